@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// annPath is where the HNSW search graph of the index is kept
+func annPath() string {
+	return settings.IndexFile + ".hnsw"
+}
+
+// openANN returns the search graph of a large index, or nil for an index
+// small enough to score every chunk
+func openANN(chunks []storage.CodeChunk) *search.ANN {
+	if len(chunks) < search.ANNMinChunks {
+		return nil
+	}
+
+	start := time.Now()
+	ann, err := search.OpenANN(annPath(), chunks)
+	if err != nil {
+		slog.Warn("Failed to save the search graph", "path", annPath(), "error", err)
+	}
+	slog.Debug("Opened search graph", "chunks", ann.Len(), "duration", time.Since(start))
+	return ann
+}
+
+// streamSearch streams the k chunks most similar to a query embedding,
+// through ann when it is set and by scoring every chunk otherwise
+func streamSearch(ctx context.Context, ann *search.ANN, chunks []storage.CodeChunk, query []float32, k int) <-chan search.Result {
+	if ann != nil {
+		return ann.Stream(ctx, query, k)
+	}
+	return search.Stream(ctx, chunks, query, k)
+}
+
+// annCache keeps the search graph between requests, reopening it when the
+// index file or its summaries change
+type annCache struct {
+	mu       sync.Mutex
+	modTimes [2]time.Time // Of the index and of its summary cache
+	ann      *search.ANN
+}
+
+// get returns the search graph of chunks, the current contents of the index
+// and its summaries
+func (c *annCache) get(chunks []storage.CodeChunk) *search.ANN {
+	info, err := os.Stat(settings.IndexFile)
+	if err != nil {
+		return openANN(chunks)
+	}
+	modTimes := [2]time.Time{info.ModTime()}
+	if info, err := os.Stat(summarization.SummaryCachePath(settings.IndexFile)); err == nil {
+		modTimes[1] = info.ModTime()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ann == nil || !modTimes[0].Equal(c.modTimes[0]) || !modTimes[1].Equal(c.modTimes[1]) {
+		c.ann, c.modTimes = openANN(chunks), modTimes
+	}
+	return c.ann
+}
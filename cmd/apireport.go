@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Report sections, in the order they are written
+var apiReportSections = []struct {
+	kind  string
+	title string
+}{
+	{"type", "Types"},
+	{"function", "Functions"},
+	{"method", "Methods"},
+	{"endpoint", "HTTP Endpoints"},
+	{"grpc", "gRPC Services"},
+}
+
+// APIReport lists the exported functions, types, and endpoints of a codebase,
+// grouped by package
+func APIReport(dir string, args []string) {
+	start := time.Now()
+	describe := false
+	for _, arg := range args {
+		if arg == "--describe" {
+			describe = true
+		}
+	}
+
+	files, err := fileutils.GetCodeFiles(dir)
+	if err != nil {
+		log.Fatalf("Failed to list files: %v", err)
+	}
+
+	var symbols []embeddings.APISymbol
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("Failed to read file", "file", file, "error", err)
+			continue
+		}
+
+		fileSymbols, err := embeddings.ExtractAPISymbols(file, dir, string(content))
+		if err != nil {
+			slog.Warn("Failed to parse file", "file", file, "error", err)
+			continue
+		}
+
+		for _, symbol := range fileSymbols {
+			if rel, err := filepath.Rel(dir, symbol.File); err == nil {
+				symbol.File = rel
+			}
+			// Languages without packages are grouped by directory
+			if symbol.Package == "" {
+				symbol.Package = filepath.Dir(symbol.File)
+			}
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	var descriptions map[string]string
+	if describe && len(symbols) > 0 {
+		slog.Info("Describing symbols", "symbols", len(symbols))
+		descriptions, err = summarization.DescribeSymbols(symbols)
+		if err != nil {
+			slog.Warn("Some symbols have no description", "error", err)
+		}
+	}
+
+	writeSummary("API report: "+dir, buildAPIReport(symbols, descriptions), parseSummaryOutput(args))
+	slog.Info("Found public symbols", "symbols", len(symbols), "files", len(files), "duration", time.Since(start))
+}
+
+// buildAPIReport renders symbols as markdown, one section per package
+func buildAPIReport(symbols []embeddings.APISymbol, descriptions map[string]string) string {
+	byPackage := make(map[string][]embeddings.APISymbol)
+	for _, symbol := range symbols {
+		byPackage[symbol.Package] = append(byPackage[symbol.Package], symbol)
+	}
+
+	var packages []string
+	for pkg := range byPackage {
+		packages = append(packages, pkg)
+	}
+	sort.Strings(packages)
+
+	var sb strings.Builder
+	sb.WriteString("# Public API\n")
+	if len(packages) == 0 {
+		sb.WriteString("\nNo exported symbols or endpoints found.\n")
+	}
+
+	for _, pkg := range packages {
+		sb.WriteString(fmt.Sprintf("\n## %s\n", pkg))
+
+		for _, section := range apiReportSections {
+			var entries []embeddings.APISymbol
+			for _, symbol := range byPackage[pkg] {
+				if symbol.Kind == section.kind {
+					entries = append(entries, symbol)
+				}
+			}
+			if len(entries) == 0 {
+				continue
+			}
+
+			sort.SliceStable(entries, func(i, j int) bool {
+				return apiSymbolName(entries[i]) < apiSymbolName(entries[j])
+			})
+
+			sb.WriteString(fmt.Sprintf("\n### %s\n\n", section.title))
+			for _, symbol := range entries {
+				sb.WriteString(fmt.Sprintf("- `%s` (%s:%d)", apiSymbolName(symbol), symbol.File, symbol.Line))
+				if description := descriptions[summarization.SymbolKey(symbol)]; description != "" {
+					sb.WriteString(" - " + description)
+				}
+				sb.WriteString("\n")
+				if symbol.Kind != "endpoint" && symbol.Kind != "grpc" {
+					sb.WriteString(fmt.Sprintf("  - `%s`\n", symbol.Signature))
+				}
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// apiSymbolName returns a symbol's name qualified by its receiver type
+func apiSymbolName(symbol embeddings.APISymbol) string {
+	if symbol.Receiver != "" {
+		return symbol.Receiver + "." + symbol.Name
+	}
+	return symbol.Name
+}
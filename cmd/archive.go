@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/archive"
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Default path of an exported index archive
+const DefaultArchivePath = "index.codie.zst"
+
+// Export writes the index, its settings fingerprint, and metadata to a
+// compressed archive that "codie import" can load on another machine. Chunk
+// paths are stored relative to --root (default: the current directory).
+func Export(args []string) {
+	outPath := DefaultArchivePath
+	root := "."
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--out=") {
+			outPath = strings.TrimPrefix(arg, "--out=")
+		} else if strings.HasPrefix(arg, "--root=") {
+			root = strings.TrimPrefix(arg, "--root=")
+		}
+	}
+
+	chunks, err := openStoreAnyModel().Load()
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	manifest := archive.Manifest{
+		CreatedAt:      time.Now().UTC(),
+		EmbeddingModel: storage.Current.EmbeddingModel, // The index's, whatever is configured
+		Fingerprint:    settings.IndexFingerprint(),
+		Settings: archive.Settings{
+			Provider:     settings.Provider,
+			MaxChunkSize: settings.MaxChunkSize,
+			ChunkOverlap: settings.ChunkOverlap,
+			Ignore:       settings.Ignore,
+		},
+	}
+	if commit, err := gitdiff.ResolveRevision(root, "HEAD"); err == nil {
+		manifest.GitCommit = commit
+	}
+
+	file, err := os.Create(outPath)
+	if err != nil {
+		log.Fatalf("Failed to create archive: %v", err)
+	}
+	if err := archive.Write(file, manifest, chunks, root); err != nil {
+		file.Close()
+		os.Remove(outPath)
+		log.Fatalf("Failed to write archive: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("Failed to write archive: %v", err)
+	}
+
+	info, _ := os.Stat(outPath)
+	report := struct {
+		Path      string `json:"path"`
+		SizeBytes int64  `json:"size_bytes"`
+		Root      string `json:"root"`
+		Chunks    int    `json:"chunks"`
+	}{outPath, info.Size(), root, len(chunks)}
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	fmt.Printf("Exported %d chunks under %s to %s (%s)\n", report.Chunks, root, outPath, formatBytes(report.SizeBytes))
+}
+
+// Import replaces the index with the contents of an archive written by
+// Export. Chunk paths are rebased onto --root (default: the current
+// directory). An archive embedded with a different model than the one
+// configured is refused unless --force is given, as its vectors can't be
+// compared with new query embeddings.
+func Import(args []string) {
+	var archivePath string
+	root := "."
+	force := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--root=") {
+			root = strings.TrimPrefix(arg, "--root=")
+		} else if arg == "--force" {
+			force = true
+		} else if !strings.HasPrefix(arg, "--") && archivePath == "" {
+			archivePath = arg
+		}
+	}
+	if archivePath == "" {
+		archivePath = DefaultArchivePath
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		log.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	manifest, chunks, err := archive.Read(file, root)
+	if err != nil {
+		log.Fatalf("Failed to read archive %s: %v", archivePath, err)
+	}
+
+	if manifest.EmbeddingModel != settings.EmbeddingModel && !force {
+		log.Fatalf("Archive was embedded with %s but %s is configured; set --embedding-model=%s or pass --force",
+			manifest.EmbeddingModel, settings.EmbeddingModel, manifest.EmbeddingModel)
+	}
+	if manifest.Fingerprint != settings.IndexFingerprint() {
+		slog.Warn("Archive was built with different index settings; re-indexed files will be chunked differently",
+			"archive", manifest.Settings, "fingerprint", manifest.Fingerprint)
+	}
+
+	if err := openStore().Save(chunks); err != nil {
+		log.Fatalf("Failed to save index: %v", err)
+	}
+
+	if settings.JSONOutput {
+		printJSON(struct {
+			IndexFile string           `json:"index_file"`
+			Manifest  archive.Manifest `json:"manifest"`
+		}{settings.IndexFile, manifest})
+		return
+	}
+	fmt.Printf("Imported %d chunks of %d files into %s\n", manifest.Chunks, manifest.Files, settings.IndexFile)
+	if manifest.GitCommit != "" {
+		fmt.Printf("Built from commit %s on %s\n", manifest.GitCommit, manifest.CreatedAt.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Fewest tokens --max-context-tokens may leave the excerpts, enough for one
+// trimmed excerpt
+const minAskContextTokens = 100
+
+// parseAskOptions parses the options of ask, which serve takes too as the
+// defaults of its Ask method
+func parseAskOptions(args []string) summarization.AskOptions {
+	var options summarization.AskOptions
+	for _, arg := range args {
+		if arg == "--rerank" {
+			options.Rerank = true
+		} else if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			options.TopK = n
+		} else if strings.HasPrefix(arg, "--min-score=") {
+			s, err := strconv.ParseFloat(strings.TrimPrefix(arg, "--min-score="), 32)
+			if err != nil || s < 0 || s > 1 {
+				log.Fatalf("Invalid --min-score value %q: must be a similarity between 0 and 1", arg)
+			}
+			options.MinScore = float32(s)
+		} else if strings.HasPrefix(arg, "--max-context-tokens=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-context-tokens="))
+			if err != nil || n < minAskContextTokens {
+				log.Fatalf("Invalid --max-context-tokens value %q: must be at least %d", arg, minAskContextTokens)
+			}
+			options.MaxContextTokens = n
+		}
+	}
+	return options
+}
+
+// Ask answers a question about the indexed codebase from the chunks most
+// relevant to it, and lists the chunks the answer was based on
+func Ask(question string, args []string) {
+	options := parseAskOptions(args)
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index before answering from it
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadFromJSON(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+	chunks = withSummaries(chunks)
+
+	answer, sources, err := summarization.AnswerQuestion(commandCtx, chunks, question, options)
+	if err != nil {
+		log.Fatalf("Failed to answer: %v", err)
+	}
+
+	if settings.JSONOutput {
+		hits := []SearchHit{}
+		for i, result := range sources {
+			hits = append(hits, newSearchHit(i+1, result))
+		}
+		printJSON(struct {
+			Question string      `json:"question"`
+			Answer   string      `json:"answer"`
+			Sources  []SearchHit `json:"sources"`
+		}{question, answer, hits})
+		return
+	}
+
+	fmt.Println(answer)
+	if len(sources) == 0 {
+		return
+	}
+	fmt.Println("\nSources:")
+	for _, result := range sources {
+		fmt.Printf("  %s (score %.3f)", chunkLocation(result.Chunk), result.Score)
+		if symbol := chunkSymbol(result.Chunk); symbol != "" {
+			fmt.Printf(" %s", symbol)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/exolottl/codie/internal/config"
+)
+
+// Auth manages the OpenAI API key stored in the OS keychain
+func Auth(subcommand string) {
+	var err error
+	switch subcommand {
+	case "login":
+		err = config.Login()
+	case "logout":
+		err = config.Logout()
+	default:
+		log.Fatalf("Unknown auth command %q: use 'auth login' or 'auth logout'", subcommand)
+	}
+
+	if err != nil {
+		log.Fatalf("Authentication error: %v", err)
+	}
+}
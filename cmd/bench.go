@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/fileutils"
+)
+
+// BenchStage is the timing and memory use of one stage of the indexing
+// pipeline
+type BenchStage struct {
+	Name           string  `json:"name"`
+	DurationMS     float64 `json:"duration_ms"`
+	Items          int     `json:"items"` // Files discovered, chunks produced, or chunks embedded
+	Unit           string  `json:"unit"`
+	ItemsPerSecond float64 `json:"items_per_second"`
+	AllocatedBytes uint64  `json:"allocated_bytes"` // Allocated during the stage, including memory since freed
+	HeapBytes      uint64  `json:"heap_bytes"`      // Live heap at the end of the stage
+	GCRuns         uint32  `json:"gc_runs"`
+}
+
+// BenchReport is the outcome of benchmarking the indexing pipeline on a
+// directory, printed with --json
+type BenchReport struct {
+	Directory          string       `json:"directory"`
+	GoVersion          string       `json:"go_version"`
+	CPUs               int          `json:"cpus"`
+	Workers            int          `json:"workers"`             // Files chunked concurrently
+	ConcurrentRequests int          `json:"concurrent_requests"` // Embedding requests in flight at once
+	BatchSize          int          `json:"batch_size"`
+	Bytes              int64        `json:"bytes"` // Size of the files read
+	Stages             []BenchStage `json:"stages"`
+	TotalMS            float64      `json:"total_ms"`
+	PeakSysBytes       uint64       `json:"peak_sys_bytes"` // Memory obtained from the OS by the end of the run
+}
+
+// Bench runs discovery, chunking, and embedding with the mock provider over
+// a directory, timing each stage, so changes to the pipeline's performance
+// can be measured without calling an API or writing an index
+func Bench(dir string, args []string) {
+	// Embeddings come from the mock provider, unthrottled by the rate limits
+	// configured for the real one
+	embeddings.Provider = "mock"
+	embeddings.SetRateLimit(0, 0, settings.MaxConcurrentRequests)
+
+	workers := settings.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	report := BenchReport{
+		Directory:          dir,
+		GoVersion:          runtime.Version(),
+		CPUs:               runtime.NumCPU(),
+		Workers:            workers,
+		ConcurrentRequests: settings.MaxConcurrentRequests,
+		BatchSize:          settings.BatchSize,
+	}
+	options := parseIndexOptions(args)
+	options.Root = dir
+	start := time.Now()
+
+	var files []string
+	report.Stages = append(report.Stages, benchStage("discovery", "files", func() int {
+		var err error
+		if files, err = discoverFiles(commandCtx, dir, options.Git); err != nil {
+			log.Fatalf("Error scanning directory: %v", err)
+		}
+		return len(files)
+	}))
+	if len(files) == 0 {
+		log.Fatal("No code files found in the specified directory")
+	}
+
+	var texts []string
+	report.Stages = append(report.Stages, benchStage("chunking", "chunks", func() int {
+		texts, report.Bytes = benchChunkFiles(files, options, workers)
+		return len(texts)
+	}))
+
+	report.Stages = append(report.Stages, benchStage("embedding", "chunks", func() int {
+		embedded, err := embeddings.GetBatchEmbeddingsContext(commandCtx, texts, settings.BatchSize)
+		if err != nil {
+			log.Fatalf("Failed to embed chunks: %v", err)
+		}
+		return len(embedded)
+	}))
+
+	report.TotalMS = float64(time.Since(start).Microseconds()) / 1000
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	report.PeakSysBytes = memStats.Sys
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	printBenchReport(report)
+}
+
+// benchStage runs a stage, returning its timing and memory use along with
+// the number of items it reported processing
+func benchStage(name, unit string, run func() int) BenchStage {
+	slog.Info("Benchmarking stage", "stage", name)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	items := run()
+	elapsed := time.Since(start)
+
+	runtime.ReadMemStats(&after)
+	stage := BenchStage{
+		Name:           name,
+		DurationMS:     float64(elapsed.Microseconds()) / 1000,
+		Items:          items,
+		Unit:           unit,
+		AllocatedBytes: after.TotalAlloc - before.TotalAlloc,
+		HeapBytes:      after.HeapAlloc,
+		GCRuns:         after.NumGC - before.NumGC,
+	}
+	if elapsed > 0 {
+		stage.ItemsPerSecond = float64(items) / elapsed.Seconds()
+	}
+	return stage
+}
+
+// benchChunkFiles reads and chunks files on workers goroutines as indexing
+// does, returning the text embedded for each chunk and the bytes read
+func benchChunkFiles(files []string, options IndexOptions, workers int) ([]string, int64) {
+	filesChan := make(chan string, len(files))
+	for _, file := range files {
+		filesChan <- file
+	}
+	close(filesChan)
+
+	var mu sync.Mutex
+	var texts []string
+	var bytes int64
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range filesChan {
+				content, err := fileutils.ReadFileContent(file)
+				if err != nil {
+					slog.Debug("Failed to read file", "file", file, "error", err)
+					continue
+				}
+				chunks, err := embeddings.ExtractCodeChunks(file, content, embeddings.ChunkOptions{
+					MaxChunkSize: settings.MaxChunkSize,
+					Overlap:      options.ChunkOverlap,
+					MaxChunks:    settings.MaxChunksPerFile,
+					Root:         options.Root,
+				})
+				if err != nil {
+					slog.Debug("Failed to chunk file", "file", file, "error", err)
+					continue
+				}
+
+				mu.Lock()
+				bytes += int64(len(content))
+				for _, chunk := range chunks {
+					texts = append(texts, chunk.EmbeddingText())
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return texts, bytes
+}
+
+// printBenchReport prints the stages of a benchmark as a table
+func printBenchReport(report BenchReport) {
+	fmt.Printf("\nBenchmark of %s (%s, %d CPUs)\n", report.Directory, report.GoVersion, report.CPUs)
+	fmt.Printf("  Workers: %d, concurrent embedding requests: %d, batch size: %d\n", report.Workers, report.ConcurrentRequests, report.BatchSize)
+	fmt.Printf("  Read:    %s\n\n", formatBytes(report.Bytes))
+
+	fmt.Printf("  %-10s %10s %14s %16s %12s %12s %4s\n", "Stage", "Time", "Items", "Rate", "Allocated", "Heap", "GCs")
+	for _, stage := range report.Stages {
+		fmt.Printf("  %-10s %10s %14s %16s %12s %12s %4d\n",
+			stage.Name,
+			time.Duration(stage.DurationMS*float64(time.Millisecond)).Round(time.Microsecond*100),
+			fmt.Sprintf("%d %s", stage.Items, stage.Unit),
+			fmt.Sprintf("%.0f/s", stage.ItemsPerSecond),
+			formatBytes(int64(stage.AllocatedBytes)),
+			formatBytes(int64(stage.HeapBytes)),
+			stage.GCRuns)
+	}
+	fmt.Printf("  %-10s %10s\n", "total", time.Duration(report.TotalMS*float64(time.Millisecond)).Round(time.Microsecond*100))
+	fmt.Printf("\n  Memory obtained from the OS: %s\n", formatBytes(int64(report.PeakSysBytes)))
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Changelog drafts release notes for the commits since a tag or other
+// revision, grouped by area
+func Changelog(args []string) {
+	start := time.Now()
+	diffRange := DiffRange{RepoDir: ".", To: "HEAD"}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--since=") {
+			diffRange.From = strings.TrimPrefix(arg, "--since=")
+		} else if strings.HasPrefix(arg, "--to=") {
+			diffRange.To = strings.TrimPrefix(arg, "--to=")
+		} else if strings.HasPrefix(arg, "--repo=") {
+			diffRange.RepoDir = strings.TrimPrefix(arg, "--repo=")
+		}
+	}
+	if diffRange.From == "" {
+		log.Fatal("Usage: go run main.go changelog --since=<tag> [--to=<rev>] [options]")
+	}
+	for _, rev := range []string{diffRange.From, diffRange.To} {
+		if _, err := gitdiff.ResolveRevision(diffRange.RepoDir, rev); err != nil {
+			log.Fatalf("Invalid revision: %v", err)
+		}
+	}
+
+	slog.Info("Drafting release notes", "from", diffRange.From, "to", diffRange.To)
+	input := loadDiffSummaryInput(diffRange, args)
+	slog.Info("Found changes", "commits", len(input.Commits), "files", len(input.Changes))
+
+	changelog, err := summarization.GenerateChangelog(commandCtx, input, parseSummaryOptions(args))
+	if err != nil {
+		log.Fatalf("Failed to generate changelog: %v", err)
+	}
+
+	writeSummary(fmt.Sprintf("Changes since %s", diffRange.From), changelog, parseSummaryOutput(args))
+	slog.Info("Changelog complete", "duration", time.Since(start))
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/github"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Tasks the ci command can run
+var ciTasks = []string{"summary", "review"}
+
+// CIResult is what a ci run produced, written to result.json in the
+// artifacts directory
+type CIResult struct {
+	Event       string         `json:"event"`
+	PullRequest int            `json:"pull_request,omitempty"`
+	Base        string         `json:"base,omitempty"`
+	Head        string         `json:"head,omitempty"`
+	Index       CIIndex        `json:"index"`
+	SummaryFile string         `json:"summary_file,omitempty"`
+	ReviewFile  string         `json:"review_file,omitempty"`
+	ReviewJSON  string         `json:"review_json,omitempty"`
+	Comments    map[string]int `json:"comments,omitempty"` // Review comments by severity
+	DurationMS  int64          `json:"duration_ms"`
+}
+
+// CIIndex describes the index a ci run used
+type CIIndex struct {
+	File   string `json:"file"`
+	Action string `json:"action"` // "built", or "refreshed" when restored from a cache
+	Chunks int    `json:"chunks"`
+}
+
+// CI runs codie as a CI step. It reads the repository and triggering event
+// from the GitHub Actions environment, builds the index or refreshes one
+// restored from a cache, and writes a summary and, for pull requests, a
+// review to an artifacts directory. Paths and counts are written as step
+// outputs, the reports to the job summary, and review comments as
+// annotations.
+func CI(args []string) {
+	start := time.Now()
+	dir := os.Getenv("GITHUB_WORKSPACE")
+	if dir == "" {
+		dir = "."
+	}
+	artifacts := "codie-artifacts"
+	if temp := os.Getenv("RUNNER_TEMP"); temp != "" {
+		artifacts = filepath.Join(temp, "codie")
+	}
+	var tasks []string
+	base, head := "", "HEAD"
+	failOn := ""
+
+	result := CIResult{Event: os.Getenv("GITHUB_EVENT_NAME")}
+	if event := github.LoadPullRequestEvent(); event != nil {
+		base, head = event.PullRequest.Base.SHA, event.PullRequest.Head.SHA
+		result.PullRequest = event.PullRequest.Number
+	}
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--dir=") {
+			dir = strings.TrimPrefix(arg, "--dir=")
+		} else if strings.HasPrefix(arg, "--artifacts=") {
+			artifacts = strings.TrimPrefix(arg, "--artifacts=")
+		} else if strings.HasPrefix(arg, "--tasks=") {
+			tasks = strings.Split(strings.TrimPrefix(arg, "--tasks="), ",")
+			for _, task := range tasks {
+				if !contains(ciTasks, task) {
+					log.Fatalf("Invalid --tasks value %q: must be a list of %s", task, strings.Join(ciTasks, ", "))
+				}
+			}
+		} else if strings.HasPrefix(arg, "--base=") {
+			base = strings.TrimPrefix(arg, "--base=")
+		} else if strings.HasPrefix(arg, "--head=") {
+			head = strings.TrimPrefix(arg, "--head=")
+		} else if strings.HasPrefix(arg, "--fail-on=") {
+			failOn = strings.TrimPrefix(arg, "--fail-on=")
+			if summarization.ReviewSeverityRank(failOn) < 0 {
+				log.Fatalf("Invalid --fail-on value %q: must be one of %s", failOn, strings.Join(summarization.ReviewSeverities, ", "))
+			}
+		}
+	}
+
+	// Pull requests are summarized and reviewed; other events summarize the repository
+	if tasks == nil {
+		tasks = []string{"summary"}
+		if base != "" {
+			tasks = append(tasks, "review")
+		}
+	}
+	if contains(tasks, "review") && base == "" {
+		log.Fatal("Reviewing needs a pull_request event or --base=<ref>")
+	}
+	if err := os.MkdirAll(artifacts, 0755); err != nil {
+		log.Fatalf("Failed to create artifacts directory: %v", err)
+	}
+
+	result.Index = updateCIIndex(dir, parseIndexOptions(args))
+	options := parseSummaryOptions(args)
+	var stepSummary strings.Builder
+
+	// The diff of a pull request, loaded once for both tasks
+	var input *summarization.DiffSummaryInput
+	if base != "" {
+		mergeBase, err := gitdiff.MergeBase(dir, base, head)
+		if err != nil {
+			log.Fatalf("Failed to find merge base of %s and %s (is the clone shallow?): %v", base, head, err)
+		}
+		result.Base, result.Head = base, head
+		loaded := loadDiffSummaryInput(DiffRange{RepoDir: dir, From: mergeBase, To: head}, args)
+		loaded.From, loaded.To = base, head
+		input = &loaded
+	}
+
+	if contains(tasks, "summary") {
+		var summary string
+		var err error
+		if input != nil {
+			slog.Info("Summarizing pull request", "from", base, "to", head)
+			summary, err = summarization.GenerateDiffSummary(commandCtx, *input, options)
+		} else {
+			slog.Info("Generating codebase summary")
+			var repoSummary summarization.SummaryResult
+			repoSummary, err = summarization.GenerateRepoSummary(commandCtx, settings.IndexFile, options)
+			summary = repoSummary.Text
+		}
+		if err != nil {
+			log.Fatalf("Failed to generate summary: %v", err)
+		}
+		result.SummaryFile = writeArtifact(artifacts, "summary.md", summary+"\n")
+		stepSummary.WriteString(summary + "\n\n")
+	}
+
+	var review summarization.Review
+	if contains(tasks, "review") {
+		slog.Info("Reviewing pull request", "files", len(input.Changes))
+		var err error
+		review, err = summarization.GenerateReview(commandCtx, *input, options)
+		if err != nil {
+			log.Fatalf("Failed to review changes: %v", err)
+		}
+		report := buildReviewReport(review)
+		data, err := json.MarshalIndent(review, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode review: %v", err)
+		}
+		result.ReviewFile = writeArtifact(artifacts, "review.md", report)
+		result.ReviewJSON = writeArtifact(artifacts, "review.json", string(data)+"\n")
+		result.Comments = make(map[string]int)
+		for _, comment := range review.Comments {
+			result.Comments[comment.Severity]++
+		}
+		stepSummary.WriteString(report + "\n")
+		if !settings.JSONOutput {
+			printAnnotations(review.Comments)
+		}
+	}
+
+	result.DurationMS = time.Since(start).Milliseconds()
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode result: %v", err)
+	}
+	resultFile := writeArtifact(artifacts, "result.json", string(data)+"\n")
+
+	outputs := map[string]string{
+		"result-file":  resultFile,
+		"summary-file": result.SummaryFile,
+		"review-file":  result.ReviewFile,
+		"review-json":  result.ReviewJSON,
+		"comments":     fmt.Sprint(len(review.Comments)),
+	}
+	if err := appendGitHubFile("GITHUB_OUTPUT", formatOutputs(outputs)); err != nil {
+		slog.Warn("Failed to write step outputs", "error", err)
+	}
+	if err := appendGitHubFile("GITHUB_STEP_SUMMARY", stepSummary.String()); err != nil {
+		slog.Warn("Failed to write job summary", "error", err)
+	}
+	if settings.JSONOutput {
+		printJSON(result)
+	}
+	slog.Info("CI run complete", "artifacts", artifacts, "duration", time.Since(start))
+
+	if failOn != "" {
+		if failing := review.CountAtLeast(failOn); failing > 0 {
+			log.Fatalf("Review found %d comments of severity %s or worse", failing, failOn)
+		}
+	}
+}
+
+// updateCIIndex builds the index of dir, or brings an index restored from a
+// cache up to date with the checked out commit
+func updateCIIndex(dir string, options IndexOptions) CIIndex {
+	index := CIIndex{File: settings.IndexFile, Action: "built"}
+	refreshed := false
+	if metadata, err := storage.LoadMetadata(settings.IndexFile); err == nil && metadata.Commit != "" {
+		// A shallow clone may not have the commit the cached index was built at
+		if _, err := gitdiff.ResolveRevision(dir, metadata.Commit); err != nil {
+			slog.Info("Commit of the cached index isn't in the clone; rebuilding it", "commit", metadata.Commit)
+		} else if err := refreshIndexSince(dir, metadata.Commit, options); err != nil {
+			slog.Warn("Failed to refresh the cached index; rebuilding it", "error", err)
+		} else {
+			refreshed = true
+			index.Action = "refreshed"
+		}
+	}
+	if !refreshed {
+		indexCodebase(dir, options)
+	}
+
+	if chunks, err := storage.LoadFromJSON(settings.IndexFile); err == nil {
+		index.Chunks = len(chunks)
+	}
+	return index
+}
+
+// writeArtifact writes a file to the artifacts directory and returns its path
+func writeArtifact(dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+// formatOutputs renders step outputs as the name=value lines GitHub Actions
+// reads from GITHUB_OUTPUT, leaving out empty ones
+func formatOutputs(outputs map[string]string) string {
+	names := make([]string, 0, len(outputs))
+	for name, value := range outputs {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + "=" + outputs[name] + "\n")
+	}
+	return sb.String()
+}
+
+// appendGitHubFile appends to the file GitHub Actions names in an
+// environment variable, such as GITHUB_OUTPUT. Outside Actions it does nothing.
+func appendGitHubFile(variable, content string) error {
+	path := os.Getenv(variable)
+	if path == "" || content == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(content)
+	return err
+}
+
+// printAnnotations prints review comments as GitHub Actions workflow
+// commands, which show them on the lines of the pull request diff
+func printAnnotations(comments []summarization.ReviewComment) {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return
+	}
+	levels := map[string]string{"blocker": "error", "major": "error", "minor": "warning", "nit": "notice"}
+	for _, comment := range comments {
+		properties := fmt.Sprintf("file=%s,line=%d", escapeProperty(comment.File), comment.Line)
+		if comment.EndLine > comment.Line {
+			properties += fmt.Sprintf(",endLine=%d", comment.EndLine)
+		}
+		properties += ",title=" + escapeProperty(fmt.Sprintf("codie: %s %s", comment.Severity, comment.Category))
+		fmt.Printf("::%s %s::%s\n", levels[comment.Severity], properties, escapeData(comment.Message))
+	}
+}
+
+// escapeData escapes the message of a workflow command
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a property value of a workflow command
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/exolottl/codie/internal/config"
+)
+
+// Files in the data directory that clean keeps unless --all is given, as
+// they are written by hand
+var cleanKeptFiles = map[string]bool{"config.yaml": true, "config.yml": true, ".env": true}
+
+// CleanReport lists what clean removed, or would remove
+type CleanReport struct {
+	Dir        string   `json:"dir"`
+	Removed    []string `json:"removed"`
+	FreedBytes int64    `json:"freed_bytes"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+// Clean removes the index, checkpoints, search graph, and other files Codie
+// wrote to the data directory. Config files are kept unless --all is given.
+func Clean(args []string) {
+	dryRun, all := false, false
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRun = true
+		} else if arg == "--all" {
+			all = true
+		}
+	}
+
+	dir := config.DataDir()
+	report := CleanReport{Dir: dir, Removed: []string{}, DryRun: dryRun}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		if cleanKeptFiles[entry.Name()] && !all {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		report.FreedBytes += diskUsage(path)
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				log.Fatalf("Failed to remove %s: %v", path, err)
+			}
+		}
+		report.Removed = append(report.Removed, path)
+	}
+	// Nothing is left of a directory cleaned with --all
+	if all && !dryRun {
+		os.Remove(dir)
+	}
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	switch {
+	case len(report.Removed) == 0:
+		fmt.Printf("Nothing to clean in %s\n", dir)
+	case dryRun:
+		printFileList(fmt.Sprintf("Would remove (%d, %s):", len(report.Removed), formatBytes(report.FreedBytes)), report.Removed)
+	default:
+		fmt.Printf("Removed %d files from %s, freeing %s\n", len(report.Removed), dir, formatBytes(report.FreedBytes))
+	}
+}
+
+// diskUsage returns the size of a file, or of the files under a directory
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
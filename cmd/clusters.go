@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/exolottl/codie/internal/cluster"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Default number of files listed for each cluster
+const DefaultClusterFiles = 10
+
+// Number of a cluster's most central chunks shown to the model to label it
+const clusterSamples = 3
+
+// Topic is a cluster of similar chunks: a functional area of the codebase
+type Topic struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Chunks      int      `json:"chunks"`
+	FileCount   int      `json:"file_count"`
+	Files       []string `json:"files"`
+}
+
+// Clusters groups the indexed chunks by topic with k-means over their
+// embeddings and prints the functional areas of the codebase, each named by
+// the model from its most representative chunks, with the files it spans
+func Clusters(args []string) {
+	k := 0
+	label := true
+	maxFiles := DefaultClusterFiles
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--k=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--k="))
+			if err != nil || n < 2 {
+				log.Fatalf("Invalid --k value %q: must be an integer of at least 2", arg)
+			}
+			k = n
+		} else if strings.HasPrefix(arg, "--files=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--files="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --files value %q: must be a positive integer", arg)
+			}
+			maxFiles = n
+		} else if arg == "--no-label" {
+			label = false
+		}
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	if k == 0 {
+		k = defaultClusterCount(len(chunks))
+	}
+	if len(chunks) < k {
+		log.Fatalf("The index has %d chunks, too few for %d clusters", len(chunks), k)
+	}
+
+	vectors := make([][]float32, len(chunks))
+	for i, chunk := range chunks {
+		vectors[i] = chunk.Embedding
+	}
+	result := cluster.KMeans(vectors, k, 1)
+
+	// Collect each cluster's chunks, most central first
+	members := make([][]int, len(result.Centroids))
+	for i, c := range result.Assignments {
+		if c >= 0 {
+			members[c] = append(members[c], i)
+		}
+	}
+	for _, m := range members {
+		slices.SortStableFunc(m, func(a, b int) int { return cmp.Compare(result.Similarity[b], result.Similarity[a]) })
+	}
+
+	topics := make([]Topic, len(members))
+	for c, m := range members {
+		files := clusterFiles(chunks, m)
+		topics[c] = Topic{
+			Name:      fallbackTopicName(files),
+			Chunks:    len(m),
+			FileCount: len(files),
+			Files:     files[:min(maxFiles, len(files))],
+		}
+	}
+
+	if label {
+		samples := make([][]storage.CodeChunk, len(members))
+		for c, m := range members {
+			for _, i := range m[:min(clusterSamples, len(m))] {
+				samples[c] = append(samples[c], chunks[i])
+			}
+		}
+		labels, err := summarization.LabelTopics(commandCtx, samples)
+		if err != nil {
+			slog.Warn("Naming clusters by their files", "error", err)
+		} else {
+			for c, l := range labels {
+				if l.Name != "" {
+					topics[c].Name = l.Name
+					topics[c].Description = l.Description
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(topics, func(a, b Topic) int { return cmp.Compare(b.Chunks, a.Chunks) })
+
+	if settings.JSONOutput {
+		printJSON(topics)
+		return
+	}
+
+	for i, topic := range topics {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%d. %s (%d chunks in %d files)\n", i+1, topic.Name, topic.Chunks, topic.FileCount)
+		if topic.Description != "" {
+			fmt.Printf("   %s\n", topic.Description)
+		}
+		for _, file := range topic.Files {
+			fmt.Printf("   - %s\n", file)
+		}
+		if more := topic.FileCount - len(topic.Files); more > 0 {
+			fmt.Printf("   ... and %d more\n", more)
+		}
+	}
+}
+
+// defaultClusterCount picks a number of clusters that grows slowly with the
+// size of the index
+func defaultClusterCount(chunks int) int {
+	k := int(math.Round(math.Sqrt(float64(chunks) / 10)))
+	return max(2, min(k, 15))
+}
+
+// clusterFiles returns the files of a cluster's chunks, those with the most
+// chunks in the cluster first
+func clusterFiles(chunks []storage.CodeChunk, members []int) []string {
+	counts := make(map[string]int)
+	var files []string
+	for _, i := range members {
+		file := chunks[i].File
+		if counts[file] == 0 {
+			files = append(files, file)
+		}
+		counts[file]++
+	}
+	slices.SortStableFunc(files, func(a, b string) int { return cmp.Compare(counts[b], counts[a]) })
+	return files
+}
+
+// fallbackTopicName names an unlabeled cluster after the directory holding
+// most of its files
+func fallbackTopicName(files []string) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		counts[dir]++
+		if counts[dir] > counts[best] {
+			best = dir
+		}
+	}
+	if best == "" {
+		return "Unassigned"
+	}
+	return best
+}
@@ -1,242 +1,708 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"runtime"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"codie/internal/embeddings"
-	"codie/internal/fileutils"
-	"codie/internal/storage"
-	"codie/internal/summarization"
-	"github.com/charmbracelet/glamour"
-	"github.com/schollz/progressbar/v3"
+	"github.com/exolottl/codie/internal/bedrock"
+	"github.com/exolottl/codie/internal/config"
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/httpclient"
+	"github.com/exolottl/codie/internal/local"
+	"github.com/exolottl/codie/internal/logging"
+	"github.com/exolottl/codie/internal/progress"
+	"github.com/exolottl/codie/internal/retry"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+	"github.com/exolottl/codie/internal/vertex"
+	"github.com/exolottl/codie/pkg/index"
+	"github.com/sashabaranov/go-openai"
 )
 
-// Default maximum chunk size for code splitting
-const DefaultMaxChunkSize = 8000
+// Settings for this run, loaded from the config file, environment, and flags
+var settings = config.DefaultSettings()
 
-// Default embeddings file name
-const DefaultEmbeddingsFile = "embeddings.json"
+// ApplySettings sets the configuration used by all commands and the
+// packages they call into
+func ApplySettings(s config.Settings) {
+	settings = s
 
-// Default batch size for sending embeddings to API
-const DefaultBatchSize = 20
+	if err := httpclient.Configure(httpclient.Options{Proxy: s.Proxy, CABundle: s.CABundle, Timeout: s.RequestTimeout}); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+	embeddings.Provider = s.EmbeddingProviderName()
+	embeddings.OpenAIBaseURL = s.EmbeddingBaseURL
+	vertex.Project = s.VertexProject
+	vertex.Location = s.VertexLocation
+	bedrock.Region = s.BedrockRegion
+	local.ModelDir = s.LocalModelDir
+	local.LibraryPath = s.OnnxRuntimeLibrary
+	embeddings.EmbeddingModel = openai.EmbeddingModel(s.EmbeddingModel)
+	embeddings.BatchTokens = s.BatchTokens
+	embeddings.SetRateLimit(s.RequestsPerMinute, s.TokensPerMinute, s.MaxConcurrentRequests)
+	storage.Current = storage.Header{
+		SchemaVersion:  storage.SchemaVersion,
+		ToolVersion:    config.Version,
+		EmbeddingModel: s.EmbeddingModel,
+		ChunkerVersion: embeddings.ChunkerVersion,
+		Fingerprint:    s.IndexFingerprint(),
+	}
+	retry.Default.MaxAttempts = s.MaxAttempts
+	summarization.Provider = s.ChatProviderName()
+	summarization.OpenAIBaseURL = s.BaseURL
+	summarization.ChatModel = s.ChatModel
+	summarization.RerankModel = s.RerankModel
+	summarization.Fallbacks = nil
+	for _, provider := range s.FallbackProviders {
+		chatModel, rerankModel := config.DefaultChatModels(provider)
+		summarization.Fallbacks = append(summarization.Fallbacks, summarization.Fallback{Provider: provider, ChatModel: chatModel, RerankModel: rerankModel})
+	}
+	summarization.MaxTokens = s.MaxTokens
+	summarization.MaxPromptTokens = s.MaxPromptTokens
+	summarization.Temperature = float32(s.Temperature)
+	summarization.SetChatRateLimit(s.ChatRequestsPerMinute, s.MaxConcurrentChats)
+	summarization.RecentCommits = s.RecentCommits
+	summarization.RecencyBoost = s.RecencyBoost
+	fileutils.SetIgnorePatterns(s.Ignore)
+	fileutils.SetFollowSymlinks(s.FollowSymlinks)
+	fileutils.SetSkipVendored(s.SkipVendored)
+	fileutils.SetSkipGenerated(s.SkipGenerated)
+	if err := embeddings.SetChunkers(s.Chunkers); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+	if err := embeddings.SetEmbeddingTemplate(s.EmbeddingTemplate); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	if err := logging.Setup(s.LogLevel, s.LogFormat); err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+}
+
+// IndexOptions configures the behavior of the indexing process
+type IndexOptions struct {
+	ChunkOverlap int     // Lines of context repeated at chunk boundaries
+	DryRun       bool    // Only estimate chunks, tokens, and cost
+	MaxCost      float64 // Abort if the estimated cost exceeds this (0 disables)
+	Resume       bool    // Continue an interrupted run, skipping the files it completed
+	Git          bool    // Index only the files git tracks, recording the commit and provenance of each chunk
+	Commit       string  // Commit checked out in the indexed repository, set for Git
+	Source       string  // Repository URL the directory was cloned from, if any
+	Ref          string  // Branch, tag, or commit requested from Source
+	Repo         string  // Workspace repository the chunks are namespaced under, if any
+	Root         string  // Directory being indexed, which package paths are relative to
+	LowMemory    int     // Most chunks held in memory at once (0 leaves it unbounded)
+}
 
-// Default number of worker goroutines (0 means use NumCPU)
-const DefaultNumWorkers = 0
+// Chunks --low-memory holds in memory at once when not given a number
+const defaultLowMemoryChunks = 1000
+
+// parseIndexOptions parses index command-line options
+func parseIndexOptions(args []string) IndexOptions {
+	options := IndexOptions{
+		ChunkOverlap: settings.ChunkOverlap,
+	}
+
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			options.DryRun = true
+		} else if arg == "--resume" {
+			options.Resume = true
+		} else if arg == "--git" {
+			options.Git = true
+		} else if arg == "--low-memory" {
+			options.LowMemory = defaultLowMemoryChunks
+		} else if strings.HasPrefix(arg, "--low-memory=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--low-memory="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --low-memory value %q: must be a positive number of chunks", arg)
+			}
+			options.LowMemory = n
+		} else if strings.HasPrefix(arg, "--max-cost=") {
+			maxCost, err := strconv.ParseFloat(strings.TrimPrefix(arg, "--max-cost="), 64)
+			if err != nil || maxCost <= 0 {
+				log.Fatalf("Invalid --max-cost value %q: must be a positive amount in USD", arg)
+			}
+			options.MaxCost = maxCost
+		}
+	}
+
+	return options
+}
+
+// indexOptions returns the chunking and embedding options for these index
+// options and the current settings
+func (o IndexOptions) indexOptions() index.Options {
+	return index.Options{
+		MaxChunkSize: settings.MaxChunkSize,
+		ChunkOverlap: o.ChunkOverlap,
+		BatchSize:    settings.BatchSize,
+		Workers:      settings.Workers,
+		Commit:       o.Commit,
+		Provenance:   o.Git,
+		Repo:         o.Repo,
+		Root:         o.Root,
+
+		MaxChunksInFlight: o.LowMemory,
+
+		MaxFileSize:      settings.MaxFileSize,
+		MaxChunksPerFile: settings.MaxChunksPerFile,
+		MaxTotalChunks:   settings.MaxTotalChunks,
+	}
+}
+
+// withCommit returns the options with Commit set to the commit checked out
+// in dir when indexing only tracked files
+func (o IndexOptions) withCommit(dir string) (IndexOptions, error) {
+	if !o.Git {
+		return o, nil
+	}
+	commit, err := gitdiff.ResolveRevision(dir, "HEAD")
+	if err != nil {
+		return o, fmt.Errorf("failed to read the checked out commit: %w", err)
+	}
+	o.Commit = commit
+	return o, nil
+}
 
 // PrintUsage prints the usage information
 func PrintUsage() {
 	fmt.Println("Usage:")
+	fmt.Println("  All commands accept --usage-log=<file> to append API usage as JSON lines (or set CODIE_USAGE_LOG)")
+	fmt.Println("  Settings are read from .codie/config.yaml or .codie.yaml (or --config=<file>), CODIE_<KEY> variables, and --<key>=<value> flags")
+	fmt.Println("  Status messages and warnings go to stderr: --verbose, --quiet, --log-level=<level>, --log-format=text|json")
+	fmt.Println("  All commands accept --json to print their output to stdout as a single JSON document")
+	fmt.Println("  Commands writing a report accept --notify-webhook=<url> to also post it to Slack or Teams (or set CODIE_NOTIFY_WEBHOOK)")
+	fmt.Println("  All commands accept --base-url=<url> to use an OpenAI-compatible server such as vLLM or LM Studio (or set OPENAI_BASE_URL)")
 	fmt.Println("  go run main.go index <directory>     - Index a codebase")
+	fmt.Println("  go run main.go index <url>[#ref]     - Shallow-clone a git repository into the cache directory and index it")
+	fmt.Println("    Options:")
+	fmt.Println("      --chunk-overlap=<n> - Repeat n lines of context between consecutive chunks")
+	fmt.Println("      --dry-run          - Report files, chunks, tokens, and estimated cost without calling the API")
+	fmt.Println("      --max-cost=<usd>   - Abort if the estimated embedding cost exceeds this amount")
+	fmt.Println("      --resume           - Continue an interrupted run, skipping files it already embedded")
+	fmt.Println("      --git              - Index only files tracked by git, recording the current commit on each chunk")
+	fmt.Println("      --low-memory[=<n>] - Hold at most n chunks (default 1000) in memory at once, for very large repositories")
+	fmt.Println("      --max-file-size=<size> - Skip files larger than this, e.g. 512KB (default 1MB, 'off' to disable)")
+	fmt.Println("      --max-chunks-per-file=<n> - Skip files that split into more than n chunks")
+	fmt.Println("      --max-total-chunks=<n> - Stop embedding new files once a run has embedded n chunks")
+	fmt.Println("      --follow-symlinks  - Follow symlinks to files and directories (skipped by default)")
+	fmt.Println("      --skip-vendored=false - Index vendor/ and third_party/ directories (skipped by default)")
+	fmt.Println("      --skip-generated=false - Index generated files such as *.pb.go (skipped by default)")
+	fmt.Println("  go run main.go workspace add <directory> - Index a repository into the workspace, alongside the others")
+	fmt.Println("    Options:")
+	fmt.Println("      --name=<name>      - Name to filter the repository by (default the directory name)")
+	fmt.Println("      --chunk-overlap, --git - As for index")
+	fmt.Println("  go run main.go workspace remove <name> - Drop a repository and its chunks from the workspace")
+	fmt.Println("  go run main.go workspace list        - List the workspace repositories")
 	fmt.Println("  go run main.go summarize <directory> - Generate a summary of a codebase")
 	fmt.Println("    Options:")
+	fmt.Println("      --mode=<mode>      - Kind of document: overview (default), onboarding, security, tests, or docs")
+	fmt.Println("      --audience=<who>   - Reader of an overview: developer (default), exec, new-dev, sre, or security")
 	fmt.Println("      --detail=<level>   - Set detail level (brief, standard, comprehensive)")
-	fmt.Println("      --focus=<path>     - Focus on a specific directory")
+	fmt.Println("      --focus=<paths>    - Summarize only these comma-separated paths or globs, such as internal/api,cmd/*.go")
+	fmt.Println("      --exclude=<paths>  - Leave out these comma-separated paths or globs, such as **/*_test.go")
 	fmt.Println("      --no-metrics       - Exclude code quality metrics")
+	fmt.Println("      --staleness=<d>    - Refresh the index first if older than this (default 24h, 'off' to disable)")
+	fmt.Println("      --stale-commits=<n> - Refresh the index first if HEAD is n commits past it")
+	fmt.Println("      --no-refresh       - Only warn about a stale index instead of refreshing it")
+	fmt.Println("      --output=<file>    - Write the summary to a file (format inferred from .md, .html, .json, .txt)")
+	fmt.Println("      --format=<fmt>     - Output format: markdown, html, json, or plain")
+	fmt.Println("      --model=<name>     - Chat model to use (e.g. gpt-4o, gpt-4o-mini, o3-mini)")
+	fmt.Println("      --max-tokens=<n>   - Maximum tokens in the summary")
+	fmt.Println("      --temperature=<t>  - Sampling temperature between 0 and 2")
+	fmt.Println("      --file=<path>      - Summarize a single file instead (same as summarize-file)")
+	fmt.Println("      --per-directory    - Summarize every directory instead, as a tree of markdown pages")
+	fmt.Println("      --output-dir=<dir> - Where --per-directory writes the pages (default <directory>/docs/ARCHITECTURE)")
+	fmt.Println("  go run main.go summarize-file <path> - Generate a focused summary of one indexed file")
+	fmt.Println("    Options:")
+	fmt.Println("      --detail=<level>   - Set detail level (brief, standard, comprehensive)")
+	fmt.Println("      --output, --format - As for summarize")
+	fmt.Println("      --staleness, --stale-commits, --no-refresh - As for summarize")
+	fmt.Println("  go run main.go summarize-diff <rev1> [rev2] - Summarize the changes between two revisions (rev2 defaults to HEAD)")
+	fmt.Println("    Options:")
+	fmt.Println("      --since=<ref>      - Compare HEAD with its merge base with ref instead of naming revisions")
+	fmt.Println("      --repo=<dir>       - Repository to diff (default current directory)")
+	fmt.Println("      --detail=<level>   - Set detail level (brief, standard, comprehensive)")
+	fmt.Println("      --output, --format - As for summarize")
+	fmt.Println("  go run main.go pr-summary --base=<ref> - Summarize a pull request and post it as a comment (for CI)")
+	fmt.Println("    Options:")
+	fmt.Println("      --head=<ref>       - Pull request head (default HEAD)")
+	fmt.Println("      --github-repo=<owner/name> - Repository to comment on (default $GITHUB_REPOSITORY)")
+	fmt.Println("      --pr=<n>           - Pull request number (default from the GitHub Actions event)")
+	fmt.Println("      --dry-run          - Print the comment body instead of posting it")
+	fmt.Println("      --repo, --detail   - As for summarize-diff")
+	fmt.Println("  go run main.go commit-msg            - Propose a conventional commit message for the staged changes")
+	fmt.Println("    Options:")
+	fmt.Println("      --repo, --detail   - As for summarize-diff")
+	fmt.Println("  go run main.go changelog --since=<tag> - Draft release notes for the changes since a tag, grouped by area")
+	fmt.Println("    Options:")
+	fmt.Println("      --to=<rev>         - Last revision to include (default HEAD)")
+	fmt.Println("      --repo, --detail, --output, --format - As for summarize-diff")
+	fmt.Println("  go run main.go review <diff-file> | --staged | --ref=<ref> - Review a diff with context from the index")
+	fmt.Println("    Options:")
+	fmt.Println("      --fail-on=<severity> - Exit with an error on a comment this severe or worse (blocker, major, minor, nit)")
+	fmt.Println("      --repo, --detail, --output, --format - As for summarize-diff")
+	fmt.Println("  go run main.go ci                    - Index, summarize, and review in CI, reading the repository and event from GitHub Actions")
+	fmt.Println("    Options:")
+	fmt.Println("      --tasks=<list>     - summary and/or review (default both for pull requests, summary otherwise)")
+	fmt.Println("      --artifacts=<dir>  - Where to write the reports and result.json (default $RUNNER_TEMP/codie)")
+	fmt.Println("      --dir=<dir>        - Repository to index (default $GITHUB_WORKSPACE)")
+	fmt.Println("      --base=<ref>, --head=<ref> - Revisions to compare outside a pull_request event")
+	fmt.Println("      --fail-on, --detail - As for review")
+	fmt.Println("  go run main.go search <query>        - Find the indexed code most relevant to a query")
+	fmt.Println("    Options:")
+	fmt.Println("      --top=<n>          - Number of results to show (default 10)")
+	fmt.Println("      --exact            - Score every chunk instead of searching the HNSW graph of a large index")
+	fmt.Println("      --hybrid           - Combine embedding similarity with BM25 keyword matching")
+	fmt.Println("      --keyword-weight=<w> - Blend hybrid scores with this weight (0-1) on keywords instead of rank fusion")
+	fmt.Println("      --rerank           - Rerank the top 50 hits with the rerank model (default gpt-4o-mini)")
+	fmt.Println("      --group-by=<by>    - Group hits by file (default), symbol, or none")
+	fmt.Println("      --lang=<list>      - Only search files of these languages or extensions, e.g. go,ts")
+	fmt.Println("      --path=<list>      - Only search these files or directories (dir/... and globs work too)")
+	fmt.Println("      --kind=<list>      - Only search chunks of these kinds: function, class, or file")
+	fmt.Println("      --repo=<list>      - Only search these workspace repositories")
+	fmt.Println("      --open[=<n>]       - Open the top (or nth) result in $EDITOR or editor_command")
+	fmt.Println("      --staleness, --stale-commits, --no-refresh - As for summarize")
+	fmt.Println("  go run main.go tui [query]           - Browse search results and file summaries in an interactive terminal UI")
+	fmt.Println("    Options:")
+	fmt.Println("      --top=<n>          - Maximum number of results per search (default 50)")
+	fmt.Println("      --hybrid           - Combine embedding similarity with BM25 keyword matching")
+	fmt.Println("      --lang, --path, --kind, --repo - As for search")
+	fmt.Println("  go run main.go similar <file>[:start-end] - Find near-duplicates of a file or line range in the index")
+	fmt.Println("    Options:")
+	fmt.Println("      --threshold=<s>    - Minimum similarity to report, 0-1 (default 0.85)")
+	fmt.Println("      --top=<n>          - Maximum number of matches (default 20)")
+	fmt.Println("  go run main.go ask <question>        - Answer a question about the codebase from the indexed code most relevant to it")
+	fmt.Println("    Options:")
+	fmt.Println("      --top=<n>          - Chunks given to the model (default 8)")
+	fmt.Println("      --rerank           - Pick them by reranking the top 50 hits with the rerank model")
+	fmt.Println("      --min-score=<s>    - Leave out chunks less similar to the question than this, 0-1 (default 0 keeps all)")
+	fmt.Println("      --max-context-tokens=<n> - Most tokens the code excerpts may take (default what max_prompt_tokens leaves)")
+	fmt.Println("  go run main.go owners <query|path>   - List who last changed the code matching a query, or the files under a path")
+	fmt.Println("    Options:")
+	fmt.Println("      --top=<n>          - Chunks matched by a query (default 10)")
+	fmt.Println("      --contributors=<n> - Contributors listed per file and overall (default 3)")
+	fmt.Println("  go run main.go clusters              - Map the functional areas of the codebase by clustering the index")
+	fmt.Println("    Options:")
+	fmt.Println("      --k=<n>            - Number of clusters (default grows with the index, 2-15)")
+	fmt.Println("      --files=<n>        - Files listed per cluster (default 10)")
+	fmt.Println("      --no-label         - Name clusters by directory instead of asking the model")
+	fmt.Println("  go run main.go diagram               - Emit a package dependency diagram from the index")
+	fmt.Println("    Options:")
+	fmt.Println("      --format=<fmt>     - mermaid (default) or dot")
+	fmt.Println("      --output=<file>    - Write the diagram to a file instead of stdout")
+	fmt.Println("      --label            - Ask the model to group packages into named clusters")
+	fmt.Println("  go run main.go graph                 - Emit the file import and function call graph of the index")
+	fmt.Println("    Options:")
+	fmt.Println("      --format=<fmt>     - dot (default) or json")
+	fmt.Println("      --calls            - Draw functions and the calls between them instead of file imports (dot)")
+	fmt.Println("      --output=<file>    - Write the graph to a file instead of stdout")
+	fmt.Println("  go run main.go rank                  - List the most central files by PageRank over the import and call graph")
+	fmt.Println("    Options:")
+	fmt.Println("      --top=<n>          - Number of files to show (default 20)")
+	fmt.Println("  go run main.go metrics               - Report function complexity and length, duplicated chunks, and doc coverage")
+	fmt.Println("    Options:")
+	fmt.Println("      --format=<fmt>     - text (default) or json")
+	fmt.Println("      --top=<n>          - Functions, files, duplicates, and packages listed in text (default 20)")
+	fmt.Println("      --output=<file>    - Write the report to a file instead of stdout")
+	fmt.Println("  go run main.go debt                  - Report TODO/FIXME/HACK/XXX comments and deprecated API uses")
+	fmt.Println("    Options:")
+	fmt.Println("      --group=<by>       - Group by file (default) or owner")
+	fmt.Println("      --blame            - Take owners of unassigned markers from git blame (implied by --group=owner)")
+	fmt.Println("      --plan             - Ask the model to prioritize the items into a remediation plan")
+	fmt.Println("      --output, --format - As for summarize")
+	fmt.Println("  go run main.go document <path>       - Write doc comments for the undocumented functions of a file or package, as a diff")
+	fmt.Println("    Options:")
+	fmt.Println("      --write            - Apply the comments to the files instead of printing the diff")
+	fmt.Println("  go run main.go api-report <directory> - List exported functions, types, and HTTP/gRPC endpoints by package")
+	fmt.Println("    Options:")
+	fmt.Println("      --describe         - Add a one-line description of each symbol written by the model")
+	fmt.Println("      --output, --format - As for summarize")
+	fmt.Println("  go run main.go serve                 - Serve the Index, Search, SearchStream, Ask, and Summarize gRPC API")
+	fmt.Println("    Options:")
+	fmt.Println("      --grpc-addr=<host> - Address to listen on (default 127.0.0.1); other addresses expose the unauthenticated API")
+	fmt.Println("      --grpc-port=<n>    - Port of the gRPC server (default 50051)")
+	fmt.Println("      --metrics-port=<n> - Also serve Prometheus metrics at /metrics on this port")
+	fmt.Println("      --min-score=<s>, --max-context-tokens=<n> - Limit the code given to every Ask, as for ask")
+	fmt.Println("  go run main.go daemon [directory]    - Keep the index in memory, re-index changed files, and answer editors over JSON-RPC")
+	fmt.Println("    Options:")
+	fmt.Println("      --socket=<path>    - Unix socket to listen on (default <index file>.sock)")
+	fmt.Println("      --debounce=<d>     - Quiet period after a change before re-indexing (default 1s)")
+	fmt.Println("  go run main.go lsp [directory]       - Serve context for cursor positions and selections to IDEs over stdio, LSP-style")
+	fmt.Println("    Options:")
+	fmt.Println("      --debounce=<d>     - As for daemon")
+	fmt.Println("  go run main.go stats                 - Report index contents, size, age, and stale files")
+	fmt.Println("  go run main.go errors                - List every error of the last run that indexed files")
+	fmt.Println("  go run main.go prune [directory]     - Remove chunks of deleted files and files now matching ignore rules")
+	fmt.Println("    Options:")
+	fmt.Println("      --dry-run          - List what would be removed without changing the index")
+	fmt.Println("  go run main.go remove <path>...      - Remove the chunks of files or directories from the index")
+	fmt.Println("  go run main.go clean                 - Delete the index and everything else Codie wrote to .codie/")
+	fmt.Println("    Options:")
+	fmt.Println("      --dry-run          - List what would be deleted")
+	fmt.Println("      --all              - Delete config.yaml and .env too")
+	fmt.Println("  go run main.go export               - Write the index to a compressed archive for other machines")
+	fmt.Println("    Options:")
+	fmt.Println("      --out=<file>       - Archive path (default index.codie.zst)")
+	fmt.Println("      --root=<dir>       - Directory chunk paths are stored relative to (default .)")
+	fmt.Println("  go run main.go import [archive]      - Replace the index with an exported archive")
+	fmt.Println("    Options:")
+	fmt.Println("      --root=<dir>       - Directory the archived paths are placed under (default .)")
+	fmt.Println("      --force            - Import even if the archive used a different embedding model")
+	fmt.Println("  go run main.go migrate               - Copy the index to another storage backend, or rewrite it at the current schema version")
+	fmt.Println("    Options:")
+	fmt.Println("      --from=<store>     - Backend the index is read from (default the store setting)")
+	fmt.Println("      --to=<store>       - Backend the index is written to (default the store setting)")
+	fmt.Println("      --out=<path>       - Where the migrated index is written (default in place)")
+	fmt.Println("  go run main.go auth login            - Save an OpenAI API key to the OS keychain")
+	fmt.Println("  go run main.go auth logout           - Remove the saved API key from the OS keychain")
+	fmt.Println("  go run main.go bench <directory>     - Time discovery, chunking, and mock embedding of a directory, with memory stats")
+	fmt.Println("    Options:")
+	fmt.Println("      --git, --chunk-overlap - As for index; workers, batch_size, and max_concurrent_requests apply too")
+	fmt.Println("  go run main.go quicklook <directory> - Fast one-screen orientation without indexing")
+	fmt.Println("    Options:")
+	fmt.Println("      --time-budget=<d>  - Maximum time to spend (default 60s)")
+	fmt.Println("      --max-cost=<usd>   - Maximum estimated API cost (default 0.10)")
+}
+
+// IndexReport is the outcome of indexing a directory, printed with --json
+type IndexReport struct {
+	Source     string   `json:"source,omitempty"` // Repository URL, when one was indexed
+	Commit     string   `json:"commit,omitempty"`
+	Directory  string   `json:"directory"`
+	IndexFile  string   `json:"index_file"`
+	Files      int      `json:"files"`
+	Chunks     int      `json:"chunks"`
+	Errors     []string `json:"errors"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// IndexCodebase processes and indexes a codebase directory, or a repository
+// URL with an optional #ref, which is shallow-cloned into the cache directory
+func IndexCodebase(dir string, args []string) {
+	options := parseIndexOptions(args)
+	if isRepoURL(dir) {
+		repo, err := cloneRepo(dir)
+		if err != nil {
+			log.Fatalf("Error fetching repository: %v", err)
+		}
+		dir, options = repo.Dir, repo.indexOptions(options)
+	}
+	report := indexCodebase(dir, options)
+	if report != nil && settings.JSONOutput {
+		printJSON(report)
+	}
 }
 
-// IndexCodebase processes and indexes a codebase directory
-func IndexCodebase(dir string) {
+// indexCodebase indexes dir and saves the index, returning nil for a dry run
+func indexCodebase(dir string, options IndexOptions) *IndexReport {
 	// Get all code files from the directory
 	startTime := time.Now()
-	files, err := fileutils.GetCodeFiles(dir)
+	ctx := withProgress(commandCtx)
+	files, err := discoverFiles(ctx, dir, options.Git)
 	if err != nil {
 		log.Fatalf("Error scanning directory: %v", err)
 	}
+	if options, err = options.withCommit(dir); err != nil {
+		log.Fatalf("Error reading git metadata: %v", err)
+	}
+	options.Root = dir
 
 	if len(files) == 0 {
 		log.Fatal("No code files found in the specified directory")
 	}
 
-	fmt.Printf("Found %d code files to process\n", len(files))
-
-	// Determine number of workers based on CPU cores
-	numWorkers := DefaultNumWorkers
-	if numWorkers <= 0 {
-		numWorkers = runtime.NumCPU()
-	}
-
-	// Set up concurrency channels and wait groups
-	filesChan := make(chan string, len(files))
-	resultsChan := make(chan []storage.CodeChunk, len(files))
-	errorsChan := make(chan error, len(files))
-
-	// Create a progress bar
-	bar := progressbar.NewOptions(len(files),
-		progressbar.OptionSetDescription("Processing files"),
-		progressbar.OptionShowCount(),
-		progressbar.OptionShowIts(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
-
-	// Launch worker pool
-	var wg sync.WaitGroup
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for file := range filesChan {
-				chunks, err := processFile(file)
-				if err != nil {
-					errorsChan <- fmt.Errorf("error processing %s: %w", file, err)
-				} else {
-					resultsChan <- chunks
-				}
-				bar.Add(1)
-			}
-		}()
-	}
+	slog.Info("Found code files to process", "files", len(files))
 
-	// Queue files for processing
-	for _, file := range files {
-		filesChan <- file
+	// Chunks are checkpointed as files finish, so a crash keeps finished work
+	// and --resume picks up where it stopped
+	var writer storage.ChunkWriter
+	totalFiles := len(files)
+	resumedChunks := 0
+	if options.Resume {
+		var completed map[string]int
+		writer, completed, err = openStore().ResumeWriter()
+		if err != nil {
+			log.Fatalf("Failed to resume indexing: %v", err)
+		}
+		defer writer.Close()
+		files, resumedChunks = skipCompletedFiles(files, completed)
+		slog.Info("Resuming from checkpoint", "completed_files", totalFiles-len(files), "remaining_files", len(files))
 	}
-	close(filesChan)
 
-	// Start collector goroutine
-	var allChunks []storage.CodeChunk
-	var processingErrors []error
+	// Estimate the cost before spending any API credits
+	if options.DryRun || options.MaxCost > 0 {
+		estimate := estimateIndexCost(files, options)
+		if settings.JSONOutput {
+			if options.DryRun {
+				printJSON(estimate)
+				return nil
+			}
+			slog.Info("Estimated indexing cost", "tokens", estimate.Tokens, "estimated_cost_usd", estimate.Cost)
+		} else {
+			printIndexEstimate(estimate)
+		}
 
-	go func() {
-		for err := range errorsChan {
-			processingErrors = append(processingErrors, err)
+		if options.DryRun {
+			return nil
+		}
+		if estimate.Cost > options.MaxCost {
+			log.Fatalf("Estimated cost $%.4f exceeds --max-cost of $%.4f; aborting", estimate.Cost, options.MaxCost)
 		}
-	}()
+		if !settings.JSONOutput {
+			fmt.Println()
+		}
+	}
 
-	go func() {
-		for chunks := range resultsChan {
-			allChunks = append(allChunks, chunks...)
+	if writer == nil {
+		writer, err = openStore().NewWriter()
+		if err != nil {
+			log.Fatalf("Failed to start writing the index: %v", err)
 		}
-	}()
+	}
+	chunkCount, processingErrors := processFiles(ctx, files, options, writer)
+	chunkCount += resumedChunks
 
-	// Wait for all workers to finish
-	wg.Wait()
-	close(resultsChan)
-	close(errorsChan)
+	// Report errors (but continue with saving results)
+	reportProcessingErrors(processingErrors)
 
-	// Wait a bit for collectors to finish
-	time.Sleep(100 * time.Millisecond)
+	if chunkCount == 0 {
+		writer.Close()
+		log.Fatal("No code chunks were processed successfully")
+	}
+	slog.Info("Saving code chunks", "chunks", chunkCount, "index", settings.IndexFile)
+	if err := commitIndex(ctx, writer); err != nil {
+		log.Fatalf("Failed to save embeddings: %v", err)
+	}
+	logStageTimings(ctx)
+	slog.Info("Indexing complete", "chunks", chunkCount, "duration", time.Since(startTime))
+	saveIndexMetadata(dir, options)
+	// The new index replaces every workspace repository
+	if err := storage.SaveWorkspace(settings.IndexFile, storage.Workspace{}); err != nil {
+		slog.Warn("Failed to clear the workspace", "error", err)
+	}
 
-	// Report errors (but continue with saving results)
-	if len(processingErrors) > 0 {
-		fmt.Printf("\nEncountered %d errors during processing:\n", len(processingErrors))
-		for i, err := range processingErrors {
-			if i < 10 { // Only show first 10 errors
-				fmt.Printf("- %v\n", err)
-			} else {
-				fmt.Printf("- ... and %d more errors\n", len(processingErrors)-10)
-				break
-			}
-		}
+	report := &IndexReport{
+		Source:     options.Source,
+		Commit:     options.Commit,
+		Directory:  dir,
+		IndexFile:  settings.IndexFile,
+		Files:      totalFiles,
+		Chunks:     chunkCount,
+		Errors:     []string{},
+		DurationMS: time.Since(startTime).Milliseconds(),
 	}
+	for _, err := range processingErrors {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report
+}
 
-	// Save the results to a JSON file
-	if len(allChunks) > 0 {
-		fmt.Printf("\nSaving %d code chunks to %s...\n", len(allChunks), DefaultEmbeddingsFile)
-		err = storage.SaveToJSON(allChunks, DefaultEmbeddingsFile)
-		if err != nil {
-			log.Fatalf("Failed to save embeddings: %v", err)
+// saveIndexMetadata records the source of the index just written from dir
+func saveIndexMetadata(dir string, options IndexOptions) {
+	metadata := storage.Metadata{
+		Source:    options.Source,
+		Ref:       options.Ref,
+		Commit:    options.Commit,
+		Directory: dir,
+		IndexedAt: time.Now().UTC(),
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		metadata.Directory = abs
+	}
+	if metadata.Source == "" {
+		metadata.Source = metadata.Directory
+	}
+	if metadata.Commit == "" {
+		metadata.Commit, _ = gitdiff.ResolveRevision(dir, "HEAD")
+	}
+	if err := storage.SaveMetadata(settings.IndexFile, metadata); err != nil {
+		slog.Warn("Failed to save index metadata", "error", err)
+	}
+}
+
+// skipCompletedFiles returns files without those completed by an earlier run,
+// and the number of chunks the completed ones produced
+func skipCompletedFiles(files []string, completed map[string]int) ([]string, int) {
+	var remaining []string
+	chunks := 0
+	for _, file := range files {
+		if count, ok := completed[file]; ok {
+			chunks += count
+		} else {
+			remaining = append(remaining, file)
 		}
-		fmt.Printf("Successfully processed %d code chunks\n", len(allChunks))
-	} else {
-		log.Fatal("No code chunks were processed successfully")
 	}
-	elapsedTime := time.Since(startTime)
-	fmt.Printf("Total indexing time: %v\n", elapsedTime)
+	return remaining, chunks
 }
 
-// processFile handles a single file, extracting and embedding its chunks
-func processFile(file string) ([]storage.CodeChunk, error) {
-	content, err := fileutils.ReadFileContent(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+// processFiles chunks and embeds files concurrently, writing each file's
+// chunks to writer as soon as it is done. It returns the number of chunks
+// written and any per-file errors.
+func processFiles(ctx context.Context, files []string, options IndexOptions, writer storage.ChunkWriter) (int, []error) {
+	// Show the progress of each stage while files are processed
+	if tracker := progress.TrackerFrom(ctx); tracker != nil {
+		display := startProgressDisplay(tracker)
+		defer display.Stop()
 	}
+	progress.Report(ctx, progress.Event{Stage: progress.Chunking, Total: len(files)})
+	progress.Report(ctx, progress.Event{Stage: progress.Writing, Total: len(files)})
 
-	// Split code into chunks
-	chunkedCode := fileutils.SplitCodeIntoChunks(content, DefaultMaxChunkSize)
-	if len(chunkedCode) == 0 {
-		return nil, nil // No valid chunks found
+	indexOptions := options.indexOptions()
+	indexOptions.Progress = func(_ string, err error) {
+		// Files that failed are never written
+		if err != nil {
+			progress.Report(ctx, progress.Event{Stage: progress.Writing, Total: -1})
+		}
+	}
+	indexOptions.Sink = func(file string, chunks []storage.CodeChunk) error {
+		start := time.Now()
+		if err := writer.WriteFile(file, chunks); err != nil {
+			return err
+		}
+		progress.Report(ctx, progress.Event{Stage: progress.Writing, Items: 1, Duration: time.Since(start)})
+		return nil
 	}
 
-	// Prepare data for batch processing
-	var chunksToEmbed []string
-	fileChunks := make([]storage.CodeChunk, len(chunkedCode))
+	result, _ := index.Files(ctx, files, indexOptions)
+	progress.Report(ctx, progress.Event{Stage: progress.Chunking, Done: true})
+	progress.Report(ctx, progress.Event{Stage: progress.Embedding, Done: true})
+	reportSkippedFiles(result.Skipped)
+	return result.ChunkCount, result.Errors
+}
 
-	for i, chunk := range chunkedCode {
-		chunksToEmbed = append(chunksToEmbed, chunk)
-		fileChunks[i] = storage.CodeChunk{
-			File:    file,
-			Content: chunk,
-			// Embedding will be added later
+// reportSkippedFiles warns about files left out by the size and chunk limits
+func reportSkippedFiles(skipped []index.Skipped) {
+	if len(skipped) == 0 {
+		return
+	}
+
+	slog.Warn("Skipped files over the indexing limits", "files", len(skipped))
+	for i, file := range skipped {
+		// Show the first 10 files unless debugging
+		if i >= 10 && !logging.Enabled(slog.LevelDebug) {
+			slog.Warn("More skipped files omitted; run with --verbose to see them", "omitted", len(skipped)-10)
+			break
 		}
+		slog.Warn("Skipped file", "file", file.File, "reason", file.Reason)
 	}
+}
 
-	// Get embeddings for all chunks in batch
-	embedMap, err := embeddings.GetBatchEmbeddings(chunksToEmbed, DefaultBatchSize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get embeddings: %w", err)
+// reportProcessingErrors prints the first few errors encountered while
+// processing files, and adds them all to the run's error report
+func reportProcessingErrors(processingErrors []error) {
+	if len(processingErrors) == 0 {
+		return
+	}
+	recordRunErrors("indexing", processingErrors)
+
+	slog.Warn("Encountered errors during processing", "errors", len(processingErrors))
+	for i, err := range processingErrors {
+		// Show the first 10 errors unless debugging
+		if i >= 10 && !logging.Enabled(slog.LevelDebug) {
+			slog.Warn("More errors omitted; run 'errors' or use --verbose to see them", "omitted", len(processingErrors)-10)
+			break
+		}
+		slog.Warn("Failed to process file", "error", err)
 	}
+}
+
+// embedFileContent chunks a file's content and embeds the chunks
+func embedFileContent(file, content string, options IndexOptions) ([]storage.CodeChunk, error) {
+	return index.Content(commandCtx, file, content, options.indexOptions())
+}
+
+// parseSummaryOptions parses summarize command-line options
+func parseSummaryOptions(args []string) summarization.SummaryOptions {
+	options := summarization.DefaultSummaryOptions()
 
-	// Associate embeddings with their chunks
-	var validChunks []storage.CodeChunk
-	for i, chunk := range fileChunks {
-		if embedding, ok := embedMap[chunksToEmbed[i]]; ok {
-			chunk.Embedding = embedding
-			validChunks = append(validChunks, chunk)
+	for _, arg := range args {
+		var err error
+		if strings.HasPrefix(arg, "--mode=") {
+			if options.Mode, err = summarization.ParseMode(strings.TrimPrefix(arg, "--mode=")); err != nil {
+				log.Fatalf("Invalid --mode value: %v", err)
+			}
+		} else if strings.HasPrefix(arg, "--audience=") {
+			if options.Audience, err = summarization.ParseAudience(strings.TrimPrefix(arg, "--audience=")); err != nil {
+				log.Fatalf("Invalid --audience value: %v", err)
+			}
+		} else if strings.HasPrefix(arg, "--detail=") {
+			if options.DetailLevel, err = summarization.ParseDetailLevel(strings.TrimPrefix(arg, "--detail=")); err != nil {
+				log.Fatalf("Invalid --detail value: %v", err)
+			}
+		} else if strings.HasPrefix(arg, "--focus=") {
+			options.Focus = append(options.Focus, splitFlagList(strings.TrimPrefix(arg, "--focus="))...)
+		} else if strings.HasPrefix(arg, "--exclude=") {
+			options.Exclude = append(options.Exclude, splitFlagList(strings.TrimPrefix(arg, "--exclude="))...)
+		} else if arg == "--no-metrics" {
+			options.IncludeMetrics = false
 		}
 	}
 
-	return validChunks, nil
+	return options
 }
 
 // SummarizeCodebase generates a summary of the codebase
 func SummarizeCodebase(dir string, args []string) {
+	// A single file can be summarized with --file=<path>
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--file=") {
+			SummarizeFile(strings.TrimPrefix(arg, "--file="), args)
+			return
+		}
+	}
+
 	start := time.Now()
-	embeddingsPath := DefaultEmbeddingsFile
+	embeddingsPath := settings.IndexFile
+
+	// A repository URL is cloned, and indexed unless the index already holds
+	// the commit fetched
+	if isRepoURL(dir) {
+		repo, err := cloneRepo(dir)
+		if err != nil {
+			log.Fatalf("Error fetching repository: %v", err)
+		}
+		dir = repo.Dir
+		if metadata, err := storage.LoadMetadata(embeddingsPath); err != nil || metadata.Source != repo.URL || metadata.Commit != repo.Commit {
+			slog.Info("Indexing repository first", "url", repo.URL, "commit", repo.Commit)
+			indexCodebase(dir, repo.indexOptions(parseIndexOptions(nil)))
+		}
+	}
 
 	// Check if embeddings file exists
 	_, err := os.Stat(embeddingsPath)
 	if os.IsNotExist(err) {
-		fmt.Println("Embeddings file not found. Indexing codebase first...")
-		IndexCodebase(dir)
+		slog.Info("Index not found; indexing codebase first", "index", embeddingsPath)
+		indexCodebase(dir, parseIndexOptions(nil))
+	} else {
+		ensureFreshIndex(dir, parseStalenessPolicy(args), parseIndexOptions(args))
 	}
 
 	// Parse options
-	options := summarization.DefaultSummaryOptions()
-
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "--detail=") {
-			options.DetailLevel = strings.TrimPrefix(arg, "--detail=")
-		} else if strings.HasPrefix(arg, "--focus=") {
-			options.FocusPath = strings.TrimPrefix(arg, "--focus=")
-		} else if arg == "--no-metrics" {
-			options.IncludeMetrics = false
-		}
+	options := parseSummaryOptions(args)
+	if contains(args, "--per-directory") {
+		summarizeDirectories(dir, options, args)
+		return
 	}
 
 	// Generate summary
-	fmt.Println("Generating codebase summary...")
-	summary, err := summarization.GenerateRepoSummary(embeddingsPath, options)
+	slog.Info("Generating codebase summary")
+	summary, err := summarization.GenerateRepoSummary(commandCtx, embeddingsPath, options)
 	if err != nil {
 		log.Fatalf("Failed to generate summary: %v", err)
 	}
 
 	// Output the summary
-	fmt.Println("\n--- CODEBASE SUMMARY ---")
-	output, _ := glamour.Render(summary, "dark")
-	fmt.Println(output)
-	elapsedTime := time.Since(start)
-	fmt.Printf("Total summarizing time: %v\n", elapsedTime)
-
+	writeSummaryResult("Codebase summary", summary, parseSummaryOutput(args))
+	slog.Info("Summary complete", "duration", time.Since(start))
 }
-
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// CommitMsg proposes a conventional commit message for the staged changes,
+// printed as plain text for git commit -F
+func CommitMsg(args []string) {
+	start := time.Now()
+	diffRange := DiffRange{RepoDir: ".", Staged: true}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--repo=") {
+			diffRange.RepoDir = strings.TrimPrefix(arg, "--repo=")
+		}
+	}
+
+	input := loadDiffSummaryInput(diffRange, args)
+	if len(input.Changes) == 0 {
+		log.Fatal("Nothing is staged; stage changes with git add first")
+	}
+	slog.Info("Found staged files", "files", len(input.Changes), "chunks", len(input.ChangedChunks))
+
+	message, err := summarization.GenerateCommitMessage(commandCtx, input, parseSummaryOptions(args))
+	if err != nil {
+		log.Fatalf("Failed to generate commit message: %v", err)
+	}
+
+	if settings.JSONOutput {
+		printJSON(map[string]string{"message": message})
+	} else {
+		fmt.Print(message)
+	}
+	slog.Info("Commit message complete", "duration", time.Since(start))
+}
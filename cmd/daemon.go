@@ -0,0 +1,485 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/jsonrpc"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Default quiet period after a file change before the daemon re-indexes, so
+// a burst of saves is indexed once
+const DefaultDaemonDebounce = time.Second
+
+// Number of query embeddings the daemon keeps, so repeated queries skip the
+// embeddings API
+const daemonQueryCacheSize = 256
+
+// daemonSocketPath is where the daemon listens by default
+func daemonSocketPath() string {
+	return settings.IndexFile + ".sock"
+}
+
+// Daemon keeps the index in memory, re-indexes files as they change, and
+// answers search and context requests from editor plugins with JSON-RPC
+// over a Unix socket, until interrupted
+func Daemon(args []string) {
+	dir := ""
+	socketPath := daemonSocketPath()
+	debounce := DefaultDaemonDebounce
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--socket=") {
+			socketPath = strings.TrimPrefix(arg, "--socket=")
+		} else if strings.HasPrefix(arg, "--debounce=") {
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, "--debounce="))
+			if err != nil || d < 0 {
+				log.Fatalf("Invalid --debounce value %q: must be a duration such as 500ms", arg)
+			}
+			debounce = d
+		} else if !strings.HasPrefix(arg, "--") {
+			dir = arg
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(commandCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	d := startDaemon(ctx, dir, debounce, args)
+
+	listener, err := listenSocket(socketPath)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", socketPath, err)
+	}
+	defer os.Remove(socketPath)
+
+	server := jsonrpc.NewServer()
+	server.Register("search", d.handleSearch)
+	server.Register("context", d.handleContext)
+	server.Register("status", d.handleStatus)
+
+	slog.Info("Daemon listening", "socket", socketPath, "dir", d.dir, "chunks", len(d.chunks))
+	if err := server.Serve(ctx, listener); err != nil {
+		log.Fatalf("Daemon failed: %v", err)
+	}
+	slog.Info("Shutting down")
+}
+
+// startDaemon loads the index into memory, re-indexes the files of dir (by
+// default the root of the indexed files) changed since it was written, and
+// watches dir for changes until ctx is canceled
+func startDaemon(ctx context.Context, dir string, debounce time.Duration, args []string) *daemon {
+	info, err := os.Stat(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	d := &daemon{options: parseIndexOptions(args), queries: make(map[string][]float32)}
+	if err := d.load(); err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	d.dir = dir
+	if d.dir == "" {
+		d.dir = storage.RootDir(d.chunks)
+	}
+
+	// Catch up on changes made while the daemon wasn't running
+	lastRefresh := time.Now()
+	if err := d.refresh(info.ModTime()); err != nil {
+		slog.Warn("Failed to refresh index, using existing one", "error", err)
+		lastRefresh = info.ModTime()
+	}
+
+	go func() {
+		if err := d.watch(ctx, lastRefresh, debounce); err != nil {
+			slog.Warn("Not watching for changes", "error", err)
+		}
+	}()
+	return d
+}
+
+// listenSocket listens on a Unix socket at path, replacing a socket left
+// behind by a daemon that didn't shut down cleanly
+func listenSocket(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening")
+		}
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// daemon is the in-memory index and the request handlers serving it
+type daemon struct {
+	dir     string
+	options IndexOptions
+
+	mu        sync.RWMutex
+	chunks    []storage.CodeChunk
+	ann       *search.ANN
+	keyword   *search.KeywordIndex // Built on the first hybrid search
+	updatedAt time.Time
+
+	refreshing atomic.Bool
+
+	queriesMu sync.Mutex
+	queries   map[string][]float32 // Embeddings of recent queries
+}
+
+// load reads the index file into memory
+func (d *daemon) load() error {
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		return err
+	}
+	chunks = withSummaries(chunks)
+	ann := openANN(chunks)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.chunks, d.ann, d.keyword = chunks, ann, nil
+	d.updatedAt = time.Now()
+	return nil
+}
+
+// snapshot returns the current chunks and their search graph
+func (d *daemon) snapshot() ([]storage.CodeChunk, *search.ANN) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.chunks, d.ann
+}
+
+// keywordIndex returns the keyword index of the current chunks, building it
+// if needed
+func (d *daemon) keywordIndex() *search.KeywordIndex {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.keyword == nil {
+		d.keyword = search.NewKeywordIndex(d.chunks)
+	}
+	return d.keyword
+}
+
+// refresh re-indexes the files changed since the given time and reloads the
+// index
+func (d *daemon) refresh(since time.Time) error {
+	d.refreshing.Store(true)
+	defer d.refreshing.Store(false)
+	if err := refreshIndex(d.dir, since, d.options); err != nil {
+		return err
+	}
+	return d.load()
+}
+
+// watch re-indexes the directory whenever code files in it change, once the
+// changes have been quiet for debounce. Files changed since lastRefresh are
+// picked up by the first refresh.
+func (d *daemon) watch(ctx context.Context, lastRefresh time.Time, debounce time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	addDirs := func(root string) {
+		dirs, err := fileutils.GetCodeDirs(root)
+		if err != nil {
+			slog.Warn("Failed to list directories to watch", "dir", root, "error", err)
+		}
+		for _, dir := range dirs {
+			if err := watcher.Add(dir); err != nil {
+				slog.Warn("Failed to watch directory", "dir", dir, "error", err)
+			}
+		}
+	}
+	addDirs(d.dir)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if d.affectsIndex(event) {
+				// Watch new directories, which may already hold files
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addDirs(event.Name)
+					}
+				}
+				timer.Reset(debounce)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("File watcher error", "error", err)
+
+		case <-timer.C:
+			start := time.Now()
+			if err := d.refresh(lastRefresh); err != nil {
+				// Try again once the other process is done with the index
+				var locked *storage.LockedError
+				if errors.As(err, &locked) {
+					slog.Info("Index is locked; refreshing later", "pid", locked.PID)
+					timer.Reset(debounce)
+					continue
+				}
+				slog.Warn("Failed to refresh index", "error", err)
+				continue
+			}
+			lastRefresh = start
+		}
+	}
+}
+
+// affectsIndex reports whether a file event may change the index: a code
+// file changed, or a directory was created, removed, or renamed
+func (d *daemon) affectsIndex(event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return false
+	}
+	if fileutils.IsSkippedDir(filepath.Base(event.Name)) {
+		return false
+	}
+	rel, err := filepath.Rel(d.dir, event.Name)
+	if err != nil {
+		return false
+	}
+	if fileutils.IsCodeFile(d.dir, rel) {
+		return true
+	}
+	if event.Has(fsnotify.Create) {
+		info, err := os.Stat(event.Name)
+		return err == nil && info.IsDir()
+	}
+	// A removed directory can no longer be told from a file, but has no
+	// extension
+	return (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)) && filepath.Ext(event.Name) == ""
+}
+
+// queryEmbedding embeds a search query, reusing the embedding of a recent
+// identical query
+func (d *daemon) queryEmbedding(ctx context.Context, query string) ([]float32, error) {
+	d.queriesMu.Lock()
+	embedding, ok := d.queries[query]
+	d.queriesMu.Unlock()
+	if ok {
+		return embedding, nil
+	}
+
+	embedding, err := embeddings.GetQueryEmbeddingContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	d.queriesMu.Lock()
+	defer d.queriesMu.Unlock()
+	if len(d.queries) >= daemonQueryCacheSize {
+		clear(d.queries)
+	}
+	d.queries[query] = embedding
+	return embedding, nil
+}
+
+// daemonSearchParams are the parameters of the search method
+type daemonSearchParams struct {
+	Query         string   `json:"query"`
+	TopK          int      `json:"top_k"`
+	Hybrid        bool     `json:"hybrid"`
+	KeywordWeight float64  `json:"keyword_weight"`
+	Languages     []string `json:"lang"`
+	Paths         []string `json:"path"`
+	Kinds         []string `json:"kind"`
+}
+
+// handleSearch answers the search method: the chunks most relevant to a query
+func (d *daemon) handleSearch(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params daemonSearchParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, jsonrpc.InvalidParams("invalid params: %v", err)
+	}
+	if strings.TrimSpace(params.Query) == "" {
+		return nil, jsonrpc.InvalidParams("query is required")
+	}
+	if params.KeywordWeight < 0 || params.KeywordWeight > 1 {
+		return nil, jsonrpc.InvalidParams("keyword_weight must be between 0 and 1")
+	}
+	for _, kind := range params.Kinds {
+		if !contains(chunkKinds, kind) {
+			return nil, jsonrpc.InvalidParams("invalid kind %q: must be one of %s", kind, strings.Join(chunkKinds, ", "))
+		}
+	}
+	topK := params.TopK
+	if topK <= 0 {
+		topK = DefaultSearchResults
+	}
+
+	queryEmbedding, err := d.queryEmbedding(ctx, params.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	chunks, ann := d.snapshot()
+	hybrid := params.Hybrid || params.KeywordWeight > 0
+	filter := SearchFilter{Languages: params.Languages, Paths: params.Paths, Kinds: params.Kinds}
+	var keyword *search.KeywordIndex
+	if filter.active() {
+		chunks, ann = filter.apply(chunks), nil
+		if hybrid {
+			keyword = search.NewKeywordIndex(chunks)
+		}
+	} else if hybrid {
+		keyword = d.keywordIndex()
+	}
+
+	var results []search.Result
+	if hybrid {
+		candidates := topK * hybridCandidatesPerResult
+		var vector []search.Result
+		for result := range streamSearch(ctx, ann, chunks, queryEmbedding, candidates) {
+			vector = append(vector, result)
+		}
+		results = search.Fuse(vector, keyword.Search(params.Query, candidates), topK, params.KeywordWeight)
+	} else {
+		for result := range streamSearch(ctx, ann, chunks, queryEmbedding, topK) {
+			results = append(results, result)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hits := []SearchHit{}
+	for i, result := range results {
+		hits = append(hits, newSearchHit(i+1, result))
+	}
+	return struct {
+		Results []SearchHit `json:"results"`
+	}{hits}, nil
+}
+
+// daemonContextParams are the parameters of the context method
+type daemonContextParams struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	TopK int    `json:"top_k"`
+}
+
+// handleContext answers the context method: the indexed chunk at a file and line,
+// and the chunks elsewhere most related to it. It uses the chunk's stored
+// embedding, so it doesn't call the embeddings API.
+func (d *daemon) handleContext(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params daemonContextParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, jsonrpc.InvalidParams("invalid params: %v", err)
+	}
+	if params.File == "" {
+		return nil, jsonrpc.InvalidParams("file is required")
+	}
+	topK := params.TopK
+	if topK <= 0 {
+		topK = DefaultSearchResults
+	}
+
+	chunks, ann := d.snapshot()
+	target, ok := chunkAt(chunks, params.File, params.Line)
+	if !ok {
+		return nil, jsonrpc.InvalidParams("no indexed code at %s:%d", params.File, params.Line)
+	}
+
+	isTarget := func(chunk storage.CodeChunk) bool {
+		return chunk.File == target.File && chunk.StartLine == target.StartLine && chunk.EndLine == target.EndLine
+	}
+	related, err := relatedChunks(ctx, chunks, ann, target.Embedding, topK, isTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []SearchHit{}
+	for i, result := range related {
+		hits = append(hits, newSearchHit(i+1, result))
+	}
+	return struct {
+		Chunk   SearchHit   `json:"chunk"`
+		Related []SearchHit `json:"related"`
+	}{newSearchHit(0, search.Result{Chunk: target, Score: 1}), hits}, nil
+}
+
+// chunkAt returns the indexed chunk of file spanning line, or the file's
+// first chunk when line is 0 or less
+func chunkAt(chunks []storage.CodeChunk, file string, line int) (storage.CodeChunk, bool) {
+	for _, chunk := range chunks {
+		if samePath(chunk.File, file) && (line <= 0 || (chunk.StartLine <= line && line <= chunk.EndLine)) {
+			return chunk, true
+		}
+	}
+	return storage.CodeChunk{}, false
+}
+
+// relatedChunks returns the k chunks most similar to an embedding, leaving
+// out those excluded
+func relatedChunks(ctx context.Context, chunks []storage.CodeChunk, ann *search.ANN, embedding []float32, k int, exclude func(storage.CodeChunk) bool) ([]search.Result, error) {
+	excluded := 0
+	for _, chunk := range chunks {
+		if exclude(chunk) {
+			excluded++
+		}
+	}
+
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var related []search.Result
+	for result := range streamSearch(searchCtx, ann, chunks, embedding, k+excluded) {
+		if exclude(result.Chunk) {
+			continue
+		}
+		related = append(related, result)
+		if len(related) == k {
+			break
+		}
+	}
+	return related, ctx.Err()
+}
+
+// handleStatus answers the status method: what the daemon has loaded
+func (d *daemon) handleStatus(ctx context.Context, raw json.RawMessage) (any, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	files := make(map[string]bool)
+	for _, chunk := range d.chunks {
+		files[chunk.File] = true
+	}
+	return struct {
+		Dir        string    `json:"dir"`
+		IndexFile  string    `json:"index_file"`
+		Chunks     int       `json:"chunks"`
+		Files      int       `json:"files"`
+		UpdatedAt  time.Time `json:"updated_at"`
+		Refreshing bool      `json:"refreshing"`
+	}{d.dir, settings.IndexFile, len(d.chunks), len(files), d.updatedAt, d.refreshing.Load()}, nil
+}
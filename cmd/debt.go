@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Kinds of debt item, in the order they are counted
+var debtKinds = []string{"FIXME", "HACK", "XXX", "TODO", "deprecated"}
+
+// Debt reports the TODO, FIXME, HACK, and XXX comments and uses of
+// deprecated APIs in the index, grouped by file or owner, and can ask the
+// model to prioritize them into a remediation plan
+func Debt(args []string) {
+	start := time.Now()
+	group := "file"
+	blame := false
+	plan := false
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--group=") {
+			group = strings.TrimPrefix(arg, "--group=")
+			if group != "file" && group != "owner" {
+				log.Fatalf("Invalid --group value %q: must be file or owner", group)
+			}
+		} else if arg == "--blame" {
+			blame = true
+		} else if arg == "--plan" {
+			plan = true
+		}
+	}
+	// Owners of unassigned markers come from git blame
+	if group == "owner" {
+		blame = true
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadFromJSON(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+
+	root := storage.RootDir(chunks)
+	items := summarization.FindDebt(chunks)
+	if blame {
+		assignBlameOwners(root, items)
+	}
+	for i := range items {
+		if rel, err := filepath.Rel(root, items[i].File); err == nil {
+			items[i].File = filepath.ToSlash(rel)
+		}
+	}
+
+	var remediation string
+	if plan && len(items) > 0 {
+		slog.Info("Prioritizing debt", "items", len(items))
+		remediation, err = summarization.GenerateDebtPlan(commandCtx, items, parseSummaryOptions(args))
+		if err != nil {
+			log.Fatalf("Failed to generate remediation plan: %v", err)
+		}
+	}
+
+	output := parseSummaryOutput(args)
+	if settings.JSONOutput && output.Path == "" {
+		printJSON(struct {
+			Items []summarization.DebtItem `json:"items"`
+			Plan  string                   `json:"plan,omitempty"`
+		}{append([]summarization.DebtItem{}, items...), remediation})
+		return
+	}
+
+	report := buildDebtReport(items, group)
+	if remediation != "" {
+		report += "\n## Remediation Plan\n\n" + remediation + "\n"
+	}
+	writeSummary("Technical debt", report, output)
+	slog.Info("Found debt", "items", len(items), "duration", time.Since(start))
+}
+
+// assignBlameOwners sets the owner of items without one to the author who
+// last changed their line. Items outside a git repository keep no owner.
+func assignBlameOwners(root string, items []summarization.DebtItem) {
+	top, err := gitdiff.TopLevel(root)
+	if err != nil {
+		slog.Warn("Not a git repository; owners come from markers only", "dir", root, "error", err)
+		return
+	}
+
+	byFile := make(map[string][]int)
+	for i, item := range items {
+		if item.Owner == "" {
+			byFile[item.File] = append(byFile[item.File], i)
+		}
+	}
+	for file, indices := range byFile {
+		rel, err := filepath.Rel(top, file)
+		if err != nil {
+			continue
+		}
+		authors, err := gitdiff.Blame(top, rel)
+		if err != nil {
+			slog.Warn("Failed to blame file", "file", rel, "error", err)
+			continue
+		}
+		for _, i := range indices {
+			items[i].Owner = authors[items[i].Line]
+		}
+	}
+}
+
+// buildDebtReport renders debt items as markdown, one section per file or
+// owner, largest first
+func buildDebtReport(items []summarization.DebtItem, group string) string {
+	var sb strings.Builder
+	sb.WriteString("# Technical Debt\n\n")
+	if len(items) == 0 {
+		sb.WriteString("No TODO, FIXME, HACK, or XXX comments or deprecated APIs found.\n")
+		return sb.String()
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Kind]++
+	}
+	var totals []string
+	for _, kind := range debtKinds {
+		if counts[kind] > 0 {
+			totals = append(totals, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("%d items: %s\n", len(items), strings.Join(totals, ", ")))
+
+	groups := make(map[string][]summarization.DebtItem)
+	for _, item := range items {
+		key := item.File
+		if group == "owner" {
+			key = item.Owner
+			if key == "" {
+				key = "Unowned"
+			}
+		}
+		groups[key] = append(groups[key], item)
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(groups[keys[i]]) != len(groups[keys[j]]) {
+			return len(groups[keys[i]]) > len(groups[keys[j]])
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("\n## %s (%d)\n\n", key, len(groups[key])))
+		for _, item := range groups[key] {
+			location := fmt.Sprintf("line %d", item.Line)
+			if group == "owner" {
+				location = fmt.Sprintf("%s:%d", item.File, item.Line)
+			}
+			sb.WriteString(fmt.Sprintf("- %s **%s**", location, item.Kind))
+			if item.Symbol != "" {
+				sb.WriteString(" `" + item.Symbol + "`")
+			}
+			if item.Text != "" {
+				sb.WriteString(" - " + item.Text)
+			}
+			if item.Owner != "" && group != "owner" {
+				sb.WriteString(" (" + item.Owner + ")")
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
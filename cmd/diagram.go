@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/exolottl/codie/internal/diagram"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Diagram prints or writes a package dependency diagram derived from the index
+func Diagram(args []string) {
+	format := "mermaid"
+	outputPath := ""
+	label := false
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+			if format != "mermaid" && format != "dot" {
+				log.Fatalf("Invalid --format value %q: must be mermaid or dot", format)
+			}
+		} else if strings.HasPrefix(arg, "--output=") {
+			outputPath = strings.TrimPrefix(arg, "--output=")
+		} else if arg == "--label" {
+			label = true
+		}
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index so the graph reflects current imports
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadFromJSON(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+
+	graph := diagram.Build(chunks)
+
+	if label {
+		clusters, err := summarization.LabelClusters(graph)
+		if err != nil {
+			slog.Warn("Writing the diagram without clusters", "error", err)
+		} else {
+			graph.Clusters = clusters
+		}
+	}
+
+	output := graph.Mermaid()
+	if format == "dot" {
+		output = graph.DOT()
+	}
+
+	if outputPath == "" {
+		if settings.JSONOutput {
+			printJSON(struct {
+				Format       string `json:"format"`
+				Packages     int    `json:"packages"`
+				Dependencies int    `json:"dependencies"`
+				Diagram      string `json:"diagram"`
+			}{format, len(graph.Nodes), len(graph.Edges), output})
+			return
+		}
+		fmt.Print(output)
+		return
+	}
+
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		log.Fatalf("Failed to write diagram: %v", err)
+	}
+	slog.Info("Wrote diagram", "packages", len(graph.Nodes), "dependencies", len(graph.Edges), "path", outputPath)
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// DocumentedFile is a file with the doc comments written for it
+type DocumentedFile struct {
+	File     string                     `json:"file"`
+	Comments []summarization.DocComment `json:"comments"`
+	Diff     string                     `json:"diff"`
+}
+
+// Document writes doc comments for the undocumented functions of a file, or
+// of the code files of a directory, and prints them as a unified diff, or
+// applies them with --write. Functions the index shows calling or called by
+// them give the model context.
+func Document(path string, args []string) {
+	start := time.Now()
+	write := false
+	for _, arg := range args {
+		if arg == "--write" {
+			write = true
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Fatalf("Failed to access %s: %v", path, err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = packageFiles(path)
+		if len(files) == 0 {
+			log.Fatalf("No code files in %s", path)
+		}
+	}
+
+	// The index only adds context, so documenting works without one
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		slog.Info("No index; documenting without context from other files", "index", settings.IndexFile)
+	}
+
+	var documented []DocumentedFile
+	total := 0
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", file, err)
+		}
+
+		slog.Info("Documenting file", "file", file)
+		comments, err := summarization.GenerateDocComments(commandCtx, file, string(content), chunks)
+		if err != nil {
+			log.Fatalf("Failed to document %s: %v", file, err)
+		}
+		if len(comments) == 0 {
+			continue
+		}
+
+		updated := summarization.ApplyDocComments(file, string(content), comments)
+		documented = append(documented, DocumentedFile{
+			File:     filepath.ToSlash(file),
+			Comments: comments,
+			Diff:     gitdiff.Unified(filepath.ToSlash(file), string(content), updated),
+		})
+		total += len(comments)
+
+		if write {
+			if err := os.WriteFile(file, []byte(updated), fileMode(file)); err != nil {
+				log.Fatalf("Failed to write %s: %v", file, err)
+			}
+		}
+	}
+
+	if settings.JSONOutput {
+		printJSON(append([]DocumentedFile{}, documented...))
+	} else if !write {
+		for _, file := range documented {
+			fmt.Print(file.Diff)
+		}
+	}
+	slog.Info("Documented functions", "functions", total, "files", len(documented), "written", write, "duration", time.Since(start))
+}
+
+// packageFiles returns the code files directly in a directory, in name order
+func packageFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", dir, err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && fileutils.IsCodeFile(dir, entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// fileMode returns the permissions of a file, to keep them when rewriting it
+func fileMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
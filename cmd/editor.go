@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Arguments that open a file at a line in editors taken from $VISUAL or
+// $EDITOR, which vi, vim, nano, emacs, and most terminal editors accept
+const defaultEditorArgs = "+{line} {file}"
+
+// editorCommand returns the command opening file at line: the editor_command
+// template with {file} and {line} filled in, or else $VISUAL or $EDITOR
+func editorCommand(file string, line int) (*exec.Cmd, error) {
+	template := settings.EditorCommand
+	if template == "" {
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			return nil, errors.New("no editor configured: set $EDITOR or editor_command")
+		}
+		template = editor + " " + defaultEditorArgs
+	}
+
+	// The template is split into arguments before substituting, so paths with
+	// spaces stay one argument
+	line = max(line, 1)
+	fields := strings.Fields(template)
+	if len(fields) == 0 {
+		return nil, errors.New("editor_command is empty")
+	}
+	for i, field := range fields {
+		field = strings.ReplaceAll(field, "{file}", file)
+		fields[i] = strings.ReplaceAll(field, "{line}", strconv.Itoa(line))
+	}
+
+	command := exec.Command(fields[0], fields[1:]...)
+	command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return command, nil
+}
+
+// openInEditor opens file at line and waits for the editor to exit, which
+// for GUI editors is usually as soon as the file is handed over
+func openInEditor(file string, line int) error {
+	command, err := editorCommand(file, line)
+	if err != nil {
+		return err
+	}
+	return command.Run()
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/config"
+	"github.com/exolottl/codie/pkg/index"
+)
+
+// File in the data directory holding the errors of the last indexing run
+const errorReportName = "last-run-errors.json"
+
+// RunError is one error of an indexing run
+type RunError struct {
+	Stage string `json:"stage"` // discovery or indexing
+	File  string `json:"file,omitempty"`
+	Error string `json:"error"`
+}
+
+// ErrorReport lists every error of the last run that discovered or indexed
+// files, so they can be reviewed after the warnings have scrolled by
+type ErrorReport struct {
+	Directory string     `json:"directory"`
+	Time      time.Time  `json:"time"`
+	Errors    []RunError `json:"errors"`
+}
+
+// Errors of the running command, written to the error report as they are
+// recorded
+var runErrors struct {
+	mu     sync.Mutex
+	report *ErrorReport
+}
+
+// errorReportPath returns where the error report is kept
+func errorReportPath() string {
+	return filepath.Join(config.DataDir(), errorReportName)
+}
+
+// startErrorReport begins the error report of a run over dir, replacing the
+// last one
+func startErrorReport(dir string) {
+	runErrors.mu.Lock()
+	defer runErrors.mu.Unlock()
+	runErrors.report = &ErrorReport{Directory: dir, Time: time.Now().UTC(), Errors: []RunError{}}
+	saveErrorReport()
+}
+
+// recordRunErrors adds errs to the error report of this run and saves it
+func recordRunErrors(stage string, errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+	runErrors.mu.Lock()
+	defer runErrors.mu.Unlock()
+	if runErrors.report == nil {
+		runErrors.report = &ErrorReport{Time: time.Now().UTC(), Errors: []RunError{}}
+	}
+	for _, err := range errs {
+		runError := RunError{Stage: stage, Error: err.Error()}
+		var fileErr *index.FileError
+		var pathErr *fs.PathError
+		if errors.As(err, &fileErr) {
+			runError.File, runError.Error = fileErr.File, fileErr.Err.Error()
+		} else if errors.As(err, &pathErr) {
+			runError.File, runError.Error = pathErr.Path, pathErr.Err.Error()
+		}
+		runErrors.report.Errors = append(runErrors.report.Errors, runError)
+	}
+	saveErrorReport()
+}
+
+// saveErrorReport writes the error report of this run, with runErrors.mu
+// held
+func saveErrorReport() {
+	data, err := json.MarshalIndent(runErrors.report, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(errorReportPath()), 0o755); err == nil {
+			err = os.WriteFile(errorReportPath(), data, 0o644)
+		}
+	}
+	if err != nil {
+		slog.Warn("Failed to save the error report", "path", errorReportPath(), "error", err)
+	}
+}
+
+// splitErrors returns the errors joined in err, or err alone
+func splitErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// Errors prints the errors of the last run that discovered or indexed files
+func Errors(args []string) {
+	data, err := os.ReadFile(errorReportPath())
+	if os.IsNotExist(err) {
+		log.Fatalf("No errors recorded yet; %s is written by runs that index files", errorReportPath())
+	} else if err != nil {
+		log.Fatalf("Failed to read %s: %v", errorReportPath(), err)
+	}
+	var report ErrorReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		log.Fatalf("Failed to parse %s: %v", errorReportPath(), err)
+	}
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	printErrorReport(report)
+}
+
+// printErrorReport prints the errors of a run grouped by stage
+func printErrorReport(report ErrorReport) {
+	where := ""
+	if report.Directory != "" {
+		where = " over " + report.Directory
+	}
+	if len(report.Errors) == 0 {
+		fmt.Printf("The last run%s, at %s, had no errors\n", where, report.Time.Local().Format(time.DateTime))
+		return
+	}
+
+	fmt.Printf("%d errors in the last run%s, at %s\n", len(report.Errors), where, report.Time.Local().Format(time.DateTime))
+	for _, stage := range []string{"discovery", "indexing"} {
+		var stageErrors []RunError
+		for _, runError := range report.Errors {
+			if runError.Stage == stage {
+				stageErrors = append(stageErrors, runError)
+			}
+		}
+		if len(stageErrors) == 0 {
+			continue
+		}
+
+		fmt.Printf("\n%s (%d):\n", stage, len(stageErrors))
+		for _, runError := range stageErrors {
+			if runError.File != "" {
+				fmt.Printf("  %s: %s\n", runError.File, runError.Error)
+			} else {
+				fmt.Printf("  %s\n", runError.Error)
+			}
+		}
+	}
+}
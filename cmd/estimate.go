@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/pricing"
+	"github.com/sashabaranov/go-openai"
+)
+
+// Embedding models shown for comparison in cost estimates
+var estimateModels = []openai.EmbeddingModel{
+	openai.SmallEmbedding3,
+	openai.LargeEmbedding3,
+	openai.AdaEmbeddingV2,
+	"embed-english-v3.0",
+	"embed-multilingual-v3.0",
+	"text-embedding-004",
+}
+
+// IndexEstimate summarizes what indexing a set of files would send to the embeddings API
+type IndexEstimate struct {
+	Files         int                `json:"files"`
+	Chunks        int                `json:"chunks"`
+	SkippedChunks int                `json:"skipped_chunks"` // Chunks over the embedding token limit
+	Tokens        int                `json:"tokens"`
+	Cost          float64            `json:"estimated_cost_usd"` // Estimated cost with the configured embedding model
+	ModelCosts    map[string]float64 `json:"model_costs_usd"`    // Estimated cost with each model in estimateModels
+}
+
+// estimateIndexCost chunks files locally, without calling the API, and
+// estimates the tokens and cost of embedding them
+func estimateIndexCost(files []string, options IndexOptions) IndexEstimate {
+	estimate := IndexEstimate{Files: len(files)}
+
+	for _, file := range files {
+		content, err := fileutils.ReadFileContent(file)
+		if err != nil {
+			continue
+		}
+
+		chunks, err := embeddings.ExtractCodeChunks(file, content, embeddings.ChunkOptions{
+			MaxChunkSize: settings.MaxChunkSize,
+			Overlap:      options.ChunkOverlap,
+			MaxChunks:    settings.MaxChunksPerFile,
+			Root:         options.Root,
+		})
+		if err != nil {
+			continue
+		}
+
+		for _, chunk := range chunks {
+			tokens := pricing.EstimateTokens(chunk.EmbeddingText())
+			if tokens > embeddings.MaxTokenLimit {
+				estimate.SkippedChunks++
+				continue
+			}
+			estimate.Chunks++
+			estimate.Tokens += tokens
+		}
+	}
+
+	estimate.Cost = pricing.EstimateCost(string(embeddings.EmbeddingModel), estimate.Tokens, 0)
+	estimate.ModelCosts = make(map[string]float64)
+	for _, model := range estimateModels {
+		estimate.ModelCosts[string(model)] = pricing.EstimateCost(string(model), estimate.Tokens, 0)
+	}
+	return estimate
+}
+
+// printIndexEstimate prints an estimate with costs for the supported embedding models
+func printIndexEstimate(estimate IndexEstimate) {
+	fmt.Println("\nIndexing estimate:")
+	fmt.Printf("  Files:            %d\n", estimate.Files)
+	fmt.Printf("  Chunks:           %d\n", estimate.Chunks)
+	if estimate.SkippedChunks > 0 {
+		fmt.Printf("  Skipped chunks:   %d (over the %d-token limit)\n", estimate.SkippedChunks, embeddings.MaxTokenLimit)
+	}
+	fmt.Printf("  Estimated tokens: %d\n", estimate.Tokens)
+
+	fmt.Println("  Estimated cost:")
+	for _, model := range estimateModels {
+		marker := ""
+		if model == embeddings.EmbeddingModel {
+			marker = " (configured)"
+		}
+		fmt.Printf("    %-24s $%.4f%s\n", model, estimate.ModelCosts[string(model)], marker)
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Kinds of chunk a search can be limited to
+var chunkKinds = []string{"function", "class", "file", storage.SummaryKind}
+
+// SearchFilter limits a search to the chunks matching every filter that is
+// set; a filter with several values matches any of them
+type SearchFilter struct {
+	Languages []string // Language names ("go", "python") or file extensions ("ts")
+	Paths     []string // Files, directories, "dir/..." patterns, or globs
+	Kinds     []string // function, class, file, or summary
+	Repos     []string // Names of workspace repositories
+}
+
+// parseSearchFilter parses --lang, --path, --kind, and --repo, each taking a
+// comma-separated list
+func parseSearchFilter(args []string) SearchFilter {
+	var filter SearchFilter
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--lang=") {
+			filter.Languages = append(filter.Languages, splitFlagList(strings.TrimPrefix(arg, "--lang="))...)
+		} else if strings.HasPrefix(arg, "--path=") {
+			filter.Paths = append(filter.Paths, splitFlagList(strings.TrimPrefix(arg, "--path="))...)
+		} else if strings.HasPrefix(arg, "--kind=") {
+			for _, kind := range splitFlagList(strings.TrimPrefix(arg, "--kind=")) {
+				if !contains(chunkKinds, kind) {
+					log.Fatalf("Invalid --kind value %q: must be one of %s", kind, strings.Join(chunkKinds, ", "))
+				}
+				filter.Kinds = append(filter.Kinds, kind)
+			}
+		} else if strings.HasPrefix(arg, "--repo=") {
+			filter.Repos = append(filter.Repos, splitFlagList(strings.TrimPrefix(arg, "--repo="))...)
+		}
+	}
+	if len(filter.Repos) > 0 {
+		workspace, err := storage.LoadWorkspace(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to read workspace: %v", err)
+		}
+		for _, name := range filter.Repos {
+			if _, ok := workspace.Find(name); !ok {
+				log.Fatalf("Invalid --repo value %q: no such workspace repository (see 'workspace list')", name)
+			}
+		}
+	}
+	return filter
+}
+
+// splitFlagList splits a comma-separated flag value, dropping empty entries
+func splitFlagList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// active reports whether any filter is set
+func (f SearchFilter) active() bool {
+	return len(f.Languages) > 0 || len(f.Paths) > 0 || len(f.Kinds) > 0 || len(f.Repos) > 0
+}
+
+// apply returns the chunks matching the filter
+func (f SearchFilter) apply(chunks []storage.CodeChunk) []storage.CodeChunk {
+	var matched []storage.CodeChunk
+	for _, chunk := range chunks {
+		if f.matches(chunk) {
+			matched = append(matched, chunk)
+		}
+	}
+	return matched
+}
+
+// matches reports whether a chunk passes every filter that is set
+func (f SearchFilter) matches(chunk storage.CodeChunk) bool {
+	if len(f.Repos) > 0 && !contains(f.Repos, chunk.Repo) {
+		return false
+	}
+	if len(f.Kinds) > 0 && !contains(f.Kinds, chunkKind(chunk)) {
+		return false
+	}
+	if len(f.Languages) > 0 && !matchesAnyLanguage(chunk.File, f.Languages) {
+		return false
+	}
+	if len(f.Paths) > 0 && !matchesAnyPathPattern(chunk.File, f.Paths) {
+		return false
+	}
+	return true
+}
+
+// chunkKind classifies a chunk as a function (or method), the body of a
+// class outside its methods, file-level code, or a summary
+func chunkKind(chunk storage.CodeChunk) string {
+	switch {
+	case chunk.Kind != "":
+		return chunk.Kind
+	case chunk.Function != "":
+		return "function"
+	case chunk.Class != "":
+		return "class"
+	}
+	return "file"
+}
+
+// matchesAnyLanguage reports whether a file's language name or extension is
+// one of languages, ignoring case
+func matchesAnyLanguage(file string, languages []string) bool {
+	language := summarization.LanguageForFile(file)
+	ext := strings.TrimPrefix(filepath.Ext(file), ".")
+	for _, want := range languages {
+		want = strings.TrimPrefix(want, ".")
+		if strings.EqualFold(want, language) || strings.EqualFold(want, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyPathPattern reports whether a file matches one of patterns: a
+// file, a directory or "dir/..." containing it, or a glob matched against
+// its path relative to the current directory
+func matchesAnyPathPattern(file string, patterns []string) bool {
+	abs, _ := filepath.Abs(file)
+	cwd, _ := filepath.Abs(".")
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			if rel, err := filepath.Rel(cwd, abs); err == nil {
+				if ok, _ := filepath.Match(filepath.Clean(pattern), rel); ok {
+					return true
+				}
+			}
+			continue
+		}
+
+		dir, _ := filepath.Abs(strings.TrimSuffix(pattern, "..."))
+		if abs == dir || strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
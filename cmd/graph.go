@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/exolottl/codie/internal/graph"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Graph prints or writes the file import and function call graph of the
+// index, built during indexing and kept next to it
+func Graph(args []string) {
+	format := "dot"
+	outputPath := ""
+	calls := false
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+			if format != "dot" && format != "json" {
+				log.Fatalf("Invalid --format value %q: must be dot or json", format)
+			}
+		} else if strings.HasPrefix(arg, "--output=") {
+			outputPath = strings.TrimPrefix(arg, "--output=")
+		} else if arg == "--calls" {
+			calls = true
+		}
+	}
+
+	chunks, err := storage.LoadAnyModel(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index so the graph reflects current imports and calls
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadAnyModel(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+
+	dependencies, err := graph.Open(settings.IndexFile, chunks)
+	if err != nil {
+		slog.Warn("Failed to save the dependency graph", "path", graph.Path(settings.IndexFile), "error", err)
+	}
+	dependencies = dependencies.Relative(storage.RootDir(chunks))
+
+	var output string
+	if format == "json" {
+		data, err := json.MarshalIndent(dependencies, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode the graph: %v", err)
+		}
+		output = string(data) + "\n"
+	} else {
+		output = dependencies.DOT(calls)
+	}
+
+	if outputPath == "" {
+		if settings.JSONOutput && format != "json" {
+			printJSON(struct {
+				Format  string `json:"format"`
+				Files   int    `json:"files"`
+				Imports int    `json:"imports"`
+				Calls   int    `json:"calls"`
+				Graph   string `json:"graph"`
+			}{format, len(dependencies.Files), len(dependencies.Imports), len(dependencies.Calls), output})
+			return
+		}
+		fmt.Print(output)
+		return
+	}
+
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		log.Fatalf("Failed to write graph: %v", err)
+	}
+	slog.Info("Wrote graph", "files", len(dependencies.Files), "imports", len(dependencies.Imports), "calls", len(dependencies.Calls), "path", outputPath)
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// printJSON writes v to stdout as indented JSON, the output of every command
+// run with --json
+func printJSON(v any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatalf("Failed to write JSON output: %v", err)
+	}
+}
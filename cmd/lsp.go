@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/exolottl/codie/internal/jsonrpc"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Lines around the cursor embedded when it isn't in an indexed chunk, such
+// as in code written since the last refresh
+const lspCursorContextLines = 15
+
+// LSP serves relevant context for a cursor position or selection over stdin
+// and stdout, with the framing and lifecycle of the Language Server Protocol,
+// so IDE extensions can start Codie like a language server. Like the daemon,
+// it keeps the index in memory and re-indexes files as they change.
+func LSP(args []string) {
+	dir := ""
+	debounce := DefaultDaemonDebounce
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--debounce=") {
+			d, err := time.ParseDuration(strings.TrimPrefix(arg, "--debounce="))
+			if err != nil || d < 0 {
+				log.Fatalf("Invalid --debounce value %q: must be a duration such as 500ms", arg)
+			}
+			debounce = d
+		} else if !strings.HasPrefix(arg, "--") {
+			dir = arg
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(commandCtx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l := &lspServer{daemon: startDaemon(ctx, dir, debounce, args), documents: make(map[string]string)}
+
+	server := jsonrpc.NewServer()
+	server.Register("initialize", l.initialize)
+	server.Register("initialized", ignoreNotification)
+	server.Register("shutdown", l.shutdown)
+	server.Register("exit", l.exit)
+	server.Register("textDocument/didOpen", l.didOpen)
+	server.Register("textDocument/didChange", l.didChange)
+	server.Register("textDocument/didClose", l.didClose)
+	server.Register("github.com/exolottl/codie/context", l.handleContext)
+	server.Register("github.com/exolottl/codie/search", l.daemon.handleSearch)
+
+	slog.Info("Serving context over stdio", "dir", l.daemon.dir, "chunks", len(l.daemon.chunks))
+	done := make(chan struct{})
+	go func() {
+		server.ServeHeaderFramed(ctx, stdio{})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// stdio is the connection of a server started by an editor
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdio) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdio) Close() error                { return os.Stdin.Close() }
+
+// lspServer adds the lifecycle and open documents of a language server to
+// the daemon's index
+type lspServer struct {
+	daemon *daemon
+
+	mu        sync.Mutex
+	documents map[string]string // Text of open documents by URI, including unsaved edits
+
+	shutdownRequested atomic.Bool
+}
+
+// LSP position, with 0-based line and character
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// LSP range, with an exclusive end
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+// empty reports whether the range selects nothing
+func (r lspRange) empty() bool {
+	return r.Start == r.End
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text,omitempty"`
+}
+
+func (l *lspServer) initialize(ctx context.Context, raw json.RawMessage) (any, error) {
+	return map[string]any{
+		"capabilities": map[string]any{
+			// Full document sync, so context can be found for unsaved code
+			"textDocumentSync": 1,
+			"experimental":     map[string]any{"codieContext": true, "codieSearch": true},
+		},
+		"serverInfo": map[string]any{"name": "codie"},
+	}, nil
+}
+
+func (l *lspServer) shutdown(ctx context.Context, raw json.RawMessage) (any, error) {
+	l.shutdownRequested.Store(true)
+	return nil, nil
+}
+
+// exit ends the process, with an error status unless shutdown was requested
+// first, as the protocol specifies
+func (l *lspServer) exit(ctx context.Context, raw json.RawMessage) (any, error) {
+	if l.shutdownRequested.Load() {
+		os.Exit(0)
+	}
+	os.Exit(1)
+	return nil, nil
+}
+
+func ignoreNotification(ctx context.Context, raw json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+func (l *lspServer) didOpen(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params struct {
+		TextDocument lspTextDocument `json:"textDocument"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, jsonrpc.InvalidParams("invalid params: %v", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.documents[params.TextDocument.URI] = params.TextDocument.Text
+	return nil, nil
+}
+
+func (l *lspServer) didChange(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params struct {
+		TextDocument   lspTextDocument `json:"textDocument"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, jsonrpc.InvalidParams("invalid params: %v", err)
+	}
+	// With full sync, the last change is the whole document
+	if n := len(params.ContentChanges); n > 0 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.documents[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+	}
+	return nil, nil
+}
+
+func (l *lspServer) didClose(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params struct {
+		TextDocument lspTextDocument `json:"textDocument"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, jsonrpc.InvalidParams("invalid params: %v", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.documents, params.TextDocument.URI)
+	return nil, nil
+}
+
+// documentLines returns the lines of a document: the editor's copy if it is
+// open, or else the file on disk
+func (l *lspServer) documentLines(uri, path string) ([]string, error) {
+	l.mu.Lock()
+	text, ok := l.documents[uri]
+	l.mu.Unlock()
+	if !ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), nil
+}
+
+// lspContextParams are the parameters of codie/context
+type lspContextParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     lspPosition     `json:"position"`
+	Range        *lspRange       `json:"range"` // The selection, if any
+	TopK         int             `json:"topK"`
+}
+
+// lspContextItem is a chunk of context, located as an LSP location
+type lspContextItem struct {
+	URI     string   `json:"uri"`
+	Range   lspRange `json:"range"`
+	Score   float32  `json:"score"`
+	Symbol  string   `json:"symbol,omitempty"`
+	Content string   `json:"content"`
+}
+
+// handleContext answers codie/context: the chunks most relevant to a
+// selection, or to the code at the cursor, best first. The code itself is
+// left out. At a cursor in an indexed chunk the chunk's stored embedding is
+// used, so no API call is made.
+func (l *lspServer) handleContext(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params lspContextParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, jsonrpc.InvalidParams("invalid params: %v", err)
+	}
+	path, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, jsonrpc.InvalidParams("%v", err)
+	}
+	topK := params.TopK
+	if topK <= 0 {
+		topK = DefaultSearchResults
+	}
+
+	chunks, ann := l.daemon.snapshot()
+
+	// Lines of the code to find context for, 1-based as in the index
+	var embedding []float32
+	var first, last int
+	if params.Range != nil && !params.Range.empty() {
+		first, last = params.Range.Start.Line+1, params.Range.End.Line+1
+		if params.Range.End.Character == 0 && last > first {
+			last--
+		}
+	} else if chunk, ok := chunkAt(chunks, path, params.Position.Line+1); ok {
+		embedding, first, last = chunk.Embedding, chunk.StartLine, chunk.EndLine
+	} else {
+		line := params.Position.Line + 1
+		first, last = max(1, line-lspCursorContextLines), line+lspCursorContextLines
+	}
+
+	if embedding == nil {
+		lines, err := l.documentLines(params.TextDocument.URI, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		text := selectText(lines, params.Range, first, last)
+		if strings.TrimSpace(text) == "" {
+			return map[string]any{"items": []lspContextItem{}}, nil
+		}
+		if len(text) > settings.MaxChunkSize {
+			text = text[:settings.MaxChunkSize]
+		}
+		if embedding, err = l.daemon.queryEmbedding(ctx, text); err != nil {
+			return nil, fmt.Errorf("failed to embed the code: %w", err)
+		}
+	}
+
+	isSource := func(chunk storage.CodeChunk) bool {
+		return chunk.EndLine >= first && chunk.StartLine <= last && samePath(chunk.File, path)
+	}
+	related, err := relatedChunks(ctx, chunks, ann, embedding, topK, isSource)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []lspContextItem{}
+	for _, result := range related {
+		items = append(items, newLSPContextItem(result))
+	}
+	return map[string]any{"items": items}, nil
+}
+
+// selectText returns the selected text of a document, or lines first through
+// last when nothing is selected
+func selectText(lines []string, selection *lspRange, first, last int) string {
+	if first > len(lines) {
+		return ""
+	}
+	last = min(last, len(lines))
+	selected := append([]string(nil), lines[first-1:last]...)
+	if selection == nil || selection.empty() {
+		return strings.Join(selected, "\n")
+	}
+
+	// Characters are counted as runes, which matches the protocol's UTF-16
+	// offsets outside of astral characters
+	if end := selection.End; end.Line+1 == last {
+		runes := []rune(selected[len(selected)-1])
+		selected[len(selected)-1] = string(runes[:min(end.Character, len(runes))])
+	}
+	runes := []rune(selected[0])
+	selected[0] = string(runes[min(selection.Start.Character, len(runes)):])
+	return strings.Join(selected, "\n")
+}
+
+// newLSPContextItem locates a result as an LSP location
+func newLSPContextItem(result search.Result) lspContextItem {
+	chunk := result.Chunk
+	symbol := chunk.Function
+	if chunk.Class != "" && symbol != "" {
+		symbol = chunk.Class + "." + symbol
+	} else if symbol == "" {
+		symbol = chunk.Class
+	}
+	return lspContextItem{
+		URI: pathToURI(chunk.File),
+		Range: lspRange{
+			Start: lspPosition{Line: max(0, chunk.StartLine-1)},
+			End:   lspPosition{Line: chunk.EndLine},
+		},
+		Score:   result.Score,
+		Symbol:  symbol,
+		Content: chunk.Content,
+	}
+}
+
+// uriToPath returns the path of a file URI
+func uriToPath(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return "", errors.New("textDocument.uri must be a file URI")
+	}
+	path := parsed.Path
+	// Windows paths are written as /C:/...
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// pathToURI returns the file URI of a path
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
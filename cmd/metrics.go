@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/exolottl/codie/internal/quality"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Metrics prints the cyclomatic complexity, nesting, and length of the
+// index's functions, the length of its files, and its duplicated chunks
+func Metrics(args []string) {
+	format := "text"
+	outputPath := ""
+	top := 20
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--format=") {
+			format = strings.TrimPrefix(arg, "--format=")
+			if format != "text" && format != "json" {
+				log.Fatalf("Invalid --format value %q: must be text or json", format)
+			}
+		} else if strings.HasPrefix(arg, "--output=") {
+			outputPath = strings.TrimPrefix(arg, "--output=")
+		} else if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			top = n
+		}
+	}
+
+	chunks, err := storage.LoadAnyModel(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index so duplicates are found among current chunks
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadAnyModel(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+
+	report := quality.Analyze(chunks).Relative(storage.RootDir(chunks))
+
+	if settings.JSONOutput && outputPath == "" {
+		printJSON(report)
+		return
+	}
+
+	var output string
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode metrics: %v", err)
+		}
+		output = string(data) + "\n"
+	} else {
+		output = report.Text(top)
+	}
+
+	if outputPath == "" {
+		fmt.Print(output)
+		return
+	}
+	if err := os.WriteFile(outputPath, []byte(output), 0644); err != nil {
+		log.Fatalf("Failed to write metrics: %v", err)
+	}
+	slog.Info("Wrote metrics", "files", len(report.Files), "functions", len(report.Functions), "path", outputPath)
+}
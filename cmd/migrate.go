@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// MigrateReport describes an index copied to another store or schema version
+type MigrateReport struct {
+	From           string `json:"from"`            // Backend read
+	To             string `json:"to"`              // Backend written
+	Source         string `json:"source"`          // Index read
+	Destination    string `json:"destination"`     // Index written
+	FromSchema     int    `json:"from_schema"`     // Schema version of the index read
+	ToSchema       int    `json:"to_schema"`       // Schema version written
+	Files          int    `json:"files"`           // Files whose chunks were copied
+	Chunks         int    `json:"chunks"`          // Chunks copied, as counted again in the new index
+	EmbeddingModel string `json:"embedding_model"` // Model recorded for the chunks
+	DurationMS     int64  `json:"duration_ms"`
+}
+
+// Migrate copies the index to another storage backend, or rewrites it at the
+// current schema version, streaming its chunks so the index is never held in
+// memory. The copy keeps the source's header, and its chunks are counted
+// again before the report, which fails the command if any went missing.
+func Migrate(args []string) {
+	from, to := settings.Store, settings.Store
+	out := settings.IndexFile
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--from=") {
+			from = strings.TrimPrefix(arg, "--from=")
+		} else if strings.HasPrefix(arg, "--to=") {
+			to = strings.TrimPrefix(arg, "--to=")
+		} else if strings.HasPrefix(arg, "--out=") {
+			out = strings.TrimPrefix(arg, "--out=")
+		}
+	}
+	for flag, backend := range map[string]string{"--from": from, "--to": to} {
+		if !slices.Contains(storage.Backends, backend) {
+			log.Fatalf("Unsupported backend %q for %s: supported backends are %s", backend, flag, strings.Join(storage.Backends, ", "))
+		}
+	}
+	// Another backend can't be written over the index being read
+	if from != to && out == settings.IndexFile {
+		log.Fatalf("Migrating from %s to %s needs --out=<path> for the new index", from, to)
+	}
+
+	options := storage.Options{VectorPrecision: settings.VectorPrecision}
+	source, err := storage.Open(from, settings.IndexFile, options)
+	if err != nil {
+		log.Fatalf("Failed to open the index to migrate: %v", err)
+	}
+	destination, err := storage.Open(to, out, options)
+	if err != nil {
+		log.Fatalf("Failed to open the store to migrate to: %v", err)
+	}
+
+	header, err := source.Header()
+	if err != nil {
+		log.Fatalf("Failed to read index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	if header.SchemaVersion > storage.SchemaVersion {
+		log.Fatalf("Index %s has schema version %d, newer than the %d this version of codie writes; upgrade codie to migrate it",
+			settings.IndexFile, header.SchemaVersion, storage.SchemaVersion)
+	}
+	if from == to && out == settings.IndexFile && header.SchemaVersion == storage.SchemaVersion {
+		fmt.Printf("Index %s is already stored in %s at schema version %d; nothing to migrate\n", settings.IndexFile, to, storage.SchemaVersion)
+		return
+	}
+
+	// The copy is described by the source's header rather than by this run's
+	// settings. An index without a header is assumed to match them.
+	if header.SchemaVersion > 1 {
+		storage.Current.EmbeddingModel = header.EmbeddingModel
+		storage.Current.ChunkerVersion = header.ChunkerVersion
+		storage.Current.Fingerprint = header.Fingerprint
+		storage.Current.Commit = header.Commit
+		storage.Current.CreatedAt = header.CreatedAt
+	} else {
+		slog.Warn("Index has no header; recording the configured settings in the new one",
+			"embedding_model", storage.Current.EmbeddingModel)
+	}
+
+	start := time.Now()
+	files, copied, err := copyIndex(source, destination)
+	if err != nil {
+		log.Fatalf("Failed to migrate %s: %v", settings.IndexFile, err)
+	}
+
+	// Count the chunks again from the new index before trusting it
+	counted := 0
+	if err := destination.Scan(func(storage.CodeChunk) error { counted++; return nil }); err != nil {
+		log.Fatalf("Failed to read back the migrated index %s: %v", out, err)
+	}
+	if counted != copied {
+		log.Fatalf("Migrated index %s holds %d chunks but %d were copied; rebuild it with 'codie index <directory>'", out, counted, copied)
+	}
+	if out != settings.IndexFile {
+		copySidecarFiles(settings.IndexFile, out)
+	}
+
+	report := MigrateReport{
+		From:           from,
+		To:             to,
+		Source:         settings.IndexFile,
+		Destination:    out,
+		FromSchema:     header.SchemaVersion,
+		ToSchema:       storage.SchemaVersion,
+		Files:          files,
+		Chunks:         counted,
+		EmbeddingModel: storage.Current.EmbeddingModel,
+		DurationMS:     time.Since(start).Milliseconds(),
+	}
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	fmt.Printf("Migrated %d chunks of %d files from %s (%s, schema %d) to %s (%s, schema %d) in %v\n",
+		report.Chunks, report.Files, report.Source, report.From, report.FromSchema,
+		report.Destination, report.To, report.ToSchema, time.Duration(report.DurationMS)*time.Millisecond)
+}
+
+// copyIndex streams the chunks of source into a new index in destination,
+// a file at a time, returning the files and chunks copied. Nothing replaces
+// the destination's index unless every chunk was copied.
+func copyIndex(source, destination storage.Store) (int, int, error) {
+	writer, err := destination.NewWriter()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer writer.Close()
+
+	var pending []storage.CodeChunk
+	files, chunks := 0, 0
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := writer.WriteFile(pending[0].File, pending); err != nil {
+			return err
+		}
+		files++
+		chunks += len(pending)
+		pending = nil
+		return nil
+	}
+	err = source.Scan(func(chunk storage.CodeChunk) error {
+		if len(pending) > 0 && chunk.File != pending[0].File {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		pending = append(pending, chunk)
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = writer.Commit()
+	}
+	return files, chunks, err
+}
+
+// copySidecarFiles copies the files kept next to an index, such as its
+// source metadata, workspace, and summaries, to sit next to a copy of it
+func copySidecarFiles(indexPath, copyPath string) {
+	sidecars := []func(string) string{storage.MetadataPath, storage.WorkspacePath, summarization.SummaryCachePath}
+	for _, path := range sidecars {
+		if err := copyFile(path(indexPath), path(copyPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to copy a file kept next to the index", "path", path(indexPath), "error", err)
+		}
+	}
+}
+
+// copyFile copies the file at src to dst, replacing it
+func copyFile(src, dst string) error {
+	input, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
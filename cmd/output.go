@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/exolottl/codie/internal/notify"
+	"github.com/exolottl/codie/internal/summarization"
+	"github.com/yuin/goldmark"
+)
+
+// Supported summary output formats
+var summaryFormats = []string{"markdown", "html", "json", "plain"}
+
+// SummaryOutput configures where and how a summary is written
+type SummaryOutput struct {
+	Path   string // File to write to; empty prints to stdout
+	Format string // One of summaryFormats; empty renders for the terminal
+}
+
+// parseSummaryOutput parses --output and --format. When only --output is
+// given, the format is inferred from the file extension; with --json and
+// neither, the summary is printed as JSON.
+func parseSummaryOutput(args []string) SummaryOutput {
+	var output SummaryOutput
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--output=") {
+			output.Path = strings.TrimPrefix(arg, "--output=")
+		} else if strings.HasPrefix(arg, "--format=") {
+			output.Format = strings.TrimPrefix(arg, "--format=")
+			if !contains(summaryFormats, output.Format) {
+				log.Fatalf("Invalid --format value %q: must be one of %s", output.Format, strings.Join(summaryFormats, ", "))
+			}
+		}
+	}
+
+	if output.Path == "" && output.Format == "" && settings.JSONOutput {
+		output.Format = "json"
+	}
+
+	if output.Path != "" && output.Format == "" {
+		switch strings.ToLower(filepath.Ext(output.Path)) {
+		case ".html", ".htm":
+			output.Format = "html"
+		case ".json":
+			output.Format = "json"
+		case ".txt":
+			output.Format = "plain"
+		default:
+			output.Format = "markdown"
+		}
+	}
+
+	return output
+}
+
+// writeSummary renders a markdown summary in the requested format and writes
+// it to the output file, or prints it to the terminal
+func writeSummary(title, summary string, output SummaryOutput) {
+	writeSummaryResult(title, summarization.SummaryResult{Text: summary}, output)
+}
+
+// writeSummaryResult is writeSummary for a codebase summary, whose JSON
+// output adds how it was made and the tokens it took
+func writeSummaryResult(title string, result summarization.SummaryResult, output SummaryOutput) {
+	summary := result.Text
+
+	// Posted once the summary is written, so a failing webhook loses nothing
+	defer notifyWebhook(title, summary)
+
+	if output.Format == "" {
+		fmt.Printf("\n--- %s ---\n", strings.ToUpper(title))
+		rendered, _ := glamour.Render(summary, "dark")
+		fmt.Println(rendered)
+		return
+	}
+
+	content, err := formatSummary(title, result, output.Format)
+	if err != nil {
+		log.Fatalf("Failed to format summary: %v", err)
+	}
+
+	if output.Path == "" {
+		fmt.Print(content)
+		return
+	}
+
+	if err := os.WriteFile(output.Path, []byte(content), 0644); err != nil {
+		log.Fatalf("Failed to write summary: %v", err)
+	}
+	slog.Info("Summary written", "path", output.Path, "format", output.Format)
+
+	if settings.JSONOutput {
+		printJSON(map[string]string{"title": title, "path": output.Path, "format": output.Format})
+	}
+}
+
+// notifyWebhook posts a markdown report to the Slack or Teams webhook of the
+// notify_webhook setting, if one is set
+func notifyWebhook(title, report string) {
+	if settings.NotifyWebhook == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(commandCtx, 2*time.Minute)
+	defer cancel()
+
+	kind := notify.Kind(settings.NotifyWebhook)
+	messages, err := notify.Post(ctx, settings.NotifyWebhook, title, report)
+	if err != nil {
+		log.Fatalf("Failed to post to the %s webhook: %v", kind, err)
+	}
+	slog.Info("Posted to webhook", "service", kind, "messages", messages)
+}
+
+// formatSummary converts a markdown summary to the given format
+func formatSummary(title string, result summarization.SummaryResult, format string) (string, error) {
+	summary := result.Text
+	switch format {
+	case "markdown":
+		return summary + "\n", nil
+
+	case "plain":
+		// The notty style renders markdown as plain text without ANSI codes,
+		// but pads every line to the wrap width
+		rendered, err := glamour.Render(summary, "notty")
+		if err != nil {
+			return "", err
+		}
+		lines := strings.Split(rendered, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " ")
+		}
+		return strings.TrimSpace(strings.Join(lines, "\n")) + "\n", nil
+
+	case "html":
+		var body bytes.Buffer
+		if err := goldmark.Convert([]byte(summary), &body); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n%s</body>\n</html>\n",
+			html.EscapeString(title), body.String()), nil
+
+	case "json":
+		document := struct {
+			Title       string                         `json:"title"`
+			Model       string                         `json:"model"`
+			GeneratedAt time.Time                      `json:"generated_at"`
+			Summary     string                         `json:"summary"`
+			Sections    []summarization.SummarySection `json:"sections"`
+			Metadata    *summarization.SummaryMetadata `json:"metadata,omitempty"`
+			Usage       *summarization.TokenUsage      `json:"usage,omitempty"`
+		}{title, summarization.ChatModel, time.Now(), summary, summarization.SplitSections(summary), nil, nil}
+		if !result.Metadata.GeneratedAt.IsZero() {
+			document.Model, document.GeneratedAt = result.Metadata.Model, result.Metadata.GeneratedAt
+			document.Metadata, document.Usage = &result.Metadata, &result.Usage
+		}
+		data, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+
+	return "", fmt.Errorf("unsupported format %q", format)
+}
+
+// contains reports whether value is in list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
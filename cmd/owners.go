@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Default number of chunks matched by a query to the owners command
+const DefaultOwnersResults = 10
+
+// Default number of contributors listed per area
+const DefaultOwnersPerArea = 3
+
+// Contributor is someone who last changed lines of an area
+type Contributor struct {
+	Author      string    `json:"author"`
+	Lines       int       `json:"lines"`   // Lines of the area they last changed
+	Commits     int       `json:"commits"` // Distinct commits those changes came from
+	LastChanged time.Time `json:"last_changed,omitzero"`
+}
+
+// OwnerArea is a file matched by the owners command, with the people who
+// last changed its matched lines, most lines first
+type OwnerArea struct {
+	File         string        `json:"file"`
+	Score        float32       `json:"score,omitempty"` // Best similarity of its chunks to the query
+	Lines        int           `json:"lines"`           // Lines of the file matched
+	Contributors []Contributor `json:"contributors"`
+}
+
+// OwnersReport answers who to ask about a query or path
+type OwnersReport struct {
+	Target  string        `json:"target"`
+	IsPath  bool          `json:"is_path"`
+	Areas   []OwnerArea   `json:"areas"`
+	Overall []Contributor `json:"overall"` // Contributors across every area
+}
+
+// Owners finds the code matching a query, or the indexed files under a path,
+// and lists the people who last changed most of it, per file and overall.
+// Lines are attributed with git blame, or, for files git can't blame, by the
+// last change recorded on their chunks when indexed with --git.
+func Owners(target string, args []string) {
+	topK := DefaultOwnersResults
+	perArea := DefaultOwnersPerArea
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			topK = n
+		} else if strings.HasPrefix(arg, "--contributors=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--contributors="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --contributors value %q: must be a positive integer", arg)
+			}
+			perArea = n
+		}
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	report := OwnersReport{Target: target, Areas: []OwnerArea{}, Overall: []Contributor{}}
+	var matched []ownedChunk
+	if _, err := os.Stat(target); err == nil {
+		report.IsPath = true
+		matched = chunksUnder(chunks, target)
+		if len(matched) == 0 {
+			log.Fatalf("No indexed code under %s", target)
+		}
+	} else {
+		queryEmbedding, err := embeddings.GetQueryEmbeddingContext(commandCtx, target)
+		if err != nil {
+			log.Fatalf("Failed to embed query: %v", err)
+		}
+		for result := range streamSearch(commandCtx, openANN(chunks), chunks, queryEmbedding, topK) {
+			matched = append(matched, ownedChunk{result.Chunk, result.Score})
+		}
+	}
+
+	overall := make(map[string]*contributorTally)
+	for _, area := range groupOwnedChunks(matched) {
+		tallies := tallyArea(area)
+		for author, tally := range tallies {
+			if overall[author] == nil {
+				overall[author] = &contributorTally{commits: make(map[string]bool)}
+			}
+			overall[author].merge(tally)
+		}
+		contributors := rankContributors(tallies)
+		report.Areas = append(report.Areas, OwnerArea{
+			File:         area[0].File,
+			Score:        area[0].score,
+			Lines:        matchedLines(area),
+			Contributors: contributors[:min(perArea, len(contributors))],
+		})
+	}
+	report.Overall = rankContributors(overall)
+	report.Overall = report.Overall[:min(perArea, len(report.Overall))]
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	printOwnersReport(report)
+}
+
+// ownedChunk is a chunk matched by the owners command, with its similarity
+// to the query
+type ownedChunk struct {
+	storage.CodeChunk
+	score float32
+}
+
+// chunksUnder returns the code chunks of the file at path, or of the files
+// under the directory at path
+func chunksUnder(chunks []storage.CodeChunk, path string) []ownedChunk {
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	var matched []ownedChunk
+	for _, chunk := range chunks {
+		file, err := filepath.Abs(chunk.File)
+		if err != nil {
+			continue
+		}
+		if file == target || strings.HasPrefix(file, target+string(filepath.Separator)) {
+			matched = append(matched, ownedChunk{CodeChunk: chunk})
+		}
+	}
+	return matched
+}
+
+// groupOwnedChunks groups matched chunks by file, ordered by their best
+// score and then by path
+func groupOwnedChunks(matched []ownedChunk) [][]ownedChunk {
+	byFile := make(map[string][]ownedChunk)
+	var files []string
+	for _, chunk := range matched {
+		if chunk.Kind == storage.SummaryKind {
+			continue
+		}
+		if _, ok := byFile[chunk.File]; !ok {
+			files = append(files, chunk.File)
+		}
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+	// Matches arrive best first, so the first chunk of a file is its best
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := byFile[files[i]][0], byFile[files[j]][0]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		return a.File < b.File
+	})
+
+	areas := make([][]ownedChunk, len(files))
+	for i, file := range files {
+		areas[i] = byFile[file]
+	}
+	return areas
+}
+
+// contributorTally counts what one author last changed
+type contributorTally struct {
+	lines       int
+	commits     map[string]bool
+	lastChanged time.Time
+}
+
+func (t *contributorTally) add(lines int, commit string, changed time.Time) {
+	t.lines += lines
+	t.commits[commit] = true
+	if changed.After(t.lastChanged) {
+		t.lastChanged = changed
+	}
+}
+
+func (t *contributorTally) merge(other *contributorTally) {
+	t.lines += other.lines
+	for commit := range other.commits {
+		t.commits[commit] = true
+	}
+	if other.lastChanged.After(t.lastChanged) {
+		t.lastChanged = other.lastChanged
+	}
+}
+
+// tallyArea attributes the matched lines of one file to the authors who last
+// changed them, by blaming the file or, failing that, by the last change
+// recorded on each chunk
+func tallyArea(area []ownedChunk) map[string]*contributorTally {
+	tallies := make(map[string]*contributorTally)
+	tally := func(author string) *contributorTally {
+		if tallies[author] == nil {
+			tallies[author] = &contributorTally{commits: make(map[string]bool)}
+		}
+		return tallies[author]
+	}
+
+	file := area[0].File
+	blame, err := gitdiff.BlameLines(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		for _, chunk := range area {
+			if chunk.LastAuthor != "" {
+				tally(chunk.LastAuthor).add(chunk.EndLine-chunk.StartLine+1, chunk.LastCommit, chunk.LastChanged)
+			}
+		}
+		return tallies
+	}
+
+	// Chunks can overlap, so each line is counted once
+	counted := make(map[int]bool)
+	for _, chunk := range area {
+		for line := chunk.StartLine; line <= chunk.EndLine; line++ {
+			change, ok := blame[line]
+			if !ok || counted[line] {
+				continue
+			}
+			counted[line] = true
+			tally(change.Author).add(1, change.Commit, change.Time)
+		}
+	}
+	return tallies
+}
+
+// matchedLines counts the distinct lines of an area's chunks
+func matchedLines(area []ownedChunk) int {
+	lines := make(map[int]bool)
+	for _, chunk := range area {
+		for line := chunk.StartLine; line <= chunk.EndLine; line++ {
+			lines[line] = true
+		}
+	}
+	return len(lines)
+}
+
+// rankContributors lists tallied authors, most lines first
+func rankContributors(tallies map[string]*contributorTally) []Contributor {
+	contributors := []Contributor{}
+	for author, tally := range tallies {
+		contributors = append(contributors, Contributor{
+			Author:      author,
+			Lines:       tally.lines,
+			Commits:     len(tally.commits),
+			LastChanged: tally.lastChanged,
+		})
+	}
+	sort.Slice(contributors, func(i, j int) bool {
+		if contributors[i].Lines != contributors[j].Lines {
+			return contributors[i].Lines > contributors[j].Lines
+		}
+		return contributors[i].Author < contributors[j].Author
+	})
+	return contributors
+}
+
+// printOwnersReport prints the contributors of each area and overall
+func printOwnersReport(report OwnersReport) {
+	if len(report.Areas) == 0 {
+		fmt.Println("No indexed code matches.")
+		return
+	}
+	if report.IsPath {
+		fmt.Printf("Owners of %s:\n", report.Target)
+	} else {
+		fmt.Printf("Owners of code matching %q:\n", report.Target)
+	}
+
+	for _, area := range report.Areas {
+		fmt.Println()
+		if report.IsPath {
+			fmt.Printf("%s (%d lines)\n", area.File, area.Lines)
+		} else {
+			fmt.Printf("%s (%d lines, score %.3f)\n", area.File, area.Lines, area.Score)
+		}
+		if len(area.Contributors) == 0 {
+			fmt.Println("    No committed history")
+		}
+		for _, contributor := range area.Contributors {
+			fmt.Println("    " + formatContributor(contributor))
+		}
+	}
+
+	if len(report.Overall) == 0 {
+		fmt.Println("\nNo git history found for the matched code; index with --git to record who changed it.")
+		return
+	}
+	fmt.Println("\nOverall:")
+	for _, contributor := range report.Overall {
+		fmt.Println("    " + formatContributor(contributor))
+	}
+}
+
+// formatContributor describes a contributor's share of an area on one line
+func formatContributor(c Contributor) string {
+	commits := "commits"
+	if c.Commits == 1 {
+		commits = "commit"
+	}
+	return fmt.Sprintf("%-24s %5d lines, %d %s, last %s", c.Author, c.Lines, c.Commits, commits, c.LastChanged.Format(time.DateOnly))
+}
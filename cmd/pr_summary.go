@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/github"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Hidden marker identifying codie's comment, so reruns edit it instead of adding another
+const prCommentMarker = "<!-- codie-pr-summary -->"
+
+// PRSummary summarizes a pull request's diff and posts it as a comment, or
+// prints the comment body with --dry-run. In GitHub Actions the repository,
+// pull request number, and refs default to those of the triggering event.
+func PRSummary(args []string) {
+	start := time.Now()
+	diffRange := DiffRange{RepoDir: "."}
+	base, head := "", ""
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	number := 0
+	dryRun := false
+
+	if event := github.LoadPullRequestEvent(); event != nil {
+		base = event.PullRequest.Base.SHA
+		head = event.PullRequest.Head.SHA
+		number = event.PullRequest.Number
+	}
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--base=") {
+			base = strings.TrimPrefix(arg, "--base=")
+		} else if strings.HasPrefix(arg, "--head=") {
+			head = strings.TrimPrefix(arg, "--head=")
+		} else if strings.HasPrefix(arg, "--repo=") {
+			diffRange.RepoDir = strings.TrimPrefix(arg, "--repo=")
+		} else if strings.HasPrefix(arg, "--github-repo=") {
+			repo = strings.TrimPrefix(arg, "--github-repo=")
+		} else if strings.HasPrefix(arg, "--pr=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--pr="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --pr value %q: must be a pull request number", arg)
+			}
+			number = n
+		} else if arg == "--dry-run" {
+			dryRun = true
+		}
+	}
+
+	if base == "" {
+		log.Fatal("Usage: go run main.go pr-summary --base=<ref> [--head=<ref>] [options]")
+	}
+	if head == "" {
+		head = "HEAD"
+	}
+
+	// Like a pull request, compare head with the point it branched from base
+	mergeBase, err := gitdiff.MergeBase(diffRange.RepoDir, base, head)
+	if err != nil {
+		log.Fatalf("Failed to find merge base of %s and %s (is the clone shallow?): %v", base, head, err)
+	}
+	diffRange.From, diffRange.To = mergeBase, head
+
+	// Check posting settings before spending API credits
+	token := os.Getenv("GITHUB_TOKEN")
+	if !dryRun {
+		if token == "" {
+			log.Fatal("GITHUB_TOKEN is not set; set it or use --dry-run to print the comment")
+		}
+		if repo == "" || number == 0 {
+			log.Fatal("Pull request unknown; pass --github-repo=<owner/name> and --pr=<number>, or use --dry-run")
+		}
+	}
+
+	slog.Info("Summarizing changes", "from", base, "to", head)
+	input := loadDiffSummaryInput(diffRange, args)
+	input.From, input.To = base, head
+
+	summary, err := summarization.GenerateDiffSummary(commandCtx, input, parseSummaryOptions(args))
+	if err != nil {
+		log.Fatalf("Failed to generate summary: %v", err)
+	}
+
+	body := buildPRComment(summary, len(input.Changes))
+	title := fmt.Sprintf("Changes %s..%s", base, head)
+	if repo != "" && number != 0 {
+		title = fmt.Sprintf("Pull request %s#%d", repo, number)
+	}
+	if dryRun {
+		if settings.JSONOutput {
+			printJSON(map[string]string{"body": body})
+		} else {
+			fmt.Println(body)
+		}
+		notifyWebhook(title, summary)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(commandCtx, time.Minute)
+	defer cancel()
+
+	url, err := github.NewClient(token).UpsertComment(ctx, repo, number, prCommentMarker, body)
+	if err != nil {
+		log.Fatalf("Failed to comment on %s#%d: %v", repo, number, err)
+	}
+	slog.Info("Posted summary", "url", url, "duration", time.Since(start))
+	notifyWebhook(title, summary+"\n\n"+url)
+	if settings.JSONOutput {
+		printJSON(map[string]string{"url": url, "body": body})
+	}
+}
+
+// buildPRComment wraps a summary in the markdown body of a pull request comment
+func buildPRComment(summary string, files int) string {
+	var sb strings.Builder
+	sb.WriteString(prCommentMarker + "\n")
+	sb.WriteString("## Codie summary\n\n")
+	sb.WriteString(strings.TrimSpace(summary) + "\n\n")
+	sb.WriteString(fmt.Sprintf("<sub>Generated by codie from %d changed files. Edits to this comment are overwritten on the next run.</sub>\n", files))
+	return sb.String()
+}
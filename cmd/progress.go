@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/exolottl/codie/internal/logging"
+	"github.com/exolottl/codie/internal/progress"
+)
+
+// How often progress is redrawn on a terminal, or logged otherwise
+const (
+	progressRedrawInterval = 200 * time.Millisecond
+	progressLogInterval    = 10 * time.Second
+)
+
+// withProgress returns ctx with a new tracker of the indexing stages it is
+// passed to: shown by processFiles, and summed up by logStageTimings
+func withProgress(ctx context.Context) context.Context {
+	return progress.WithReporter(ctx, progress.NewTracker())
+}
+
+// startProgressDisplay draws the progress of tracker on stderr when it is a
+// terminal showing text logs, or logs it at intervals otherwise
+func startProgressDisplay(tracker *progress.Tracker) *progress.Display {
+	if logging.ProgressEnabled() && isTerminal(os.Stderr) {
+		return progress.StartTerminal(os.Stderr, tracker, progressRedrawInterval)
+	}
+	return progress.StartLog(tracker, progressLogInterval)
+}
+
+// logStageTimings logs how long each indexing stage tracked in ctx took
+func logStageTimings(ctx context.Context) {
+	if tracker := progress.TrackerFrom(ctx); tracker != nil {
+		progress.LogTimings(tracker)
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// PruneReport lists the files whose chunks prune removed, or would remove
+type PruneReport struct {
+	MissingFiles  []string `json:"missing_files"` // No longer on disk
+	IgnoredFiles  []string `json:"ignored_files"` // Now skipped by ignore rules
+	RemovedChunks int      `json:"removed_chunks"`
+	DryRun        bool     `json:"dry_run"`
+}
+
+// Prune removes chunks of files that no longer exist or now match the ignore
+// rules. Ignore patterns are matched relative to the directory argument,
+// which defaults to the deepest directory containing every indexed file.
+func Prune(args []string) {
+	var dir string
+	dryRun := false
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			dryRun = true
+		} else if !strings.HasPrefix(arg, "--") && dir == "" {
+			dir = arg
+		}
+	}
+
+	store := openStoreAnyModel()
+	chunks, err := store.Load()
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	if dir == "" {
+		dir = storage.RootDir(chunks)
+	}
+
+	report := PruneReport{MissingFiles: []string{}, IgnoredFiles: []string{}, DryRun: dryRun}
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		if seen[chunk.File] {
+			continue
+		}
+		seen[chunk.File] = true
+
+		if _, err := os.Stat(chunk.File); err != nil {
+			report.MissingFiles = append(report.MissingFiles, chunk.File)
+		} else if isIgnoredIndexFile(dir, chunk.File) {
+			report.IgnoredFiles = append(report.IgnoredFiles, chunk.File)
+		}
+	}
+	sort.Strings(report.MissingFiles)
+	sort.Strings(report.IgnoredFiles)
+
+	stale := append(append([]string{}, report.MissingFiles...), report.IgnoredFiles...)
+	if dryRun {
+		_, report.RemovedChunks = storage.FilterByFile(chunks, stale...)
+	} else if len(stale) > 0 {
+		report.RemovedChunks, err = store.DeleteByFile(stale...)
+		if err != nil {
+			log.Fatalf("Failed to prune index: %v", err)
+		}
+	}
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+
+	printFileList(fmt.Sprintf("Missing on disk (%d):", len(report.MissingFiles)), report.MissingFiles)
+	printFileList(fmt.Sprintf("Matching ignore rules (%d):", len(report.IgnoredFiles)), report.IgnoredFiles)
+	switch {
+	case len(stale) == 0:
+		fmt.Println("Nothing to prune; every indexed file exists and is still indexed.")
+	case dryRun:
+		fmt.Printf("Would remove %d chunks of %d files (dry run)\n", report.RemovedChunks, len(stale))
+	default:
+		fmt.Printf("Removed %d chunks of %d files\n", report.RemovedChunks, len(stale))
+	}
+}
+
+// isIgnoredIndexFile reports whether an indexed file under dir would now be
+// skipped when indexing dir. Files outside dir are kept.
+func isIgnoredIndexFile(dir, file string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return !fileutils.IsCodeFile(absDir, rel)
+}
+
+// Remove drops the chunks of files, or of every file under directories, from the index
+func Remove(args []string) {
+	var paths []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		log.Fatal("Usage: go run main.go remove <path>... [options]")
+	}
+
+	report := struct {
+		Paths         []string `json:"paths"`
+		RemovedChunks int      `json:"removed_chunks"`
+	}{Paths: paths}
+
+	var err error
+	report.RemovedChunks, err = openStoreAnyModel().DeleteByFile(paths...)
+	if err != nil {
+		log.Fatalf("Failed to remove from index %s: %v", settings.IndexFile, err)
+	}
+
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	if report.RemovedChunks == 0 {
+		fmt.Printf("No indexed chunks found for %s\n", strings.Join(paths, ", "))
+		return
+	}
+	fmt.Printf("Removed %d chunks\n", report.RemovedChunks)
+}
+
+// openStore opens the configured index store
+func openStore() storage.Store {
+	store, err := storage.Open(settings.Store, settings.IndexFile, storage.Options{
+		VectorPrecision: settings.VectorPrecision,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open index: %v", err)
+	}
+	return store
+}
+
+// openStoreAnyModel opens the configured index store for a command that
+// never embeds. Its writes are described by the index's embedding model
+// rather than the configured one, so an index embedded with another model
+// loads, and keeps its model when rewritten.
+func openStoreAnyModel() storage.Store {
+	store := openStore()
+	if header, err := store.Header(); err == nil && header.EmbeddingModel != "" {
+		storage.Current.EmbeddingModel = header.EmbeddingModel
+	}
+	return store
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// QuickLook prints a fast, budget-capped orientation for an unfamiliar repository
+func QuickLook(dir string, args []string) {
+	start := time.Now()
+	options := summarization.DefaultQuickLookOptions()
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--time-budget=") {
+			budget, err := time.ParseDuration(strings.TrimPrefix(arg, "--time-budget="))
+			if err != nil || budget <= 0 {
+				log.Fatalf("Invalid --time-budget value %q: must be a positive duration such as 60s", arg)
+			}
+			options.TimeBudget = budget
+		} else if strings.HasPrefix(arg, "--max-cost=") {
+			budget, err := strconv.ParseFloat(strings.TrimPrefix(arg, "--max-cost="), 64)
+			if err != nil || budget <= 0 {
+				log.Fatalf("Invalid --max-cost value %q: must be a positive amount in USD", arg)
+			}
+			options.CostBudget = budget
+		}
+	}
+
+	slog.Info("Taking a quick look", "time_budget", options.TimeBudget, "cost_budget", options.CostBudget)
+	result, err := summarization.GenerateQuickLook(commandCtx, dir, options)
+	if err != nil {
+		log.Fatalf("Quick look failed: %v", err)
+	}
+
+	if settings.JSONOutput {
+		printJSON(struct {
+			Summary       string                         `json:"summary"`
+			Sections      []summarization.SummarySection `json:"sections"`
+			SampledFiles  []string                       `json:"sampled_files"`
+			EstimatedCost float64                        `json:"estimated_cost_usd"`
+			DurationMS    int64                          `json:"duration_ms"`
+		}{result.Summary, summarization.SplitSections(result.Summary), result.SampledFiles, result.EstimatedCost, time.Since(start).Milliseconds()})
+		return
+	}
+
+	output, _ := glamour.Render(result.Summary, "dark")
+	fmt.Println(output)
+	slog.Info("Quick look complete", "sampled_files", len(result.SampledFiles),
+		"estimated_cost_usd", result.EstimatedCost, "duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/exolottl/codie/internal/graph"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// RankedFile is a file with its PageRank over the import and call graph
+type RankedFile struct {
+	File     string  `json:"file"`
+	Score    float64 `json:"score"`            // PageRank, plus the recency boost for recent files; unboosted scores sum to 1
+	InDegree int     `json:"in_degree"`        // Files importing or calling into it
+	Recent   bool    `json:"recent,omitempty"` // Changed in the last recent_commits commits
+}
+
+// Rank prints the most central files of the index by their PageRank over
+// the import and call graph, boosting recently changed files when
+// recent_commits is set
+func Rank(args []string) {
+	top := 20
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			top = n
+		}
+	}
+
+	chunks, err := storage.LoadAnyModel(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index so the ranking reflects current imports and calls
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadAnyModel(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+
+	dependencies, err := graph.Open(settings.IndexFile, chunks)
+	if err != nil {
+		slog.Warn("Failed to save the dependency graph", "path", graph.Path(settings.IndexFile), "error", err)
+	}
+	pageRank := dependencies.PageRank()
+	inDegree := dependencies.InDegree()
+
+	root := storage.RootDir(chunks)
+	recent := recentFiles(chunks)
+	ranked := make([]RankedFile, 0, len(dependencies.Files))
+	for _, file := range dependencies.Files {
+		rel := file
+		if r, err := filepath.Rel(root, file); err == nil {
+			rel = filepath.ToSlash(r)
+		}
+		entry := RankedFile{rel, pageRank[file], inDegree[file], summarization.IsRecent(recent, file)}
+		if entry.Recent {
+			entry.Score += settings.RecencyBoost
+		}
+		ranked = append(ranked, entry)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+
+	if settings.JSONOutput {
+		printJSON(ranked)
+		return
+	}
+
+	if len(ranked) == 0 {
+		fmt.Println("No files in the index")
+		return
+	}
+	fmt.Printf("%-4s  %-8s  %-9s  %s\n", "RANK", "SCORE", "IMPORTERS", "FILE")
+	for i, file := range ranked {
+		marker := ""
+		if file.Recent {
+			marker = "  (recent)"
+		}
+		fmt.Printf("%-4d  %-8.4f  %-9d  %s%s\n", i+1, file.Score, file.InDegree, file.File, marker)
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"sort"
+
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Candidates searched per result shown when recently changed files are
+// boosted, so boosted chunks from just below the top can move up
+const recencyCandidatesPerResult = 3
+
+// recentFiles returns the absolute paths of the files changed in the last
+// recent_commits commits of the indexed repository, or of each workspace
+// repository, or nil when recency boosting is off
+func recentFiles(chunks []storage.CodeChunk) map[string]bool {
+	dirs := []string{storage.RootDir(chunks)}
+	if workspace, err := storage.LoadWorkspace(settings.IndexFile); err == nil && len(workspace.Repos) > 0 {
+		dirs = dirs[:0]
+		for _, repo := range workspace.Repos {
+			dirs = append(dirs, repo.Dir)
+		}
+	}
+	return summarization.RecentFiles(dirs...)
+}
+
+// boostRecentResults adds the recency boost to the scores of results from
+// recently changed files and returns the best k in the new order. The bump
+// is added rather than multiplied, so it raises negative scores too. The
+// results are collected before any is sent.
+func boostRecentResults(results <-chan search.Result, recent map[string]bool, k int) <-chan search.Result {
+	var boosted []search.Result
+	for result := range results {
+		if summarization.IsRecent(recent, result.Chunk.File) {
+			result.Score += float32(settings.RecencyBoost)
+		}
+		boosted = append(boosted, result)
+	}
+	sort.SliceStable(boosted, func(i, j int) bool {
+		return boosted[i].Score > boosted[j].Score
+	})
+	if len(boosted) > k {
+		boosted = boosted[:k]
+	}
+	return resultChannel(boosted)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+)
+
+// Prefixes of repository URLs accepted in place of a directory
+var repoURLPrefixes = []string{"https://", "http://", "ssh://", "git://", "git@"}
+
+// remoteRepo is a repository URL checked out locally to be indexed
+type remoteRepo struct {
+	URL    string // Repository URL without the ref
+	Ref    string // Branch, tag, or commit after '#', if any
+	Dir    string // Local clone
+	Commit string // Commit checked out in Dir
+}
+
+// indexOptions returns options that index the clone's tracked files and
+// record the URL it came from
+func (r remoteRepo) indexOptions(options IndexOptions) IndexOptions {
+	options.Git = true
+	options.Source, options.Ref = r.URL, r.Ref
+	return options
+}
+
+// isRepoURL reports whether an argument names a repository URL rather than
+// a directory
+func isRepoURL(arg string) bool {
+	for _, prefix := range repoURLPrefixes {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneRepo shallow-clones a repository given as <url>[#ref] into the cache
+// directory, reusing an earlier clone of the same URL
+func cloneRepo(source string) (remoteRepo, error) {
+	url, ref, _ := strings.Cut(source, "#")
+	repo := remoteRepo{URL: url, Ref: ref}
+	// git would parse such a ref as an option, such as --upload-pack=<command>
+	if strings.HasPrefix(ref, "-") {
+		return repo, fmt.Errorf("invalid ref %q in %s: refs can't start with '-'", ref, source)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return repo, fmt.Errorf("failed to find a cache directory: %w", err)
+	}
+	repo.Dir = filepath.Join(cacheDir, "codie", "repos", repoCacheName(url))
+
+	slog.Info("Fetching repository", "url", url, "ref", ref, "dir", repo.Dir)
+	if repo.Commit, err = gitdiff.ShallowClone(url, ref, repo.Dir); err != nil {
+		return repo, fmt.Errorf("failed to clone %s: %w", source, err)
+	}
+	return repo, nil
+}
+
+// repoCacheName returns the path of a repository's clone under the cache
+// directory: its host and path, as in github.com/org/repo
+func repoCacheName(url string) string {
+	name := url
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimPrefix(name, "git@")
+	// Drop credentials, and make the colon of a port or an scp-like URL a
+	// separator
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Replace(name, ":", "/", 1)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "/"), ".git")
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return filepath.Join(parts...)
+}
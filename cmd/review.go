@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Review reviews a diff file, the staged changes, or the changes on HEAD
+// since it left a ref, and prints review comments anchored to files and
+// lines as markdown or JSON. With --fail-on it exits with an error when a
+// comment is at least that severe, for CI.
+func Review(args []string) {
+	start := time.Now()
+	diffRange := DiffRange{RepoDir: "."}
+	ref := ""
+	failOn := ""
+
+	for _, arg := range args {
+		if arg == "--staged" {
+			diffRange.Staged = true
+		} else if strings.HasPrefix(arg, "--ref=") {
+			ref = strings.TrimPrefix(arg, "--ref=")
+		} else if strings.HasPrefix(arg, "--repo=") {
+			diffRange.RepoDir = strings.TrimPrefix(arg, "--repo=")
+		} else if strings.HasPrefix(arg, "--fail-on=") {
+			failOn = strings.TrimPrefix(arg, "--fail-on=")
+			if summarization.ReviewSeverityRank(failOn) < 0 {
+				log.Fatalf("Invalid --fail-on value %q: must be one of %s", failOn, strings.Join(summarization.ReviewSeverities, ", "))
+			}
+		} else if !strings.HasPrefix(arg, "--") && diffRange.PatchFile == "" {
+			diffRange.PatchFile = arg
+		}
+	}
+
+	sources := 0
+	for _, set := range []bool{diffRange.Staged, ref != "", diffRange.PatchFile != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		log.Fatal("Usage: go run main.go review <diff-file> | --staged | --ref=<ref> [options]")
+	}
+
+	title := "Review of " + diffRange.PatchFile
+	switch {
+	case diffRange.Staged:
+		title = "Review of staged changes"
+	case ref != "":
+		// Like a pull request, compare HEAD with the point it branched from ref
+		base, err := gitdiff.MergeBase(diffRange.RepoDir, ref, "HEAD")
+		if err != nil {
+			log.Fatalf("Failed to find merge base with %s: %v", ref, err)
+		}
+		diffRange.From, diffRange.To = base, "HEAD"
+		title = "Review of changes since " + ref
+	}
+
+	input := loadDiffSummaryInput(diffRange, args)
+	if len(input.Changes) == 0 {
+		log.Fatal("No changes to review")
+	}
+	slog.Info("Reviewing changes", "files", len(input.Changes), "chunks", len(input.ChangedChunks))
+
+	review, err := summarization.GenerateReview(commandCtx, input, parseSummaryOptions(args))
+	if err != nil {
+		log.Fatalf("Failed to review changes: %v", err)
+	}
+
+	output := parseSummaryOutput(args)
+	if settings.JSONOutput && output.Path == "" {
+		printJSON(review)
+	} else {
+		writeSummary(title, buildReviewReport(review), output)
+	}
+	slog.Info("Review complete", "comments", len(review.Comments), "duration", time.Since(start))
+
+	if failOn != "" {
+		if failing := review.CountAtLeast(failOn); failing > 0 {
+			log.Fatalf("Review found %d comments of severity %s or worse", failing, failOn)
+		}
+	}
+}
+
+// buildReviewReport renders a review as markdown, with a section per file
+func buildReviewReport(review summarization.Review) string {
+	var sb strings.Builder
+	sb.WriteString("# Code Review\n\n")
+	sb.WriteString(strings.TrimSpace(review.Summary) + "\n")
+	if len(review.Comments) == 0 {
+		sb.WriteString("\nNo issues found.\n")
+		return sb.String()
+	}
+
+	counts := make(map[string]int)
+	for _, comment := range review.Comments {
+		counts[comment.Severity]++
+	}
+	var totals []string
+	for _, severity := range summarization.ReviewSeverities {
+		if counts[severity] > 0 {
+			totals = append(totals, fmt.Sprintf("%d %s", counts[severity], severity))
+		}
+	}
+	sb.WriteString(fmt.Sprintf("\n%d comments: %s\n", len(review.Comments), strings.Join(totals, ", ")))
+
+	file := ""
+	for _, comment := range review.Comments {
+		if comment.File != file {
+			file = comment.File
+			sb.WriteString(fmt.Sprintf("\n## %s\n\n", file))
+		}
+		lines := fmt.Sprintf("line %d", comment.Line)
+		if comment.EndLine > comment.Line {
+			lines = fmt.Sprintf("lines %d-%d", comment.Line, comment.EndLine)
+		}
+		sb.WriteString(fmt.Sprintf("- **%s** %s (%s): %s\n", comment.Severity, lines, comment.Category, strings.TrimSpace(comment.Message)))
+		if comment.Suggestion != "" {
+			sb.WriteString("\n  ```\n")
+			for _, line := range strings.Split(strings.TrimRight(comment.Suggestion, "\n"), "\n") {
+				sb.WriteString("  " + line + "\n")
+			}
+			sb.WriteString("  ```\n\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,401 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Default number of search results to show
+const DefaultSearchResults = 10
+
+// Results taken from each of vector and keyword search for hybrid search,
+// per result shown
+const hybridCandidatesPerResult = 5
+
+// SearchCodebase finds the indexed chunks most relevant to a natural-language query
+func SearchCodebase(query string, args []string) {
+	topK := DefaultSearchResults
+	exact := false
+	hybrid := false
+	keywordWeight := 0.0
+	rerank := false
+	groupBy := "file"
+	open := 0 // Rank of the hit to open in the editor, if any
+
+	for _, arg := range args {
+		if arg == "--exact" {
+			exact = true
+		} else if arg == "--open" {
+			open = 1
+		} else if strings.HasPrefix(arg, "--open=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--open="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --open value %q: must be the rank of a result", arg)
+			}
+			open = n
+		} else if strings.HasPrefix(arg, "--group-by=") {
+			groupBy = strings.TrimPrefix(arg, "--group-by=")
+			if groupBy != "file" && groupBy != "symbol" && groupBy != "none" {
+				log.Fatalf("Invalid --group-by value %q: must be file, symbol, or none", groupBy)
+			}
+		} else if arg == "--rerank" {
+			rerank = true
+		} else if arg == "--hybrid" {
+			hybrid = true
+		} else if strings.HasPrefix(arg, "--keyword-weight=") {
+			w, err := strconv.ParseFloat(strings.TrimPrefix(arg, "--keyword-weight="), 64)
+			if err != nil || w <= 0 || w > 1 {
+				log.Fatalf("Invalid --keyword-weight value %q: must be a number above 0 and at most 1", arg)
+			}
+			hybrid, keywordWeight = true, w
+		} else if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			topK = n
+		}
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index before querying it
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadFromJSON(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+	chunks = withSummaries(chunks)
+
+	// Filtered searches score every matching chunk, as the HNSW graph covers
+	// the whole index
+	if filter := parseSearchFilter(args); filter.active() {
+		chunks = filter.apply(chunks)
+		exact = true
+		slog.Debug("Filtered index", "chunks", len(chunks))
+	}
+
+	// Large indexes are searched through the HNSW graph unless --exact is set
+	var ann *search.ANN
+	if !exact {
+		ann = openANN(chunks)
+	}
+
+	queryEmbedding, err := embeddings.GetQueryEmbeddingContext(commandCtx, query)
+	if err != nil {
+		log.Fatalf("Failed to embed query: %v", err)
+	}
+
+	// Reranking picks the results from a longer list of candidates
+	candidates := topK
+	if rerank {
+		candidates = max(summarization.RerankCandidates, topK)
+	}
+
+	// Boosting recently changed files picks the candidates from a longer
+	// list again
+	recent := recentFiles(chunks)
+	searched := candidates
+	if recent != nil {
+		searched = candidates * recencyCandidatesPerResult
+	}
+
+	var results <-chan search.Result
+	if hybrid {
+		results = hybridSearch(ann, chunks, query, queryEmbedding, searched, keywordWeight)
+	} else {
+		results = streamSearch(commandCtx, ann, chunks, queryEmbedding, searched)
+	}
+	if recent != nil {
+		results = boostRecentResults(results, recent, candidates)
+	}
+	if rerank {
+		results = rerankResults(query, results, topK)
+	}
+
+	var opened *search.Result
+	if settings.JSONOutput {
+		hits := []SearchHit{}
+		var all []search.Result
+		for result := range results {
+			hits = append(hits, newSearchHit(len(hits)+1, result))
+			all = append(all, result)
+		}
+		var groups []SearchGroup
+		if groupBy != "none" {
+			grouped := groupResults(resultChannel(all), groupBy)
+			for _, group := range grouped {
+				groups = append(groups, newSearchGroup(group, groupBy))
+			}
+			if open > 0 && open <= len(grouped) {
+				opened = &grouped[open-1].hits[0]
+			}
+		} else if open > 0 && open <= len(all) {
+			opened = &all[open-1]
+		}
+		printJSON(struct {
+			Query   string        `json:"query"`
+			Results []SearchHit   `json:"results"`
+			Groups  []SearchGroup `json:"groups,omitempty"`
+		}{query, hits, groups})
+	} else if groupBy != "none" {
+		// Hits are grouped once all have arrived, as a later hit can join
+		// an earlier group
+		groups := groupResults(results, groupBy)
+		for i, group := range groups {
+			printSearchResult(i+1, group.hits[0])
+			for _, hit := range group.hits[1:] {
+				printSecondaryHit(hit)
+			}
+			if i+1 == open {
+				opened = &group.hits[0]
+			}
+		}
+
+		if len(groups) == 0 {
+			fmt.Println("No results found.")
+		}
+	} else {
+		// Print hits as they arrive rather than waiting for the full result set
+		rank := 0
+		for result := range results {
+			rank++
+			printSearchResult(rank, result)
+			if rank == open {
+				opened = &result
+			}
+		}
+
+		if rank == 0 {
+			fmt.Println("No results found.")
+		}
+	}
+
+	if open > 0 {
+		if opened == nil {
+			log.Fatalf("There is no result %d to open", open)
+		}
+		if err := openInEditor(opened.Chunk.File, opened.Chunk.StartLine); err != nil {
+			log.Fatalf("Failed to open %s in the editor: %v", opened.Chunk.File, err)
+		}
+	}
+}
+
+// withSummaries adds the embedded directory and file summaries of the index
+// to its chunks, so conceptual queries can match a description of the code
+// rather than the code itself
+func withSummaries(chunks []storage.CodeChunk) []storage.CodeChunk {
+	return append(chunks, summarization.SummaryChunks(settings.IndexFile)...)
+}
+
+// hybridSearch ranks chunks by both embedding similarity and BM25 keyword
+// score, sending the k best on a closed channel. A keyword weight of zero
+// fuses the two rankings by reciprocal rank.
+func hybridSearch(ann *search.ANN, chunks []storage.CodeChunk, query string, queryEmbedding []float32, k int, keywordWeight float64) <-chan search.Result {
+	candidates := k * hybridCandidatesPerResult
+
+	var vector []search.Result
+	for result := range streamSearch(commandCtx, ann, chunks, queryEmbedding, candidates) {
+		vector = append(vector, result)
+	}
+	keyword := search.NewKeywordIndex(chunks).Search(query, candidates)
+
+	return resultChannel(search.Fuse(vector, keyword, k, keywordWeight))
+}
+
+// rerankResults reranks search results with the rerank model, sending the k
+// most relevant on a closed channel. If reranking fails, the first k results
+// are kept in their original order.
+func rerankResults(query string, results <-chan search.Result, k int) <-chan search.Result {
+	var candidates []search.Result
+	for result := range results {
+		candidates = append(candidates, result)
+	}
+
+	reranked, err := summarization.Rerank(commandCtx, query, candidates, k)
+	if err != nil {
+		slog.Warn("Showing results without reranking", "error", err)
+		reranked = candidates[:min(k, len(candidates))]
+	}
+	return resultChannel(reranked)
+}
+
+// resultChannel sends results on a closed, buffered channel
+func resultChannel(results []search.Result) <-chan search.Result {
+	out := make(chan search.Result, len(results))
+	for _, result := range results {
+		out <- result
+	}
+	close(out)
+	return out
+}
+
+// SearchHit is a ranked search result as printed with --json
+type SearchHit struct {
+	Rank      int     `json:"rank"`
+	Score     float32 `json:"score"`
+	Repo      string  `json:"repo,omitempty"`
+	File      string  `json:"file"`
+	StartLine int     `json:"start_line,omitempty"`
+	EndLine   int     `json:"end_line,omitempty"`
+	Package   string  `json:"package,omitempty"`
+	Class     string  `json:"class,omitempty"`
+	Function  string  `json:"function,omitempty"`
+	Kind      string  `json:"kind,omitempty"` // "summary" for a summary of a file or directory
+	Content   string  `json:"content"`
+
+	// Last commit to change the chunk's lines, when indexed with --git
+	LastCommit  string    `json:"last_commit,omitempty"`
+	LastAuthor  string    `json:"last_author,omitempty"`
+	LastChanged time.Time `json:"last_changed,omitzero"`
+}
+
+// SearchGroup gathers the hits of one file, or of one symbol in it, as
+// printed with --json unless --group-by=none
+type SearchGroup struct {
+	Repo   string  `json:"repo,omitempty"`
+	File   string  `json:"file"`
+	Symbol string  `json:"symbol,omitempty"` // Set with --group-by=symbol
+	Score  float32 `json:"score"`            // Best score of its hits
+	Ranks  []int   `json:"ranks"`            // Ranks of its hits among the results, best first
+}
+
+// searchGroup is a group of hits, best first, with their ranks among all
+// the hits
+type searchGroup struct {
+	hits  []search.Result
+	ranks []int
+}
+
+// groupResults groups hits by file or by symbol, keeping the groups in the
+// order of their best hit
+func groupResults(results <-chan search.Result, groupBy string) []searchGroup {
+	var groups []searchGroup
+	index := make(map[string]int)
+	rank := 0
+	for result := range results {
+		rank++
+		chunk := result.Chunk
+		key := chunk.Repo + "\x00" + chunk.File
+		if groupBy == "symbol" {
+			key += "\x00" + chunkSymbol(chunk)
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, searchGroup{})
+		}
+		groups[i].hits = append(groups[i].hits, result)
+		groups[i].ranks = append(groups[i].ranks, rank)
+	}
+	return groups
+}
+
+// newSearchGroup describes a group of hits by its best one
+func newSearchGroup(group searchGroup, groupBy string) SearchGroup {
+	best := group.hits[0]
+	converted := SearchGroup{Repo: best.Chunk.Repo, File: best.Chunk.File, Score: best.Score, Ranks: group.ranks}
+	if groupBy == "symbol" {
+		converted.Symbol = chunkSymbol(best.Chunk)
+	}
+	return converted
+}
+
+// newSearchHit converts a search result, leaving out its embedding
+func newSearchHit(rank int, result search.Result) SearchHit {
+	chunk := result.Chunk
+	return SearchHit{
+		Rank:      rank,
+		Score:     result.Score,
+		Repo:      chunk.Repo,
+		File:      chunk.File,
+		StartLine: chunk.StartLine,
+		EndLine:   chunk.EndLine,
+		Package:   chunk.Package,
+		Class:     chunk.Class,
+		Function:  chunk.Function,
+		Kind:      chunk.Kind,
+		Content:   chunk.Content,
+
+		LastCommit:  chunk.LastCommit,
+		LastAuthor:  chunk.LastAuthor,
+		LastChanged: chunk.LastChanged,
+	}
+}
+
+// printSearchResult prints a single ranked hit with a short preview
+func printSearchResult(rank int, result search.Result) {
+	chunk := result.Chunk
+	symbol := chunkSymbol(chunk)
+
+	fmt.Printf("%d. %s (score %.3f)", rank, chunkLocation(chunk), result.Score)
+	if symbol != "" {
+		fmt.Printf(" %s", symbol)
+	}
+	fmt.Println()
+	if provenance := chunk.Provenance(); provenance != "" {
+		fmt.Println("    (" + provenance + ")")
+	}
+
+	// Show the first few lines of the chunk
+	lines := strings.Split(chunk.Content, "\n")
+	for i, line := range lines {
+		if i == 3 {
+			fmt.Println("    ...")
+			break
+		}
+		fmt.Println("    " + line)
+	}
+}
+
+// printSecondaryHit prints a further hit of a group, indented under the
+// group's best hit and without a preview
+func printSecondaryHit(result search.Result) {
+	fmt.Printf("    + %s (score %.3f)", chunkLocation(result.Chunk), result.Score)
+	if symbol := chunkSymbol(result.Chunk); symbol != "" {
+		fmt.Printf(" %s", symbol)
+	}
+	fmt.Println()
+}
+
+// chunkLocation returns the file and line range of a chunk, led by its
+// workspace repository
+func chunkLocation(chunk storage.CodeChunk) string {
+	location := chunk.File
+	if chunk.StartLine > 0 {
+		location = fmt.Sprintf("%s:%d-%d", chunk.File, chunk.StartLine, chunk.EndLine)
+	}
+	if chunk.Repo != "" {
+		location = fmt.Sprintf("[%s] %s", chunk.Repo, location)
+	}
+	return location
+}
+
+// chunkSymbol names the function, method, or class of a chunk, or marks a
+// summary
+func chunkSymbol(chunk storage.CodeChunk) string {
+	if chunk.Kind == storage.SummaryKind {
+		return "(summary)"
+	}
+	symbol := chunk.Function
+	if chunk.Class != "" && symbol != "" {
+		symbol = chunk.Class + "." + symbol
+	} else if symbol == "" {
+		symbol = chunk.Class
+	}
+	return symbol
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/metrics"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+	codiev1 "github.com/exolottl/codie/proto/codie/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Default port of the gRPC server
+const DefaultGRPCPort = 50051
+
+// Default address the gRPC server listens on. The API has no authentication
+// and Index reads any directory the server can, so only local clients can
+// reach it unless another address is given.
+const DefaultGRPCAddr = "127.0.0.1"
+
+// Serve runs the gRPC API, and optionally a Prometheus /metrics endpoint,
+// until interrupted
+func Serve(args []string) {
+	addr := DefaultGRPCAddr
+	port := DefaultGRPCPort
+	metricsPort := 0
+	// --min-score and --max-context-tokens apply to every Ask call
+	parsed := parseAskOptions(args)
+	askOptions := summarization.AskOptions{MinScore: parsed.MinScore, MaxContextTokens: parsed.MaxContextTokens}
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--grpc-addr=") {
+			addr = strings.TrimPrefix(arg, "--grpc-addr=")
+		} else if strings.HasPrefix(arg, "--grpc-port=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--grpc-port="))
+			if err != nil || n <= 0 || n > 65535 {
+				log.Fatalf("Invalid --grpc-port value %q: must be a port number", arg)
+			}
+			port = n
+		} else if strings.HasPrefix(arg, "--metrics-port=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--metrics-port="))
+			if err != nil || n <= 0 || n > 65535 {
+				log.Fatalf("Invalid --metrics-port value %q: must be a port number", arg)
+			}
+			metricsPort = n
+		}
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		log.Fatalf("Failed to listen on %s port %d: %v", addr, port, err)
+	}
+	if ip := net.ParseIP(addr); addr != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		slog.Warn("Serving gRPC beyond this machine; the API has no authentication, and any client can index directories the server can read and send their code to the embedding provider",
+			"addr", addr)
+	}
+
+	service := &grpcServer{askOptions: askOptions}
+	// Open the search graph up front so the first search isn't slow
+	if chunks, err := storage.LoadFromJSON(settings.IndexFile); err == nil {
+		service.ann.get(chunks)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(observeRPC), grpc.StreamInterceptor(observeStream))
+	codiev1.RegisterCodieServer(server, service)
+	// Reflection lets tools such as grpcurl discover the service
+	reflection.Register(server)
+
+	var metricsServer *http.Server
+	if metricsPort > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: net.JoinHostPort(addr, strconv.Itoa(metricsPort)), Handler: mux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Metrics server failed: %v", err)
+			}
+		}()
+		slog.Info("Serving metrics", "addr", metricsServer.Addr, "path", "/metrics")
+	}
+
+	// Finish in-flight requests on Ctrl-C or SIGTERM
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		slog.Info("Shutting down")
+		server.GracefulStop()
+		if metricsServer != nil {
+			metricsServer.Close()
+		}
+	}()
+
+	slog.Info("Serving gRPC", "addr", listener.Addr().String(), "index", settings.IndexFile)
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("gRPC server failed: %v", err)
+	}
+}
+
+// observeRPC records the duration and status code of each gRPC call
+func observeRPC(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	metrics.RPCDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// observeStream records the duration and status code of each streaming call
+func observeStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	metrics.RPCDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// grpcServer implements the Codie gRPC service on top of the index file
+type grpcServer struct {
+	codiev1.UnimplementedCodieServer
+
+	// Held for writing while Index replaces the index file
+	indexMutex sync.RWMutex
+
+	// Search graph of a large index, kept between Search calls
+	ann annCache
+
+	// Options of Ask calls beyond those a request sets
+	askOptions summarization.AskOptions
+}
+
+// loadIndex reads the index for a request that only reads it
+func (s *grpcServer) loadIndex() ([]storage.CodeChunk, error) {
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to load index %s (call Index first): %v", settings.IndexFile, err)
+	}
+	return chunks, nil
+}
+
+// Index chunks and embeds a directory, replacing the index
+func (s *grpcServer) Index(ctx context.Context, req *codiev1.IndexRequest) (*codiev1.IndexResponse, error) {
+	if req.GetDirectory() == "" {
+		return nil, status.Error(codes.InvalidArgument, "directory is required")
+	}
+
+	options := IndexOptions{ChunkOverlap: settings.ChunkOverlap, Root: req.GetDirectory()}
+	if req.GetChunkOverlap() > 0 {
+		options.ChunkOverlap = int(req.GetChunkOverlap())
+	}
+
+	ctx = withProgress(ctx)
+	files, err := discoverFiles(ctx, req.GetDirectory(), false)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to scan directory: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no code files found in the directory")
+	}
+
+	s.indexMutex.Lock()
+	defer s.indexMutex.Unlock()
+
+	writer, err := openStore().NewWriter()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to start writing the index: %v", err)
+	}
+	defer writer.Close()
+
+	chunkCount, processingErrors := processFiles(ctx, files, options, writer)
+	recordRunErrors("indexing", processingErrors)
+	if chunkCount == 0 {
+		return nil, status.Error(codes.Internal, "no code chunks were processed successfully")
+	}
+	if err := commitIndex(ctx, writer); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to save embeddings: %v", err)
+	}
+	logStageTimings(ctx)
+
+	response := &codiev1.IndexResponse{Files: int32(len(files)), Chunks: int32(chunkCount)}
+	for _, err := range processingErrors {
+		response.Errors = append(response.Errors, err.Error())
+	}
+	return response, nil
+}
+
+// Search returns the indexed chunks most similar to a query
+func (s *grpcServer) Search(ctx context.Context, req *codiev1.SearchRequest) (*codiev1.SearchResponse, error) {
+	var results []search.Result
+	err := s.search(ctx, req, func(result search.Result) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &codiev1.SearchResponse{Results: toProtoResults(results)}, nil
+}
+
+// SearchStream sends the indexed chunks most similar to a query, each as soon
+// as it is ranked
+func (s *grpcServer) SearchStream(req *codiev1.SearchRequest, stream grpc.ServerStreamingServer[codiev1.SearchResult]) error {
+	return s.search(stream.Context(), req, func(result search.Result) error {
+		return stream.Send(toProtoResult(result))
+	})
+}
+
+// search finds the indexed chunks most similar to the query of a request and
+// passes them to send, best first. Results are passed on as the search ranks
+// them, or all at once after reranking.
+func (s *grpcServer) search(ctx context.Context, req *codiev1.SearchRequest, send func(search.Result) error) error {
+	if req.GetQuery() == "" {
+		return status.Error(codes.InvalidArgument, "query is required")
+	}
+	topK := DefaultSearchResults
+	if req.GetTopK() > 0 {
+		topK = int(req.GetTopK())
+	}
+
+	s.indexMutex.RLock()
+	defer s.indexMutex.RUnlock()
+
+	chunks, err := s.loadIndex()
+	if err != nil {
+		return err
+	}
+	chunks = withSummaries(chunks)
+	queryEmbedding, err := embeddings.GetQueryEmbeddingContext(ctx, req.GetQuery())
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to embed query: %v", err)
+	}
+
+	if !req.GetRerank() {
+		for result := range streamSearch(ctx, s.ann.get(chunks), chunks, queryEmbedding, topK) {
+			if err := send(result); err != nil {
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		return nil
+	}
+
+	var results []search.Result
+	candidates := max(summarization.RerankCandidates, topK)
+	for result := range streamSearch(ctx, s.ann.get(chunks), chunks, queryEmbedding, candidates) {
+		results = append(results, result)
+	}
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if results, err = summarization.Rerank(ctx, req.GetQuery(), results, topK); err != nil {
+		return status.Errorf(codes.Unavailable, "%v", err)
+	}
+	for _, result := range results {
+		if err := send(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ask answers a question from the most relevant indexed code
+func (s *grpcServer) Ask(ctx context.Context, req *codiev1.AskRequest) (*codiev1.AskResponse, error) {
+	if req.GetQuestion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "question is required")
+	}
+
+	s.indexMutex.RLock()
+	defer s.indexMutex.RUnlock()
+
+	chunks, err := s.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	chunks = withSummaries(chunks)
+	options := s.askOptions
+	options.TopK = int(req.GetTopK())
+	options.Rerank = req.GetRerank()
+	answer, sources, err := summarization.AnswerQuestion(ctx, chunks, req.GetQuestion(), options)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "%v", err)
+	}
+
+	return &codiev1.AskResponse{Answer: answer, Sources: toProtoResults(sources)}, nil
+}
+
+// Summarize generates a summary of the indexed codebase or one indexed file
+func (s *grpcServer) Summarize(ctx context.Context, req *codiev1.SummarizeRequest) (*codiev1.SummarizeResponse, error) {
+	options := summarization.DefaultSummaryOptions()
+	options.Mode = summarization.Mode(req.GetMode())
+	options.DetailLevel = summarization.DetailLevel(req.GetDetail())
+	options.Focus = splitFlagList(req.GetFocus())
+	options, err := options.Normalize()
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	s.indexMutex.RLock()
+	defer s.indexMutex.RUnlock()
+
+	var summary string
+	if req.GetFile() != "" {
+		summary, err = summarization.GenerateFileSummary(ctx, settings.IndexFile, req.GetFile(), options)
+	} else {
+		var result summarization.SummaryResult
+		result, err = summarization.GenerateRepoSummary(ctx, settings.IndexFile, options)
+		summary = result.Text
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to generate summary: %v", err)
+	}
+
+	return &codiev1.SummarizeResponse{Summary: summary}, nil
+}
+
+// toProtoResults converts search results to their gRPC messages
+func toProtoResults(results []search.Result) []*codiev1.SearchResult {
+	converted := make([]*codiev1.SearchResult, len(results))
+	for i, result := range results {
+		converted[i] = toProtoResult(result)
+	}
+	return converted
+}
+
+// toProtoResult converts a search result to its protobuf message
+func toProtoResult(result search.Result) *codiev1.SearchResult {
+	chunk := result.Chunk
+	return &codiev1.SearchResult{
+		Score: result.Score,
+		Chunk: &codiev1.Chunk{
+			File:      chunk.File,
+			StartLine: int32(chunk.StartLine),
+			EndLine:   int32(chunk.EndLine),
+			Package:   chunk.Package,
+			Class:     chunk.Class,
+			Function:  chunk.Function,
+			Content:   chunk.Content,
+		},
+	}
+}
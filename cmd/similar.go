@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Default minimum similarity of code reported by the similar command
+const DefaultSimilarityThreshold = 0.85
+
+// Default maximum number of similar chunks to report
+const DefaultSimilarResults = 20
+
+// FindSimilar reports indexed chunks that are near-duplicates of a file or a
+// line range of it, given as <file>[:start[-end]], to spot copy-paste drift
+func FindSimilar(target string, args []string) {
+	threshold := DefaultSimilarityThreshold
+	topK := DefaultSimilarResults
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--threshold=") {
+			t, err := strconv.ParseFloat(strings.TrimPrefix(arg, "--threshold="), 64)
+			if err != nil || t <= 0 || t > 1 {
+				log.Fatalf("Invalid --threshold value %q: must be a similarity above 0 and at most 1", arg)
+			}
+			threshold = t
+		} else if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			topK = n
+		}
+	}
+
+	file, startLine, endLine, err := parseFileRange(target)
+	if err != nil {
+		log.Fatalf("Invalid target %q: %v", target, err)
+	}
+	snippet, startLine, endLine, err := readLineRange(file, startLine, endLine)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", file, err)
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Reuse the stored embedding when the range is exactly an indexed chunk
+	var embedding []float32
+	for _, chunk := range chunks {
+		if samePath(chunk.File, file) && chunk.StartLine == startLine && chunk.EndLine == endLine {
+			embedding = chunk.Embedding
+			break
+		}
+	}
+	if embedding == nil {
+		if len(snippet) > settings.MaxChunkSize {
+			slog.Warn("Comparing only the start of the code", "chars", settings.MaxChunkSize, "of", len(snippet))
+			snippet = snippet[:settings.MaxChunkSize]
+		}
+		embedding, err = embeddings.GetEmbeddingContext(commandCtx, snippet)
+		if err != nil {
+			log.Fatalf("Failed to embed %s: %v", target, err)
+		}
+	}
+
+	// Leave out the code being compared, then keep matches above the threshold
+	isSource := func(chunk storage.CodeChunk) bool {
+		return samePath(chunk.File, file) && chunk.EndLine >= startLine && chunk.StartLine <= endLine
+	}
+	sourceChunks := 0
+	for _, chunk := range chunks {
+		if isSource(chunk) {
+			sourceChunks++
+		}
+	}
+	ctx, cancel := context.WithCancel(commandCtx)
+	defer cancel()
+	var matches []search.Result
+	for result := range streamSearch(ctx, openANN(chunks), chunks, embedding, topK+sourceChunks) {
+		if float64(result.Score) < threshold || len(matches) == topK {
+			break
+		}
+		if !isSource(result.Chunk) {
+			matches = append(matches, result)
+		}
+	}
+
+	if settings.JSONOutput {
+		hits := []SearchHit{}
+		for i, result := range matches {
+			hits = append(hits, newSearchHit(i+1, result))
+		}
+		printJSON(struct {
+			File      string      `json:"file"`
+			StartLine int         `json:"start_line"`
+			EndLine   int         `json:"end_line"`
+			Threshold float64     `json:"threshold"`
+			Results   []SearchHit `json:"results"`
+		}{file, startLine, endLine, threshold, hits})
+		return
+	}
+
+	if len(matches) == 0 {
+		fmt.Printf("No code with similarity %.2f or more to %s:%d-%d.\n", threshold, file, startLine, endLine)
+		return
+	}
+	fmt.Printf("Code similar to %s:%d-%d:\n\n", file, startLine, endLine)
+	for i, result := range matches {
+		printSearchResult(i+1, result)
+	}
+}
+
+// parseFileRange splits <file>[:start[-end]] into its parts; a missing start
+// or end is 0
+func parseFileRange(target string) (file string, start, end int, err error) {
+	file, lines, found := strings.Cut(target, ":")
+	if !found {
+		return target, 0, 0, nil
+	}
+	first, last, isRange := strings.Cut(lines, "-")
+	if start, err = strconv.Atoi(first); err != nil || start <= 0 {
+		return "", 0, 0, fmt.Errorf("line range must be <start> or <start>-<end>")
+	}
+	end = start
+	if isRange {
+		if end, err = strconv.Atoi(last); err != nil || end < start {
+			return "", 0, 0, fmt.Errorf("line range must be <start> or <start>-<end>")
+		}
+	}
+	return file, start, end, nil
+}
+
+// readLineRange returns lines start through end of a file, with the range
+// clamped to the file. A start of 0 reads the whole file.
+func readLineRange(file string, start, end int) (string, int, int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if start == 0 {
+		start, end = 1, len(lines)
+	}
+	if start > len(lines) {
+		return "", 0, 0, fmt.Errorf("file has only %d lines", len(lines))
+	}
+	end = min(end, len(lines))
+	return strings.Join(lines[start-1:end], "\n"), start, end, nil
+}
+
+// samePath reports whether two paths name the same file
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// StalenessPolicy decides when an existing index is refreshed before it is used
+type StalenessPolicy struct {
+	MaxAge           time.Duration // Refresh when the index is older than this (0 disables)
+	MaxCommitsBehind int           // Refresh when HEAD is this many commits past the index (0 disables)
+	NoRefresh        bool          // Only warn about a stale index instead of refreshing it
+}
+
+// parseStalenessPolicy builds the policy from the staleness settings
+// (config key staleness / stale_commits) and the --no-refresh flag
+func parseStalenessPolicy(args []string) StalenessPolicy {
+	policy := StalenessPolicy{
+		MaxAge:           settings.Staleness,
+		MaxCommitsBehind: settings.StaleCommits,
+	}
+
+	for _, arg := range args {
+		if arg == "--no-refresh" {
+			policy.NoRefresh = true
+		}
+	}
+
+	return policy
+}
+
+// ensureFreshIndex checks the index against the staleness policy and, when it
+// is stale, refreshes it incrementally from dir (or only warns with NoRefresh).
+// It reports whether the index was rewritten.
+func ensureFreshIndex(dir string, policy StalenessPolicy, options IndexOptions) bool {
+	info, err := os.Stat(settings.IndexFile)
+	if err != nil {
+		return false
+	}
+
+	reason := staleReason(dir, info.ModTime(), policy)
+	if reason == "" {
+		return false
+	}
+
+	if policy.NoRefresh {
+		slog.Warn("Index is stale; results may be out of date. Run without --no-refresh to update it.", "reason", reason)
+		return false
+	}
+
+	slog.Info("Index is stale; refreshing changed files", "reason", reason)
+	if err := refreshSources(dir, info.ModTime(), options); err != nil {
+		slog.Warn("Failed to refresh index, using existing one", "error", err)
+		return false
+	}
+	return true
+}
+
+// staleReason describes why an index written at indexTime is stale, or returns "" if it isn't
+func staleReason(dir string, indexTime time.Time, policy StalenessPolicy) string {
+	if policy.MaxAge > 0 {
+		if age := time.Since(indexTime); age > policy.MaxAge {
+			return fmt.Sprintf("%v old, limit %v", age.Round(time.Minute), policy.MaxAge)
+		}
+	}
+
+	if policy.MaxCommitsBehind > 0 {
+		if behind, err := commitsSince(dir, indexTime); err == nil && behind >= policy.MaxCommitsBehind {
+			return fmt.Sprintf("%d commits behind HEAD, limit %d", behind, policy.MaxCommitsBehind)
+		}
+	}
+
+	return ""
+}
+
+// commitsSince counts commits on HEAD made after the given time
+func commitsSince(dir string, since time.Time) (int, error) {
+	out, err := exec.Command("git", "-C", dir, "rev-list", "--count",
+		"--since="+since.Format(time.RFC3339), "HEAD").Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// refreshSources refreshes each workspace repository in turn, or dir when
+// there is no workspace
+func refreshSources(dir string, indexTime time.Time, options IndexOptions) error {
+	workspace, err := storage.LoadWorkspace(settings.IndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to read workspace: %w", err)
+	}
+	if len(workspace.Repos) == 0 {
+		return refreshIndex(dir, indexTime, options)
+	}
+	for _, repo := range workspace.Repos {
+		options.Repo = repo.Name
+		if err := refreshIndex(repo.Dir, indexTime, options); err != nil {
+			return fmt.Errorf("%s: %w", repo.Name, err)
+		}
+	}
+	return nil
+}
+
+// refreshIndex re-embeds files under dir that are new or modified since
+// indexTime, drops chunks for files that no longer exist, and keeps the rest
+func refreshIndex(dir string, indexTime time.Time, options IndexOptions) error {
+	// Hold the lock from reading the index to writing it back, so changes
+	// another process makes in between aren't lost
+	unlock, err := openStore().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+
+	ctx := withProgress(commandCtx)
+	files, err := discoverFiles(ctx, dir, options.Git)
+	if err != nil {
+		return fmt.Errorf("failed to scan directory: %w", err)
+	}
+	if options, err = options.withCommit(dir); err != nil {
+		return err
+	}
+	options.Root = dir
+
+	indexed := make(map[string]bool)
+	blobs := make(map[string]string)
+	for _, chunk := range existing {
+		indexed[chunk.File] = true
+		if chunk.Blob != "" {
+			blobs[chunk.File] = chunk.Blob
+		}
+	}
+
+	// Find new and modified files. Files indexed with their blob hash are
+	// compared by content, which modification times only approximate.
+	var toProcess []string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !indexed[file] {
+			toProcess = append(toProcess, file)
+		} else if blob, ok := blobs[file]; ok {
+			if content, err := os.ReadFile(file); err != nil || gitdiff.BlobHash(string(content)) != blob {
+				toProcess = append(toProcess, file)
+			}
+		} else if info.ModTime().After(indexTime) {
+			toProcess = append(toProcess, file)
+		}
+	}
+	return reindexFiles(ctx, existing, toProcess, options)
+}
+
+// refreshIndexSince re-embeds the files under dir that git reports changed
+// since commit, or that aren't indexed, and drops chunks for files that no
+// longer exist. Unlike modification times, this works in a fresh checkout
+// of a repository whose index was restored from a cache.
+func refreshIndexSince(dir, commit string, options IndexOptions) error {
+	unlock, err := openStore().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	existing, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	root, err := gitdiff.TopLevel(dir)
+	if err != nil {
+		return err
+	}
+	changes, err := gitdiff.Changes(root, commit, "")
+	if err != nil {
+		return err
+	}
+
+	ctx := withProgress(commandCtx)
+	files, err := discoverFiles(ctx, dir, options.Git)
+	if err != nil {
+		return fmt.Errorf("failed to scan directory: %w", err)
+	}
+	if options, err = options.withCommit(dir); err != nil {
+		return err
+	}
+	options.Root = dir
+
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		if abs, err := filepath.Abs(filepath.Join(root, change.Path)); err == nil {
+			changed[abs] = true
+		}
+	}
+	indexed := make(map[string]bool)
+	for _, chunk := range existing {
+		indexed[chunk.File] = true
+	}
+
+	var toProcess []string
+	for _, file := range files {
+		abs, _ := filepath.Abs(file)
+		if !indexed[file] || changed[abs] {
+			toProcess = append(toProcess, file)
+		}
+	}
+	if err := reindexFiles(ctx, existing, toProcess, options); err != nil {
+		return err
+	}
+	saveIndexMetadata(dir, options)
+	return nil
+}
+
+// reindexFiles rewrites the index with the files in toProcess embedded
+// again, keeping the chunks of the other files that still exist
+func reindexFiles(ctx context.Context, existing []storage.CodeChunk, toProcess []string, options IndexOptions) error {
+	changed := make(map[string]bool)
+	for _, file := range toProcess {
+		changed[file] = true
+	}
+
+	// Keep chunks for unchanged files that still exist
+	var kept []storage.CodeChunk
+	removed := make(map[string]bool)
+	for _, chunk := range existing {
+		if changed[chunk.File] {
+			continue
+		}
+		if _, err := os.Stat(chunk.File); err != nil {
+			removed[chunk.File] = true
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+
+	if len(toProcess) == 0 && len(removed) == 0 {
+		slog.Info("No changes found; index is up to date")
+		// Touch the index so the age check passes until the next change
+		now := time.Now()
+		return os.Chtimes(settings.IndexFile, now, now)
+	}
+
+	slog.Info("Re-indexing changed files", "changed", len(toProcess), "deleted", len(removed))
+	writer, err := openStore().NewWriter()
+	if err != nil {
+		return fmt.Errorf("failed to start writing the index: %w", err)
+	}
+	defer writer.Close()
+	if err := writeChunks(writer, kept); err != nil {
+		return fmt.Errorf("failed to write the index: %w", err)
+	}
+	newChunks, processingErrors := processFiles(ctx, toProcess, options, writer)
+	reportProcessingErrors(processingErrors)
+
+	if err := commitIndex(ctx, writer); err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	logStageTimings(ctx)
+
+	slog.Info("Index refreshed", "chunks", len(kept)+newChunks)
+	return nil
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// Embedding models by the number of dimensions of their vectors
+var embeddingModelsByDimensions = map[int]string{
+	256:  "mock",
+	384:  "all-MiniLM-L6-v2, bge-small-en-v1.5, embed-english-light-v3.0, or embed-multilingual-light-v3.0",
+	768:  "text-embedding-004, text-embedding-005, or text-multilingual-embedding-002",
+	1024: "embed-english-v3.0, embed-multilingual-v3.0, or amazon.titan-embed-text-v2:0",
+	1536: "text-embedding-3-small, text-embedding-ada-002, or amazon.titan-embed-text-v1",
+	3072: "text-embedding-3-large",
+}
+
+// LanguageStats counts the indexed files, chunks, and lines of one language
+type LanguageStats struct {
+	Language string `json:"language"`
+	Files    int    `json:"files"`
+	Chunks   int    `json:"chunks"`
+	LOC      int    `json:"loc"`
+}
+
+// IndexStats describes an index file and how current it is
+type IndexStats struct {
+	IndexFile           string          `json:"index_file"`
+	SizeBytes           int64           `json:"size_bytes"`
+	ModifiedAt          time.Time       `json:"modified_at"`
+	AgeSeconds          int64           `json:"age_seconds"`
+	Files               int             `json:"files"`
+	Chunks              int             `json:"chunks"`
+	LOC                 int             `json:"loc"`
+	Languages           []LanguageStats `json:"languages"`
+	EmbeddingModel      string          `json:"embedding_model"`      // Configured embedding model
+	EmbeddingDimensions int             `json:"embedding_dimensions"` // Dimensions of the stored vectors
+	MissingFiles        []string        `json:"missing_files"`        // Indexed files no longer on disk
+	ChangedFiles        []string        `json:"changed_files"`        // Indexed files modified since the index was written
+
+	// What was indexed, for indexes that record it
+	Source *storage.Metadata `json:"source,omitempty"`
+	// How the index was built, from its header
+	Header storage.Header `json:"header"`
+}
+
+// Stats reports what the index contains and which of its files are stale
+func Stats(args []string) {
+	info, err := os.Stat(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to read index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+	// Stats are shown for indexes built with other settings too
+	header, chunks, err := storage.LoadIndex(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s: %v", settings.IndexFile, err)
+	}
+
+	stats := collectIndexStats(chunks, info)
+	stats.Header = header
+	if metadata, err := storage.LoadMetadata(settings.IndexFile); err == nil {
+		stats.Source = &metadata
+	}
+	if settings.JSONOutput {
+		printJSON(stats)
+		return
+	}
+	printIndexStats(stats)
+}
+
+// collectIndexStats summarizes chunks loaded from the index file described by info
+func collectIndexStats(chunks []storage.CodeChunk, info os.FileInfo) IndexStats {
+	stats := IndexStats{
+		IndexFile:      settings.IndexFile,
+		SizeBytes:      info.Size(),
+		ModifiedAt:     info.ModTime(),
+		AgeSeconds:     int64(time.Since(info.ModTime()).Seconds()),
+		Chunks:         len(chunks),
+		EmbeddingModel: settings.EmbeddingModel,
+		MissingFiles:   []string{},
+		ChangedFiles:   []string{},
+	}
+
+	// A file's LOC is its last chunked line, or the lines of its chunks when
+	// they have no line numbers
+	fileChunks := make(map[string]int)
+	fileLOC := make(map[string]int)
+	for _, chunk := range chunks {
+		fileChunks[chunk.File]++
+		if chunk.EndLine > 0 {
+			fileLOC[chunk.File] = max(fileLOC[chunk.File], chunk.EndLine)
+		} else {
+			fileLOC[chunk.File] += strings.Count(chunk.Content, "\n") + 1
+		}
+		if stats.EmbeddingDimensions == 0 {
+			stats.EmbeddingDimensions = len(chunk.Embedding)
+		}
+	}
+	stats.Files = len(fileChunks)
+
+	languages := make(map[string]*LanguageStats)
+	for file, count := range fileChunks {
+		language := summarization.LanguageForFile(file)
+		if languages[language] == nil {
+			languages[language] = &LanguageStats{Language: language}
+		}
+		languages[language].Files++
+		languages[language].Chunks += count
+		languages[language].LOC += fileLOC[file]
+		stats.LOC += fileLOC[file]
+
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			stats.MissingFiles = append(stats.MissingFiles, file)
+		} else if fileInfo.ModTime().After(info.ModTime()) {
+			stats.ChangedFiles = append(stats.ChangedFiles, file)
+		}
+	}
+
+	for _, language := range languages {
+		stats.Languages = append(stats.Languages, *language)
+	}
+	sort.Slice(stats.Languages, func(i, j int) bool {
+		if stats.Languages[i].Files != stats.Languages[j].Files {
+			return stats.Languages[i].Files > stats.Languages[j].Files
+		}
+		return stats.Languages[i].Language < stats.Languages[j].Language
+	})
+	sort.Strings(stats.MissingFiles)
+	sort.Strings(stats.ChangedFiles)
+
+	return stats
+}
+
+// printIndexStats prints index statistics for the terminal
+func printIndexStats(stats IndexStats) {
+	fmt.Printf("Index: %s\n", stats.IndexFile)
+	if source := stats.Source; source != nil {
+		fmt.Printf("  Source:           %s\n", source.Source)
+		if source.Ref != "" {
+			fmt.Printf("  Ref:              %s\n", source.Ref)
+		}
+		if source.Commit != "" {
+			fmt.Printf("  Commit:           %s\n", source.Commit)
+		}
+	}
+	fmt.Printf("  Size on disk:     %s\n", formatBytes(stats.SizeBytes))
+	fmt.Printf("  Last written:     %s (%v ago)\n", stats.ModifiedAt.Format(time.RFC3339),
+		(time.Duration(stats.AgeSeconds) * time.Second).String())
+	fmt.Printf("  Files:            %d\n", stats.Files)
+	fmt.Printf("  Chunks:           %d\n", stats.Chunks)
+	fmt.Printf("  Lines of code:    %d\n", stats.LOC)
+
+	model := stats.EmbeddingModel + " (configured)"
+	if stored := stats.Header.EmbeddingModel; stored != "" {
+		if stored != stats.EmbeddingModel {
+			model += fmt.Sprintf("; the index was embedded with %s", stored)
+		}
+	} else if stored, ok := embeddingModelsByDimensions[stats.EmbeddingDimensions]; ok && !strings.Contains(stored, stats.EmbeddingModel) {
+		// Indexes without a header only hint at their model
+		model += fmt.Sprintf("; stored vectors look like %s", stored)
+	}
+	fmt.Printf("  Embedding model:  %s\n", model)
+	fmt.Printf("  Dimensions:       %d\n", stats.EmbeddingDimensions)
+	if header := stats.Header; header.SchemaVersion < storage.SchemaVersion {
+		fmt.Printf("  Schema version:   %d (no header; rewritten as version %d on the next save)\n", header.SchemaVersion, storage.SchemaVersion)
+	} else {
+		fmt.Printf("  Schema version:   %d, chunker version %d, written by codie %s\n", header.SchemaVersion, header.ChunkerVersion, header.ToolVersion)
+		fmt.Printf("  Created:          %s\n", header.CreatedAt.Local().Format(time.RFC3339))
+	}
+
+	fmt.Println("\nLanguages:")
+	for _, language := range stats.Languages {
+		fmt.Printf("  %-16s %6d files  %7d chunks  %9d lines\n", language.Language, language.Files, language.Chunks, language.LOC)
+	}
+
+	if len(stats.MissingFiles) == 0 && len(stats.ChangedFiles) == 0 {
+		fmt.Println("\nNo stale files; every indexed file is unchanged on disk.")
+		return
+	}
+	printFileList(fmt.Sprintf("\nMissing on disk (%d):", len(stats.MissingFiles)), stats.MissingFiles)
+	printFileList(fmt.Sprintf("\nChanged since indexing (%d):", len(stats.ChangedFiles)), stats.ChangedFiles)
+}
+
+// printFileList prints a heading and up to 20 files under it
+func printFileList(heading string, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Println(heading)
+	for i, file := range files {
+		if i == 20 {
+			fmt.Printf("  ... and %d more\n", len(files)-20)
+			break
+		}
+		fmt.Printf("  %s\n", file)
+	}
+}
+
+// formatBytes formats a size with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// DiffRange is the pair of revisions a diff command compares, the changes
+// staged for the next commit, or a patch file
+type DiffRange struct {
+	RepoDir   string
+	From      string
+	To        string
+	Staged    bool   // Compare the staged changes with HEAD; From and To are unused
+	PatchFile string // Read the changes from a unified diff, with files as in the working tree
+}
+
+// parseDiffRange reads "<rev1> [rev2]" or --since=<ref>, plus --repo=<dir>.
+// --since compares HEAD with its merge base with ref, as a pull request would.
+func parseDiffRange(args []string) DiffRange {
+	diffRange := DiffRange{RepoDir: "."}
+	var revisions []string
+	since := ""
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--since=") {
+			since = strings.TrimPrefix(arg, "--since=")
+		} else if strings.HasPrefix(arg, "--repo=") {
+			diffRange.RepoDir = strings.TrimPrefix(arg, "--repo=")
+		} else if !strings.HasPrefix(arg, "--") {
+			revisions = append(revisions, arg)
+		}
+	}
+
+	switch {
+	case since != "":
+		if len(revisions) > 0 {
+			log.Fatal("Pass either --since=<ref> or revisions, not both")
+		}
+		base, err := gitdiff.MergeBase(diffRange.RepoDir, since, "HEAD")
+		if err != nil {
+			log.Fatalf("Failed to find merge base with %s: %v", since, err)
+		}
+		diffRange.From, diffRange.To = base, "HEAD"
+	case len(revisions) == 1:
+		diffRange.From, diffRange.To = revisions[0], "HEAD"
+	case len(revisions) == 2:
+		diffRange.From, diffRange.To = revisions[0], revisions[1]
+	default:
+		log.Fatal("Usage: go run main.go summarize-diff <rev1> [rev2] | --since=<ref> [options]")
+	}
+
+	for _, rev := range []string{diffRange.From, diffRange.To} {
+		if _, err := gitdiff.ResolveRevision(diffRange.RepoDir, rev); err != nil {
+			log.Fatalf("Invalid revision: %v", err)
+		}
+	}
+
+	return diffRange
+}
+
+// loadDiffSummaryInput collects the changes of a diff range, embeds the
+// changed files as they are after it, and loads unchanged code from the index
+func loadDiffSummaryInput(diffRange DiffRange, args []string) summarization.DiffSummaryInput {
+	input := summarization.DiffSummaryInput{From: diffRange.From, To: diffRange.To}
+
+	root, err := gitdiff.TopLevel(diffRange.RepoDir)
+	if err != nil {
+		// A patch file applies to any directory
+		if diffRange.PatchFile == "" {
+			log.Fatalf("Not a git repository: %v", err)
+		}
+		root = diffRange.RepoDir
+	}
+
+	show := func(path string) (string, error) {
+		return gitdiff.Show(root, diffRange.To, path)
+	}
+	switch {
+	case diffRange.PatchFile != "":
+		patch, err := os.ReadFile(diffRange.PatchFile)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", diffRange.PatchFile, err)
+		}
+		input.Changes = gitdiff.ParsePatch(string(patch))
+		show = func(path string) (string, error) {
+			return gitdiff.Show(root, "", path)
+		}
+	case diffRange.Staged:
+		input.Changes, err = gitdiff.StagedChanges(root)
+		if err != nil {
+			log.Fatalf("Failed to diff staged changes: %v", err)
+		}
+		show = func(path string) (string, error) {
+			return gitdiff.ShowStaged(root, path)
+		}
+	default:
+		input.Changes, err = gitdiff.Changes(root, diffRange.From, diffRange.To)
+		if err != nil {
+			log.Fatalf("Failed to diff %s..%s: %v", diffRange.From, diffRange.To, err)
+		}
+		input.Commits, err = gitdiff.Log(root, diffRange.From, diffRange.To)
+		if err != nil {
+			slog.Warn("Failed to read commit log", "error", err)
+		}
+	}
+
+	// Index only the changed code files, as they are at the newer revision or staged
+	options := parseIndexOptions(args)
+	changed := make(map[string]bool)
+	for _, change := range input.Changes {
+		abs, _ := filepath.Abs(filepath.Join(root, change.Path))
+		changed[abs] = true
+		if change.Status == "deleted" || change.Binary || !fileutils.IsCodeFile(root, change.Path) {
+			continue
+		}
+
+		content, err := show(change.Path)
+		if err != nil {
+			slog.Warn("Failed to read changed file", "file", change.Path, "revision", diffRange.To, "error", err)
+			continue
+		}
+		chunks, err := embedFileContent(change.Path, content, options)
+		if err != nil {
+			slog.Warn("Failed to index file", "file", change.Path, "error", err)
+			continue
+		}
+		input.ChangedChunks = append(input.ChangedChunks, chunks...)
+	}
+
+	// The existing index supplies context; the summary works without it
+	indexed, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		slog.Info("No index found; summarizing without related code", "index", settings.IndexFile)
+		return input
+	}
+	for _, chunk := range indexed {
+		if abs, err := filepath.Abs(chunk.File); err == nil && changed[abs] {
+			continue
+		}
+		input.Context = append(input.Context, chunk)
+	}
+
+	return input
+}
+
+// SummarizeDiff generates a change-focused summary of the diff between two revisions
+func SummarizeDiff(args []string) {
+	start := time.Now()
+	diffRange := parseDiffRange(args)
+
+	slog.Info("Summarizing changes", "from", diffRange.From, "to", diffRange.To)
+	input := loadDiffSummaryInput(diffRange, args)
+	slog.Info("Found changed files", "files", len(input.Changes), "chunks", len(input.ChangedChunks))
+
+	summary, err := summarization.GenerateDiffSummary(commandCtx, input, parseSummaryOptions(args))
+	if err != nil {
+		log.Fatalf("Failed to generate summary: %v", err)
+	}
+
+	writeSummary(fmt.Sprintf("Changes %s..%s", diffRange.From, diffRange.To), summary, parseSummaryOutput(args))
+	slog.Info("Summary complete", "duration", time.Since(start))
+}
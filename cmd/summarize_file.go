@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// SummarizeFile generates a focused summary of a single indexed file
+func SummarizeFile(path string, args []string) {
+	start := time.Now()
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index so the file's chunks are current
+	ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args))
+
+	slog.Info("Generating file summary", "file", path)
+	summary, err := summarization.GenerateFileSummary(commandCtx, settings.IndexFile, path, parseSummaryOptions(args))
+	if err != nil {
+		log.Fatalf("Failed to generate summary: %v", err)
+	}
+
+	writeSummary("File summary: "+path, summary, parseSummaryOutput(args))
+	slog.Info("Summary complete", "duration", time.Since(start))
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/summarization"
+)
+
+// First line of every page of a directory tree, which marks pages that may
+// be overwritten or removed
+const treePageMarker = "<!-- Generated by codie summarize --per-directory; edits are overwritten. -->"
+
+// DirectoryTreeReport lists the pages written for a directory tree
+type DirectoryTreeReport struct {
+	OutputDir   string   `json:"output_dir"`
+	Pages       []string `json:"pages"`
+	Removed     []string `json:"removed"` // Pages of directories that are gone
+	Directories int      `json:"directories"`
+	Cached      int      `json:"cached"` // Directories whose summaries came from the cache
+	DurationMS  int64    `json:"duration_ms"`
+}
+
+// summarizeDirectories writes a summary of every directory of the index as
+// a tree of markdown pages under --output-dir, by default docs/ARCHITECTURE
+// of the summarized directory
+func summarizeDirectories(dir string, options summarization.SummaryOptions, args []string) {
+	start := time.Now()
+	outputDir := filepath.Join(dir, "docs", "ARCHITECTURE")
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--output-dir=") {
+			outputDir = strings.TrimPrefix(arg, "--output-dir=")
+		}
+	}
+
+	slog.Info("Summarizing directories")
+	tree, err := summarization.GenerateDirectorySummaries(commandCtx, settings.IndexFile, options)
+	if err != nil {
+		log.Fatalf("Failed to summarize directories: %v", err)
+	}
+
+	report := DirectoryTreeReport{OutputDir: outputDir, Pages: []string{}, Removed: []string{}, Directories: len(tree.Directories)}
+	written := make(map[string]bool)
+	for _, summary := range tree.Directories {
+		page := filepath.Join(outputDir, summary.Path, "README.md")
+		if err := os.MkdirAll(filepath.Dir(page), 0755); err != nil {
+			log.Fatalf("Failed to create %s: %v", filepath.Dir(page), err)
+		}
+		if err := os.WriteFile(page, []byte(buildDirectoryPage(tree, summary, outputDir)), 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", page, err)
+		}
+		written[page] = true
+		report.Pages = append(report.Pages, page)
+		if summary.Cached {
+			report.Cached++
+		}
+	}
+
+	// Pages generated for directories that are gone are removed, unless
+	// only part of the tree was summarized
+	if len(options.Focus) == 0 && len(options.Exclude) == 0 {
+		filepath.WalkDir(outputDir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || entry.Name() != "README.md" || written[path] || !isTreePage(path) {
+				return nil
+			}
+			if err := os.Remove(path); err != nil {
+				slog.Warn("Failed to remove stale page", "path", path, "error", err)
+				return nil
+			}
+			os.Remove(filepath.Dir(path)) // Only succeeds if the directory is now empty
+			report.Removed = append(report.Removed, path)
+			return nil
+		})
+	}
+
+	report.DurationMS = time.Since(start).Milliseconds()
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	fmt.Printf("Wrote %d directory pages to %s (%d unchanged since the last run)\n", len(report.Pages), outputDir, report.Cached)
+	if len(report.Removed) > 0 {
+		fmt.Printf("Removed %d pages of directories that are gone\n", len(report.Removed))
+	}
+	slog.Info("Directory summaries complete", "duration", time.Since(start))
+}
+
+// buildDirectoryPage renders the page of a directory: its summary, links to
+// its parent and subdirectories, and its files with links to their source
+func buildDirectoryPage(tree summarization.DirectoryTree, summary summarization.DirectorySummary, outputDir string) string {
+	summaries := make(map[string]summarization.DirectorySummary)
+	for _, directory := range tree.Directories {
+		summaries[directory.Path] = directory
+	}
+
+	// Blocks of the page, separated by blank lines
+	blocks := []string{treePageMarker}
+	if summary.Path == "." {
+		root, _ := filepath.Abs(tree.Root)
+		blocks = append(blocks, "# "+filepath.Base(root))
+	} else {
+		blocks = append(blocks, "# "+filepath.ToSlash(summary.Path))
+		parent := filepath.Dir(summary.Path)
+		name := filepath.ToSlash(parent)
+		if parent == "." {
+			name = "repository root"
+		}
+		blocks = append(blocks, fmt.Sprintf("[Up to %s](../README.md)", name))
+	}
+
+	if summary.Summary != "" {
+		blocks = append(blocks, summary.Summary)
+	}
+
+	if len(summary.Subdirectories) > 0 {
+		var sb strings.Builder
+		sb.WriteString("## Subdirectories\n")
+		for _, path := range summary.Subdirectories {
+			name := filepath.Base(path)
+			sb.WriteString(fmt.Sprintf("\n- [%s/](%s/README.md)", name, name))
+			if first := firstSentence(summaries[path].Summary); first != "" {
+				sb.WriteString(" - " + first)
+			}
+		}
+		blocks = append(blocks, sb.String())
+	}
+
+	if len(summary.Files) > 0 {
+		var sb strings.Builder
+		sb.WriteString("## Files\n")
+		pageDir, _ := filepath.Abs(filepath.Join(outputDir, summary.Path))
+		for _, file := range summary.Files {
+			name := filepath.Base(file.Path)
+			source, _ := filepath.Abs(filepath.Join(tree.Root, file.Path))
+			if link, err := filepath.Rel(pageDir, source); err == nil {
+				sb.WriteString(fmt.Sprintf("\n- [`%s`](%s)", name, filepath.ToSlash(link)))
+			} else {
+				sb.WriteString(fmt.Sprintf("\n- `%s`", name))
+			}
+			if file.Summary != "" {
+				sb.WriteString(" - " + file.Summary)
+			}
+		}
+		blocks = append(blocks, sb.String())
+	}
+
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// firstSentence returns the first sentence of a summary, for one-line
+// descriptions of subdirectories
+func firstSentence(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if end := strings.Index(text, ". "); end >= 0 {
+		return text[:end+1]
+	}
+	return text
+}
+
+// isTreePage reports whether a file is a page written by
+// summarizeDirectories, by its first line
+func isTreePage(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	return scanner.Scan() && scanner.Text() == treePageMarker
+}
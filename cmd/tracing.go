@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/progress"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/tracing"
+	"github.com/exolottl/codie/pkg/index"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Context of the running command, carrying its root span when tracing is on
+var commandCtx = context.Background()
+
+// StartTracing exports spans when OTEL_EXPORTER_OTLP_ENDPOINT is set and
+// starts the root span of the command. The returned function ends the span
+// and flushes pending spans.
+func StartTracing(command string) func() {
+	shutdown, err := tracing.Init(context.Background())
+	if err != nil {
+		slog.Warn("Tracing disabled", "error", err)
+		return func() {}
+	}
+
+	var span trace.Span
+	commandCtx, span = tracing.Start(context.Background(), "codie "+command)
+	return func() {
+		span.End()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Failed to flush traces", "error", err)
+		}
+	}
+}
+
+// discoverFiles lists the code files under dir, or only those git tracks,
+// starting the run's error report. It fails only if no files could be
+// listed.
+func discoverFiles(ctx context.Context, dir string, tracked bool) ([]string, error) {
+	_, span := tracing.Start(ctx, "discover files", attribute.String("codie.directory", dir), attribute.Bool("codie.git", tracked))
+	start := time.Now()
+	progress.Report(ctx, progress.Event{Stage: progress.Discovery})
+	var files []string
+	var err error
+	if tracked {
+		files, err = fileutils.GetGitFiles(dir)
+	} else {
+		files, err = fileutils.GetCodeFiles(dir)
+	}
+	files, oversized := fileutils.LimitFileSize(files, settings.MaxFileSize)
+	span.SetAttributes(attribute.Int("codie.files", len(files)), attribute.Int("codie.files_skipped", len(oversized)))
+	tracing.End(span, err)
+	progress.Report(ctx, progress.Event{Stage: progress.Discovery, Items: len(files), Duration: time.Since(start), Done: true})
+
+	// Directories that can't be read are reported with the run's other
+	// errors rather than failing it
+	startErrorReport(dir)
+	if err != nil && len(files) > 0 {
+		errs := splitErrors(err)
+		recordRunErrors("discovery", errs)
+		slog.Warn("Skipped directories that couldn't be read; run 'errors' to list them", "errors", len(errs))
+		err = nil
+	}
+
+	var skipped []index.Skipped
+	for _, file := range oversized {
+		skipped = append(skipped, index.Skipped{File: file.Path, Reason: file.Reason})
+	}
+	reportSkippedFiles(skipped)
+	return files, err
+}
+
+// commitIndex makes the chunks written to writer the index
+func commitIndex(ctx context.Context, writer storage.ChunkWriter) error {
+	_, span := tracing.Start(ctx, "store write", attribute.String("codie.index_file", settings.IndexFile))
+	start := time.Now()
+	err := writer.Commit()
+	tracing.End(span, err)
+	progress.Report(ctx, progress.Event{Stage: progress.Writing, Duration: time.Since(start), Done: true})
+	return err
+}
+
+// writeChunks writes already indexed chunks to writer, grouped by file
+func writeChunks(writer storage.ChunkWriter, chunks []storage.CodeChunk) error {
+	for start := 0; start < len(chunks); {
+		end := start + 1
+		for end < len(chunks) && chunks[end].File == chunks[start].File {
+			end++
+		}
+		if err := writer.WriteFile(chunks[start].File, chunks[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/summarization"
+	"github.com/exolottl/codie/internal/tui"
+)
+
+// TUI opens an interactive terminal browser for searching the index,
+// previewing matched chunks in their files, summarizing those files, and
+// opening them in the editor.
+// Words that aren't options form an initial query.
+func TUI(args []string) {
+	topK := DefaultSearchResults * 5
+	hybrid := false
+	var queryWords []string
+	for _, arg := range args {
+		if arg == "--hybrid" {
+			hybrid = true
+		} else if strings.HasPrefix(arg, "--top=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--top="))
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid --top value %q: must be a positive integer", arg)
+			}
+			topK = n
+		} else if !strings.HasPrefix(arg, "--") {
+			queryWords = append(queryWords, arg)
+		}
+	}
+
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to load index %s (run 'index' first): %v", settings.IndexFile, err)
+	}
+
+	// Refresh a stale index before browsing it
+	if ensureFreshIndex(storage.RootDir(chunks), parseStalenessPolicy(args), parseIndexOptions(args)) {
+		chunks, err = storage.LoadFromJSON(settings.IndexFile)
+		if err != nil {
+			log.Fatalf("Failed to reload index %s: %v", settings.IndexFile, err)
+		}
+	}
+	chunks = withSummaries(chunks)
+
+	exact := false
+	if filter := parseSearchFilter(args); filter.active() {
+		chunks = filter.apply(chunks)
+		exact = true
+	}
+	var ann *search.ANN
+	if !exact {
+		ann = openANN(chunks)
+	}
+
+	searchFn := func(ctx context.Context, query string) ([]search.Result, error) {
+		queryEmbedding, err := embeddings.GetQueryEmbeddingContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		var results <-chan search.Result
+		if hybrid {
+			results = hybridSearch(ann, chunks, query, queryEmbedding, topK, 0)
+		} else {
+			results = streamSearch(ctx, ann, chunks, queryEmbedding, topK)
+		}
+		var found []search.Result
+		for result := range results {
+			found = append(found, result)
+		}
+		return found, ctx.Err()
+	}
+
+	summaryOptions := parseSummaryOptions(args)
+	summaryFn := func(ctx context.Context, file string) (string, error) {
+		return summarization.GenerateFileSummary(ctx, settings.IndexFile, file, summaryOptions)
+	}
+
+	// Log lines would draw over the screen, so errors are shown in the
+	// browser's status line instead
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	err = tui.Run(commandCtx, strings.Join(queryWords, " "), searchFn, summaryFn, editorCommand)
+	slog.SetDefault(logger)
+	if err != nil {
+		log.Fatalf("Terminal browser failed: %v", err)
+	}
+}
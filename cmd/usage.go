@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/exolottl/codie/internal/logging"
+	"github.com/exolottl/codie/internal/usage"
+)
+
+// ReportUsage prints the API usage of this run and, when --usage-log or
+// CODIE_USAGE_LOG is set, appends it to that log file for cost tracking
+func ReportUsage(command string, args []string) {
+	report := usage.Snapshot(command)
+	if logging.JSON() {
+		slog.Info("API usage", "requests", report.Requests, "tokens", report.Tokens, "estimated_cost_usd", report.TotalCost)
+	} else if logging.Enabled(slog.LevelInfo) {
+		report.Print(os.Stderr)
+	}
+
+	logPath := os.Getenv("CODIE_USAGE_LOG")
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--usage-log=") {
+			logPath = strings.TrimPrefix(arg, "--usage-log=")
+		}
+	}
+
+	if logPath != "" && report.Requests > 0 {
+		if err := usage.AppendToLog(logPath, report); err != nil {
+			slog.Warn("Failed to write usage log", "path", logPath, "error", err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// WorkspaceRepoStats describes a workspace repository and its share of the index
+type WorkspaceRepoStats struct {
+	Name   string `json:"name"`
+	Dir    string `json:"dir"`
+	Files  int    `json:"files"`
+	Chunks int    `json:"chunks"`
+}
+
+// Workspace manages the repositories indexed together into one index. Each
+// repository's chunks are namespaced by its name, so searches cover every
+// repository unless limited with --repo.
+func Workspace(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: go run main.go workspace add|remove|list [options]")
+	}
+	switch args[0] {
+	case "add":
+		workspaceAdd(args[1:])
+	case "remove":
+		workspaceRemove(args[1:])
+	case "list":
+		workspaceList()
+	default:
+		log.Fatalf("Unknown workspace command %q: must be add, remove, or list", args[0])
+	}
+}
+
+// workspaceAdd indexes a directory as a workspace repository, replacing the
+// repository's earlier chunks and keeping every other repository's
+func workspaceAdd(args []string) {
+	var dir, name string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--name=") {
+			name = strings.TrimPrefix(arg, "--name=")
+		} else if !strings.HasPrefix(arg, "--") && dir == "" {
+			dir = arg
+		}
+	}
+	if dir == "" {
+		log.Fatal("Usage: go run main.go workspace add <directory> [--name=<name>] [options]")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		log.Fatalf("Invalid directory %q: %v", dir, err)
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		log.Fatalf("%s is not a directory", dir)
+	}
+	if name == "" {
+		name = filepath.Base(abs)
+	}
+
+	workspace, err := storage.LoadWorkspace(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to read workspace: %v", err)
+	}
+	if existing, ok := workspace.Find(name); ok && existing.Dir != abs {
+		log.Fatalf("Repository name %q is already used for %s; choose another with --name", name, existing.Dir)
+	}
+
+	options := parseIndexOptions(args)
+	options.Repo = name
+	ctx := withProgress(commandCtx)
+	files, err := discoverFiles(ctx, abs, options.Git)
+	if err != nil {
+		log.Fatalf("Error scanning directory: %v", err)
+	}
+	if len(files) == 0 {
+		log.Fatal("No code files found in the specified directory")
+	}
+	if options, err = options.withCommit(abs); err != nil {
+		log.Fatalf("Error reading git metadata: %v", err)
+	}
+	options.Root = abs
+
+	store := openStore()
+	unlock, err := store.Lock()
+	if err != nil {
+		log.Fatalf("Failed to add repository: %v", err)
+	}
+	defer unlock()
+	chunks, err := store.Load()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Failed to load index %s: %v", settings.IndexFile, err)
+	}
+	kept, replaced := storage.FilterByRepo(chunks, name)
+	slog.Info("Indexing workspace repository", "repo", name, "files", len(files), "replaced_chunks", replaced)
+
+	writer, err := store.NewWriter()
+	if err != nil {
+		log.Fatalf("Failed to start writing the index: %v", err)
+	}
+	defer writer.Close()
+	if err := writeChunks(writer, kept); err != nil {
+		log.Fatalf("Failed to write the index: %v", err)
+	}
+	chunkCount, processingErrors := processFiles(ctx, files, options, writer)
+	reportProcessingErrors(processingErrors)
+	if chunkCount == 0 {
+		log.Fatal("No code chunks were processed successfully")
+	}
+	if err := commitIndex(ctx, writer); err != nil {
+		log.Fatalf("Failed to save embeddings: %v", err)
+	}
+	logStageTimings(ctx)
+
+	workspace.Put(storage.WorkspaceRepo{Name: name, Dir: abs})
+	if err := storage.SaveWorkspace(settings.IndexFile, workspace); err != nil {
+		log.Fatalf("Failed to save workspace: %v", err)
+	}
+	// The index no longer comes from the single source its metadata names
+	os.Remove(storage.MetadataPath(settings.IndexFile))
+
+	report := struct {
+		WorkspaceRepoStats
+		Errors []string `json:"errors"`
+	}{WorkspaceRepoStats{Name: name, Dir: abs, Files: len(files), Chunks: chunkCount}, []string{}}
+	for _, err := range processingErrors {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	if settings.JSONOutput {
+		printJSON(report)
+		return
+	}
+	fmt.Printf("Indexed %d files of %s as %q (%d chunks)\n", len(files), abs, name, chunkCount)
+}
+
+// workspaceRemove drops a repository and its chunks from the workspace
+func workspaceRemove(args []string) {
+	var name string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") && name == "" {
+			name = arg
+		}
+	}
+	if name == "" {
+		log.Fatal("Usage: go run main.go workspace remove <name>")
+	}
+
+	workspace, err := storage.LoadWorkspace(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to read workspace: %v", err)
+	}
+	if !workspace.Remove(name) {
+		log.Fatalf("No repository named %q in the workspace", name)
+	}
+
+	removed, err := openStore().DeleteByRepo(name)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Failed to remove from index %s: %v", settings.IndexFile, err)
+	}
+	if err := storage.SaveWorkspace(settings.IndexFile, workspace); err != nil {
+		log.Fatalf("Failed to save workspace: %v", err)
+	}
+
+	if settings.JSONOutput {
+		printJSON(struct {
+			Name          string `json:"name"`
+			RemovedChunks int    `json:"removed_chunks"`
+		}{name, removed})
+		return
+	}
+	fmt.Printf("Removed %q and its %d chunks from the workspace\n", name, removed)
+}
+
+// workspaceList prints the workspace repositories with their files and
+// chunks in the index
+func workspaceList() {
+	workspace, err := storage.LoadWorkspace(settings.IndexFile)
+	if err != nil {
+		log.Fatalf("Failed to read workspace: %v", err)
+	}
+	chunks, err := storage.LoadFromJSON(settings.IndexFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Failed to load index %s: %v", settings.IndexFile, err)
+	}
+
+	repos := []WorkspaceRepoStats{}
+	for _, repo := range workspace.Repos {
+		stats := WorkspaceRepoStats{Name: repo.Name, Dir: repo.Dir}
+		files := make(map[string]bool)
+		for _, chunk := range chunks {
+			if chunk.Repo == repo.Name {
+				stats.Chunks++
+				files[chunk.File] = true
+			}
+		}
+		stats.Files = len(files)
+		repos = append(repos, stats)
+	}
+
+	if settings.JSONOutput {
+		printJSON(struct {
+			Repos []WorkspaceRepoStats `json:"repos"`
+		}{repos})
+		return
+	}
+	if len(repos) == 0 {
+		fmt.Println("The workspace is empty; add a repository with 'workspace add <directory>'.")
+		return
+	}
+	fmt.Printf("Workspace of %s:\n", settings.IndexFile)
+	for _, repo := range repos {
+		fmt.Printf("  %-20s %6d files  %7d chunks  %s\n", repo.Name, repo.Files, repo.Chunks, repo.Dir)
+	}
+}
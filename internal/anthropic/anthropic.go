@@ -0,0 +1,130 @@
+// Package anthropic generates chat completions with Anthropic's Claude
+// models through the Messages API, using the key in ANTHROPIC_API_KEY or
+// rotating through those in ANTHROPIC_API_KEYS
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/exolottl/codie/internal/apikeys"
+	"github.com/exolottl/codie/internal/httpclient"
+)
+
+// Endpoint of the Messages API, and the API version requests are made against
+const (
+	messagesURL = "https://api.anthropic.com/v1/messages"
+	apiVersion  = "2023-06-01"
+)
+
+// Highest temperature Claude accepts
+const maxTemperature = 1
+
+// Status Anthropic returns when its API is overloaded
+const statusOverloaded = 529
+
+// Keys requests rotate through
+var keys = apikeys.NewRotation("ANTHROPIC_API_KEY")
+
+// Generate asks a Claude model for a reply to a system and user prompt. It
+// returns the reply and the prompt and reply tokens.
+func Generate(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (reply string, promptTokens, replyTokens int, err error) {
+	if len(apikeys.Get("ANTHROPIC_API_KEY")) == 0 {
+		return "", 0, 0, fmt.Errorf("ANTHROPIC_API_KEY is not set")
+	}
+	err = keys.Do(func(apiKey string) error {
+		reply, promptTokens, replyTokens, err = generate(ctx, apiKey, model, systemPrompt, prompt, maxTokens, temperature)
+		return err
+	})
+	return reply, promptTokens, replyTokens, err
+}
+
+// generate makes one Messages API request with an API key
+func generate(ctx context.Context, apiKey, model, systemPrompt, prompt string, maxTokens int, temperature float32) (string, int, int, error) {
+
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	body, err := json.Marshal(struct {
+		Model       string    `json:"model"`
+		System      string    `json:"system,omitempty"`
+		Messages    []message `json:"messages"`
+		MaxTokens   int       `json:"max_tokens"`
+		Temperature float32   `json:"temperature"`
+	}{
+		Model:       model,
+		System:      systemPrompt,
+		Messages:    []message{{Role: "user", Content: prompt}},
+		MaxTokens:   maxTokens,
+		Temperature: min(temperature, maxTemperature),
+	})
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, messagesURL, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", apiVersion)
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := httpclient.New().Do(req)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	var reply struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StopReason string `json:"stop_reason"`
+		Usage      struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil && resp.StatusCode < 300 {
+		return "", 0, 0, fmt.Errorf("failed to parse Anthropic response: %v", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == statusOverloaded:
+		return "", 0, 0, fmt.Errorf("anthropic rate limit exceeded: %s", reply.Error.Message)
+	case resp.StatusCode >= 300:
+		message := reply.Error.Message
+		if message == "" {
+			message = strings.TrimSpace(string(data))
+		}
+		return "", 0, 0, fmt.Errorf("anthropic returned %s: %s", resp.Status, message)
+	}
+
+	var sb strings.Builder
+	for _, block := range reply.Content {
+		if block.Type == "text" {
+			sb.WriteString(block.Text)
+		}
+	}
+	if sb.Len() == 0 {
+		return "", reply.Usage.InputTokens, reply.Usage.OutputTokens, fmt.Errorf("empty response from Anthropic (stop reason %s)", reply.StopReason)
+	}
+	return sb.String(), reply.Usage.InputTokens, reply.Usage.OutputTokens, nil
+}
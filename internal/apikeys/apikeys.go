@@ -0,0 +1,91 @@
+// Package apikeys reads a provider's API keys and classifies the errors that
+// call for moving on to another key or provider. Several keys can be given
+// in priority order, comma-separated in a variable named after the usual one
+// with an S appended, such as OPENAI_API_KEYS.
+package apikeys
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Get returns the keys in variable+"S", in order, or the single key in
+// variable when that isn't set
+func Get(variable string) []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv(variable+"S"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		if key := strings.TrimSpace(os.Getenv(variable)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// IsAuthError reports whether err is a provider rejecting the key or
+// credentials a request was made with
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, marker := range []string{"401", "403", "unauthorized", "invalid_api_key", "invalid api key", "invalid x-api-key", "authentication", "permission denied"} {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRateLimit reports whether err is a provider throttling requests or
+// reporting an exhausted quota
+func IsRateLimit(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, marker := range []string{"rate limit", "rate_limit", "429", "quota", "throttl", "overloaded"} {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rotation tries the keys in a variable in turn, starting from the last one
+// that worked, so requests stop going to a key once it fails
+type Rotation struct {
+	variable string
+	current  atomic.Int64
+}
+
+// NewRotation returns a Rotation through the keys read by Get(variable)
+func NewRotation(variable string) *Rotation {
+	return &Rotation{variable: variable}
+}
+
+// Do calls request with each key until it succeeds or fails with an error
+// other than a rejected key or a rate limit, and returns its last error.
+// Without keys, request is called once with an empty key.
+func (r *Rotation) Do(request func(key string) error) error {
+	keys := Get(r.variable)
+	if len(keys) == 0 {
+		return request("")
+	}
+
+	start := int(r.current.Load())
+	var err error
+	for i := range keys {
+		index := (start + i) % len(keys)
+		if err = request(keys[index]); err == nil || (!IsAuthError(err) && !IsRateLimit(err)) {
+			r.current.Store(int64(index))
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+// Package archive reads and writes portable index archives: a zstd-compressed
+// stream of JSON lines holding a manifest followed by one chunk per line.
+// Chunk paths are stored relative to the indexed root so an archive built on
+// one machine can be imported into a checkout anywhere else.
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/klauspost/compress/zstd"
+)
+
+// FormatVersion is the archive format written by Write. Read rejects archives
+// of newer versions.
+const FormatVersion = 1
+
+// Maximum length of one line of an archive; chunks are at most a few hundred KB
+const maxLineSize = 64 << 20
+
+// Manifest describes the index in an archive
+type Manifest struct {
+	Version        int       `json:"version"`
+	CreatedAt      time.Time `json:"created_at"`
+	Files          int       `json:"files"`
+	Chunks         int       `json:"chunks"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Dimensions     int       `json:"dimensions"`
+	Fingerprint    string    `json:"fingerprint"` // Hash of the settings that shaped the index
+	Settings       Settings  `json:"settings"`
+	GitCommit      string    `json:"git_commit,omitempty"` // HEAD of the indexed repository, if any
+}
+
+// Settings are the indexing settings recorded in a manifest
+type Settings struct {
+	Provider     string   `json:"provider"`
+	MaxChunkSize int      `json:"max_chunk_size"`
+	ChunkOverlap int      `json:"chunk_overlap"`
+	Ignore       []string `json:"ignore,omitempty"`
+}
+
+// Write compresses the manifest and chunks to w, storing each chunk's file
+// relative to root. The manifest's version and counts are filled in.
+func Write(w io.Writer, manifest Manifest, chunks []storage.CodeChunk, root string) error {
+	manifest.Version = FormatVersion
+	manifest.Chunks = len(chunks)
+	files := make(map[string]bool)
+	for _, chunk := range chunks {
+		files[chunk.File] = true
+		if manifest.Dimensions == 0 {
+			manifest.Dimensions = len(chunk.Embedding)
+		}
+	}
+	manifest.Files = len(files)
+
+	encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return err
+	}
+
+	lines := json.NewEncoder(encoder)
+	if err := lines.Encode(manifest); err != nil {
+		encoder.Close()
+		return err
+	}
+	for _, chunk := range chunks {
+		rel, err := filepath.Rel(root, chunk.File)
+		if err != nil {
+			encoder.Close()
+			return fmt.Errorf("file %s is not under %s: %w", chunk.File, root, err)
+		}
+		chunk.File = filepath.ToSlash(rel)
+		if err := lines.Encode(chunk); err != nil {
+			encoder.Close()
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+// Read decompresses an archive, returning its manifest and chunks with their
+// files joined onto root
+func Read(r io.Reader, root string) (Manifest, []storage.CodeChunk, error) {
+	var manifest Manifest
+
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return manifest, nil, err
+	}
+	defer decoder.Close()
+
+	scanner := bufio.NewScanner(decoder)
+	scanner.Buffer(make([]byte, 0, 1<<20), maxLineSize)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return manifest, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return manifest, nil, errors.New("archive is empty")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &manifest); err != nil {
+		return manifest, nil, fmt.Errorf("invalid archive manifest: %w", err)
+	}
+	if manifest.Version < 1 || manifest.Version > FormatVersion {
+		return manifest, nil, fmt.Errorf("unsupported archive version %d (this codie reads up to %d)", manifest.Version, FormatVersion)
+	}
+
+	chunks := make([]storage.CodeChunk, 0, manifest.Chunks)
+	for scanner.Scan() {
+		var chunk storage.CodeChunk
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return manifest, nil, fmt.Errorf("invalid chunk %d in archive: %w", len(chunks)+1, err)
+		}
+		chunk.File = filepath.Join(root, filepath.FromSlash(chunk.File))
+		chunks = append(chunks, chunk)
+	}
+	if err := scanner.Err(); err != nil {
+		return manifest, nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	if len(chunks) != manifest.Chunks {
+		return manifest, nil, fmt.Errorf("archive is truncated: expected %d chunks, found %d", manifest.Chunks, len(chunks))
+	}
+
+	return manifest, chunks, nil
+}
@@ -0,0 +1,205 @@
+// Package bedrock calls Amazon Bedrock for embeddings, with Amazon Titan or
+// Cohere models, and chat completions through the Converse API, with Claude
+// or any other chat model. Credentials and the region come from the standard
+// AWS chain: environment variables, shared config and SSO profiles, and
+// instance or task roles.
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/exolottl/codie/internal/httpclient"
+)
+
+// Most characters Titan embeds; longer texts are cut
+const titanMaxChars = 50000
+
+// Most texts Cohere embeds in one request, and the characters of each it reads
+const (
+	cohereMaxTexts = 96
+	cohereMaxChars = 2048
+)
+
+// Region is the AWS region requests go to; empty uses AWS_REGION or the
+// region of the AWS profile
+var Region = ""
+
+var (
+	mu     sync.Mutex
+	client *bedrockruntime.Client
+)
+
+// Credentials loads the AWS configuration and credentials, so missing ones
+// are reported before any work is done
+func Credentials(ctx context.Context) error {
+	_, err := runtimeClient(ctx)
+	return err
+}
+
+// runtimeClient returns a cached Bedrock runtime client
+func runtimeClient(ctx context.Context) (*bedrockruntime.Client, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	options := []func(*config.LoadOptions) error{config.WithHTTPClient(httpclient.New())}
+	if Region != "" {
+		options = append(options, config.WithRegion(Region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("no AWS region set; set bedrock_region or AWS_REGION")
+	}
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("no AWS credentials found (set AWS_PROFILE or AWS_ACCESS_KEY_ID, or run aws sso login): %v", err)
+	}
+	client = bedrockruntime.NewFromConfig(cfg)
+	return client, nil
+}
+
+// Embed embeds texts with a Titan or Cohere embedding model. Cohere models
+// embed documents and search queries differently, and are told which the
+// texts are with inputType, search_document or search_query. It returns the
+// vectors in the order of the texts and the tokens read.
+func Embed(ctx context.Context, model string, texts []string, inputType string) ([][]float32, int, error) {
+	c, err := runtimeClient(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if strings.HasPrefix(model, "cohere.") {
+		return embedCohere(ctx, c, model, texts, inputType)
+	}
+
+	// Titan embeds one text per request
+	vectors := make([][]float32, len(texts))
+	tokens := 0
+	for i, text := range texts {
+		if len(text) > titanMaxChars {
+			text = text[:titanMaxChars]
+		}
+		var reply struct {
+			Embedding           []float32 `json:"embedding"`
+			InputTextTokenCount int       `json:"inputTextTokenCount"`
+		}
+		if err := invoke(ctx, c, model, map[string]any{"inputText": text}, &reply); err != nil {
+			return nil, tokens, err
+		}
+		vectors[i] = reply.Embedding
+		tokens += reply.InputTextTokenCount
+	}
+	return vectors, tokens, nil
+}
+
+// embedCohere embeds texts with a Cohere model in requests of up to cohereMaxTexts
+func embedCohere(ctx context.Context, c *bedrockruntime.Client, model string, texts []string, inputType string) ([][]float32, int, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += cohereMaxTexts {
+		batch := texts[start:min(start+cohereMaxTexts, len(texts))]
+		var reply struct {
+			Embeddings [][]float32 `json:"embeddings"`
+		}
+		request := map[string]any{"texts": batch, "input_type": inputType, "truncate": "END"}
+		if err := invoke(ctx, c, model, request, &reply); err != nil {
+			return nil, 0, err
+		}
+		if len(reply.Embeddings) != len(batch) {
+			return nil, 0, fmt.Errorf("bedrock returned %d embeddings for %d texts", len(reply.Embeddings), len(batch))
+		}
+		vectors = append(vectors, reply.Embeddings...)
+	}
+
+	// Cohere on Bedrock doesn't report tokens; estimate them from the characters read
+	tokens := 0
+	for _, text := range texts {
+		tokens += (min(len(text), cohereMaxChars) + 3) / 4
+	}
+	return vectors, tokens, nil
+}
+
+// invoke calls a model with a JSON request body and decodes its JSON reply
+func invoke(ctx context.Context, c *bedrockruntime.Client, model string, request, reply any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := c.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(model),
+		Body:        body,
+		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	if err := json.Unmarshal(resp.Body, reply); err != nil {
+		return fmt.Errorf("failed to parse Bedrock response: %v", err)
+	}
+	return nil
+}
+
+// Generate asks a chat model, such as Claude, for a reply to a system and
+// user prompt. It returns the reply and the prompt and reply tokens.
+func Generate(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (string, int, int, error) {
+	c, err := runtimeClient(ctx)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	resp, err := c.Converse(ctx, &bedrockruntime.ConverseInput{
+		ModelId: aws.String(model),
+		System:  []types.SystemContentBlock{&types.SystemContentBlockMemberText{Value: systemPrompt}},
+		Messages: []types.Message{{
+			Role:    types.ConversationRoleUser,
+			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: prompt}},
+		}},
+		InferenceConfig: &types.InferenceConfiguration{
+			MaxTokens:   aws.Int32(int32(maxTokens)),
+			Temperature: aws.Float32(temperature),
+		},
+	})
+	if err != nil {
+		return "", 0, 0, wrapError(err)
+	}
+
+	promptTokens, completionTokens := 0, 0
+	if resp.Usage != nil {
+		promptTokens = int(aws.ToInt32(resp.Usage.InputTokens))
+		completionTokens = int(aws.ToInt32(resp.Usage.OutputTokens))
+	}
+
+	var sb strings.Builder
+	if message, ok := resp.Output.(*types.ConverseOutputMemberMessage); ok {
+		for _, block := range message.Value.Content {
+			if text, ok := block.(*types.ContentBlockMemberText); ok {
+				sb.WriteString(text.Value)
+			}
+		}
+	}
+	if sb.Len() == 0 {
+		return "", promptTokens, completionTokens, fmt.Errorf("empty response from Bedrock (stop reason %s)", resp.StopReason)
+	}
+	return sb.String(), promptTokens, completionTokens, nil
+}
+
+// wrapError marks throttling errors so callers back off longer
+func wrapError(err error) error {
+	var throttling *types.ThrottlingException
+	if errors.As(err, &throttling) {
+		return fmt.Errorf("bedrock rate limit exceeded: %w", err)
+	}
+	return err
+}
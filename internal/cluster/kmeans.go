@@ -0,0 +1,198 @@
+// Package cluster groups embedding vectors by topic with spherical k-means,
+// which clusters by cosine similarity like codie's search does.
+package cluster
+
+import (
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+)
+
+// Maximum number of k-means iterations; clustering usually converges sooner
+const maxIterations = 50
+
+// Result is a clustering of vectors
+type Result struct {
+	Assignments []int       // Cluster of each vector, or -1 for vectors that couldn't be clustered
+	Centroids   [][]float32 // Unit-length center of each cluster
+	Similarity  []float32   // Cosine similarity of each vector to its cluster's centroid
+}
+
+// KMeans partitions vectors into k clusters of similar direction. Vectors
+// with no length or different dimensions than the first are left
+// unassigned. Clustering is deterministic for a given seed.
+func KMeans(vectors [][]float32, k int, seed uint64) Result {
+	result := Result{
+		Assignments: make([]int, len(vectors)),
+		Similarity:  make([]float32, len(vectors)),
+	}
+	for i := range result.Assignments {
+		result.Assignments[i] = -1
+	}
+
+	// Only vectors of the common dimensions with a length are clustered
+	var dims int
+	norms := make([]float32, len(vectors))
+	var valid []int
+	for i, v := range vectors {
+		if dims == 0 {
+			dims = len(v)
+		}
+		if len(v) != dims || dims == 0 {
+			continue
+		}
+		if norms[i] = norm(v); norms[i] > 0 {
+			valid = append(valid, i)
+		}
+	}
+	k = min(k, len(valid))
+	if k <= 0 {
+		return result
+	}
+
+	random := rand.New(rand.NewPCG(seed, uint64(len(valid))))
+	centroids := initCentroids(vectors, norms, valid, k, random)
+
+	for range maxIterations {
+		changed := assign(vectors, norms, valid, centroids, &result)
+		centroids = recenter(vectors, norms, valid, result.Assignments, centroids)
+		if !changed {
+			break
+		}
+	}
+	assign(vectors, norms, valid, centroids, &result)
+	result.Centroids = centroids
+	return result
+}
+
+// initCentroids picks k starting centroids with k-means++: each is drawn
+// with probability proportional to its squared distance from the closest
+// centroid already picked, which spreads them across the data
+func initCentroids(vectors [][]float32, norms []float32, valid []int, k int, random *rand.Rand) [][]float32 {
+	centroids := [][]float32{unit(vectors[valid[random.IntN(len(valid))]])}
+	closest := make([]float64, len(valid))
+	for i := range closest {
+		closest[i] = math.Inf(1)
+	}
+
+	for len(centroids) < k {
+		last := centroids[len(centroids)-1]
+		total := 0.0
+		for i, v := range valid {
+			dist := 1 - float64(dot(vectors[v], last)/norms[v])
+			closest[i] = min(closest[i], dist*dist)
+			total += closest[i]
+		}
+
+		// All remaining vectors coincide with a centroid
+		if total == 0 {
+			break
+		}
+		target := random.Float64() * total
+		pick := len(valid) - 1
+		for i, d := range closest {
+			if target -= d; target <= 0 {
+				pick = i
+				break
+			}
+		}
+		centroids = append(centroids, unit(vectors[valid[pick]]))
+	}
+	return centroids
+}
+
+// assign moves each vector to the cluster of its most similar centroid,
+// reporting whether any vector moved
+func assign(vectors [][]float32, norms []float32, valid []int, centroids [][]float32, result *Result) bool {
+	var changed bool
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	shard := (len(valid) + runtime.NumCPU() - 1) / runtime.NumCPU()
+	for start := 0; start < len(valid); start += shard {
+		wg.Add(1)
+		go func(part []int) {
+			defer wg.Done()
+			moved := false
+			for _, v := range part {
+				best, bestSim := 0, float32(math.Inf(-1))
+				for c, centroid := range centroids {
+					if sim := dot(vectors[v], centroid) / norms[v]; sim > bestSim {
+						best, bestSim = c, sim
+					}
+				}
+				if result.Assignments[v] != best {
+					result.Assignments[v] = best
+					moved = true
+				}
+				result.Similarity[v] = bestSim
+			}
+			if moved {
+				mu.Lock()
+				changed = true
+				mu.Unlock()
+			}
+		}(valid[start:min(start+shard, len(valid))])
+	}
+	wg.Wait()
+	return changed
+}
+
+// recenter moves each centroid to the normalized mean direction of its
+// vectors. A cluster left empty keeps its centroid.
+func recenter(vectors [][]float32, norms []float32, valid []int, assignments []int, centroids [][]float32) [][]float32 {
+	sums := make([][]float64, len(centroids))
+	for c := range sums {
+		sums[c] = make([]float64, len(centroids[c]))
+	}
+	counts := make([]int, len(centroids))
+	for _, v := range valid {
+		c := assignments[v]
+		counts[c]++
+		for j, x := range vectors[v] {
+			sums[c][j] += float64(x / norms[v])
+		}
+	}
+
+	next := make([][]float32, len(centroids))
+	for c, sum := range sums {
+		if counts[c] == 0 {
+			next[c] = centroids[c]
+			continue
+		}
+		centroid := make([]float32, len(sum))
+		for j, x := range sum {
+			centroid[j] = float32(x)
+		}
+		next[c] = unit(centroid)
+	}
+	return next
+}
+
+// unit returns a copy of v scaled to length 1, or of v itself if it has no
+// length
+func unit(v []float32) []float32 {
+	n := norm(v)
+	if n == 0 {
+		n = 1
+	}
+	u := make([]float32, len(v))
+	for i, x := range v {
+		u[i] = x / n
+	}
+	return u
+}
+
+// dot returns the dot product of two vectors of the same length
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// norm returns the Euclidean length of a vector
+func norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dot(v, v))))
+}
@@ -4,23 +4,68 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/exolottl/codie/internal/apikeys"
+	"github.com/exolottl/codie/internal/bedrock"
+	"github.com/exolottl/codie/internal/httpclient"
+	"github.com/exolottl/codie/internal/local"
+	"github.com/exolottl/codie/internal/vertex"
 	"github.com/joho/godotenv"
 	"github.com/sashabaranov/go-openai"
 )
 
 // Init initializes the application configuration
-// It loads environment variables and ensures the OpenAI API key is set and valid
-func Init() error {
-	// Load environment variables if .env file exists
-	envFileExists := true
-	err := godotenv.Load()
-	if err != nil {
-		envFileExists = false
-		fmt.Println("No .env file found.")
+// It ensures a valid OpenAI API key is available, taken from OPENAI_API_KEY
+// (the environment or an existing .env file), then the OS keychain, and
+// otherwise prompting for one and saving it to the keychain. With embeddings
+// from another provider, its key must be set instead, and the OpenAI key is
+// only needed when the command uses an OpenAI chat model. Vertex AI needs
+// Google Cloud Application Default Credentials, and Bedrock AWS credentials.
+// No key is required of OpenAI-compatible servers set with base_url, and
+// local embeddings only need the model's files.
+func Init(s Settings, chat bool) error {
+	loadDotEnv()
+
+	embeddingProvider := s.EmbeddingProviderName()
+	chatProvider := s.ChatProviderName()
+	if embeddingProvider == "cohere" && len(apikeys.Get("COHERE_API_KEY")) == 0 {
+		return fmt.Errorf("COHERE_API_KEY is not set; it is needed for Cohere embeddings")
+	}
+	if chat && chatProvider == "anthropic" && len(apikeys.Get("ANTHROPIC_API_KEY")) == 0 {
+		return fmt.Errorf("ANTHROPIC_API_KEY is not set; it is needed for Claude")
+	}
+	if embeddingProvider == "vertex" || (chat && chatProvider == "vertex") {
+		if err := vertex.Credentials(context.Background()); err != nil {
+			return err
+		}
+	}
+	if embeddingProvider == "bedrock" || (chat && chatProvider == "bedrock") {
+		if err := bedrock.Credentials(context.Background()); err != nil {
+			return err
+		}
+	}
+	if embeddingProvider == "local" {
+		if err := local.Check(); err != nil {
+			return err
+		}
+	}
+	// OpenAI-compatible servers set with base_url may not need a key at all,
+	// and can't validate one the way OpenAI does
+	openaiEmbeddings := embeddingProvider == "openai" && s.EmbeddingBaseURL == ""
+	openaiChat := chat && chatProvider == "openai" && s.BaseURL == ""
+	if !openaiEmbeddings && !openaiChat {
+		return nil
+	}
+
+	// Several keys are rotated through as each is rejected, so aren't
+	// validated up front
+	if os.Getenv("OPENAI_API_KEYS") != "" {
+		return nil
 	}
 
 	// Check if OPENAI_API_KEY is already set in environment
@@ -29,18 +74,56 @@ func Init() error {
 	// If key is present, validate it first before proceeding
 	if apiKey != "" {
 		if err := validateAPIKey(apiKey); err != nil {
-			fmt.Printf("Existing API key is invalid: %v\n", err)
-			// Clear the invalid key from environment
-			apiKey = ""
+			slog.Warn("Existing API key is invalid", "error", err)
+		} else {
+			slog.Debug("Existing OpenAI API key validated")
+			return nil
+		}
+	}
+	
+	// Fall back to the key stored by 'codie auth login'
+	storedKey, err := loadKeyringAPIKey()
+	if err != nil {
+		slog.Warn("Could not read the OS keychain", "error", err)
+	} else if storedKey != "" {
+		if err := validateAPIKey(storedKey); err != nil {
+			slog.Warn("API key in the OS keychain is invalid", "error", err)
 		} else {
-			fmt.Println("Existing OpenAI API key validated successfully.")
+			os.Setenv("OPENAI_API_KEY", storedKey)
 			return nil
 		}
 	}
 	
 	// If we reach here, we need a new API key from user
+	validKey, err := obtainValidAPIKey()
+	if err != nil {
+		return err
+	}
+	
+	// Set the API key in the current environment
+	os.Setenv("OPENAI_API_KEY", validKey)
+	
+	// Save it to the OS keychain so later runs don't prompt again
+	if err := storeKeyringAPIKey(validKey); err != nil {
+		slog.Warn("Could not save the API key to the OS keychain; set OPENAI_API_KEY to avoid being prompted next time", "error", err)
+	} else {
+		slog.Info("API key saved to the OS keychain")
+	}
+	
+	return nil
+}
+
+// loadDotEnv loads environment variables from a .env file in the data
+// directory or the current directory, if there is one. Variables already set
+// take precedence.
+func loadDotEnv() {
+	godotenv.Load(filepath.Join(DataDir(), ".env"))
+	godotenv.Load()
+}
+
+// obtainValidAPIKey prompts for an OpenAI API key until a valid one is entered
+func obtainValidAPIKey() (string, error) {
 	fmt.Println("Please provide a valid OpenAI API key.")
-	var validKey string
 	maxAttempts := 3
 	
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
@@ -50,7 +133,7 @@ func Init() error {
 		
 		newKey, err := promptForAPIKey()
 		if err != nil {
-			return fmt.Errorf("failed to get API key: %v", err)
+			return "", fmt.Errorf("failed to get API key: %v", err)
 		}
 		
 		// Validate the new key before saving
@@ -59,54 +142,30 @@ func Init() error {
 			continue
 		}
 		
-		// If we reach here, the key is valid
-		validKey = newKey
-		break
-	}
-	
-	// Check if we got a valid key after attempts
-	if validKey == "" {
-		return fmt.Errorf("failed to obtain a valid OpenAI API key after %d attempts", maxAttempts)
+		fmt.Println("API key validated successfully.")
+		return newKey, nil
 	}
 	
-	// At this point we have a validated key - now save it to .env and environment
-	fmt.Println("API key validated successfully.")
-	
-	// Set the API key in the current environment
-	os.Setenv("OPENAI_API_KEY", validKey)
-	
-	// Now save to .env file
-	if !envFileExists {
-		err = createEnvFile(validKey)
-		if err != nil {
-			return fmt.Errorf("failed to create .env file: %v", err)
-		}
-	} else {
-		// Update existing .env file
-		err = updateEnvFile("OPENAI_API_KEY", validKey)
-		if err != nil {
-			return fmt.Errorf("failed to update API key in .env file: %v", err)
-		}
-	}
-	
-	return nil
+	return "", fmt.Errorf("failed to obtain a valid OpenAI API key after %d attempts", maxAttempts)
 }
 
 // validateAPIKey checks if the provided API key is valid by making a small test request
 func validateAPIKey(apiKey string) error {
 	// Verify the API key format first (basic check)
 	if !strings.HasPrefix(apiKey, "sk-") {
-		fmt.Println("Warning: OpenAI API keys typically start with 'sk-'. Proceeding with validation anyway.")
+		slog.Warn("OpenAI API keys typically start with 'sk-'; proceeding with validation anyway")
 	}
 	
-	client := openai.NewClient(apiKey)
+	clientConfig := openai.DefaultConfig(apiKey)
+	clientConfig.HTTPClient = httpclient.New()
+	client := openai.NewClientWithConfig(clientConfig)
 	
 	// Create a context with timeout to avoid hanging
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	
 	// Try to create a small embedding to validate the API key
-	fmt.Println("Validating OpenAI API key...")
+	slog.Debug("Validating OpenAI API key")
 	_, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
 		Model: openai.AdaEmbeddingV2,
 		Input: []string{"test"},
@@ -152,57 +211,3 @@ func promptForAPIKey() (string, error) {
 	
 	return apiKey, nil
 }
-
-// createEnvFile creates a new .env file with a validated API key
-func createEnvFile(validatedKey string) error {
-	file, err := os.Create(".env")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	
-	// Write the validated API key to file
-	_, err = file.WriteString(fmt.Sprintf("OPENAI_API_KEY=%s\n", validatedKey))
-	if err != nil {
-		return err
-	}
-	
-	fmt.Println("Created .env file with your validated API key.")
-	return nil
-}
-
-// updateEnvFile updates a value in the .env file or adds it if it doesn't exist
-func updateEnvFile(key, value string) error {
-	// Try to read existing .env file
-	content, err := os.ReadFile(".env")
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	}
-	
-	// Check if file exists
-	if os.IsNotExist(err) {
-		// If file doesn't exist, create it with the key-value pair
-		return os.WriteFile(".env", []byte(fmt.Sprintf("%s=%s\n", key, value)), 0644)
-	}
-	
-	// Convert content to string and split by lines
-	lines := strings.Split(string(content), "\n")
-	keyFound := false
-	
-	// Check if key exists and update it
-	for i, line := range lines {
-		if strings.HasPrefix(line, key+"=") {
-			lines[i] = fmt.Sprintf("%s=%s", key, value)
-			keyFound = true
-			break
-		}
-	}
-	
-	// If key wasn't found, add it
-	if !keyFound {
-		lines = append(lines, fmt.Sprintf("%s=%s", key, value))
-	}
-	
-	// Join lines and write back to file
-	return os.WriteFile(".env", []byte(strings.Join(lines, "\n")), 0644)
-}
\ No newline at end of file
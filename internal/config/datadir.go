@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ProjectDirName is the directory in a project's root that holds its index,
+// checkpoints, caches, and config
+const ProjectDirName = ".codie"
+
+// Index file written by versions that kept it in the current directory
+const legacyIndexFile = "embeddings.json"
+
+// DataDir returns the directory Codie keeps its files in: .codie in the
+// nearest directory at or above the current one that already has it or is
+// the root of a git repository, or codie under the XDG data directory when
+// run outside any project
+func DataDir() string {
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			if info, err := os.Stat(filepath.Join(dir, ProjectDirName)); err == nil && info.IsDir() {
+				return filepath.Join(dir, ProjectDirName)
+			}
+			if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+				return filepath.Join(dir, ProjectDirName)
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return GlobalDataDir()
+}
+
+// GlobalDataDir returns codie under $XDG_DATA_HOME, or under ~/.local/share
+// when it isn't set
+func GlobalDataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "codie")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "codie")
+	}
+	return ProjectDirName
+}
+
+// DefaultIndexFile returns index.json in the data directory. While there is
+// none, an embeddings.json left in the current directory by an earlier
+// version is used instead.
+func DefaultIndexFile() string {
+	indexFile := filepath.Join(DataDir(), "index.json")
+	if _, err := os.Stat(indexFile); err != nil {
+		if _, err := os.Stat(legacyIndexFile); err == nil {
+			return legacyIndexFile
+		}
+	}
+	return indexFile
+}
+
+// configFilePaths returns the config files to look for, in order: config.yaml
+// in the data directory, then .codie.yaml in the current directory
+func configFilePaths() []string {
+	dataDir := DataDir()
+	paths := []string{filepath.Join(dataDir, "config.yaml"), filepath.Join(dataDir, "config.yml")}
+	return append(paths, configFileNames...)
+}
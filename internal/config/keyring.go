@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Keyring entry the OpenAI API key is stored under
+const (
+	keyringService = "codie"
+	keyringUser    = "openai-api-key"
+)
+
+// loadKeyringAPIKey returns the API key stored in the OS keychain, or "" if none is stored
+func loadKeyringAPIKey() (string, error) {
+	key, err := keyring.Get(keyringService, keyringUser)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", nil
+	}
+	return key, err
+}
+
+// storeKeyringAPIKey saves the API key in the OS keychain
+// (macOS Keychain, Secret Service on Linux, Windows Credential Manager)
+func storeKeyringAPIKey(apiKey string) error {
+	return keyring.Set(keyringService, keyringUser, apiKey)
+}
+
+// Login prompts for an OpenAI API key, validates it, and stores it in the OS keychain
+func Login() error {
+	apiKey, err := obtainValidAPIKey()
+	if err != nil {
+		return err
+	}
+
+	if err := storeKeyringAPIKey(apiKey); err != nil {
+		return fmt.Errorf("failed to store API key in the OS keychain: %v", err)
+	}
+
+	fmt.Println("API key saved to the OS keychain.")
+	return nil
+}
+
+// Logout removes the OpenAI API key from the OS keychain
+func Logout() error {
+	err := keyring.Delete(keyringService, keyringUser)
+	if errors.Is(err, keyring.ErrNotFound) {
+		fmt.Println("No API key stored in the OS keychain.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove API key from the OS keychain: %v", err)
+	}
+
+	fmt.Println("API key removed from the OS keychain.")
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		fmt.Println("Note: OPENAI_API_KEY is still set in your environment or .env file.")
+	}
+	return nil
+}
@@ -0,0 +1,631 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/logging"
+	"github.com/exolottl/codie/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file names checked in the current directory, after config.yaml in
+// the data directory
+var configFileNames = []string{".codie.yaml", ".codie.yml"}
+
+// Settings holds the tunable options for a run. Values are layered with the
+// precedence flag > environment variable > config file > defaults.
+type Settings struct {
+	Provider              string        // Chat provider, and embeddings provider unless EmbeddingProvider is set
+	EmbeddingProvider     string        // Provider of embeddings when it isn't Provider, such as cohere
+	VertexProject         string        // Google Cloud project of Vertex AI requests (empty uses the credentials' project)
+	VertexLocation        string        // Google Cloud region of Vertex AI requests
+	BedrockRegion         string        // AWS region of Bedrock requests (empty uses AWS_REGION or the profile's region)
+	LocalModelDir         string        // Directory of the local embedding model's files (default models/<embedding_model> in the global data directory)
+	OnnxRuntimeLibrary    string        // Path of the ONNX Runtime library local models run with (empty searches the library path)
+	FallbackProviders     []string      // Chat providers tried in order when the provider rejects its key or is rate limited
+	BaseURL               string        // Base URL of an OpenAI-compatible API used instead of OpenAI's (default OPENAI_BASE_URL)
+	EmbeddingBaseURL      string        // Base URL of the OpenAI-compatible API embeddings are requested from (default BaseURL)
+	Proxy                 string        // URL of the proxy API requests go through (empty uses HTTPS_PROXY and HTTP_PROXY)
+	CABundle              string        // PEM file of root certificates API servers and proxies are trusted with, besides the system's
+	RequestTimeout        time.Duration // Longest an API request may take (0 disables)
+	EmbeddingModel        string        // Model used for embeddings
+	EmbeddingTemplate     string        // Layout of the text embedded for each chunk, with placeholders such as {path} and {content} (empty embeds the context header and content)
+	ChatModel             string        // Model used for summaries and answers
+	RerankModel           string        // Cheaper chat model used to rerank search results
+	MaxTokens             int           // Maximum tokens in a chat reply (0 uses each command's default)
+	MaxPromptTokens       int           // Tokens a summary, answer, or review prompt may take, code context included
+	Temperature           float64       // Chat sampling temperature (negative uses each command's default)
+	Store                 string        // Index storage backend
+	VectorPrecision       string        // Precision embeddings are stored at: float32, float16, or int8
+	IndexFile             string        // Path of the index file
+	MaxChunkSize          int           // Maximum characters per chunk
+	ChunkOverlap          int           // Lines repeated between consecutive chunks
+	BatchSize             int           // Most texts per embeddings request
+	BatchTokens           int           // Tokens embeddings requests are packed with, at most about (0 packs by BatchSize alone)
+	Workers               int           // Concurrent file workers (0 means NumCPU)
+	Ignore                []string      // Glob patterns of paths to skip while indexing
+	MaxFileSize           int64         // Files larger than this many bytes are skipped (0 disables)
+	MaxChunksPerFile      int           // Files splitting into more chunks are skipped (0 disables)
+	MaxTotalChunks        int           // Chunks one indexing run may embed; later files are skipped (0 disables)
+	FollowSymlinks        bool          // Follow symlinks while traversing directories (--follow-symlinks)
+	SkipVendored          bool          // Skip vendored directories such as vendor/ and third_party/
+	SkipGenerated         bool          // Skip generated files such as *.pb.go and files with a "Code generated" header
+	RequestsPerMinute     int           // Embeddings API requests per minute of each key (0 = the provider's default)
+	TokensPerMinute       int           // Embeddings API tokens per minute of each key (0 = learned from rate limit headers)
+	MaxConcurrentRequests int           // Embeddings API requests in flight
+	ChatRequestsPerMinute int           // Chat requests per minute (0 = unlimited)
+	MaxConcurrentChats    int           // Chat requests in flight, such as directory summaries written at once
+	MaxAttempts           int           // Attempts at each API request before giving up
+	Staleness             time.Duration // Refresh the index when older than this (0 disables)
+	StaleCommits          int           // Refresh the index when HEAD is this many commits past it (0 disables)
+	RecentCommits         int           // Boost files changed in this many latest commits in search and ranking (0 disables)
+	RecencyBoost          float64       // Added to the search and rank scores of recently changed files
+	LogLevel              string        // Minimum level of log messages: debug, info, warn, or error
+	LogFormat             string        // Log output format: text or json
+	EditorCommand         string        // Command template opening a file at a line, with {file} and {line} placeholders
+	NotifyWebhook         string        // Slack or Teams incoming webhook that reports are posted to
+	JSONOutput            bool          // Print command output to stdout as JSON (--json)
+	ConfigFile            string        // Config file the settings were loaded from, if any
+
+	Chunkers map[string]string // Chunker chosen by name per language, such as sql=generic
+}
+
+// DefaultSettings returns the built-in defaults
+func DefaultSettings() Settings {
+	return Settings{
+		Provider:              "openai",
+		EmbeddingModel:        "text-embedding-3-small",
+		ChatModel:             "gpt-4o",
+		RerankModel:           "gpt-4o-mini",
+		VertexLocation:        "us-central1",
+		RequestTimeout:        10 * time.Minute,
+		MaxTokens:             0,
+		MaxPromptTokens:       24000,
+		Temperature:           -1,
+		Store:                 "json",
+		VectorPrecision:       "float32",
+		IndexFile:             DefaultIndexFile(),
+		MaxChunkSize:          8000,
+		ChunkOverlap:          0,
+		BatchSize:             100,
+		BatchTokens:           50000,
+		Workers:               0,
+		MaxFileSize:           1 << 20,
+		MaxChunksPerFile:      0,
+		MaxTotalChunks:        0,
+		SkipVendored:          true,
+		SkipGenerated:         true,
+		RequestsPerMinute:     0,
+		TokensPerMinute:       0,
+		MaxConcurrentRequests: 5,
+		ChatRequestsPerMinute: 0,
+		MaxConcurrentChats:    4,
+		MaxAttempts:           3,
+		Staleness:             24 * time.Hour,
+		StaleCommits:          0,
+		RecentCommits:         0,
+		RecencyBoost:          0.1,
+		LogLevel:              "info",
+		LogFormat:             "text",
+	}
+}
+
+// settingField describes one setting by its config key. The matching
+// environment variable is CODIE_<KEY> and the flag is --<key> with dashes.
+type settingField struct {
+	key string
+	set func(s *Settings, value string) error
+}
+
+// All settings that can be configured
+var settingFields = []settingField{
+	{"provider", func(s *Settings, v string) error { s.Provider = v; return nil }},
+	{"embedding_provider", func(s *Settings, v string) error { s.EmbeddingProvider = v; return nil }},
+	{"embedding_model", func(s *Settings, v string) error { s.EmbeddingModel = v; return nil }},
+	// \n stands for a line break, for templates given as a flag or variable
+	{"embedding_template", func(s *Settings, v string) error { s.EmbeddingTemplate = strings.ReplaceAll(v, `\n`, "\n"); return nil }},
+	{"vertex_project", func(s *Settings, v string) error { s.VertexProject = v; return nil }},
+	{"vertex_location", func(s *Settings, v string) error { s.VertexLocation = v; return nil }},
+	{"bedrock_region", func(s *Settings, v string) error { s.BedrockRegion = v; return nil }},
+	{"local_model_dir", func(s *Settings, v string) error { s.LocalModelDir = v; return nil }},
+	{"onnxruntime_library", func(s *Settings, v string) error { s.OnnxRuntimeLibrary = v; return nil }},
+	{"fallback_providers", func(s *Settings, v string) error { s.FallbackProviders = splitList(v); return nil }},
+	{"base_url", func(s *Settings, v string) error { s.BaseURL = strings.TrimSuffix(v, "/"); return nil }},
+	{"embedding_base_url", func(s *Settings, v string) error { s.EmbeddingBaseURL = strings.TrimSuffix(v, "/"); return nil }},
+	{"proxy", func(s *Settings, v string) error { s.Proxy = v; return nil }},
+	{"ca_bundle", func(s *Settings, v string) error { s.CABundle = v; return nil }},
+	{"request_timeout", func(s *Settings, v string) error {
+		if v == "0" || v == "off" {
+			s.RequestTimeout = 0
+			return nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("must be a duration such as 10m, or off")
+		}
+		s.RequestTimeout = d
+		return nil
+	}},
+	{"chat_model", func(s *Settings, v string) error { s.ChatModel = v; return nil }},
+	{"model", func(s *Settings, v string) error { s.ChatModel = v; return nil }}, // Short alias for chat_model
+	{"rerank_model", func(s *Settings, v string) error { s.RerankModel = v; return nil }},
+	{"max_tokens", intSetter(func(s *Settings, n int) { s.MaxTokens = n }, 0)},
+	{"max_prompt_tokens", intSetter(func(s *Settings, n int) { s.MaxPromptTokens = n }, 1000)},
+	{"temperature", func(s *Settings, v string) error {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 2 {
+			return fmt.Errorf("must be a number between 0 and 2")
+		}
+		s.Temperature = t
+		return nil
+	}},
+	{"store", func(s *Settings, v string) error { s.Store = v; return nil }},
+	{"vector_precision", choiceSetter(func(s *Settings, v string) { s.VectorPrecision = v }, storage.VectorPrecisions)},
+	{"index_file", func(s *Settings, v string) error { s.IndexFile = v; return nil }},
+	{"max_chunk_size", intSetter(func(s *Settings, n int) { s.MaxChunkSize = n }, 1)},
+	{"chunk_overlap", intSetter(func(s *Settings, n int) { s.ChunkOverlap = n }, 0)},
+	{"batch_size", intSetter(func(s *Settings, n int) { s.BatchSize = n }, 1)},
+	{"batch_tokens", intSetter(func(s *Settings, n int) { s.BatchTokens = n }, 0)},
+	{"workers", intSetter(func(s *Settings, n int) { s.Workers = n }, 0)},
+	{"ignore", func(s *Settings, v string) error { s.Ignore = splitList(v); return nil }},
+	{"chunkers", func(s *Settings, v string) error {
+		chunkers := make(map[string]string)
+		for _, item := range splitList(v) {
+			language, name, ok := strings.Cut(item, "=")
+			if !ok || strings.TrimSpace(language) == "" || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("must be a list of language=chunker pairs, such as sql=generic")
+			}
+			chunkers[strings.ToLower(strings.TrimSpace(language))] = strings.ToLower(strings.TrimSpace(name))
+		}
+		s.Chunkers = chunkers
+		return nil
+	}},
+	{"max_file_size", func(s *Settings, v string) error {
+		n, err := parseSize(v)
+		if err != nil {
+			return err
+		}
+		s.MaxFileSize = n
+		return nil
+	}},
+	{"max_chunks_per_file", intSetter(func(s *Settings, n int) { s.MaxChunksPerFile = n }, 0)},
+	{"max_total_chunks", intSetter(func(s *Settings, n int) { s.MaxTotalChunks = n }, 0)},
+	{"follow_symlinks", boolSetter(func(s *Settings, b bool) { s.FollowSymlinks = b })},
+	{"skip_vendored", boolSetter(func(s *Settings, b bool) { s.SkipVendored = b })},
+	{"skip_generated", boolSetter(func(s *Settings, b bool) { s.SkipGenerated = b })},
+	{"requests_per_minute", intSetter(func(s *Settings, n int) { s.RequestsPerMinute = n }, 0)},
+	{"tokens_per_minute", intSetter(func(s *Settings, n int) { s.TokensPerMinute = n }, 0)},
+	{"max_concurrent_requests", intSetter(func(s *Settings, n int) { s.MaxConcurrentRequests = n }, 1)},
+	{"chat_requests_per_minute", intSetter(func(s *Settings, n int) { s.ChatRequestsPerMinute = n }, 0)},
+	{"max_concurrent_chats", intSetter(func(s *Settings, n int) { s.MaxConcurrentChats = n }, 1)},
+	{"max_attempts", intSetter(func(s *Settings, n int) { s.MaxAttempts = n }, 1)},
+	{"staleness", func(s *Settings, v string) error {
+		if v == "0" || v == "off" {
+			s.Staleness = 0
+			return nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("must be a duration such as 24h, or off")
+		}
+		s.Staleness = d
+		return nil
+	}},
+	{"stale_commits", intSetter(func(s *Settings, n int) { s.StaleCommits = n }, 0)},
+	{"recent_commits", intSetter(func(s *Settings, n int) { s.RecentCommits = n }, 0)},
+	{"recency_boost", func(s *Settings, v string) error {
+		b, err := strconv.ParseFloat(v, 64)
+		if err != nil || b < 0 || b > 1 {
+			return fmt.Errorf("must be a number between 0 and 1")
+		}
+		s.RecencyBoost = b
+		return nil
+	}},
+	{"log_level", choiceSetter(func(s *Settings, v string) { s.LogLevel = v }, logging.Levels)},
+	{"log_format", choiceSetter(func(s *Settings, v string) { s.LogFormat = v }, logging.Formats)},
+	{"editor_command", func(s *Settings, v string) error { s.EditorCommand = v; return nil }},
+	{"notify_webhook", func(s *Settings, v string) error { s.NotifyWebhook = v; return nil }},
+}
+
+// Flags without a value that set a log level
+var logLevelFlags = map[string]string{
+	"--verbose": "debug",
+	"--quiet":   "warn",
+}
+
+// Supported values for settings with a fixed set of choices
+var (
+	supportedProviders          = []string{"openai", "anthropic", "vertex", "bedrock", "local", "mock"}
+	supportedEmbeddingProviders = []string{"openai", "cohere", "vertex", "bedrock", "local", "mock"}
+	supportedStores             = []string{"json"}
+)
+
+// Chat and embedding models supported by each provider
+var (
+	supportedChatModels = map[string][]string{
+		"openai": {"gpt-4o", "gpt-4o-mini", "gpt-4-turbo", "o1", "o1-mini", "o3-mini"},
+		"anthropic": {
+			"claude-3-7-sonnet-latest", "claude-3-7-sonnet-20250219", "claude-3-5-sonnet-latest", "claude-3-5-sonnet-20241022",
+			"claude-3-5-haiku-latest", "claude-3-5-haiku-20241022", "claude-3-opus-latest", "claude-3-haiku-20240307",
+		},
+		"vertex": {"gemini-1.5-pro", "gemini-1.5-flash", "gemini-2.0-flash", "gemini-2.0-flash-lite"},
+		"bedrock": {
+			"anthropic.claude-3-5-sonnet-20241022-v2:0", "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			"anthropic.claude-3-5-haiku-20241022-v1:0", "anthropic.claude-3-haiku-20240307-v1:0",
+			"anthropic.claude-3-opus-20240229-v1:0",
+		},
+		"mock": {"mock"},
+	}
+	supportedEmbeddingModels = map[string][]string{
+		"openai":  {"text-embedding-3-small", "text-embedding-3-large", "text-embedding-ada-002"},
+		"cohere":  {"embed-english-v3.0", "embed-multilingual-v3.0", "embed-english-light-v3.0", "embed-multilingual-light-v3.0"},
+		"vertex":  {"text-embedding-004", "text-embedding-005", "text-multilingual-embedding-002"},
+		"bedrock": {"amazon.titan-embed-text-v2:0", "amazon.titan-embed-text-v1", "cohere.embed-english-v3", "cohere.embed-multilingual-v3"},
+		"local":   {"all-MiniLM-L6-v2", "all-MiniLM-L12-v2", "bge-small-en-v1.5"},
+		"mock":    {"mock"},
+	}
+
+	// Models of each provider used when none is configured
+	defaultEmbeddingModels = map[string]string{
+		"openai":  "text-embedding-3-small",
+		"cohere":  "embed-english-v3.0",
+		"vertex":  "text-embedding-004",
+		"bedrock": "amazon.titan-embed-text-v2:0",
+		"local":   "all-MiniLM-L6-v2",
+		"mock":    "mock",
+	}
+	defaultChatModels = map[string]string{
+		"openai":    "gpt-4o",
+		"anthropic": "claude-3-5-sonnet-latest",
+		"vertex":    "gemini-1.5-pro",
+		"bedrock":   "anthropic.claude-3-5-sonnet-20241022-v2:0",
+		"mock":      "mock",
+	}
+	defaultRerankModels = map[string]string{
+		"openai":    "gpt-4o-mini",
+		"anthropic": "claude-3-5-haiku-latest",
+		"vertex":    "gemini-1.5-flash",
+		"bedrock":   "anthropic.claude-3-haiku-20240307-v1:0",
+		"mock":      "mock",
+	}
+
+	// Prefixes of Bedrock cross-region inference profiles, which serve a
+	// model from any region of a geography
+	inferenceProfilePrefixes = []string{"us.", "eu.", "apac."}
+)
+
+// intSetter returns a setter that parses an integer no smaller than minValue
+func intSetter(assign func(s *Settings, n int), minValue int) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < minValue {
+			return fmt.Errorf("must be an integer >= %d", minValue)
+		}
+		assign(s, n)
+		return nil
+	}
+}
+
+// boolSetter returns a setter that accepts true or false
+func boolSetter(assign func(s *Settings, b bool)) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		assign(s, b)
+		return nil
+	}
+}
+
+// Multipliers of the units accepted by parseSize, longest suffix first
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses a size in bytes with an optional unit, such as 512KB or
+// 40MB; units are binary. 0 or off disables the limit.
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "OFF" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a size such as 512KB or 2MB, or off")
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// choiceSetter returns a setter that accepts one of choices
+func choiceSetter(assign func(s *Settings, value string), choices []string) func(s *Settings, value string) error {
+	return func(s *Settings, value string) error {
+		value = strings.ToLower(value)
+		if !contains(choices, value) {
+			return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+		}
+		assign(s, value)
+		return nil
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// LoadSettings layers defaults, the config file, CODIE_* environment
+// variables, and command-line flags (in increasing precedence). The config
+// file is taken from --config=<path>, CODIE_CONFIG, config.yaml in the data
+// directory, or .codie.yaml in the current directory.
+func LoadSettings(args []string) (Settings, error) {
+	settings := DefaultSettings()
+	loadDotEnv()
+
+	// Config file
+	path, explicit := os.Getenv("CODIE_CONFIG"), os.Getenv("CODIE_CONFIG") != ""
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--config=") {
+			path, explicit = strings.TrimPrefix(arg, "--config="), true
+		}
+	}
+	if !explicit {
+		for _, name := range configFilePaths() {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+	}
+	if path != "" {
+		if err := applyConfigFile(&settings, path); err != nil {
+			return settings, err
+		}
+		settings.ConfigFile = path
+	}
+
+	// Environment variables
+	for _, field := range settingFields {
+		envName := "CODIE_" + strings.ToUpper(field.key)
+		if value, ok := os.LookupEnv(envName); ok && value != "" {
+			if err := field.set(&settings, value); err != nil {
+				return settings, fmt.Errorf("invalid %s: %v", envName, err)
+			}
+		}
+	}
+
+	// Command-line flags
+	for _, arg := range args {
+		if level, ok := logLevelFlags[arg]; ok {
+			settings.LogLevel = level
+		}
+		if arg == "--json" {
+			settings.JSONOutput = true
+		}
+		if arg == "--follow-symlinks" {
+			settings.FollowSymlinks = true
+		}
+		for _, field := range settingFields {
+			prefix := "--" + strings.ReplaceAll(field.key, "_", "-") + "="
+			if strings.HasPrefix(arg, prefix) {
+				if err := field.set(&settings, strings.TrimPrefix(arg, prefix)); err != nil {
+					return settings, fmt.Errorf("invalid %s: %v", strings.TrimSuffix(prefix, "="), err)
+				}
+			}
+		}
+	}
+
+	// Embeddings come from the chat provider unless configured otherwise, and
+	// models left at their defaults follow the providers
+	if settings.EmbeddingProvider == "" {
+		settings.EmbeddingProvider = settings.EmbeddingProviderName()
+	}
+	defaults := DefaultSettings()
+	if model, ok := defaultEmbeddingModels[settings.EmbeddingProvider]; ok && settings.EmbeddingModel == defaults.EmbeddingModel {
+		settings.EmbeddingModel = model
+	}
+	if settings.LocalModelDir == "" {
+		settings.LocalModelDir = filepath.Join(GlobalDataDir(), "models", settings.EmbeddingModel)
+	}
+	if model, ok := defaultChatModels[settings.Provider]; ok && settings.ChatModel == defaults.ChatModel {
+		settings.ChatModel = model
+	}
+	if model, ok := defaultRerankModels[settings.Provider]; ok && settings.RerankModel == defaults.RerankModel {
+		settings.RerankModel = model
+	}
+
+	// OpenAI clients honor OPENAI_BASE_URL, as the official SDKs do
+	if settings.BaseURL == "" {
+		settings.BaseURL = strings.TrimSuffix(os.Getenv("OPENAI_BASE_URL"), "/")
+	}
+	if settings.EmbeddingBaseURL == "" {
+		settings.EmbeddingBaseURL = settings.BaseURL
+	}
+
+	return settings, settings.validate()
+}
+
+// applyConfigFile reads a YAML config file and applies its values
+func applyConfigFile(settings *Settings, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	for key, raw := range values {
+		field, ok := lookupSettingField(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q in %s", key, path)
+		}
+
+		// Lists are accepted in YAML form as well as comma-separated strings,
+		// and maps as comma-separated key=value pairs
+		value := fmt.Sprint(raw)
+		if list, ok := raw.([]any); ok {
+			var items []string
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			value = strings.Join(items, ",")
+		} else if pairs, ok := raw.(map[string]any); ok {
+			var items []string
+			for key, item := range pairs {
+				items = append(items, key+"="+fmt.Sprint(item))
+			}
+			sort.Strings(items)
+			value = strings.Join(items, ",")
+		}
+
+		if err := field.set(settings, value); err != nil {
+			return fmt.Errorf("invalid %s in %s: %v", key, path, err)
+		}
+	}
+
+	return nil
+}
+
+// lookupSettingField finds a setting by its config key
+func lookupSettingField(key string) (settingField, bool) {
+	for _, field := range settingFields {
+		if field.key == key {
+			return field, true
+		}
+	}
+	return settingField{}, false
+}
+
+// IndexFingerprint hashes the settings that determine an index's chunks and
+// embeddings, so indexes built with different settings can be told apart
+func (s Settings) IndexFingerprint() string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "provider=%s\nembedding_model=%s\nmax_chunk_size=%d\nchunk_overlap=%d\nignore=%s\n",
+		s.EmbeddingProviderName(), s.EmbeddingModel, s.MaxChunkSize, s.ChunkOverlap, strings.Join(s.Ignore, ","))
+	// Settings added later are written only when set, so fingerprints of
+	// indexes built before they existed don't change
+	if len(s.Chunkers) > 0 {
+		var pairs []string
+		for language, name := range s.Chunkers {
+			pairs = append(pairs, language+"="+name)
+		}
+		sort.Strings(pairs)
+		fmt.Fprintf(hash, "chunkers=%s\n", strings.Join(pairs, ","))
+	}
+	if s.EmbeddingTemplate != "" {
+		fmt.Fprintf(hash, "embedding_template=%q\n", s.EmbeddingTemplate)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// EmbeddingProviderName returns the provider embeddings are requested from:
+// EmbeddingProvider if set, otherwise Provider, or OpenAI for chat-only
+// providers such as Anthropic
+func (s Settings) EmbeddingProviderName() string {
+	if s.EmbeddingProvider != "" {
+		return s.EmbeddingProvider
+	}
+	if !contains(supportedEmbeddingProviders, s.Provider) {
+		return "openai"
+	}
+	return s.Provider
+}
+
+// DefaultChatModels returns the chat and rerank models a chat provider uses
+// when none is configured, as when it is a fallback
+func DefaultChatModels(provider string) (chatModel, rerankModel string) {
+	return defaultChatModels[provider], defaultRerankModels[provider]
+}
+
+// ChatProviderName returns the provider chat requests go to: Provider, or
+// OpenAI for embedding-only providers such as local
+func (s Settings) ChatProviderName() string {
+	if _, ok := supportedChatModels[s.Provider]; !ok {
+		return "openai"
+	}
+	return s.Provider
+}
+
+// validate checks settings with a fixed set of supported values
+func (s Settings) validate() error {
+	if !contains(supportedProviders, s.Provider) {
+		return fmt.Errorf("unsupported provider %q (supported: %s)", s.Provider, strings.Join(supportedProviders, ", "))
+	}
+	if s.EmbeddingProvider != "" && !contains(supportedEmbeddingProviders, s.EmbeddingProvider) {
+		return fmt.Errorf("unsupported embedding provider %q (supported: %s)", s.EmbeddingProvider, strings.Join(supportedEmbeddingProviders, ", "))
+	}
+	if !contains(supportedStores, s.Store) {
+		return fmt.Errorf("unsupported store %q (supported: %s)", s.Store, strings.Join(supportedStores, ", "))
+	}
+	// Models served by an OpenAI-compatible server can have any name
+	for _, provider := range s.FallbackProviders {
+		if _, ok := supportedChatModels[provider]; !ok {
+			return fmt.Errorf("unsupported fallback provider %q (must be a chat provider)", provider)
+		}
+	}
+	chatProvider := s.ChatProviderName()
+	customChat := chatProvider == "openai" && s.BaseURL != ""
+	if models := supportedChatModels[chatProvider]; !customChat && !supportsModel(models, s.ChatModel) {
+		return fmt.Errorf("unsupported chat model %q for provider %s (supported: %s)", s.ChatModel, chatProvider, strings.Join(models, ", "))
+	}
+	if models := supportedChatModels[chatProvider]; !customChat && !supportsModel(models, s.RerankModel) {
+		return fmt.Errorf("unsupported rerank model %q for provider %s (supported: %s)", s.RerankModel, chatProvider, strings.Join(models, ", "))
+	}
+	embeddingProvider := s.EmbeddingProviderName()
+	customEmbeddings := embeddingProvider == "openai" && s.EmbeddingBaseURL != ""
+	if models := supportedEmbeddingModels[embeddingProvider]; !customEmbeddings && !supportsModel(models, s.EmbeddingModel) {
+		return fmt.Errorf("unsupported embedding model %q for provider %s (supported: %s)", s.EmbeddingModel, embeddingProvider, strings.Join(models, ", "))
+	}
+	return nil
+}
+
+// supportsModel reports whether model is one of models, directly or through
+// a Bedrock inference profile
+func supportsModel(models []string, model string) bool {
+	for _, prefix := range inferenceProfilePrefixes {
+		if strings.HasPrefix(model, prefix) && contains(models, strings.TrimPrefix(model, prefix)) {
+			return true
+		}
+	}
+	return contains(models, model)
+}
+
+// contains reports whether value is in list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,5 @@
+package config
+
+// Version of codie, recorded in the indexes it writes. Release builds set it
+// with -ldflags "-X codie/internal/config.Version=v1.2.3".
+var Version = "dev"
@@ -0,0 +1,177 @@
+package diagram
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/imports"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Edge is a dependency from one package to another
+type Edge struct {
+	From string
+	To   string
+}
+
+// Graph is a package-level dependency graph. Nodes are package directories
+// relative to the index root.
+type Graph struct {
+	Nodes    []string
+	Edges    []Edge
+	Clusters map[string][]string // Optional named groups of nodes
+}
+
+// Label used for files at the index root
+const rootNode = "(root)"
+
+// Build derives the package dependency graph from the imports recorded in
+// the index. An import that resolves to a file in another package becomes an
+// edge between the two packages; external imports are ignored.
+func Build(chunks []storage.CodeChunk) Graph {
+	byFile := make(map[string][]storage.CodeChunk)
+	for _, chunk := range chunks {
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+
+	var files []string
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	root := storage.RootDir(chunks)
+	nodeOf := func(file string) string {
+		rel, err := filepath.Rel(root, filepath.Dir(file))
+		if err != nil || rel == "." {
+			return rootNode
+		}
+		return filepath.ToSlash(rel)
+	}
+
+	nodeSet := make(map[string]bool)
+	for _, file := range files {
+		nodeSet[nodeOf(file)] = true
+	}
+
+	resolver := imports.NewResolver(byFile)
+
+	edgeSet := make(map[Edge]bool)
+	for _, file := range files {
+		from := nodeOf(file)
+
+		for _, imp := range imports.ForFile(file, byFile[file]) {
+			for _, other := range resolver.Resolve(file, imp) {
+				if to := nodeOf(other); to != from {
+					edgeSet[Edge{from, to}] = true
+				}
+			}
+		}
+	}
+
+	var graph Graph
+	for node := range nodeSet {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Strings(graph.Nodes)
+
+	for edge := range edgeSet {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+
+	return graph
+}
+
+// nodeIDs assigns each node a stable identifier safe for Mermaid and DOT
+func (g Graph) nodeIDs() map[string]string {
+	ids := make(map[string]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+// sortedClusters returns the cluster names in a stable order
+func (g Graph) sortedClusters() []string {
+	var names []string
+	for name := range g.Clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Mermaid renders the graph as a Mermaid flowchart
+func (g Graph) Mermaid() string {
+	ids := g.nodeIDs()
+	var sb strings.Builder
+	sb.WriteString("graph LR\n")
+
+	// Nodes in a cluster are declared inside its subgraph
+	clustered := make(map[string]bool)
+	for i, name := range g.sortedClusters() {
+		sb.WriteString(fmt.Sprintf("    subgraph c%d[%q]\n", i, name))
+		for _, node := range g.Clusters[name] {
+			if id, ok := ids[node]; ok && !clustered[node] {
+				sb.WriteString(fmt.Sprintf("        %s[%q]\n", id, node))
+				clustered[node] = true
+			}
+		}
+		sb.WriteString("    end\n")
+	}
+
+	for _, node := range g.Nodes {
+		if !clustered[node] {
+			sb.WriteString(fmt.Sprintf("    %s[%q]\n", ids[node], node))
+		}
+	}
+
+	for _, edge := range g.Edges {
+		sb.WriteString(fmt.Sprintf("    %s --> %s\n", ids[edge.From], ids[edge.To]))
+	}
+
+	return sb.String()
+}
+
+// DOT renders the graph in Graphviz DOT format
+func (g Graph) DOT() string {
+	ids := g.nodeIDs()
+	var sb strings.Builder
+	sb.WriteString("digraph codebase {\n")
+	sb.WriteString("    rankdir=LR;\n")
+	sb.WriteString("    node [shape=box];\n")
+
+	clustered := make(map[string]bool)
+	for i, name := range g.sortedClusters() {
+		sb.WriteString(fmt.Sprintf("    subgraph cluster_%d {\n", i))
+		sb.WriteString(fmt.Sprintf("        label=%q;\n", name))
+		for _, node := range g.Clusters[name] {
+			if id, ok := ids[node]; ok && !clustered[node] {
+				sb.WriteString(fmt.Sprintf("        %s [label=%q];\n", id, node))
+				clustered[node] = true
+			}
+		}
+		sb.WriteString("    }\n")
+	}
+
+	for _, node := range g.Nodes {
+		if !clustered[node] {
+			sb.WriteString(fmt.Sprintf("    %s [label=%q];\n", ids[node], node))
+		}
+	}
+
+	for _, edge := range g.Edges {
+		sb.WriteString(fmt.Sprintf("    %s -> %s;\n", ids[edge.From], ids[edge.To]))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"os"
-	"strings"
+	"log/slog"
 	"sync"
 	"time"
 
-	"github.com/sashabaranov/go-openai"
+	"github.com/exolottl/codie/internal/metrics"
+	"github.com/exolottl/codie/internal/progress"
+	"github.com/exolottl/codie/internal/retry"
+	"github.com/exolottl/codie/internal/tracing"
+	"github.com/exolottl/codie/internal/usage"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // batchResult is used to collect results from embedding API calls
@@ -21,11 +24,33 @@ type batchResult struct {
 	Error      error
 }
 
-// GetEmbedding generates an embedding for the given text using OpenAI's API
+// BatchTokens is about the most tokens of text one embeddings request is
+// packed with, so small chunks share a request and large ones don't exceed
+// the provider's request limits; 0 packs requests by count alone
+var BatchTokens = 50000
+
+// GetEmbedding generates an embedding for the given text with the configured provider
 // This is kept for backward compatibility but uses GetBatchEmbeddings internally
 func GetEmbedding(text string) ([]float32, error) {
+	return GetEmbeddingContext(context.Background(), text)
+}
+
+// GetEmbeddingContext is GetEmbedding with a context that cancels the request
+func GetEmbeddingContext(ctx context.Context, text string) ([]float32, error) {
+	return getEmbedding(ctx, text, DocumentInput)
+}
+
+// GetQueryEmbeddingContext embeds a search query, to be compared with the
+// embeddings of indexed chunks. Providers such as Cohere embed queries
+// differently from the documents they are matched against.
+func GetQueryEmbeddingContext(ctx context.Context, query string) ([]float32, error) {
+	return getEmbedding(ctx, query, QueryInput)
+}
+
+// getEmbedding embeds one text as a document or a query
+func getEmbedding(ctx context.Context, text string, inputType InputType) ([]float32, error) {
 	// Use batch embeddings with a batch of 1
-	embeddingMap, err := GetBatchEmbeddings([]string{text}, 1)
+	embeddingMap, err := batchEmbeddings(ctx, []string{text}, 1, inputType)
 	if err != nil {
 		return nil, err
 	}
@@ -39,8 +64,26 @@ func GetEmbedding(text string) ([]float32, error) {
 
 // GetBatchEmbeddings generates embeddings for multiple texts in batch
 func GetBatchEmbeddings(texts []string, batchSize int) (map[string][]float32, error) {
+	return GetBatchEmbeddingsContext(context.Background(), texts, batchSize)
+}
+
+// GetBatchEmbeddingsContext is GetBatchEmbeddings with a context; once it is
+// canceled, no further requests or retries are made
+func GetBatchEmbeddingsContext(ctx context.Context, texts []string, batchSize int) (map[string][]float32, error) {
+	return batchEmbeddings(ctx, texts, batchSize, DocumentInput)
+}
+
+// GetBatchQueryEmbeddingsContext is GetBatchEmbeddingsContext for search
+// queries, as GetQueryEmbeddingContext is for one
+func GetBatchQueryEmbeddingsContext(ctx context.Context, queries []string, batchSize int) (map[string][]float32, error) {
+	return batchEmbeddings(ctx, queries, batchSize, QueryInput)
+}
+
+// batchEmbeddings embeds texts of one input type with the configured
+// provider, in concurrent batches
+func batchEmbeddings(ctx context.Context, texts []string, batchSize int, inputType InputType) (map[string][]float32, error) {
 	if batchSize <= 0 {
-		batchSize = 20 // Default batch size
+		batchSize = 100 // Default batch size
 	}
 	
 	// Filter out empty texts and check for length
@@ -53,7 +96,7 @@ func GetBatchEmbeddings(texts []string, batchSize int) (map[string][]float32, er
 			validTexts = append(validTexts, trimmed)
 			originalTexts = append(originalTexts, text) // Store original text
 		} else if trimmed != "" {
-			log.Printf("Warning: Text too long for embedding API, skipping (%d approximate tokens)", len(trimmed)/4)
+			slog.Debug("Text too long for embedding API, skipping", "approx_tokens", len(trimmed)/4)
 			invalidCount++
 		} else {
 			invalidCount++
@@ -65,26 +108,23 @@ func GetBatchEmbeddings(texts []string, batchSize int) (map[string][]float32, er
 	}
 	
 	if invalidCount > 0 {
-		log.Printf("Warning: Skipped %d texts due to empty content or exceeding token limit", invalidCount)
+		slog.Warn("Skipped texts that were empty or exceeded the token limit", "skipped", invalidCount)
 	}
 	
-	// Get API key
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, ErrMissingAPIKey
+	keys, err := currentKeyPool()
+	if err != nil {
+		return nil, err
 	}
-	
-	client := openai.NewClient(apiKey)
 	embeddings := make(map[string][]float32)
 	
 	// Create channels for concurrent processing
-	resultChan := make(chan batchResult, (len(validTexts)+batchSize-1)/batchSize)
+	batches := packBatches(validTexts, batchSize, BatchTokens)
+	resultChan := make(chan batchResult, len(batches))
 	var wg sync.WaitGroup
 	
 	// Process texts in batches
-	for i := 0; i < len(validTexts); i += batchSize {
-		end := min(i+batchSize, len(validTexts))
-		batch := validTexts[i:end]
+	for _, bounds := range batches {
+		i, batch := bounds[0], validTexts[bounds[0]:bounds[1]]
 		
 		wg.Add(1)
 		go func(startIdx int, textBatch []string) {
@@ -93,54 +133,52 @@ func GetBatchEmbeddings(texts []string, batchSize int) (map[string][]float32, er
 			var result batchResult
 			result.Texts = textBatch
 			result.StartIndex = startIdx
+			batchStart := time.Now()
 			
-			// Wait for rate limiter
-			apiRateLimiter.Wait()
-			defer apiRateLimiter.Release()
+			ctx, span := tracing.Start(ctx, "embedding batch",
+				attribute.String("codie.model", string(EmbeddingModel)),
+				attribute.Int("codie.texts", len(textBatch)))
+			defer func() { tracing.End(span, result.Error) }()
 			
-			// Try up to 3 times with increasing backoff
-			var resp openai.EmbeddingResponse
-			var err error
-			var success bool
+			// Retry with backoff as long as the retry policy allows. Once an API
+			// key is rejected or keeps hitting its rate limit, the next key is
+			// tried right away, without using up an attempt.
+			var vectors [][]float32
+			var tokens int
 			
-			for attempt := 1; attempt <= 3; attempt++ {
-				ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
-				resp, err = client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-					Model: openai.SmallEmbedding3,
-					Input: textBatch,
-				})
-				cancel()
-				
-				if err == nil {
-					success = true
-					break
-				}
-				
-				// Check if we need to back off due to rate limiting
-				if strings.Contains(strings.ToLower(err.Error()), "rate limit") {
-					log.Printf("Rate limit hit, backing off for attempt %d", attempt)
-					time.Sleep(time.Duration(4<<attempt) * time.Second)
-				} else if attempt < 3 {
-					// For other errors, use standard backoff
-					backoffTime := time.Duration(1<<(attempt-1)) * time.Second
-					time.Sleep(backoffTime)
+			err := retry.Default.Do(ctx, func(attempt int) error {
+				span.SetAttributes(attribute.Int("codie.attempts", attempt))
+				for rotations := 0; ; rotations++ {
+					key, err := keys.acquire(ctx, estimateTokens(textBatch))
+					if err != nil {
+						return retry.Permanent(err)
+					}
+					
+					requestCtx, cancel := context.WithTimeout(ctx, DefaultAPITimeout)
+					start := time.Now()
+					progress.Report(ctx, progress.Event{Stage: progress.Embedding, InFlight: 1})
+					vectors, tokens, err = key.client.embed(requestCtx, textBatch, inputType)
+					progress.Report(ctx, progress.Event{Stage: progress.Embedding, InFlight: -1})
+					metrics.ObserveAPIRequest("embeddings", string(EmbeddingModel), start, err)
+					cancel()
+					key.limiter.Release()
+					
+					if rotated := keys.report(key, err); err == nil || !rotated || rotations >= len(keys.keys) {
+						// Wait at least as long as the key's rate limiter is paused
+						return retry.After(err, key.limiter.pause())
+					}
 				}
-			}
-			
-			if !success {
+			})
+			if err != nil {
 				result.Error = fmt.Errorf("batch embedding failed after retries: %w", err)
 				resultChan <- result
 				return
 			}
 			
-			// Extract embeddings
-			if len(resp.Data) > 0 {
-				for _, item := range resp.Data {
-					if len(item.Embedding) > 0 {
-						result.Embeddings = append(result.Embeddings, item.Embedding)
-					}
-				}
-			}
+			usage.Record(string(EmbeddingModel), tokens, 0)
+			result.Embeddings = vectors
+			metrics.ChunksEmbedded.Add(float64(len(result.Embeddings)))
+			progress.Report(ctx, progress.Event{Stage: progress.Embedding, Items: len(vectors), Duration: time.Since(batchStart)})
 			
 			resultChan <- result
 		}(i, batch)
@@ -171,6 +209,11 @@ func GetBatchEmbeddings(texts []string, batchSize int) (map[string][]float32, er
 		}
 	}
 	
+	// A canceled request's partial results are discarded
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	
 	// Check if we got any embeddings
 	if len(embeddings) == 0 {
 		if len(errors) > 0 {
@@ -181,8 +224,49 @@ func GetBatchEmbeddings(texts []string, batchSize int) (map[string][]float32, er
 	
 	// Return partial results with a warning if some failed
 	if len(embeddings) < len(validTexts) {
-		log.Printf("Warning: Only generated %d/%d embeddings successfully", len(embeddings), len(validTexts))
+		slog.Warn("Some embeddings failed", "generated", len(embeddings), "requested", len(validTexts))
 	}
 	
 	return embeddings, nil
-}
\ No newline at end of file
+}
+
+// sleepContext waits for d or until ctx is canceled
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// estimateTokens approximates the tokens in texts, at about 4 characters per
+// token, for the rate limiter's token budget
+func estimateTokens(texts []string) int {
+	tokens := 0
+	for _, text := range texts {
+		tokens += (len(text) + 3) / 4
+	}
+	return tokens
+}
+
+// packBatches splits texts into consecutive batches of at most maxTexts
+// texts and, unless maxTokens is 0, about maxTokens tokens, returning the
+// start and end index of each. A text of more than maxTokens tokens is
+// batched alone.
+func packBatches(texts []string, maxTexts, maxTokens int) [][2]int {
+	var batches [][2]int
+	start, tokens := 0, 0
+	for i, text := range texts {
+		textTokens := estimateTokens([]string{text})
+		if i > start && (i-start >= maxTexts || (maxTokens > 0 && tokens+textTokens > maxTokens)) {
+			batches = append(batches, [2]int{start, i})
+			start, tokens = i, 0
+		}
+		tokens += textTokens
+	}
+	if start < len(texts) {
+		batches = append(batches, [2]int{start, len(texts)})
+	}
+	return batches
+}
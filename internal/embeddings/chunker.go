@@ -2,87 +2,187 @@ package embeddings
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+
+	"github.com/exolottl/codie/internal/imports"
 )
 
-// GetCodeEmbeddings generates embeddings for code with semantic chunks
-func GetCodeEmbeddings(filePath string, content string) ([]CodeEmbedding, error) {
-	// Parse the code to extract semantic chunks using Tree-sitter
-	chunks, err := extractSemanticChunksWithTreeSitter(filePath, content)
+// Default maximum characters per chunk when ChunkOptions doesn't set one
+const defaultMaxChunkSize = 8000
+
+// ChunkerVersion is recorded in the header of every index. Bump it when a
+// change to the chunkers splits the same files differently, so indexes
+// chunked the old way are rebuilt rather than mixed with new chunks.
+const ChunkerVersion = 1
+
+// ExtractCodeChunks splits a source file into semantic chunks and attaches
+// a context header (file, package, enclosing scope) to each of them. The
+// file's imports are recorded on the first chunk.
+func ExtractCodeChunks(filePath string, content string, options ChunkOptions) ([]CodeChunkMetadata, error) {
+	// Split the file with the chunker of its language
+	chunks, err := ChunkerFor(filePath).Chunk(filePath, content, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract semantic chunks: %w", err)
 	}
-	
+	if options.MaxChunks > 0 && len(chunks) > options.MaxChunks {
+		return nil, fmt.Errorf("%w: %d, more than max_chunks_per_file of %d", ErrTooManyChunks, len(chunks), options.MaxChunks)
+	}
+
+	for i := range chunks {
+		chunks[i].Context = scopeHeader(filePath, chunks[i])
+	}
+
+	if len(chunks) > 0 {
+		chunks[0].Imports = imports.Extract(filePath, content)
+	}
+
+	return chunks, nil
+}
+
+// GetCodeEmbeddings generates embeddings for code with semantic chunks
+func GetCodeEmbeddings(filePath string, content string, options ChunkOptions) ([]CodeEmbedding, error) {
+	chunks, err := ExtractCodeChunks(filePath, content, options)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create embeddings for each chunk
 	var embeddings []CodeEmbedding
-	
-	// Get content for each chunk
+
+	// Get the text to embed for each chunk
 	var chunkTexts []string
 	for _, chunk := range chunks {
-		chunkTexts = append(chunkTexts, chunk.Content)
+		chunkTexts = append(chunkTexts, chunk.EmbeddingText())
 	}
-	
+
 	// Get embeddings in batch
 	embeddingsMap, err := GetBatchEmbeddings(chunkTexts, 20)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Match embeddings with their metadata
 	for i, chunk := range chunks {
-		if embedding, ok := embeddingsMap[chunk.Content]; ok {
+		if embedding, ok := embeddingsMap[chunkTexts[i]]; ok {
 			embeddings = append(embeddings, CodeEmbedding{
 				Embedding: embedding,
 				Metadata:  chunk,
 			})
 		} else {
-			log.Printf("Warning: Failed to get embedding for chunk %d in %s", i, filePath)
+			slog.Warn("Failed to get embedding for chunk", "chunk", i, "file", filePath)
 		}
 	}
-	
+
 	return embeddings, nil
 }
 
-// extractGenericChunks provides fallback generic chunking for unsupported languages
-func extractGenericChunks(filename string, lines []string) ([]CodeChunkMetadata, error) {
+// scopeHeader builds the context header embedded ahead of a chunk's content
+// so its embedding also encodes where the code lives
+func scopeHeader(filePath string, chunk CodeChunkMetadata) string {
+	header := []string{"File: " + filePath}
+	if chunk.Package != "" {
+		header = append(header, "Package: "+chunk.Package)
+	}
+	if chunk.Scope != "" {
+		header = append(header, "Scope: "+chunk.Scope)
+	}
+	return strings.Join(header, "\n")
+}
+
+// GenericChunker chunks any text by paragraphs, merged up to the size
+// limit. It's the fallback for languages without a chunker of their own.
+type GenericChunker struct{}
+
+// Chunk splits content into paragraph-aligned chunks
+func (GenericChunker) Chunk(filePath, content string, options ChunkOptions) ([]CodeChunkMetadata, error) {
+	lines := strings.Split(content, "\n")
+	return chunkLineRange(filePath, lines, 0, len(lines), options), nil
+}
+
+// chunkLineRange splits lines[start:end] into chunks of at most
+// options.MaxChunkSize characters, using empty lines as separators
+// (simulating paragraph breaks) and merging paragraphs up to the size limit.
+// When options.Overlap is positive, each chunk after the first also includes
+// up to that many preceding lines.
+func chunkLineRange(filename string, lines []string, start, end int, options ChunkOptions) []CodeChunkMetadata {
+	maxSize := options.MaxChunkSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxChunkSize
+	}
+
 	var chunks []CodeChunkMetadata
-	
-	// For unsupported languages, create larger chunks based on empty lines
-	// as separators, simulating paragraph breaks
-	
-	var chunkStart int
-	var currentChunk []string
-	
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		
-		if trimmed == "" && len(currentChunk) > 0 {
-			// End of a paragraph-like chunk
-			chunks = append(chunks, CodeChunkMetadata{
-				Filename:  filename,
-				StartLine: chunkStart + 1, // Convert to 1-indexed
-				EndLine:   i,              // Convert to 1-indexed
-				Content:   strings.Join(currentChunk, "\n"),
-			})
-			currentChunk = nil
-		} else if trimmed != "" {
-			if len(currentChunk) == 0 {
-				chunkStart = i
-			}
-			currentChunk = append(currentChunk, line)
+
+	emit := func(from, to int) {
+		if options.Overlap > 0 && len(chunks) > 0 {
+			from = max(from-options.Overlap, start)
 		}
-	}
-	
-	// Add the final chunk if any
-	if len(currentChunk) > 0 {
 		chunks = append(chunks, CodeChunkMetadata{
 			Filename:  filename,
-			StartLine: chunkStart + 1,     // Convert to 1-indexed
-			EndLine:   len(lines),         // Convert to 1-indexed
-			Content:   strings.Join(currentChunk, "\n"),
+			StartLine: from + 1, // Convert to 1-indexed
+			EndLine:   to,       // Convert to 1-indexed
+			Content:   strings.Join(lines[from:to], "\n"),
 		})
 	}
-	
-	return chunks, nil
-}
\ No newline at end of file
+
+	// Current run of merged paragraphs
+	curStart, curEnd, curSize := -1, -1, 0
+	flush := func() {
+		if curStart >= 0 {
+			emit(curStart, curEnd)
+			curStart = -1
+			curSize = 0
+		}
+	}
+
+	for i := start; i < end; {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+
+		// Find the end of this paragraph
+		paraStart, paraSize := i, 0
+		for i < end && strings.TrimSpace(lines[i]) != "" {
+			paraSize += len(lines[i]) + 1
+			i++
+		}
+		paraEnd := i
+
+		// Start a new chunk if this paragraph doesn't fit in the current one
+		if curStart >= 0 && curSize+(paraStart-curEnd)+paraSize > maxSize {
+			flush()
+		}
+
+		// Paragraphs larger than the limit are split at line boundaries
+		if paraSize > maxSize {
+			flush()
+			windowStart, windowSize := paraStart, 0
+			for j := paraStart; j < paraEnd; j++ {
+				lineSize := len(lines[j]) + 1
+				if j > windowStart && windowSize+lineSize > maxSize {
+					emit(windowStart, j)
+					windowStart, windowSize = j, 0
+				}
+				windowSize += lineSize
+			}
+			emit(windowStart, paraEnd)
+			continue
+		}
+
+		if curStart < 0 {
+			curStart, curSize = paraStart, paraSize
+		} else {
+			curSize += (paraStart - curEnd) + paraSize
+		}
+		curEnd = paraEnd
+	}
+	flush()
+
+	return chunks
+}
+
+// isTrivialChunk reports whether content holds nothing but brackets and punctuation
+func isTrivialChunk(content string) bool {
+	return strings.Trim(content, " \t\r\n{}()[];,") == ""
+}
@@ -0,0 +1,113 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Endpoint of Cohere's embed API
+const cohereEmbedURL = "https://api.cohere.com/v2/embed"
+
+// Most texts Cohere embeds in one request
+const cohereMaxTexts = 96
+
+// cohereEmbedder requests embeddings from Cohere's embed v3 models, which
+// are trained to embed search queries and documents differently
+type cohereEmbedder struct {
+	apiKey string
+	client *http.Client
+}
+
+// cohereRequest is the body of an embed request
+type cohereRequest struct {
+	Model          string   `json:"model"`
+	Texts          []string `json:"texts"`
+	InputType      string   `json:"input_type"`
+	EmbeddingTypes []string `json:"embedding_types"`
+	Truncate       string   `json:"truncate"`
+}
+
+// cohereResponse is the reply to an embed request
+type cohereResponse struct {
+	Embeddings struct {
+		Float [][]float32 `json:"float"`
+	} `json:"embeddings"`
+	Meta struct {
+		BilledUnits struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"billed_units"`
+	} `json:"meta"`
+	Message string `json:"message"`
+}
+
+func (e *cohereEmbedder) embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, int, error) {
+	var vectors [][]float32
+	tokens := 0
+	for start := 0; start < len(texts); start += cohereMaxTexts {
+		batch := texts[start:min(start+cohereMaxTexts, len(texts))]
+		batchVectors, batchTokens, err := e.embedBatch(ctx, batch, inputType)
+		if err != nil {
+			return nil, tokens, err
+		}
+		vectors = append(vectors, batchVectors...)
+		tokens += batchTokens
+	}
+	return vectors, tokens, nil
+}
+
+// embedBatch sends one embed request of at most cohereMaxTexts texts
+func (e *cohereEmbedder) embedBatch(ctx context.Context, texts []string, inputType InputType) ([][]float32, int, error) {
+	body, err := json.Marshal(cohereRequest{
+		Model:          string(EmbeddingModel),
+		Texts:          texts,
+		InputType:      string(inputType),
+		EmbeddingTypes: []string{"float"},
+		Truncate:       "END", // Embed v3 models read at most 512 tokens
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cohereEmbedURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	var reply cohereResponse
+	if err := json.Unmarshal(data, &reply); err != nil && resp.StatusCode < 300 {
+		return nil, 0, fmt.Errorf("failed to parse Cohere response: %v", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// Matched by the caller to back off longer
+		return nil, 0, fmt.Errorf("cohere rate limit exceeded: %s", reply.Message)
+	case resp.StatusCode >= 300:
+		message := reply.Message
+		if message == "" {
+			message = strings.TrimSpace(string(data))
+		}
+		return nil, 0, fmt.Errorf("cohere returned %s: %s", resp.Status, message)
+	case len(reply.Embeddings.Float) != len(texts):
+		return nil, 0, fmt.Errorf("cohere returned %d embeddings for %d texts", len(reply.Embeddings.Float), len(texts))
+	}
+	return reply.Embeddings.Float, reply.Meta.BilledUnits.InputTokens, nil
+}
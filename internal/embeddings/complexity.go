@@ -0,0 +1,246 @@
+package embeddings
+
+import (
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// CodeMetrics measures the functions and types of a file
+type CodeMetrics struct {
+	Functions []FunctionMetrics
+	Types     []TypeMetrics
+}
+
+// FunctionMetrics measures one function or method of a file
+type FunctionMetrics struct {
+	Name       string
+	StartLine  int // 1-based
+	EndLine    int
+	DeclLine   int  // Where its doc comment goes above: its start, or that of an export or decorator wrapping it
+	BodyLine   int  // Where its body starts, which holds a Python docstring
+	Complexity int  // Cyclomatic complexity: 1 plus each branch, loop, case, and && or ||
+	Nesting    int  // Deepest nesting of control-flow blocks
+	Documented bool // Has a doc comment or docstring
+}
+
+// TypeMetrics describes one class, struct, interface, or other named type of
+// a file
+type TypeMetrics struct {
+	Name       string
+	StartLine  int // 1-based
+	Documented bool
+}
+
+// complexityRules names the syntax nodes of a grammar that metrics count.
+// Anonymous functions and lambdas are counted as part of the function they
+// appear in.
+type complexityRules struct {
+	functions map[string]bool // Named functions and methods
+	types     map[string]bool // Named classes, structs, interfaces, and enums
+	decisions map[string]bool // Nodes adding a path through a function
+	logical   map[string]bool // Operators of binary expressions adding a path
+	nesting   map[string]bool // Blocks that nest the code inside them
+}
+
+// Metrics rules of each grammar
+var complexityRulesByLanguage = map[*sitter.Language]complexityRules{
+	goLanguage: {
+		functions: nodeTypes("function_declaration", "method_declaration"),
+		types:     nodeTypes("type_spec"),
+		decisions: nodeTypes("if_statement", "for_statement", "expression_case", "type_case", "communication_case"),
+		logical:   nodeTypes("&&", "||"),
+		nesting:   nodeTypes("if_statement", "for_statement", "expression_switch_statement", "type_switch_statement", "select_statement"),
+	},
+	pythonLanguage: {
+		functions: nodeTypes("function_definition"),
+		types:     nodeTypes("class_definition"),
+		decisions: nodeTypes("if_statement", "elif_clause", "for_statement", "while_statement", "except_clause",
+			"conditional_expression", "boolean_operator", "for_in_clause", "if_clause"),
+		nesting: nodeTypes("if_statement", "for_statement", "while_statement", "try_statement", "with_statement"),
+	},
+	javascriptLanguage: {
+		functions: nodeTypes("function_declaration", "generator_function_declaration", "method_definition"),
+		types:     nodeTypes("class_declaration"),
+		decisions: nodeTypes("if_statement", "for_statement", "for_in_statement", "while_statement", "do_statement",
+			"switch_case", "catch_clause", "ternary_expression"),
+		logical: nodeTypes("&&", "||", "??"),
+		nesting: nodeTypes("if_statement", "for_statement", "for_in_statement", "while_statement", "do_statement",
+			"switch_statement", "try_statement"),
+	},
+	javaLanguage: {
+		functions: nodeTypes("method_declaration", "constructor_declaration"),
+		types:     nodeTypes("class_declaration", "interface_declaration", "enum_declaration", "record_declaration"),
+		decisions: nodeTypes("if_statement", "for_statement", "enhanced_for_statement", "while_statement", "do_statement",
+			"switch_label", "catch_clause", "ternary_expression"),
+		logical: nodeTypes("&&", "||"),
+		nesting: nodeTypes("if_statement", "for_statement", "enhanced_for_statement", "while_statement", "do_statement",
+			"switch_expression", "try_statement"),
+	},
+	csharpLanguage: {
+		functions: nodeTypes("method_declaration", "constructor_declaration", "local_function_statement"),
+		types:     nodeTypes("class_declaration", "interface_declaration", "struct_declaration", "enum_declaration", "record_declaration"),
+		decisions: nodeTypes("if_statement", "for_statement", "foreach_statement", "while_statement", "do_statement",
+			"switch_section", "catch_clause", "conditional_expression"),
+		logical: nodeTypes("&&", "||", "??"),
+		nesting: nodeTypes("if_statement", "for_statement", "foreach_statement", "while_statement", "do_statement",
+			"switch_statement", "try_statement"),
+	},
+}
+
+// nodeTypes returns a set of syntax node types
+func nodeTypes(values ...string) map[string]bool {
+	s := make(map[string]bool, len(values))
+	for _, v := range values {
+		s[v] = true
+	}
+	return s
+}
+
+// ExtractCodeMetrics parses a file and measures each of its named functions,
+// methods, and types, in order of their position. Files of languages without
+// a Tree-sitter grammar have none.
+func ExtractCodeMetrics(filePath, content string) (CodeMetrics, error) {
+	var metrics CodeMetrics
+	language := languageForFile(filePath)
+	rules, ok := complexityRulesByLanguage[language]
+	if !ok {
+		return metrics, nil
+	}
+	tree, err := parseContent(language, content)
+	if err != nil {
+		return metrics, err
+	}
+	defer tree.Close()
+
+	var visit func(node *sitter.Node)
+	visit = func(node *sitter.Node) {
+		if rules.functions[node.Type()] {
+			function := FunctionMetrics{
+				Name:       functionName(node, content),
+				StartLine:  int(node.StartPoint().Row) + 1,
+				EndLine:    int(node.EndPoint().Row) + 1,
+				DeclLine:   int(declaration(node).StartPoint().Row) + 1,
+				BodyLine:   int(node.StartPoint().Row) + 1,
+				Complexity: 1,
+				Documented: hasDocumentation(node, language),
+			}
+			if body := node.ChildByFieldName("body"); body != nil {
+				function.BodyLine = int(body.StartPoint().Row) + 1
+			}
+			measure(node, rules, 0, &function, visit)
+			metrics.Functions = append(metrics.Functions, function)
+			return
+		}
+		if rules.types[node.Type()] {
+			metrics.Types = append(metrics.Types, TypeMetrics{
+				Name:       functionName(node, content),
+				StartLine:  int(node.StartPoint().Row) + 1,
+				Documented: hasDocumentation(node, language),
+			})
+		}
+		for i := 0; i < int(node.ChildCount()); i++ {
+			visit(node.Child(i))
+		}
+	}
+	visit(tree.RootNode())
+
+	sort.SliceStable(metrics.Functions, func(i, j int) bool {
+		return metrics.Functions[i].StartLine < metrics.Functions[j].StartLine
+	})
+	return metrics, nil
+}
+
+// measure adds the decisions and nesting below node to a function's metrics.
+// Functions nested inside it are measured on their own through visit.
+func measure(node *sitter.Node, rules complexityRules, depth int, metrics *FunctionMetrics, visit func(*sitter.Node)) {
+	for i := 0; i < int(node.ChildCount()); i++ {
+		child := node.Child(i)
+		if rules.functions[child.Type()] {
+			visit(child)
+			continue
+		}
+
+		if rules.decisions[child.Type()] && !isDefaultLabel(child) {
+			metrics.Complexity++
+		}
+		if !child.IsNamed() && rules.logical[child.Type()] && node.Type() == "binary_expression" {
+			metrics.Complexity++
+		}
+
+		childDepth := depth
+		// An else if continues its chain rather than nesting inside it
+		if rules.nesting[child.Type()] && !isElseIf(child) {
+			childDepth++
+			if childDepth > metrics.Nesting {
+				metrics.Nesting = childDepth
+			}
+		}
+		measure(child, rules, childDepth, metrics, visit)
+	}
+}
+
+// isDefaultLabel reports whether a switch label or section is the default
+// case, which adds no path of its own
+func isDefaultLabel(node *sitter.Node) bool {
+	if node.ChildCount() == 0 {
+		return false
+	}
+	first := node.Child(0).Type()
+	return first == "default" || first == "default_switch_label"
+}
+
+// isElseIf reports whether an if statement is the else branch of another
+func isElseIf(node *sitter.Node) bool {
+	if node.Type() != "if_statement" {
+		return false
+	}
+	parent := node.Parent()
+	return parent != nil && (parent.Type() == "if_statement" || parent.Type() == "else_clause")
+}
+
+// Nodes wrapping a declaration that its doc comment comes before: exports,
+// decorators, and Go type declarations
+var declarationWrappers = nodeTypes("export_statement", "decorated_definition", "type_declaration")
+
+// hasDocumentation reports whether a declaration has a doc comment on the
+// lines right above it, or above what wraps it, or for Python a docstring
+func hasDocumentation(node *sitter.Node, language *sitter.Language) bool {
+	if language == pythonLanguage {
+		if body := node.ChildByFieldName("body"); body != nil && body.NamedChildCount() > 0 {
+			first := body.NamedChild(0)
+			if first.Type() == "expression_statement" && first.NamedChildCount() > 0 && first.NamedChild(0).Type() == "string" {
+				return true
+			}
+		}
+	}
+
+	for n := node; n != nil; n = n.Parent() {
+		// Comment node types vary: comment, line_comment, block_comment
+		if prev := n.PrevSibling(); prev != nil && strings.HasSuffix(prev.Type(), "comment") && prev.EndPoint().Row+1 >= n.StartPoint().Row {
+			return true
+		}
+		if parent := n.Parent(); parent == nil || !declarationWrappers[parent.Type()] {
+			return false
+		}
+	}
+	return false
+}
+
+// declaration returns the outermost export or decorator wrapping a
+// declaration, or the declaration itself
+func declaration(node *sitter.Node) *sitter.Node {
+	for parent := node.Parent(); parent != nil && declarationWrappers[parent.Type()]; parent = parent.Parent() {
+		node = parent
+	}
+	return node
+}
+
+// functionName returns the name of a function, method, or type node
+func functionName(node *sitter.Node, content string) string {
+	if name := node.ChildByFieldName("name"); name != nil {
+		return content[name.StartByte():name.EndByte()]
+	}
+	return "<anonymous>"
+}
@@ -0,0 +1,186 @@
+package embeddings
+
+import (
+	"regexp"
+	"strings"
+)
+
+// block is a top-level unit of an infrastructure file, such as a Terraform
+// resource or a SQL table, starting at a line
+type block struct {
+	start int    // 0-indexed line the block starts on
+	name  string // Label recorded as the scope of the block's chunks
+}
+
+// blockFinder returns the blocks of a file's lines, in order
+type blockFinder func(lines []string) []block
+
+var (
+	// resource "aws_s3_bucket" "logs" {
+	hclBlockStart = regexp.MustCompile(`^([A-Za-z_][\w-]*)((?:\s+"[^"]*"|\s+[A-Za-z_][\w-]*)*)\s*\{`)
+	hclLabel      = regexp.MustCompile(`"([^"]*)"|([A-Za-z_][\w-]*)`)
+	// CREATE [OR REPLACE] [UNIQUE] TABLE [IF NOT EXISTS] users
+	sqlStatementStart = regexp.MustCompile(`(?i)^\s*(create|alter)\s+(?:or\s+replace\s+)?(?:unique\s+)?(?:temp(?:orary)?\s+)?(materialized\s+view|table|view|index|function|procedure|trigger|type|schema|sequence|extension)\s+(?:if\s+(?:not\s+)?exists\s+)?([\w."` + "`" + `]+)`)
+	// message Order {
+	protoBlockStart = regexp.MustCompile(`^(message|service|enum|extend)\s+([\w.]+)`)
+	// FROM golang:1.24 AS build
+	dockerStageStart = regexp.MustCompile(`(?i)^FROM\s+(?:--\S+\s+)*(\S+)(?:\s+AS\s+(\S+))?`)
+	// A service under a compose file's top-level services key
+	composeServiceStart = regexp.MustCompile(`^  ([\w.-]+):\s*$`)
+	yamlTopLevelKey     = regexp.MustCompile(`^[\w.-]+:`)
+	yamlKind            = regexp.MustCompile(`^kind:\s*["']?([\w.-]+)`)
+	yamlMetadataName    = regexp.MustCompile(`^  name:\s*["']?([\w.{}\s-]*[\w}])`)
+)
+
+// BlockChunker chunks infrastructure and schema files, such as Terraform
+// and SQL, by their top-level blocks, labeling each chunk with the block it
+// belongs to
+type BlockChunker struct {
+	findBlocks blockFinder
+}
+
+// Chunk splits content by its blocks. Lines ahead of the first block are
+// chunked generically.
+func (c BlockChunker) Chunk(filePath, content string, options ChunkOptions) ([]CodeChunkMetadata, error) {
+	lines := strings.Split(content, "\n")
+	blocks := c.findBlocks(lines)
+	if len(blocks) == 0 {
+		return chunkLineRange(filePath, lines, 0, len(lines), options), nil
+	}
+
+	// Lines ahead of the first block, such as comments and provider
+	// settings, are chunked on their own
+	chunks := chunkLineRange(filePath, lines, 0, blocks[0].start, options)
+	for i, b := range blocks {
+		end := len(lines)
+		if i+1 < len(blocks) {
+			end = blocks[i+1].start
+		}
+		for _, chunk := range chunkLineRange(filePath, lines, b.start, end, options) {
+			chunk.Scope = b.name
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+// hclBlocks finds the top-level blocks of Terraform and other HCL files,
+// named like resource aws_s3_bucket.logs
+func hclBlocks(lines []string) []block {
+	var blocks []block
+	for i, line := range lines {
+		match := hclBlockStart.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		var labels []string
+		for _, label := range hclLabel.FindAllStringSubmatch(match[2], -1) {
+			labels = append(labels, label[1]+label[2])
+		}
+		name := match[1]
+		if len(labels) > 0 {
+			name += " " + strings.Join(labels, ".")
+		}
+		blocks = append(blocks, block{start: i, name: name})
+	}
+	return blocks
+}
+
+// sqlBlocks finds the CREATE and ALTER statements of a SQL file, named like
+// TABLE users
+func sqlBlocks(lines []string) []block {
+	var blocks []block
+	for i, line := range lines {
+		if match := sqlStatementStart.FindStringSubmatch(line); match != nil {
+			kind := strings.ToUpper(strings.Join(strings.Fields(match[2]), " "))
+			name := kind + " " + strings.Trim(match[3], "\"`")
+			if strings.EqualFold(match[1], "alter") {
+				name = "ALTER " + name
+			}
+			blocks = append(blocks, block{start: i, name: name})
+		}
+	}
+	return blocks
+}
+
+// protoBlocks finds the top-level messages, services, and enums of a
+// protobuf file
+func protoBlocks(lines []string) []block {
+	var blocks []block
+	for i, line := range lines {
+		if match := protoBlockStart.FindStringSubmatch(line); match != nil {
+			blocks = append(blocks, block{start: i, name: match[1] + " " + match[2]})
+		}
+	}
+	return blocks
+}
+
+// dockerfileStages finds the build stages of a Dockerfile, named by their
+// alias or else their base image
+func dockerfileStages(lines []string) []block {
+	var blocks []block
+	for i, line := range lines {
+		if match := dockerStageStart.FindStringSubmatch(line); match != nil {
+			name := "stage " + match[2]
+			if match[2] == "" {
+				name = "FROM " + match[1]
+			}
+			blocks = append(blocks, block{start: i, name: name})
+		}
+	}
+	return blocks
+}
+
+// composeServices finds the services of a docker-compose file. Other
+// top-level keys, such as volumes and networks, close the last service.
+func composeServices(lines []string) []block {
+	var blocks []block
+	inServices := false
+	for i, line := range lines {
+		if yamlTopLevelKey.MatchString(line) {
+			inServices = strings.HasPrefix(line, "services:")
+			if !inServices {
+				name := strings.TrimSuffix(strings.Fields(line)[0], ":")
+				blocks = append(blocks, block{start: i, name: name})
+			}
+			continue
+		}
+		if match := composeServiceStart.FindStringSubmatch(line); match != nil && inServices {
+			blocks = append(blocks, block{start: i, name: "service " + match[1]})
+		}
+	}
+	return blocks
+}
+
+// yamlDocuments finds the documents of a multi-document YAML file such as a
+// set of Kubernetes manifests, named by their kind and metadata.name
+func yamlDocuments(lines []string) []block {
+	var blocks []block
+	start := 0
+	flush := func(end int) {
+		if end == start {
+			return
+		}
+		var kind, name string
+		inMetadata := false
+		for _, line := range lines[start:end] {
+			if match := yamlKind.FindStringSubmatch(line); match != nil {
+				kind = match[1]
+			}
+			if yamlTopLevelKey.MatchString(line) {
+				inMetadata = strings.HasPrefix(line, "metadata:")
+			} else if match := yamlMetadataName.FindStringSubmatch(line); match != nil && inMetadata && name == "" {
+				name = match[1]
+			}
+		}
+		blocks = append(blocks, block{start: start, name: strings.TrimSpace(kind + " " + name)})
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, "---") {
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(lines))
+	return blocks
+}
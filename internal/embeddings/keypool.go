@@ -0,0 +1,152 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/apikeys"
+	"github.com/exolottl/codie/internal/httpclient"
+)
+
+// Consecutive rate limit errors after which a key is rested and requests
+// move on to the next one, and how long it rests
+const (
+	keyRateLimitStreak = 2
+	keyCooldown        = time.Minute
+)
+
+// keyPool rotates through the provider's API keys in priority order. Each
+// key has its own rate limiter, as quotas are per key, and keys that are
+// rejected or keep hitting their rate limit are skipped.
+type keyPool struct {
+	mu   sync.Mutex
+	keys []*poolKey
+}
+
+// poolKey is one API key with its client and rate limit state
+type poolKey struct {
+	label        string // Such as "2 of 3", to log the key without revealing it
+	client       embedder
+	limiter      *RateLimiter
+	rateLimits   int       // Consecutive rate limit errors
+	coolingUntil time.Time // Skipped until then after sustained rate limiting
+	rejected     bool
+}
+
+var (
+	poolMu       sync.Mutex
+	pool         *keyPool
+	poolProvider string
+)
+
+// currentKeyPool returns the key pool of the configured provider, creating
+// it on first use. Its state outlives single calls, so a long indexing run
+// keeps away from keys that failed earlier.
+func currentKeyPool() (*keyPool, error) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if pool != nil && poolProvider == Provider {
+		return pool, nil
+	}
+
+	// Providers authenticating with credentials rather than keys, and
+	// OpenAI-compatible servers, which often need none, get one keyless client
+	var values []string
+	if variable := keyVariable(); variable != "" {
+		values = apikeys.Get(variable)
+	}
+	if len(values) == 0 {
+		switch {
+		case Provider == "cohere":
+			return nil, ErrMissingCohereKey
+		case keyVariable() != "" && OpenAIBaseURL == "":
+			return nil, ErrMissingAPIKey
+		}
+		values = []string{""}
+	}
+
+	pool = &keyPool{}
+	poolProvider = Provider
+	for i, value := range values {
+		limiter := newProviderRateLimiter()
+		pool.keys = append(pool.keys, &poolKey{
+			label:   fmt.Sprintf("%d of %d", i+1, len(values)),
+			client:  newEmbedder(value, httpclient.NewWithTransport(observingTransport{limiter: limiter})),
+			limiter: limiter,
+		})
+	}
+	return pool, nil
+}
+
+// acquire returns the first usable key in priority order once its rate
+// limiter lets a request of about tokens tokens through. While every key is
+// resting, it waits for the first to be usable again. The caller must
+// release the key's limiter.
+func (p *keyPool) acquire(ctx context.Context, tokens int) (*poolKey, error) {
+	p.mu.Lock()
+	now := time.Now()
+	var next *poolKey
+	for _, key := range p.keys {
+		if key.rejected {
+			continue
+		}
+		if !key.coolingUntil.After(now) {
+			next = key
+			break
+		}
+		if next == nil || key.coolingUntil.Before(next.coolingUntil) {
+			next = key
+		}
+	}
+	var wait time.Duration
+	if next != nil {
+		wait = next.coolingUntil.Sub(now)
+	}
+	p.mu.Unlock()
+
+	if next == nil {
+		return nil, fmt.Errorf("all %d API keys were rejected", len(p.keys))
+	}
+	if wait > 0 {
+		slog.Warn("All API keys are rate limited, waiting", "wait", wait.Round(time.Second))
+		sleepContext(ctx, wait)
+	}
+	if err := next.limiter.Wait(ctx, tokens); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// report records the outcome of a request made with key. It returns true
+// when the error moved requests on to another key, which can be tried
+// without backing off.
+func (p *keyPool) report(key *poolKey, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		key.rateLimits = 0
+		return false
+	}
+	if len(p.keys) < 2 {
+		return false
+	}
+
+	switch {
+	case apikeys.IsAuthError(err):
+		key.rejected = true
+		slog.Warn("API key rejected, rotating to the next key", "key", key.label, "error", err)
+		return true
+	case apikeys.IsRateLimit(err):
+		key.rateLimits++
+		if key.rateLimits >= keyRateLimitStreak {
+			key.rateLimits = 0
+			key.coolingUntil = time.Now().Add(keyCooldown)
+			slog.Warn("API key keeps hitting its rate limit, rotating to the next key", "key", key.label, "rest", keyCooldown)
+			return true
+		}
+	}
+	return false
+}
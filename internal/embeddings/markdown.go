@@ -0,0 +1,61 @@
+package embeddings
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A Markdown ATX heading such as "## Install"
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// MarkdownChunker chunks Markdown by its sections, labeling each chunk with
+// the headings it falls under
+type MarkdownChunker struct{}
+
+// Chunk splits content at its headings. Headings inside fenced code blocks
+// are ignored.
+func (MarkdownChunker) Chunk(filePath, content string, options ChunkOptions) ([]CodeChunkMetadata, error) {
+	lines := strings.Split(content, "\n")
+
+	var chunks []CodeChunkMetadata
+	var trail []string // Headings enclosing the current section, outermost first
+	sectionStart, inFence := 0, false
+	flush := func(end int) {
+		var headings []string
+		for _, heading := range trail {
+			if heading != "" {
+				headings = append(headings, heading)
+			}
+		}
+		scope := strings.Join(headings, " > ")
+		for _, chunk := range chunkLineRange(filePath, lines, sectionStart, end, options) {
+			chunk.Scope = scope
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		match := markdownHeading.FindStringSubmatch(line)
+		if match == nil || inFence {
+			continue
+		}
+		flush(i)
+		sectionStart = i
+		level := len(match[1])
+		if len(trail) >= level {
+			trail = trail[:level-1]
+		}
+		for len(trail) < level-1 {
+			trail = append(trail, "")
+		}
+		trail = append(trail, match[2])
+	}
+	flush(len(lines))
+
+	return chunks, nil
+}
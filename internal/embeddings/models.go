@@ -3,6 +3,8 @@ package embeddings
 import(
 	"errors"
 	"time"
+
+	"github.com/sashabaranov/go-openai"
 )
 
 // CodeEmbedding represents a code embedding with metadata
@@ -13,12 +15,41 @@ type CodeEmbedding struct {
 
 // CodeChunkMetadata contains information about the code chunk
 type CodeChunkMetadata struct {
-	Filename  string `json:"filename"`
-	Function  string `json:"function,omitempty"`
-	Class     string `json:"class,omitempty"`
-	StartLine int    `json:"start_line"`
-	EndLine   int    `json:"end_line"`
-	Content   string `json:"content"`
+	Filename  string   `json:"filename"`
+	Package   string   `json:"package,omitempty"`
+	Function  string   `json:"function,omitempty"`
+	Class     string   `json:"class,omitempty"`
+	Scope     string   `json:"scope,omitempty"` // Signature of the enclosing class or type
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Content   string   `json:"content"`
+	Context   string   `json:"context,omitempty"` // Header embedded ahead of the content
+	Imports   []string `json:"imports,omitempty"` // Imports declared by the file, set on its first chunk only
+	Calls     []string `json:"calls,omitempty"`   // Names of the functions and methods a function chunk calls, as pkg.Fn for Go selector calls
+}
+
+// EmbeddingText returns the text sent to the embeddings API: the chunk laid
+// out by the embedding template, or by default the context header followed
+// by the raw content
+func (c CodeChunkMetadata) EmbeddingText() string {
+	templateMutex.RLock()
+	template := embeddingTemplate
+	templateMutex.RUnlock()
+	if template != "" {
+		return applyTemplate(template, c)
+	}
+	if c.Context == "" {
+		return c.Content
+	}
+	return c.Context + "\n\n" + c.Content
+}
+
+// ChunkOptions configures how source files are split into chunks
+type ChunkOptions struct {
+	MaxChunkSize int    // Maximum characters per chunk
+	Overlap      int    // Lines repeated between consecutive generic chunks
+	MaxChunks    int    // Files splitting into more chunks fail with ErrTooManyChunks (0 disables)
+	Root         string // Directory being indexed, which package paths are relative to ("" uses file paths as given)
 }
 
 // nodeType defines types of syntax nodes we're interested in
@@ -35,9 +66,14 @@ const (
 // Common errors
 var (
 	ErrMissingAPIKey    = errors.New("OPENAI_API_KEY is not set in .env file")
+	ErrMissingCohereKey = errors.New("COHERE_API_KEY is not set")
 	ErrEmbeddingFailed  = errors.New("failed to generate embedding")
+	ErrTooManyChunks    = errors.New("too many chunks")
 )
 
+// EmbeddingModel is the model used to generate embeddings
+var EmbeddingModel = openai.SmallEmbedding3
+
 // Constants
 const (
 	MaxTokenLimit     = 8192
@@ -0,0 +1,137 @@
+package embeddings
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/exolottl/codie/internal/bedrock"
+	"github.com/exolottl/codie/internal/local"
+	"github.com/exolottl/codie/internal/mock"
+	"github.com/exolottl/codie/internal/vertex"
+	"github.com/sashabaranov/go-openai"
+)
+
+// InputType tells providers that embed search queries and the documents
+// they are matched against differently which of the two a text is
+type InputType string
+
+const (
+	DocumentInput InputType = "search_document"
+	QueryInput    InputType = "search_query"
+)
+
+// Provider is the service embeddings are requested from: openai, cohere,
+// vertex, bedrock, local, or mock
+var Provider = "openai"
+
+// OpenAIBaseURL, when set, is the base URL of an OpenAI-compatible API,
+// such as vLLM, LiteLLM, or LM Studio, used instead of OpenAI's
+var OpenAIBaseURL = ""
+
+// embedder requests the embeddings of a batch of texts from one provider,
+// returning them in the order of the texts along with the tokens billed
+type embedder interface {
+	embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, int, error)
+}
+
+// keyVariable returns the environment variable holding the configured
+// provider's API key, or "" for providers that authenticate otherwise
+func keyVariable() string {
+	switch Provider {
+	case "cohere":
+		return "COHERE_API_KEY"
+	case "vertex", "bedrock", "local", "mock":
+		return ""
+	default:
+		return "OPENAI_API_KEY"
+	}
+}
+
+// newEmbedder returns an embedder of the configured provider that makes its
+// requests with apiKey, through client where the provider is called over
+// plain HTTP
+func newEmbedder(apiKey string, client *http.Client) embedder {
+	switch Provider {
+	case "cohere":
+		return &cohereEmbedder{apiKey: apiKey, client: client}
+	case "vertex":
+		return vertexEmbedder{}
+	case "bedrock":
+		return bedrockEmbedder{}
+	case "local":
+		return localEmbedder{}
+	case "mock":
+		return mockEmbedder{}
+	default:
+		config := openai.DefaultConfig(apiKey)
+		config.HTTPClient = client
+		if OpenAIBaseURL != "" {
+			config.BaseURL = OpenAIBaseURL
+		}
+		return &openaiEmbedder{client: openai.NewClientWithConfig(config)}
+	}
+}
+
+// openaiEmbedder requests embeddings from the OpenAI API, which embeds
+// queries and documents alike
+type openaiEmbedder struct {
+	client *openai.Client
+}
+
+func (e *openaiEmbedder) embed(ctx context.Context, texts []string, _ InputType) ([][]float32, int, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Model: EmbeddingModel,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var vectors [][]float32
+	for _, item := range resp.Data {
+		if len(item.Embedding) > 0 {
+			vectors = append(vectors, item.Embedding)
+		}
+	}
+	return vectors, resp.Usage.PromptTokens, nil
+}
+
+// vertexEmbedder requests embeddings from Vertex AI, whose models embed
+// documents and queries as different retrieval tasks
+type vertexEmbedder struct{}
+
+func (vertexEmbedder) embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, int, error) {
+	taskType := "RETRIEVAL_DOCUMENT"
+	if inputType == QueryInput {
+		taskType = "RETRIEVAL_QUERY"
+	}
+	return vertex.Embed(ctx, string(EmbeddingModel), texts, taskType)
+}
+
+// bedrockEmbedder requests embeddings from Amazon Bedrock, whose Cohere
+// models take the input type and Titan models ignore it
+type bedrockEmbedder struct{}
+
+func (bedrockEmbedder) embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, int, error) {
+	return bedrock.Embed(ctx, string(EmbeddingModel), texts, string(inputType))
+}
+
+// localEmbedder computes embeddings in-process with a local ONNX model,
+// prefixing search queries with the instruction the model expects
+type localEmbedder struct{}
+
+func (localEmbedder) embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, int, error) {
+	return local.Embed(ctx, string(EmbeddingModel), texts, inputType == QueryInput)
+}
+
+// mockEmbedder returns deterministic pseudo-embeddings without calling any
+// API
+type mockEmbedder struct{}
+
+func (mockEmbedder) embed(ctx context.Context, texts []string, _ InputType) ([][]float32, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	vectors, tokens := mock.Embed(texts)
+	return vectors, tokens, nil
+}
@@ -0,0 +1,109 @@
+package embeddings
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// compiledSymbolQuery is a symbolQuery compiled for its language
+type compiledSymbolQuery struct {
+	kind  string
+	query *sitter.Query
+}
+
+// Queries compiled once per language at init. Compiled queries are
+// read-only, so all goroutines share them; each match runs on a cursor of
+// its own.
+var (
+	compiledChunkQueries   = make(map[*sitter.Language][]*sitter.Query)
+	compiledSymbolQueries  = make(map[*sitter.Language][]compiledSymbolQuery)
+	compiledPackageQueries = make(map[*sitter.Language]*sitter.Query)
+	compiledCallQueries    = make(map[*sitter.Language]*sitter.Query)
+	queriesMutex           sync.RWMutex
+)
+
+// Query cursors, reused across files
+var cursorPool = sync.Pool{
+	New: func() any { return sitter.NewQueryCursor() },
+}
+
+func init() {
+	for language, patterns := range languageQueries {
+		for _, pattern := range patterns {
+			if query, err := sitter.NewQuery([]byte(pattern), language); err != nil {
+				slog.Error("Failed to create chunk query", "query", pattern, "error", err)
+			} else {
+				compiledChunkQueries[language] = append(compiledChunkQueries[language], query)
+			}
+		}
+	}
+	for language, queries := range symbolQueries {
+		for _, sq := range queries {
+			if query, err := sitter.NewQuery([]byte(sq.query), language); err != nil {
+				slog.Error("Failed to create symbol query", "query", sq.query, "error", err)
+			} else {
+				compiledSymbolQueries[language] = append(compiledSymbolQueries[language], compiledSymbolQuery{sq.kind, query})
+			}
+		}
+	}
+	for language, pattern := range packageQueries {
+		if query, err := sitter.NewQuery([]byte(pattern), language); err != nil {
+			slog.Error("Failed to create package query", "query", pattern, "error", err)
+		} else {
+			compiledPackageQueries[language] = query
+		}
+	}
+	for language, pattern := range callQueries {
+		if query, err := sitter.NewQuery([]byte(pattern), language); err != nil {
+			slog.Error("Failed to create call query", "query", pattern, "error", err)
+		} else {
+			compiledCallQueries[language] = query
+		}
+	}
+}
+
+// RegisterChunkQuery compiles a Tree-sitter query for a language, such as
+// "go", and adds it to the queries that find the definitions chunks are cut
+// along. A definition is captured as @<kind>_def and its name as
+// @<kind>_name, where kind is function, method, class, or struct.
+func RegisterChunkQuery(language, pattern string) error {
+	grammar, ok := grammars[language]
+	if !ok {
+		return fmt.Errorf("no Tree-sitter grammar for %q", language)
+	}
+	query, err := sitter.NewQuery([]byte(pattern), grammar)
+	if err != nil {
+		return fmt.Errorf("invalid query for %s: %w", language, err)
+	}
+	queriesMutex.Lock()
+	defer queriesMutex.Unlock()
+	compiledChunkQueries[grammar] = append(compiledChunkQueries[grammar], query)
+	return nil
+}
+
+// ChunkQueries returns the compiled chunk queries of a language, including
+// registered ones
+func ChunkQueries(language string) []*sitter.Query {
+	return chunkQueriesFor(grammars[language])
+}
+
+// chunkQueriesFor returns the compiled chunk queries of a grammar
+func chunkQueriesFor(grammar *sitter.Language) []*sitter.Query {
+	queriesMutex.RLock()
+	defer queriesMutex.RUnlock()
+	return append([]*sitter.Query(nil), compiledChunkQueries[grammar]...)
+}
+
+// acquireCursor takes a query cursor from the pool; release it with
+// releaseCursor once its matches have been read
+func acquireCursor() *sitter.QueryCursor {
+	return cursorPool.Get().(*sitter.QueryCursor)
+}
+
+// releaseCursor returns a query cursor to the pool
+func releaseCursor(cursor *sitter.QueryCursor) {
+	cursorPool.Put(cursor)
+}
@@ -1,39 +1,105 @@
 package embeddings
 
 import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/exolottl/codie/internal/httpclient"
+	"github.com/exolottl/codie/internal/metrics"
+	"github.com/exolottl/codie/internal/progress"
+	"github.com/exolottl/codie/internal/retry"
 )
 
-// RateLimiter manages rate limiting for API calls
+// RateLimiter paces API requests with token buckets of requests and of
+// tokens per minute, and caps the requests in flight. The rate limit headers
+// of responses correct the buckets to what the API reports is left, and a
+// Retry-After pauses requests altogether.
 type RateLimiter struct {
-	ticker    *time.Ticker
-	mu        sync.Mutex
-	semaphore chan struct{}
+	mu          sync.Mutex
+	requests    bucket
+	tokens      bucket
+	pausedUntil time.Time
+	semaphore   chan struct{}
 }
 
-// NewRateLimiter creates a new rate limiter with the specified requests per minute
-func NewRateLimiter(requestsPerMinute int, maxConcurrent int) *RateLimiter {
-	if requestsPerMinute <= 0 {
-		requestsPerMinute = 60 // Default: 1 per second
-	}
+// bucket refills at a constant rate up to a minute's worth. A zero rate
+// doesn't limit.
+type bucket struct {
+	perMinute float64
+	available float64
+	updated   time.Time
+}
+
+// NewRateLimiter creates a rate limiter of requests and tokens per minute,
+// with zero tokensPerMinute limiting only requests until a response reports
+// the token limit
+func NewRateLimiter(requestsPerMinute, tokensPerMinute, maxConcurrent int) *RateLimiter {
+	requestsPerMinute = max(requestsPerMinute, 0)
+	tokensPerMinute = max(tokensPerMinute, 0)
 	if maxConcurrent <= 0 {
 		maxConcurrent = 5 // Default: 5 concurrent requests
 	}
-	
-	interval := time.Minute / time.Duration(requestsPerMinute)
+
+	now := time.Now()
 	return &RateLimiter{
-		ticker:    time.NewTicker(interval),
+		requests:  bucket{perMinute: float64(requestsPerMinute), available: float64(requestsPerMinute), updated: now},
+		tokens:    bucket{perMinute: float64(tokensPerMinute), available: float64(tokensPerMinute), updated: now},
 		semaphore: make(chan struct{}, maxConcurrent),
 	}
 }
 
-// Wait blocks until a request can be made according to rate limits
-func (r *RateLimiter) Wait() {
-	r.semaphore <- struct{}{} // Acquire semaphore
-	r.mu.Lock()
-	<-r.ticker.C
-	r.mu.Unlock()
+// Wait blocks until a request of about tokens tokens can be made according
+// to rate limits, or ctx is canceled. Unless it returns an error, the caller
+// must call Release once the request is done.
+func (r *RateLimiter) Wait(ctx context.Context, tokens int) error {
+	start := time.Now()
+	defer func() { metrics.RateLimitWait.Observe(time.Since(start).Seconds()) }()
+
+	select {
+	case r.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Time spent waiting for the limits, rather than for a request slot, is
+	// reported as progress
+	var limited time.Time
+	defer func() {
+		if !limited.IsZero() {
+			progress.Report(ctx, progress.Event{Stage: progress.Embedding, Waiting: -1, Waited: time.Since(limited)})
+		}
+	}()
+
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		r.requests.refill(now)
+		r.tokens.refill(now)
+		// A request larger than a minute's tokens waits for a full bucket
+		cost := math.Min(float64(tokens), r.tokens.perMinute)
+		wait := max(r.pausedUntil.Sub(now), r.requests.wait(1), r.tokens.wait(cost))
+		if wait <= 0 {
+			r.requests.take(1)
+			r.tokens.take(cost)
+			r.mu.Unlock()
+			return nil
+		}
+		r.mu.Unlock()
+
+		if limited.IsZero() {
+			limited = now
+			progress.Report(ctx, progress.Event{Stage: progress.Embedding, Waiting: 1})
+		}
+		sleepContext(ctx, wait)
+		if err := ctx.Err(); err != nil {
+			r.Release()
+			return err
+		}
+	}
 }
 
 // Release releases the semaphore
@@ -41,6 +107,143 @@ func (r *RateLimiter) Release() {
 	<-r.semaphore
 }
 
-// Global rate limiter for OpenAI API (3,500 RPM for ada-002 embeddings is the limit)
-// Using 3,000 to be safe
-var apiRateLimiter = NewRateLimiter(3000, 5)
\ No newline at end of file
+// Observe adapts the limiter to the rate limit headers of a response: the
+// limits and what is left of them, when they reset, and how long to wait
+// after being throttled
+func (r *RateLimiter) Observe(header http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+
+	if wait, ok := retry.ParseRetryAfter(header, now); ok && now.Add(wait).After(r.pausedUntil) {
+		r.pausedUntil = now.Add(wait)
+	}
+	for _, limit := range []struct {
+		bucket *bucket
+		kind   string
+	}{{&r.requests, "requests"}, {&r.tokens, "tokens"}} {
+		limit.bucket.refill(now)
+		if until := limit.bucket.observe(header, limit.kind, now); until.After(r.pausedUntil) {
+			r.pausedUntil = until
+		}
+	}
+}
+
+// refill adds what the bucket gained since it was last updated
+func (b *bucket) refill(now time.Time) {
+	if b.perMinute > 0 {
+		b.available = math.Min(b.perMinute, b.available+now.Sub(b.updated).Minutes()*b.perMinute)
+	}
+	b.updated = now
+}
+
+// wait returns how long until n can be taken from the bucket
+func (b *bucket) wait(n float64) time.Duration {
+	if b.perMinute <= 0 || b.available >= n {
+		return 0
+	}
+	return time.Duration((n - b.available) / b.perMinute * float64(time.Minute))
+}
+
+// take removes n from the bucket
+func (b *bucket) take(n float64) {
+	if b.perMinute > 0 {
+		b.available -= n
+	}
+}
+
+// observe applies OpenAI's x-ratelimit-* headers of one kind, requests or
+// tokens, to the bucket. A limit lower than the configured one, or one where
+// none is configured, is adopted. It returns when requests can resume if the
+// API reports nothing is left, or the zero time.
+func (b *bucket) observe(header http.Header, kind string, now time.Time) time.Time {
+	if limit, err := strconv.Atoi(header.Get("x-ratelimit-limit-" + kind)); err == nil && limit > 0 &&
+		(b.perMinute <= 0 || float64(limit) < b.perMinute) {
+		if b.perMinute <= 0 {
+			b.available = float64(limit)
+		}
+		b.perMinute = float64(limit)
+	}
+	remaining, err := strconv.Atoi(header.Get("x-ratelimit-remaining-" + kind))
+	if err != nil || b.perMinute <= 0 {
+		return time.Time{}
+	}
+	b.available = math.Min(b.available, float64(remaining))
+	if remaining > 0 {
+		return time.Time{}
+	}
+	if reset, err := time.ParseDuration(header.Get("x-ratelimit-reset-" + kind)); err == nil {
+		return now.Add(reset)
+	}
+	return time.Time{}
+}
+
+// pause returns how much longer requests are paused by a Retry-After or an
+// exhausted limit
+func (r *RateLimiter) pause() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return max(time.Until(r.pausedUntil), 0)
+}
+
+// observingTransport passes the headers of every response to a rate limiter,
+// sending requests with the configured proxy and root certificates
+type observingTransport struct {
+	limiter *RateLimiter
+}
+
+func (t observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := httpclient.Transport.RoundTrip(req)
+	if err == nil {
+		t.limiter.Observe(resp.Header)
+	}
+	return resp, err
+}
+
+// Default requests and tokens per minute of each API key of a provider,
+// unless configured otherwise. Zero doesn't limit; token limits are learned
+// from the headers of providers that send them.
+var providerRateLimits = map[string]struct{ requestsPerMinute, tokensPerMinute int }{
+	"openai":  {3000, 0}, // 3,500 RPM for ada-002 embeddings is the limit; using 3,000 to be safe
+	"cohere":  {2000, 0},
+	"vertex":  {600, 0},
+	"bedrock": {1000, 0},
+	"local":   {0, 0},
+	"mock":    {0, 0},
+}
+
+// Rate limit of each API key, with zero requestsPerMinute and
+// tokensPerMinute taking the provider's default
+var rateLimit = struct {
+	requestsPerMinute int
+	tokensPerMinute   int
+	maxConcurrent     int
+}{0, 0, 5}
+
+// SetRateLimit sets the rate limit of each API key, with zero
+// requestsPerMinute and tokensPerMinute keeping the provider's default. It
+// must be called before any embeddings are requested.
+func SetRateLimit(requestsPerMinute, tokensPerMinute, maxConcurrent int) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	rateLimit.requestsPerMinute = requestsPerMinute
+	rateLimit.tokensPerMinute = tokensPerMinute
+	rateLimit.maxConcurrent = maxConcurrent
+	pool = nil
+}
+
+// newProviderRateLimiter returns the rate limiter of one API key of the
+// configured provider
+func newProviderRateLimiter() *RateLimiter {
+	limits, ok := providerRateLimits[Provider]
+	if !ok {
+		limits = providerRateLimits["openai"]
+	}
+	if rateLimit.requestsPerMinute > 0 {
+		limits.requestsPerMinute = rateLimit.requestsPerMinute
+	}
+	if rateLimit.tokensPerMinute > 0 {
+		limits.tokensPerMinute = rateLimit.tokensPerMinute
+	}
+	return NewRateLimiter(limits.requestsPerMinute, limits.tokensPerMinute, rateLimit.maxConcurrent)
+}
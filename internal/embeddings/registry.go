@@ -0,0 +1,152 @@
+package embeddings
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/exolottl/codie/internal/fileutils"
+)
+
+// Chunker splits a file's content into chunks. Implementations are
+// registered per language with RegisterChunker.
+type Chunker interface {
+	Chunk(filePath, content string, options ChunkOptions) ([]CodeChunkMetadata, error)
+}
+
+// Languages of files by extension, as used to look up their chunker
+var languageExtensions = map[string]string{
+	".go":       "go",
+	".py":       "python",
+	".js":       "javascript",
+	".jsx":      "javascript",
+	".ts":       "typescript",
+	".tsx":      "typescript",
+	".java":     "java",
+	".cs":       "csharp",
+	".cpp":      "cpp",
+	".lua":      "lua",
+	".html":     "html",
+	".css":      "css",
+	".php":      "php",
+	".rb":       "ruby",
+	".rs":       "rust",
+	".swift":    "swift",
+	".kt":       "kotlin",
+	".md":       "markdown",
+	".markdown": "markdown",
+	".tf":       "terraform",
+	".tfvars":   "terraform",
+	".hcl":      "hcl",
+	".sql":      "sql",
+	".proto":    "proto",
+	".yml":      "yaml",
+	".yaml":     "yaml",
+}
+
+// Chunker of each language. Languages without one are chunked by
+// GenericChunker.
+var chunkers = map[string]Chunker{
+	"go":         TreeSitterChunker{Language: goLanguage},
+	"python":     TreeSitterChunker{Language: pythonLanguage},
+	"javascript": TreeSitterChunker{Language: javascriptLanguage},
+	"typescript": TreeSitterChunker{Language: javascriptLanguage},
+	"java":       TreeSitterChunker{Language: javaLanguage},
+	"csharp":     TreeSitterChunker{Language: csharpLanguage},
+	"markdown":   MarkdownChunker{},
+	"terraform":  BlockChunker{findBlocks: hclBlocks},
+	"hcl":        BlockChunker{findBlocks: hclBlocks},
+	"sql":        BlockChunker{findBlocks: sqlBlocks},
+	"proto":      BlockChunker{findBlocks: protoBlocks},
+	"dockerfile": BlockChunker{findBlocks: dockerfileStages},
+	"compose":    BlockChunker{findBlocks: composeServices},
+	"yaml":       BlockChunker{findBlocks: yamlDocuments},
+}
+
+// Chunkers that can be chosen for any language by name in the chunkers
+// setting, besides "default"
+var namedChunkers = map[string]Chunker{
+	"generic":  GenericChunker{},
+	"markdown": MarkdownChunker{},
+}
+
+var (
+	// Chunkers chosen per language by the chunkers setting, taking
+	// precedence over the registered ones
+	chunkerOverrides = map[string]Chunker{}
+	chunkersMutex    sync.RWMutex
+)
+
+// DetectLanguage returns the language a file is chunked as, by its name and
+// extension, or "" if it has none
+func DetectLanguage(filePath string) string {
+	switch name := filepath.Base(filePath); {
+	case fileutils.IsDockerfile(name):
+		return "dockerfile"
+	case fileutils.IsComposeFile(name):
+		return "compose"
+	}
+	return languageExtensions[strings.ToLower(filepath.Ext(filePath))]
+}
+
+// RegisterChunker sets the chunker of a language, replacing its default. A
+// chunker chosen for the language in the chunkers setting still takes
+// precedence.
+func RegisterChunker(language string, chunker Chunker) {
+	chunkersMutex.Lock()
+	defer chunkersMutex.Unlock()
+	chunkers[language] = chunker
+}
+
+// RegisterNamedChunker makes a chunker selectable by name in the chunkers
+// setting
+func RegisterNamedChunker(name string, chunker Chunker) {
+	chunkersMutex.Lock()
+	defer chunkersMutex.Unlock()
+	namedChunkers[name] = chunker
+}
+
+// ChunkerFor returns the chunker chosen for a file's language in the
+// chunkers setting or else registered for it, or a GenericChunker if there
+// is none
+func ChunkerFor(filePath string) Chunker {
+	language := DetectLanguage(filePath)
+	chunkersMutex.RLock()
+	defer chunkersMutex.RUnlock()
+	if chunker, ok := chunkerOverrides[language]; ok {
+		return chunker
+	}
+	if chunker, ok := chunkers[language]; ok {
+		return chunker
+	}
+	return GenericChunker{}
+}
+
+// SetChunkers chooses chunkers by name for languages, replacing earlier
+// choices: overrides maps a language to a named chunker, such as
+// sql=generic. "default" keeps the language's registered chunker.
+func SetChunkers(overrides map[string]string) error {
+	chunkersMutex.Lock()
+	defer chunkersMutex.Unlock()
+
+	updated := make(map[string]Chunker)
+	for language, name := range overrides {
+		if name == "default" {
+			continue
+		}
+		chunker, ok := namedChunkers[name]
+		if !ok {
+			names := []string{"default"}
+			for name := range namedChunkers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown chunker %q for %s (available: %s)", name, language, strings.Join(names, ", "))
+		}
+		updated[language] = chunker
+	}
+	chunkerOverrides = updated
+	return nil
+}
@@ -0,0 +1,289 @@
+package embeddings
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// APISymbol is an exported declaration or a network endpoint found in a file
+type APISymbol struct {
+	Kind        string // "function", "method", "type", "endpoint", or "grpc"
+	Name        string // Declaration name, or "METHOD /path" for endpoints
+	Receiver    string // Type a method belongs to
+	Signature   string // First line of the declaration
+	Declaration string // Opening lines of the declaration
+	File        string
+	Package     string
+	Line        int // 1-based line of the declaration
+}
+
+// symbolQuery finds declarations of one kind. Captures: @name, @decl, and
+// optionally @mods (modifiers, checked for visibility).
+type symbolQuery struct {
+	kind  string
+	query string
+}
+
+// Tree-sitter queries for top-level and member declarations that may be public
+var symbolQueries = map[*sitter.Language][]symbolQuery{
+	goLanguage: {
+		{"function", "(source_file (function_declaration name: (identifier) @name) @decl)"},
+		{"method", "(source_file (method_declaration name: (field_identifier) @name) @decl)"},
+		{"type", "(source_file (type_declaration (type_spec name: (type_identifier) @name) @decl))"},
+	},
+	pythonLanguage: {
+		{"function", "(module (function_definition name: (identifier) @name) @decl)"},
+		{"type", "(module (class_definition name: (identifier) @name) @decl)"},
+		{"function", "(module (decorated_definition definition: (function_definition name: (identifier) @name)) @decl)"},
+		{"type", "(module (decorated_definition definition: (class_definition name: (identifier) @name)) @decl)"},
+		{"method", "(module (class_definition body: (block (function_definition name: (identifier) @name) @decl)))"},
+	},
+	javascriptLanguage: {
+		{"function", "(export_statement declaration: (function_declaration name: (identifier) @name)) @decl"},
+		{"type", "(export_statement declaration: (class_declaration name: (identifier) @name)) @decl"},
+		{"function", "(export_statement declaration: (lexical_declaration (variable_declarator name: (identifier) @name))) @decl"},
+	},
+	javaLanguage: {
+		{"type", "(class_declaration (modifiers) @mods name: (identifier) @name) @decl"},
+		{"type", "(interface_declaration (modifiers) @mods name: (identifier) @name) @decl"},
+		{"type", "(enum_declaration (modifiers) @mods name: (identifier) @name) @decl"},
+		{"type", "(record_declaration (modifiers) @mods name: (identifier) @name) @decl"},
+		{"method", "(method_declaration (modifiers) @mods name: (identifier) @name) @decl"},
+	},
+	csharpLanguage: {
+		{"type", "(class_declaration (modifier) @mods name: (identifier) @name) @decl"},
+		{"type", "(interface_declaration (modifier) @mods name: (identifier) @name) @decl"},
+		{"type", "(struct_declaration (modifier) @mods name: (identifier) @name) @decl"},
+		{"type", "(enum_declaration (modifier) @mods name: (identifier) @name) @decl"},
+		{"type", "(record_declaration (modifier) @mods name: (identifier) @name) @decl"},
+		{"method", "(method_declaration (modifier) @mods name: (identifier) @name) @decl"},
+	},
+}
+
+// endpointPattern recognizes a route or service registration. Named groups:
+// "method" (HTTP method), "path", and "service" (gRPC service name).
+type endpointPattern struct {
+	kind    string
+	method  string // Fixed HTTP method when the pattern has no method group
+	pattern *regexp.Regexp
+}
+
+// Route and service registrations of common frameworks
+var endpointPatterns = []endpointPattern{
+	// Go net/http, including Go 1.22 "METHOD /path" patterns
+	{"endpoint", "ANY", regexp.MustCompile(`\.(?:HandleFunc|Handle)\(\s*"(?:(?P<method>[A-Z]+)\s+)?(?P<path>/[^"]*)"`)},
+	// Go gin, echo, chi, fiber
+	{"endpoint", "", regexp.MustCompile(`\.(?P<method>GET|POST|PUT|PATCH|DELETE|Get|Post|Put|Patch|Delete)\(\s*"(?P<path>/[^"]*)"`)},
+	// Express
+	{"endpoint", "", regexp.MustCompile(`\b(?:app|router|server)\.(?P<method>get|post|put|patch|delete|all)\(\s*['"` + "`" + `](?P<path>/[^'"` + "`" + `]*)`)},
+	// Flask
+	{"endpoint", "GET", regexp.MustCompile(`@\w+\.route\(\s*['"](?P<path>[^'"]+)['"](?:.*methods\s*=\s*\[(?P<method>[^\]]*)\])?`)},
+	// FastAPI
+	{"endpoint", "", regexp.MustCompile(`@\w+\.(?P<method>get|post|put|patch|delete)\(\s*['"](?P<path>[^'"]+)`)},
+	// Spring
+	{"endpoint", "", regexp.MustCompile(`@(?P<method>Get|Post|Put|Patch|Delete|Request)Mapping\(\s*(?:(?:value|path)\s*=\s*)?"(?P<path>[^"]*)"`)},
+	// ASP.NET
+	{"endpoint", "", regexp.MustCompile(`\[Http(?P<method>Get|Post|Put|Patch|Delete)\(\s*"(?P<path>[^"]*)"`)},
+	// gRPC service registrations
+	{"grpc", "", regexp.MustCompile(`\bRegister(?P<service>\w+)Server\(`)},
+	{"grpc", "", regexp.MustCompile(`\badd_(?P<service>\w+)Servicer_to_server\(`)},
+	{"grpc", "", regexp.MustCompile(`extends\s+(?P<service>\w+)Grpc\.\w+ImplBase`)},
+}
+
+// Lines of a declaration kept for describing it
+const declarationLines = 15
+
+// ExtractAPISymbols returns the exported functions, methods, and types of a
+// file, found with Tree-sitter queries, plus the HTTP and gRPC endpoints it
+// registers. Packages not declared are named after the file's directory
+// relative to root. Files without a grammar yield endpoints only.
+func ExtractAPISymbols(filePath, root, content string) ([]APISymbol, error) {
+	lines := strings.Split(content, "\n")
+	var symbols []APISymbol
+	var pkg string
+
+	if language := languageForFile(filePath); language != nil {
+		tree, err := parseContent(language, content)
+		if err != nil {
+			return nil, err
+		}
+		defer tree.Close()
+
+		rootNode := tree.RootNode()
+		pkg = detectPackage(filePath, root, content, rootNode, language)
+		symbols = append(symbols, extractDeclarations(filePath, content, lines, rootNode, language)...)
+	}
+
+	symbols = append(symbols, extractEndpoints(filePath, lines)...)
+	for i := range symbols {
+		symbols[i].Package = pkg
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return symbols[i].Line < symbols[j].Line
+	})
+	return symbols, nil
+}
+
+// extractDeclarations runs the language's symbol queries and keeps public declarations
+func extractDeclarations(filePath, content string, lines []string, rootNode *sitter.Node, language *sitter.Language) []APISymbol {
+	var symbols []APISymbol
+	seen := make(map[uint32]int) // Declaration start byte -> index in symbols
+
+	cursor := acquireCursor()
+	defer releaseCursor(cursor)
+	for _, sq := range compiledSymbolQueries[language] {
+		query := sq.query
+		cursor.Exec(query, rootNode)
+
+		for {
+			match, ok := cursor.NextMatch()
+			if !ok {
+				break
+			}
+
+			var decl *sitter.Node
+			var name, mods string
+			for _, capture := range match.Captures {
+				text := content[capture.Node.StartByte():capture.Node.EndByte()]
+				switch query.CaptureNameForId(capture.Index) {
+				case "decl":
+					decl = capture.Node
+				case "name":
+					name = text
+				case "mods":
+					mods = text
+				}
+			}
+			if decl == nil || name == "" {
+				continue
+			}
+
+			// C# modifiers arrive one per match, so a declaration may match several times
+			if i, ok := seen[decl.StartByte()]; ok {
+				if i >= 0 || !isPublic(language, name, mods) {
+					continue
+				}
+			} else if !isPublic(language, name, mods) {
+				seen[decl.StartByte()] = -1
+				continue
+			}
+
+			row := int(decl.StartPoint().Row)
+			end := int(decl.EndPoint().Row)
+			if end-row >= declarationLines {
+				end = row + declarationLines - 1
+			}
+
+			symbol := APISymbol{
+				Kind:        sq.kind,
+				Name:        name,
+				Signature:   signatureLine(lines, row),
+				Declaration: strings.Join(lines[row:end+1], "\n"),
+				File:        filePath,
+				Line:        row + 1,
+			}
+			if receiver := decl.ChildByFieldName("receiver"); receiver != nil {
+				symbol.Receiver = receiverTypeName(content[receiver.StartByte():receiver.EndByte()])
+			} else if sq.kind == "method" {
+				symbol.Receiver = enclosingTypeName(decl, content)
+			}
+
+			// Methods on unexported Go types aren't part of the API
+			if language == goLanguage && symbol.Receiver != "" && !isExportedName(symbol.Receiver) {
+				seen[decl.StartByte()] = -1
+				continue
+			}
+
+			seen[decl.StartByte()] = len(symbols)
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	return symbols
+}
+
+// isPublic reports whether a declaration is visible outside its package or module
+func isPublic(language *sitter.Language, name, mods string) bool {
+	switch language {
+	case goLanguage:
+		return isExportedName(name)
+	case pythonLanguage:
+		return !strings.HasPrefix(name, "_")
+	case javaLanguage, csharpLanguage:
+		return strings.Contains(" "+mods+" ", " public ")
+	}
+	// JavaScript queries only match export statements
+	return true
+}
+
+// isExportedName reports whether a Go identifier starts with an upper-case letter
+func isExportedName(name string) bool {
+	for _, r := range name {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// enclosingTypeName returns the name of the class, interface, or struct declaring node
+func enclosingTypeName(node *sitter.Node, content string) string {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		if strings.HasSuffix(parent.Type(), "_declaration") || parent.Type() == "class_definition" {
+			if name := parent.ChildByFieldName("name"); name != nil {
+				return content[name.StartByte():name.EndByte()]
+			}
+		}
+	}
+	return ""
+}
+
+// extractEndpoints finds HTTP routes and gRPC service registrations line by line
+func extractEndpoints(filePath string, lines []string) []APISymbol {
+	var symbols []APISymbol
+
+	for i, line := range lines {
+		for _, ep := range endpointPatterns {
+			match := ep.pattern.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			group := func(name string) string {
+				if idx := ep.pattern.SubexpIndex(name); idx >= 0 {
+					return match[idx]
+				}
+				return ""
+			}
+
+			var name string
+			if ep.kind == "grpc" {
+				name = group("service")
+			} else {
+				method := strings.ToUpper(strings.Trim(group("method"), `"' `))
+				method = strings.NewReplacer(`"`, "", "'", "", " ", "").Replace(method)
+				if method == "" || method == "REQUEST" {
+					method = ep.method
+				}
+				if method == "" {
+					method = "ANY"
+				}
+				name = method + " " + group("path")
+			}
+
+			symbols = append(symbols, APISymbol{
+				Kind:      ep.kind,
+				Name:      name,
+				Signature: strings.TrimSpace(line),
+				File:      filePath,
+				Line:      i + 1,
+			})
+			break
+		}
+	}
+
+	return symbols
+}
@@ -0,0 +1,84 @@
+package embeddings
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Placeholders of an embedding template, filled in from a chunk
+var templateFields = map[string]func(c CodeChunkMetadata) string{
+	"path":     func(c CodeChunkMetadata) string { return c.Filename },
+	"language": func(c CodeChunkMetadata) string { return DetectLanguage(c.Filename) },
+	"package":  func(c CodeChunkMetadata) string { return c.Package },
+	"symbol":   chunkSymbol,
+	"scope":    func(c CodeChunkMetadata) string { return c.Scope },
+	"context":  func(c CodeChunkMetadata) string { return c.Context },
+	"content":  func(c CodeChunkMetadata) string { return c.Content },
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+var (
+	templateMutex     sync.RWMutex
+	embeddingTemplate string // Empty embeds the context header and content
+)
+
+// SetEmbeddingTemplate sets the layout of the text embedded for each chunk,
+// with placeholders such as "{path} | {symbol}\n{content}". An empty
+// template embeds the context header followed by the content. Changing it
+// changes every embedding, so indexes built with another need rebuilding.
+func SetEmbeddingTemplate(template string) error {
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := templateFields[match[1]]; !ok {
+			return fmt.Errorf("unknown placeholder {%s} in embedding template (available: {path}, {language}, {package}, {symbol}, {scope}, {context}, {content})", match[1])
+		}
+	}
+	if template != "" && !strings.Contains(template, "{content}") {
+		return fmt.Errorf("embedding template must include {content}")
+	}
+
+	templateMutex.Lock()
+	defer templateMutex.Unlock()
+	embeddingTemplate = template
+	return nil
+}
+
+// applyTemplate fills in a template's placeholders from a chunk. Lines
+// whose placeholders are all empty are dropped, labels and all, and lines
+// with some empty lose the separators left dangling at their end.
+func applyTemplate(template string, c CodeChunkMetadata) string {
+	var lines []string
+	for _, line := range strings.Split(template, "\n") {
+		placeholders, empty := 0, 0
+		filled := placeholder.ReplaceAllStringFunc(line, func(match string) string {
+			value := templateFields[match[1:len(match)-1]](c)
+			placeholders++
+			if value == "" {
+				empty++
+			}
+			return value
+		})
+		if empty > 0 {
+			if filled = strings.TrimRight(filled, " \t|,;:"); empty == placeholders || filled == "" {
+				continue
+			}
+		}
+		lines = append(lines, filled)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// chunkSymbol returns the name of a chunk's function, qualified by its
+// class, or of its class
+func chunkSymbol(c CodeChunkMetadata) string {
+	switch {
+	case c.Class != "" && c.Function != "":
+		return c.Class + "." + c.Function
+	case c.Function != "":
+		return c.Function
+	default:
+		return c.Class
+	}
+}
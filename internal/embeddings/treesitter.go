@@ -3,31 +3,43 @@ package embeddings
 import (
 	"context"
 	"fmt"
-	"log"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/csharp"
 	"github.com/smacker/go-tree-sitter/golang"
+	"github.com/smacker/go-tree-sitter/java"
 	"github.com/smacker/go-tree-sitter/javascript"
 	"github.com/smacker/go-tree-sitter/python"
 )
 
+// Tree-sitter languages. GetLanguage returns a new pointer on every call, so
+// each language is created once and shared as a map key.
+var (
+	goLanguage         = golang.GetLanguage()
+	pythonLanguage     = python.GetLanguage()
+	javascriptLanguage = javascript.GetLanguage()
+	javaLanguage       = java.GetLanguage()
+	csharpLanguage     = csharp.GetLanguage()
+)
+
 // Language-specific Tree-sitter queries
 var languageQueries = map[*sitter.Language][]string{
-	golang.GetLanguage(): {
+	goLanguage: {
 		// Functions
 		"(function_declaration name: (identifier) @function_name) @function_def",
 		// Methods
 		"(method_declaration name: (field_identifier) @method_name) @method_def",
 		// Structs
-		"(type_declaration (type_spec name: (identifier) @struct_name type: (struct_type)) @struct_def)",
+		"(type_declaration (type_spec name: (type_identifier) @struct_name type: (struct_type)) @struct_def)",
 		// Imports
 		"(import_declaration) @import",
 	},
-	python.GetLanguage(): {
+	pythonLanguage: {
 		// Functions
 		"(function_definition name: (identifier) @function_name) @function_def",
 		// Classes
@@ -36,102 +48,347 @@ var languageQueries = map[*sitter.Language][]string{
 		"(import_statement) @import",
 		"(import_from_statement) @import",
 	},
-	javascript.GetLanguage(): {
+	javascriptLanguage: {
 		// Functions - including arrow functions
 		"(function_declaration name: (identifier) @function_name) @function_def",
 		"(arrow_function) @function_def",
-		"(function) @function_def",
+		"(function_expression) @function_def",
 		// Classes
 		"(class_declaration name: (identifier) @class_name) @class_def",
 		// Methods
 		"(method_definition name: (property_identifier) @method_name) @method_def",
 		// Variable declarations with functions
-		"(variable_declarator name: (identifier) @var_name value: [(function) (arrow_function)]) @function_def",
+		"(variable_declarator name: (identifier) @var_name value: [(function_expression) (arrow_function)]) @function_def",
 		// Imports
 		"(import_statement) @import",
 	},
+	javaLanguage: {
+		// Methods and constructors
+		"(method_declaration name: (identifier) @method_name) @method_def",
+		"(constructor_declaration name: (identifier) @method_name) @method_def",
+		// Classes, interfaces, enums, and records
+		"(class_declaration name: (identifier) @class_name) @class_def",
+		"(interface_declaration name: (identifier) @class_name) @class_def",
+		"(enum_declaration name: (identifier) @class_name) @class_def",
+		"(record_declaration name: (identifier) @class_name) @class_def",
+		// Imports
+		"(import_declaration) @import",
+	},
+	csharpLanguage: {
+		// Methods and constructors
+		"(method_declaration name: (identifier) @method_name) @method_def",
+		"(constructor_declaration name: (identifier) @method_name) @method_def",
+		// Classes, interfaces, structs, enums, and records
+		"(class_declaration name: (identifier) @class_name) @class_def",
+		"(interface_declaration name: (identifier) @class_name) @class_def",
+		"(struct_declaration name: (identifier) @struct_name) @struct_def",
+		"(enum_declaration name: (identifier) @class_name) @class_def",
+		"(record_declaration name: (identifier) @class_name) @class_def",
+		// Imports
+		"(using_directive) @import",
+	},
 }
 
-// Cached parsers to avoid recreating them for each file
-var parserCache = make(map[*sitter.Language]*sitter.Parser)
-var parserMutex sync.Mutex
+// Language-specific queries for the declared package, module, or namespace
+var packageQueries = map[*sitter.Language]string{
+	goLanguage:     "(package_clause (package_identifier) @package)",
+	javaLanguage:   "(package_declaration [(scoped_identifier) (identifier)] @package)",
+	csharpLanguage: "[(namespace_declaration name: (_) @package) (file_scoped_namespace_declaration name: (_) @package)]",
+}
 
-// extractSemanticChunksWithTreeSitter uses Tree-sitter to parse code and extract meaningful chunks
-func extractSemanticChunksWithTreeSitter(filePath string, content string) ([]CodeChunkMetadata, error) {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	filename := filepath.Base(filePath)
-	
-	var language *sitter.Language
-	
-	// Select the appropriate Tree-sitter language parser
-	switch ext {
-	case ".go":
-		language = golang.GetLanguage()
-	case ".py":
-		language = python.GetLanguage()
-	case ".js", ".ts", ".jsx", ".tsx":
-		language = javascript.GetLanguage()
-	default:
-		// Fall back to generic chunking for unsupported languages
-		return extractGenericChunks(filename, strings.Split(content, "\n"))
-	}
-	
-	// Use or create a parser from cache with mutex protection
-	parserMutex.Lock()
-	var parser *sitter.Parser
-	var ok bool
-	
-	if parser, ok = parserCache[language]; !ok {
-		parser = sitter.NewParser()
-		parser.SetLanguage(language)
-		parserCache[language] = parser
+// Language-specific queries for the names of called functions and methods.
+// Go selectors also capture their operand, so a call of an imported
+// package's function is recorded qualified, as pkg.Fn.
+var callQueries = map[*sitter.Language]string{
+	goLanguage:         "(call_expression function: [(identifier) @callee (selector_expression operand: (_) @qualifier field: (field_identifier) @callee)])",
+	pythonLanguage:     "(call function: [(identifier) @callee (attribute attribute: (identifier) @callee)])",
+	javascriptLanguage: "(call_expression function: [(identifier) @callee (member_expression property: (property_identifier) @callee)])",
+	javaLanguage:       "(method_invocation name: (identifier) @callee)",
+	csharpLanguage:     "(invocation_expression function: [(identifier) @callee (member_access_expression name: (identifier) @callee)])",
+}
+
+// Pools of parsers per language, so concurrent workers each parse with a
+// parser of their own without recreating one for every file
+var parserPools sync.Map // *sitter.Language -> *sync.Pool
+
+// Time limit of a single parse
+const parseTimeout = 5 * time.Second
+
+// definition is a function, method, class, or struct found in the syntax tree
+type definition struct {
+	kind       nodeType
+	name       string
+	receiver   string // Receiver type name for Go methods
+	startByte  uint32
+	endByte    uint32
+	startRow   int
+	endRow     int
+	parent     *definition // Enclosing class or struct, if any
+	hasMembers bool        // Whether methods or nested classes were found inside
+}
+
+// isContainer reports whether the definition can hold member definitions
+func (d *definition) isContainer() bool {
+	return d.kind == classNode || d.kind == structNode
+}
+
+// contains reports whether other lies entirely within d
+func (d *definition) contains(other *definition) bool {
+	return d.startByte <= other.startByte && other.endByte <= d.endByte
+}
+
+// Tree-sitter grammar of each language that has one
+var grammars = map[string]*sitter.Language{
+	"go":         goLanguage,
+	"python":     pythonLanguage,
+	"javascript": javascriptLanguage,
+	"typescript": javascriptLanguage,
+	"java":       javaLanguage,
+	"csharp":     csharpLanguage,
+}
+
+// languageForFile returns the Tree-sitter language for a file, or nil if
+// the file type has no grammar
+func languageForFile(filePath string) *sitter.Language {
+	return grammars[DetectLanguage(filePath)]
+}
+
+// parserPool returns the pool of parsers for a language
+func parserPool(language *sitter.Language) *sync.Pool {
+	if pool, ok := parserPools.Load(language); ok {
+		return pool.(*sync.Pool)
 	}
-	parserMutex.Unlock()
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	pool, _ := parserPools.LoadOrStore(language, &sync.Pool{
+		New: func() any {
+			parser := sitter.NewParser()
+			parser.SetLanguage(language)
+			// A cancelable context would leave a reused parser's cancellation
+			// flag set once it expires, failing every later parse, so the
+			// time limit is set on the parser instead
+			parser.SetOperationLimit(int(parseTimeout.Microseconds()))
+			return parser
+		},
+	})
+	return pool.(*sync.Pool)
+}
+
+// parseContent parses content with a pooled parser for the language. Parsers
+// are not safe for concurrent use, so each is held by one caller at a time.
+func parseContent(language *sitter.Language, content string) (*sitter.Tree, error) {
+	pool := parserPool(language)
+	parser := pool.Get().(*sitter.Parser)
 	
-	tree, err := parser.ParseCtx(ctx, nil, []byte(content))
+	tree, err := parser.ParseCtx(context.Background(), nil, []byte(content))
 	if err != nil {
+		// A halted parser keeps its partial state, so it isn't reused
+		parser.Close()
 		return nil, fmt.Errorf("tree-sitter parsing failed: %w", err)
 	}
+	pool.Put(parser)
+	return tree, nil
+}
+
+// TreeSitterChunker parses code with a Tree-sitter grammar and chunks it by
+// its functions, methods, and classes
+type TreeSitterChunker struct {
+	Language *sitter.Language
+}
+
+// Chunk splits content by its definitions, falling back to generic chunking
+// when the grammar finds none
+func (c TreeSitterChunker) Chunk(filePath, content string, options ChunkOptions) ([]CodeChunkMetadata, error) {
+	tree, err := parseContent(c.Language, content)
+	if err != nil {
+		return nil, err
+	}
 	defer tree.Close()
 	
 	rootNode := tree.RootNode()
 	
 	// Extract chunks based on language-specific AST queries
-	chunks, err := extractChunksFromAST(filename, content, rootNode, language)
+	chunks, err := extractChunksFromAST(filePath, content, rootNode, c.Language, options)
 	if err != nil {
 		return nil, err
 	}
 	
 	// If no chunks were found, fall back to generic chunking
 	if len(chunks) == 0 {
-		return extractGenericChunks(filename, strings.Split(content, "\n"))
+		return GenericChunker{}.Chunk(filePath, content, options)
 	}
 	
 	return chunks, nil
 }
 
-// extractChunksFromAST extracts code chunks from the AST using language-specific queries
-func extractChunksFromAST(filename, content string, rootNode *sitter.Node, language *sitter.Language) ([]CodeChunkMetadata, error) {
-	var chunks []CodeChunkMetadata
+// extractChunksFromAST extracts code chunks from the AST using language-specific queries.
+// Functions and methods become their own chunks; class bodies outside their
+// methods and top-level code outside any definition are chunked generically
+// so nothing in the file is lost.
+func extractChunksFromAST(filePath, content string, rootNode *sitter.Node, language *sitter.Language, options ChunkOptions) ([]CodeChunkMetadata, error) {
 	lines := strings.Split(content, "\n")
 	
-	// Get queries for this language
-	queries, ok := languageQueries[language]
-	if !ok {
-		return nil, fmt.Errorf("no queries defined for language")
+	defs, err := collectDefinitions(content, rootNode, language)
+	if err != nil {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		return nil, nil
+	}
+	
+	pkg := detectPackage(filePath, options.Root, content, rootNode, language)
+	accepted := nestDefinitions(defs)
+	
+	// Signatures of top-level types, used to describe the scope of Go methods
+	typeSignatures := make(map[string]string)
+	for _, def := range accepted {
+		if def.isContainer() && def.parent == nil && def.name != "" {
+			typeSignatures[def.name] = signatureLine(lines, def.startRow)
+		}
+	}
+	
+	var chunks []CodeChunkMetadata
+	covered := make([]bool, len(lines))
+	
+	addChunks := func(start, end int, function, class, scope string) {
+		for _, chunk := range chunkLineRange(filePath, lines, start, end, options) {
+			if isTrivialChunk(chunk.Content) {
+				continue
+			}
+			chunk.Package = pkg
+			chunk.Function = function
+			chunk.Class = class
+			chunk.Scope = scope
+			chunks = append(chunks, chunk)
+		}
+		for row := start; row < end && row < len(lines); row++ {
+			covered[row] = true
+		}
+	}
+	
+	// Functions, methods, and classes without members
+	for _, def := range accepted {
+		if def.isContainer() && def.hasMembers {
+			continue
+		}
+		
+		var function, class, scope string
+		if def.isContainer() {
+			class = def.name
+		} else {
+			function = def.name
+		}
+		if def.parent != nil {
+			scope = signatureLine(lines, def.parent.startRow)
+			if class == "" {
+				class = def.parent.name
+			}
+		} else if def.receiver != "" {
+			class = def.receiver
+			scope = typeSignatures[def.receiver]
+		}
+		
+		addChunks(leadingCommentStart(lines, covered, def.startRow), def.endRow+1, function, class, scope)
 	}
 	
-	for _, queryStr := range queries {
-		query, err := sitter.NewQuery([]byte(queryStr), language)
-		if err != nil {
-			log.Printf("Error creating query '%s': %v", queryStr, err)
+	// Remaining lines of classes with members, innermost classes first
+	for i := len(accepted) - 1; i >= 0; i-- {
+		def := accepted[i]
+		if !def.isContainer() || !def.hasMembers {
 			continue
 		}
 		
-		cursor := sitter.NewQueryCursor()
+		var scope string
+		if def.parent != nil {
+			scope = signatureLine(lines, def.parent.startRow)
+		}
+		start := leadingCommentStart(lines, covered, def.startRow)
+		for _, gap := range uncoveredRuns(covered, start, def.endRow+1) {
+			addChunks(gap[0], gap[1], "", def.name, scope)
+		}
+	}
+	
+	// Top-level code outside any definition (imports, constants, etc.)
+	for _, gap := range uncoveredRuns(covered, 0, len(lines)) {
+		addChunks(gap[0], gap[1], "", "", "")
+	}
+	
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].StartLine < chunks[j].StartLine
+	})
+	attachCalls(chunks, content, rootNode, language)
+	
+	return chunks, nil
+}
+
+// attachCalls records on each function chunk the names of the functions and
+// methods called within its lines. A call through a selector on a plain
+// identifier, such as strings.Split or h.serve, keeps the identifier as a
+// qualifier, leaving it to the graph to tell packages from values.
+func attachCalls(chunks []CodeChunkMetadata, content string, rootNode *sitter.Node, language *sitter.Language) {
+	query, ok := compiledCallQueries[language]
+	if !ok {
+		return
+	}
+	cursor := acquireCursor()
+	defer releaseCursor(cursor)
+	cursor.Exec(query, rootNode)
+	
+	type call struct {
+		row  int
+		name string
+	}
+	var calls []call
+	for {
+		match, ok := cursor.NextMatch()
+		if !ok {
+			break
+		}
+		var qualifier string
+		for _, capture := range match.Captures {
+			node := capture.Node
+			text := content[node.StartByte():node.EndByte()]
+			switch query.CaptureNameForId(capture.Index) {
+			case "qualifier":
+				if node.Type() == "identifier" {
+					qualifier = text
+				}
+			case "callee":
+				if qualifier != "" {
+					text = qualifier + "." + text
+				}
+				calls = append(calls, call{int(node.StartPoint().Row), text})
+			}
+		}
+	}
+	
+	for i := range chunks {
+		if chunks[i].Function == "" {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, c := range calls {
+			// Chunk lines are 1-indexed
+			if c.row+1 >= chunks[i].StartLine && c.row+1 <= chunks[i].EndLine && !seen[c.name] {
+				seen[c.name] = true
+				chunks[i].Calls = append(chunks[i].Calls, c.name)
+			}
+		}
+	}
+}
+
+// collectDefinitions runs the language's queries and returns every captured definition
+func collectDefinitions(content string, rootNode *sitter.Node, language *sitter.Language) ([]*definition, error) {
+	// Get queries for this language
+	queries := chunkQueriesFor(language)
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries defined for language")
+	}
+	
+	var defs []*definition
+	seen := make(map[[2]uint32]bool)
+	
+	cursor := acquireCursor()
+	defer releaseCursor(cursor)
+	for _, query := range queries {
 		cursor.Exec(query, rootNode)
 		
 		for {
@@ -140,6 +397,9 @@ func extractChunksFromAST(filename, content string, rootNode *sitter.Node, langu
 				break
 			}
 			
+			var def *definition
+			var name string
+			
 			for _, capture := range match.Captures {
 				node := capture.Node
 				
@@ -148,63 +408,168 @@ func extractChunksFromAST(filename, content string, rootNode *sitter.Node, langu
 				
 				if strings.HasSuffix(captureName, "_def") {
 					// This is a definition node (function, class, etc.)
-					nodeStart := node.StartPoint()
-					nodeEnd := node.EndPoint()
-					
-					var chunk CodeChunkMetadata
-					chunk.Filename = filename
-					chunk.StartLine = int(nodeStart.Row) + 1 // Convert to 1-indexed
-					chunk.EndLine = int(nodeEnd.Row) + 1     // Convert to 1-indexed
-					
-					// Get the actual code content - fix index calculation
-					nodeContent := getNodeContent(lines, nodeStart.Row, nodeEnd.Row)
-					chunk.Content = nodeContent
-					
-					// Find the name capture if present
-					for _, nameCapture := range match.Captures {
-						nameCaptureType := query.CaptureNameForId(nameCapture.Index)
-						if strings.HasSuffix(nameCaptureType, "_name") {
-							name := content[nameCapture.Node.StartByte():nameCapture.Node.EndByte()]
-							
-							if strings.Contains(captureName, "function") || strings.Contains(captureName, "method") {
-								chunk.Function = name
-							} else if strings.Contains(captureName, "class") || strings.Contains(captureName, "struct") {
-								chunk.Class = name
-							}
-						}
+					def = &definition{
+						kind:      nodeType(strings.TrimSuffix(captureName, "_def")),
+						startByte: node.StartByte(),
+						endByte:   node.EndByte(),
+						startRow:  int(node.StartPoint().Row),
+						endRow:    int(node.EndPoint().Row),
 					}
-					
-					// Only add if there's actual content
-					if len(strings.TrimSpace(chunk.Content)) > 0 {
-						chunks = append(chunks, chunk)
+					if receiver := node.ChildByFieldName("receiver"); receiver != nil {
+						def.receiver = receiverTypeName(content[receiver.StartByte():receiver.EndByte()])
 					}
+				} else if strings.HasSuffix(captureName, "_name") {
+					name = content[node.StartByte():node.EndByte()]
 				}
 			}
+			
+			if def == nil {
+				continue
+			}
+			
+			key := [2]uint32{def.startByte, def.endByte}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			
+			def.name = name
+			defs = append(defs, def)
 		}
 	}
 	
-	return chunks, nil
+	return defs, nil
 }
 
-// getNodeContent extracts text content from source lines for a node
-func getNodeContent(lines []string, startRow, endRow uint32) string {
-	// Fix for zero-based indexing
-	if int(startRow) >= len(lines) {
-		return ""
+// nestDefinitions resolves how definitions nest inside one another. Members of
+// classes and structs are kept and linked to their parent; definitions nested
+// inside functions are dropped since they're already part of the function's chunk.
+func nestDefinitions(defs []*definition) []*definition {
+	sort.SliceStable(defs, func(i, j int) bool {
+		if defs[i].startByte != defs[j].startByte {
+			return defs[i].startByte < defs[j].startByte
+		}
+		return defs[i].endByte > defs[j].endByte
+	})
+	
+	var accepted []*definition
+	var stack []*definition // Accepted definitions enclosing the current one
+	
+	for _, def := range defs {
+		for len(stack) > 0 && !stack[len(stack)-1].contains(def) {
+			stack = stack[:len(stack)-1]
+		}
+		
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			if !parent.isContainer() {
+				continue
+			}
+			def.parent = parent
+			parent.hasMembers = true
+		}
+		
+		accepted = append(accepted, def)
+		stack = append(stack, def)
 	}
 	
-	endIdx := int(endRow)
-	if endIdx >= len(lines) {
-		endIdx = len(lines) - 1
+	return accepted
+}
+
+// uncoveredRuns returns [start, end) ranges of rows in [from, to) not yet covered
+func uncoveredRuns(covered []bool, from, to int) [][2]int {
+	var runs [][2]int
+	to = min(to, len(covered))
+	
+	runStart := -1
+	for row := from; row < to; row++ {
+		if !covered[row] && runStart < 0 {
+			runStart = row
+		} else if covered[row] && runStart >= 0 {
+			runs = append(runs, [2]int{runStart, row})
+			runStart = -1
+		}
+	}
+	if runStart >= 0 {
+		runs = append(runs, [2]int{runStart, to})
 	}
 	
-	// Handle single-line nodes correctly
-	if startRow == endRow {
-		if int(startRow) < len(lines) {
-			return lines[startRow]
+	return runs
+}
+
+// leadingCommentStart returns the first row of the comment, decorator, or
+// annotation lines directly above row, so they stay with their definition
+func leadingCommentStart(lines []string, covered []bool, row int) int {
+	start := row
+	for start > 0 && !covered[start-1] {
+		trimmed := strings.TrimSpace(lines[start-1])
+		if !strings.HasPrefix(trimmed, "//") && !strings.HasPrefix(trimmed, "#") &&
+			!strings.HasPrefix(trimmed, "/*") && !strings.HasPrefix(trimmed, "*") &&
+			!strings.HasPrefix(trimmed, "@") {
+			break
 		}
+		start--
+	}
+	return start
+}
+
+// signatureLine returns the first line of a definition without its opening brace
+func signatureLine(lines []string, row int) string {
+	if row < 0 || row >= len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(lines[row]), "{"))
+}
+
+// receiverTypeName extracts the type name from a Go method receiver such as "(s *Server[T])"
+func receiverTypeName(receiver string) string {
+	receiver = strings.Trim(receiver, "() \t")
+	fields := strings.Fields(receiver)
+	if len(fields) == 0 {
 		return ""
 	}
 	
-	return strings.Join(lines[startRow:endIdx+1], "\n")
-}
\ No newline at end of file
+	typeName := strings.TrimLeft(fields[len(fields)-1], "*")
+	if idx := strings.Index(typeName, "["); idx >= 0 {
+		typeName = typeName[:idx]
+	}
+	return typeName
+}
+
+// detectPackage returns the package or namespace the file declares, falling
+// back to a package path derived from the file's directory under root
+func detectPackage(filePath, root, content string, rootNode *sitter.Node, language *sitter.Language) string {
+	if query, ok := compiledPackageQueries[language]; ok {
+		cursor := acquireCursor()
+		defer releaseCursor(cursor)
+		cursor.Exec(query, rootNode)
+		
+		if match, ok := cursor.NextMatch(); ok && len(match.Captures) > 0 {
+			node := match.Captures[0].Node
+			return content[node.StartByte():node.EndByte()]
+		}
+	}
+	
+	return packagePath(filePath, root, language)
+}
+
+// packagePath derives a package name from a file's directory relative to
+// root, e.g. "app/models/user.py" -> "app.models" for Python or
+// "src/components" otherwise. Files outside root keep their directory.
+func packagePath(filePath, root string, language *sitter.Language) string {
+	dir := filepath.Dir(filePath)
+	if root != "" {
+		if rel, err := filepath.Rel(root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			dir = rel
+		}
+	}
+	dir = strings.TrimPrefix(filepath.ToSlash(dir), "./")
+	if dir == "." {
+		dir = ""
+	}
+	
+	if language == pythonLanguage {
+		dir = strings.ReplaceAll(dir, "/", ".")
+	}
+	return dir
+}
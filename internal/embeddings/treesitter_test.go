@@ -0,0 +1,148 @@
+package embeddings
+
+import (
+	"maps"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// Sources of each language with a pooled parser, keyed by file name
+var treeSitterSources = map[string]string{
+	"server/handler.go": `package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Handler serves greetings
+type Handler struct {
+	name string
+}
+
+// ServeHTTP greets the caller
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "hello from %s", h.name)
+}
+
+func newHandler(name string) *Handler {
+	return &Handler{name: name}
+}
+`,
+	"app/models/user.py": `import json
+
+
+class User:
+    def __init__(self, name):
+        self.name = name
+
+    def to_json(self):
+        return json.dumps({"name": self.name})
+
+
+def load(data):
+    return User(json.loads(data)["name"])
+`,
+	"src/cart.js": `import { format } from "./money";
+
+export class Cart {
+  constructor() {
+    this.items = [];
+  }
+
+  add(item) {
+    this.items.push(item);
+  }
+
+  total() {
+    return format(this.items.reduce((sum, item) => sum + item.price, 0));
+  }
+}
+
+function emptyCart() {
+  return new Cart();
+}
+`,
+}
+
+// TestExtractCodeChunksConcurrent chunks files of every pooled language from
+// many goroutines at once and checks each gets the chunks of a serial run.
+// Run it with the race detector, which checks that pooled parsers and query
+// cursors are never shared between goroutines:
+//
+//	go test -race -run TestExtractCodeChunksConcurrent ./internal/embeddings
+func TestExtractCodeChunksConcurrent(t *testing.T) {
+	options := ChunkOptions{MaxChunkSize: defaultMaxChunkSize}
+
+	want := make(map[string][]CodeChunkMetadata)
+	for file, content := range treeSitterSources {
+		chunks, err := ExtractCodeChunks(file, content, options)
+		if err != nil {
+			t.Fatalf("ExtractCodeChunks(%s): %v", file, err)
+		}
+		if len(chunks) == 0 {
+			t.Fatalf("ExtractCodeChunks(%s) returned no chunks", file)
+		}
+		want[file] = chunks
+	}
+
+	const workers = 16
+	const rounds = 20
+	var wg sync.WaitGroup
+	errs := make(chan string, workers*rounds*len(treeSitterSources))
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				for file, content := range treeSitterSources {
+					chunks, err := ExtractCodeChunks(file, content, options)
+					if err != nil {
+						errs <- file + ": " + err.Error()
+					} else if !reflect.DeepEqual(chunks, want[file]) {
+						errs <- file + ": chunks differ from a serial run"
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// BenchmarkExtractCodeChunks measures chunking this package's largest
+// Tree-sitter source and a short file of each pooled language, which reuse
+// compiled queries, query cursors, and parsers:
+//
+//	go test -run XXX -bench ExtractCodeChunks -count 3 ./internal/embeddings
+func BenchmarkExtractCodeChunks(b *testing.B) {
+	sources := map[string]string{}
+	for file, content := range treeSitterSources {
+		sources[file] = content
+	}
+	content, err := os.ReadFile("treesitter.go")
+	if err != nil {
+		b.Fatal(err)
+	}
+	sources["treesitter.go"] = string(content)
+
+	options := ChunkOptions{MaxChunkSize: defaultMaxChunkSize}
+	for _, file := range slices.Sorted(maps.Keys(sources)) {
+		content := sources[file]
+		b.Run(path.Base(file), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := ExtractCodeChunks(file, content, options); err != nil {
+					b.Fatalf("ExtractCodeChunks(%s): %v", file, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fileutils
+
+import "os"
+
+// fileID identifies the file behind info by its path with symlinks
+// resolved, as inodes aren't available on this platform
+func fileID(path string, info os.FileInfo) string {
+	return resolvedPath(path)
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package fileutils
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID identifies the file behind info by its device and inode, so a
+// directory reached through several symlinks is recognized
+func fileID(path string, info os.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+	}
+	return resolvedPath(path)
+}
@@ -3,13 +3,19 @@ package fileutils
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/exolottl/codie/internal/metrics"
 )
 
 // Common code file extensions to process
@@ -33,9 +39,16 @@ var codeExtensions = map[string]bool{
 	".kt":    true,
 }
 
+// Documentation file extensions, indexed alongside the code they describe
+var docExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+}
+
 // Common directories to skip
 var skipDirs = map[string]bool{
 	".git":         true,
+	".codie":       true,
 	"node_modules": true,
 	"venv":         true,
 	"__pycache__":  true,
@@ -45,6 +58,63 @@ var skipDirs = map[string]bool{
 	".vscode":      true,
 }
 
+// User-configured glob patterns of paths to skip
+var ignorePatterns []string
+
+// Whether traversal follows symlinks to files and directories
+var followSymlinks bool
+
+// SetIgnorePatterns sets glob patterns of files and directories to skip during
+// traversal, matched with MatchPath against paths relative to the traversal root.
+func SetIgnorePatterns(patterns []string) {
+	ignorePatterns = patterns
+}
+
+// SetFollowSymlinks sets whether traversal follows symlinks. They are
+// skipped by default.
+func SetFollowSymlinks(follow bool) {
+	followSymlinks = follow
+}
+
+// IsSkippedDir reports whether a directory name is excluded from traversal
+func IsSkippedDir(name string) bool {
+	return skipDirs[name] || (skipVendored && vendoredDirs[name])
+}
+
+// IsCodeFile reports whether a path relative to root would be indexed: it is
+// code or an infrastructure definition, isn't under a skipped directory, isn't ignored, and
+// isn't skipped as generated
+func IsCodeFile(root, path string) bool {
+	if !hasIndexedType(filepath.Join(root, path)) || isIgnored(root, filepath.Join(root, path)) {
+		return false
+	}
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if IsSkippedDir(dir) {
+			return false
+		}
+	}
+	return !isSkippedGenerated(filepath.Join(root, path))
+}
+
+// isIgnored reports whether a path under root matches a configured ignore pattern
+func isIgnored(root, path string) bool {
+	if len(ignorePatterns) == 0 {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, pattern := range ignorePatterns {
+		if MatchPath(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
 // ContentCache provides file content caching
 type ContentCache struct {
 	cache  map[string]CachedContent
@@ -72,6 +142,17 @@ func NewContentCache(maxAge time.Duration) *ContentCache {
 
 // Get retrieves content from cache if available and not expired
 func (c *ContentCache) Get(filePath string) (string, bool) {
+	content, found := c.lookup(filePath)
+	if found {
+		metrics.ContentCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		metrics.ContentCacheLookups.WithLabelValues("miss").Inc()
+	}
+	return content, found
+}
+
+// lookup returns a file's cached content if it is fresh
+func (c *ContentCache) lookup(filePath string) (string, bool) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
@@ -146,113 +227,286 @@ var bufferPool = sync.Pool{
 	},
 }
 
-// GetCodeFiles returns a list of code files in the given directory (serial version)
+// GetCodeFiles returns the code files under root, in the order of a
+// depth-first walk in lexical order. Directories are read in parallel,
+// except when following symlinks: a directory linked from several places
+// is then always listed under the path the serial walk reaches first.
 func GetCodeFiles(root string) ([]string, error) {
+	if followSymlinks {
+		return getCodeFilesSerial(root)
+	}
+	return GetCodeFilesParallel(root, 0)
+}
+
+// getCodeFilesSerial returns the code files under root, walking one
+// directory at a time
+func getCodeFilesSerial(root string) ([]string, error) {
 	// Pre-allocate slice with reasonable capacity
 	files := make([]string, 0, 1000)
-	
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	err := walkCodeTree(root, func(path string) {
+		if hasIndexedType(path) && !isSkippedGenerated(path) {
+			files = append(files, path)
+		}
+	}, nil)
+	return files, err
+}
+
+// walkCodeTree calls visitFile with each file and visitDir, if set, with
+// each directory under root that indexing traverses, in lexical order.
+// Skipped and ignored directories are pruned. Symlinks are skipped unless
+// SetFollowSymlinks enabled following them, in which case each directory is
+// visited once, so symlink cycles end. A directory that can't be read is
+// skipped, and its error returned along with those of the others.
+func walkCodeTree(root string, visitFile func(path string), visitDir func(path string)) error {
+	visited := make(map[string]bool)
+	var errs []error
+	var walk func(dir string)
+	walk = func(dir string) {
+		if followSymlinks {
+			info, err := os.Stat(dir)
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			id := fileID(dir, info)
+			if visited[id] {
+				return
+			}
+			visited[id] = true
+		}
+		if visitDir != nil {
+			visitDir(dir)
+		}
+
+		entries, err := os.ReadDir(dir)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			return
 		}
-		
-		// Skip directories we want to exclude
-		if info.IsDir() {
-			if skipDirs[info.Name()] {
-				return filepath.SkipDir
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			isDir, ok := resolveEntry(path, entry)
+			if !ok || isIgnored(root, path) {
+				continue
+			}
+			if !isDir {
+				visitFile(path)
+			} else if !IsSkippedDir(entry.Name()) {
+				walk(path)
 			}
-			return nil
 		}
-		
-		// Check if file has code extension
-		ext := filepath.Ext(info.Name())
-		if codeExtensions[ext] {
-			files = append(files, path)
+	}
+	walk(root)
+	return errors.Join(errs...)
+}
+
+// resolveEntry reports whether a directory entry is a directory, following
+// it if it is a symlink, and whether traversal should visit it at all:
+// symlinks are visited only when followed, and only if their target exists
+func resolveEntry(path string, entry os.DirEntry) (isDir, ok bool) {
+	if entry.Type()&os.ModeSymlink == 0 {
+		return entry.IsDir(), true
+	}
+	if !followSymlinks {
+		return false, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, false
+	}
+	return info.IsDir(), true
+}
+
+// resolvedPath returns path with symlinks resolved, or path itself if that
+// fails
+func resolvedPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// GetGitFiles returns the code files under root that git tracks, so untracked
+// build output and files matched by .gitignore are left out. Files deleted
+// from the working tree but not yet from the index are skipped as well.
+func GetGitFiles(root string) ([]string, error) {
+	cmd := exec.Command("git", "-C", root, "ls-files", "-z", "--cached")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git ls-files: %s", msg)
 		}
-		
-		return nil
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+
+	var files []string
+	for _, rel := range strings.Split(string(out), "\x00") {
+		if rel == "" || !IsCodeFile(root, filepath.FromSlash(rel)) {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		// Submodules and symlinks are tracked too, but aren't regular files;
+		// symlinks to files are kept when following symlinks
+		stat := os.Lstat
+		if followSymlinks {
+			stat = os.Stat
+		}
+		if info, err := stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// SkippedFile is a file left out of the index, with the reason
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// LimitFileSize splits files into those of at most maxSize bytes and those
+// skipped as larger, such as generated code and data dumps. A maxSize of 0
+// keeps every file.
+func LimitFileSize(files []string, maxSize int64) ([]string, []SkippedFile) {
+	if maxSize <= 0 {
+		return files, nil
+	}
+	kept := files[:0:0]
+	var skipped []SkippedFile
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.Size() > maxSize {
+			skipped = append(skipped, SkippedFile{
+				Path:   file,
+				Reason: fmt.Sprintf("%d bytes, more than max_file_size of %d", info.Size(), maxSize),
+			})
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept, skipped
+}
+
+// GetCodeDirs returns root and the directories below it that GetCodeFiles
+// traverses
+func GetCodeDirs(root string) ([]string, error) {
+	var dirs []string
+	err := walkCodeTree(root, func(string) {}, func(path string) {
+		dirs = append(dirs, path)
 	})
-	
-	return files, err
+	return dirs, err
 }
 
-// GetCodeFilesParallel returns a list of code files using concurrent directory traversal
+// GetCodeFilesParallel returns the code files under root, reading up to
+// maxWorkers directories at once (0 uses the number of CPUs). Files are
+// sorted in the order GetCodeFiles walks them, so runs are deterministic.
+// A directory that can't be read doesn't stop the others; the files found
+// are returned along with every error.
 func GetCodeFilesParallel(root string, maxWorkers int) ([]string, error) {
 	if maxWorkers <= 0 {
 		maxWorkers = runtime.NumCPU()
 	}
 
-	var files []string
-	var mutex sync.Mutex
-	errChan := make(chan error, 1)
-	
-	// Create a worker pool using semaphore pattern
-	sem := make(chan struct{}, maxWorkers)
+	// Workers take directories from a shared queue and queue the
+	// subdirectories they find, so no worker ever waits on another
+	var (
+		mu      sync.Mutex
+		ready   = sync.NewCond(&mu)
+		queue   = []string{root}
+		pending = 1 // Directories queued or being read
+		files   []string
+		errs    []error
+	)
+	var visited sync.Map // IDs of the directories reached, when following symlinks
+
 	var wg sync.WaitGroup
-	
-	// Process directories concurrently
-	var processDir func(path string)
-	processDir = func(path string) {
-		defer func() {
-			<-sem // Release the semaphore slot
-			wg.Done()
-		}()
-		
-		entries, err := os.ReadDir(path)
-		if err != nil {
-			select {
-			case errChan <- err:
-			default:
-			}
-			return
-		}
-		
-		// Process all directory entries
-		for _, entry := range entries {
-			entryPath := filepath.Join(path, entry.Name())
-			
-			if entry.IsDir() {
-				if skipDirs[entry.Name()] {
-					continue
+	for i := 0; i < maxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				for len(queue) == 0 && pending > 0 {
+					ready.Wait()
 				}
-				
-				wg.Add(1)
-				// Try to acquire a semaphore slot
-				select {
-				case sem <- struct{}{}:
-					// We got a slot, process in a new goroutine
-					go processDir(entryPath)
-				default:
-					// No free slots, process in the current goroutine
-					sem <- struct{}{} // Will block until a slot is available
-					processDir(entryPath)
+				if pending == 0 {
+					return
 				}
-			} else {
-				ext := filepath.Ext(entry.Name())
-				if codeExtensions[ext] {
-					mutex.Lock()
-					files = append(files, entryPath)
-					mutex.Unlock()
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+
+				mu.Unlock()
+				found, subdirs, err := readCodeDir(root, dir, &visited)
+				mu.Lock()
+
+				files = append(files, found...)
+				if err != nil {
+					errs = append(errs, err)
 				}
+				queue = append(queue, subdirs...)
+				pending += len(subdirs) - 1
+				ready.Broadcast()
 			}
-		}
+		}()
 	}
-	
-	// Start the root directory
-	wg.Add(1)
-	sem <- struct{}{} // Acquire a slot
-	go processDir(root)
-	
-	// Wait for all goroutines to finish
 	wg.Wait()
-	
-	// Check for errors
-	select {
-	case err := <-errChan:
-		return nil, err
-	default:
-		return files, nil
+
+	sortWalkOrder(files)
+	return files, errors.Join(errs...)
+}
+
+// readCodeDir returns the code files and the subdirectories to traverse in
+// one directory under root. A directory already in visited, when following
+// symlinks, is skipped.
+func readCodeDir(root, dir string, visited *sync.Map) (files, subdirs []string, err error) {
+	// A directory reached again through a symlink was already read
+	if followSymlinks {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, seen := visited.LoadOrStore(fileID(dir, info), true); seen {
+			return nil, nil, nil
+		}
 	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		isDir, ok := resolveEntry(path, entry)
+		if !ok || isIgnored(root, path) {
+			continue
+		}
+		if isDir {
+			if !IsSkippedDir(entry.Name()) {
+				subdirs = append(subdirs, path)
+			}
+		} else if hasIndexedType(path) && !isSkippedGenerated(path) {
+			files = append(files, path)
+		}
+	}
+	return files, subdirs, nil
+}
+
+// sortWalkOrder sorts paths in the order of a depth-first walk in lexical
+// order, comparing them one path element at a time
+func sortWalkOrder(paths []string) {
+	sort.Slice(paths, func(i, j int) bool {
+		a := strings.Split(paths[i], string(filepath.Separator))
+		b := strings.Split(paths[j], string(filepath.Separator))
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
 }
 
 // ReadFileContent reads a file and returns its content as a string
@@ -320,15 +574,17 @@ func ReadLargeFile(filePath string) (string, error) {
 	return buffer.String(), nil
 }
 
-// ReadFilesInParallel reads multiple files concurrently
+// ReadFilesInParallel reads multiple files concurrently. Files that can't be
+// read are left out, and their errors returned along with the contents
+// of the others.
 func ReadFilesInParallel(filePaths []string, maxWorkers int) (map[string]string, error) {
 	if maxWorkers <= 0 {
 		maxWorkers = runtime.NumCPU()
 	}
 	
 	results := make(map[string]string)
+	var errs []error
 	var mutex sync.Mutex
-	errChan := make(chan error, 1)
 	
 	// Create worker pool
 	jobs := make(chan string, len(filePaths))
@@ -341,16 +597,13 @@ func ReadFilesInParallel(filePaths []string, maxWorkers int) (map[string]string,
 			defer wg.Done()
 			for path := range jobs {
 				content, err := os.ReadFile(path)
-				if err != nil {
-					select {
-					case errChan <- err:
-					default:
-					}
-					continue
-				}
 				
 				mutex.Lock()
-				results[path] = string(content)
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					results[path] = string(content)
+				}
 				mutex.Unlock()
 			}
 		}()
@@ -365,17 +618,13 @@ func ReadFilesInParallel(filePaths []string, maxWorkers int) (map[string]string,
 	// Wait for all workers to finish
 	wg.Wait()
 	
-	// Check for errors
-	select {
-	case err := <-errChan:
-		return nil, err
-	default:
-		return results, nil
-	}
+	return results, errors.Join(errs...)
 }
 
-// SplitCodeIntoChunks splits a code string into chunks with improved logic
-func SplitCodeIntoChunks(code string, maxChunkSize int) []string {
+// SplitCodeIntoChunks splits a code string into chunks with improved logic.
+// When overlap is positive, each chunk after the first starts with the last
+// overlap lines of the previous chunk so context isn't lost at boundaries.
+func SplitCodeIntoChunks(code string, maxChunkSize int, overlap int) []string {
 	if maxChunkSize <= 0 {
 		maxChunkSize = 1000 // Default max chunk size
 	}
@@ -387,6 +636,19 @@ func SplitCodeIntoChunks(code string, maxChunkSize int) []string {
 	var currentChunk strings.Builder
 	currentChunk.Grow(maxChunkSize) // Pre-allocate builder capacity
 	
+	// hasNewContent tracks whether the current chunk holds anything beyond
+	// the lines carried over from the previous chunk
+	hasNewContent := false
+	
+	finalizeChunk := func() {
+		finished := currentChunk.String()
+		chunks = append(chunks, finished)
+		currentChunk.Reset()
+		currentChunk.Grow(maxChunkSize)
+		currentChunk.WriteString(lastLines(finished, overlap))
+		hasNewContent = false
+	}
+	
 	for _, chunk := range rawChunks {
 		// Skip empty chunks
 		trimmedChunk := strings.TrimSpace(chunk)
@@ -395,10 +657,8 @@ func SplitCodeIntoChunks(code string, maxChunkSize int) []string {
 		}
 		
 		// If adding this chunk would exceed max size, finalize current chunk and start a new one
-		if currentChunk.Len() > 0 && currentChunk.Len()+len(trimmedChunk) > maxChunkSize {
-			chunks = append(chunks, currentChunk.String())
-			currentChunk.Reset()
-			currentChunk.Grow(maxChunkSize)
+		if hasNewContent && currentChunk.Len()+len(trimmedChunk) > maxChunkSize {
+			finalizeChunk()
 		}
 		
 		// Add the current chunk
@@ -406,23 +666,35 @@ func SplitCodeIntoChunks(code string, maxChunkSize int) []string {
 			currentChunk.WriteString("\n\n")
 		}
 		currentChunk.WriteString(trimmedChunk)
+		hasNewContent = true
 		
 		// If the chunk itself is already bigger than max size, add it directly
 		if currentChunk.Len() >= maxChunkSize {
-			chunks = append(chunks, currentChunk.String())
-			currentChunk.Reset()
-			currentChunk.Grow(maxChunkSize)
+			finalizeChunk()
 		}
 	}
 	
 	// Add any remaining content
-	if currentChunk.Len() > 0 {
+	if hasNewContent {
 		chunks = append(chunks, currentChunk.String())
 	}
 	
 	return chunks
 }
 
+// lastLines returns the last n lines of text, or an empty string if n <= 0
+func lastLines(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
+
 // StreamChunksFromFile processes a large file in chunks without loading it all into memory
 func StreamChunksFromFile(filePath string, maxChunkSize int, processor func(chunk string) error) error {
 	file, err := os.Open(filePath)
@@ -462,15 +734,17 @@ func StreamChunksFromFile(filePath string, maxChunkSize int, processor func(chun
 	return scanner.Err()
 }
 
-// ProcessFilesWithWorkerPool processes multiple files using a worker pool
+// ProcessFilesWithWorkerPool processes multiple files using a worker pool.
+// A file whose processor fails doesn't stop the others; every error is
+// returned.
 func ProcessFilesWithWorkerPool(filePaths []string, workerCount int, processor func(path string) error) error {
 	if workerCount <= 0 {
 		workerCount = runtime.NumCPU()
 	}
 	
 	jobs := make(chan string, len(filePaths))
-	errChan := make(chan error, 1)
-	done := make(chan struct{})
+	var errs []error
+	var mutex sync.Mutex
 	
 	// Start workers
 	var wg sync.WaitGroup
@@ -480,41 +754,22 @@ func ProcessFilesWithWorkerPool(filePaths []string, workerCount int, processor f
 			defer wg.Done()
 			for path := range jobs {
 				if err := processor(path); err != nil {
-					select {
-					case errChan <- err:
-					default:
-					}
-					return
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
 				}
 			}
 		}()
 	}
 	
-	// Close jobs channel when all workers finish
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-	
 	// Send jobs
 	for _, path := range filePaths {
-		select {
-		case jobs <- path:
-		case <-done:
-			// If workers are done (possibly due to an error), stop sending jobs
-			break
-		}
+		jobs <- path
 	}
 	close(jobs)
 	
 	// Wait for workers to finish
-	<-done
+	wg.Wait()
 	
-	// Check for errors
-	select {
-	case err := <-errChan:
-		return err
-	default:
-		return nil
-	}
+	return errors.Join(errs...)
 }
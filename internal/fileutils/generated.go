@@ -0,0 +1,72 @@
+package fileutils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Directories of third-party code copied into a repository
+var vendoredDirs = map[string]bool{
+	"vendor":           true,
+	"third_party":      true,
+	"third-party":      true,
+	"bower_components": true,
+}
+
+// Name suffixes of files written by code generators and bundlers
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_gen.go", "_generated.go",
+	"_pb2.py", "_pb2_grpc.py", ".pb.ts", "_pb.js", "_pb.d.ts", ".generated.ts", ".generated.cs", ".g.cs",
+	".min.js", ".min.css", ".bundle.js", ".chunk.js",
+}
+
+// Markers generators put in the header of a file: Go's "Code generated ...
+// DO NOT EDIT.", @generated, and .NET's <auto-generated>
+var generatedHeader = regexp.MustCompile(`(?i)code generated\b.*\bdo not edit|@generated\b|<auto-generated|this file (is|was) (automatically |auto-?)generated`)
+
+// Bytes at the start of a file searched for a generated header
+const generatedHeaderBytes = 1024
+
+// Whether vendored directories and generated files are skipped
+var skipVendored, skipGenerated = true, true
+
+// SetSkipVendored sets whether traversal skips vendored directories such as
+// vendor/ and third_party/. They are skipped by default.
+func SetSkipVendored(skip bool) {
+	skipVendored = skip
+}
+
+// SetSkipGenerated sets whether generated files are left out, recognized by
+// their names (*.pb.go, *_gen.go, *.min.js, ...) or a generated header.
+// They are left out by default.
+func SetSkipGenerated(skip bool) {
+	skipGenerated = skip
+}
+
+// IsGeneratedFile reports whether a file was written by a code generator or
+// bundler, judging by its name and the start of its content
+func IsGeneratedFile(path string) bool {
+	name := filepath.Base(path)
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, generatedHeaderBytes)
+	n, _ := io.ReadFull(file, header)
+	return generatedHeader.Match(header[:n])
+}
+
+// isSkippedGenerated reports whether a file is left out as generated code
+func isSkippedGenerated(path string) bool {
+	return skipGenerated && IsGeneratedFile(path)
+}
@@ -0,0 +1,46 @@
+package fileutils
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MatchPath reports whether a path relative to a root matches a glob
+// pattern, or lies under a directory matching it. As in .gitignore, a
+// pattern without a slash matches at any depth, and ** matches any number
+// of directories.
+func MatchPath(pattern, rel string) bool {
+	pattern = strings.Trim(strings.TrimPrefix(filepath.ToSlash(pattern), "./"), "/")
+	if pattern == "" {
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	rel = strings.Trim(strings.TrimPrefix(filepath.ToSlash(rel), "./"), "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches the segments of a pattern against the leading
+// segments of a path
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return true // What's left lies under the matched directory
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
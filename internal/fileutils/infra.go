@@ -0,0 +1,81 @@
+package fileutils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Extensions of infrastructure definitions and schemas indexed alongside code
+var infraExtensions = map[string]bool{
+	".tf":     true,
+	".tfvars": true,
+	".hcl":    true,
+	".sql":    true,
+	".proto":  true,
+}
+
+// Top-level keys every Kubernetes manifest, and so every Helm template, has
+var (
+	manifestAPIVersion = regexp.MustCompile(`(?m)^apiVersion:\s*\S`)
+	manifestKind       = regexp.MustCompile(`(?m)^kind:\s*\S`)
+)
+
+// Bytes at the start of a YAML file searched for manifest keys
+const manifestHeaderBytes = 4096
+
+// IsDockerfile reports whether a file name is a Dockerfile or Containerfile,
+// including variants such as Dockerfile.dev and api.dockerfile
+func IsDockerfile(name string) bool {
+	name = strings.ToLower(filepath.Base(name))
+	return name == "dockerfile" || name == "containerfile" ||
+		strings.HasPrefix(name, "dockerfile.") || strings.HasSuffix(name, ".dockerfile")
+}
+
+// IsComposeFile reports whether a file name is a docker-compose file
+func IsComposeFile(name string) bool {
+	name = strings.ToLower(filepath.Base(name))
+	ext := filepath.Ext(name)
+	if ext != ".yml" && ext != ".yaml" {
+		return false
+	}
+	base := strings.TrimSuffix(name, ext)
+	return base == "compose" || base == "docker-compose" || strings.HasPrefix(base, "docker-compose.")
+}
+
+// isInfraYAML reports whether a YAML file describes infrastructure: a
+// docker-compose file, a Helm chart's Chart.yaml or values, or a Kubernetes
+// manifest. Other YAML, such as CI pipelines and app config, isn't indexed.
+func isInfraYAML(path string) bool {
+	name := filepath.Base(path)
+	if IsComposeFile(name) || name == "Chart.yaml" || strings.HasPrefix(name, "values") {
+		return true
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, manifestHeaderBytes)
+	n, _ := io.ReadFull(file, header)
+	return manifestAPIVersion.Match(header[:n]) && manifestKind.Match(header[:n])
+}
+
+// hasIndexedType reports whether a file's type is indexed: source code,
+// documentation, infrastructure definitions, or schemas
+func hasIndexedType(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case codeExtensions[filepath.Ext(path)] || docExtensions[ext] || infraExtensions[ext] || IsDockerfile(path):
+		return true
+	case ext == ".yaml" || ext == ".yml":
+		return isInfraYAML(path)
+	case ext == ".tpl":
+		// Helm template helpers such as _helpers.tpl
+		return filepath.Base(filepath.Dir(path)) == "templates"
+	}
+	return false
+}
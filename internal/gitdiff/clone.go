@@ -0,0 +1,34 @@
+package gitdiff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ShallowClone checks out ref of the repository at url in dir, fetching only
+// that commit. An empty ref is the remote's default branch. A clone left in
+// dir by an earlier call is updated in place, so only new objects are
+// downloaded. It returns the commit checked out.
+func ShallowClone(url, ref, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		if _, err := git(dir, "init", "--quiet"); err != nil {
+			return "", err
+		}
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Neither may be taken for an option, such as --upload-pack
+	if _, err := git(dir, "fetch", "--quiet", "--depth=1", "--no-tags", "--", url, ref); err != nil {
+		return "", err
+	}
+	if _, err := git(dir, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return ResolveRevision(dir, "HEAD")
+}
@@ -0,0 +1,429 @@
+package gitdiff
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileChange is one file added, modified, deleted, or renamed between two revisions
+type FileChange struct {
+	Path      string // Path relative to the repository root, at the newer revision
+	OldPath   string // Previous path of a renamed file
+	Status    string // "added", "modified", "deleted", or "renamed"
+	Additions int
+	Deletions int
+	Binary    bool
+	Patch     string // Unified diff of the file
+}
+
+// Hunk header of a unified diff; the second pair is the range in the new file
+var hunkHeader = regexp.MustCompile(`(?m)^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// Hunk header with the line counts of both ranges
+var hunkRanges = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// Full object name of a commit, which starts each line's header in blame output
+var hexHash = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// git runs a git command in repoDir and returns its standard output
+func git(repoDir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// revRange returns the git arguments comparing from with to, or with the
+// working tree when to is empty
+func revRange(from, to string) []string {
+	if to == "" {
+		return []string{from}
+	}
+	return []string{from, to}
+}
+
+// TopLevel returns the root directory of the repository containing dir
+func TopLevel(dir string) (string, error) {
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// ResolveRevision returns the commit hash a revision names
+func ResolveRevision(repoDir, rev string) (string, error) {
+	out, err := git(repoDir, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %q", rev)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// MergeBase returns the best common ancestor of two revisions
+func MergeBase(repoDir, a, b string) (string, error) {
+	out, err := git(repoDir, "merge-base", a, b)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Changes lists the files that differ between two revisions, with their
+// patches. An empty to compares from with the working tree.
+func Changes(repoDir, from, to string) ([]FileChange, error) {
+	return changes(repoDir, revRange(from, to))
+}
+
+// StagedChanges lists the files staged for the next commit, with their
+// patches against HEAD
+func StagedChanges(repoDir string) ([]FileChange, error) {
+	return changes(repoDir, []string{"--cached"})
+}
+
+// changes lists the files git diff reports for its revision arguments
+func changes(repoDir string, revs []string) ([]FileChange, error) {
+	nameStatus, err := git(repoDir, append([]string{"diff", "--name-status", "-M", "-z"}, revs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	fields := strings.Split(strings.TrimSuffix(nameStatus, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == "" {
+			continue
+		}
+		change := FileChange{}
+		switch code := fields[i][0]; code {
+		case 'A':
+			change.Status = "added"
+		case 'D':
+			change.Status = "deleted"
+		case 'R':
+			change.Status = "renamed"
+			i++
+			change.OldPath = fields[i]
+		default:
+			change.Status = "modified"
+		}
+		i++
+		if i >= len(fields) {
+			break
+		}
+		change.Path = fields[i]
+		changes = append(changes, change)
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		paths := []string{change.Path}
+		if change.OldPath != "" {
+			paths = append(paths, change.OldPath)
+		}
+
+		args := append([]string{"diff", "-M", "--numstat"}, revs...)
+		numstat, err := git(repoDir, append(append(args, "--"), paths...)...)
+		if err != nil {
+			return nil, err
+		}
+		if stat := strings.Fields(numstat); len(stat) >= 2 {
+			if stat[0] == "-" {
+				change.Binary = true
+			}
+			change.Additions, _ = strconv.Atoi(stat[0])
+			change.Deletions, _ = strconv.Atoi(stat[1])
+		}
+
+		args = append([]string{"diff", "-M"}, revs...)
+		change.Patch, err = git(repoDir, append(append(args, "--"), paths...)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// Show returns a file's content at a revision, or in the working tree when rev is empty
+func Show(repoDir, rev, path string) (string, error) {
+	if rev == "" {
+		content, err := os.ReadFile(filepath.Join(repoDir, path))
+		return string(content), err
+	}
+	return git(repoDir, "show", rev+":"+path)
+}
+
+// ShowStaged returns a file's content as staged for the next commit
+func ShowStaged(repoDir, path string) (string, error) {
+	return git(repoDir, "show", ":"+path)
+}
+
+// Log returns the subject lines of commits reachable from to but not from, oldest first
+func Log(repoDir, from, to string) ([]string, error) {
+	if to == "" {
+		to = "HEAD"
+	}
+	out, err := git(repoDir, "log", "--reverse", "--format=%s", from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			subjects = append(subjects, line)
+		}
+	}
+	return subjects, nil
+}
+
+// RecentFiles returns the absolute paths of the files changed by the last n
+// commits on HEAD, including files since deleted
+func RecentFiles(repoDir string, n int) ([]string, error) {
+	root, err := TopLevel(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(root, "log", "-n", strconv.Itoa(n), "--name-only", "--format=", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !seen[line] {
+			seen[line] = true
+			files = append(files, filepath.Join(root, filepath.FromSlash(line)))
+		}
+	}
+	return files, nil
+}
+
+// ParsePatch splits a unified diff, as written by git diff or diff -u, into
+// its files. Paths lose git's a/ and b/ prefixes.
+func ParsePatch(patch string) []FileChange {
+	var changes []FileChange
+	var current *FileChange
+	var lines []string
+	flush := func() {
+		if current != nil {
+			current.Patch = strings.Join(lines, "\n") + "\n"
+			changes = append(changes, *current)
+		}
+		current, lines = nil, nil
+	}
+
+	// Lines left in the current hunk of the old and new file, counted so that
+	// removed lines starting with "--" aren't taken for headers
+	oldLeft, newLeft := 0, 0
+	hunks := 0
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		inHunk := oldLeft > 0 || newLeft > 0
+		if inHunk {
+			lines = append(lines, line)
+			switch {
+			case strings.HasPrefix(line, "+"):
+				current.Additions++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				current.Deletions++
+				oldLeft--
+			case strings.HasPrefix(line, "\\"):
+				// "\ No newline at end of file"
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		// A file starts at a git header, or at --- for plain diffs
+		if strings.HasPrefix(line, "diff --git ") || (strings.HasPrefix(line, "--- ") && (current == nil || hunks > 0)) {
+			flush()
+			current = &FileChange{Status: "modified"}
+			hunks = 0
+		}
+		if current == nil {
+			continue // Text before the first file, such as a commit message
+		}
+		lines = append(lines, line)
+
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			if match := hunkRanges.FindStringSubmatch(line); match != nil {
+				oldLeft, newLeft = hunkCount(match[1]), hunkCount(match[2])
+				hunks++
+			}
+		case strings.HasPrefix(line, "\\"):
+			// "\ No newline at end of file" after a hunk's last line
+		case strings.HasPrefix(line, "diff --git "):
+			// Paths are taken from the ---/+++ or rename lines, which quote
+			// them unambiguously
+			if fields := strings.Fields(line); len(fields) == 4 {
+				current.Path = strings.TrimPrefix(fields[3], "b/")
+			}
+		case strings.HasPrefix(line, "--- "):
+			if path := patchPath(line[4:]); path != "" {
+				current.OldPath = path
+			} else {
+				current.Status = "added"
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if path := patchPath(line[4:]); path != "" {
+				current.Path = path
+			} else {
+				current.Status = "deleted"
+				current.Path = current.OldPath
+			}
+		case strings.HasPrefix(line, "rename from "):
+			current.Status = "renamed"
+			current.OldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			current.Path = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "new file mode"):
+			current.Status = "added"
+		case strings.HasPrefix(line, "deleted file mode"):
+			current.Status = "deleted"
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			current.Binary = true
+		}
+	}
+	flush()
+
+	// Old paths are only kept for renames, as for Changes
+	for i := range changes {
+		if changes[i].Status != "renamed" {
+			changes[i].OldPath = ""
+		}
+	}
+	return changes
+}
+
+// hunkCount returns the line count of a hunk header range, which is 1 when
+// left out
+func hunkCount(count string) int {
+	if count == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(count)
+	return n
+}
+
+// patchPath returns the path of a ---/+++ line of a patch without its
+// a/ or b/ prefix and timestamp, or "" for /dev/null
+func patchPath(field string) string {
+	if i := strings.Index(field, "\t"); i >= 0 {
+		field = field[:i] // diff -u appends a timestamp
+	}
+	if field == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(field, "a/") || strings.HasPrefix(field, "b/") {
+		return field[2:]
+	}
+	return field
+}
+
+// ChangedLines returns the line ranges (1-based, inclusive) of a patch's
+// hunks in the newer version of the file
+func ChangedLines(patch string) [][2]int {
+	var ranges [][2]int
+	for _, match := range hunkHeader.FindAllStringSubmatch(patch, -1) {
+		start, _ := strconv.Atoi(match[1])
+		count := 1
+		if match[2] != "" {
+			count, _ = strconv.Atoi(match[2])
+		}
+		if count == 0 {
+			// Pure deletion: mark the line the removal follows
+			ranges = append(ranges, [2]int{start, start})
+			continue
+		}
+		ranges = append(ranges, [2]int{start, start + count - 1})
+	}
+	return ranges
+}
+
+// Blame returns the author of each line (1-based) of a file in the working
+// tree, as last changed by a commit. Lines not yet committed are left out.
+func Blame(repoDir, path string) (map[int]string, error) {
+	lines, err := BlameLines(repoDir, path)
+	if err != nil {
+		return nil, err
+	}
+	authors := make(map[int]string, len(lines))
+	for line, change := range lines {
+		authors[line] = change.Author
+	}
+	return authors, nil
+}
+
+// LineChange is the commit that last changed a line
+type LineChange struct {
+	Commit string
+	Author string
+	Time   time.Time // When the author made the change
+}
+
+// BlameLines returns the commit that last changed each line (1-based) of a
+// file in the working tree. Lines not yet committed are left out.
+func BlameLines(repoDir, path string) (map[int]LineChange, error) {
+	out, err := git(repoDir, "blame", "--line-porcelain", "--", path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[int]LineChange)
+	line := 0
+	var change LineChange
+	for _, text := range strings.Split(out, "\n") {
+		switch {
+		case len(text) >= 40 && !strings.HasPrefix(text, "\t") && hexHash.MatchString(text[:40]):
+			// Header of a line: <hash> <original line> <final line> [<group size>]
+			if fields := strings.Fields(text); len(fields) >= 3 {
+				line, _ = strconv.Atoi(fields[2])
+			}
+			change = LineChange{Commit: text[:40]}
+		case strings.HasPrefix(text, "author "):
+			change.Author = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "author-time "):
+			if seconds, err := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64); err == nil {
+				change.Time = time.Unix(seconds, 0).UTC()
+			}
+		case strings.HasPrefix(text, "\t"):
+			// The line's content ends its entry
+			if change.Author != "Not Committed Yet" {
+				lines[line] = change
+			}
+		}
+	}
+	return lines, nil
+}
+
+// BlobHash returns the object name git gives a file with content, as
+// "git hash-object" does without filters
+func BlobHash(content string) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "blob %d\x00", len(content))
+	io.WriteString(hash, content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,158 @@
+package gitdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unchanged lines shown around each change in a unified diff
+const diffContext = 3
+
+// edit is one line of a line diff: kept (' '), deleted ('-'), or inserted ('+')
+type edit struct {
+	op   byte
+	line string
+}
+
+// Unified returns a unified diff from before to after of a file at path, as
+// git diff would print it, or "" when they are the same
+func Unified(path, before, after string) string {
+	edits := diffLines(splitLines(before), splitLines(after))
+
+	var sb strings.Builder
+	for _, hunk := range hunks(edits) {
+		if sb.Len() == 0 {
+			sb.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", path, path))
+		}
+		sb.WriteString(hunk)
+	}
+	return sb.String()
+}
+
+// splitLines splits content into lines without their line endings
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines returns the shortest edit script from a to b, found with Myers'
+// algorithm
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int // v as it was before each round
+
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Insertion
+			} else {
+				x = v[offset+k-1] + 1 // Deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the rounds of diffLines back from the end of both inputs
+// to recover the edits
+func backtrack(trace [][]int, a, b []string, offset int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			edits = append(edits, edit{'+', b[y-1]})
+		} else {
+			edits = append(edits, edit{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		edits = append(edits, edit{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// hunks groups edits into unified diff hunks, each with its header and up
+// to diffContext unchanged lines around its changes
+func hunks(edits []edit) []string {
+	// Lines of each side before each edit
+	aLine := make([]int, len(edits)+1)
+	bLine := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if e.op != '+' {
+			aLine[i+1]++
+		}
+		if e.op != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	var out []string
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk over changes separated by at most twice the context
+		start, end := max(0, i-diffContext), i+1
+		for j := i + 1; j < len(edits) && j-end < 2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				end = j + 1
+			}
+		}
+		end = min(len(edits), end+diffContext)
+
+		aStart, aCount := aLine[start]+1, aLine[end]-aLine[start]
+		bStart, bCount := bLine[start]+1, bLine[end]-bLine[start]
+		// An empty range is numbered by the line before it
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount))
+		for _, e := range edits[start:end] {
+			sb.WriteString(string(e.op) + e.line + "\n")
+		}
+		out = append(out, sb.String())
+		i = end
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/httpclient"
+)
+
+// Default REST API endpoint; GitHub Enterprise sets GITHUB_API_URL instead
+const defaultAPIURL = "https://api.github.com"
+
+// Comments fetched per page when looking for an earlier comment
+const commentsPerPage = 100
+
+// Client calls the GitHub REST API with a token
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Comment is an issue or pull request comment
+type Comment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// PullRequestEvent holds the fields of a GitHub Actions pull_request event used here
+type PullRequestEvent struct {
+	PullRequest struct {
+		Number int `json:"number"`
+		Base   struct {
+			SHA string `json:"sha"`
+		} `json:"base"`
+		Head struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+}
+
+// NewClient creates a client for GITHUB_API_URL, or api.github.com when it isn't set
+func NewClient(token string) *Client {
+	baseURL := os.Getenv("GITHUB_API_URL")
+	if baseURL == "" {
+		baseURL = defaultAPIURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Transport: httpclient.Transport, Timeout: 30 * time.Second},
+	}
+}
+
+// LoadPullRequestEvent reads the event payload GitHub Actions writes to
+// GITHUB_EVENT_PATH. It returns nil when not running for a pull request.
+func LoadPullRequestEvent() *PullRequestEvent {
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var event PullRequestEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.PullRequest.Number == 0 {
+		return nil
+	}
+	return &event
+}
+
+// do sends a request and decodes a JSON response into out, when out is not nil
+func (c *Client) do(ctx context.Context, method, path string, payload, out any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// findComment returns the first comment on an issue or pull request containing marker
+func (c *Client) findComment(ctx context.Context, repo string, number int, marker string) (*Comment, error) {
+	for page := 1; ; page++ {
+		var comments []Comment
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=%d&page=%d", repo, number, commentsPerPage, page)
+		if err := c.do(ctx, http.MethodGet, path, nil, &comments); err != nil {
+			return nil, err
+		}
+		for i := range comments {
+			if strings.Contains(comments[i].Body, marker) {
+				return &comments[i], nil
+			}
+		}
+		if len(comments) < commentsPerPage {
+			return nil, nil
+		}
+	}
+}
+
+// UpsertComment posts body as a comment on a pull request, or edits the
+// earlier comment containing marker so reruns don't pile up comments. It
+// returns the comment's URL.
+func (c *Client) UpsertComment(ctx context.Context, repo string, number int, marker, body string) (string, error) {
+	existing, err := c.findComment(ctx, repo, number, marker)
+	if err != nil {
+		return "", fmt.Errorf("failed to list comments: %w", err)
+	}
+
+	var comment Comment
+	payload := map[string]string{"body": body}
+	if existing != nil {
+		path := fmt.Sprintf("/repos/%s/issues/comments/%d", repo, existing.ID)
+		if err := c.do(ctx, http.MethodPatch, path, payload, &comment); err != nil {
+			return "", fmt.Errorf("failed to update comment: %w", err)
+		}
+		return comment.HTMLURL, nil
+	}
+
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number)
+	if err := c.do(ctx, http.MethodPost, path, payload, &comment); err != nil {
+		return "", fmt.Errorf("failed to post comment: %w", err)
+	}
+	return comment.HTMLURL, nil
+}
@@ -0,0 +1,438 @@
+// Package graph builds the import and call graph of an index's files, kept
+// next to the index and rebuilt when its chunks change.
+package graph
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/imports"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Suffix of the graph file kept next to an index
+const graphSuffix = ".graph.json"
+
+// Version of the rules resolving imports and calls, hashed into every
+// fingerprint so graphs saved under older rules are rebuilt
+const graphVersion = 2
+
+// Edge is an import of one file by another
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Symbol is a function or method in a file
+type Symbol struct {
+	File     string `json:"file"`
+	Function string `json:"function"`
+}
+
+// Call is a call from one function to another, both in the index
+type Call struct {
+	From Symbol `json:"from"`
+	To   Symbol `json:"to"`
+}
+
+// Graph holds the files of an index with the imports and calls between them.
+// Imports of packages and modules outside the index are left out.
+type Graph struct {
+	Fingerprint string   `json:"fingerprint"` // Hash of the chunks the graph was built from
+	Files       []string `json:"files"`
+	Imports     []Edge   `json:"imports"`
+	Calls       []Call   `json:"calls"`
+}
+
+// Path returns the path of the graph file of an index
+func Path(indexPath string) string {
+	return indexPath + graphSuffix
+}
+
+// Open returns the graph of an index's chunks: the saved graph when it was
+// built from the same chunks, or else a new one, which is saved in its
+// place. The graph is returned along with any error saving it.
+func Open(indexPath string, chunks []storage.CodeChunk) (Graph, error) {
+	fingerprint := Fingerprint(chunks)
+	if data, err := os.ReadFile(Path(indexPath)); err == nil {
+		var saved Graph
+		if json.Unmarshal(data, &saved) == nil && saved.Fingerprint == fingerprint {
+			return saved, nil
+		}
+	}
+
+	graph := Build(chunks)
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return graph, err
+	}
+	return graph, os.WriteFile(Path(indexPath), append(data, '\n'), 0o644)
+}
+
+// Fingerprint hashes what the graph is built from: each chunk's file, lines,
+// function, imports, and calls, and the rules resolving them
+func Fingerprint(chunks []storage.CodeChunk) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "v%d\x00", graphVersion)
+	for _, chunk := range chunks {
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s\x00", chunk.File, chunk.Function, strings.Join(chunk.Imports, ","), strings.Join(chunk.Calls, ","))
+		binary.Write(hash, binary.LittleEndian, [2]int64{int64(chunk.StartLine), int64(chunk.EndLine)})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// Build derives the graph from the imports and calls recorded on chunks at
+// indexing time
+func Build(chunks []storage.CodeChunk) Graph {
+	byFile := make(map[string][]storage.CodeChunk)
+	for _, chunk := range chunks {
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+	graph := Graph{Fingerprint: Fingerprint(chunks), Imports: []Edge{}, Calls: []Call{}}
+	for file := range byFile {
+		graph.Files = append(graph.Files, file)
+	}
+	sort.Strings(graph.Files)
+
+	var targets map[string]map[string][]string
+	graph.Imports, targets = resolveImports(graph.Files, byFile)
+	graph.Calls = resolveCalls(graph.Files, byFile, targets)
+	return graph
+}
+
+// resolveImports turns each file's imports into edges to the files in the
+// index they refer to. It also returns, by file, the files each of its
+// imports refers to, empty for imports from outside the index.
+func resolveImports(files []string, byFile map[string][]storage.CodeChunk) ([]Edge, map[string]map[string][]string) {
+	resolver := imports.NewResolver(byFile)
+
+	edgeSet := make(map[Edge]bool)
+	targets := make(map[string]map[string][]string, len(files))
+	for _, file := range files {
+		targets[file] = make(map[string][]string)
+		for _, imp := range imports.ForFile(file, byFile[file]) {
+			resolved := resolver.Resolve(file, imp)
+			targets[file][imp] = resolved
+			for _, other := range resolved {
+				edgeSet[Edge{file, other}] = true
+			}
+		}
+	}
+
+	edges := make([]Edge, 0, len(edgeSet))
+	for edge := range edgeSet {
+		edges = append(edges, edge)
+	}
+	sortEdges(edges)
+	return edges, targets
+}
+
+// resolveCalls links the calls recorded on function chunks to the functions
+// they name, only where the language's scoping rules say which file holds
+// the function:
+//   - A Go call qualified by an imported package, such as pkg.Fn, resolves
+//     to Fn in that package's files. Packages from outside the index, such as
+//     the standard library, have none, so their calls stay unresolved.
+//   - Unqualified Go calls resolve to a function of the same name in the
+//     calling file, else in its package. Methods called on values stay
+//     unresolved, as their types aren't known.
+//   - Calls in other languages resolve to a function of the same name in the
+//     calling file, else in the only file it imports that defines one.
+//
+// Calls that match nothing, or stay ambiguous, are left out.
+func resolveCalls(files []string, byFile map[string][]storage.CodeChunk, targets map[string]map[string][]string) []Call {
+	definitions := make(map[string]map[string]bool) // File -> functions defined in it
+	byDir := make(map[string][]string)              // Directory -> Go files in it
+	for _, file := range files {
+		definitions[file] = make(map[string]bool)
+		for _, chunk := range byFile[file] {
+			if chunk.Function != "" {
+				definitions[file][chunk.Function] = true
+			}
+		}
+		if filepath.Ext(file) == ".go" {
+			byDir[filepath.Dir(file)] = append(byDir[filepath.Dir(file)], file)
+		}
+	}
+
+	callSet := make(map[Call]bool)
+	for _, file := range files {
+		for _, chunk := range byFile[file] {
+			if chunk.Function == "" {
+				continue
+			}
+			from := Symbol{file, chunk.Function}
+			for _, name := range chunk.Calls {
+				var to Symbol
+				var ok bool
+				if filepath.Ext(file) == ".go" {
+					to, ok = resolveGoCall(name, file, targets[file], byDir[filepath.Dir(file)], definitions)
+				} else {
+					to, ok = resolveCall(name, file, targets[file], definitions)
+				}
+				if ok && to != from {
+					callSet[Call{from, to}] = true
+				}
+			}
+		}
+	}
+
+	calls := make([]Call, 0, len(callSet))
+	for call := range callSet {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		a, b := calls[i], calls[j]
+		if a.From != b.From {
+			return a.From.File < b.From.File || (a.From.File == b.From.File && a.From.Function < b.From.Function)
+		}
+		return a.To.File < b.To.File || (a.To.File == b.To.File && a.To.Function < b.To.Function)
+	})
+	return calls
+}
+
+// resolveGoCall picks the definition a call from a Go file refers to, given
+// the files its imports refer to and the Go files of its package
+func resolveGoCall(name, file string, imported map[string][]string, pkg []string, definitions map[string]map[string]bool) (Symbol, bool) {
+	if qualifier, function, ok := strings.Cut(name, "."); ok {
+		var files []string
+		isPackage := false
+		for imp, targets := range imported {
+			if path.Base(imp) == qualifier {
+				isPackage = true
+				files = append(files, targets...)
+			}
+		}
+		if !isPackage {
+			// A method called on a value, whose type isn't known
+			return Symbol{}, false
+		}
+		return findDefinition(function, files, definitions)
+	}
+	if definitions[file][name] {
+		return Symbol{file, name}, true
+	}
+	return findDefinition(name, pkg, definitions)
+}
+
+// resolveCall picks the definition a call from a file in a language other
+// than Go refers to, given the files its imports refer to
+func resolveCall(name, file string, imported map[string][]string, definitions map[string]map[string]bool) (Symbol, bool) {
+	if definitions[file][name] {
+		return Symbol{file, name}, true
+	}
+	var files []string
+	for _, targets := range imported {
+		files = append(files, targets...)
+	}
+	return findDefinition(name, files, definitions)
+}
+
+// findDefinition returns the function of a name defined in exactly one of
+// files
+func findDefinition(name string, files []string, definitions map[string]map[string]bool) (Symbol, bool) {
+	var found []Symbol
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if definitions[file][name] && !seen[file] {
+			seen[file] = true
+			found = append(found, Symbol{file, name})
+		}
+	}
+	if len(found) != 1 {
+		return Symbol{}, false
+	}
+	return found[0], true
+}
+
+// InDegree returns for each file the number of other files that import it or
+// call into it
+func (g Graph) InDegree() map[string]int {
+	referrers := make(map[string]map[string]bool)
+	add := func(from, to string) {
+		if from == to {
+			return
+		}
+		if referrers[to] == nil {
+			referrers[to] = make(map[string]bool)
+		}
+		referrers[to][from] = true
+	}
+	for _, edge := range g.Imports {
+		add(edge.From, edge.To)
+	}
+	for _, call := range g.Calls {
+		add(call.From.File, call.To.File)
+	}
+
+	degree := make(map[string]int, len(g.Files))
+	for _, file := range g.Files {
+		degree[file] = len(referrers[file])
+	}
+	return degree
+}
+
+// PageRank parameters: the probability of following a reference rather than
+// jumping to a random file, and when to stop iterating
+const (
+	pageRankDamping    = 0.85
+	pageRankIterations = 100
+	pageRankTolerance  = 1e-9
+)
+
+// PageRank returns the PageRank of each file over the graph, where a file
+// that imports or calls into another passes its rank on to it. Files that
+// central files depend on rank high even when few files reference them
+// directly. Ranks sum to 1.
+func (g Graph) PageRank() map[string]float64 {
+	n := len(g.Files)
+	rank := make(map[string]float64, n)
+	if n == 0 {
+		return rank
+	}
+
+	// Each file's distinct references, counted once however many imports and
+	// calls make them up
+	targets := make(map[string]map[string]bool)
+	add := func(from, to string) {
+		if from == to {
+			return
+		}
+		if targets[from] == nil {
+			targets[from] = make(map[string]bool)
+		}
+		targets[from][to] = true
+	}
+	for _, edge := range g.Imports {
+		add(edge.From, edge.To)
+	}
+	for _, call := range g.Calls {
+		add(call.From.File, call.To.File)
+	}
+
+	for _, file := range g.Files {
+		rank[file] = 1 / float64(n)
+	}
+	for i := 0; i < pageRankIterations; i++ {
+		// Files referencing nothing spread their rank over every file
+		dangling := 0.0
+		for _, file := range g.Files {
+			if len(targets[file]) == 0 {
+				dangling += rank[file]
+			}
+		}
+
+		next := make(map[string]float64, n)
+		base := (1-pageRankDamping)/float64(n) + pageRankDamping*dangling/float64(n)
+		for _, file := range g.Files {
+			next[file] += base
+			for to := range targets[file] {
+				next[to] += pageRankDamping * rank[file] / float64(len(targets[file]))
+			}
+		}
+
+		delta := 0.0
+		for _, file := range g.Files {
+			delta += math.Abs(next[file] - rank[file])
+		}
+		rank = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+	return rank
+}
+
+// Relative returns a copy of the graph with file paths relative to root
+func (g Graph) Relative(root string) Graph {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(root, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return path
+	}
+	out := Graph{Fingerprint: g.Fingerprint, Imports: make([]Edge, len(g.Imports)), Calls: make([]Call, len(g.Calls))}
+	for _, file := range g.Files {
+		out.Files = append(out.Files, rel(file))
+	}
+	for i, edge := range g.Imports {
+		out.Imports[i] = Edge{rel(edge.From), rel(edge.To)}
+	}
+	for i, call := range g.Calls {
+		out.Calls[i] = Call{Symbol{rel(call.From.File), call.From.Function}, Symbol{rel(call.To.File), call.To.Function}}
+	}
+	return out
+}
+
+// DOT renders the graph in Graphviz DOT format: files as nodes joined by
+// their imports, plus, when calls is set, functions joined by their calls
+// and grouped in their files
+func (g Graph) DOT(calls bool) string {
+	ids := make(map[string]string, len(g.Files))
+	for i, file := range g.Files {
+		ids[file] = fmt.Sprintf("f%d", i)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("digraph codebase {\n")
+	sb.WriteString("    rankdir=LR;\n")
+	sb.WriteString("    node [shape=box];\n")
+
+	if !calls {
+		for _, file := range g.Files {
+			sb.WriteString(fmt.Sprintf("    %s [label=%q];\n", ids[file], file))
+		}
+		for _, edge := range g.Imports {
+			sb.WriteString(fmt.Sprintf("    %s -> %s;\n", ids[edge.From], ids[edge.To]))
+		}
+		sb.WriteString("}\n")
+		return sb.String()
+	}
+
+	// Functions that take part in a call, grouped by file
+	functions := make(map[string][]string)
+	symbolIDs := make(map[Symbol]string)
+	for _, call := range g.Calls {
+		for _, symbol := range []Symbol{call.From, call.To} {
+			if _, ok := symbolIDs[symbol]; !ok {
+				symbolIDs[symbol] = fmt.Sprintf("%s_%d", ids[symbol.File], len(functions[symbol.File]))
+				functions[symbol.File] = append(functions[symbol.File], symbol.Function)
+			}
+		}
+	}
+	for i, file := range g.Files {
+		if len(functions[file]) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("    subgraph cluster_%d {\n", i))
+		sb.WriteString(fmt.Sprintf("        label=%q;\n", file))
+		for _, function := range functions[file] {
+			sb.WriteString(fmt.Sprintf("        %s [label=%q];\n", symbolIDs[Symbol{file, function}], function))
+		}
+		sb.WriteString("    }\n")
+	}
+	for _, call := range g.Calls {
+		sb.WriteString(fmt.Sprintf("    %s -> %s;\n", symbolIDs[call.From], symbolIDs[call.To]))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// sortEdges orders edges by their source, then their target
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
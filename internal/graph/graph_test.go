@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// goModule writes a go.mod for module path to a new directory and returns it
+func goModule(t *testing.T, path string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+path+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// TestBuildGoCalls checks that Go calls resolve only within the package that
+// qualifies them, or else the caller's own package, so calls into the
+// standard library, builtins, and methods on values stay unresolved even when
+// a function of the index shares their name
+func TestBuildGoCalls(t *testing.T) {
+	root := goModule(t, "example.com/app")
+	main := filepath.Join(root, "main.go")
+	helpers := filepath.Join(root, "helpers.go")
+	text := filepath.Join(root, "text", "text.go")
+
+	chunks := []storage.CodeChunk{
+		{File: main, Function: "run", StartLine: 8, EndLine: 14,
+			Imports: []string{"strings", "example.com/app/text"},
+			Calls:   []string{"strings.Split", "text.Join", "min", "setup", "w.Flush"}},
+		{File: helpers, Function: "setup", StartLine: 3, EndLine: 5},
+		{File: helpers, Function: "Flush", StartLine: 7, EndLine: 9},
+		{File: text, Function: "Split", StartLine: 3, EndLine: 5},
+		{File: text, Function: "Join", StartLine: 7, EndLine: 9},
+		{File: text, Function: "min", StartLine: 11, EndLine: 13},
+		{File: text, Function: "Flush", StartLine: 15, EndLine: 17},
+	}
+	graph := Build(chunks)
+
+	want := []Call{
+		{Symbol{main, "run"}, Symbol{helpers, "setup"}},
+		{Symbol{main, "run"}, Symbol{text, "Join"}},
+	}
+	if !slices.Equal(graph.Calls, want) {
+		t.Errorf("calls = %v, want %v", graph.Calls, want)
+	}
+	wantImports := []Edge{{main, text}}
+	if !slices.Equal(graph.Imports, wantImports) {
+		t.Errorf("imports = %v, want %v", graph.Imports, wantImports)
+	}
+}
+
+// TestRankGoStdlibCalls checks that calls into the standard library add no
+// edges to rank on, even when a file of the index defines functions of the
+// same names, so that file ranks no higher than one nothing references
+func TestRankGoStdlibCalls(t *testing.T) {
+	root := goModule(t, "example.com/app")
+	main := filepath.Join(root, "main.go")
+	notify := filepath.Join(root, "notify", "notify.go")
+	other := filepath.Join(root, "other", "other.go")
+
+	chunks := []storage.CodeChunk{
+		{File: main, Function: "run", StartLine: 5, EndLine: 9,
+			Imports: []string{"fmt", "os"},
+			Calls:   []string{"fmt.Println", "os.Exit", "len"}},
+		{File: notify, Function: "Println", StartLine: 3, EndLine: 5},
+		{File: notify, Function: "Exit", StartLine: 7, EndLine: 9},
+		{File: notify, Function: "len", StartLine: 11, EndLine: 13},
+		{File: other, Function: "helper", StartLine: 3, EndLine: 5},
+	}
+	graph := Build(chunks)
+
+	if len(graph.Imports) != 0 || len(graph.Calls) != 0 {
+		t.Fatalf("imports = %v, calls = %v, want none", graph.Imports, graph.Calls)
+	}
+	if degree := graph.InDegree(); degree[notify] != 0 {
+		t.Errorf("in-degree of %s = %d, want 0", notify, degree[notify])
+	}
+	rank := graph.PageRank()
+	if rank[notify] != rank[other] {
+		t.Errorf("rank of %s = %v, want %v like the unreferenced %s", notify, rank[notify], rank[other], other)
+	}
+}
@@ -0,0 +1,106 @@
+// Package httpclient builds the HTTP clients every API request is made
+// with, so a proxy, extra root certificates, and a timeout configured once
+// apply to all providers. Without configuration, requests honor
+// HTTPS_PROXY, HTTP_PROXY, and NO_PROXY and trust the system's roots.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Options configures the transport and clients of API requests
+type Options struct {
+	Proxy    string        // URL of the proxy requests go through (empty uses HTTPS_PROXY, HTTP_PROXY, and NO_PROXY)
+	CABundle string        // PEM file of root certificates trusted besides the system's, such as a corporate CA
+	Timeout  time.Duration // Longest a request may take, reading the response included (0 disables)
+}
+
+var (
+	mu      sync.RWMutex
+	current http.RoundTripper = newTransport()
+	timeout time.Duration
+)
+
+// Configure sets the proxy, root certificates, and timeout of API requests.
+// Transport picks them up at once; clients created by New before it keep
+// their timeout.
+func Configure(options Options) error {
+	transport := newTransport()
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil || proxy.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", options.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if options.CABundle != "" {
+		roots, err := loadRoots(options.CABundle)
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current = transport
+	timeout = options.Timeout
+	return nil
+}
+
+// newTransport returns a copy of the default transport, which proxies
+// according to the environment
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	return transport
+}
+
+// loadRoots returns the system's root certificates with those in a PEM file
+func loadRoots(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in CA bundle %s", path)
+	}
+	return roots, nil
+}
+
+// Transport sends requests with the configured proxy and root certificates.
+// It can be wrapped, and used in clients created before Configure is called.
+var Transport http.RoundTripper = sharedTransport{}
+
+type sharedTransport struct{}
+
+func (sharedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mu.RLock()
+	transport := current
+	mu.RUnlock()
+	return transport.RoundTrip(req)
+}
+
+// New returns a client of Transport with the configured timeout
+func New() *http.Client {
+	return NewWithTransport(Transport)
+}
+
+// NewWithTransport returns a client of transport, which should wrap
+// Transport, with the configured timeout
+func NewWithTransport(transport http.RoundTripper) *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
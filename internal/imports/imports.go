@@ -0,0 +1,89 @@
+package imports
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Import statements by file extension; the first submatch is the imported path or module
+var importPatterns = map[string][]*regexp.Regexp{
+	".go": {
+		regexp.MustCompile(`(?m)^\s*import\s+(?:\w+\s+)?"([^"]+)"`),
+		regexp.MustCompile(`(?m)^\s+(?:[\w.]+\s+)?"([^"]+)"\s*$`), // Lines inside an import block
+	},
+	".py": {
+		regexp.MustCompile(`(?m)^\s*from\s+([.\w]+)\s+import`),
+		regexp.MustCompile(`(?m)^\s*import\s+([.\w]+)`),
+	},
+	".js":  jsPatterns,
+	".jsx": jsPatterns,
+	".ts":  jsPatterns,
+	".tsx": jsPatterns,
+	".java": {
+		regexp.MustCompile(`(?m)^\s*import\s+(?:static\s+)?([\w.]+?)(?:\.\*)?;`),
+	},
+	".cs": {
+		regexp.MustCompile(`(?m)^\s*using\s+(?:static\s+)?([\w.]+);`),
+	},
+}
+
+// JavaScript and TypeScript import and require statements
+var jsPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`import\s+(?:[^'"]*\s+from\s+)?['"]([^'"]+)['"]`),
+	regexp.MustCompile(`require\(\s*['"]([^'"]+)['"]\s*\)`),
+}
+
+// Extract returns the import paths or module names declared in a file, in
+// order of first appearance
+func Extract(filePath, content string) []string {
+	var imports []string
+	seen := make(map[string]bool)
+	for _, pattern := range importPatterns[filepath.Ext(filePath)] {
+		for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+			if path := match[1]; !seen[path] {
+				seen[path] = true
+				imports = append(imports, path)
+			}
+		}
+	}
+	return imports
+}
+
+// ForFile returns the imports recorded for a file at indexing time, or
+// extracts them from its chunks for indexes built before imports were stored
+func ForFile(file string, chunks []storage.CodeChunk) []string {
+	for _, chunk := range chunks {
+		if len(chunk.Imports) > 0 {
+			return chunk.Imports
+		}
+	}
+
+	var content strings.Builder
+	for _, chunk := range chunks {
+		content.WriteString(chunk.Content + "\n")
+	}
+	return Extract(file, content.String())
+}
+
+// GoModulePath returns the module path declared in dir/go.mod, or "" if there is none
+func GoModulePath(dir string) string {
+	file, err := os.Open(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,272 @@
+package imports
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Extensions tried, in order, for a JavaScript or TypeScript import of a
+// path without one
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"}
+
+// goModule is a Go module found in the index
+type goModule struct {
+	dir  string // Directory holding its go.mod
+	path string // Module path declared in go.mod
+}
+
+// Resolver resolves import paths to the indexed files they refer to,
+// following each language's rules rather than matching names:
+//   - Go: imports of a module in the index name a package directory, whose
+//     files are all imported
+//   - JavaScript and TypeScript: relative imports name a file, with or
+//     without its extension, or a directory with an index file
+//   - Python: relative imports are resolved against the importing package,
+//     absolute ones against source roots containing the importing file
+//   - Java: imports name a class file by its package path, or a package
+//   - C#: using directives name a namespace, declared by any number of files
+//
+// Imports of the standard library and third-party packages resolve to
+// nothing.
+type Resolver struct {
+	files     map[string]bool
+	byDir     map[string][]string // Directory -> indexed files in it
+	byPackage map[string][]string // Declared Java package or C# namespace -> files
+	bySuffix  map[string][]string // Python or Java module path, such as a/b/c, -> files
+	modules   []goModule          // Longest module path first
+}
+
+// NewResolver returns a resolver for the files of an index
+func NewResolver(byFile map[string][]storage.CodeChunk) *Resolver {
+	r := &Resolver{
+		files:     make(map[string]bool),
+		byDir:     make(map[string][]string),
+		byPackage: make(map[string][]string),
+		bySuffix:  make(map[string][]string),
+	}
+	moduleDirs := make(map[string]bool)
+	searched := make(map[string]bool) // Directories already searched for a go.mod
+	for file, chunks := range byFile {
+		r.files[file] = true
+		dir := filepath.Dir(file)
+		r.byDir[dir] = append(r.byDir[dir], file)
+
+		switch ext := filepath.Ext(file); ext {
+		case ".java", ".cs":
+			if len(chunks) > 0 && chunks[0].Package != "" {
+				r.byPackage[chunks[0].Package] = append(r.byPackage[chunks[0].Package], file)
+			}
+			if ext == ".java" {
+				r.addSuffixes(file)
+			}
+		case ".py":
+			r.addSuffixes(file)
+		case ".go":
+			if searched[dir] {
+				continue
+			}
+			searched[dir] = true
+			if moduleDir, ok := findGoModDir(dir); ok {
+				moduleDirs[moduleDir] = true
+			}
+		}
+	}
+	for dir := range moduleDirs {
+		if path := GoModulePath(dir); path != "" {
+			r.modules = append(r.modules, goModule{dir, path})
+		}
+	}
+	sort.Slice(r.modules, func(i, j int) bool {
+		return len(r.modules[i].path) > len(r.modules[j].path)
+	})
+	for _, files := range r.byDir {
+		sort.Strings(files)
+	}
+	return r
+}
+
+// addSuffixes records every trailing module path of a file: a/b/c.py is
+// found as c, b/c, and a/b/c, and a/b/__init__.py as b and a/b
+func (r *Resolver) addSuffixes(file string) {
+	path := filepath.ToSlash(strings.TrimSuffix(file, filepath.Ext(file)))
+	path = strings.TrimSuffix(path, "/__init__")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		suffix := strings.Join(segments[i:], "/")
+		r.bySuffix[suffix] = append(r.bySuffix[suffix], file)
+	}
+}
+
+// findGoModDir returns the nearest directory at or above dir holding a go.mod
+func findGoModDir(dir string) (string, bool) {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Resolve returns the indexed files an import in file refers to, sorted
+func (r *Resolver) Resolve(file, imp string) []string {
+	var targets []string
+	switch filepath.Ext(file) {
+	case ".go":
+		targets = r.resolveGo(imp)
+	case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs":
+		targets = r.resolveJS(file, imp)
+	case ".py":
+		targets = r.resolvePython(file, imp)
+	case ".java":
+		targets = r.resolveJava(imp)
+	case ".cs":
+		targets = r.declaring(imp, ".cs")
+	}
+
+	var resolved []string
+	seen := map[string]bool{file: true}
+	for _, target := range targets {
+		if !seen[target] {
+			seen[target] = true
+			resolved = append(resolved, target)
+		}
+	}
+	sort.Strings(resolved)
+	return resolved
+}
+
+// resolveGo returns the Go files of the package an import path names, when
+// it belongs to a module in the index
+func (r *Resolver) resolveGo(imp string) []string {
+	for _, module := range r.modules {
+		if imp != module.path && !strings.HasPrefix(imp, module.path+"/") {
+			continue
+		}
+		dir := filepath.Join(module.dir, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(imp, module.path), "/")))
+		var files []string
+		for _, file := range r.byDir[dir] {
+			if filepath.Ext(file) == ".go" {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+	return nil
+}
+
+// resolveJS returns the file a relative JavaScript or TypeScript import
+// names. Package imports aren't resolved.
+func (r *Resolver) resolveJS(file, imp string) []string {
+	if !strings.HasPrefix(imp, "./") && !strings.HasPrefix(imp, "../") && imp != "." && imp != ".." {
+		return nil
+	}
+	base := filepath.Join(filepath.Dir(file), filepath.FromSlash(imp))
+
+	candidates := []string{base}
+	// TypeScript imports compiled output by its .js name
+	withoutExt := strings.TrimSuffix(base, filepath.Ext(base))
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, base+ext, withoutExt+ext)
+	}
+	for _, ext := range jsExtensions {
+		candidates = append(candidates, filepath.Join(base, "index"+ext))
+	}
+	for _, candidate := range candidates {
+		if r.files[candidate] {
+			return []string{candidate}
+		}
+	}
+	return nil
+}
+
+// resolvePython returns the module file or package __init__.py an import
+// names
+func (r *Resolver) resolvePython(file, imp string) []string {
+	// Relative imports climb one package per leading dot past the first
+	if strings.HasPrefix(imp, ".") {
+		rest := strings.TrimLeft(imp, ".")
+		dir := filepath.Dir(file)
+		for i := 1; i < len(imp)-len(rest); i++ {
+			dir = filepath.Dir(dir)
+		}
+		base := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(rest, ".", "/")))
+		for _, candidate := range []string{base + ".py", filepath.Join(base, "__init__.py")} {
+			if r.files[candidate] {
+				return []string{candidate}
+			}
+		}
+		return nil
+	}
+
+	// Absolute imports resolve against a source root: a directory containing
+	// the importing file that the module path is found under
+	modulePath := strings.ReplaceAll(imp, ".", "/")
+	candidates := r.bySuffix[modulePath]
+	var inRoot []string
+	for _, candidate := range candidates {
+		root := moduleRoot(candidate, modulePath)
+		if root == filepath.Dir(file) || strings.HasPrefix(file, root+string(filepath.Separator)) {
+			inRoot = append(inRoot, candidate)
+		}
+	}
+	if len(inRoot) > 0 {
+		return inRoot
+	}
+	if len(candidates) == 1 {
+		return candidates
+	}
+	return nil
+}
+
+// moduleRoot returns the directory a module file is imported relative to:
+// its path with the module path and extension removed
+func moduleRoot(file, modulePath string) string {
+	dir := filepath.Dir(file)
+	if filepath.Base(file) != "__init__.py" {
+		dir = filepath.Join(dir, "x") // Stand-in for the module's own segment
+	}
+	for range strings.Split(modulePath, "/") {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// resolveJava returns the class file an import names, or the files of the
+// package a wildcard import names. Static imports of a member resolve to its
+// class.
+func (r *Resolver) resolveJava(imp string) []string {
+	if files := r.declaring(imp, ".java"); len(files) > 0 {
+		return files
+	}
+	for path := imp; path != ""; {
+		if files := r.bySuffix[strings.ReplaceAll(path, ".", "/")]; len(files) > 0 && strings.Contains(path, ".") {
+			return files
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return nil
+}
+
+// declaring returns the files with an extension that declare a package or
+// namespace
+func (r *Resolver) declaring(pkg, ext string) []string {
+	var files []string
+	for _, file := range r.byPackage[pkg] {
+		if filepath.Ext(file) == ext {
+			files = append(files, file)
+		}
+	}
+	return files
+}
@@ -0,0 +1,286 @@
+// Package jsonrpc serves JSON-RPC 2.0 over stream connections such as Unix
+// sockets. Messages are newline-delimited JSON objects, which editor plugins
+// can write and read without a framing library, or framed with headers as in
+// the Language Server Protocol.
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Error codes defined by the JSON-RPC 2.0 specification
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// Errors returned by handlers that aren't an *Error
+	CodeServerError = -32000
+)
+
+// Error is a JSON-RPC error object. Handlers return one to choose the code
+// sent to the client.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// InvalidParams returns an invalid params error with a formatted message
+func InvalidParams(format string, args ...any) *Error {
+	return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// Handler answers a call with a result to be encoded as JSON, or an error
+type Handler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Server dispatches calls to the handlers registered for their methods
+type Server struct {
+	methods map[string]Handler
+}
+
+// NewServer returns a server with no methods
+func NewServer() *Server {
+	return &Server{methods: make(map[string]Handler)}
+}
+
+// Register handles calls of method with handler. Methods must be registered
+// before the server starts serving.
+func (s *Server) Register(method string, handler Handler) {
+	s.methods[method] = handler
+}
+
+// request is a call or, without an ID, a notification
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response answers a call with either a result or an error
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"` // "null" for a call with no result
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Serve accepts connections on listener and serves each until ctx is
+// canceled, which closes the listener
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.ServeConn(ctx, conn)
+		}()
+	}
+}
+
+// ServeConn answers the calls read from conn until the client closes it or
+// ctx is canceled. Calls are handled concurrently, so a slow call doesn't
+// hold up the ones after it; responses carry the call's ID to match them up.
+// Notifications are handled in the order they arrive.
+func (s *Server) ServeConn(ctx context.Context, conn io.ReadWriteCloser) {
+	s.serve(ctx, conn, lineCodec{bufio.NewReader(conn), conn})
+}
+
+// ServeHeaderFramed is ServeConn for the framing of the Language Server
+// Protocol, where each message follows a Content-Length header
+func (s *Server) ServeHeaderFramed(ctx context.Context, conn io.ReadWriteCloser) {
+	s.serve(ctx, conn, headerCodec{bufio.NewReader(conn), conn})
+}
+
+// serve answers the messages read by codec until it fails or ctx is canceled
+func (s *Server) serve(ctx context.Context, conn io.Closer, codec codec) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var writeMu sync.Mutex
+	send := func(resp response) {
+		data, err := json.Marshal(resp)
+		if err == nil {
+			writeMu.Lock()
+			err = codec.write(data)
+			writeMu.Unlock()
+		}
+		if err != nil {
+			slog.Debug("Failed to send JSON-RPC response", "error", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		message, err := codec.read()
+		if isNotification(message) {
+			// Notifications, such as edits to a document, update state that
+			// later calls depend on, so they are handled in order
+			s.handle(ctx, message)
+		} else if len(message) > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if resp, ok := s.handle(ctx, message); ok {
+					send(resp)
+				}
+			}()
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				slog.Debug("JSON-RPC connection failed", "error", err)
+			}
+			return
+		}
+	}
+}
+
+// codec reads and writes the messages of a connection
+type codec interface {
+	read() ([]byte, error)
+	write(message []byte) error
+}
+
+// lineCodec frames messages as lines
+type lineCodec struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+func (c lineCodec) read() ([]byte, error) {
+	return c.r.ReadBytes('\n')
+}
+
+func (c lineCodec) write(message []byte) error {
+	_, err := c.w.Write(append(message, '\n'))
+	return err
+}
+
+// headerCodec frames messages with a Content-Length header, as in the
+// Language Server Protocol's base protocol
+type headerCodec struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+func (c headerCodec) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(c.r, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+func (c headerCodec) write(message []byte) error {
+	_, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(message), message)
+	return err
+}
+
+// handle answers one message, reporting !ok for notifications, which get no
+// response
+func (s *Server) handle(ctx context.Context, message []byte) (response, bool) {
+	var req request
+	if err := json.Unmarshal(message, &req); err != nil {
+		if len(bytes.TrimSpace(message)) == 0 {
+			return response{}, false
+		}
+		return errorResponse(nil, &Error{Code: CodeParseError, Message: "invalid JSON: " + err.Error()}), true
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, &Error{Code: CodeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}), true
+	}
+
+	handler, ok := s.methods[req.Method]
+	if !ok {
+		if req.ID == nil {
+			return response{}, false
+		}
+		return errorResponse(req.ID, &Error{Code: CodeMethodNotFound, Message: "unknown method " + req.Method}), true
+	}
+
+	result, err := handler(ctx, req.Params)
+	if req.ID == nil {
+		return response{}, false
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeServerError, Message: err.Error()}
+		}
+		return errorResponse(req.ID, rpcErr), true
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, &Error{Code: CodeInternalError, Message: "failed to encode result: " + err.Error()}), true
+	}
+	return response{JSONRPC: "2.0", ID: req.ID, Result: data}, true
+}
+
+// isNotification reports whether a message is a well-formed request without
+// an ID
+func isNotification(message []byte) bool {
+	var req request
+	return json.Unmarshal(message, &req) == nil && req.ID == nil && req.Method != ""
+}
+
+// errorResponse answers the call with id, or a malformed one, with err
+func errorResponse(id json.RawMessage, err *Error) response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return response{JSONRPC: "2.0", ID: id, Error: err}
+}
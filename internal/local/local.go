@@ -0,0 +1,279 @@
+// Package local computes embeddings offline with a small sentence embedding
+// model, such as all-MiniLM-L6-v2 or bge-small-en-v1.5, run in-process with
+// ONNX Runtime, so indexing makes no network calls
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ModelDir is the directory holding the model's model.onnx (or
+// onnx/model.onnx, as laid out on Hugging Face) and vocab.txt
+var ModelDir = ""
+
+// LibraryPath is the ONNX Runtime shared library, loaded on first use. Empty
+// finds the platform's library on the system's library path.
+var LibraryPath = ""
+
+// model describes how a supported model's embeddings are computed
+type model struct {
+	maxTokens   int    // Longest input; longer texts are truncated
+	clsPooling  bool   // Embed texts as the [CLS] token's vector rather than the mean of all tokens
+	queryPrefix string // Instruction prepended to search queries
+}
+
+// Models that can be run, by name
+var models = map[string]model{
+	"all-MiniLM-L6-v2":  {maxTokens: 256},
+	"all-MiniLM-L12-v2": {maxTokens: 256},
+	"bge-small-en-v1.5": {maxTokens: 512, clsPooling: true, queryPrefix: "Represent this sentence for searching relevant passages: "},
+}
+
+// session is the loaded model, shared by every request
+type session struct {
+	onnx       *ort.DynamicAdvancedSession
+	tokenizer  *tokenizer
+	inputNames []string
+}
+
+var (
+	sessionMu sync.Mutex
+	loaded    *session
+)
+
+// Check returns an error if the model files are missing, so an index run
+// fails before it starts rather than on its first batch
+func Check() error {
+	if _, err := modelPath(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(ModelDir, "vocab.txt")); err != nil {
+		return fmt.Errorf("no vocab.txt in local model directory %s", ModelDir)
+	}
+	return nil
+}
+
+// Embed computes the embeddings of texts with a model, prefixing the
+// instruction it expects of search queries when query is true. It returns
+// them in the order of the texts, normalized to unit length, and the number
+// of tokens embedded.
+func Embed(ctx context.Context, name string, texts []string, query bool) ([][]float32, int, error) {
+	m, ok := models[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("unknown local embedding model %q", name)
+	}
+	s, err := load()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Pad every text to the longest in the batch, masking the padding out
+	var sequences [][]int64
+	longest, tokens := 0, 0
+	for _, text := range texts {
+		if query {
+			text = m.queryPrefix + text
+		}
+		ids := s.tokenizer.encode(text, m.maxTokens)
+		sequences = append(sequences, ids)
+		longest = max(longest, len(ids))
+		tokens += len(ids)
+	}
+	ids := make([]int64, len(texts)*longest)
+	mask := make([]int64, len(texts)*longest)
+	for i, sequence := range sequences {
+		copy(ids[i*longest:], sequence)
+		for j := range sequence {
+			mask[i*longest+j] = 1
+		}
+	}
+
+	shape := ort.NewShape(int64(len(texts)), int64(longest))
+	var inputs []ort.Value
+	defer func() {
+		for _, input := range inputs {
+			input.Destroy()
+		}
+	}()
+	for _, inputName := range s.inputNames {
+		data := mask
+		switch inputName {
+		case "input_ids":
+			data = ids
+		case "token_type_ids":
+			data = make([]int64, len(ids))
+		}
+		tensor, err := ort.NewTensor(shape, data)
+		if err != nil {
+			return nil, 0, err
+		}
+		inputs = append(inputs, tensor)
+	}
+
+	outputs := []ort.Value{nil}
+	if err := s.onnx.Run(inputs, outputs); err != nil {
+		return nil, 0, fmt.Errorf("local embedding model failed: %v", err)
+	}
+	defer outputs[0].Destroy()
+	output, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, 0, fmt.Errorf("local embedding model returned %s rather than float32 vectors", outputs[0].GetONNXType())
+	}
+
+	vectors, err := pool(output.GetData(), output.GetShape(), mask, m.clsPooling)
+	if err != nil {
+		return nil, 0, err
+	}
+	return vectors, tokens, nil
+}
+
+// pool reduces the model's per-token vectors, of shape [texts, tokens,
+// dimensions], to one unit-length vector per text. Models exported with
+// pooling built in return [texts, dimensions] instead.
+func pool(data []float32, shape ort.Shape, mask []int64, clsPooling bool) ([][]float32, error) {
+	var vectors [][]float32
+	switch len(shape) {
+	case 2:
+		dims := int(shape[1])
+		for i := range int(shape[0]) {
+			vectors = append(vectors, append([]float32(nil), data[i*dims:(i+1)*dims]...))
+		}
+	case 3:
+		texts, length, dims := int(shape[0]), int(shape[1]), int(shape[2])
+		for i := range texts {
+			vector := make([]float32, dims)
+			if clsPooling {
+				copy(vector, data[i*length*dims:])
+			} else {
+				count := float32(0)
+				for j := range length {
+					if mask[i*length+j] == 0 {
+						continue
+					}
+					token := data[(i*length+j)*dims:]
+					for k := range vector {
+						vector[k] += token[k]
+					}
+					count++
+				}
+				for k := range vector {
+					vector[k] /= count
+				}
+			}
+			vectors = append(vectors, vector)
+		}
+	default:
+		return nil, fmt.Errorf("local embedding model returned vectors of unexpected shape %s", shape)
+	}
+
+	for _, vector := range vectors {
+		var norm float64
+		for _, v := range vector {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			scale := float32(1 / math.Sqrt(norm))
+			for k := range vector {
+				vector[k] *= scale
+			}
+		}
+	}
+	return vectors, nil
+}
+
+// load starts ONNX Runtime and loads the model and its vocabulary on first
+// use
+func load() (*session, error) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	if loaded != nil {
+		return loaded, nil
+	}
+
+	path, err := modelPath()
+	if err != nil {
+		return nil, err
+	}
+	tokenizer, err := loadTokenizer(filepath.Join(ModelDir, "vocab.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the local model's vocabulary: %v", err)
+	}
+
+	if !ort.IsInitialized() {
+		ort.SetSharedLibraryPath(libraryPath())
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, fmt.Errorf("failed to load ONNX Runtime from %s (set onnxruntime_library to its path): %v", libraryPath(), err)
+		}
+	}
+
+	inputInfo, outputInfo, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local model %s: %v", path, err)
+	}
+	var inputNames []string
+	for _, info := range inputInfo {
+		switch info.Name {
+		case "input_ids", "attention_mask", "token_type_ids":
+			inputNames = append(inputNames, info.Name)
+		default:
+			return nil, fmt.Errorf("local model %s has unexpected input %q", path, info.Name)
+		}
+	}
+	if len(outputInfo) == 0 {
+		return nil, fmt.Errorf("local model %s has no outputs", path)
+	}
+	outputName := outputInfo[0].Name
+	for _, info := range outputInfo {
+		if info.Name == "last_hidden_state" {
+			outputName = info.Name
+		}
+	}
+
+	onnx, err := ort.NewDynamicAdvancedSession(path, inputNames, []string{outputName}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load local model %s: %v", path, err)
+	}
+	loaded = &session{onnx: onnx, tokenizer: tokenizer, inputNames: inputNames}
+	return loaded, nil
+}
+
+// modelPath returns the path of the model's ONNX file
+func modelPath() (string, error) {
+	for _, name := range []string{"model.onnx", filepath.Join("onnx", "model.onnx")} {
+		path := filepath.Join(ModelDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no model.onnx in local model directory %s", ModelDir)
+}
+
+// libraryPath returns LibraryPath, or the platform's name of the ONNX
+// Runtime library
+func libraryPath() string {
+	if LibraryPath != "" {
+		return LibraryPath
+	}
+	switch runtime.GOOS {
+	case "windows":
+		return "onnxruntime.dll"
+	case "darwin":
+		return "libonnxruntime.dylib"
+	default:
+		return "libonnxruntime.so"
+	}
+}
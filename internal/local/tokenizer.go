@@ -0,0 +1,143 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Words longer than this many characters become a single unknown token, as
+// in BERT's reference tokenizer
+const maxWordChars = 100
+
+// tokenizer splits text into the WordPiece token IDs of an uncased BERT
+// vocabulary, the tokenizer of MiniLM and BGE models
+type tokenizer struct {
+	vocab         map[string]int64
+	cls, sep, unk int64
+}
+
+// loadTokenizer reads a vocab.txt file, which lists one token per line in
+// the order of their IDs
+func loadTokenizer(path string) (*tokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	t := &tokenizer{vocab: make(map[string]int64)}
+	scanner := bufio.NewScanner(file)
+	for id := int64(0); scanner.Scan(); id++ {
+		t.vocab[strings.TrimRight(scanner.Text(), "\r")] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for token, id := range map[string]*int64{"[CLS]": &t.cls, "[SEP]": &t.sep, "[UNK]": &t.unk} {
+		var ok bool
+		if *id, ok = t.vocab[token]; !ok {
+			return nil, fmt.Errorf("%s has no %s token", path, token)
+		}
+	}
+	return t, nil
+}
+
+// encode returns the token IDs of text between [CLS] and [SEP], truncated to
+// maxTokens in all
+func (t *tokenizer) encode(text string, maxTokens int) []int64 {
+	ids := []int64{t.cls}
+	for _, word := range splitWords(text) {
+		for _, id := range t.wordPieces(word) {
+			if len(ids) == maxTokens-1 {
+				return append(ids, t.sep)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return append(ids, t.sep)
+}
+
+// wordPieces splits a word into the longest vocabulary pieces from the left,
+// continuations prefixed with ##, or returns the unknown token if it can't
+func (t *tokenizer) wordPieces(word string) []int64 {
+	runes := []rune(word)
+	if len(runes) > maxWordChars {
+		return []int64{t.unk}
+	}
+
+	var ids []int64
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if id, ok := t.vocab[piece]; ok {
+				ids = append(ids, id)
+				break
+			}
+		}
+		if end == start {
+			return []int64{t.unk}
+		}
+		start = end
+	}
+	return ids
+}
+
+// splitWords lowercases text, strips accents, and splits it on whitespace,
+// with each punctuation mark and CJK character a word of its own
+func splitWords(text string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		switch {
+		case r == 0 || r == unicode.ReplacementChar || unicode.Is(unicode.Mn, r):
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.IsControl(r):
+		case isPunctuation(r) || isCJK(r):
+			flush()
+			words = append(words, string(r))
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+// isPunctuation reports whether BERT treats r as punctuation, which includes
+// every non-alphanumeric ASCII symbol
+func isPunctuation(r rune) bool {
+	if r >= 33 && r <= 47 || r >= 58 && r <= 64 || r >= 91 && r <= 96 || r >= 123 && r <= 126 {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// isCJK reports whether r is in a CJK Unified Ideographs block
+func isCJK(r rune) bool {
+	return r >= 0x4E00 && r <= 0x9FFF ||
+		r >= 0x3400 && r <= 0x4DBF ||
+		r >= 0x20000 && r <= 0x2A6DF ||
+		r >= 0x2A700 && r <= 0x2B73F ||
+		r >= 0x2B740 && r <= 0x2B81F ||
+		r >= 0x2B820 && r <= 0x2CEAF ||
+		r >= 0xF900 && r <= 0xFAFF ||
+		r >= 0x2F800 && r <= 0x2FA1F
+}
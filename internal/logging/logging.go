@@ -0,0 +1,153 @@
+// Package logging configures the leveled slog logger used for status
+// messages, warnings, and errors. Logs go to stderr so stdout carries only
+// command output such as summaries and search results.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Supported values of the log_level and log_format settings
+var (
+	Levels  = []string{"debug", "info", "warn", "error"}
+	Formats = []string{"text", "json"}
+)
+
+// Format of the installed logger
+var format = "text"
+
+// Setup installs the default slog logger at level ("debug", "info", "warn",
+// or "error") in format ("text" or "json"). Messages from the standard log
+// package, such as log.Fatalf, are logged at error level.
+func Setup(level, logFormat string) error {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (supported: %s)", level, strings.Join(Levels, ", "))
+	}
+
+	var handler slog.Handler
+	switch logFormat {
+	case "text":
+		handler = NewTextHandler(os.Stderr, minLevel)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: minLevel})
+	default:
+		return fmt.Errorf("invalid log format %q (supported: %s)", logFormat, strings.Join(Formats, ", "))
+	}
+
+	format = logFormat
+	slog.SetDefault(slog.New(handler))
+	slog.SetLogLoggerLevel(slog.LevelError)
+	return nil
+}
+
+// JSON reports whether logs are written as JSON
+func JSON() bool {
+	return format == "json"
+}
+
+// Enabled reports whether messages at level are logged
+func Enabled(level slog.Level) bool {
+	return slog.Default().Enabled(context.Background(), level)
+}
+
+// ProgressEnabled reports whether progress bars should be drawn: only for
+// text logs at info level or below, so quiet and JSON runs stay parseable
+func ProgressEnabled() bool {
+	return !JSON() && Enabled(slog.LevelInfo)
+}
+
+// textHandler writes terse human-readable lines: the message followed by
+// key=value attributes, with warnings and errors prefixed by their level
+type textHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	level  slog.Leveler
+	attrs  string // Preformatted attributes from WithAttrs
+	prefix string // Group prefix for attribute keys
+}
+
+// NewTextHandler returns a handler writing human-readable lines to w
+func NewTextHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return &textHandler{w: w, mu: &sync.Mutex{}, level: level}
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("Debug: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&b, h.prefix, a)
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		appendAttr(&b, h.prefix, a)
+	}
+	clone := *h
+	clone.attrs += b.String()
+	return &clone
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// appendAttr writes " key=value", flattening groups into dotted keys
+func appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	b.WriteByte(' ')
+	b.WriteString(prefix + a.Key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
@@ -0,0 +1,98 @@
+// Package metrics defines the Prometheus metrics recorded throughout codie.
+// They are always collected and exposed only when a server serves Handler.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds codie's metrics plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// FilesIndexed counts files chunked and embedded, by result ("ok", "error", or "skipped")
+	FilesIndexed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "codie_files_indexed_total",
+		Help: "Files chunked and embedded, by result.",
+	}, []string{"result"})
+
+	// ChunksEmbedded counts embeddings received from the API
+	ChunksEmbedded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "codie_chunks_embedded_total",
+		Help: "Code chunks and queries embedded.",
+	})
+
+	// APIRequestDuration observes API request latency by API ("embeddings"
+	// or "chat"), model, and result
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "codie_api_request_duration_seconds",
+		Help:    "Latency of embedding and chat API requests.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"api", "model", "result"})
+
+	// RateLimitWait observes time spent waiting for the API rate limiter
+	RateLimitWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "codie_rate_limit_wait_seconds",
+		Help:    "Time requests waited for the API rate limiter.",
+		Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 15, 60},
+	})
+
+	// ContentCacheLookups counts file content cache lookups by result ("hit" or "miss")
+	ContentCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "codie_content_cache_lookups_total",
+		Help: "File content cache lookups, by result.",
+	}, []string{"result"})
+
+	// StoreBytes is the size of the index file last written or read
+	StoreBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "codie_store_size_bytes",
+		Help: "Size of the index file last written or read.",
+	})
+
+	// StoreChunks is the number of chunks in the index file last written or read
+	StoreChunks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "codie_store_chunks",
+		Help: "Chunks in the index file last written or read.",
+	})
+
+	// RPCDuration observes gRPC request latency by method and status code
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "codie_grpc_request_duration_seconds",
+		Help:    "Latency of gRPC requests served.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		FilesIndexed,
+		ChunksEmbedded,
+		APIRequestDuration,
+		RateLimitWait,
+		ContentCacheLookups,
+		StoreBytes,
+		StoreChunks,
+		RPCDuration,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveAPIRequest records the latency of an API request that started at start
+func ObserveAPIRequest(api, model string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	APIRequestDuration.WithLabelValues(api, model, result).Observe(time.Since(start).Seconds())
+}
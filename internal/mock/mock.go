@@ -0,0 +1,83 @@
+// Package mock stands in for the embeddings and chat APIs with deterministic
+// local fakes, so the whole pipeline can run in CI, tests, and demos without
+// an API key or network access
+package mock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/exolottl/codie/internal/pricing"
+)
+
+// Dimensions of the pseudo-embeddings
+const Dimensions = 256
+
+// Embed returns pseudo-embeddings of texts and the tokens they would have
+// used. Each word is hashed to a signed dimension, so texts sharing words
+// have similar vectors and search still finds plausible matches.
+func Embed(texts []string) ([][]float32, int) {
+	vectors := make([][]float32, 0, len(texts))
+	tokens := 0
+	for _, text := range texts {
+		vector := make([]float32, Dimensions)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			hash := fnv.New32a()
+			hash.Write([]byte(word))
+			sum := hash.Sum32()
+			if sum&(1<<31) != 0 {
+				vector[sum%Dimensions]--
+			} else {
+				vector[sum%Dimensions]++
+			}
+		}
+
+		var norm float64
+		for _, v := range vector {
+			norm += float64(v) * float64(v)
+		}
+		if norm == 0 {
+			vector[0] = 1
+		} else {
+			scale := float32(1 / math.Sqrt(norm))
+			for i := range vector {
+				vector[i] *= scale
+			}
+		}
+		vectors = append(vectors, vector)
+		tokens += pricing.EstimateTokens(text)
+	}
+	return vectors, tokens
+}
+
+// Generate returns a canned reply to a prompt, along with estimated prompt
+// and reply tokens. Prompts asking for a JSON array or object get an empty
+// one, which every caller accepts; others get a short Markdown summary
+// naming a digest of the prompt, so different prompts get different replies.
+func Generate(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (string, int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, 0, err
+	}
+
+	var reply string
+	switch {
+	case strings.Contains(prompt, "Reply with only a JSON array"):
+		reply = "[]"
+	case strings.Contains(prompt, "Reply with only a JSON object"):
+		reply = "{}"
+	default:
+		digest := sha256.Sum256([]byte(systemPrompt + "\n" + prompt))
+		reply = fmt.Sprintf("## Summary\n\nCanned reply from the mock provider to a prompt of %d characters (digest %s). No API was called.\n",
+			len(prompt), hex.EncodeToString(digest[:])[:12])
+	}
+	return reply, pricing.EstimateTokens(systemPrompt + prompt), pricing.EstimateTokens(reply), nil
+}
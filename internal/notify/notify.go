@@ -0,0 +1,247 @@
+// Package notify posts markdown reports to Slack and Microsoft Teams
+// incoming webhooks, split into as many messages as their length limits need
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/httpclient"
+)
+
+// Maximum characters of one Slack message; Slack truncates longer ones
+const slackMaxChars = 3900
+
+// Maximum characters of one Teams message, well within its 28 KB payload limit
+const teamsMaxChars = 20000
+
+// Times a message is retried when the webhook is rate limited
+const maxRetries = 3
+
+// Longest wait for a rate limit, whatever Retry-After asks for
+const maxRetryWait = 30 * time.Second
+
+var (
+	heading      = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	boldStars    = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	boldLines    = regexp.MustCompile(`__(.+?)__`)
+	markdownLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	bullet       = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+)
+
+// HTTPClient sends webhook requests
+var HTTPClient = &http.Client{Transport: httpclient.Transport, Timeout: 30 * time.Second}
+
+// Kind returns the chat service a webhook URL belongs to: "teams" for
+// Microsoft Teams and Power Automate, or "slack" for Slack and the services
+// accepting its payloads, such as Mattermost
+func Kind(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return "slack"
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, suffix := range []string{"webhook.office.com", "logic.azure.com", "powerplatform.com", "powerautomate.com"} {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return "teams"
+		}
+	}
+	return "slack"
+}
+
+// Post sends a markdown report to a Slack or Teams webhook, converted to its
+// markup and split into messages short enough to be shown whole. It returns
+// the number of messages sent.
+func Post(ctx context.Context, webhookURL, title, markdown string) (int, error) {
+	kind := Kind(webhookURL)
+	text, limit := toSlack(markdown), slackMaxChars
+	if kind == "teams" {
+		text, limit = toTeams(markdown), teamsMaxChars
+	}
+
+	parts := Split(text, limit-len(title)-20) // Room for the title line
+	for i, part := range parts {
+		header := title
+		if len(parts) > 1 {
+			header = fmt.Sprintf("%s (%d/%d)", title, i+1, len(parts))
+		}
+
+		var payload any
+		if kind == "teams" {
+			payload = teamsPayload(header, part)
+		} else {
+			payload = map[string]string{"text": "*" + escapeSlack(header) + "*\n" + part}
+		}
+		if err := send(ctx, webhookURL, payload); err != nil {
+			return i, fmt.Errorf("message %d of %d: %w", i+1, len(parts), err)
+		}
+	}
+	return len(parts), nil
+}
+
+// teamsPayload wraps a message in an Adaptive Card, which both Teams
+// connectors and Power Automate workflows accept
+func teamsPayload(title, text string) any {
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"msteams": map[string]string{"width": "Full"},
+		"body": []map[string]any{
+			{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true},
+			{"type": "TextBlock", "text": text, "wrap": true},
+		},
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
+
+// send posts one message, waiting and retrying while the webhook is rate limited
+func send(ctx context.Context, webhookURL string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			wait := time.Second
+			if seconds, err := time.ParseDuration(resp.Header.Get("Retry-After") + "s"); err == nil && seconds > 0 {
+				wait = min(seconds, maxRetryWait)
+			}
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+		}
+		return nil
+	}
+}
+
+// Split breaks text into parts of at most limit characters at line
+// boundaries. A code block cut in two is closed at the end of one part and
+// reopened at the start of the next.
+func Split(text string, limit int) []string {
+	const fence = "```"
+	limit = max(limit, 100)
+
+	var parts []string
+	var current strings.Builder
+	inFence := false
+	flush := func() {
+		part := current.String()
+		if inFence {
+			part += fence + "\n"
+		}
+		if strings.TrimSpace(part) != "" {
+			parts = append(parts, strings.TrimRight(part, "\n"))
+		}
+		current.Reset()
+		if inFence {
+			current.WriteString(fence + "\n")
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		// Lines too long for any part are cut
+		for len(line) > limit-len(fence)*2-2 {
+			cut := limit - len(fence)*2 - 2
+			if current.Len() > 0 {
+				flush()
+			}
+			current.WriteString(line[:cut] + "\n")
+			flush()
+			line = line[cut:]
+		}
+		if current.Len()+len(line)+1+len(fence)+1 > limit {
+			flush()
+		}
+		current.WriteString(line + "\n")
+		if strings.HasPrefix(strings.TrimSpace(line), fence) {
+			inFence = !inFence
+		}
+	}
+	inFence = false
+	flush()
+	return parts
+}
+
+// toSlack converts markdown to Slack's mrkdwn: headings and bold become
+// *bold*, links become <url|text>, and list markers become bullets. Code
+// blocks are left alone apart from escaping.
+func toSlack(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		line = escapeSlack(line)
+		if inFence {
+			lines[i] = line
+			continue
+		}
+		if match := heading.FindStringSubmatch(line); match != nil {
+			line = "*" + strings.Trim(match[1], "*") + "*"
+		}
+		line = boldStars.ReplaceAllString(line, "*$1*")
+		line = boldLines.ReplaceAllString(line, "*$1*")
+		line = markdownLink.ReplaceAllString(line, "<$2|$1>")
+		line = bullet.ReplaceAllString(line, "$1• ")
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// escapeSlack escapes the characters Slack reserves for its own markup
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// toTeams converts markdown to the subset Adaptive Cards render: headings,
+// which they don't support, become bold lines
+func toTeams(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	inFence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if match := heading.FindStringSubmatch(line); match != nil && !inFence {
+			lines[i] = "**" + strings.Trim(match[1], "*") + "**"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,96 @@
+package pricing
+
+import (
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ModelPrice holds the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Known model prices (USD per 1M tokens)
+var modelPrices = map[string]ModelPrice{
+	string(openai.SmallEmbedding3):              {Input: 0.02},
+	string(openai.LargeEmbedding3):              {Input: 0.13},
+	string(openai.AdaEmbeddingV2):               {Input: 0.10},
+	"embed-english-v3.0":                        {Input: 0.10},
+	"embed-multilingual-v3.0":                   {Input: 0.10},
+	"embed-english-light-v3.0":                  {Input: 0.10},
+	"embed-multilingual-light-v3.0":             {Input: 0.10},
+	"text-embedding-004":                        {Input: 0.10},
+	"text-embedding-005":                        {Input: 0.10},
+	"text-multilingual-embedding-002":           {Input: 0.10},
+	"amazon.titan-embed-text-v2:0":              {Input: 0.02},
+	"amazon.titan-embed-text-v1":                {Input: 0.10},
+	"cohere.embed-english-v3":                   {Input: 0.10},
+	"cohere.embed-multilingual-v3":              {Input: 0.10},
+	openai.GPT4o:                                {Input: 2.50, Output: 10.00},
+	openai.GPT4oMini:                            {Input: 0.15, Output: 0.60},
+	openai.GPT4Turbo:                            {Input: 10.00, Output: 30.00},
+	openai.O1:                                   {Input: 15.00, Output: 60.00},
+	openai.O1Mini:                               {Input: 1.10, Output: 4.40},
+	openai.O3Mini:                               {Input: 1.10, Output: 4.40},
+	"claude-3-7-sonnet-latest":                  {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet-20250219":                {Input: 3.00, Output: 15.00},
+	"claude-3-5-sonnet-latest":                  {Input: 3.00, Output: 15.00},
+	"claude-3-5-sonnet-20241022":                {Input: 3.00, Output: 15.00},
+	"claude-3-5-haiku-latest":                   {Input: 0.80, Output: 4.00},
+	"claude-3-5-haiku-20241022":                 {Input: 0.80, Output: 4.00},
+	"claude-3-opus-latest":                      {Input: 15.00, Output: 75.00},
+	"claude-3-haiku-20240307":                   {Input: 0.25, Output: 1.25},
+	"gemini-1.5-pro":                            {Input: 1.25, Output: 5.00},
+	"gemini-1.5-flash":                          {Input: 0.075, Output: 0.30},
+	"gemini-2.0-flash":                          {Input: 0.15, Output: 0.60},
+	"gemini-2.0-flash-lite":                     {Input: 0.075, Output: 0.30},
+	"anthropic.claude-3-5-sonnet-20241022-v2:0": {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-5-sonnet-20240620-v1:0": {Input: 3.00, Output: 15.00},
+	"anthropic.claude-3-5-haiku-20241022-v1:0":  {Input: 0.80, Output: 4.00},
+	"anthropic.claude-3-haiku-20240307-v1:0":    {Input: 0.25, Output: 1.25},
+	"anthropic.claude-3-opus-20240229-v1:0":     {Input: 15.00, Output: 75.00},
+}
+
+// EstimateTokens approximates the number of tokens in text (roughly 4 characters per token)
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// PriceFor returns the price of a model and whether it is known
+func PriceFor(model string) (ModelPrice, bool) {
+	price, ok := modelPrices[model]
+	if !ok {
+		// Bedrock inference profiles, such as us.anthropic.claude-..., are
+		// priced as their model
+		if _, base, found := strings.Cut(model, "."); found && strings.Contains(base, ".") {
+			price, ok = modelPrices[base]
+		}
+	}
+	return price, ok
+}
+
+// EstimateCost returns the estimated cost in USD for the given token counts.
+// Unknown models are priced at zero.
+func EstimateCost(model string, inputTokens, outputTokens int) float64 {
+	price, ok := PriceFor(model)
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*price.Input + float64(outputTokens)*price.Output) / 1_000_000
+}
+
+// MaxInputTokens returns how many input tokens fit within budget (USD) after
+// reserving room for outputTokens. Unknown models return -1 (no limit).
+func MaxInputTokens(model string, budget float64, outputTokens int) int {
+	price, ok := PriceFor(model)
+	if !ok || price.Input <= 0 {
+		return -1
+	}
+	remaining := budget - float64(outputTokens)*price.Output/1_000_000
+	if remaining <= 0 {
+		return 0
+	}
+	return int(remaining * 1_000_000 / price.Input)
+}
@@ -0,0 +1,143 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Width of the bar drawn for stages with a known total
+const barWidth = 24
+
+// Display shows the progress of a Tracker until stopped
+type Display struct {
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// Stop stops the display, drawing the progress on a terminal one last time
+func (d *Display) Stop() {
+	close(d.stop)
+	d.done.Wait()
+}
+
+// run calls draw every interval until the display is stopped, and once more
+// then if final is set
+func (d *Display) run(interval time.Duration, final bool, draw func()) {
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				draw()
+			case <-d.stop:
+				if final {
+					draw()
+				}
+				return
+			}
+		}
+	}()
+}
+
+// StartTerminal draws the progress of t to a terminal, one line per stage,
+// redrawn in place every interval
+func StartTerminal(w io.Writer, t *Tracker, interval time.Duration) *Display {
+	d := &Display{stop: make(chan struct{})}
+	lines := 0
+	d.run(interval, true, func() {
+		var b strings.Builder
+		// Move back to the first line drawn last time
+		if lines > 0 {
+			fmt.Fprintf(&b, "\033[%dA", lines)
+		}
+		stats := t.Snapshot()
+		for _, s := range stats {
+			b.WriteString("\033[2K" + formatStage(s, true) + "\n")
+		}
+		lines = len(stats)
+		io.WriteString(w, b.String())
+	})
+	return d
+}
+
+// StartLog logs the progress of the unfinished stages of t every interval,
+// for JSON logs and output that isn't a terminal
+func StartLog(t *Tracker, interval time.Duration) *Display {
+	d := &Display{stop: make(chan struct{})}
+	d.run(interval, false, func() {
+		for _, s := range t.Snapshot() {
+			if s.Done {
+				continue
+			}
+			attrs := []any{"stage", s.Stage, "items", s.Items, "total", s.Total, "elapsed", s.Elapsed().Round(time.Millisecond)}
+			if eta := s.ETA(); eta > 0 {
+				attrs = append(attrs, "eta", eta.Round(time.Second))
+			}
+			if s.Stage == Embedding {
+				attrs = append(attrs, "in_flight", s.InFlight, "rate_limited", s.Waiting)
+			}
+			slog.Info("Progress", attrs...)
+		}
+	})
+	return d
+}
+
+// formatStage describes the progress of a stage on one line, with a bar
+// when asked and the stage's total is known
+func formatStage(s StageStats, bar bool) string {
+	unit := "files"
+	if s.Stage == Embedding {
+		unit = "chunks"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-10s ", s.Stage)
+	if bar && s.Total > 0 {
+		filled := min(barWidth, barWidth*s.Items/s.Total)
+		b.WriteString("[" + strings.Repeat("=", filled) + strings.Repeat(" ", barWidth-filled) + "] ")
+	}
+	if s.Total > 0 {
+		fmt.Fprintf(&b, "%d/%d %s", s.Items, s.Total, unit)
+	} else {
+		fmt.Fprintf(&b, "%d %s", s.Items, unit)
+	}
+	if s.Chunks > 0 {
+		fmt.Fprintf(&b, ", %d chunks", s.Chunks)
+	}
+	if s.InFlight > 0 {
+		fmt.Fprintf(&b, ", %d in flight", s.InFlight)
+	}
+	if s.Waiting > 0 {
+		fmt.Fprintf(&b, ", %d rate limited", s.Waiting)
+	}
+	fmt.Fprintf(&b, "  %s", s.Elapsed().Round(100*time.Millisecond))
+	if eta := s.ETA(); eta > 0 {
+		fmt.Fprintf(&b, "  ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+// LogTimings logs the time each stage took, with the items it processed
+// and, where workers overlapped, the time they spent on it in all
+func LogTimings(t *Tracker) {
+	for _, s := range t.Snapshot() {
+		attrs := []any{"stage", s.Stage, "items", s.Items, "elapsed", s.Elapsed().Round(time.Millisecond)}
+		if s.Chunks > 0 {
+			attrs = append(attrs, "chunks", s.Chunks)
+		}
+		if s.Busy > 0 {
+			attrs = append(attrs, "busy", s.Busy.Round(time.Millisecond))
+		}
+		if s.Waited > 0 {
+			attrs = append(attrs, "rate_limit_wait", s.Waited.Round(time.Millisecond))
+		}
+		slog.Info("Stage timing", attrs...)
+	}
+}
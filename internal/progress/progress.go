@@ -0,0 +1,162 @@
+// Package progress reports the stages of an indexing run as events. The
+// pipeline reports to the Reporter carried by its context, so a terminal
+// display, JSON logs, or a server can each follow a run the same way.
+package progress
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stage is a step of the indexing pipeline. Stages overlap, as each file
+// is chunked, embedded, and written as soon as the one before is done.
+type Stage string
+
+const (
+	Discovery Stage = "discovery" // Listing the files to index; items are files
+	Chunking  Stage = "chunking"  // Reading and splitting files; items are files
+	Embedding Stage = "embedding" // Embedding requests; items are chunks
+	Writing   Stage = "writing"   // Writing chunks to the store; items are files
+)
+
+// Stages in pipeline order
+var Stages = []Stage{Discovery, Chunking, Embedding, Writing}
+
+// Event is a change in the progress of a stage. Every field but Stage is a
+// change to add, so events from concurrent workers can be applied in any
+// order.
+type Event struct {
+	Stage    Stage
+	Total    int           // Items the stage is expected to process
+	Items    int           // Items finished
+	Chunks   int           // Chunks produced, by Chunking
+	Duration time.Duration // Time spent on the items, summed across workers
+	InFlight int           // Embedding requests sent (+1) or answered (-1)
+	Waiting  int           // Requests starting (+1) or done (-1) waiting for the rate limiter
+	Waited   time.Duration // Time a request waited for the rate limiter
+	Done     bool          // The stage is finished
+}
+
+// Reporter receives the events of a run, from many goroutines at once
+type Reporter interface {
+	Report(Event)
+}
+
+type contextKey struct{}
+
+// WithReporter returns a context whose pipeline work reports to r
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// Report sends an event to the Reporter of ctx, if it has one
+func Report(ctx context.Context, event Event) {
+	if r, ok := ctx.Value(contextKey{}).(Reporter); ok {
+		r.Report(event)
+	}
+}
+
+// TrackerFrom returns the Tracker ctx reports to, or nil if it reports to
+// none or to another Reporter
+func TrackerFrom(ctx context.Context) *Tracker {
+	tracker, _ := ctx.Value(contextKey{}).(*Tracker)
+	return tracker
+}
+
+// StageStats is the progress of one stage
+type StageStats struct {
+	Stage    Stage         `json:"stage"`
+	Total    int           `json:"total"`
+	Items    int           `json:"items"`
+	Chunks   int           `json:"chunks,omitempty"`
+	Busy     time.Duration `json:"busy_ns"` // Time spent summed across workers
+	InFlight int           `json:"in_flight,omitempty"`
+	Waiting  int           `json:"waiting,omitempty"`
+	Waited   time.Duration `json:"waited_ns,omitempty"` // Time spent waiting for the rate limiter
+	Started  time.Time     `json:"started"`             // Time of the stage's first event
+	Updated  time.Time     `json:"updated"`             // Time of its last event
+	Done     bool          `json:"done"`
+}
+
+// Elapsed returns the wall time from the stage's first event to its last,
+// or to now while it is running
+func (s StageStats) Elapsed() time.Duration {
+	if s.Started.IsZero() {
+		return 0
+	}
+	if s.Done {
+		return s.Updated.Sub(s.Started)
+	}
+	return time.Since(s.Started)
+}
+
+// ETA estimates the time left from the stage's rate so far, or returns 0
+// when it can't yet
+func (s StageStats) ETA() time.Duration {
+	if s.Done || s.Items == 0 || s.Total <= s.Items {
+		return 0
+	}
+	perItem := s.Elapsed() / time.Duration(s.Items)
+	return perItem * time.Duration(s.Total-s.Items)
+}
+
+// Tracker is a Reporter that accumulates the progress of each stage
+type Tracker struct {
+	mu     sync.Mutex
+	stages map[Stage]*StageStats
+}
+
+// NewTracker returns a tracker with no progress
+func NewTracker() *Tracker {
+	return &Tracker{stages: make(map[Stage]*StageStats)}
+}
+
+// Report adds an event to the progress of its stage
+func (t *Tracker) Report(event Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	stats, ok := t.stages[event.Stage]
+	if !ok {
+		stats = &StageStats{Stage: event.Stage, Started: now, Updated: now}
+		t.stages[event.Stage] = stats
+	}
+	stats.Total += event.Total
+	stats.Items += event.Items
+	stats.Chunks += event.Chunks
+	stats.Busy += event.Duration
+	stats.InFlight += event.InFlight
+	stats.Waiting += event.Waiting
+	stats.Waited += event.Waited
+	stats.Done = stats.Done || event.Done
+	// Marking a stage done doesn't extend it, so it ends with its last item
+	if event != (Event{Stage: event.Stage, Done: true}) {
+		stats.Updated = now
+	}
+
+	// Every chunk produced is one more to embed
+	if event.Chunks > 0 {
+		if embedding, ok := t.stages[Embedding]; ok {
+			embedding.Total += event.Chunks
+		} else {
+			t.stages[Embedding] = &StageStats{Stage: Embedding, Total: event.Chunks, Started: now, Updated: now}
+		}
+	}
+}
+
+// Snapshot returns the progress of the stages reported so far, in pipeline
+// order
+func (t *Tracker) Snapshot() []StageStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var stats []StageStats
+	for _, stage := range Stages {
+		if s, ok := t.stages[stage]; ok {
+			stats = append(stats, *s)
+		}
+	}
+	return stats
+}
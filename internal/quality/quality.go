@@ -0,0 +1,360 @@
+// Package quality measures the code of an index: the cyclomatic complexity,
+// length, and nesting of its functions, the length of its files, the chunks
+// duplicated between them, and how much of it has doc comments.
+package quality
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Thresholds past which a function or file is reported as hard to maintain
+const (
+	HighComplexity    = 10   // Cyclomatic complexity
+	DeepNesting       = 4    // Nested control-flow blocks
+	LongFunction      = 60   // Lines
+	LongFile          = 1000 // Lines
+	minDuplicateLines = 6    // Non-blank lines a chunk needs to count as duplicated
+)
+
+// Function holds the metrics of a function or method
+type Function struct {
+	File       string `json:"file"`
+	Name       string `json:"name"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Lines      int    `json:"lines"`
+	Complexity int    `json:"complexity"`
+	Nesting    int    `json:"nesting"`
+	Documented bool   `json:"documented"`
+}
+
+// Type holds whether a class, struct, interface, or other named type is
+// documented
+type Type struct {
+	File       string `json:"file"`
+	Name       string `json:"name"`
+	Line       int    `json:"line"`
+	Documented bool   `json:"documented"`
+}
+
+// PackageDocs holds the documentation coverage of a package: the fraction of
+// its functions and types with a doc comment or docstring
+type PackageDocs struct {
+	Package      string  `json:"package"` // Directory of the package
+	Declarations int     `json:"declarations"`
+	Documented   int     `json:"documented"`
+	Coverage     float64 `json:"coverage"` // Between 0 and 1
+}
+
+// File holds the metrics of a file
+type File struct {
+	Path            string `json:"path"`
+	Lines           int    `json:"lines"`
+	Functions       int    `json:"functions"`
+	MaxComplexity   int    `json:"max_complexity"`
+	DuplicateChunks int    `json:"duplicate_chunks"` // Chunks whose code is also found elsewhere
+}
+
+// Location is a range of lines in a file
+type Location struct {
+	File      string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+}
+
+// Duplicate is code found in more than one chunk, ignoring indentation and
+// blank lines
+type Duplicate struct {
+	Lines     int        `json:"lines"` // Non-blank lines of the duplicated code
+	Locations []Location `json:"locations"`
+}
+
+// Report holds the metrics of an index. Functions are ordered by complexity,
+// files by length, and duplicates by the lines they repeat, highest first;
+// packages are ordered by documentation coverage, lowest first.
+type Report struct {
+	Files         []File        `json:"files"`
+	Functions     []Function    `json:"functions"`
+	Types         []Type        `json:"types"`
+	Duplicates    []Duplicate   `json:"duplicates"`
+	Documentation []PackageDocs `json:"documentation"`
+}
+
+// Analyze measures the files of an index, parsing each as it is on disk.
+// Files that can't be read are left out.
+func Analyze(chunks []storage.CodeChunk) Report {
+	byFile := make(map[string][]storage.CodeChunk)
+	for _, chunk := range chunks {
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+	paths := make([]string, 0, len(byFile))
+	for path := range byFile {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	report := Report{Files: []File{}, Functions: []Function{}, Types: []Type{}, Duplicates: findDuplicates(chunks)}
+	duplicated := make(map[string]int)
+	for _, duplicate := range report.Duplicates {
+		for _, location := range duplicate.Locations {
+			duplicated[location.File]++
+		}
+	}
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("Failed to read file", "file", path, "error", err)
+			continue
+		}
+		file := File{
+			Path:            path,
+			Lines:           strings.Count(strings.TrimSuffix(string(content), "\n"), "\n") + 1,
+			DuplicateChunks: duplicated[path],
+		}
+
+		metrics, err := embeddings.ExtractCodeMetrics(path, string(content))
+		if err != nil {
+			slog.Warn("Failed to parse file", "file", path, "error", err)
+		}
+		for _, fn := range metrics.Functions {
+			report.Functions = append(report.Functions, Function{
+				File:       path,
+				Name:       fn.Name,
+				StartLine:  fn.StartLine,
+				EndLine:    fn.EndLine,
+				Lines:      fn.EndLine - fn.StartLine + 1,
+				Complexity: fn.Complexity,
+				Nesting:    fn.Nesting,
+				Documented: fn.Documented,
+			})
+			file.Functions++
+			file.MaxComplexity = max(file.MaxComplexity, fn.Complexity)
+		}
+		for _, t := range metrics.Types {
+			report.Types = append(report.Types, Type{File: path, Name: t.Name, Line: t.StartLine, Documented: t.Documented})
+		}
+		report.Files = append(report.Files, file)
+	}
+	report.Documentation = documentationCoverage(report.Functions, report.Types)
+
+	sort.SliceStable(report.Functions, func(i, j int) bool {
+		return report.Functions[i].Complexity > report.Functions[j].Complexity
+	})
+	sort.SliceStable(report.Files, func(i, j int) bool {
+		return report.Files[i].Lines > report.Files[j].Lines
+	})
+	return report
+}
+
+// documentationCoverage counts the documented functions and types of each
+// package directory
+func documentationCoverage(functions []Function, types []Type) []PackageDocs {
+	byPackage := make(map[string]*PackageDocs)
+	count := func(file string, documented bool) {
+		dir := filepath.Dir(file)
+		if byPackage[dir] == nil {
+			byPackage[dir] = &PackageDocs{Package: dir}
+		}
+		byPackage[dir].Declarations++
+		if documented {
+			byPackage[dir].Documented++
+		}
+	}
+	for _, fn := range functions {
+		count(fn.File, fn.Documented)
+	}
+	for _, t := range types {
+		count(t.File, t.Documented)
+	}
+
+	packages := make([]PackageDocs, 0, len(byPackage))
+	for _, docs := range byPackage {
+		docs.Coverage = float64(docs.Documented) / float64(docs.Declarations)
+		packages = append(packages, *docs)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Coverage != packages[j].Coverage {
+			return packages[i].Coverage < packages[j].Coverage
+		}
+		return packages[i].Package < packages[j].Package
+	})
+	return packages
+}
+
+// DocumentationCoverage returns the fraction of all functions and types
+// with a doc comment or docstring
+func (r Report) DocumentationCoverage() float64 {
+	declarations, documented := 0, 0
+	for _, docs := range r.Documentation {
+		declarations += docs.Declarations
+		documented += docs.Documented
+	}
+	if declarations == 0 {
+		return 0
+	}
+	return float64(documented) / float64(declarations)
+}
+
+// findDuplicates groups chunks whose code is the same once indentation and
+// blank lines are stripped
+func findDuplicates(chunks []storage.CodeChunk) []Duplicate {
+	groups := make(map[[sha256.Size]byte]*Duplicate)
+	var order [][sha256.Size]byte
+	for _, chunk := range chunks {
+		var lines []string
+		for _, line := range strings.Split(chunk.Content, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) < minDuplicateLines {
+			continue
+		}
+
+		key := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+		if groups[key] == nil {
+			groups[key] = &Duplicate{Lines: len(lines)}
+			order = append(order, key)
+		}
+		groups[key].Locations = append(groups[key].Locations, Location{chunk.File, chunk.StartLine, chunk.EndLine})
+	}
+
+	duplicates := []Duplicate{}
+	for _, key := range order {
+		if len(groups[key].Locations) > 1 {
+			duplicates = append(duplicates, *groups[key])
+		}
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Lines*len(duplicates[i].Locations) > duplicates[j].Lines*len(duplicates[j].Locations)
+	})
+	return duplicates
+}
+
+// Relative returns a copy of the report with file paths relative to root
+func (r Report) Relative(root string) Report {
+	rel := func(path string) string {
+		if p, err := filepath.Rel(root, path); err == nil {
+			return filepath.ToSlash(p)
+		}
+		return path
+	}
+	out := Report{
+		Files:         make([]File, len(r.Files)),
+		Functions:     make([]Function, len(r.Functions)),
+		Types:         make([]Type, len(r.Types)),
+		Duplicates:    make([]Duplicate, len(r.Duplicates)),
+		Documentation: make([]PackageDocs, len(r.Documentation)),
+	}
+	for i, file := range r.Files {
+		file.Path = rel(file.Path)
+		out.Files[i] = file
+	}
+	for i, fn := range r.Functions {
+		fn.File = rel(fn.File)
+		out.Functions[i] = fn
+	}
+	for i, t := range r.Types {
+		t.File = rel(t.File)
+		out.Types[i] = t
+	}
+	for i, docs := range r.Documentation {
+		docs.Package = rel(docs.Package)
+		out.Documentation[i] = docs
+	}
+	for i, duplicate := range r.Duplicates {
+		locations := make([]Location, len(duplicate.Locations))
+		for j, location := range duplicate.Locations {
+			location.File = rel(location.File)
+			locations[j] = location
+		}
+		out.Duplicates[i] = Duplicate{duplicate.Lines, locations}
+	}
+	return out
+}
+
+// AverageComplexity returns the mean cyclomatic complexity of the functions
+func (r Report) AverageComplexity() float64 {
+	if len(r.Functions) == 0 {
+		return 0
+	}
+	total := 0
+	for _, fn := range r.Functions {
+		total += fn.Complexity
+	}
+	return float64(total) / float64(len(r.Functions))
+}
+
+// Text renders the report as plain text: totals, then the top most complex
+// functions, longest files, largest duplicates, and least documented packages
+func (r Report) Text(top int) string {
+	var sb strings.Builder
+
+	tooComplex, tooDeep, tooLong, longFiles := 0, 0, 0, 0
+	for _, fn := range r.Functions {
+		if fn.Complexity > HighComplexity {
+			tooComplex++
+		}
+		if fn.Nesting > DeepNesting {
+			tooDeep++
+		}
+		if fn.Lines > LongFunction {
+			tooLong++
+		}
+	}
+	for _, file := range r.Files {
+		if file.Lines > LongFile {
+			longFiles++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("Files: %d (%d over %d lines)\n", len(r.Files), longFiles, LongFile))
+	sb.WriteString(fmt.Sprintf("Functions: %d, average complexity %.1f\n", len(r.Functions), r.AverageComplexity()))
+	sb.WriteString(fmt.Sprintf("- Complexity over %d: %d\n", HighComplexity, tooComplex))
+	sb.WriteString(fmt.Sprintf("- Nesting deeper than %d: %d\n", DeepNesting, tooDeep))
+	sb.WriteString(fmt.Sprintf("- Longer than %d lines: %d\n", LongFunction, tooLong))
+	sb.WriteString(fmt.Sprintf("Duplicated chunks: %d groups\n", len(r.Duplicates)))
+	sb.WriteString(fmt.Sprintf("Documented functions and types: %.0f%%\n", r.DocumentationCoverage()*100))
+
+	if len(r.Functions) > 0 {
+		sb.WriteString("\nMost complex functions:\n")
+		for _, fn := range r.Functions[:min(top, len(r.Functions))] {
+			sb.WriteString(fmt.Sprintf("- %s (%s:%d) complexity %d, nesting %d, %d lines\n",
+				fn.Name, fn.File, fn.StartLine, fn.Complexity, fn.Nesting, fn.Lines))
+		}
+	}
+	if len(r.Files) > 0 {
+		sb.WriteString("\nLongest files:\n")
+		for _, file := range r.Files[:min(top, len(r.Files))] {
+			sb.WriteString(fmt.Sprintf("- %s: %d lines, %d functions, max complexity %d\n",
+				file.Path, file.Lines, file.Functions, file.MaxComplexity))
+		}
+	}
+	if len(r.Duplicates) > 0 {
+		sb.WriteString("\nLargest duplicates:\n")
+		for _, duplicate := range r.Duplicates[:min(top, len(r.Duplicates))] {
+			var locations []string
+			for _, location := range duplicate.Locations {
+				locations = append(locations, fmt.Sprintf("%s:%d-%d", location.File, location.StartLine, location.EndLine))
+			}
+			sb.WriteString(fmt.Sprintf("- %d lines in %s\n", duplicate.Lines, strings.Join(locations, ", ")))
+		}
+	}
+	if len(r.Documentation) > 0 {
+		sb.WriteString("\nLeast documented packages:\n")
+		for _, docs := range r.Documentation[:min(top, len(r.Documentation))] {
+			sb.WriteString(fmt.Sprintf("- %s: %d of %d documented (%.0f%%)\n",
+				docs.Package, docs.Documented, docs.Declarations, docs.Coverage*100))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,160 @@
+// Package retry retries failed API requests with jittered exponential
+// backoff, honoring the waits providers ask for and giving up at once on
+// errors that retrying can't fix
+package retry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/apikeys"
+)
+
+// Policy says how often and how patiently to retry
+type Policy struct {
+	MaxAttempts int           // Attempts in all, including the first
+	BaseDelay   time.Duration // Wait before the first retry, doubling for each after it
+	MaxDelay    time.Duration // Longest wait between attempts
+}
+
+// Default is the policy of API requests; MaxAttempts is set from the
+// max_attempts setting
+var Default = Policy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+// Rate limited requests back off from this many times BaseDelay, as quotas
+// take longer to recover than transient errors
+const rateLimitFactor = 4
+
+// Do calls request until it succeeds, fails with an error that isn't
+// retryable, or MaxAttempts are used up, and returns its last error. Between
+// attempts it waits as long as the error asks with After, or a jittered
+// exponential backoff. It stops as soon as ctx is canceled.
+func (p Policy) Do(ctx context.Context, request func(attempt int) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if err == nil {
+				err = ctxErr
+			}
+			return err
+		}
+		if err = request(attempt); err == nil || !Retryable(err) || ctx.Err() != nil || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		delay := p.backoff(attempt, apikeys.IsRateLimit(err))
+		if wait, ok := retryAfter(err); ok {
+			delay = min(wait, p.MaxDelay)
+		}
+		slog.Warn("Request failed, retrying", "attempt", attempt, "max_attempts", p.MaxAttempts, "delay", delay.Round(time.Millisecond), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait after a failed attempt: BaseDelay doubled for
+// each attempt before it, capped at MaxDelay, and then anywhere from half of
+// that to all of it, so concurrent requests don't retry in lockstep
+func (p Policy) backoff(attempt int, rateLimited bool) time.Duration {
+	delay := p.BaseDelay
+	if rateLimited {
+		delay *= rateLimitFactor
+	}
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// Retryable reports whether retrying might fix a failed request: not when
+// it was canceled, its credentials were rejected, the request itself is
+// invalid, or it was marked with Permanent
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.As(err, new(permanentError)) {
+		return false
+	}
+	if apikeys.IsRateLimit(err) {
+		return true
+	}
+	if apikeys.IsAuthError(err) {
+		return false
+	}
+	message := strings.ToLower(err.Error())
+	for _, marker := range []string{"bad request", "not found", "invalid_request", "context_length_exceeded", "validationexception"} {
+		if strings.Contains(message, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+// permanentError marks an error retrying can't fix
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// Permanent marks err as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// afterError carries how long the provider asked to wait before retrying
+type afterError struct {
+	error
+	wait time.Duration
+}
+
+func (e afterError) Unwrap() error { return e.error }
+
+// After attaches the wait a provider asked for, as with a Retry-After
+// header, to err
+func After(err error, wait time.Duration) error {
+	if err == nil || wait <= 0 {
+		return err
+	}
+	return afterError{err, wait}
+}
+
+// retryAfter returns the wait attached to err with After
+func retryAfter(err error) (time.Duration, bool) {
+	var after afterError
+	if errors.As(err, &after) {
+		return after.wait, true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter returns the wait in a response's retry-after-ms or
+// Retry-After header, which gives seconds or a date
+func ParseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if ms, err := strconv.Atoi(header.Get("retry-after-ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
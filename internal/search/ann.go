@@ -0,0 +1,285 @@
+package search
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"os"
+	"sync"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ANNMinChunks is the smallest index searched through an HNSW graph. Smaller
+// indexes are scored exhaustively, which is fast enough and exact.
+const ANNMinChunks = 10000
+
+// Version of the persisted graph format
+const annFormatVersion = 1
+
+// ANN finds the chunks most similar to a query through an HNSW graph, in
+// time that grows logarithmically with the number of chunks, at the cost of
+// occasionally missing a close match
+type ANN struct {
+	graph      *hnsw
+	chunks     []storage.CodeChunk
+	nodeChunks []int32 // Index in chunks of each graph node
+	dimensions int
+}
+
+// annFile is a graph as persisted: the key of each node's chunk and the
+// node's links. Vectors are not stored; they are the chunks' embeddings.
+type annFile struct {
+	Version  int
+	M        int
+	Keys     []uint64
+	Levels   []int
+	Links    [][][]int32
+	Entry    int32
+	MaxLevel int
+}
+
+// OpenANN returns the ANN index of chunks. The graph persisted at path is
+// loaded and updated for the chunks added and removed since it was saved;
+// it is built from scratch when there is none or most chunks changed. The
+// graph is saved back to path when it changed.
+func OpenANN(path string, chunks []storage.CodeChunk) (*ANN, error) {
+	ann := &ANN{chunks: chunks}
+
+	// Chunks without an embedding of the index's dimensions can't be linked
+	positions := make(map[uint64]int32)
+	var keys []uint64
+	for i, chunk := range chunks {
+		if ann.dimensions == 0 {
+			ann.dimensions = len(chunk.Embedding)
+		}
+		if len(chunk.Embedding) == 0 || len(chunk.Embedding) != ann.dimensions {
+			continue
+		}
+		key := chunkKey(chunk)
+		if _, ok := positions[key]; !ok {
+			positions[key] = int32(i)
+			keys = append(keys, key)
+		}
+	}
+
+	// A missing or unreadable graph is rebuilt
+	stored, _ := loadANNFile(path)
+	if stored == nil {
+		ann.build(positions, keys)
+	} else if changed, ok := ann.update(stored, positions, keys); !ok {
+		ann.build(positions, keys)
+	} else if !changed {
+		return ann, nil
+	}
+
+	return ann, ann.save(path)
+}
+
+// build links every chunk into a new graph
+func (a *ANN) build(positions map[uint64]int32, keys []uint64) {
+	vectors := make([][]float32, len(keys))
+	a.nodeChunks = make([]int32, len(keys))
+	for i, key := range keys {
+		a.nodeChunks[i] = positions[key]
+		vectors[i] = a.chunks[positions[key]].Embedding
+	}
+	a.graph = newHNSW(vectors, randomLevels(len(vectors), 0))
+	a.graph.insertAll(0)
+}
+
+// update brings a stored graph up to date with chunks by removing the nodes
+// of chunks that are gone and inserting the new ones, reporting whether any
+// changed. It reports !ok, leaving a unchanged, when the stored graph is
+// incompatible or more than half the chunks changed, so rebuilding is
+// cheaper.
+func (a *ANN) update(stored *annFile, positions map[uint64]int32, keys []uint64) (changed, ok bool) {
+	if stored.M != hnswM || len(stored.Levels) != len(stored.Keys) || len(stored.Links) != len(stored.Keys) {
+		return false, false
+	}
+
+	removed := make([]bool, len(stored.Keys))
+	storedKeys := make(map[uint64]bool, len(stored.Keys))
+	removedCount := 0
+	for i, key := range stored.Keys {
+		if _, ok := positions[key]; !ok || storedKeys[key] {
+			removed[i] = true
+			removedCount++
+		}
+		storedKeys[key] = true
+	}
+	var added []uint64
+	for _, key := range keys {
+		if !storedKeys[key] {
+			added = append(added, key)
+		}
+	}
+	if 2*(removedCount+len(added)) > len(keys) {
+		return false, false
+	}
+
+	// Restore the graph with the vectors of the chunks still present
+	graph := &hnsw{
+		vectors:  make([][]float32, len(stored.Keys)),
+		norms:    make([]float32, len(stored.Keys)),
+		levels:   stored.Levels,
+		links:    stored.Links,
+		entry:    stored.Entry,
+		maxLevel: stored.MaxLevel,
+	}
+	for i, key := range stored.Keys {
+		if !removed[i] {
+			graph.vectors[i] = a.chunks[positions[key]].Embedding
+			graph.norms[i] = float32(norm(graph.vectors[i]))
+		}
+	}
+	graph.locks = make([]sync.Mutex, len(stored.Keys))
+
+	a.nodeChunks = make([]int32, 0, len(keys))
+	if removedCount > 0 {
+		renumbered := graph.remove(removed)
+		for i, key := range stored.Keys {
+			if renumbered[i] >= 0 {
+				a.nodeChunks = append(a.nodeChunks, positions[key])
+			}
+		}
+	} else {
+		for _, key := range stored.Keys {
+			a.nodeChunks = append(a.nodeChunks, positions[key])
+		}
+	}
+
+	// Link the new chunks
+	if len(added) > 0 {
+		first := len(graph.vectors)
+		vectors := make([][]float32, len(added))
+		for i, key := range added {
+			a.nodeChunks = append(a.nodeChunks, positions[key])
+			vectors[i] = a.chunks[positions[key]].Embedding
+		}
+		graph.grow(vectors, randomLevels(len(added), uint64(first)))
+		graph.insertAll(first)
+	}
+
+	a.graph = graph
+	return removedCount > 0 || len(added) > 0, true
+}
+
+// save writes the graph to path, replacing it atomically
+func (a *ANN) save(path string) error {
+	stored := annFile{
+		Version:  annFormatVersion,
+		M:        hnswM,
+		Keys:     make([]uint64, len(a.nodeChunks)),
+		Levels:   a.graph.levels,
+		Links:    a.graph.links,
+		Entry:    a.graph.entry,
+		MaxLevel: a.graph.maxLevel,
+	}
+	for i, position := range a.nodeChunks {
+		stored.Keys[i] = chunkKey(a.chunks[position])
+	}
+
+	tempPath := path + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(file).Encode(stored)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// loadANNFile reads a persisted graph
+func loadANNFile(path string) (*annFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var stored annFile
+	if err := gob.NewDecoder(file).Decode(&stored); err != nil {
+		return nil, err
+	}
+	if stored.Version != annFormatVersion {
+		return nil, errors.New("unsupported graph version")
+	}
+	return &stored, nil
+}
+
+// Len returns the number of chunks in the graph
+func (a *ANN) Len() int {
+	return len(a.nodeChunks)
+}
+
+// Stream is the approximate counterpart of the package's Stream: it sends
+// the k chunks nearest to the query embedding in the graph, highest score
+// first. Every chunk is scored exhaustively when k is zero or less or the
+// query doesn't match the index's dimensions.
+func (a *ANN) Stream(ctx context.Context, query []float32, k int) <-chan Result {
+	if k <= 0 || len(query) != a.dimensions {
+		return Stream(ctx, a.chunks, query, k)
+	}
+
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+
+		_, span := tracing.Start(ctx, "retrieve",
+			attribute.Int("codie.chunks", len(a.chunks)),
+			attribute.Int("codie.top_k", k),
+			attribute.Bool("codie.ann", true))
+		defer func() { tracing.End(span, ctx.Err()) }()
+
+		for _, found := range a.graph.search(query, k) {
+			result := Result{Chunk: a.chunks[a.nodeChunks[found.id]], Score: 1 - found.dist}
+			select {
+			case out <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// chunkKey identifies a chunk across runs by its location, content, and the
+// start of its embedding, so re-embedded chunks are linked anew
+func chunkKey(chunk storage.CodeChunk) uint64 {
+	hash := fnv.New64a()
+	var buf [8]byte
+	hash.Write([]byte(chunk.File))
+	binary.LittleEndian.PutUint64(buf[:], uint64(chunk.StartLine)<<32|uint64(uint32(chunk.EndLine)))
+	hash.Write(buf[:])
+	hash.Write([]byte(chunk.Content))
+	for _, x := range chunk.Embedding[:min(16, len(chunk.Embedding))] {
+		binary.LittleEndian.PutUint32(buf[:4], math.Float32bits(x))
+		hash.Write(buf[:4])
+	}
+	return hash.Sum64()
+}
+
+// randomLevels draws the level of n new nodes, with exponentially fewer nodes
+// on each higher level
+func randomLevels(n int, seed uint64) []int {
+	random := rand.New(rand.NewPCG(seed, uint64(n)))
+	levelMult := 1 / math.Log(hnswM)
+	levels := make([]int, n)
+	for i := range levels {
+		levels[i] = int(-math.Log(1-random.Float64()) * levelMult)
+	}
+	return levels
+}
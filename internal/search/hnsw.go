@@ -0,0 +1,406 @@
+package search
+
+import (
+	"cmp"
+	"container/heap"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// HNSW parameters
+const (
+	hnswM              = 16  // Links per node on upper levels; level 0 keeps twice as many
+	hnswEfConstruction = 100 // Candidates considered when linking a new node
+	hnswEfSearch       = 100 // Minimum candidates considered by a query
+)
+
+// hnsw is a Hierarchical Navigable Small World graph (Malkov and Yashunin,
+// 2016) for approximate nearest-neighbor search by cosine similarity. Nodes
+// are inserted concurrently, each guarded by its own lock. Vectors aren't
+// owned by the graph: they are the chunks' embeddings, set before use.
+type hnsw struct {
+	vectors [][]float32
+	norms   []float32
+	levels  []int
+	links   [][][]int32 // links[node][level] are the node's neighbors on that level
+	locks   []sync.Mutex
+
+	mu       sync.RWMutex // Guards entry and maxLevel
+	entry    int32
+	maxLevel int
+}
+
+// candidate is a node and its distance to a query
+type candidate struct {
+	id   int32
+	dist float32
+}
+
+// newHNSW returns a graph of unlinked nodes for vectors at the given levels
+func newHNSW(vectors [][]float32, levels []int) *hnsw {
+	g := &hnsw{entry: -1}
+	g.grow(vectors, levels)
+	return g
+}
+
+// grow appends nodes for vectors at the given levels, without linking them
+func (g *hnsw) grow(vectors [][]float32, levels []int) {
+	g.vectors = append(g.vectors, vectors...)
+	g.levels = append(g.levels, levels...)
+	for i, v := range vectors {
+		g.norms = append(g.norms, float32(norm(v)))
+		g.links = append(g.links, make([][]int32, levels[i]+1))
+	}
+	g.locks = make([]sync.Mutex, len(g.vectors))
+}
+
+// insertAll links the nodes from first on into the graph concurrently
+func (g *hnsw) insertAll(first int) {
+	// The first node of an empty graph becomes the entry point on its own
+	if g.entry < 0 && first < len(g.vectors) {
+		g.entry, g.maxLevel = int32(first), g.levels[first]
+		first++
+	}
+
+	next := make(chan int32, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range next {
+				g.insert(id)
+			}
+		}()
+	}
+	for id := first; id < len(g.vectors); id++ {
+		next <- int32(id)
+	}
+	close(next)
+	wg.Wait()
+}
+
+// insert links a node into the graph
+func (g *hnsw) insert(id int32) {
+	level := g.levels[id]
+	query, queryNorm := g.vectors[id], g.norms[id]
+
+	g.mu.RLock()
+	entry, maxLevel := g.entry, g.maxLevel
+	g.mu.RUnlock()
+
+	// Descend greedily through the levels above the node's own
+	entries := []candidate{{entry, g.distance(query, queryNorm, entry)}}
+	for l := maxLevel; l > level; l-- {
+		entries = g.searchLevel(query, queryNorm, entries, 1, l)
+	}
+
+	for l := min(level, maxLevel); l >= 0; l-- {
+		found := g.searchLevel(query, queryNorm, entries, hnswEfConstruction, l)
+		// A node linked to while being inserted can find itself
+		found = slices.DeleteFunc(found, func(c candidate) bool { return c.id == id })
+		if len(found) == 0 {
+			continue
+		}
+		neighbors := g.selectNeighbors(found, maxLinks(l))
+
+		// Keep links other nodes made to this one while it was being inserted
+		g.locks[id].Lock()
+		links := candidateIDs(neighbors)
+		for _, n := range g.links[id][l] {
+			if !slices.Contains(links, n) {
+				links = append(links, n)
+			}
+		}
+		g.links[id][l] = links
+		g.locks[id].Unlock()
+
+		for _, neighbor := range neighbors {
+			g.link(neighbor.id, id, l)
+		}
+		entries = found
+	}
+
+	if level > maxLevel {
+		g.mu.Lock()
+		if level > g.maxLevel {
+			g.entry, g.maxLevel = id, level
+		}
+		g.mu.Unlock()
+	}
+}
+
+// link adds a link from node to target on a level. When the node has too
+// many links, the farthest is dropped.
+func (g *hnsw) link(node, target int32, level int) {
+	g.locks[node].Lock()
+	defer g.locks[node].Unlock()
+
+	links := append(g.links[node][level], target)
+	if len(links) > maxLinks(level) {
+		farthest, farthestDist := 0, float32(-1)
+		for i, id := range links {
+			if dist := g.distanceBetween(node, id); dist > farthestDist {
+				farthest, farthestDist = i, dist
+			}
+		}
+		links = slices.Delete(links, farthest, farthest+1)
+	}
+	g.links[node][level] = links
+}
+
+// search returns the k nodes nearest to query, nearest first
+func (g *hnsw) search(query []float32, k int) []candidate {
+	g.mu.RLock()
+	entry, maxLevel := g.entry, g.maxLevel
+	g.mu.RUnlock()
+	if entry < 0 {
+		return nil
+	}
+
+	queryNorm := float32(norm(query))
+	entries := []candidate{{entry, g.distance(query, queryNorm, entry)}}
+	for l := maxLevel; l > 0; l-- {
+		entries = g.searchLevel(query, queryNorm, entries, 1, l)
+	}
+	found := g.searchLevel(query, queryNorm, entries, max(hnswEfSearch, k), 0)
+	if len(found) > k {
+		found = found[:k]
+	}
+	return found
+}
+
+// searchLevel runs a best-first search on one level from entries, returning
+// up to ef of the nearest nodes found, nearest first
+func (g *hnsw) searchLevel(query []float32, queryNorm float32, entries []candidate, ef, level int) []candidate {
+	visited := make([]uint64, (len(g.vectors)+63)/64)
+	var frontier nearestHeap // Candidates to expand, nearest on top
+	var nearest farthestHeap // Best nodes found, farthest on top
+	for _, entry := range entries {
+		visited[entry.id/64] |= 1 << (entry.id % 64)
+		heap.Push(&frontier, entry)
+		heap.Push(&nearest, entry)
+	}
+	for nearest.Len() > ef {
+		heap.Pop(&nearest)
+	}
+
+	for frontier.Len() > 0 {
+		current := heap.Pop(&frontier).(candidate)
+		if current.dist > nearest[0].dist && nearest.Len() >= ef {
+			break
+		}
+
+		g.locks[current.id].Lock()
+		var links []int32
+		if level < len(g.links[current.id]) {
+			links = append(links, g.links[current.id][level]...)
+		}
+		g.locks[current.id].Unlock()
+
+		for _, id := range links {
+			if visited[id/64]&(1<<(id%64)) != 0 {
+				continue
+			}
+			visited[id/64] |= 1 << (id % 64)
+
+			dist := g.distance(query, queryNorm, id)
+			if nearest.Len() < ef || dist < nearest[0].dist {
+				heap.Push(&frontier, candidate{id, dist})
+				heap.Push(&nearest, candidate{id, dist})
+				if nearest.Len() > ef {
+					heap.Pop(&nearest)
+				}
+			}
+		}
+	}
+
+	found := make([]candidate, nearest.Len())
+	for i := len(found) - 1; i >= 0; i-- {
+		found[i] = heap.Pop(&nearest).(candidate)
+	}
+	return found
+}
+
+// selectNeighbors picks up to m of candidates (sorted nearest first) as
+// links, preferring ones closer to the node than to any link already picked
+// so links spread in different directions. Pruned candidates fill any room
+// left.
+func (g *hnsw) selectNeighbors(candidates []candidate, m int) []candidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]candidate, 0, m)
+	var pruned []candidate
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if g.distanceBetween(c.id, s.id) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// remove drops the marked nodes, reconnecting each remaining node that
+// linked to one through the dropped node's own links, and renumbers the
+// remaining nodes in order. It returns the new number of each old node, or
+// -1 for removed ones.
+func (g *hnsw) remove(removed []bool) []int32 {
+	for id := range g.links {
+		if removed[id] {
+			continue
+		}
+		for level, links := range g.links[id] {
+			repaired := false
+			seen := map[int32]bool{int32(id): true}
+			var candidates []candidate
+			add := func(n int32) {
+				if !seen[n] && !removed[n] {
+					seen[n] = true
+					candidates = append(candidates, candidate{n, g.distanceBetween(int32(id), n)})
+				}
+			}
+			for _, n := range links {
+				if removed[n] {
+					repaired = true
+					for _, m := range g.links[n][level] {
+						add(m)
+					}
+				} else {
+					add(n)
+				}
+			}
+			if repaired {
+				sortCandidates(candidates)
+				g.links[id][level] = candidateIDs(g.selectNeighbors(candidates, maxLinks(level)))
+			}
+		}
+	}
+
+	// Renumber the remaining nodes
+	renumbered := make([]int32, len(g.vectors))
+	kept := 0
+	for id := range renumbered {
+		renumbered[id] = -1
+		if !removed[id] {
+			renumbered[id] = int32(kept)
+			g.vectors[kept], g.norms[kept], g.levels[kept], g.links[kept] = g.vectors[id], g.norms[id], g.levels[id], g.links[id]
+			kept++
+		}
+	}
+	g.vectors, g.norms, g.levels, g.links = g.vectors[:kept], g.norms[:kept], g.levels[:kept], g.links[:kept]
+	g.locks = make([]sync.Mutex, kept)
+	for _, levels := range g.links {
+		for level, links := range levels {
+			for i, n := range links {
+				levels[level][i] = renumbered[n]
+			}
+		}
+	}
+
+	// The highest remaining node becomes the entry point
+	g.entry, g.maxLevel = -1, 0
+	for id, level := range g.levels {
+		if g.entry < 0 || level > g.maxLevel {
+			g.entry, g.maxLevel = int32(id), level
+		}
+	}
+	return renumbered
+}
+
+// distance is the cosine distance from a query to a node
+func (g *hnsw) distance(query []float32, queryNorm float32, id int32) float32 {
+	return cosineDistance(query, queryNorm, g.vectors[id], g.norms[id])
+}
+
+// distanceBetween is the cosine distance between two nodes
+func (g *hnsw) distanceBetween(a, b int32) float32 {
+	return cosineDistance(g.vectors[a], g.norms[a], g.vectors[b], g.norms[b])
+}
+
+// cosineDistance is one minus the cosine similarity of a and b
+func cosineDistance(a []float32, normA float32, b []float32, normB float32) float32 {
+	if normA == 0 || normB == 0 {
+		return 1
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot/(normA*normB)
+}
+
+// maxLinks is the number of links a node keeps on a level
+func maxLinks(level int) int {
+	if level == 0 {
+		return 2 * hnswM
+	}
+	return hnswM
+}
+
+// candidateIDs returns the node IDs of candidates
+func candidateIDs(candidates []candidate) []int32 {
+	ids := make([]int32, len(candidates))
+	for i, c := range candidates {
+		ids[i] = c.id
+	}
+	return ids
+}
+
+// sortCandidates sorts candidates nearest first
+func sortCandidates(candidates []candidate) {
+	slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(a.dist, b.dist) })
+}
+
+// nearestHeap is a min-heap of candidates by distance
+type nearestHeap []candidate
+
+func (h nearestHeap) Len() int           { return len(h) }
+func (h nearestHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h nearestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *nearestHeap) Push(x any) { *h = append(*h, x.(candidate)) }
+
+func (h *nearestHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// farthestHeap is a max-heap of candidates by distance
+type farthestHeap []candidate
+
+func (h farthestHeap) Len() int           { return len(h) }
+func (h farthestHeap) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h farthestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *farthestHeap) Push(x any) { *h = append(*h, x.(candidate)) }
+
+func (h *farthestHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"cmp"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// BM25 parameters: term frequency saturation and document length normalization
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Rank constant of reciprocal rank fusion, damping the weight of the top ranks
+const rrfK = 60
+
+// KeywordIndex is an inverted index of the identifiers and words in chunks,
+// scored with BM25. It finds exact identifiers that embedding search can
+// rank below chunks that are merely about the same topic.
+type KeywordIndex struct {
+	chunks    []storage.CodeChunk
+	postings  map[string][]posting
+	lengths   []int
+	avgLength float64
+}
+
+// posting is a chunk containing a term and the number of times it does
+type posting struct {
+	chunk int32
+	count int32
+}
+
+// NewKeywordIndex indexes the contents, symbols, and file names of chunks
+func NewKeywordIndex(chunks []storage.CodeChunk) *KeywordIndex {
+	index := &KeywordIndex{
+		chunks:   chunks,
+		postings: make(map[string][]posting),
+		lengths:  make([]int, len(chunks)),
+	}
+
+	total := 0
+	for i, chunk := range chunks {
+		counts := make(map[string]int32)
+		for _, text := range []string{chunk.Content, chunk.Function, chunk.Class, filepath.Base(chunk.File)} {
+			for _, term := range Tokenize(text) {
+				counts[term]++
+				index.lengths[i]++
+			}
+		}
+		for term, count := range counts {
+			index.postings[term] = append(index.postings[term], posting{int32(i), count})
+		}
+		total += index.lengths[i]
+	}
+	if len(chunks) > 0 {
+		index.avgLength = float64(total) / float64(len(chunks))
+	}
+	return index
+}
+
+// Search returns the k chunks that best match the terms of query by BM25,
+// best first. Chunks matching no term are left out.
+func (x *KeywordIndex) Search(query string, k int) []Result {
+	scores := make(map[int32]float64)
+	n := float64(len(x.chunks))
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := x.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.count)
+			norm := 1 - bm25B + bm25B*float64(x.lengths[p.chunk])/x.avgLength
+			scores[p.chunk] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	// Ties keep the index's order
+	matched := make([]int32, 0, len(scores))
+	for i := range scores {
+		matched = append(matched, i)
+	}
+	slices.Sort(matched)
+	results := make([]Result, len(matched))
+	for j, i := range matched {
+		results[j] = Result{Chunk: x.chunks[i], Score: float32(scores[i])}
+	}
+	sortResults(results)
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Tokenize splits text into lowercase terms. Identifiers are kept whole and
+// also split into their camelCase and snake_case parts, so both
+// "parseIndexOptions" and "index options" match it.
+func Tokenize(text string) []string {
+	var terms []string
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for _, word := range words {
+		parts := splitIdentifier(word)
+		if len(parts) != 1 {
+			if whole := strings.ToLower(strings.Trim(word, "_")); len(whole) > 1 {
+				terms = append(terms, whole)
+			}
+		}
+		for _, part := range parts {
+			if len(part) > 1 {
+				terms = append(terms, strings.ToLower(part))
+			}
+		}
+	}
+	return terms
+}
+
+// splitIdentifier splits an identifier at underscores and case changes,
+// keeping acronyms together: "parseHTTPRequest_v2" gives parse, HTTP,
+// Request, and v2
+func splitIdentifier(word string) []string {
+	var parts []string
+	for _, segment := range strings.Split(word, "_") {
+		runes := []rune(segment)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			acronymEnd := i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
+
+// Fuse merges vector and keyword results into the k best chunks. With a
+// keyword weight of zero, results are ranked by reciprocal rank fusion,
+// which needs no score calibration; otherwise scores are combined as
+// (1-weight)*similarity + weight*BM25, with BM25 scaled to the best keyword
+// match.
+func Fuse(vector, keyword []Result, k int, keywordWeight float64) []Result {
+	type fused struct {
+		chunk storage.CodeChunk
+		score float64
+	}
+	byKey := make(map[uint64]*fused)
+	var order []uint64
+	add := func(chunk storage.CodeChunk, score float64) {
+		key := chunkKey(chunk)
+		if f, ok := byKey[key]; ok {
+			f.score += score
+			return
+		}
+		byKey[key] = &fused{chunk, score}
+		order = append(order, key)
+	}
+
+	maxKeyword := 0.0
+	if len(keyword) > 0 {
+		maxKeyword = float64(keyword[0].Score)
+	}
+	for rank, result := range vector {
+		if keywordWeight == 0 {
+			add(result.Chunk, 1/float64(rrfK+rank+1))
+		} else {
+			add(result.Chunk, (1-keywordWeight)*float64(result.Score))
+		}
+	}
+	for rank, result := range keyword {
+		if keywordWeight == 0 {
+			add(result.Chunk, 1/float64(rrfK+rank+1))
+		} else if maxKeyword > 0 {
+			add(result.Chunk, keywordWeight*float64(result.Score)/maxKeyword)
+		}
+	}
+
+	results := make([]Result, 0, len(order))
+	for _, key := range order {
+		results = append(results, Result{Chunk: byKey[key].chunk, Score: float32(byKey[key].score)})
+	}
+	sortResults(results)
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// sortResults orders results by score, highest first, keeping the order of ties
+func sortResults(results []Result) {
+	slices.SortStableFunc(results, func(a, b Result) int { return cmp.Compare(b.Score, a.Score) })
+}
@@ -0,0 +1,195 @@
+package search
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/exolottl/codie/internal/storage"
+	"github.com/exolottl/codie/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Result is a chunk matched by a search along with its similarity score
+type Result struct {
+	Chunk storage.CodeChunk `json:"chunk"`
+	Score float32           `json:"score"`
+}
+
+// Search returns the k chunks most similar to the query embedding, best first.
+// A k of zero or less returns every chunk.
+func Search(chunks []storage.CodeChunk, query []float32, k int) []Result {
+	return SearchContext(context.Background(), chunks, query, k)
+}
+
+// SearchContext is Search with a context that cancels scoring and carries
+// the parent of the retrieval span
+func SearchContext(ctx context.Context, chunks []storage.CodeChunk, query []float32, k int) []Result {
+	var results []Result
+	for result := range Stream(ctx, chunks, query, k) {
+		results = append(results, result)
+	}
+	return results
+}
+
+// Stream scores chunks against the query embedding and sends the k best
+// results on the returned channel, highest score first. Chunks are scored in
+// shards, one per CPU, and each shard keeps only its own k best, which are
+// merged into the overall k best as the shard completes, so a search holds k
+// results per shard rather than a score for every chunk. Ranking needs every
+// score, so the first hit is sent once the last shard completes; consumers
+// can then write each hit out as it arrives instead of buffering a whole
+// response. The channel is closed when all results are sent or ctx is
+// cancelled.
+func Stream(ctx context.Context, chunks []storage.CodeChunk, query []float32, k int) <-chan Result {
+	out := make(chan Result)
+
+	go func() {
+		defer close(out)
+
+		_, span := tracing.Start(ctx, "retrieve",
+			attribute.Int("codie.chunks", len(chunks)),
+			attribute.Int("codie.top_k", k))
+		defer func() { tracing.End(span, ctx.Err()) }()
+
+		if k <= 0 || k > len(chunks) {
+			k = len(chunks)
+		}
+		best := scoreChunks(ctx, chunks, query, k)
+		if ctx.Err() != nil {
+			return
+		}
+
+		for _, result := range best.sorted() {
+			select {
+			case out <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// scoreChunks computes the similarity of every chunk to the query
+// concurrently, in shards, and returns the k best
+func scoreChunks(ctx context.Context, chunks []storage.CodeChunk, query []float32, k int) *topResults {
+	best := &topResults{k: k}
+	queryNorm := norm(query)
+
+	numWorkers := runtime.NumCPU()
+	shardSize := (len(chunks) + numWorkers - 1) / numWorkers
+	if shardSize == 0 {
+		return best
+	}
+
+	shards := make(chan *topResults)
+	var wg sync.WaitGroup
+	for start := 0; start < len(chunks); start += shardSize {
+		end := min(start+shardSize, len(chunks))
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			shard := &topResults{k: k}
+			for i := start; i < end; i++ {
+				if i%1024 == 0 && ctx.Err() != nil {
+					return
+				}
+				shard.offer(Result{
+					Chunk: chunks[i],
+					Score: cosine(query, queryNorm, chunks[i].Embedding),
+				})
+			}
+			shards <- shard
+		}(start, end)
+	}
+	go func() {
+		wg.Wait()
+		close(shards)
+	}()
+
+	// Merge each shard's best as it completes
+	for shard := range shards {
+		for _, result := range shard.heap {
+			best.offer(result)
+		}
+	}
+	return best
+}
+
+// CosineSimilarity returns the cosine similarity between two vectors
+func CosineSimilarity(a, b []float32) float32 {
+	return cosine(a, norm(a), b)
+}
+
+// cosine computes cosine similarity given the precomputed norm of a
+func cosine(a []float32, normA float64, b []float32) float32 {
+	if len(a) != len(b) || normA == 0 {
+		return 0
+	}
+
+	var dot, sumB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		sumB += float64(b[i]) * float64(b[i])
+	}
+	if sumB == 0 {
+		return 0
+	}
+	return float32(dot / (normA * math.Sqrt(sumB)))
+}
+
+// norm returns the Euclidean norm of a vector
+func norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// topResults keeps the k best results offered to it
+type topResults struct {
+	k    int
+	heap resultHeap // Worst of the kept results on top
+}
+
+// offer keeps result if it is among the k best seen so far
+func (t *topResults) offer(result Result) {
+	if t.heap.Len() < t.k {
+		heap.Push(&t.heap, result)
+	} else if t.k > 0 && result.Score > t.heap[0].Score {
+		t.heap[0] = result
+		heap.Fix(&t.heap, 0)
+	}
+}
+
+// sorted returns the kept results, best first
+func (t *topResults) sorted() []Result {
+	results := make([]Result, t.heap.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(&t.heap).(Result)
+	}
+	return results
+}
+
+// resultHeap is a min-heap of results ordered by score
+type resultHeap []Result
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *resultHeap) Push(x any) { *h = append(*h, x.(Result)) }
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
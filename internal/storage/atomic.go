@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Suffix of the copy of the previous index kept when it is replaced
+const backupSuffix = ".bak"
+
+// BackupPath returns the path of the copy of the previous version of an
+// index, kept when the index is replaced
+func BackupPath(indexPath string) string {
+	return indexPath + backupSuffix
+}
+
+// replaceIndex writes a new index to path through write, without a crash at
+// any point leaving path missing or partly written. The index is written to
+// a temporary file beside path and synced to disk, then parsed back and
+// checked to hold the chunks write reports writing. Only then does the
+// current index become the backup and the new one take its place, with a
+// rename that is synced too. It returns the size of the new index and its
+// chunks.
+func replaceIndex(path string, write func(io.Writer) (int, error)) (int64, int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, 0, err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, 0, err
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath) // Fails harmlessly once renamed
+
+	counter := &countingWriter{w: temp}
+	chunks, err := write(counter)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, 0o644)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := verifyIndex(tempPath, chunks); err != nil {
+		return 0, 0, fmt.Errorf("new index failed to verify, keeping the current one: %w", err)
+	}
+	if err := backUpIndex(path); err != nil {
+		return 0, 0, fmt.Errorf("failed to back up the current index: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return 0, 0, err
+	}
+	syncDir(filepath.Dir(path))
+	return counter.n, chunks, nil
+}
+
+// verifyIndex parses the index at path, checking that it holds chunks chunks
+func verifyIndex(path string, chunks int) error {
+	count := 0
+	if err := (&JSONStore{Path: path}).Scan(func(CodeChunk) error { count++; return nil }); err != nil {
+		return err
+	}
+	if count != chunks {
+		return fmt.Errorf("it holds %d chunks instead of %d", count, chunks)
+	}
+	return nil
+}
+
+// backUpIndex makes the index at path its backup, replacing the one before,
+// while leaving it in place. Nothing is backed up before the first index.
+func backUpIndex(path string) error {
+	backup := BackupPath(path)
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err := os.Link(path, backup)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		// Filesystems without hard links get a copy
+		return copyFile(path, backup)
+	}
+	return nil
+}
+
+// copyFile copies the file at src to dst and syncs it
+func copyFile(src, dst string) error {
+	input, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, input)
+	if err == nil {
+		err = output.Sync()
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncDir syncs a directory so the renames in it survive a crash. Systems
+// that can't sync directories, such as Windows, flush them in their own time.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/metrics"
+)
+
+// ChunkWriter receives an index's chunks file by file as they are produced.
+// Chunks are persisted as they arrive, so a crash loses at most the last
+// flush interval, and become the index only when Commit is called.
+type ChunkWriter interface {
+	// WriteFile records that a file was indexed into chunks. It is safe for
+	// concurrent use.
+	WriteFile(file string, chunks []CodeChunk) error
+	// Flush persists every chunk written so far
+	Flush() error
+	// Commit replaces the index with the written chunks
+	Commit() error
+	// Close stops writing without committing, keeping the written chunks
+	// for a later run. It does nothing after Commit.
+	Close() error
+}
+
+// How often written chunks are flushed to disk
+const checkpointFlushInterval = 2 * time.Second
+
+// Suffix of the checkpoint file kept next to a JSON index while it is written
+const checkpointSuffix = ".partial"
+
+// checkpointRecord is one line of a checkpoint file: a file and its chunks,
+// or, on the first line, the header the index is being built as
+type checkpointRecord struct {
+	File   string      `json:"file,omitempty"`
+	Chunks []CodeChunk `json:"chunks,omitempty"`
+	Header *Header     `json:"header,omitempty"`
+}
+
+// jsonWriter streams chunks to a JSON-lines checkpoint file and assembles
+// the JSON index from it on commit. The checkpoint keeps full precision
+// embeddings; they are quantized when the index is assembled.
+type jsonWriter struct {
+	mu        sync.Mutex
+	indexPath string
+	precision string
+	file      *os.File
+	buffer    *bufio.Writer
+	lastFlush time.Time
+	stats     headerStats // Of the chunks written, for the index's header
+	unlock    func()      // Releases the index's lock, held until done
+	done      bool
+}
+
+// NewWriter starts writing a new index to a checkpoint file next to the
+// index, discarding any checkpoint left by an earlier run. The index stays
+// locked until the writer commits or closes.
+func (s *JSONStore) NewWriter() (ChunkWriter, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return nil, err
+	}
+	writer, err := s.newWriter(unlock)
+	if err != nil {
+		unlock()
+	}
+	return writer, err
+}
+
+// newWriter starts a new checkpoint for NewWriter, which holds the lock
+func (s *JSONStore) newWriter(unlock func()) (ChunkWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(s.Path + checkpointSuffix)
+	if err != nil {
+		return nil, err
+	}
+	writer := &jsonWriter{
+		indexPath: s.Path,
+		precision: s.Precision,
+		file:      file,
+		buffer:    bufio.NewWriterSize(file, 1<<20),
+		lastFlush: time.Now(),
+		unlock:    unlock,
+	}
+
+	// The checkpoint records what it is built as, so a resumed run can't add
+	// incompatible chunks to it
+	header := Current
+	line, err := json.Marshal(checkpointRecord{Header: &header})
+	if err == nil {
+		_, err = writer.buffer.Write(append(line, '\n'))
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// ResumeWriter continues writing the index from the checkpoint left by an
+// interrupted writer, returning the number of chunks already written for
+// each file in it. Without a checkpoint it starts a new index like NewWriter.
+func (s *JSONStore) ResumeWriter() (ChunkWriter, map[string]int, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return nil, nil, err
+	}
+	writer, completed, err := s.resumeWriter(unlock)
+	if err != nil {
+		unlock()
+	}
+	return writer, completed, err
+}
+
+// resumeWriter reopens the checkpoint for ResumeWriter, which holds the lock
+func (s *JSONStore) resumeWriter(unlock func()) (ChunkWriter, map[string]int, error) {
+	checkpointPath := s.Path + checkpointSuffix
+	file, err := os.OpenFile(checkpointPath, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		writer, err := s.newWriter(unlock)
+		return writer, map[string]int{}, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	completed := make(map[string]int)
+	var stats headerStats
+	size, err := scanCheckpoint(file, func(record checkpointRecord) error {
+		if record.Header != nil {
+			if err := record.Header.Compatible(checkpointPath, Current); err != nil {
+				err.(*IncompatibleError).Fix = "run without --resume to start over"
+				return err
+			}
+			return nil
+		}
+		completed[record.File] = len(record.Chunks)
+		for _, chunk := range record.Chunks {
+			stats.add(chunk)
+		}
+		return nil
+	})
+	if err == nil {
+		// Drop a truncated last record so new records start on their own line
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to resume from %s: %w", checkpointPath, err)
+	}
+
+	return &jsonWriter{
+		indexPath: s.Path,
+		precision: s.Precision,
+		file:      file,
+		buffer:    bufio.NewWriterSize(file, 1<<20),
+		lastFlush: time.Now(),
+		stats:     stats,
+		unlock:    unlock,
+	}, completed, nil
+}
+
+func (w *jsonWriter) WriteFile(file string, chunks []CodeChunk) error {
+	line, err := json.Marshal(checkpointRecord{File: file, Chunks: chunks})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return errors.New("index writer is closed")
+	}
+	if _, err := w.buffer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		w.stats.add(chunk)
+	}
+	if time.Since(w.lastFlush) >= checkpointFlushInterval {
+		return w.flushLocked()
+	}
+	return nil
+}
+
+func (w *jsonWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return nil
+	}
+	return w.flushLocked()
+}
+
+// flushLocked writes buffered records through to disk; w.mu must be held
+func (w *jsonWriter) flushLocked() error {
+	w.lastFlush = time.Now()
+	if err := w.buffer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *jsonWriter) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return errors.New("index writer is closed")
+	}
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	w.done = true
+	defer w.unlock()
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	header := w.stats.header(previousHeader(w.indexPath))
+	if err := assembleJSONIndex(w.indexPath+checkpointSuffix, w.indexPath, w.precision, header); err != nil {
+		return err
+	}
+	return os.Remove(w.indexPath + checkpointSuffix)
+}
+
+func (w *jsonWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer w.unlock()
+	if err := w.flushLocked(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// assembleJSONIndex streams the chunks of a checkpoint file into a JSON
+// index under header, replacing indexPath only once it is complete
+func assembleJSONIndex(checkpointPath, indexPath, precision string, header Header) error {
+	input, err := os.Open(checkpointPath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	size, written, err := replaceIndex(indexPath, func(w io.Writer) (int, error) {
+		return writeJSONIndex(w, input, precision, header)
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.StoreBytes.Set(float64(size))
+	metrics.StoreChunks.Set(float64(written))
+	return nil
+}
+
+// writeJSONIndex writes header and the chunks of every checkpoint record
+// read from r as one indented JSON index with embeddings at precision,
+// laid out as json.MarshalIndent would, returning the number of chunks
+func writeJSONIndex(w io.Writer, r io.Reader, precision string, header Header) (int, error) {
+	buffered := bufio.NewWriterSize(w, 1<<20)
+	count := 0
+
+	data, err := json.MarshalIndent(header, "  ", "  ")
+	if err != nil {
+		return 0, err
+	}
+	buffered.WriteString("{\n  \"header\": ")
+	buffered.Write(data)
+	buffered.WriteString(",\n  \"chunks\": ")
+
+	err = readCheckpoint(r, func(record checkpointRecord) error {
+		for _, chunk := range record.Chunks {
+			encoded, err := encodeChunk(chunk, precision)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(encoded, "    ", "  ")
+			if err != nil {
+				return err
+			}
+			separator := ",\n    "
+			if count == 0 {
+				separator = "[\n    "
+			}
+			buffered.WriteString(separator)
+			buffered.Write(data)
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		buffered.WriteString("[]\n}")
+	} else {
+		buffered.WriteString("\n  ]\n}")
+	}
+	return count, buffered.Flush()
+}
+
+// readCheckpoint calls fn for each record of a checkpoint file. A truncated
+// last line, left by a crash mid-write, is ignored.
+func readCheckpoint(r io.Reader, fn func(record checkpointRecord) error) error {
+	_, err := scanCheckpoint(r, fn)
+	return err
+}
+
+// scanCheckpoint is readCheckpoint, also returning the size of the complete
+// records read
+func scanCheckpoint(r io.Reader, fn func(record checkpointRecord) error) (int64, error) {
+	reader := bufio.NewReaderSize(r, 1<<20)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+
+		var record checkpointRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return size, fmt.Errorf("corrupt checkpoint record: %w", err)
+		}
+		if err := fn(record); err != nil {
+			return size, err
+		}
+		size += int64(len(line))
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
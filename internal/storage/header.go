@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the index format this build writes. Version 1 indexes
+// are bare JSON arrays of chunks; version 2 wraps the chunks in an object
+// led by a Header. Indexes of newer versions are refused.
+const SchemaVersion = 2
+
+// Header describes how an index was built, so data from incompatible builds
+// isn't mixed into it
+type Header struct {
+	SchemaVersion  int       `json:"schema_version"`
+	ToolVersion    string    `json:"tool_version,omitempty"`    // Version of codie that last wrote the index
+	EmbeddingModel string    `json:"embedding_model,omitempty"` // Model the chunks were embedded with
+	Dimensions     int       `json:"dimensions,omitempty"`      // Length of the stored embeddings
+	ChunkerVersion int       `json:"chunker_version,omitempty"` // Version of the chunker that split the files
+	Fingerprint    string    `json:"fingerprint,omitempty"`     // Hash of the settings that shaped the chunks
+	Root           string    `json:"root,omitempty"`            // Deepest directory holding every indexed file
+	Commit         string    `json:"commit,omitempty"`          // Commit the chunks were indexed at, when they share one
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Current describes the indexes this run builds. It is written, along with
+// what the chunks themselves tell, as the header of every index saved, and
+// indexes loaded with LoadFromJSON must be compatible with it. Empty fields
+// aren't checked.
+var Current = Header{SchemaVersion: SchemaVersion}
+
+// IncompatibleError is returned for an index whose header doesn't match the
+// current build
+type IncompatibleError struct {
+	Path   string
+	Reason string // What doesn't match
+	Fix    string // How to make it usable
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("index %s %s; %s", e.Path, e.Reason, e.Fix)
+}
+
+// Compatible returns an *IncompatibleError if chunks built as want can't be
+// mixed with those of an index with header h, stored at path
+func (h Header) Compatible(path string, want Header) error {
+	rebuild := "rebuild it with 'codie index <directory>'"
+	switch {
+	case h.SchemaVersion > SchemaVersion:
+		return &IncompatibleError{Path: path,
+			Reason: fmt.Sprintf("has schema version %d, newer than the %d this version of codie reads", h.SchemaVersion, SchemaVersion),
+			Fix:    "upgrade codie, or " + rebuild}
+	case h.EmbeddingModel != "" && want.EmbeddingModel != "" && h.EmbeddingModel != want.EmbeddingModel:
+		return &IncompatibleError{Path: path,
+			Reason: fmt.Sprintf("was embedded with %s but %s is configured", h.EmbeddingModel, want.EmbeddingModel),
+			Fix:    fmt.Sprintf("set --provider, or the embedding_provider setting, to the provider that serves %s to use it, or %s", h.EmbeddingModel, rebuild)}
+	case h.Dimensions != 0 && want.Dimensions != 0 && h.Dimensions != want.Dimensions:
+		return &IncompatibleError{Path: path,
+			Reason: fmt.Sprintf("holds %d-dimensional embeddings but %d are expected", h.Dimensions, want.Dimensions),
+			Fix:    rebuild}
+	case h.ChunkerVersion != 0 && want.ChunkerVersion != 0 && h.ChunkerVersion != want.ChunkerVersion:
+		return &IncompatibleError{Path: path,
+			Reason: fmt.Sprintf("was chunked by chunker version %d but this version of codie chunks with %d", h.ChunkerVersion, want.ChunkerVersion),
+			Fix:    rebuild}
+	}
+	return nil
+}
+
+// AnyModel returns the header without the embedding model and dimensions,
+// so Compatible accepts indexes embedded with any model
+func (h Header) AnyModel() Header {
+	h.EmbeddingModel = ""
+	h.Dimensions = 0
+	return h
+}
+
+// indexFile is the layout of an index of the current schema version
+type indexFile struct {
+	Header Header `json:"header"`
+	Chunks []any  `json:"chunks"`
+}
+
+// LoadHeader reads the header of an index without reading its chunks. A
+// version 1 index, which has no header, gets one with only SchemaVersion.
+func LoadHeader(filename string) (Header, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Header{}, err
+	}
+	defer file.Close()
+	return readHeader(json.NewDecoder(file))
+}
+
+// readHeader reads the header at the start of an index. The decoder is left
+// before the value of "chunks" of a current index, or after the opening
+// bracket of a version 1 index.
+func readHeader(decoder *json.Decoder) (Header, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return Header{}, err
+	}
+	switch token {
+	case json.Delim('['):
+		return Header{SchemaVersion: 1}, nil
+	case json.Delim('{'):
+	default:
+		return Header{}, errors.New("index is neither a JSON array nor an object")
+	}
+
+	var header Header
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return Header{}, err
+		}
+		if key == "chunks" {
+			break
+		}
+		if key == "header" {
+			err = decoder.Decode(&header)
+		} else {
+			err = decoder.Decode(new(json.RawMessage))
+		}
+		if err != nil {
+			return Header{}, err
+		}
+	}
+	if header.SchemaVersion == 0 {
+		return Header{}, errors.New("index header has no schema version")
+	}
+	return header, nil
+}
+
+// decodeIndex parses an index of any schema version
+func decodeIndex(data []byte) (Header, []CodeChunk, error) {
+	var chunks []CodeChunk
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(data, &chunks)
+		return Header{SchemaVersion: 1}, chunks, err
+	}
+
+	var index struct {
+		Header Header      `json:"header"`
+		Chunks []CodeChunk `json:"chunks"`
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return Header{}, nil, err
+	}
+	if index.Header.SchemaVersion == 0 {
+		return Header{}, nil, errors.New("index header has no schema version")
+	}
+	return index.Header, index.Chunks, nil
+}
+
+// headerStats gathers the fields of a header that describe its chunks, as
+// they are written
+type headerStats struct {
+	root       string
+	dimensions int
+	commit     string
+	commits    int // Distinct commits seen, up to 2
+}
+
+func (s *headerStats) add(chunk CodeChunk) {
+	if chunk.Kind != SummaryKind {
+		s.root = widenRoot(s.root, filepath.Dir(chunk.File))
+	}
+	if s.dimensions == 0 {
+		s.dimensions = len(chunk.Embedding)
+	}
+	if chunk.Commit != "" && chunk.Commit != s.commit && s.commits < 2 {
+		s.commit = chunk.Commit
+		s.commits++
+	}
+}
+
+// header returns Current completed with what the chunks tell. The creation
+// time of previous, the header of the index being replaced, is kept when it
+// covers the same root, and that of Current otherwise when it has one.
+func (s *headerStats) header(previous Header) Header {
+	header := Current
+	header.SchemaVersion = SchemaVersion
+	header.Root = s.root
+	if header.Root == "" {
+		header.Root = "."
+	}
+	header.Dimensions = s.dimensions
+	if s.commits == 1 {
+		header.Commit = s.commit
+	}
+	header.UpdatedAt = time.Now().UTC()
+	if !previous.CreatedAt.IsZero() && previous.Root == header.Root {
+		header.CreatedAt = previous.CreatedAt
+	} else if header.CreatedAt.IsZero() {
+		header.CreatedAt = header.UpdatedAt
+	}
+	return header
+}
+
+// previousHeader returns the header of the index at path, or an empty one if
+// there is none
+func previousHeader(path string) Header {
+	header, _ := LoadHeader(path)
+	return header
+}
+
+// widenRoot returns the deepest directory holding both root and dir, or dir
+// when root is empty
+func widenRoot(root, dir string) string {
+	if root == "" {
+		return dir
+	}
+	for root != "." && root != string(filepath.Separator) &&
+		dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		root = filepath.Dir(root)
+	}
+	return root
+}
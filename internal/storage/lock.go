@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix of the file locked by the process writing an index
+const lockSuffix = ".lock"
+
+// LockPath returns the path of the file locked while an index is written
+func LockPath(indexPath string) string {
+	return indexPath + lockSuffix
+}
+
+// lockOwner is written to a lock file by the process holding it, so others
+// can tell who it is
+type lockOwner struct {
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LockedError is returned when another process is writing the index
+type LockedError struct {
+	Path    string
+	PID     int    // Process holding the lock, or 0 if it couldn't be read
+	Command string // Its command line, if known
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("index %s is locked by another codie process; wait for it to finish or stop it", e.Path)
+	}
+	return fmt.Sprintf("index %s is locked by PID %d (%s); wait for it to finish or stop it", e.Path, e.PID, e.Command)
+}
+
+// errLockHeld is returned by lockFile when another process holds the lock
+var errLockHeld = errors.New("lock is held")
+
+// heldLock is a lock file this process holds, shared by every caller that
+// locked the same index
+type heldLock struct {
+	file    *os.File
+	holders int
+}
+
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*heldLock) // By absolute index path
+)
+
+// Lock makes this process the only writer of the index at indexPath until
+// the returned function is called, failing with a *LockedError if another
+// process is writing it. The lock is advisory and released by the system if
+// the process dies. Within a process, locking an index already locked only
+// counts another holder, so a caller can hold the lock across writes that
+// take it themselves.
+func Lock(indexPath string) (func(), error) {
+	key := absPath(indexPath)
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	held, ok := locks[key]
+	if !ok {
+		file, err := acquireLock(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		held = &heldLock{file: file}
+		locks[key] = held
+	}
+	held.holders++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			locksMu.Lock()
+			defer locksMu.Unlock()
+			if held.holders--; held.holders == 0 {
+				// Closing the file releases the lock. The file is left in
+				// place, as removing it could let two processes lock
+				// different files of the same name.
+				held.file.Close()
+				delete(locks, key)
+			}
+		})
+	}, nil
+}
+
+// acquireLock locks the lock file of an index and records this process as
+// its owner
+func acquireLock(indexPath string) (*os.File, error) {
+	path := LockPath(indexPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLockHeld) {
+			return nil, lockedError(indexPath, path)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	owner, _ := json.Marshal(lockOwner{PID: os.Getpid(), Command: strings.Join(os.Args, " "), StartedAt: time.Now().UTC()})
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt(append(owner, '\n'), 0)
+	}
+	return file, nil
+}
+
+// lockedError describes the process holding the lock file at path
+func lockedError(indexPath, path string) *LockedError {
+	locked := &LockedError{Path: indexPath}
+	// The owner may be partly written if it locked the file a moment ago
+	var owner lockOwner
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &owner) == nil {
+		locked.PID, locked.Command = owner.PID, owner.Command
+	}
+	return locked
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFile does nothing, as file locks aren't available on this platform
+// without cgo or extra dependencies; processes writing the same index
+// there must be kept apart by hand
+func lockFile(file *os.File) error {
+	return nil
+}
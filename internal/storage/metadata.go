@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Suffix of the metadata file kept next to an index
+const metadataSuffix = ".meta.json"
+
+// Metadata records where an index's chunks came from
+type Metadata struct {
+	Source    string    `json:"source"`           // Repository URL or directory that was indexed
+	Ref       string    `json:"ref,omitempty"`    // Branch, tag, or commit requested from a repository URL
+	Commit    string    `json:"commit,omitempty"` // Commit checked out when the index was built
+	Directory string    `json:"directory"`        // Directory the chunks were read from, such as a clone of Source
+	IndexedAt time.Time `json:"indexed_at"`
+}
+
+// MetadataPath returns the path of the metadata file of an index
+func MetadataPath(indexPath string) string {
+	return indexPath + metadataSuffix
+}
+
+// LoadMetadata reads the metadata of an index. Indexes built before metadata
+// was recorded have none, which is reported as an error satisfying
+// os.IsNotExist.
+func LoadMetadata(indexPath string) (Metadata, error) {
+	var metadata Metadata
+	data, err := os.ReadFile(MetadataPath(indexPath))
+	if err != nil {
+		return metadata, err
+	}
+	err = json.Unmarshal(data, &metadata)
+	return metadata, err
+}
+
+// SaveMetadata writes the metadata of an index
+func SaveMetadata(indexPath string, metadata Metadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(MetadataPath(indexPath), append(data, '\n'), 0o644)
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Precisions embeddings can be stored at. Float32 keeps the vectors as
+// returned by the API; float16 halves their size and int8 quarters it, at a
+// small loss of accuracy in similarity scores.
+const (
+	PrecisionFloat32 = "float32"
+	PrecisionFloat16 = "float16"
+	PrecisionInt8    = "int8"
+)
+
+// VectorPrecisions lists the supported storage precisions
+var VectorPrecisions = []string{PrecisionFloat32, PrecisionFloat16, PrecisionInt8}
+
+// QuantizedVector is an embedding stored at reduced precision. Data holds
+// little-endian float16 values, or int8 values that are multiplied by Scale.
+type QuantizedVector struct {
+	Precision string  `json:"precision"`
+	Scale     float32 `json:"scale,omitempty"`
+	Data      []byte  `json:"data"` // Base64 in JSON
+}
+
+// Quantize encodes an embedding at precision, which must be float16 or int8
+func Quantize(embedding []float32, precision string) (*QuantizedVector, error) {
+	switch precision {
+	case PrecisionFloat16:
+		data := make([]byte, 2*len(embedding))
+		for i, x := range embedding {
+			binary.LittleEndian.PutUint16(data[2*i:], float32ToFloat16(x))
+		}
+		return &QuantizedVector{Precision: precision, Data: data}, nil
+
+	case PrecisionInt8:
+		// Scale so the largest magnitude maps to 127
+		var maxAbs float32
+		for _, x := range embedding {
+			maxAbs = max(maxAbs, float32(math.Abs(float64(x))))
+		}
+		scale := maxAbs / 127
+		data := make([]byte, len(embedding))
+		if scale > 0 {
+			for i, x := range embedding {
+				data[i] = byte(int8(math.Round(float64(x / scale))))
+			}
+		}
+		return &QuantizedVector{Precision: precision, Scale: scale, Data: data}, nil
+	}
+	return nil, fmt.Errorf("unsupported vector precision %q", precision)
+}
+
+// Dequantize decodes the vector back to float32 values
+func (v *QuantizedVector) Dequantize() ([]float32, error) {
+	switch v.Precision {
+	case PrecisionFloat16:
+		if len(v.Data)%2 != 0 {
+			return nil, fmt.Errorf("float16 vector has odd length %d", len(v.Data))
+		}
+		embedding := make([]float32, len(v.Data)/2)
+		for i := range embedding {
+			embedding[i] = float16ToFloat32(binary.LittleEndian.Uint16(v.Data[2*i:]))
+		}
+		return embedding, nil
+
+	case PrecisionInt8:
+		embedding := make([]float32, len(v.Data))
+		for i, b := range v.Data {
+			embedding[i] = float32(int8(b)) * v.Scale
+		}
+		return embedding, nil
+	}
+	return nil, fmt.Errorf("unsupported vector precision %q", v.Precision)
+}
+
+// storedChunk is a chunk as written to an index with its embedding quantized.
+// Its Embedding shadows the chunk's so only the quantized vector is written.
+type storedChunk struct {
+	CodeChunk
+	Embedding []float32        `json:"embedding,omitempty"`
+	Vector    *QuantizedVector `json:"vector,omitempty"`
+}
+
+// encodeChunk returns the value to marshal for chunk at precision
+func encodeChunk(chunk CodeChunk, precision string) (any, error) {
+	if precision == "" || precision == PrecisionFloat32 || len(chunk.Embedding) == 0 {
+		return chunk, nil
+	}
+	vector, err := Quantize(chunk.Embedding, precision)
+	if err != nil {
+		return nil, err
+	}
+	return storedChunk{CodeChunk: chunk, Vector: vector}, nil
+}
+
+// UnmarshalJSON reads a chunk with either a float32 or a quantized embedding
+func (c *CodeChunk) UnmarshalJSON(data []byte) error {
+	type plainChunk CodeChunk // Without this method, to avoid recursion
+	var stored struct {
+		plainChunk
+		Vector *QuantizedVector `json:"vector"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	*c = CodeChunk(stored.plainChunk)
+	if stored.Vector != nil {
+		embedding, err := stored.Vector.Dequantize()
+		if err != nil {
+			return err
+		}
+		c.Embedding = embedding
+	}
+	return nil
+}
+
+// float32ToFloat16 converts to IEEE 754 half precision, rounding to nearest
+// even. Values too large become infinity and values too small become zero.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int((bits>>23)&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+
+	switch {
+	case (bits>>23)&0xff == 0xff: // Infinity or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f: // Overflow
+		return sign | 0x7c00
+	case exp <= 0: // Subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := mant >> shift
+		rem := mant & (1<<shift - 1)
+		if rem > 1<<(shift-1) || (rem == 1<<(shift-1) && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	half := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++ // May carry into the exponent, which is still correct
+	}
+	return sign | uint16(half)
+}
+
+// float16ToFloat32 converts from IEEE 754 half precision
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Subnormal: value is mant * 2^-24
+		f := float32(mant) * (1.0 / (1 << 24))
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
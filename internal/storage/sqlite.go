@@ -0,0 +1,460 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/exolottl/codie/internal/metrics"
+
+	_ "modernc.org/sqlite" // Registers the "sqlite" driver
+)
+
+// Tables of a SQLite index. Chunks are kept as JSON, as in a JSON index, in
+// rows that record their file, so a resumed run can replace a file's chunks.
+// A new index is written to the pending table and moved into place in one
+// transaction on commit, so readers never see it partly written and an
+// interrupted run can resume from it.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS chunks (id INTEGER PRIMARY KEY AUTOINCREMENT, file TEXT NOT NULL, data TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS pending_chunks (id INTEGER PRIMARY KEY AUTOINCREMENT, file TEXT NOT NULL, data TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS pending_chunks_file ON pending_chunks (file);
+`
+
+// Keys of the meta table
+const (
+	sqliteHeaderKey        = "header"         // Header of the index
+	sqlitePendingHeaderKey = "pending_header" // Header a new index is being written as
+)
+
+// SQLiteStore keeps the index in a SQLite database file
+type SQLiteStore struct {
+	Path      string
+	Precision string // Precision embeddings are written at; empty stores float32
+}
+
+// open opens the database, creating it when create is set. Without create,
+// a missing database fails like a missing JSON index.
+func (s *SQLiteStore) open(create bool) (*sql.DB, error) {
+	if create {
+		if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(s.Path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(s.Path)+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite index %s: %w", s.Path, err)
+	}
+	return db, nil
+}
+
+// Load reads every chunk in the index, failing with an *IncompatibleError if
+// its header doesn't match Current
+func (s *SQLiteStore) Load() ([]CodeChunk, error) {
+	header, err := s.Header()
+	if err != nil {
+		return nil, err
+	}
+	if err := header.Compatible(s.Path, Current); err != nil {
+		return nil, err
+	}
+
+	var chunks []CodeChunk
+	if err := s.Scan(func(chunk CodeChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	metrics.StoreChunks.Set(float64(len(chunks)))
+	return chunks, nil
+}
+
+// Save replaces the index with chunks
+func (s *SQLiteStore) Save(chunks []CodeChunk) error {
+	writer, err := s.NewWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	for start := 0; start < len(chunks); {
+		end := start + 1
+		for end < len(chunks) && chunks[end].File == chunks[start].File {
+			end++
+		}
+		if err := writer.WriteFile(chunks[start].File, chunks[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return writer.Commit()
+}
+
+// Header reads the header of the index
+func (s *SQLiteStore) Header() (Header, error) {
+	db, err := s.open(false)
+	if err != nil {
+		return Header{}, err
+	}
+	defer db.Close()
+
+	header, ok, err := readSQLiteHeader(db, sqliteHeaderKey)
+	if err == nil && !ok {
+		err = fmt.Errorf("SQLite index %s has no header", s.Path)
+	}
+	return header, err
+}
+
+// readSQLiteHeader reads the header stored under key, reporting whether
+// there is one
+func readSQLiteHeader(db *sql.DB, key string) (Header, bool, error) {
+	var data string
+	err := db.QueryRow("SELECT value FROM meta WHERE key = ?", key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Header{}, false, nil
+	}
+	if err != nil {
+		return Header{}, false, err
+	}
+	var header Header
+	if err := json.Unmarshal([]byte(data), &header); err != nil {
+		return Header{}, false, fmt.Errorf("corrupt index header: %w", err)
+	}
+	return header, true, nil
+}
+
+// Scan decodes the chunks of the index one at a time, in the order they
+// were written
+func (s *SQLiteStore) Scan(fn func(CodeChunk) error) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return scanSQLiteChunks(db, "chunks", fn)
+}
+
+// scanSQLiteChunks calls fn with each chunk of table, in the order they were
+// written
+func scanSQLiteChunks(db *sql.DB, table string, fn func(CodeChunk) error) error {
+	rows, err := db.Query("SELECT data FROM " + table + " ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var chunk CodeChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("corrupt index chunk: %w", err)
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Lock locks the lock file next to the database
+func (s *SQLiteStore) Lock() (func(), error) {
+	return Lock(s.Path)
+}
+
+// DeleteByFile rewrites the index without the chunks of paths. The index is
+// left untouched when nothing matches.
+func (s *SQLiteStore) DeleteByFile(paths ...string) (int, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	chunks, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	kept, removed := FilterByFile(chunks, paths...)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save(kept)
+}
+
+// DeleteByRepo rewrites the index without the chunks of the named
+// repositories. The index is left untouched when nothing matches.
+func (s *SQLiteStore) DeleteByRepo(names ...string) (int, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	chunks, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	kept, removed := FilterByRepo(chunks, names...)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save(kept)
+}
+
+// sqliteWriter writes a new index to the pending tables of a SQLite index,
+// a transaction per file, and moves it into place on commit
+type sqliteWriter struct {
+	mu        sync.Mutex
+	db        *sql.DB
+	path      string
+	precision string
+	stats     headerStats // Of the chunks written, for the index's header
+	unlock    func()      // Releases the index's lock, held until done
+	done      bool
+}
+
+// NewWriter starts writing a new index, discarding any left uncommitted by
+// an earlier run. The index stays locked until the writer commits or closes.
+func (s *SQLiteStore) NewWriter() (ChunkWriter, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return nil, err
+	}
+	writer, err := s.newWriter(unlock)
+	if err != nil {
+		unlock()
+	}
+	return writer, err
+}
+
+// newWriter clears the pending tables for NewWriter, which holds the lock
+func (s *SQLiteStore) newWriter(unlock func()) (ChunkWriter, error) {
+	db, err := s.open(true)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pending index records what it is built as, so a resumed run can't
+	// add incompatible chunks to it
+	header, err := json.Marshal(Current)
+	if err == nil {
+		err = inTransaction(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec("DELETE FROM pending_chunks"); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)", sqlitePendingHeaderKey, string(header))
+			return err
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteWriter{db: db, path: s.Path, precision: s.Precision, unlock: unlock}, nil
+}
+
+// ResumeWriter continues writing the index left uncommitted by an
+// interrupted writer, returning the number of chunks already written for
+// each file. Without one it starts a new index like NewWriter.
+func (s *SQLiteStore) ResumeWriter() (ChunkWriter, map[string]int, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return nil, nil, err
+	}
+	writer, completed, err := s.resumeWriter(unlock)
+	if err != nil {
+		unlock()
+	}
+	return writer, completed, err
+}
+
+// resumeWriter reopens the pending index for ResumeWriter, which holds the
+// lock
+func (s *SQLiteStore) resumeWriter(unlock func()) (ChunkWriter, map[string]int, error) {
+	db, err := s.open(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, ok, err := readSQLiteHeader(db, sqlitePendingHeaderKey)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if !ok {
+		db.Close()
+		writer, err := s.newWriter(unlock)
+		return writer, map[string]int{}, err
+	}
+	if err := header.Compatible(s.Path, Current); err != nil {
+		db.Close()
+		err.(*IncompatibleError).Fix = "run without --resume to start over"
+		return nil, nil, err
+	}
+
+	completed := make(map[string]int)
+	var stats headerStats
+	err = scanSQLiteChunks(db, "pending_chunks", func(chunk CodeChunk) error {
+		completed[chunk.File]++
+		stats.add(chunk)
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to resume from %s: %w", s.Path, err)
+	}
+	return &sqliteWriter{db: db, path: s.Path, precision: s.Precision, stats: stats, unlock: unlock}, completed, nil
+}
+
+// WriteFile replaces the pending chunks of file with chunks in one
+// transaction, so they are persisted when it returns
+func (w *sqliteWriter) WriteFile(file string, chunks []CodeChunk) error {
+	rows := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		encoded, err := encodeChunk(chunk, w.precision)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(encoded)
+		if err != nil {
+			return err
+		}
+		rows[i] = string(data)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return errors.New("index writer is closed")
+	}
+	err := inTransaction(w.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM pending_chunks WHERE file = ?", file); err != nil {
+			return err
+		}
+		insert, err := tx.Prepare("INSERT INTO pending_chunks (file, data) VALUES (?, ?)")
+		if err != nil {
+			return err
+		}
+		defer insert.Close()
+		for _, row := range rows {
+			if _, err := insert.Exec(file, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		w.stats.add(chunk)
+	}
+	return nil
+}
+
+// Flush does nothing, as every file is committed to the database as it is
+// written
+func (w *sqliteWriter) Flush() error {
+	return nil
+}
+
+// Commit replaces the chunks of the index with the pending ones, and its
+// header with one describing them, in one transaction
+func (w *sqliteWriter) Commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return errors.New("index writer is closed")
+	}
+	w.done = true
+	defer w.unlock()
+	defer w.db.Close()
+
+	previous, _, err := readSQLiteHeader(w.db, sqliteHeaderKey)
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(w.stats.header(previous))
+	if err != nil {
+		return err
+	}
+
+	var written, moved int64
+	err = inTransaction(w.db, func(tx *sql.Tx) error {
+		if err := tx.QueryRow("SELECT COUNT(*) FROM pending_chunks").Scan(&written); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM chunks"); err != nil {
+			return err
+		}
+		result, err := tx.Exec("INSERT INTO chunks (file, data) SELECT file, data FROM pending_chunks ORDER BY id")
+		if err != nil {
+			return err
+		}
+		if moved, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if moved != written {
+			return fmt.Errorf("new index holds %d chunks instead of %d, keeping the current one", moved, written)
+		}
+		if _, err := tx.Exec("DELETE FROM pending_chunks"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM meta WHERE key = ?", sqlitePendingHeaderKey); err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)", sqliteHeaderKey, string(header))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(w.path); err == nil {
+		metrics.StoreBytes.Set(float64(info.Size()))
+	}
+	metrics.StoreChunks.Set(float64(moved))
+	return nil
+}
+
+// Close stops writing, keeping the pending chunks for a later run
+func (w *sqliteWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer w.unlock()
+	return w.db.Close()
+}
+
+// inTransaction runs fn in a transaction, committing it if fn succeeds and
+// rolling it back otherwise
+func inTransaction(db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSQLiteStore saves chunks to a SQLite index, reads them back, resumes
+// an interrupted writer, and deletes a file's chunks
+func TestSQLiteStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open("sqlite", filepath.Join(dir, "index.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	chunks := []CodeChunk{
+		{File: a, Function: "run", StartLine: 1, EndLine: 5, Content: "func run() {}", Calls: []string{"fmt.Println"}, Embedding: []float32{0.5, -0.25}},
+		{File: a, Function: "stop", StartLine: 7, EndLine: 9, Content: "func stop() {}", Embedding: []float32{1, 0}},
+		{File: b, Function: "main", StartLine: 3, EndLine: 4, Content: "func main() {}", Repo: "app", Embedding: []float32{0, 1}},
+	}
+
+	if err := store.Save(chunks); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, chunks) {
+		t.Errorf("Load = %+v, want %+v", loaded, chunks)
+	}
+	header, err := store.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if header.SchemaVersion != SchemaVersion || header.Dimensions != 2 || header.Root != dir {
+		t.Errorf("Header = %+v, want schema %d, 2 dimensions, and root %s", header, SchemaVersion, dir)
+	}
+
+	// An interrupted writer leaves the index as it was, and a resumed one
+	// picks up the files it wrote
+	writer, err := store.NewWriter()
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := writer.WriteFile(b, chunks[2:]); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if loaded, err := store.Load(); err != nil || len(loaded) != len(chunks) {
+		t.Fatalf("Load after an interrupted write = %d chunks, %v; want %d", len(loaded), err, len(chunks))
+	}
+	writer, completed, err := store.ResumeWriter()
+	if err != nil {
+		t.Fatalf("ResumeWriter: %v", err)
+	}
+	if want := map[string]int{b: 1}; !reflect.DeepEqual(completed, want) {
+		t.Errorf("ResumeWriter completed = %v, want %v", completed, want)
+	}
+	if err := writer.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if loaded, err := store.Load(); err != nil || !reflect.DeepEqual(loaded, chunks[2:]) {
+		t.Errorf("Load after resuming = %+v, %v; want %+v", loaded, err, chunks[2:])
+	}
+
+	removed, err := store.DeleteByRepo("app")
+	if err != nil || removed != 1 {
+		t.Errorf("DeleteByRepo = %d, %v; want 1 chunk removed", removed, err)
+	}
+	count := 0
+	if err := store.Scan(func(CodeChunk) error { count++; return nil }); err != nil || count != 0 {
+		t.Errorf("Scan after deleting = %d chunks, %v; want none", count, err)
+	}
+}
@@ -2,22 +2,174 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/metrics"
 )
 
 // CodeChunk represents a chunk of code with its embedding
 type CodeChunk struct {
-	File      string    `json:"file"`
-	Content   string    `json:"content"`
+	File      string   `json:"file"`
+	Package   string   `json:"package,omitempty"`
+	Function  string   `json:"function,omitempty"`
+	Class     string   `json:"class,omitempty"`
+	StartLine int      `json:"start_line,omitempty"`
+	EndLine   int      `json:"end_line,omitempty"`
+	Content   string   `json:"content"`
+	Context   string   `json:"context,omitempty"` // Scope header that was embedded ahead of Content
+	Imports   []string `json:"imports,omitempty"` // Imports declared by the file, set on its first chunk only
+	Calls     []string `json:"calls,omitempty"`   // Names of the functions and methods a function chunk calls, as pkg.Fn for Go selector calls
+	Commit    string   `json:"commit,omitempty"`  // Git commit checked out when the file was indexed with --git
+	Repo      string   `json:"repo,omitempty"`    // Name of the workspace repository the file belongs to
+	Kind      string   `json:"kind,omitempty"`    // SummaryKind for a summary of a file or directory; empty for code
+
+	// Provenance recorded when the file was indexed with --git: the git
+	// blob hash of the whole file as indexed, and the latest commit to
+	// change the chunk's lines. Uncommitted lines don't count.
+	Blob        string    `json:"blob,omitempty"`
+	LastCommit  string    `json:"last_commit,omitempty"`
+	LastAuthor  string    `json:"last_author,omitempty"`
+	LastChanged time.Time `json:"last_changed,omitzero"`
+
 	Embedding []float32 `json:"embedding"`
 }
 
+// Provenance describes the last change to the chunk's lines, as in "last
+// changed by Ada in 1a2b3c4 on 2024-05-01", or returns "" if it isn't known
+func (c CodeChunk) Provenance() string {
+	if c.LastCommit == "" {
+		return ""
+	}
+	commit := c.LastCommit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	return fmt.Sprintf("last changed by %s in %s on %s", c.LastAuthor, commit, c.LastChanged.Format(time.DateOnly))
+}
+
+// CalledFunctions returns the names of the functions and methods the chunk
+// calls, without the package or value a Go call is qualified by
+func (c CodeChunk) CalledFunctions() []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, call := range c.Calls {
+		if i := strings.LastIndexByte(call, '.'); i >= 0 {
+			call = call[i+1:]
+		}
+		if !seen[call] {
+			seen[call] = true
+			names = append(names, call)
+		}
+	}
+	return names
+}
+
+// Kind of the chunks holding summaries of files and directories, which are
+// searched alongside the code but never stored in the index
+const SummaryKind = "summary"
+
+// LoadFromJSON loads a slice of CodeChunks from a JSON file, failing with
+// an *IncompatibleError if its header doesn't match Current
+func LoadFromJSON(filename string) ([]CodeChunk, error) {
+	header, chunks, err := LoadIndex(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := header.Compatible(filename, Current); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// LoadAnyModel loads an index like LoadFromJSON, whatever model its chunks
+// were embedded with, for commands that never compare its embeddings with
+// new ones
+func LoadAnyModel(filename string) ([]CodeChunk, error) {
+	header, chunks, err := LoadIndex(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := header.Compatible(filename, Current.AnyModel()); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// LoadIndex loads the header and chunks of an index of any schema version,
+// without checking that they match Current
+func LoadIndex(filename string) (Header, []CodeChunk, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	header, chunks, err := decodeIndex(data)
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	metrics.StoreBytes.Set(float64(len(data)))
+	metrics.StoreChunks.Set(float64(len(chunks)))
+	return header, chunks, nil
+}
+
 // SaveToJSON saves a slice of CodeChunks to a JSON file
 func SaveToJSON(chunks []CodeChunk, filename string) error {
-	output, err := json.MarshalIndent(chunks, "", "  ")
+	return saveJSON(chunks, filename, PrecisionFloat32)
+}
+
+// saveJSON saves chunks to a JSON file with their embeddings stored at
+// precision, under a header describing them
+func saveJSON(chunks []CodeChunk, filename, precision string) error {
+	unlock, err := Lock(filename)
 	if err != nil {
 		return err
 	}
-	
-	return os.WriteFile(filename, output, 0644)
-}
\ No newline at end of file
+	defer unlock()
+
+	var stats headerStats
+	encoded := make([]any, len(chunks))
+	for i, chunk := range chunks {
+		if encoded[i], err = encodeChunk(chunk, precision); err != nil {
+			return err
+		}
+		stats.add(chunk)
+	}
+
+	output, err := json.MarshalIndent(indexFile{Header: stats.header(previousHeader(filename)), Chunks: encoded}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, _, err = replaceIndex(filename, func(w io.Writer) (int, error) {
+		_, err := w.Write(output)
+		return len(chunks), err
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.StoreBytes.Set(float64(len(output)))
+	metrics.StoreChunks.Set(float64(len(chunks)))
+	return nil
+}
+
+// RootDir returns the deepest directory containing every indexed file
+func RootDir(chunks []CodeChunk) string {
+	root := ""
+	for _, chunk := range chunks {
+		if chunk.Kind == SummaryKind {
+			continue // Summaries of directories are paths of directories
+		}
+		root = widenRoot(root, filepath.Dir(chunk.File))
+	}
+	if root == "" {
+		return "."
+	}
+	return root
+}
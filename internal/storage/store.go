@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Store is an index storage backend. Every backend can load and replace the
+// whole index, read it chunk by chunk, write a new index incrementally, and
+// delete the chunks of individual files or of a workspace repository. Only
+// one process writes an index at a time; the others fail with a
+// *LockedError.
+type Store interface {
+	// Load reads every chunk in the index
+	Load() ([]CodeChunk, error)
+	// Header reads the header of the index
+	Header() (Header, error)
+	// Scan calls fn with each chunk of the index in order, holding only
+	// one in memory. Unlike Load, it doesn't check the index against
+	// Current.
+	Scan(fn func(CodeChunk) error) error
+	// Save replaces the index with chunks
+	Save(chunks []CodeChunk) error
+	// NewWriter starts writing a new index that replaces the current one
+	// when committed
+	NewWriter() (ChunkWriter, error)
+	// ResumeWriter continues a new index left uncommitted by an interrupted
+	// run, returning the number of chunks written for each completed file
+	ResumeWriter() (ChunkWriter, map[string]int, error)
+	// DeleteByFile removes the chunks of the given files and of every file
+	// under the given directories, returning the number of chunks removed
+	DeleteByFile(paths ...string) (int, error)
+	// DeleteByRepo removes the chunks of the named workspace repositories,
+	// returning the number of chunks removed
+	DeleteByRepo(names ...string) (int, error)
+	// Lock makes this process the index's only writer until the returned
+	// function is called. Writes take the lock themselves; callers take it
+	// to keep the index from changing between reading it and writing it
+	// back.
+	Lock() (func(), error)
+}
+
+// Options configure how a store writes the index
+type Options struct {
+	VectorPrecision string // One of VectorPrecisions; empty stores float32
+}
+
+// Backends lists the storage backends Open supports
+var Backends = []string{"json", "sqlite"}
+
+// Open returns the store of a backend ("json" or "sqlite") at path
+func Open(backend, path string, options Options) (Store, error) {
+	switch backend {
+	case "json":
+		return &JSONStore{Path: path, Precision: options.VectorPrecision}, nil
+	case "sqlite":
+		return &SQLiteStore{Path: path, Precision: options.VectorPrecision}, nil
+	}
+	return nil, fmt.Errorf("unsupported backend %q; supported backends: %s", backend, strings.Join(Backends, ", "))
+}
+
+// JSONStore keeps the index as a JSON array of chunks in a single file
+type JSONStore struct {
+	Path      string
+	Precision string // Precision embeddings are written at; empty stores float32
+}
+
+// Load reads every chunk in the index file
+func (s *JSONStore) Load() ([]CodeChunk, error) {
+	return LoadFromJSON(s.Path)
+}
+
+// Save replaces the index file with chunks
+func (s *JSONStore) Save(chunks []CodeChunk) error {
+	return saveJSON(chunks, s.Path, s.Precision)
+}
+
+// Header reads the header at the start of the index file
+func (s *JSONStore) Header() (Header, error) {
+	return LoadHeader(s.Path)
+}
+
+// Scan decodes the chunks of the index file one at a time
+func (s *JSONStore) Scan(fn func(CodeChunk) error) error {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReaderSize(file, 1<<20))
+	header, err := readHeader(decoder)
+	if err != nil {
+		return err
+	}
+	// The chunks of a version 1 index follow its opening bracket
+	if header.SchemaVersion > 1 {
+		if token, err := decoder.Token(); err != nil {
+			return err
+		} else if token != json.Delim('[') {
+			return errors.New("index chunks aren't a JSON array")
+		}
+	}
+	for decoder.More() {
+		var chunk CodeChunk
+		if err := decoder.Decode(&chunk); err != nil {
+			return err
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lock locks the lock file next to the index file
+func (s *JSONStore) Lock() (func(), error) {
+	return Lock(s.Path)
+}
+
+// DeleteByFile rewrites the index file without the chunks of paths. The file
+// is left untouched when nothing matches.
+func (s *JSONStore) DeleteByFile(paths ...string) (int, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	chunks, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	kept, removed := FilterByFile(chunks, paths...)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save(kept)
+}
+
+// DeleteByRepo rewrites the index file without the chunks of the named
+// repositories. The file is left untouched when nothing matches.
+func (s *JSONStore) DeleteByRepo(names ...string) (int, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	chunks, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	kept, removed := FilterByRepo(chunks, names...)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save(kept)
+}
+
+// FilterByRepo returns chunks without those of the named repositories, and
+// the number of chunks left out
+func FilterByRepo(chunks []CodeChunk, names ...string) ([]CodeChunk, int) {
+	kept := chunks[:0:0]
+	removed := 0
+	for _, chunk := range chunks {
+		if chunk.Repo != "" && slices.Contains(names, chunk.Repo) {
+			removed++
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	return kept, removed
+}
+
+// FilterByFile returns chunks without those of the given files or of files
+// under the given directories, and the number of chunks left out
+func FilterByFile(chunks []CodeChunk, paths ...string) ([]CodeChunk, int) {
+	targets := make([]string, len(paths))
+	for i, path := range paths {
+		targets[i] = absPath(path)
+	}
+
+	kept := chunks[:0:0]
+	removed := 0
+	for _, chunk := range chunks {
+		if matchesAnyPath(absPath(chunk.File), targets) {
+			removed++
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	return kept, removed
+}
+
+// matchesAnyPath reports whether file is one of targets or lies under one of them
+func matchesAnyPath(file string, targets []string) bool {
+	for _, target := range targets {
+		if file == target || strings.HasPrefix(file, strings.TrimSuffix(target, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// absPath cleans path and makes it absolute so relative and absolute
+// spellings of the same file match
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// Suffix of the workspace file kept next to an index
+const workspaceSuffix = ".workspace.json"
+
+// WorkspaceRepo is a repository indexed into a workspace under a name
+type WorkspaceRepo struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"` // Absolute path of the repository
+}
+
+// Workspace lists the repositories whose chunks share one index, each
+// namespaced by its name
+type Workspace struct {
+	Repos []WorkspaceRepo `json:"repos"`
+}
+
+// WorkspacePath returns the path of the workspace file of an index
+func WorkspacePath(indexPath string) string {
+	return indexPath + workspaceSuffix
+}
+
+// LoadWorkspace reads the workspace of an index. An index without a
+// workspace file has an empty workspace.
+func LoadWorkspace(indexPath string) (Workspace, error) {
+	var workspace Workspace
+	data, err := os.ReadFile(WorkspacePath(indexPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return workspace, nil
+	}
+	if err != nil {
+		return workspace, err
+	}
+	err = json.Unmarshal(data, &workspace)
+	return workspace, err
+}
+
+// SaveWorkspace writes the workspace of an index, removing the file when the
+// workspace is empty
+func SaveWorkspace(indexPath string, workspace Workspace) error {
+	if len(workspace.Repos) == 0 {
+		err := os.Remove(WorkspacePath(indexPath))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	sort.Slice(workspace.Repos, func(i, j int) bool {
+		return workspace.Repos[i].Name < workspace.Repos[j].Name
+	})
+	data, err := json.MarshalIndent(workspace, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(WorkspacePath(indexPath), append(data, '\n'), 0o644)
+}
+
+// Find returns the repository with a name
+func (w Workspace) Find(name string) (WorkspaceRepo, bool) {
+	for _, repo := range w.Repos {
+		if repo.Name == name {
+			return repo, true
+		}
+	}
+	return WorkspaceRepo{}, false
+}
+
+// Put adds a repository, replacing one of the same name
+func (w *Workspace) Put(repo WorkspaceRepo) {
+	w.Remove(repo.Name)
+	w.Repos = append(w.Repos, repo)
+}
+
+// Remove drops the repository with a name, reporting whether there was one
+func (w *Workspace) Remove(name string) bool {
+	for i, repo := range w.Repos {
+		if repo.Name == name {
+			w.Repos = append(w.Repos[:i], w.Repos[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
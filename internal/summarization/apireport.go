@@ -0,0 +1,70 @@
+package summarization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+)
+
+// Symbols described per chat request
+const describeBatchSize = 40
+
+// Characters of each declaration included when describing symbols
+const describeDeclarationMaxChars = 800
+
+// SymbolKey identifies a symbol in the map returned by DescribeSymbols
+func SymbolKey(symbol embeddings.APISymbol) string {
+	return fmt.Sprintf("%s:%d", symbol.File, symbol.Line)
+}
+
+// DescribeSymbols asks the model for a one-line description of each symbol,
+// keyed by SymbolKey. Symbols the model skips have no description.
+func DescribeSymbols(symbols []embeddings.APISymbol) (map[string]string, error) {
+	descriptions := make(map[string]string)
+
+	for start := 0; start < len(symbols); start += describeBatchSize {
+		end := start + describeBatchSize
+		if end > len(symbols) {
+			end = len(symbols)
+		}
+
+		var sb strings.Builder
+		sb.WriteString("Write a one-line description (at most 15 words) of what each public API element below does, ")
+		sb.WriteString("judging from its declaration. Don't start with the element's name. ")
+		sb.WriteString("Reply with only a JSON object mapping each element's id to its description.\n")
+
+		for _, symbol := range symbols[start:end] {
+			declaration := symbol.Declaration
+			if declaration == "" {
+				declaration = symbol.Signature
+			}
+			if len(declaration) > describeDeclarationMaxChars {
+				declaration = declaration[:describeDeclarationMaxChars] + "\n..."
+			}
+			sb.WriteString(fmt.Sprintf("\n--- id: %s (%s %s) ---\n%s\n", SymbolKey(symbol), symbol.Kind, symbol.Name, declaration))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		reply, err := chatCompletion(ctx, summarySystemPrompt, sb.String(), 3000, 0.1)
+		cancel()
+		if err != nil {
+			return descriptions, fmt.Errorf("failed to describe symbols: %v", err)
+		}
+
+		reply = stripCodeFence(reply)
+
+		var batch map[string]string
+		if err := json.Unmarshal([]byte(reply), &batch); err != nil {
+			return descriptions, fmt.Errorf("failed to parse symbol descriptions: %v", err)
+		}
+		for key, description := range batch {
+			descriptions[key] = strings.TrimSpace(description)
+		}
+	}
+
+	return descriptions, nil
+}
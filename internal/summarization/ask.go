@@ -0,0 +1,145 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/pricing"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Default number of chunks given to the model when answering a question
+const DefaultAskChunks = 8
+
+// AskOptions control how a question is answered
+type AskOptions struct {
+	TopK   int  // Chunks given to the model; 0 uses DefaultAskChunks
+	Rerank bool // Pick them by reranking the RerankCandidates most similar chunks with RerankModel
+
+	// MinScore leaves out chunks less similar to the question than this,
+	// so weak matches aren't passed off as relevant. When none is left, the
+	// model is told that no relevant code was found. 0 keeps every chunk.
+	MinScore float32
+
+	// MaxContextTokens caps the tokens the excerpts take in all, below what
+	// MaxPromptTokens leaves them; 0 leaves them all of that
+	MaxContextTokens int
+}
+
+// AnswerQuestion answers a question about the codebase from the indexed
+// chunks most relevant to it, returning the answer and the chunks it used.
+// Chunks trimmed out of the prompt to fit its budget aren't returned.
+func AnswerQuestion(ctx context.Context, chunks []storage.CodeChunk, question string, options AskOptions) (string, []search.Result, error) {
+	topK := options.TopK
+	if topK <= 0 {
+		topK = DefaultAskChunks
+	}
+
+	queryEmbedding, err := embeddings.GetQueryEmbeddingContext(ctx, question)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to embed question: %v", err)
+	}
+
+	candidateCount := topK
+	if options.Rerank {
+		candidateCount = max(RerankCandidates, topK)
+	}
+	candidates := search.SearchContext(ctx, chunks, queryEmbedding, candidateCount)
+	if len(candidates) == 0 {
+		return "", nil, fmt.Errorf("no indexed code to answer from")
+	}
+
+	// Candidates arrive most similar first, so the weak matches are a tail
+	relevant := candidates
+	for i, result := range candidates {
+		if options.MinScore > 0 && result.Score < options.MinScore {
+			relevant = candidates[:i]
+			break
+		}
+	}
+	sources := relevant
+	if options.Rerank && len(relevant) > 0 {
+		if sources, err = Rerank(ctx, question, relevant, topK); err != nil {
+			return "", nil, err
+		}
+	}
+	if len(sources) > topK {
+		sources = sources[:topK]
+	}
+
+	var sb strings.Builder
+	if len(sources) == 0 {
+		// Without excerpts the model would answer from what it guesses
+		sb.WriteString("A question was asked about a codebase, but no indexed code or summary was similar enough to it to answer from ")
+		sb.WriteString(fmt.Sprintf("(the closest scored %.2f, below the minimum of %.2f). ", candidates[0].Score, options.MinScore))
+		sb.WriteString("Say that no relevant code was found in the index and suggest rephrasing the question or re-indexing. Don't guess at an answer.\n")
+		sb.WriteString("\nQuestion: " + question + "\n")
+		answer, err := askModel(ctx, sb.String())
+		return answer, nil, err
+	}
+
+	sb.WriteString("Answer the question below about a codebase using only the code excerpts and summaries that follow. ")
+	sb.WriteString("Cite file:line for the code your answer relies on, with the author and commit of its last change when the excerpt gives them. ")
+	sb.WriteString("If the excerpts don't contain the answer, say so instead of guessing.\n")
+	sb.WriteString("\nQuestion: " + question + "\n")
+
+	sb.WriteString("\nCode excerpts (most relevant first):\n")
+
+	// Excerpts share what the question leaves of the budget, keeping their
+	// line numbers when trimmed. Summaries of files and directories have no
+	// lines to number.
+	var headers, excerpts []string
+	for _, result := range sources {
+		chunk := result.Chunk
+		if chunk.Kind == storage.SummaryKind {
+			headers = append(headers, fmt.Sprintf("\n--- %s (similarity %.2f) ---\n", chunk.Context, result.Score))
+			excerpts = append(excerpts, chunk.Content)
+			continue
+		}
+		headers = append(headers, fmt.Sprintf("\n--- %s (%s) ---\n", chunk.File, describeMatch(chunk, result.Score)))
+		excerpts = append(excerpts, numberLines(chunk.Content, chunk.StartLine))
+	}
+	contextTokens := MaxPromptTokens - pricing.EstimateTokens(sb.String())
+	if options.MaxContextTokens > 0 {
+		contextTokens = min(contextTokens, options.MaxContextTokens)
+	}
+	var used []search.Result
+	for i, excerpt := range newTokenBudget(contextTokens).next().fitAll(headers, excerpts) {
+		if excerpt != "" {
+			sb.WriteString(headers[i] + excerpt + "\n")
+			used = append(used, sources[i])
+		}
+	}
+	if len(used) == 0 {
+		return "", nil, fmt.Errorf("no excerpt fits in %d tokens of context", contextTokens)
+	}
+
+	answer, err := askModel(ctx, sb.String())
+	return answer, used, err
+}
+
+// askModel sends the prompt of a question to the chat model
+func askModel(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	answer, err := chatCompletion(ctx, summarySystemPrompt, prompt, 1500, 0.2)
+	if err != nil {
+		return "", fmt.Errorf("failed to answer question: %v", err)
+	}
+	return answer, nil
+}
+
+// describeMatch notes the similarity of a chunk to the question and, when
+// known, who last changed it
+func describeMatch(chunk storage.CodeChunk, score float32) string {
+	description := fmt.Sprintf("similarity %.2f", score)
+	if provenance := chunk.Provenance(); provenance != "" {
+		description += "; " + provenance
+	}
+	return description
+}
@@ -0,0 +1,145 @@
+package summarization
+
+// Audiences lists the readers a codebase summary can be written for:
+// "developer" explains the architecture and design to engineers, "exec"
+// gives a business-level overview with the risks, "new-dev" orients a
+// developer joining the project, "sre" covers deployment, configuration,
+// observability, and failure modes, and "security" maps the attack surface
+var Audiences = []string{"developer", "exec", "new-dev", "sre", "security"}
+
+// audience is a preset of what a summary is written for: the system prompt,
+// how it's introduced, the code retrieved for it, and the sections asked for
+type audience struct {
+	reader       string         // Who reads the summary, as in "would <reader> understand"
+	systemPrompt string         // System prompt of the summary request
+	instruction  string         // What the summary is for, opening the prompt
+	topics       []summaryTopic // Topics code is retrieved for, in the order shown
+	sections     []string       // Sections of the summary
+	quality      string         // Section added when code metrics are included
+	styleExample bool           // Whether the prompt shows the example of an architectural summary
+}
+
+// audiences maps each of Audiences to its preset
+var audiences = map[string]audience{
+	"developer": {
+		reader:       "a developer",
+		systemPrompt: summarySystemPrompt,
+		instruction: "You are analyzing a software codebase. Your task is to create a professional, " +
+			"technically precise summary that would help a developer understand this project quickly. " +
+			"Focus on identifying architectural patterns, key abstractions, and the overall design philosophy. " +
+			"When code follows well-known patterns or frameworks, explicitly name them. ",
+		topics: summaryTopics,
+		sections: []string{
+			"Overview - What the project does and its main purpose",
+			"Architecture - Main components and how they're organized",
+			"Key Features - Important functionality implemented",
+			"Implementation Details - Notable code patterns or techniques",
+		},
+		quality:      "Code Quality - Assessment of structure, organization, and maintainability, citing the code metrics above",
+		styleExample: true,
+	},
+	"exec": {
+		reader:       "an engineering executive without time to read code",
+		systemPrompt: "You are a principal engineer briefing engineering leadership on a codebase. You explain what software does and what it's worth in plain business language, and you are candid about risk, cost, and where investment is needed.",
+		instruction: "You are analyzing a software codebase for an executive audience. Your task is to create a " +
+			"business-level overview: what the product does, what it depends on, how healthy it is, and what could go wrong. " +
+			"Avoid code, jargon, and implementation detail unless it explains a risk, and name technologies only where they matter for cost, hiring, or vendor lock-in. ",
+		topics: []summaryTopic{
+			{"Product capabilities", "user-facing features, commands, endpoints, and the main workflows the product supports"},
+			{"External dependencies", "third-party services, cloud providers, external APIs, databases, and paid integrations"},
+			{"Data handling", "storage of customer or user data, personal information, exports, and retention"},
+			{"Security-sensitive code", "authentication, authorization, secrets, credentials, and encryption"},
+			{"Reliability", "error handling, retries, failure recovery, and single points of failure"},
+		},
+		sections: []string{
+			"Executive Summary - What the product does and who it serves, in two or three sentences",
+			"Capabilities - The main things it does, described by their value rather than their implementation",
+			"Architecture at a Glance - The major parts and the outside services they depend on, in plain terms",
+			"Risks - Security, reliability, vendor, and maintainability risks, each with its likely business impact",
+			"Recommendations - Where investment or attention would pay off most",
+		},
+		quality: "Health - How maintainable the code is, in plain terms, citing the code metrics above only where they support the point",
+	},
+	"new-dev": {
+		reader:       "a developer in their first week on the project",
+		systemPrompt: "You are a senior engineer onboarding a new teammate to a codebase. You explain how the code is organized and how its pieces fit together, define the project's vocabulary, and point to the files worth reading first.",
+		instruction: "You are analyzing a software codebase for a developer who has just joined the project. Your task is to create a " +
+			"guided introduction that gets them productive quickly: how the code is laid out, the concepts and data it revolves around, " +
+			"how a typical request or command flows through it, and the conventions to follow when changing it. Cite file paths throughout. ",
+		topics: []summaryTopic{
+			{"Entry points", "program entry point, main function, command-line handling, server startup"},
+			{"Data model", "core data structures, domain models, types and schemas"},
+			{"Core logic", "main algorithm and business logic that does the central work"},
+			{"Configuration", "configuration loading, settings, environment variables, options and defaults"},
+			{"Build and tests", "build scripts, Makefile, test setup, fixtures, and helpers used by tests"},
+			{"Conventions", "shared utilities, error handling helpers, logging, and common patterns reused across the code"},
+		},
+		sections: []string{
+			"Overview - What the project does, in a paragraph",
+			"Code Layout - The main directories and packages and what belongs in each",
+			"Key Concepts - The domain vocabulary and core data structures, with where they're defined",
+			"How It Works - A walkthrough of one typical request or command from entry point to result",
+			"Where to Start Reading - The five to ten files to read first, in order, with why",
+			"Conventions - Error handling, testing, naming, and other patterns to follow when making changes",
+		},
+		quality: "Watch Out For - The most complex or duplicated code, citing the code metrics above, and how to approach it",
+	},
+	"sre": {
+		reader:       "a site reliability engineer who will run this in production",
+		systemPrompt: "You are a senior site reliability engineer reviewing a codebase before taking it on in production. You care about how it is deployed, configured, observed, and scaled, what it depends on, and how it fails.",
+		instruction: "You are analyzing a software codebase for the engineers who will operate it. Your task is to create an " +
+			"operational summary: how the software is built and deployed, how it's configured, what it depends on at runtime, " +
+			"what telemetry it emits, and how it behaves when things go wrong. Cite file paths, settings, and environment variables by name. ",
+		topics: []summaryTopic{
+			{"Startup and shutdown", "server startup, listening ports, graceful shutdown, and signal handling"},
+			{"Configuration", "configuration loading, environment variables, flags, secrets, and defaults"},
+			{"Deployment", "Dockerfile, Kubernetes manifests, Helm charts, Terraform, and CI/CD pipelines"},
+			{"Runtime dependencies", "database connections, queues, caches, external API clients, timeouts, and connection pools"},
+			{"Observability", "logging, metrics, tracing, health checks, and readiness probes"},
+			{"Failure handling", "error handling, retries, rate limiting, backoff, circuit breakers, and failure recovery"},
+		},
+		sections: []string{
+			"Overview - What the service does and how it runs (long-running service, job, CLI)",
+			"Build and Deployment - How it's packaged and deployed, and the infrastructure it expects",
+			"Configuration - The settings and environment variables that matter in production, with their defaults",
+			"Runtime Dependencies - Databases, queues, and external services it needs, and how it connects to them",
+			"Observability - The logs, metrics, traces, and health checks it provides, and the gaps",
+			"Failure Modes - How it behaves when dependencies fail or load spikes, and the operational risks",
+			"Runbook Notes - What an on-call engineer should know: restarts, scaling, data migrations, and common issues",
+		},
+		quality: "Operability - How code complexity and duplication, citing the code metrics above, affect debugging incidents",
+	},
+	"security": {
+		reader:       "a security engineer assessing the project",
+		systemPrompt: "You are an application security engineer reviewing a codebase. You map its attack surface and trust boundaries, follow untrusted input through the code, and report risks with concrete file references rather than generic advice.",
+		instruction: "You are analyzing a software codebase for a security review. Your task is to create a " +
+			"security-oriented overview: what the software exposes, who and what it trusts, how it authenticates and authorizes, " +
+			"how it handles secrets and sensitive data, and where it is most likely to be vulnerable. Cite file paths for every finding. ",
+		topics: []summaryTopic{
+			{"Attack surface", "HTTP handlers and routes, RPC services, command-line input, and file or network parsing"},
+			{"Authentication and authorization", "login, sessions, tokens, API keys, permission and access control checks"},
+			{"Secrets and credentials", "secrets, credentials, keys, tokens loaded from configuration or the environment"},
+			{"Input handling", "input validation, deserialization, SQL queries, shell commands, templates, and path handling"},
+			{"Cryptography", "encryption, hashing, random number generation, TLS configuration, and certificates"},
+			{"Outbound requests", "external API clients, webhooks, HTTP requests to user-supplied URLs, and redirects"},
+		},
+		sections: []string{
+			"Overview - What the software does and how it is exposed (network service, CLI, library)",
+			"Attack Surface - Every entry point that accepts untrusted input",
+			"Trust Boundaries - Authentication, authorization, and the components that trust each other",
+			"Sensitive Data - Secrets, credentials, and personal data, and how they are stored and transmitted",
+			"Notable Risks - Likely vulnerabilities ranked by severity, each with file references",
+			"Recommendations - The hardening steps that would reduce risk most",
+		},
+		quality: "Code Quality Risks - Complex or duplicated security-relevant code, citing the code metrics above, that is likely to hide bugs",
+	},
+}
+
+// audienceFor returns the preset of an audience, or of developers when it
+// isn't one of Audiences
+func audienceFor(name string) audience {
+	if preset, ok := audiences[name]; ok {
+		return preset
+	}
+	return audiences["developer"]
+}
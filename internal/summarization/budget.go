@@ -0,0 +1,163 @@
+package summarization
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/pricing"
+)
+
+// MaxPromptTokens is the number of tokens a summary, answer, or review
+// prompt may take, as measured by pricing.EstimateTokens. The instructions
+// are counted first and the code context fills the rest.
+var MaxPromptTokens = 24000
+
+// Fewest tokens worth trimming a piece of context to; pieces that would get
+// less are left out
+const minPieceTokens = 48
+
+// tokenBudget divides the tokens of a prompt among its sections by share.
+// Each section is allowed its share of what's left when it's filled, so the
+// tokens one section doesn't use pass to the sections after it.
+type tokenBudget struct {
+	remaining int
+	shares    []float64 // Shares of the sections not filled yet, in order
+}
+
+// newTokenBudget returns a budget of total tokens for sections with shares,
+// filled in order
+func newTokenBudget(total int, shares ...float64) *tokenBudget {
+	return &tokenBudget{remaining: max(total, 0), shares: shares}
+}
+
+// next returns the allowance of the next section. Sections beyond those
+// the budget was made for may use all that's left.
+func (b *tokenBudget) next() *tokenAllowance {
+	if len(b.shares) == 0 {
+		return &tokenAllowance{budget: b, left: b.remaining}
+	}
+	total := 0.0
+	for _, share := range b.shares {
+		total += share
+	}
+	left := b.remaining
+	if total > 0 {
+		left = int(float64(b.remaining) * b.shares[0] / total)
+	}
+	b.shares = b.shares[1:]
+	return &tokenAllowance{budget: b, left: left}
+}
+
+// tokenAllowance is what a section of a prompt may spend of its budget
+type tokenAllowance struct {
+	budget *tokenBudget
+	left   int
+}
+
+// charge spends the tokens of text written to the section
+func (a *tokenAllowance) charge(text string) {
+	tokens := pricing.EstimateTokens(text)
+	a.left -= tokens
+	a.budget.remaining -= tokens
+}
+
+// fit returns text whole if it fits what's left of the allowance, or its
+// first and last lines with the middle omitted if it doesn't, charging
+// either. It returns false when too little is left to show anything useful.
+func (a *tokenAllowance) fit(text string) (string, bool) {
+	if pricing.EstimateTokens(text) > a.left {
+		if a.left < minPieceTokens {
+			return "", false
+		}
+		text = trimToTokens(text, a.left)
+	}
+	a.charge(text)
+	return text, true
+}
+
+// fitAll fits pieces of context, each written after its header, into the
+// allowance together. Pieces that fit an even share are kept whole and the
+// tokens they leave are shared among the rest, which are trimmed to their
+// share, or left out as "" when it's too small.
+func (a *tokenAllowance) fitAll(headers, texts []string) []string {
+	sizes := make([]int, len(texts))
+	for i := range texts {
+		sizes[i] = pricing.EstimateTokens(headers[i]) + pricing.EstimateTokens(texts[i])
+	}
+
+	fitted := make([]string, len(texts))
+	for i, share := range fairShares(sizes, a.left) {
+		text := texts[i]
+		if share < sizes[i] {
+			limit := share - pricing.EstimateTokens(headers[i])
+			if limit < minPieceTokens {
+				continue
+			}
+			text = trimToTokens(text, limit)
+		}
+		a.charge(headers[i])
+		a.charge(text)
+		fitted[i] = text
+	}
+	return fitted
+}
+
+// fairShares splits total tokens among pieces of sizes, giving none more
+// than its size and splitting the rest evenly among those that need more
+func fairShares(sizes []int, total int) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]] < sizes[order[j]]
+	})
+
+	shares := make([]int, len(sizes))
+	for n, i := range order {
+		share := max(total, 0) / (len(order) - n)
+		shares[i] = min(sizes[i], share)
+		total -= shares[i]
+	}
+	return shares
+}
+
+// trimToTokens shortens text to about limit tokens, keeping whole lines
+// from its start and end around a note of how many lines were omitted.
+// Text whose first line alone is over the limit is cut off instead.
+func trimToTokens(text string, limit int) string {
+	lines := strings.Split(text, "\n")
+	room := limit - pricing.EstimateTokens(fmt.Sprintf("\n...[%d lines omitted]...\n", len(lines)))
+
+	// Two thirds of the room for the start, which usually declares what the
+	// code is, and the rest for the end
+	var head, tail []string
+	used := 0
+	for _, line := range lines {
+		tokens := pricing.EstimateTokens(line + "\n")
+		if used+tokens > room*2/3 {
+			break
+		}
+		head = append(head, line)
+		used += tokens
+	}
+	if len(head) == 0 {
+		cut := max(room, 0) * 4
+		return text[:min(cut, len(text))] + "\n...[truncated]..."
+	}
+	for i := len(lines) - 1; i >= len(head); i-- {
+		tokens := pricing.EstimateTokens(lines[i] + "\n")
+		if used+tokens > room {
+			break
+		}
+		tail = append([]string{lines[i]}, tail...)
+		used += tokens
+	}
+
+	omitted := len(lines) - len(head) - len(tail)
+	if omitted == 0 {
+		return text
+	}
+	return strings.Join(head, "\n") + fmt.Sprintf("\n...[%d lines omitted]...\n", omitted) + strings.Join(tail, "\n")
+}
@@ -0,0 +1,236 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/anthropic"
+	"github.com/exolottl/codie/internal/apikeys"
+	"github.com/exolottl/codie/internal/bedrock"
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/metrics"
+	"github.com/exolottl/codie/internal/mock"
+	"github.com/exolottl/codie/internal/pricing"
+	"github.com/exolottl/codie/internal/retry"
+	"github.com/exolottl/codie/internal/tracing"
+	"github.com/exolottl/codie/internal/usage"
+	"github.com/exolottl/codie/internal/vertex"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ChatProvider generates chat completions with one provider's API.
+// Implementations are registered by name with RegisterChatProvider.
+type ChatProvider interface {
+	Complete(ctx context.Context, request ChatRequest) (ChatReply, error)
+}
+
+// ChatRequest is a single-turn chat completion request
+type ChatRequest struct {
+	Model        string
+	SystemPrompt string
+	Prompt       string
+	MaxTokens    int
+	Temperature  float32
+}
+
+// ChatReply is the reply to a ChatRequest and the tokens it used
+type ChatReply struct {
+	Text             string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Provider is the name of the ChatProvider chat requests go to
+var Provider = "openai"
+
+// ChatModel is the model used for summaries
+var ChatModel = "gpt-4o"
+
+// RerankModel is the cheaper model used to rerank search results
+var RerankModel = "gpt-4o-mini"
+
+// Fallback is a chat provider requests fail over to when the ones before it
+// reject their credentials or are rate limited, with the models it uses in
+// place of ChatModel and RerankModel
+type Fallback struct {
+	Provider    string
+	ChatModel   string
+	RerankModel string
+}
+
+// Fallbacks are tried in order after Provider
+var Fallbacks []Fallback
+
+// Overrides for every chat request; MaxTokens 0 and a negative Temperature
+// keep each caller's own default
+var (
+	MaxTokens   = 0
+	Temperature = float32(-1)
+)
+
+// Paces chat requests across goroutines, so independent prompts such as
+// directory summaries can be sent concurrently
+var (
+	chatLimiterMu sync.Mutex
+	chatLimiter   = embeddings.NewRateLimiter(0, 0, 4)
+)
+
+// SetChatRateLimit limits chat requests to requestsPerMinute a minute, when
+// positive, and maxConcurrent in flight
+func SetChatRateLimit(requestsPerMinute, maxConcurrent int) {
+	chatLimiterMu.Lock()
+	defer chatLimiterMu.Unlock()
+	chatLimiter = embeddings.NewRateLimiter(requestsPerMinute, 0, maxConcurrent)
+}
+
+// chatRateLimiter returns the limiter chat requests wait for
+func chatRateLimiter() *embeddings.RateLimiter {
+	chatLimiterMu.Lock()
+	defer chatLimiterMu.Unlock()
+	return chatLimiter
+}
+
+var (
+	chatProvidersMu sync.RWMutex
+	chatProviders   = map[string]ChatProvider{
+		"openai":    openaiChat{},
+		"anthropic": generateFunc(anthropic.Generate),
+		"vertex":    generateFunc(vertex.Generate),
+		"bedrock":   generateFunc(bedrock.Generate),
+		"mock":      generateFunc(mock.Generate),
+	}
+)
+
+// RegisterChatProvider makes a chat provider selectable by name, replacing
+// any provider registered under it
+func RegisterChatProvider(name string, provider ChatProvider) {
+	chatProvidersMu.Lock()
+	defer chatProvidersMu.Unlock()
+	chatProviders[name] = provider
+}
+
+// ChatProviders returns the names of the registered chat providers, sorted
+func ChatProviders() []string {
+	chatProvidersMu.RLock()
+	defer chatProvidersMu.RUnlock()
+	var names []string
+	for name := range chatProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generateFunc adapts a provider package's Generate function, which returns
+// the reply and the prompt and reply tokens, to a ChatProvider
+type generateFunc func(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (string, int, int, error)
+
+func (f generateFunc) Complete(ctx context.Context, request ChatRequest) (ChatReply, error) {
+	text, promptTokens, completionTokens, err := f(ctx, request.Model, request.SystemPrompt, request.Prompt, request.MaxTokens, request.Temperature)
+	return ChatReply{Text: text, PromptTokens: promptTokens, CompletionTokens: completionTokens}, err
+}
+
+// chatCompletion sends a system and user prompt to the chat provider and returns the reply
+func chatCompletion(ctx context.Context, systemPrompt, prompt string, maxTokens int, temperature float32) (string, error) {
+	return chatCompletionModel(ctx, ChatModel, systemPrompt, prompt, maxTokens, temperature)
+}
+
+// chatCompletionModel is chatCompletion with a model other than ChatModel
+func chatCompletionModel(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (string, error) {
+	reply, err := chatReply(ctx, model, systemPrompt, prompt, maxTokens, temperature)
+	return reply.Text, err
+}
+
+// chatReply is chatCompletionModel returning the tokens the reply took too
+func chatReply(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (reply ChatReply, err error) {
+	ctx, span := tracing.Start(ctx, "llm chat",
+		attribute.String("codie.provider", Provider),
+		attribute.String("codie.model", model),
+		attribute.Int("codie.prompt_chars", len(prompt)))
+	defer func() { tracing.End(span, err) }()
+
+	// Apply user overrides
+	if MaxTokens > 0 {
+		maxTokens = MaxTokens
+	}
+	if Temperature >= 0 {
+		temperature = Temperature
+	}
+
+	// Fallbacks take over the rerank model's role or the chat model's
+	rerank := model == RerankModel && model != ChatModel
+	candidates := []Fallback{{Provider: Provider, ChatModel: model, RerankModel: model}}
+	candidates = append(candidates, Fallbacks...)
+	for i, candidate := range candidates {
+		model := candidate.ChatModel
+		if rerank {
+			model = candidate.RerankModel
+		}
+
+		chatProvidersMu.RLock()
+		provider, ok := chatProviders[candidate.Provider]
+		chatProvidersMu.RUnlock()
+		if !ok {
+			return ChatReply{}, fmt.Errorf("unknown chat provider %q (registered: %s)", candidate.Provider, strings.Join(ChatProviders(), ", "))
+		}
+
+		// Transient errors and rate limits are retried before failing over,
+		// each attempt waiting its turn with the other chat requests
+		var result ChatReply
+		err = retry.Default.Do(ctx, func(int) error {
+			limiter := chatRateLimiter()
+			if err := limiter.Wait(ctx, pricing.EstimateTokens(systemPrompt+prompt)); err != nil {
+				return err
+			}
+			defer limiter.Release()
+
+			start := time.Now()
+			var attemptErr error
+			result, attemptErr = provider.Complete(ctx, ChatRequest{
+				Model:        model,
+				SystemPrompt: systemPrompt,
+				Prompt:       prompt,
+				MaxTokens:    maxTokens,
+				Temperature:  temperature,
+			})
+			metrics.ObserveAPIRequest("chat", model, start, attemptErr)
+			usage.Record(model, result.PromptTokens, result.CompletionTokens)
+			return attemptErr
+		})
+
+		span.SetAttributes(
+			attribute.Int("codie.prompt_tokens", result.PromptTokens),
+			attribute.Int("codie.completion_tokens", result.CompletionTokens))
+		if err == nil {
+			if i > 0 {
+				span.SetAttributes(attribute.String("codie.fallback_provider", candidate.Provider))
+			}
+			return result, nil
+		}
+		if i == len(candidates)-1 || (!apikeys.IsAuthError(err) && !apikeys.IsRateLimit(err)) || ctx.Err() != nil {
+			break
+		}
+		slog.Warn("Chat provider failed, failing over", "provider", candidate.Provider, "next", candidates[i+1].Provider, "error", err)
+	}
+	return ChatReply{}, err
+}
+
+// stripCodeFence returns a reply without the code fence models sometimes wrap
+// JSON or other requested text in, such as ```json ... ```, and without the
+// space around it
+func stripCodeFence(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if rest, ok := strings.CutPrefix(reply, "```"); ok {
+		// Drop the language tag on the fence's line, if any
+		if tag, body, found := strings.Cut(rest, "\n"); found && !strings.ContainsAny(tag, "{[ ") {
+			rest = body
+		}
+		reply = strings.TrimSuffix(strings.TrimSpace(rest), "```")
+	}
+	return strings.TrimSpace(reply)
+}
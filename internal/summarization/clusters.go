@@ -0,0 +1,120 @@
+package summarization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/diagram"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// LabelClusters asks the model to group the packages of a dependency graph
+// into named architectural clusters, such as "CLI" or "Storage". Packages the
+// model doesn't place are left unclustered.
+func LabelClusters(graph diagram.Graph) (map[string][]string, error) {
+	var sb strings.Builder
+	sb.WriteString("Group the packages of this codebase into a small number (2-8) of architectural clusters ")
+	sb.WriteString("with short descriptive names such as \"CLI\", \"Storage\", or \"Domain model\". ")
+	sb.WriteString("Put every package in exactly one cluster. ")
+	sb.WriteString("Reply with only a JSON object mapping each cluster name to an array of package paths, ")
+	sb.WriteString("using the package paths exactly as listed.\n")
+
+	sb.WriteString("\nPackages:\n")
+	for _, node := range graph.Nodes {
+		sb.WriteString("- " + node + "\n")
+	}
+
+	sb.WriteString("\nDependencies (importer -> imported):\n")
+	for _, edge := range graph.Edges {
+		sb.WriteString(fmt.Sprintf("- %s -> %s\n", edge.From, edge.To))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	reply, err := chatCompletion(ctx, summarySystemPrompt, sb.String(), 1000, 0.1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to label clusters: %v", err)
+	}
+
+	reply = stripCodeFence(reply)
+
+	var clusters map[string][]string
+	if err := json.Unmarshal([]byte(reply), &clusters); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster labels: %v", err)
+	}
+
+	// Drop packages the model invented
+	known := make(map[string]bool)
+	for _, node := range graph.Nodes {
+		known[node] = true
+	}
+	for name, nodes := range clusters {
+		var valid []string
+		for _, node := range nodes {
+			if known[node] {
+				valid = append(valid, node)
+			}
+		}
+		if len(valid) == 0 {
+			delete(clusters, name)
+		} else {
+			clusters[name] = valid
+		}
+	}
+
+	return clusters, nil
+}
+
+// TopicLabel names a cluster of similar code
+type TopicLabel struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Characters of each representative chunk shown when labeling topics
+const topicExcerptChars = 500
+
+// LabelTopics asks the model to name each cluster of chunks from a few of
+// its most representative chunks. Clusters the model doesn't label get an
+// empty label.
+func LabelTopics(ctx context.Context, samples [][]storage.CodeChunk) ([]TopicLabel, error) {
+	var sb strings.Builder
+	sb.WriteString("Each numbered cluster below groups semantically similar code from one codebase, shown by a few representative excerpts. ")
+	sb.WriteString("Give each cluster a short name for the functional area it covers, such as \"Authentication\" or \"Index storage\", ")
+	sb.WriteString("and a one-sentence description. Use distinct names. ")
+	sb.WriteString("Reply with only a JSON array with one {\"name\": ..., \"description\": ...} object per cluster, in cluster order.\n")
+
+	for i, chunks := range samples {
+		sb.WriteString(fmt.Sprintf("\n## Cluster %d\n", i+1))
+		for _, chunk := range chunks {
+			content := chunk.Content
+			if len(content) > topicExcerptChars {
+				content = content[:topicExcerptChars] + "\n..."
+			}
+			sb.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", chunk.File, content))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	reply, err := chatCompletion(ctx, summarySystemPrompt, sb.String(), 200+80*len(samples), 0.2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to label topics: %v", err)
+	}
+
+	reply = stripCodeFence(reply)
+
+	var labels []TopicLabel
+	if err := json.Unmarshal([]byte(reply), &labels); err != nil {
+		return nil, fmt.Errorf("failed to parse topic labels: %v", err)
+	}
+	for len(labels) < len(samples) {
+		labels = append(labels, TopicLabel{})
+	}
+	return labels[:len(samples)], nil
+}
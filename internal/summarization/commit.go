@@ -0,0 +1,123 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Maximum number of commit subjects listed in a changelog prompt
+const changelogMaxCommits = 300
+
+// Conventional commit types a commit message may use
+var commitTypes = []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"}
+
+// GenerateCommitMessage proposes a conventional commit message for staged
+// changes. The message is plain text, ready for git commit -F.
+func GenerateCommitMessage(ctx context.Context, input DiffSummaryInput, options SummaryOptions) (string, error) {
+	if len(input.Changes) == 0 {
+		return "", fmt.Errorf("no staged changes")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	message, err := chatCompletion(ctx, summarySystemPrompt, buildCommitMessagePrompt(input, options), 800, 0.2)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate commit message: %v", err)
+	}
+
+	return stripCodeFence(message) + "\n", nil
+}
+
+// buildCommitMessagePrompt creates the prompt for a commit message
+func buildCommitMessagePrompt(input DiffSummaryInput, options SummaryOptions) string {
+	var sb strings.Builder
+	sb.WriteString("You are writing the commit message for the staged changes below, in the Conventional Commits format:\n\n")
+	sb.WriteString("<type>(<scope>): <subject>\n\n<body>\n\n<footer>\n\n")
+	sb.WriteString("- type is one of " + strings.Join(commitTypes, ", ") + "\n")
+	sb.WriteString("- scope is the main package, module, or component changed; leave it out, with its parentheses, when the change is broad\n")
+	sb.WriteString("- subject is imperative, lowercase, without a trailing period, and keeps the first line under 72 characters\n")
+	sb.WriteString("- body explains what changed and why, not how, wrapped at 72 characters\n")
+	sb.WriteString("- footer has a BREAKING CHANGE: paragraph if the change breaks callers, configuration, or stored data, and is left out otherwise\n")
+	if options.DetailLevel == DetailBrief {
+		sb.WriteString("Keep it to the first line unless the reason for the change isn't obvious from it.\n")
+	}
+	sb.WriteString("Base the message on the diff only. Reply with only the commit message, without quotes or a code fence.")
+
+	writeDiffContext(&sb, input, options, 0)
+	return sb.String()
+}
+
+// GenerateChangelog drafts release notes for the commits and changes since
+// a revision, grouped by the area of the codebase they touch
+func GenerateChangelog(ctx context.Context, input DiffSummaryInput, options SummaryOptions) (string, error) {
+	if len(input.Commits) == 0 && len(input.Changes) == 0 {
+		return "", fmt.Errorf("no changes since %s", input.From)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	changelog, err := chatCompletion(ctx, summarySystemPrompt, buildChangelogPrompt(input, options), 3000, 0.2)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate changelog: %v", err)
+	}
+	return changelog, nil
+}
+
+// changeArea returns the area of the codebase a changed file belongs to: its
+// directory, up to two levels deep
+func changeArea(path string) string {
+	dir := filepath.ToSlash(filepath.Dir(path))
+	if dir == "." {
+		return "(root)"
+	}
+	if parts := strings.SplitN(dir, "/", 3); len(parts) > 2 {
+		dir = parts[0] + "/" + parts[1]
+	}
+	return dir
+}
+
+// buildChangelogPrompt creates the prompt for release notes
+func buildChangelogPrompt(input DiffSummaryInput, options SummaryOptions) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("You are drafting the release notes for the changes from %s to %s of a codebase. ", input.From, input.To))
+	sb.WriteString("Write them for the project's users: what is new, what changed, what was fixed, and what they must do to upgrade. ")
+	sb.WriteString("Leave out internal refactoring, tests, and CI changes unless they affect users. ")
+	sb.WriteString("Base every entry on the commits and diff below.")
+
+	// Lines changed per area, largest first, as the headings to group under
+	lines := make(map[string]int)
+	for _, change := range input.Changes {
+		lines[changeArea(change.Path)] += change.Additions + change.Deletions
+	}
+	areas := make([]string, 0, len(lines))
+	for area := range lines {
+		areas = append(areas, area)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		if lines[areas[i]] != lines[areas[j]] {
+			return lines[areas[i]] > lines[areas[j]]
+		}
+		return areas[i] < areas[j]
+	})
+	sb.WriteString("\n\nAreas changed, by lines changed:\n")
+	for _, area := range areas {
+		sb.WriteString(fmt.Sprintf("- %s (%d lines)\n", area, lines[area]))
+	}
+
+	writeDiffContext(&sb, input, options, changelogMaxCommits)
+
+	sb.WriteString("\n\nFormat the release notes in markdown:\n")
+	sb.WriteString("1. Highlights - the two or three most important changes, in a sentence each\n")
+	sb.WriteString("2. One section per area, named for what the area does rather than its path, with bullets marked Added, Changed, Fixed, or Removed\n")
+	sb.WriteString("3. Breaking Changes - what breaks and how to migrate, or \"None\"\n")
+	if options.DetailLevel == DetailBrief {
+		sb.WriteString("Keep each area to its three most important entries.\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,220 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// DebtItem is a marker of technical debt: a TODO, FIXME, HACK, or XXX
+// comment, or a use of a deprecated API
+type DebtItem struct {
+	Kind   string `json:"kind"` // "TODO", "FIXME", "HACK", "XXX", or "deprecated"
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Text   string `json:"text"`             // The comment after the marker, or what to use instead of the API
+	Owner  string `json:"owner,omitempty"`  // Named in the marker, as in TODO(name), or found by git blame
+	Symbol string `json:"symbol,omitempty"` // Deprecated API or function used
+}
+
+// Debt markers in comments, with an optional owner in parentheses
+var debtMarker = regexp.MustCompile(`\b(TODO|FIXME|HACK|XXX)\b(?:\(([^)]*)\))?[:\s-]*(.*)`)
+
+// Tokens that start a comment, or a line of a block comment, in the indexed
+// languages
+var commentTokens = []string{"//", "#", "/*", "*", "<!--", "--"}
+
+// deprecatedAPI is a standard library or framework API that has been
+// deprecated, with what replaces it
+type deprecatedAPI struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Deprecated APIs by language, as detected by embeddings.DetectLanguage
+var deprecatedAPIs = map[string][]deprecatedAPI{
+	"go": {
+		{regexp.MustCompile(`\bioutil\.\w+`), "the equivalent functions in io and os"},
+		{regexp.MustCompile(`\bstrings\.Title\(`), "golang.org/x/text/cases"},
+		{regexp.MustCompile(`\brand\.Seed\(`), "rand.New(rand.NewSource(seed)), or the automatically seeded global source"},
+		{regexp.MustCompile(`\breflect\.(SliceHeader|StringHeader)\b`), "unsafe.Slice and unsafe.String"},
+		{regexp.MustCompile(`\bx509\.(IsEncryptedPEMBlock|DecryptPEMBlock|EncryptPEMBlock)\(`), "a modern key encryption format"},
+	},
+	"python": {
+		{regexp.MustCompile(`\bdatetime\.utcnow\(`), "datetime.now(timezone.utc)"},
+		{regexp.MustCompile(`\bdatetime\.utcfromtimestamp\(`), "datetime.fromtimestamp(ts, timezone.utc)"},
+		{regexp.MustCompile(`^\s*(import\s+imp\b|from\s+imp\s+import)`), "importlib"},
+		{regexp.MustCompile(`\bdistutils\b`), "setuptools"},
+		{regexp.MustCompile(`\basyncio\.get_event_loop\(`), "asyncio.run or asyncio.get_running_loop"},
+		{regexp.MustCompile(`\bassertEquals\(`), "assertEqual"},
+		{regexp.MustCompile(`\blog(ging|ger)?\.warn\(`), "warning"},
+	},
+	"javascript": jsDeprecatedAPIs,
+	"typescript": jsDeprecatedAPIs,
+	"java": {
+		{regexp.MustCompile(`\bnew (Integer|Long|Short|Byte|Double|Float|Boolean|Character)\(`), "valueOf"},
+		{regexp.MustCompile(`\bRuntime\.runFinalization\(|\bprotected void finalize\(`), "Cleaner or try-with-resources"},
+	},
+	"csharp": {
+		{regexp.MustCompile(`\bWebClient\b|\bHttpWebRequest\b`), "HttpClient"},
+		{regexp.MustCompile(`\bBinaryFormatter\b`), "System.Text.Json or another safe serializer"},
+		{regexp.MustCompile(`\bThread\.Abort\(`), "CancellationToken"},
+	},
+}
+
+// Deprecated JavaScript and TypeScript APIs
+var jsDeprecatedAPIs = []deprecatedAPI{
+	{regexp.MustCompile(`\bnew Buffer\(`), "Buffer.from or Buffer.alloc"},
+	{regexp.MustCompile(`\.substr\(`), "slice or substring"},
+	{regexp.MustCompile(`\b(un)?escape\(`), "encodeURIComponent and decodeURIComponent"},
+	{regexp.MustCompile(`\burl\.parse\(`), "new URL()"},
+	{regexp.MustCompile(`\bcomponentWill(Mount|ReceiveProps|Update)\b`), "hooks, or componentDidMount and getDerivedStateFromProps"},
+	{regexp.MustCompile(`\bReactDOM\.render\(`), "createRoot"},
+}
+
+// Deprecation notices on the indexed code's own functions: Go's
+// "Deprecated:" paragraph, JSDoc's @deprecated, Java's @Deprecated, and C#'s
+// [Obsolete]
+var deprecationNotice = regexp.MustCompile(`(?m)^\s*(//\s*Deprecated:|(/\*\*|\*|//).*@deprecated\b|@Deprecated\b|\[Obsolete\b)`)
+
+// Maximum debt items listed in a remediation plan prompt
+const debtPlanMaxItems = 300
+
+// FindDebt scans chunks for debt markers in comments, uses of deprecated
+// standard library and framework APIs, and calls to functions of the index
+// marked deprecated. Items are ordered by file and line.
+func FindDebt(chunks []storage.CodeChunk) []DebtItem {
+	seen := make(map[string]bool) // Chunks can overlap
+	var items []DebtItem
+	add := func(item DebtItem) {
+		key := fmt.Sprintf("%s:%d:%s:%s", item.File, item.Line, item.Kind, item.Symbol)
+		if !seen[key] {
+			seen[key] = true
+			items = append(items, item)
+		}
+	}
+
+	// Functions whose declaration carries a deprecation notice
+	deprecated := make(map[string]storage.CodeChunk)
+	for _, chunk := range chunks {
+		if chunk.Function != "" && deprecationNotice.MatchString(chunk.Content) {
+			deprecated[chunk.Function] = chunk
+		}
+	}
+
+	for _, chunk := range chunks {
+		apis := deprecatedAPIs[embeddings.DetectLanguage(chunk.File)]
+		lines := strings.Split(chunk.Content, "\n")
+		for i, line := range lines {
+			if match := debtMarker.FindStringSubmatchIndex(line); match != nil && isComment(line[:match[0]]) {
+				owner := ""
+				if match[4] >= 0 {
+					owner = strings.TrimSpace(line[match[4]:match[5]])
+				}
+				text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line[match[6]:match[7]]), "*/"))
+				add(DebtItem{Kind: line[match[2]:match[3]], File: chunk.File, Line: chunk.StartLine + i, Text: text, Owner: owner})
+			}
+			for _, api := range apis {
+				if found := api.pattern.FindString(line); found != "" {
+					add(DebtItem{Kind: "deprecated", File: chunk.File, Line: chunk.StartLine + i,
+						Text: "Use " + api.replacement, Symbol: strings.TrimSuffix(strings.TrimSpace(found), "(")})
+				}
+			}
+		}
+
+		for _, name := range chunk.CalledFunctions() {
+			target, ok := deprecated[name]
+			if !ok || (target.File == chunk.File && target.Function == chunk.Function) {
+				continue
+			}
+			// The first line calling it, else the start of the chunk
+			line := chunk.StartLine
+			for i, text := range lines {
+				if strings.Contains(text, name+"(") {
+					line = chunk.StartLine + i
+					break
+				}
+			}
+			add(DebtItem{Kind: "deprecated", File: chunk.File, Line: line,
+				Text: fmt.Sprintf("Calls %s, marked deprecated in %s:%d", name, filepath.Base(target.File), target.StartLine), Symbol: name})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].File != items[j].File {
+			return items[i].File < items[j].File
+		}
+		return items[i].Line < items[j].Line
+	})
+	return items
+}
+
+// isComment reports whether the text before a marker on its line ends by
+// opening a comment, or continuing a block comment, so that the marker
+// starts it. Markers mentioned in the middle of a comment aren't debt.
+func isComment(prefix string) bool {
+	prefix = strings.TrimRight(prefix, " \t")
+	for _, token := range commentTokens {
+		if strings.HasSuffix(prefix, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateDebtPlan asks the model to prioritize debt items into a
+// remediation plan. File paths in items should be relative to the repository.
+func GenerateDebtPlan(ctx context.Context, items []DebtItem, options SummaryOptions) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	plan, err := chatCompletion(ctx, summarySystemPrompt, buildDebtPlanPrompt(items, options), 3000, 0.2)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate remediation plan: %v", err)
+	}
+	return plan, nil
+}
+
+// buildDebtPlanPrompt lists the debt items and asks for a prioritized plan
+func buildDebtPlanPrompt(items []DebtItem, options SummaryOptions) string {
+	var sb strings.Builder
+	sb.WriteString("Below are the technical debt markers found in a codebase: TODO, FIXME, HACK, and XXX comments, ")
+	sb.WriteString("and uses of deprecated APIs. Prioritize them into a remediation plan.\n\n")
+
+	sb.WriteString("Group related items into workstreams. For each workstream give:\n")
+	sb.WriteString("- A priority (P0 for correctness or security risks and deprecated APIs close to removal, down to P3 for cosmetic cleanups)\n")
+	sb.WriteString("- A rough effort (small, medium, or large)\n")
+	sb.WriteString("- The items it covers, by file and line\n")
+	sb.WriteString("- What to do, in one or two sentences\n")
+	sb.WriteString("Order workstreams by priority, then by how much they unblock. Finish with quick wins that take under an hour.\n")
+	if options.DetailLevel == DetailBrief {
+		sb.WriteString("Keep the plan short: at most five workstreams.\n")
+	}
+
+	sb.WriteString("\nDebt items:\n")
+	for i, item := range items {
+		if i == debtPlanMaxItems {
+			sb.WriteString(fmt.Sprintf("...and %d more\n", len(items)-debtPlanMaxItems))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("- %s %s:%d", item.Kind, item.File, item.Line))
+		if item.Symbol != "" {
+			sb.WriteString(" `" + item.Symbol + "`")
+		}
+		if item.Text != "" {
+			sb.WriteString(" - " + item.Text)
+		}
+		if item.Owner != "" {
+			sb.WriteString(" (owner: " + item.Owner + ")")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
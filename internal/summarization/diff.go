@@ -0,0 +1,223 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Maximum characters of all patches included in a diff summary prompt
+const diffMaxPatchChars = 60000
+
+// Maximum characters of a single file's patch
+const diffMaxFilePatchChars = 8000
+
+// Maximum number of commit subjects listed in a diff summary prompt
+const diffMaxCommits = 50
+
+// DiffSummaryInput is the material for summarizing the changes between two revisions
+type DiffSummaryInput struct {
+	From    string // Older revision
+	To      string // Newer revision
+	Commits []string
+	Changes []gitdiff.FileChange
+	// Embedded chunks of the changed files at the newer revision, with File
+	// set to the path relative to the repository root
+	ChangedChunks []storage.CodeChunk
+	// Indexed chunks of unchanged files, searched for code related to the change
+	Context []storage.CodeChunk
+}
+
+// relatedChunksLimit returns how many unchanged chunks to include for a detail level
+func relatedChunksLimit(detailLevel DetailLevel) int {
+	switch detailLevel {
+	case DetailBrief:
+		return 3
+	case DetailComprehensive:
+		return 10
+	default:
+		return 6
+	}
+}
+
+// GenerateDiffSummary creates a change-focused summary of a diff, suitable
+// for a pull request description or release notes
+func GenerateDiffSummary(ctx context.Context, input DiffSummaryInput, options SummaryOptions) (string, error) {
+	if len(input.Changes) == 0 {
+		return "", fmt.Errorf("no changes between %s and %s", input.From, input.To)
+	}
+
+	prompt := buildDiffSummaryPrompt(input, options)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	summary, err := chatCompletion(ctx, summarySystemPrompt, prompt, 3000, 0.2)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate summary: %v", err)
+	}
+
+	return summary, nil
+}
+
+// touchedChunks returns the changed chunks that overlap a hunk of their file's patch
+func touchedChunks(input DiffSummaryInput) []storage.CodeChunk {
+	hunks := make(map[string][][2]int)
+	for _, change := range input.Changes {
+		hunks[change.Path] = gitdiff.ChangedLines(change.Patch)
+	}
+
+	var touched []storage.CodeChunk
+	for _, chunk := range input.ChangedChunks {
+		for _, hunk := range hunks[chunk.File] {
+			if chunk.StartLine <= hunk[1] && chunk.EndLine >= hunk[0] {
+				touched = append(touched, chunk)
+				break
+			}
+		}
+	}
+	return touched
+}
+
+// relatedContext finds the unchanged chunks most similar to the touched code
+func relatedContext(touched, candidates []storage.CodeChunk, limit int) []search.Result {
+	best := make(map[string]search.Result)
+	for _, chunk := range touched {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+		for _, result := range search.Search(candidates, chunk.Embedding, 2) {
+			key := fmt.Sprintf("%s:%d", result.Chunk.File, result.Chunk.StartLine)
+			if existing, ok := best[key]; !ok || result.Score > existing.Score {
+				best[key] = result
+			}
+		}
+	}
+
+	var results []search.Result
+	for _, result := range best {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// buildDiffSummaryPrompt creates the prompt for a change-focused summary
+func buildDiffSummaryPrompt(input DiffSummaryInput, options SummaryOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("You are summarizing the changes between revisions %s and %s of a codebase ", input.From, input.To))
+	sb.WriteString("for a pull request description and release notes. ")
+	sb.WriteString("Explain what changed and why it matters, not line-by-line edits. ")
+	sb.WriteString("Base every statement on the diff below, and cite files when useful.")
+
+	writeDiffContext(&sb, input, options, diffMaxCommits)
+
+	sb.WriteString("\n\nWrite the summary with these sections:\n")
+	sb.WriteString("1. Summary - what this change does and why, in a few sentences\n")
+	sb.WriteString("2. Changes - the notable changes grouped by area\n")
+	sb.WriteString("3. Impact and Risks - breaking changes, migrations, configuration changes, and code likely to be affected\n")
+	sb.WriteString("4. Release Notes - short user-facing bullet points, or \"No user-facing changes\"\n")
+
+	return sb.String()
+}
+
+// writeDiffContext writes the commits, changed files and functions, patches,
+// and related unchanged code of a diff to a prompt, listing at most
+// maxCommits commit subjects
+func writeDiffContext(sb *strings.Builder, input DiffSummaryInput, options SummaryOptions, maxCommits int) {
+	if len(input.Commits) > 0 {
+		sb.WriteString("\n\nCommits:\n")
+		for i, subject := range input.Commits {
+			if i == maxCommits {
+				sb.WriteString(fmt.Sprintf("- ... and %d more\n", len(input.Commits)-i))
+				break
+			}
+			sb.WriteString("- " + subject + "\n")
+		}
+	}
+
+	additions, deletions := 0, 0
+	sb.WriteString("\n\nChanged files:\n")
+	for _, change := range input.Changes {
+		additions += change.Additions
+		deletions += change.Deletions
+
+		path := change.Path
+		if change.OldPath != "" {
+			path = change.OldPath + " -> " + change.Path
+		}
+		if change.Binary {
+			sb.WriteString(fmt.Sprintf("- %s (%s, binary)\n", path, change.Status))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("- %s (%s, +%d -%d)\n", path, change.Status, change.Additions, change.Deletions))
+	}
+	sb.WriteString(fmt.Sprintf("Total: %d files, +%d -%d lines\n", len(input.Changes), additions, deletions))
+
+	touched := touchedChunks(input)
+	if len(touched) > 0 {
+		sb.WriteString("\n\nChanged functions and types:\n")
+		for _, chunk := range touched {
+			name := chunk.Function
+			if chunk.Class != "" && name != "" {
+				name = chunk.Class + "." + name
+			} else if name == "" {
+				name = chunk.Class
+			}
+			if name == "" {
+				name = "(top-level code)"
+			}
+			sb.WriteString(fmt.Sprintf("- %s:%d-%d %s\n", chunk.File, chunk.StartLine, chunk.EndLine, name))
+		}
+	}
+
+	// Largest changes first, so the patch budget goes to the most significant ones
+	changes := append([]gitdiff.FileChange(nil), input.Changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Additions+changes[i].Deletions > changes[j].Additions+changes[j].Deletions
+	})
+
+	sb.WriteString("\n\nDiff:\n")
+	written := 0
+	for i, change := range changes {
+		if change.Binary || change.Patch == "" {
+			continue
+		}
+		patch := change.Patch
+		if len(patch) > diffMaxFilePatchChars {
+			patch = patch[:diffMaxFilePatchChars] + "\n...[patch truncated]..."
+		}
+		if written+len(patch) > diffMaxPatchChars {
+			sb.WriteString(fmt.Sprintf("\n...[patches of %d more files omitted]...\n", len(changes)-i))
+			break
+		}
+		sb.WriteString("\n" + patch)
+		written += len(patch)
+	}
+
+	// Unchanged code most similar to the change, which shows what it affects
+	if related := relatedContext(touched, input.Context, relatedChunksLimit(options.DetailLevel)); len(related) > 0 {
+		sb.WriteString("\n\nRelated unchanged code (may be affected by the change):\n")
+		for _, result := range related {
+			chunk := result.Chunk
+			content := chunk.Content
+			if len(content) > retrievedChunkMaxChars {
+				content = content[:retrievedChunkMaxChars] + "\n...[truncated]..."
+			}
+			sb.WriteString(fmt.Sprintf("\n--- %s:%d-%d (similarity %.2f) ---\n%s\n",
+				chunk.File, chunk.StartLine, chunk.EndLine, result.Score, content))
+		}
+	}
+}
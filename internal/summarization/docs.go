@@ -0,0 +1,169 @@
+package summarization
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/quality"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Maximum undocumented declarations listed per package in a docs prompt
+const docsMaxUndocumented = 15
+
+// Maximum characters of a single undocumented function included in a docs prompt
+const docsFunctionMaxChars = 1500
+
+// docsPackages returns how many packages to highlight for a detail level
+func docsPackages(detailLevel DetailLevel) int {
+	switch detailLevel {
+	case DetailBrief:
+		return 5
+	case DetailComprehensive:
+		return 15
+	default:
+		return 8
+	}
+}
+
+// docsGap is a package ranked by how much its missing documentation matters
+type docsGap struct {
+	docs         quality.PackageDocs
+	importance   float64 // Sum of its files' importance
+	undocumented []quality.Function
+	types        []quality.Type
+}
+
+// findDocsGaps ranks packages by their importance weighted by the fraction
+// of their functions and types without documentation, highest first
+func findDocsGaps(report quality.Report, fileImportance map[string]float64, options SummaryOptions) []docsGap {
+	importance := make(map[string]float64)
+	for file, score := range fileImportance {
+		importance[filepath.Dir(file)] += score
+	}
+
+	gaps := make(map[string]*docsGap)
+	for _, docs := range report.Documentation {
+		if docs.Documented == docs.Declarations {
+			continue
+		}
+		gaps[docs.Package] = &docsGap{docs: docs, importance: importance[docs.Package]}
+	}
+	for _, fn := range report.Functions {
+		if gap := gaps[filepath.Dir(fn.File)]; gap != nil && !fn.Documented {
+			gap.undocumented = append(gap.undocumented, fn)
+		}
+	}
+	for _, t := range report.Types {
+		if gap := gaps[filepath.Dir(t.File)]; gap != nil && !t.Documented {
+			gap.types = append(gap.types, t)
+		}
+	}
+
+	ranked := make([]docsGap, 0, len(gaps))
+	for _, gap := range gaps {
+		ranked = append(ranked, *gap)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a := ranked[i].importance * (1 - ranked[i].docs.Coverage)
+		b := ranked[j].importance * (1 - ranked[j].docs.Coverage)
+		if a != b {
+			return a > b
+		}
+		return ranked[i].docs.Package < ranked[j].docs.Package
+	})
+	if limit := docsPackages(options.DetailLevel); len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// buildDocsPrompt creates the prompt for a documentation coverage report that
+// highlights the least documented of the most important packages
+func buildDocsPrompt(chunks []storage.CodeChunk, repoStructure []FileStructure, fileImportance map[string]float64, options SummaryOptions) string {
+	root := storage.RootDir(chunks)
+	report := quality.Analyze(chunks)
+	gaps := findDocsGaps(report, fileImportance, options)
+	rel := func(path string) string {
+		if r, err := filepath.Rel(root, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return path
+	}
+
+	byFile := make(map[string][]storage.CodeChunk)
+	for _, chunk := range chunks {
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("You are reviewing the documentation of a codebase: which functions, methods, and types have doc comments or docstrings. ")
+	sb.WriteString("Write a documentation coverage report that tells the maintainers where missing documentation hurts most ")
+	sb.WriteString("and what to write first. Packages below are ranked by their importance in the codebase weighted by how much of them is undocumented.\n\n")
+
+	sb.WriteString("Codebase Context:\n")
+	sb.WriteString("- Primary Languages: " + getMainLanguages(repoStructure) + "\n")
+	sb.WriteString(fmt.Sprintf("- Total Files: %d\n", len(repoStructure)))
+	sb.WriteString(fmt.Sprintf("- Functions and types: %d, of which %.0f%% are documented\n",
+		len(report.Functions)+len(report.Types), report.DocumentationCoverage()*100))
+
+	sb.WriteString("\nCoverage by package, least documented first:\n")
+	for _, docs := range report.Documentation {
+		sb.WriteString(fmt.Sprintf("- %s: %d of %d (%.0f%%)\n", rel(docs.Package), docs.Documented, docs.Declarations, docs.Coverage*100))
+	}
+
+	if len(gaps) == 0 {
+		sb.WriteString("\nEvery function and type found is documented.\n")
+	}
+	for _, gap := range gaps {
+		sb.WriteString(fmt.Sprintf("\n=== %s (coverage %.0f%%, importance %.2f) ===\n",
+			rel(gap.docs.Package), gap.docs.Coverage*100, gap.importance))
+
+		sb.WriteString("Undocumented declarations:\n")
+		listed := 0
+		for _, t := range gap.types {
+			if listed == docsMaxUndocumented {
+				break
+			}
+			sb.WriteString(fmt.Sprintf("- type %s (%s:%d)\n", t.Name, rel(t.File), t.Line))
+			listed++
+		}
+		// Most complex functions first, as they most need explaining
+		for _, fn := range gap.undocumented {
+			if listed == docsMaxUndocumented {
+				break
+			}
+			sb.WriteString(fmt.Sprintf("- %s (%s:%d, complexity %d)\n", fn.Name, rel(fn.File), fn.StartLine, fn.Complexity))
+			listed++
+		}
+		if remaining := len(gap.types) + len(gap.undocumented) - listed; remaining > 0 {
+			sb.WriteString(fmt.Sprintf("- ...and %d more\n", remaining))
+		}
+
+		// The code of the most complex undocumented function, for suggested doc comments
+		if len(gap.undocumented) > 0 {
+			fn := gap.undocumented[0]
+			for _, chunk := range byFile[fn.File] {
+				if chunk.StartLine <= fn.StartLine && fn.StartLine <= chunk.EndLine {
+					content := chunk.Content
+					if len(content) > docsFunctionMaxChars {
+						content = content[:docsFunctionMaxChars] + "\n...[truncated]..."
+					}
+					sb.WriteString(fmt.Sprintf("\nCode of %s:\n%s\n", fn.Name, content))
+					break
+				}
+			}
+		}
+	}
+
+	sb.WriteString("\nPlease format the report with the following sections:\n")
+	sb.WriteString("1. Coverage Overview - Overall coverage and how it varies across the codebase\n")
+	sb.WriteString("2. Priority Gaps - For each highlighted package, why it matters and what is missing\n")
+	sb.WriteString("3. Suggested Doc Comments - Doc comments for the most important undocumented declarations, in the language's own convention\n")
+	sb.WriteString("4. Recommendations - Conventions or tooling to keep documentation from falling behind\n")
+	sb.WriteString("Reference declarations as file:line.\n")
+
+	return sb.String()
+}
@@ -0,0 +1,235 @@
+package summarization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Functions documented per request to the model
+const documentBatchSize = 20
+
+// Maximum characters of a single function included in a doc comment prompt
+const documentFunctionMaxChars = 3000
+
+// Maximum characters of the rest of the file included in a doc comment prompt
+const documentContextMaxChars = 8000
+
+// Maximum callers and callees listed for a function in a doc comment prompt
+const documentMaxRelated = 5
+
+// DocComment is a doc comment written for an undocumented function
+type DocComment struct {
+	Function embeddings.FunctionMetrics `json:"-"`
+	Name     string                     `json:"name"`
+	Line     int                        `json:"line"` // Where the function starts, before the comment is inserted
+	Text     string                     `json:"text"` // The comment's text, without comment markers
+}
+
+// GenerateDocComments asks the model for doc comments for the undocumented
+// functions of a file, giving it the file and, from indexed chunks, the
+// signatures of what each function calls and what calls it. Comments are
+// ordered by position.
+func GenerateDocComments(ctx context.Context, filePath, content string, indexed []storage.CodeChunk) ([]DocComment, error) {
+	metrics, err := embeddings.ExtractCodeMetrics(filePath, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filePath, err)
+	}
+
+	language := embeddings.DetectLanguage(filePath)
+	var undocumented []embeddings.FunctionMetrics
+	for _, fn := range metrics.Functions {
+		if fn.Documented || fn.Name == "<anonymous>" {
+			continue
+		}
+		// A docstring needs a body on its own lines
+		if language == "python" && fn.BodyLine <= fn.StartLine {
+			continue
+		}
+		undocumented = append(undocumented, fn)
+	}
+
+	lines := strings.Split(content, "\n")
+	var comments []DocComment
+	for start := 0; start < len(undocumented); start += documentBatchSize {
+		end := min(start+documentBatchSize, len(undocumented))
+		batch := undocumented[start:end]
+
+		prompt := buildDocCommentPrompt(filePath, language, content, lines, batch, indexed)
+		reqCtx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+		reply, err := chatCompletion(reqCtx, summarySystemPrompt, prompt, 4000, 0.2)
+		cancel()
+		if err != nil {
+			return comments, fmt.Errorf("failed to generate doc comments: %v", err)
+		}
+
+		reply = stripCodeFence(reply)
+
+		var texts map[string]string
+		if err := json.Unmarshal([]byte(reply), &texts); err != nil {
+			return comments, fmt.Errorf("failed to parse doc comments: %v", err)
+		}
+		for _, fn := range batch {
+			if text := strings.TrimSpace(texts[strconv.Itoa(fn.StartLine)]); text != "" {
+				comments = append(comments, DocComment{Function: fn, Name: fn.Name, Line: fn.StartLine, Text: text})
+			}
+		}
+	}
+	return comments, nil
+}
+
+// buildDocCommentPrompt creates the prompt for doc comments for a batch of
+// functions of a file
+func buildDocCommentPrompt(filePath, language, content string, lines []string,
+	batch []embeddings.FunctionMetrics, indexed []storage.CodeChunk) string {
+	var sb strings.Builder
+	sb.WriteString("Write a doc comment for each function below, following the documentation conventions of " + language + ". ")
+	sb.WriteString("Say what the function does and returns, and anything a caller must know: side effects, errors, and preconditions. ")
+	sb.WriteString("Be concise: one sentence for simple functions, a short paragraph at most for complex ones. ")
+	sb.WriteString("Don't describe the implementation line by line or restate parameter types.\n")
+	if language == "go" {
+		sb.WriteString("Start each comment with the function's name, as Go doc comments do.\n")
+	}
+	sb.WriteString("Reply with only a JSON object mapping each function's id to the text of its comment, ")
+	sb.WriteString("without comment markers such as //, /**, or quotes. Use \\n between lines of a longer comment.\n")
+
+	surrounding := content
+	if len(surrounding) > documentContextMaxChars {
+		surrounding = surrounding[:documentContextMaxChars] + "\n...[truncated]..."
+	}
+	sb.WriteString(fmt.Sprintf("\nFile %s:\n%s\n", filePath, surrounding))
+
+	// Index the chunks to find related functions
+	indexedPath, inIndex := findIndexedFile(indexed, filePath)
+	definitions := make(map[string]storage.CodeChunk)
+	for _, chunk := range indexed {
+		if chunk.Function != "" {
+			if _, ok := definitions[chunk.Function]; !ok {
+				definitions[chunk.Function] = chunk
+			}
+		}
+	}
+
+	for _, fn := range batch {
+		code := strings.Join(lines[fn.StartLine-1:min(fn.EndLine, len(lines))], "\n")
+		if len(code) > documentFunctionMaxChars {
+			code = code[:documentFunctionMaxChars] + "\n...[truncated]..."
+		}
+		sb.WriteString(fmt.Sprintf("\n--- id: %d (%s) ---\n%s\n", fn.StartLine, fn.Name, code))
+
+		if !inIndex {
+			continue
+		}
+		var callees, callers []string
+		for _, chunk := range indexed {
+			if chunk.File == indexedPath && chunk.Function == fn.Name {
+				for _, name := range chunk.CalledFunctions() {
+					if def, ok := definitions[name]; ok && name != fn.Name && len(callees) < documentMaxRelated {
+						callees = append(callees, chunkSignature(def.Content))
+					}
+				}
+				continue
+			}
+			for _, name := range chunk.CalledFunctions() {
+				if name == fn.Name && len(callers) < documentMaxRelated {
+					callers = append(callers, fmt.Sprintf("%s in %s", chunkSignature(chunk.Content), chunk.File))
+					break
+				}
+			}
+		}
+		if len(callees) > 0 {
+			sb.WriteString("Calls:\n- " + strings.Join(callees, "\n- ") + "\n")
+		}
+		if len(callers) > 0 {
+			sb.WriteString("Called by:\n- " + strings.Join(callers, "\n- ") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// ApplyDocComments returns content with doc comments inserted in the style
+// of the file's language: above each function, or for Python as a docstring
+// at the start of its body
+func ApplyDocComments(filePath, content string, comments []DocComment) string {
+	language := embeddings.DetectLanguage(filePath)
+	lines := strings.Split(content, "\n")
+
+	// Insert from the bottom up so earlier line numbers stay valid
+	sorted := append([]DocComment(nil), comments...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Function.StartLine > sorted[j].Function.StartLine
+	})
+
+	for _, comment := range sorted {
+		at := comment.Function.DeclLine
+		if at == 0 {
+			at = comment.Function.StartLine
+		}
+		if language == "python" {
+			// A docstring needs a body on its own lines
+			if comment.Function.BodyLine <= comment.Function.StartLine {
+				continue
+			}
+			at = comment.Function.BodyLine
+		}
+		if at < 1 || at > len(lines) {
+			continue
+		}
+		indent := leadingWhitespace(lines[at-1])
+		block := formatDocComment(language, indent, strings.Split(comment.Text, "\n"))
+		lines = append(lines[:at-1], append(block, lines[at-1:]...)...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatDocComment renders the lines of a comment in the doc comment syntax
+// of a language
+func formatDocComment(language, indent string, text []string) []string {
+	var block []string
+	prefixed := func(open, prefix, close string) {
+		if open != "" {
+			block = append(block, indent+open)
+		}
+		for _, line := range text {
+			block = append(block, strings.TrimRight(indent+prefix+strings.TrimSpace(line), " "))
+		}
+		if close != "" {
+			block = append(block, indent+close)
+		}
+	}
+
+	switch language {
+	case "python":
+		if len(text) == 1 {
+			return []string{indent + `"""` + strings.TrimSpace(text[0]) + `"""`}
+		}
+		prefixed(`"""`, "", `"""`)
+	case "javascript", "typescript", "java", "php", "kotlin", "swift":
+		prefixed("/**", " * ", " */")
+	case "csharp":
+		block = append(block, indent+"/// <summary>")
+		prefixed("", "/// ", "")
+		block = append(block, indent+"/// </summary>")
+	case "rust":
+		prefixed("", "/// ", "")
+	case "ruby":
+		prefixed("", "# ", "")
+	case "lua", "sql":
+		prefixed("", "-- ", "")
+	default:
+		prefixed("", "// ", "")
+	}
+	return block
+}
+
+// leadingWhitespace returns the indentation of a line
+func leadingWhitespace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
@@ -0,0 +1,183 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/imports"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Maximum characters of the target file included in a file summary prompt
+const fileSummaryMaxChars = 40000
+
+// Maximum number of dependency files outlined in a file summary prompt
+const fileSummaryMaxDependencies = 10
+
+// GenerateFileSummary creates a focused summary of a single indexed file,
+// using its chunks and an outline of the indexed files it imports
+func GenerateFileSummary(ctx context.Context, embeddingsPath, filePath string, options SummaryOptions) (string, error) {
+	options, err := options.Normalize()
+	if err != nil {
+		return "", err
+	}
+
+	chunks, err := storage.LoadFromJSON(embeddingsPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load embeddings: %v", err)
+	}
+
+	target, ok := findIndexedFile(chunks, filePath)
+	if !ok {
+		return "", fmt.Errorf("%s is not in the index; index its repository first", filePath)
+	}
+
+	// Group chunks by file, keeping each file's chunks in line order
+	byFile := make(map[string][]storage.CodeChunk)
+	for _, chunk := range chunks {
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+	for _, fileChunks := range byFile {
+		sort.SliceStable(fileChunks, func(i, j int) bool {
+			return fileChunks[i].StartLine < fileChunks[j].StartLine
+		})
+	}
+
+	dependencies := resolveDependencies(target, byFile)
+	prompt := buildFileSummaryPrompt(target, byFile[target], dependencies, byFile, options)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	summary, err := chatCompletion(ctx, summarySystemPrompt, prompt, 2500, 0.2)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate summary: %v", err)
+	}
+
+	return summary, nil
+}
+
+// findIndexedFile returns the indexed path that refers to filePath
+func findIndexedFile(chunks []storage.CodeChunk, filePath string) (string, bool) {
+	want := filepath.Clean(filePath)
+	wantAbs, _ := filepath.Abs(want)
+
+	for _, chunk := range chunks {
+		if filepath.Clean(chunk.File) == want {
+			return chunk.File, true
+		}
+		if abs, err := filepath.Abs(chunk.File); err == nil && abs == wantAbs {
+			return chunk.File, true
+		}
+	}
+	return "", false
+}
+
+// resolveDependencies maps the target file's imports to the other indexed
+// files they refer to, resolved by the rules of its language
+func resolveDependencies(target string, byFile map[string][]storage.CodeChunk) []string {
+	resolver := imports.NewResolver(byFile)
+
+	var deps []string
+	seen := map[string]bool{target: true}
+	for _, imp := range imports.ForFile(target, byFile[target]) {
+		for _, file := range resolver.Resolve(target, imp) {
+			if !seen[file] {
+				seen[file] = true
+				deps = append(deps, file)
+			}
+		}
+	}
+
+	if len(deps) > fileSummaryMaxDependencies {
+		deps = deps[:fileSummaryMaxDependencies]
+	}
+	return deps
+}
+
+// sortedFiles returns the indexed file paths in a stable order
+func sortedFiles(byFile map[string][]storage.CodeChunk) []string {
+	files := make([]string, 0, len(byFile))
+	for file := range byFile {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// chunkSignature returns the first line of code in a chunk, skipping comments
+func chunkSignature(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") ||
+			strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "*") {
+			continue
+		}
+		return trimmed
+	}
+	return ""
+}
+
+// buildFileSummaryPrompt creates the prompt for a single-file summary
+func buildFileSummaryPrompt(target string, chunks []storage.CodeChunk, dependencies []string,
+	byFile map[string][]storage.CodeChunk, options SummaryOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are explaining a single source file to a developer who needs to understand or change it. ")
+	sb.WriteString("Describe its purpose, its main types and functions and how they fit together, ")
+	sb.WriteString("how it uses the files it depends on, and anything non-obvious: invariants, error handling, ")
+	sb.WriteString("concurrency, and likely pitfalls when modifying it. Reference functions by name. ")
+
+	if options.DetailLevel == DetailComprehensive {
+		sb.WriteString("Walk through each significant function and its control flow.")
+	} else if options.DetailLevel == DetailBrief {
+		sb.WriteString("Keep it to a short overview and the key functions.")
+	} else {
+		sb.WriteString("Balance an overview with notes on the most important functions.")
+	}
+
+	language := LanguageForFile(target)
+	if template, ok := languageTemplates[language]; ok {
+		sb.WriteString("\n\n" + template)
+	}
+
+	sb.WriteString(fmt.Sprintf("\n\nFile: %s\nLanguage: %s\n", target, language))
+	if len(chunks) > 0 && chunks[0].Package != "" {
+		sb.WriteString("Package: " + chunks[0].Package + "\n")
+	}
+
+	// The file itself, chunk by chunk
+	sb.WriteString("\nFile content:\n```\n")
+	written := 0
+	for _, chunk := range chunks {
+		if written+len(chunk.Content) > fileSummaryMaxChars {
+			sb.WriteString("\n...[truncated]...\n")
+			break
+		}
+		sb.WriteString(chunk.Content + "\n")
+		written += len(chunk.Content)
+	}
+	sb.WriteString("```\n")
+
+	// An outline of each immediate dependency
+	if len(dependencies) > 0 {
+		sb.WriteString("\nImmediate dependencies (outline of declarations):\n")
+		for _, dep := range dependencies {
+			sb.WriteString("\n" + dep + ":\n")
+			for _, chunk := range byFile[dep] {
+				if chunk.Function == "" && chunk.Class == "" {
+					continue
+				}
+				if signature := chunkSignature(chunk.Content); signature != "" {
+					sb.WriteString("- " + signature + "\n")
+				}
+			}
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package summarization
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// pathFilter selects the files a summary covers by the Focus and Exclude
+// patterns of its options. Patterns are matched with fileutils.MatchPath
+// against paths relative to the indexed root, and against paths as indexed
+// unless those are absolute and the pattern isn't.
+type pathFilter struct {
+	root    string
+	focus   []string
+	exclude []string
+}
+
+// newPathFilter returns the filter of options for an index's chunks
+func newPathFilter(chunks []storage.CodeChunk, options SummaryOptions) pathFilter {
+	return pathFilter{root: storage.RootDir(chunks), focus: options.Focus, exclude: options.Exclude}
+}
+
+// active reports whether the filter leaves out any file
+func (f pathFilter) active() bool {
+	return len(f.focus) > 0 || len(f.exclude) > 0
+}
+
+// includes reports whether a file matches a focus pattern, if there are
+// any, and no exclude pattern
+func (f pathFilter) includes(file string) bool {
+	if len(f.focus) > 0 && !f.matchesAny(f.focus, file) {
+		return false
+	}
+	return !f.matchesAny(f.exclude, file)
+}
+
+// matchesAny reports whether a file matches one of patterns
+func (f pathFilter) matchesAny(patterns []string, file string) bool {
+	rel, err := filepath.Rel(f.root, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = file
+	}
+	for _, pattern := range patterns {
+		if fileutils.MatchPath(pattern, rel) ||
+			((filepath.IsAbs(pattern) || !filepath.IsAbs(file)) && fileutils.MatchPath(pattern, file)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterChunks returns the chunks of the files the filter includes
+func (f pathFilter) filterChunks(chunks []storage.CodeChunk) []storage.CodeChunk {
+	if !f.active() {
+		return chunks
+	}
+	var filtered []storage.CodeChunk
+	for _, chunk := range chunks {
+		if f.includes(chunk.File) {
+			filtered = append(filtered, chunk)
+		}
+	}
+	return filtered
+}
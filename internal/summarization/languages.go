@@ -0,0 +1,69 @@
+package summarization
+
+// Share of lines of code above which a repository is treated as monolingual
+const monolingualThreshold = 0.9
+
+// languageTemplates holds language-specialized guidance used when a single
+// language dominates the repository. Polyglot repos use the generic prompt.
+var languageTemplates = map[string]string{
+	"Go": "This is a Go codebase. Describe it in terms Go developers expect: the module path and package layout " +
+		"(cmd/ for binaries, internal/ for private packages, pkg/ for public ones), how packages depend on each other, " +
+		"interface usage and where interfaces are declared, error handling style (wrapping with %w, sentinel errors), " +
+		"goroutine and channel usage, context propagation, and whether the code follows idiomatic naming and doc comments.",
+	"Python": "This is a Python codebase. Describe the package and module layout (src/ layout, __init__.py packages, " +
+		"entry points in __main__.py or console scripts), the packaging and dependency tooling (pyproject.toml, setup.py, " +
+		"requirements), use of type hints, classes versus plain functions, async usage, frameworks such as Django, Flask or " +
+		"FastAPI, and how closely the code follows PEP 8 conventions.",
+	"JavaScript": "This is a JavaScript codebase. Describe the module system (ES modules or CommonJS), the package.json " +
+		"scripts and entry points, frameworks and build tooling (React, Express, Vite, webpack), how async code is " +
+		"structured (promises, async/await, callbacks), and the directory conventions used for components, routes, and utilities.",
+	"TypeScript": "This is a TypeScript codebase. Describe the module layout and tsconfig-driven structure, how types and " +
+		"interfaces model the domain, use of generics, frameworks and build tooling, package.json scripts and entry points, " +
+		"and how strictly the code relies on the type system versus any/unknown escapes.",
+	"Java": "This is a Java codebase. Describe the package hierarchy and Maven/Gradle module layout (src/main/java, " +
+		"src/test/java), frameworks such as Spring, dependency injection and annotations, the use of interfaces and abstract " +
+		"classes, layering (controller, service, repository), exception handling conventions, and build configuration.",
+	"C#": "This is a C# codebase. Describe the solution and project layout, namespaces, frameworks such as ASP.NET Core, " +
+		"dependency injection setup, async/await usage, LINQ, interfaces and their implementations, and how configuration " +
+		"and startup are organized.",
+	"Rust": "This is a Rust codebase. Describe the crate and module layout (Cargo workspace, lib.rs versus main.rs, mod " +
+		"hierarchy), the ownership and borrowing patterns used, traits and generics, error handling with Result and error " +
+		"crates, async runtimes, unsafe usage, and feature flags.",
+	"Ruby": "This is a Ruby codebase. Describe the gem or Rails application layout (app/, lib/, config/), Bundler " +
+		"dependencies, use of modules and mixins, metaprogramming, and Rails conventions such as models, controllers, and concerns.",
+	"PHP": "This is a PHP codebase. Describe the Composer setup and PSR-4 autoloading layout, frameworks such as Laravel " +
+		"or Symfony, namespaces, routing and controllers, and how dependencies are injected.",
+	"Kotlin": "This is a Kotlin codebase. Describe the Gradle module layout, packages, use of coroutines, data and sealed " +
+		"classes, extension functions, null-safety practices, and frameworks such as Android, Ktor, or Spring.",
+	"Swift": "This is a Swift codebase. Describe the Swift Package Manager or Xcode project layout, protocols and " +
+		"protocol-oriented design, value versus reference types, concurrency with async/await and actors, and UI frameworks " +
+		"such as SwiftUI or UIKit.",
+	"C++": "This is a C++ codebase. Describe the build system (CMake, Bazel, Make), header and source layout, namespaces, " +
+		"class hierarchies and templates, memory management (RAII, smart pointers), and the C++ standard and libraries in use.",
+}
+
+// dominantLanguage returns the language that accounts for more than
+// monolingualThreshold of the repository's lines of code, or "" for polyglot repos
+func dominantLanguage(repoStructure []FileStructure) string {
+	langLOC := make(map[string]int)
+	total := 0
+
+	for _, file := range repoStructure {
+		if file.Language == "Unknown" {
+			continue
+		}
+		langLOC[file.Language] += file.LOC
+		total += file.LOC
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	for lang, loc := range langLOC {
+		if float64(loc)/float64(total) > monolingualThreshold {
+			return lang
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package summarization
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Maximum characters of build and documentation files included in an onboarding prompt
+const onboardingMaxManifestChars = 20000
+
+// Lines shown from the start of each file in the reading order
+const onboardingFileHeadLines = 60
+
+// readingOrderLength returns how many files to put in the suggested reading order
+func readingOrderLength(detailLevel DetailLevel) int {
+	switch detailLevel {
+	case DetailBrief:
+		return 5
+	case DetailComprehensive:
+		return 12
+	default:
+		return 8
+	}
+}
+
+// readingOrder returns the most important files, most important first
+func readingOrder(fileImportance map[string]float64, options SummaryOptions) []string {
+	var files []string
+	for path := range fileImportance {
+		files = append(files, path)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if fileImportance[files[i]] != fileImportance[files[j]] {
+			return fileImportance[files[i]] > fileImportance[files[j]]
+		}
+		return files[i] < files[j]
+	})
+
+	if limit := readingOrderLength(options.DetailLevel); len(files) > limit {
+		files = files[:limit]
+	}
+	return files
+}
+
+// findEntryPoints returns indexed files that define a main function or are
+// conventional entry point files
+func findEntryPoints(chunks []storage.CodeChunk) []string {
+	conventional := make(map[string]bool)
+	for _, name := range entryPointFiles {
+		conventional[filepath.Base(name)] = true
+	}
+
+	seen := make(map[string]bool)
+	var entryPoints []string
+	for _, chunk := range chunks {
+		if seen[chunk.File] {
+			continue
+		}
+		if chunk.Function == "main" || conventional[filepath.Base(chunk.File)] {
+			seen[chunk.File] = true
+			entryPoints = append(entryPoints, chunk.File)
+		}
+	}
+	sort.Strings(entryPoints)
+	return entryPoints
+}
+
+// buildOnboardingPrompt creates the prompt for a new-developer onboarding guide
+func buildOnboardingPrompt(root string, chunks []storage.CodeChunk, repoStructure []FileStructure,
+	fileChunks map[string][]string, fileImportance map[string]float64, options SummaryOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are writing an onboarding guide for a developer who joins this project tomorrow. ")
+	sb.WriteString("Be concrete: give exact commands, file paths, and function names taken from the material below, ")
+	sb.WriteString("and say plainly when the material doesn't show something rather than guessing.")
+
+	if template, ok := languageTemplates[dominantLanguage(repoStructure)]; ok {
+		sb.WriteString("\n\n" + template)
+	}
+
+	sb.WriteString("\n\nCodebase Context:\n")
+	sb.WriteString("- Primary Languages: " + getMainLanguages(repoStructure) + "\n")
+	sb.WriteString(fmt.Sprintf("- Total Files: %d\n", len(repoStructure)))
+	sb.WriteString(fmt.Sprintf("- Total Lines of Code: %d\n", calculateTotalLOC(repoStructure)))
+
+	sb.WriteString("\n\nCodebase structure:\n")
+	writeStructureSection(&sb, repoStructure, false)
+
+	// Build files and documentation, which are read from disk since they aren't indexed
+	sb.WriteString("\n\nBuild and documentation files:\n")
+	written := 0
+	for _, name := range manifestFiles {
+		content, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+		text := string(content)
+		if len(text) > quickLookMaxFileChars {
+			text = text[:quickLookMaxFileChars] + "\n...[truncated]..."
+		}
+		if written+len(text) > onboardingMaxManifestChars {
+			break
+		}
+		sb.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", name, text))
+		written += len(text)
+	}
+	if written == 0 {
+		sb.WriteString("(none found)\n")
+	}
+
+	sb.WriteString("\n\nEntry points:\n")
+	entryPoints := findEntryPoints(chunks)
+	if len(entryPoints) == 0 {
+		sb.WriteString("(none detected)\n")
+	}
+	for _, file := range entryPoints {
+		sb.WriteString("- " + file + "\n")
+	}
+
+	// Files ordered by importance score, with the start of each
+	order := readingOrder(fileImportance, options)
+	sb.WriteString("\n\nSuggested reading order (most central first, by importance score):\n")
+	for i, file := range order {
+		sb.WriteString(fmt.Sprintf("%d. %s (importance %.2f)\n", i+1, file, fileImportance[file]))
+	}
+	for _, file := range order {
+		lines := strings.Split(strings.Join(fileChunks[file], "\n"), "\n")
+		if len(lines) > onboardingFileHeadLines {
+			lines = append(lines[:onboardingFileHeadLines], "...[rest of file omitted]...")
+		}
+		sb.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", file, strings.Join(lines, "\n")))
+	}
+
+	sb.WriteString("\n\nWrite the guide with these sections:\n")
+	sb.WriteString("1. What This Project Is - purpose and main users in a few sentences\n")
+	sb.WriteString("2. Getting Set Up - prerequisites and configuration such as API keys or environment variables\n")
+	sb.WriteString("3. Build, Run, and Test - the exact commands\n")
+	sb.WriteString("4. Entry Points - where execution starts and what each entry point does\n")
+	sb.WriteString("5. Guided Tour - the most important packages, what each is responsible for, and how they interact\n")
+	sb.WriteString("6. Suggested Reading Order - the files above in order, with one line on what to look for in each\n")
+	sb.WriteString("7. Conventions and Gotchas - patterns to follow and pitfalls a newcomer is likely to hit\n")
+
+	return sb.String()
+}
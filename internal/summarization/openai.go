@@ -0,0 +1,90 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/exolottl/codie/internal/apikeys"
+	"github.com/exolottl/codie/internal/httpclient"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIBaseURL, when set, is the base URL of an OpenAI-compatible API,
+// such as vLLM, LiteLLM, LM Studio, or OpenRouter, used instead of OpenAI's
+var OpenAIBaseURL = ""
+
+// Keys of OPENAI_API_KEYS, or OPENAI_API_KEY, chat requests rotate through
+var openaiKeys = apikeys.NewRotation("OPENAI_API_KEY")
+
+// openaiChat generates chat completions with the OpenAI API, or a
+// compatible one at OpenAIBaseURL, moving on to the next of several keys when
+// one is rejected or rate limited
+type openaiChat struct{}
+
+func (openaiChat) Complete(ctx context.Context, request ChatRequest) (reply ChatReply, err error) {
+	// Compatible servers often need no key
+	if os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("OPENAI_API_KEYS") == "" && OpenAIBaseURL == "" {
+		return ChatReply{}, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	err = openaiKeys.Do(func(apiKey string) error {
+		reply, err = openaiComplete(ctx, apiKey, request)
+		return err
+	})
+	return reply, err
+}
+
+// openaiComplete makes one chat completion request with an API key
+func openaiComplete(ctx context.Context, apiKey string, request ChatRequest) (ChatReply, error) {
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = httpclient.New()
+	if OpenAIBaseURL != "" {
+		config.BaseURL = OpenAIBaseURL
+	}
+	client := openai.NewClientWithConfig(config)
+
+	chatRequest := openai.ChatCompletionRequest{
+		Model: request.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: request.SystemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: request.Prompt,
+			},
+		},
+	}
+	if isReasoningModel(request.Model) {
+		chatRequest.MaxCompletionTokens = request.MaxTokens
+	} else {
+		chatRequest.MaxTokens = request.MaxTokens
+		chatRequest.Temperature = request.Temperature
+		if request.Temperature == 0 {
+			// A zero temperature is dropped from the request (omitempty), so send the closest non-zero value
+			chatRequest.Temperature = math.SmallestNonzeroFloat32
+		}
+		chatRequest.TopP = 0.95
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, chatRequest)
+	if err != nil {
+		return ChatReply{}, err
+	}
+
+	reply := ChatReply{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		return reply, fmt.Errorf("empty response from OpenAI")
+	}
+	reply.Text = resp.Choices[0].Message.Content
+	return reply, nil
+}
+
+// isReasoningModel reports whether a model is an o-series reasoning model,
+// which takes max_completion_tokens and doesn't accept sampling parameters
+func isReasoningModel(model string) bool {
+	return strings.HasPrefix(model, "o1") || strings.HasPrefix(model, "o3")
+}
@@ -0,0 +1,116 @@
+package summarization
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DetailLevel is how much detail a summary goes into
+type DetailLevel string
+
+const (
+	DetailBrief         DetailLevel = "brief"
+	DetailStandard      DetailLevel = "standard"
+	DetailComprehensive DetailLevel = "comprehensive"
+)
+
+// DetailLevels lists the detail levels, least detailed first
+var DetailLevels = []DetailLevel{DetailBrief, DetailStandard, DetailComprehensive}
+
+// Mode is the kind of document a summary is
+type Mode string
+
+const (
+	ModeOverview   Mode = "overview"
+	ModeOnboarding Mode = "onboarding"
+	ModeSecurity   Mode = "security"
+	ModeTests      Mode = "tests"
+	ModeDocs       Mode = "docs"
+)
+
+// SummaryModes lists the kinds of document a summary can be:
+// "overview" describes the architecture, "onboarding" is a guide for new
+// developers, "security" reviews security-sensitive code, "tests" describes
+// the testing strategy and coverage gaps, and "docs" reports documentation
+// coverage
+var SummaryModes = []Mode{ModeOverview, ModeOnboarding, ModeSecurity, ModeTests, ModeDocs}
+
+// ParseDetailLevel returns the detail level named by s, ignoring case and
+// surrounding space
+func ParseDetailLevel(s string) (DetailLevel, error) {
+	level := DetailLevel(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(DetailLevels, level) {
+		return "", fmt.Errorf("invalid detail level %q: must be one of %s", s, joinNames(DetailLevels))
+	}
+	return level, nil
+}
+
+// ParseMode returns the summary mode named by s, ignoring case and
+// surrounding space
+func ParseMode(s string) (Mode, error) {
+	mode := Mode(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(SummaryModes, mode) {
+		return "", fmt.Errorf("invalid mode %q: must be one of %s", s, joinNames(SummaryModes))
+	}
+	return mode, nil
+}
+
+// ParseAudience returns the audience named by s, ignoring case and
+// surrounding space
+func ParseAudience(s string) (string, error) {
+	audience := strings.ToLower(strings.TrimSpace(s))
+	if !slices.Contains(Audiences, audience) {
+		return "", fmt.Errorf("invalid audience %q: must be one of %s", s, strings.Join(Audiences, ", "))
+	}
+	return audience, nil
+}
+
+// Normalize returns the options with the defaults of DefaultSummaryOptions
+// in place of an empty mode, detail level, or audience, names in lower
+// case, and blank focus and exclude patterns dropped. It fails on a mode,
+// detail level, or audience that isn't one of those listed.
+func (o SummaryOptions) Normalize() (SummaryOptions, error) {
+	defaults := DefaultSummaryOptions()
+	var err error
+
+	if o.Mode == "" {
+		o.Mode = defaults.Mode
+	} else if o.Mode, err = ParseMode(string(o.Mode)); err != nil {
+		return o, err
+	}
+	if o.DetailLevel == "" {
+		o.DetailLevel = defaults.DetailLevel
+	} else if o.DetailLevel, err = ParseDetailLevel(string(o.DetailLevel)); err != nil {
+		return o, err
+	}
+	if o.Audience == "" {
+		o.Audience = defaults.Audience
+	} else if o.Audience, err = ParseAudience(o.Audience); err != nil {
+		return o, err
+	}
+
+	o.Focus = nonBlank(o.Focus)
+	o.Exclude = nonBlank(o.Exclude)
+	return o, nil
+}
+
+// nonBlank returns the patterns that aren't blank, trimmed
+func nonBlank(patterns []string) []string {
+	var kept []string
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			kept = append(kept, pattern)
+		}
+	}
+	return kept
+}
+
+// joinNames joins the names of enum values with commas
+func joinNames[T ~string](values []T) string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = string(value)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,255 @@
+package summarization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/pricing"
+)
+
+// QuickLookOptions configures the budget for a quick look at a repository
+type QuickLookOptions struct {
+	TimeBudget time.Duration // Maximum wall-clock time for the whole run
+	CostBudget float64       // Maximum estimated API cost in USD
+}
+
+// DefaultQuickLookOptions returns the default quick look budget
+func DefaultQuickLookOptions() QuickLookOptions {
+	return QuickLookOptions{
+		TimeBudget: 60 * time.Second,
+		CostBudget: 0.10,
+	}
+}
+
+// QuickLookResult holds the orientation text and what it cost to produce
+type QuickLookResult struct {
+	Summary       string
+	SampledFiles  []string
+	EstimatedCost float64
+}
+
+// Maximum tokens the model may answer with in a quick look
+const quickLookOutputTokens = 700
+
+// Maximum characters included from a single sampled file
+const quickLookMaxFileChars = 6000
+
+// Maximum number of files inspected while detecting languages
+const quickLookMaxScannedFiles = 5000
+
+// Well-known manifest and build files, in order of usefulness
+var manifestFiles = []string{
+	"README.md", "README", "README.rst", "README.txt",
+	"go.mod", "package.json", "pyproject.toml", "requirements.txt", "setup.py",
+	"Cargo.toml", "pom.xml", "build.gradle", "build.gradle.kts", "Gemfile",
+	"composer.json", "Makefile", "Dockerfile", "docker-compose.yml", "docker-compose.yaml",
+}
+
+// Common entry point files, relative to the repository root
+var entryPointFiles = []string{
+	"main.go", "main.py", "app.py", "__main__.py", "manage.py",
+	"index.js", "index.ts", "server.js", "app.js",
+	"src/main.rs", "src/lib.rs", "src/index.js", "src/index.ts", "src/main.ts",
+	"src/main.py", "src/app.py",
+}
+
+// GenerateQuickLook produces a short orientation for an unfamiliar repository
+// without indexing it, staying within the given time and cost budget.
+// Canceling ctx stops it early.
+func GenerateQuickLook(ctx context.Context, dir string, options QuickLookOptions) (*QuickLookResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, options.TimeBudget)
+	defer cancel()
+
+	// Work out how much input we can afford
+	maxInputTokens := pricing.MaxInputTokens(ChatModel, options.CostBudget, quickLookOutputTokens)
+	if maxInputTokens == 0 {
+		return nil, fmt.Errorf("cost budget of $%.4f is too small for a quick look", options.CostBudget)
+	}
+
+	// Survey the top level and languages used
+	topLevel, err := listTopLevel(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	langLOC := detectLanguages(ctx, dir)
+
+	var sb strings.Builder
+	sb.WriteString("You are giving a developer a quick orientation to an unfamiliar repository. ")
+	sb.WriteString("Using only the samples below, write a response that fits on one screen (under 40 lines) with these sections:\n")
+	sb.WriteString("1. What this is - one or two sentences\n")
+	sb.WriteString("2. Main language and stack\n")
+	sb.WriteString("3. How to build and run it - concrete commands where the samples show them\n")
+	sb.WriteString("4. Where to look next - the 3-5 files or directories worth reading first\n")
+	sb.WriteString("Say so plainly when the samples don't answer a question rather than guessing.\n")
+
+	sb.WriteString("\nTop-level entries:\n")
+	for _, entry := range topLevel {
+		sb.WriteString("- " + entry + "\n")
+	}
+
+	if len(langLOC) > 0 {
+		sb.WriteString("\nLanguages by file count:\n")
+		for _, lang := range sortedLanguages(langLOC) {
+			sb.WriteString(fmt.Sprintf("- %s: %d files\n", lang, langLOC[lang]))
+		}
+	}
+
+	// Add sampled files in priority order while the budget allows
+	var sampled []string
+	for _, rel := range sampleCandidates(dir) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			continue
+		}
+
+		text := string(content)
+		if len(text) > quickLookMaxFileChars {
+			text = text[:quickLookMaxFileChars] + "\n...[truncated]..."
+		}
+
+		section := fmt.Sprintf("\n--- %s ---\n%s\n", rel, text)
+		if maxInputTokens > 0 && pricing.EstimateTokens(sb.String()+section) > maxInputTokens {
+			continue
+		}
+
+		sb.WriteString(section)
+		sampled = append(sampled, rel)
+	}
+
+	prompt := sb.String()
+	summary, err := chatCompletion(ctx, summarySystemPrompt, prompt, quickLookOutputTokens, 0.1)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("quick look exceeded its %v time budget", options.TimeBudget)
+		}
+		return nil, fmt.Errorf("failed to generate quick look: %v", err)
+	}
+
+	return &QuickLookResult{
+		Summary:      summary,
+		SampledFiles: sampled,
+		EstimatedCost: pricing.EstimateCost(ChatModel,
+			pricing.EstimateTokens(prompt), pricing.EstimateTokens(summary)),
+	}, nil
+}
+
+// listTopLevel returns the names of the top-level entries of dir, marking directories
+func listTopLevel(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if fileutils.IsSkippedDir(entry.Name()) {
+				continue
+			}
+			names = append(names, entry.Name()+"/")
+		} else {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// detectLanguages counts files per language, stopping early when ctx expires
+// or the scan limit is reached
+func detectLanguages(ctx context.Context, dir string) map[string]int {
+	counts := make(map[string]int)
+	scanned := 0
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil || scanned >= quickLookMaxScannedFiles {
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			if path != dir && fileutils.IsSkippedDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		scanned++
+		if lang := LanguageForFile(path); lang != "Unknown" {
+			counts[lang]++
+		}
+		return nil
+	})
+
+	return counts
+}
+
+// sortedLanguages returns language names ordered by descending file count
+func sortedLanguages(counts map[string]int) []string {
+	var langs []string
+	for lang := range counts {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if counts[langs[i]] != counts[langs[j]] {
+			return counts[langs[i]] > counts[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	return langs
+}
+
+// sampleCandidates returns existing manifest and entry point files, most useful first
+func sampleCandidates(dir string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+
+	add := func(rel string) {
+		if seen[rel] {
+			return
+		}
+		if info, err := os.Stat(filepath.Join(dir, rel)); err == nil && !info.IsDir() {
+			candidates = append(candidates, rel)
+			seen[rel] = true
+		}
+	}
+
+	for _, name := range manifestFiles {
+		add(name)
+	}
+	for _, name := range entryPointFiles {
+		add(name)
+	}
+
+	// Go-style cmd/<name>/main.go entry points
+	if matches, err := filepath.Glob(filepath.Join(dir, "cmd", "*", "main.go")); err == nil {
+		for _, match := range matches {
+			if rel, err := filepath.Rel(dir, match); err == nil {
+				add(rel)
+			}
+		}
+	}
+
+	// Remaining top-level source files
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() && LanguageForFile(entry.Name()) != "Unknown" {
+				add(entry.Name())
+			}
+		}
+	}
+
+	return candidates
+}
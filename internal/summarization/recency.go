@@ -0,0 +1,61 @@
+package summarization
+
+import (
+	"log/slog"
+	"path/filepath"
+
+	"github.com/exolottl/codie/internal/gitdiff"
+)
+
+// Files changed in the last RecentCommits commits have their importance
+// raised by the fraction RecencyBoost, since current work is what readers
+// most often ask about. RecentCommits of 0 turns the boost off.
+var (
+	RecentCommits = 0
+	RecencyBoost  = 0.1
+)
+
+// RecentFiles returns the absolute paths of the files changed in the last
+// RecentCommits commits of the repositories holding dirs. It returns nil when
+// the boost is off or nothing could be read from git.
+func RecentFiles(dirs ...string) map[string]bool {
+	if RecentCommits <= 0 || RecencyBoost <= 0 {
+		return nil
+	}
+
+	recent := make(map[string]bool)
+	for _, dir := range dirs {
+		files, err := gitdiff.RecentFiles(dir, RecentCommits)
+		if err != nil {
+			slog.Debug("Not boosting recent changes", "dir", dir, "error", err)
+			continue
+		}
+		for _, file := range files {
+			recent[file] = true
+		}
+	}
+	if len(recent) == 0 {
+		return nil
+	}
+	return recent
+}
+
+// IsRecent reports whether file is one of the recently changed files
+func IsRecent(recent map[string]bool, file string) bool {
+	if len(recent) == 0 {
+		return false
+	}
+	abs, err := filepath.Abs(file)
+	return err == nil && recent[abs]
+}
+
+// boostRecentFiles raises the importance of the recently changed files
+// under root
+func boostRecentFiles(importance map[string]float64, root string) {
+	recent := RecentFiles(root)
+	for file := range importance {
+		if IsRecent(recent, file) {
+			importance[file] *= 1 + RecencyBoost
+		}
+	}
+}
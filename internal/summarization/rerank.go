@@ -0,0 +1,94 @@
+package summarization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/search"
+)
+
+// Number of vector search hits passed to the model for reranking
+const RerankCandidates = 50
+
+// Characters of each candidate shown to the reranking model
+const rerankExcerptChars = 600
+
+// Rerank asks RerankModel to order search results by how well they answer
+// query and returns the k most relevant, keeping their similarity scores.
+// Candidates the model leaves out of its ranking follow in their original
+// order.
+func Rerank(ctx context.Context, query string, results []search.Result, k int) ([]search.Result, error) {
+	if len(results) <= 1 {
+		return results, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Rank the code excerpts below by how relevant they are to the search query. ")
+	sb.WriteString("Reply with only a JSON array of excerpt numbers, most relevant first, leaving out excerpts that are not relevant.\n")
+	sb.WriteString("\nQuery: " + query + "\n")
+	for i, result := range results {
+		chunk := result.Chunk
+		content := chunk.Content
+		if len(content) > rerankExcerptChars {
+			content = content[:rerankExcerptChars] + "\n..."
+		}
+		location := chunk.File
+		if chunk.StartLine > 0 {
+			location = fmt.Sprintf("%s:%d-%d", chunk.File, chunk.StartLine, chunk.EndLine)
+		}
+		sb.WriteString(fmt.Sprintf("\n[%d] %s\n%s\n", i+1, location, content))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	reply, err := chatCompletionModel(ctx, RerankModel, "You rank code search results by relevance.", sb.String(), 400, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank results: %v", err)
+	}
+	order, err := parseRanking(reply, len(results))
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank results: %v", err)
+	}
+
+	reranked := make([]search.Result, 0, len(results))
+	for _, i := range order {
+		reranked = append(reranked, results[i])
+	}
+	if k > 0 && len(reranked) > k {
+		reranked = reranked[:k]
+	}
+	return reranked, nil
+}
+
+// parseRanking reads the JSON array of 1-based excerpt numbers in a reply,
+// returning the 0-based indexes of every one of n candidates: the ranked
+// ones first, then the rest in their original order
+func parseRanking(reply string, n int) ([]int, error) {
+	start, end := strings.Index(reply, "["), strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no ranking in reply %q", reply)
+	}
+	var numbers []int
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &numbers); err != nil {
+		return nil, fmt.Errorf("invalid ranking in reply: %v", err)
+	}
+
+	seen := make([]bool, n)
+	order := make([]int, 0, n)
+	for _, number := range numbers {
+		if number >= 1 && number <= n && !seen[number-1] {
+			seen[number-1] = true
+			order = append(order, number-1)
+		}
+	}
+	for i := range n {
+		if !seen[i] {
+			order = append(order, i)
+		}
+	}
+	return order, nil
+}
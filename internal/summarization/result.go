@@ -0,0 +1,92 @@
+package summarization
+
+import (
+	"strings"
+	"time"
+)
+
+// SummaryResult is a codebase summary, split into its sections, with what
+// it covered and the tokens it took
+type SummaryResult struct {
+	Text     string           `json:"text"` // The whole summary, in markdown
+	Sections []SummarySection `json:"sections"`
+	Metadata SummaryMetadata  `json:"metadata"`
+	Usage    TokenUsage       `json:"usage"`
+}
+
+// SummarySection is one heading of a markdown summary and the text under it
+type SummarySection struct {
+	Heading string `json:"heading"`
+	Level   int    `json:"level"`
+	Content string `json:"content"`
+}
+
+// SummaryMetadata records how a summary was made
+type SummaryMetadata struct {
+	Mode        Mode        `json:"mode"`
+	DetailLevel DetailLevel `json:"detail_level"`
+	Audience    string      `json:"audience"`
+	Focus       []string    `json:"focus,omitempty"`
+	Exclude     []string    `json:"exclude,omitempty"`
+	Provider    string      `json:"provider"`
+	Model       string      `json:"model"`
+	Files       int         `json:"files"`  // Files summarized, after focus and exclude patterns
+	Chunks      int         `json:"chunks"` // Chunks of those files
+	GeneratedAt time.Time   `json:"generated_at"`
+}
+
+// TokenUsage is the tokens a summary's chat request took, as reported by
+// the provider, and their estimated cost in USD
+type TokenUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost"`
+}
+
+// Section returns the first section whose heading contains title, ignoring
+// case, so "architecture" finds "2. Architecture", and whether there was one
+func (r SummaryResult) Section(title string) (SummarySection, bool) {
+	title = strings.ToLower(title)
+	for _, section := range r.Sections {
+		if strings.Contains(strings.ToLower(section.Heading), title) {
+			return section, true
+		}
+	}
+	return SummarySection{}, false
+}
+
+// SplitSections splits a markdown summary at its headings. Text before the
+// first heading becomes a section with an empty heading; headings inside
+// fenced code blocks are ignored.
+func SplitSections(summary string) []SummarySection {
+	var sections []SummarySection
+	current := SummarySection{}
+	var body []string
+	inFence := false
+
+	flush := func() {
+		current.Content = strings.TrimSpace(strings.Join(body, "\n"))
+		if current.Heading != "" || current.Content != "" {
+			sections = append(sections, current)
+		}
+		body = nil
+	}
+
+	for _, line := range strings.Split(summary, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if !inFence && level > 0 && level <= 6 && strings.HasPrefix(trimmed[level:], " ") {
+			flush()
+			current = SummarySection{Heading: strings.TrimSpace(trimmed[level:]), Level: level}
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return sections
+}
@@ -0,0 +1,118 @@
+package summarization
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// summaryTopic is a query used to retrieve the chunks that best describe one
+// aspect of a codebase. Each is embedded and matched against the index so
+// the summary prompt is built from semantically relevant code rather than
+// file-level heuristics.
+type summaryTopic struct {
+	Title string
+	Query string
+}
+
+// Topics of summaries written for developers
+var summaryTopics = []summaryTopic{
+	{"Entry points", "program entry point, main function, command-line handling, server startup"},
+	{"Data model", "core data structures, domain models, types and schemas"},
+	{"API surface", "public API, exported interfaces, HTTP handlers and routes, service methods"},
+	{"Core logic", "main algorithm and business logic that does the central work"},
+	{"Persistence and I/O", "storage, database access, reading and writing files, external API clients"},
+	{"Configuration", "configuration loading, settings, environment variables, options and defaults"},
+	{"Error handling", "error handling, retries, validation and failure recovery"},
+}
+
+// Maximum characters of a single retrieved chunk included in a diff summary
+const retrievedChunkMaxChars = 3000
+
+// retrievedTopic is the code retrieved for a summary topic, with a header
+// for each excerpt giving its location and similarity
+type retrievedTopic struct {
+	Title    string
+	Headers  []string
+	Excerpts []string
+}
+
+// retrievedChunksPerTopic returns how many chunks to retrieve per topic for a detail level
+func retrievedChunksPerTopic(detailLevel DetailLevel) int {
+	switch detailLevel {
+	case DetailBrief:
+		return 2
+	case DetailComprehensive:
+		return 6
+	default:
+		return 4
+	}
+}
+
+// retrieveTopicContext embeds the summary topics of the audience and
+// returns the best matching chunks for each, skipping chunks already shown
+// under an earlier topic
+func retrieveTopicContext(ctx context.Context, chunks []storage.CodeChunk, options SummaryOptions) ([]retrievedTopic, error) {
+	var candidates []storage.CodeChunk
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) == 0 {
+			continue
+		}
+		candidates = append(candidates, chunk)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no embedded chunks to retrieve from")
+	}
+
+	topics := audienceFor(options.Audience).topics
+	queries := make([]string, len(topics))
+	for i, topic := range topics {
+		queries[i] = topic.Query
+	}
+	queryEmbeddings, err := embeddings.GetBatchQueryEmbeddingsContext(ctx, queries, len(queries))
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed summary topics: %v", err)
+	}
+
+	var retrieved []retrievedTopic
+	shown := make(map[string]bool)
+	perTopic := retrievedChunksPerTopic(options.DetailLevel)
+
+	for _, topic := range topics {
+		queryEmbedding, ok := queryEmbeddings[topic.Query]
+		if !ok {
+			continue
+		}
+
+		// Over-fetch so duplicates from earlier topics can be skipped
+		section := retrievedTopic{Title: topic.Title}
+		for _, result := range search.SearchContext(ctx, candidates, queryEmbedding, perTopic*2) {
+			chunk := result.Chunk
+			key := fmt.Sprintf("%s:%d:%d", chunk.File, chunk.StartLine, chunk.EndLine)
+			if shown[key] {
+				continue
+			}
+			shown[key] = true
+
+			location := chunk.File
+			if chunk.StartLine > 0 {
+				location = fmt.Sprintf("%s:%d-%d", chunk.File, chunk.StartLine, chunk.EndLine)
+			}
+			section.Headers = append(section.Headers, fmt.Sprintf("\n--- %s (%s) ---\n", location, describeMatch(chunk, result.Score)))
+			section.Excerpts = append(section.Excerpts, chunk.Content)
+
+			if len(section.Excerpts) == perTopic {
+				break
+			}
+		}
+
+		if len(section.Excerpts) > 0 {
+			retrieved = append(retrieved, section)
+		}
+	}
+
+	return retrieved, nil
+}
@@ -0,0 +1,287 @@
+package summarization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exolottl/codie/internal/pricing"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// ReviewSeverities are the severities of review comments, most severe first
+var ReviewSeverities = []string{"blocker", "major", "minor", "nit"}
+
+// Maximum functions called by the changed code listed in a review prompt
+const reviewMaxCallees = 15
+
+// Maximum callers of the changed code included in a review prompt
+const reviewMaxCallers = 8
+
+// Start of the new file's range in a hunk header
+var newHunkStart = regexp.MustCompile(`^@@ -\S+ \+(\d+)`)
+
+// ReviewComment is a review comment anchored to lines of the newer version
+// of a changed file
+type ReviewComment struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	EndLine    int    `json:"end_line,omitempty"`
+	Severity   string `json:"severity"` // One of ReviewSeverities
+	Category   string `json:"category"` // bug, security, performance, error-handling, concurrency, api, tests, or readability
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"` // Code to replace the lines with
+}
+
+// Review is the result of reviewing a diff
+type Review struct {
+	Summary  string          `json:"summary"`
+	Comments []ReviewComment `json:"comments"`
+}
+
+// GenerateReview reviews a diff, giving the model the patches with line
+// numbers, the functions the changed code calls, and the code calling it.
+// Comments on files outside the diff are dropped, and the rest are ordered
+// by file and line.
+func GenerateReview(ctx context.Context, input DiffSummaryInput, options SummaryOptions) (Review, error) {
+	if len(input.Changes) == 0 {
+		return Review{}, fmt.Errorf("no changes to review")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	reply, err := chatCompletion(ctx, summarySystemPrompt, buildReviewPrompt(input, options), 4000, 0.1)
+	if err != nil {
+		return Review{}, fmt.Errorf("failed to generate review: %v", err)
+	}
+
+	reply = stripCodeFence(reply)
+
+	var review Review
+	if err := json.Unmarshal([]byte(reply), &review); err != nil {
+		return Review{}, fmt.Errorf("failed to parse review: %v", err)
+	}
+
+	changed := make(map[string]bool)
+	for _, change := range input.Changes {
+		changed[change.Path] = true
+	}
+	comments := review.Comments[:0]
+	for _, comment := range review.Comments {
+		if !changed[comment.File] || strings.TrimSpace(comment.Message) == "" {
+			continue
+		}
+		if ReviewSeverityRank(comment.Severity) < 0 {
+			comment.Severity = "minor"
+		}
+		comments = append(comments, comment)
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		if comments[i].File != comments[j].File {
+			return comments[i].File < comments[j].File
+		}
+		return comments[i].Line < comments[j].Line
+	})
+	review.Comments = comments
+	return review, nil
+}
+
+// CountAtLeast returns how many comments are of a severity or worse
+func (r Review) CountAtLeast(severity string) int {
+	count := 0
+	for _, comment := range r.Comments {
+		if ReviewSeverityRank(comment.Severity) <= ReviewSeverityRank(severity) {
+			count++
+		}
+	}
+	return count
+}
+
+// ReviewSeverityRank returns the position of a severity in
+// ReviewSeverities, or -1 if it isn't one
+func ReviewSeverityRank(severity string) int {
+	for i, s := range ReviewSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// numberedPatch returns the hunks of a patch with the line number in the
+// newer file before each added and unchanged line, so comments can cite them
+func numberedPatch(patch string) string {
+	var sb strings.Builder
+	line := 0
+	inHunk := false
+	for _, text := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if match := newHunkStart.FindStringSubmatch(text); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			inHunk = true
+			sb.WriteString(text + "\n")
+			continue
+		}
+		if !inHunk {
+			continue // File headers
+		}
+		switch {
+		case strings.HasPrefix(text, "-"):
+			sb.WriteString(fmt.Sprintf("%6s %s\n", "", text))
+		case strings.HasPrefix(text, "\\"):
+			sb.WriteString(fmt.Sprintf("%6s %s\n", "", text))
+		default:
+			sb.WriteString(fmt.Sprintf("%6d %s\n", line, text))
+			line++
+		}
+	}
+	return sb.String()
+}
+
+// reviewRelated returns the signatures of the functions the touched chunks
+// call, and the chunks outside them that call the touched functions
+func reviewRelated(touched []storage.CodeChunk, input DiffSummaryInput) ([]string, []storage.CodeChunk) {
+	isTouched := make(map[string]bool)
+	changedNames := make(map[string]bool)
+	for _, chunk := range touched {
+		isTouched[fmt.Sprintf("%s:%d", chunk.File, chunk.StartLine)] = true
+		if chunk.Function != "" {
+			changedNames[chunk.Function] = true
+		}
+	}
+
+	// Changed files at their newer version take precedence over the index
+	candidates := append(append([]storage.CodeChunk(nil), input.ChangedChunks...), input.Context...)
+	definitions := make(map[string]storage.CodeChunk)
+	for _, chunk := range candidates {
+		if _, ok := definitions[chunk.Function]; chunk.Function != "" && !ok {
+			definitions[chunk.Function] = chunk
+		}
+	}
+
+	var callees []string
+	seen := make(map[string]bool)
+	for _, chunk := range touched {
+		for _, name := range chunk.CalledFunctions() {
+			def, ok := definitions[name]
+			if !ok || changedNames[name] || seen[name] || len(callees) == reviewMaxCallees {
+				continue
+			}
+			seen[name] = true
+			callees = append(callees, fmt.Sprintf("%s:%d %s", def.File, def.StartLine, chunkSignature(def.Content)))
+		}
+	}
+
+	var callers []storage.CodeChunk
+	for _, chunk := range candidates {
+		if len(callers) == reviewMaxCallers {
+			break
+		}
+		if isTouched[fmt.Sprintf("%s:%d", chunk.File, chunk.StartLine)] {
+			continue
+		}
+		for _, name := range chunk.CalledFunctions() {
+			if changedNames[name] {
+				callers = append(callers, chunk)
+				break
+			}
+		}
+	}
+	return callees, callers
+}
+
+// buildReviewPrompt creates the prompt for a code review of a diff
+func buildReviewPrompt(input DiffSummaryInput, options SummaryOptions) string {
+	var sb strings.Builder
+	sb.WriteString("You are reviewing a change to a codebase as an experienced maintainer. ")
+	sb.WriteString("Find the problems a careful reviewer would raise: bugs, security issues, unhandled errors, race conditions, ")
+	sb.WriteString("performance problems, breaking changes to callers, missing tests, and code that is hard to follow. ")
+	sb.WriteString("Check the changed code against the functions it calls and the code calling it, shown below. ")
+	sb.WriteString("Only comment on the changed lines and what they affect; don't praise, and don't restate what the code does.\n")
+	switch options.DetailLevel {
+	case DetailBrief:
+		sb.WriteString("Only raise blocker and major issues.\n")
+	case DetailComprehensive:
+		sb.WriteString("Also raise minor issues and nits on naming, duplication, and documentation.\n")
+	}
+
+	sb.WriteString("\nReply with only a JSON object of this form:\n")
+	sb.WriteString(`{"summary": "<overall assessment in two or three sentences>", "comments": [{"file": "<path as in the diff>", `)
+	sb.WriteString(`"line": <first line>, "end_line": <last line, optional>, "severity": "<` + strings.Join(ReviewSeverities, "|") + `>", `)
+	sb.WriteString(`"category": "<bug|security|performance|error-handling|concurrency|api|tests|readability>", `)
+	sb.WriteString(`"message": "<the problem and why it matters>", "suggestion": "<replacement code for the lines, optional>"}]}` + "\n")
+	sb.WriteString("Line numbers are those of the newer file, shown before each line of the diff. Reply with an empty comments list if the change looks good.\n")
+
+	if len(input.Commits) > 0 {
+		sb.WriteString("\nCommits:\n")
+		for i, subject := range input.Commits {
+			if i == diffMaxCommits {
+				sb.WriteString(fmt.Sprintf("- ... and %d more\n", len(input.Commits)-i))
+				break
+			}
+			sb.WriteString("- " + subject + "\n")
+		}
+	}
+
+	// The patches, the callees, and the callers share the rest of the
+	// budget, with what one leaves passing to the next
+	budget := newTokenBudget(MaxPromptTokens-pricing.EstimateTokens(sb.String()), 0.7, 0.05, 0.25)
+
+	sb.WriteString("\nDiff:\n")
+	var headers, patches []string
+	for _, change := range input.Changes {
+		if change.Binary || change.Patch == "" {
+			continue
+		}
+		path := change.Path
+		if change.OldPath != "" {
+			path = change.OldPath + " -> " + change.Path
+		}
+		headers = append(headers, fmt.Sprintf("\n=== %s (%s) ===\n", path, change.Status))
+		patches = append(patches, numberedPatch(change.Patch))
+	}
+	omitted := 0
+	for i, patch := range budget.next().fitAll(headers, patches) {
+		if patch == "" {
+			omitted++
+			continue
+		}
+		sb.WriteString(headers[i] + strings.TrimSuffix(patch, "\n") + "\n")
+	}
+	if omitted > 0 {
+		sb.WriteString(fmt.Sprintf("\n...[patches of %d more files omitted]...\n", omitted))
+	}
+
+	callees, callers := reviewRelated(touchedChunks(input), input)
+	calleeBudget := budget.next()
+	if len(callees) > 0 {
+		if text, ok := calleeBudget.fit("- " + strings.Join(callees, "\n- ") + "\n"); ok {
+			sb.WriteString("\nFunctions called by the changed code:\n")
+			sb.WriteString(text)
+		}
+	}
+	if len(callers) > 0 {
+		headers = headers[:0]
+		var contents []string
+		for _, chunk := range callers {
+			headers = append(headers, fmt.Sprintf("\n--- %s:%d-%d ---\n", chunk.File, chunk.StartLine, chunk.EndLine))
+			contents = append(contents, chunk.Content)
+		}
+		fitted := budget.next().fitAll(headers, contents)
+		if slices.ContainsFunc(fitted, func(content string) bool { return content != "" }) {
+			sb.WriteString("\nCode calling the changed functions (check it still works with the change):\n")
+		}
+		for i, content := range fitted {
+			if content != "" {
+				sb.WriteString(headers[i] + content + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,152 @@
+package summarization
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// securityCategory is a class of security-sensitive code found by pattern matching
+type securityCategory struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// Risky code patterns, checked line by line
+var securityCategories = []securityCategory{
+	{"Authentication and secrets", regexp.MustCompile(`(?i)\b(password|passwd|secret|api[_-]?key|access[_-]?token|bearer|jwt|oauth|session|login|authenticate|authorize)\b`)},
+	{"Cryptography and randomness", regexp.MustCompile(`(?i)\b(md5|sha1|des|rc4|ecb|cipher|encrypt|decrypt|hmac|math/rand|random\.random|Math\.random|InsecureSkipVerify|verify\s*=\s*False|x509)\b`)},
+	{"SQL construction", regexp.MustCompile(`(?i)((select|insert|update|delete)\s.*(\+\s*\w|%s|%v|\$\{|\{\w+\})|\.(Exec|Query|QueryRow|execute|executemany|raw)\s*\(\s*(f?["'` + "`" + `].*(\+|%|\{)|\w+\s*\+))`)},
+	{"Command execution and eval", regexp.MustCompile(`\b(exec\.Command|os\.system|os\.popen|subprocess\.|shell\s*=\s*True|child_process|execSync|spawn\(|eval\(|exec\(|new Function\(|Runtime\.getRuntime\(\)\.exec|Process\.Start)`)},
+	{"Deserialization", regexp.MustCompile(`\b(pickle\.loads?|yaml\.load\(|marshal\.loads|ObjectInputStream|BinaryFormatter|unserialize\()`)},
+	{"File system access", regexp.MustCompile(`\b(os\.(Open|OpenFile|Create|WriteFile|ReadFile|Remove|RemoveAll|Chmod)|ioutil\.(ReadFile|WriteFile)|filepath\.Join|open\(|fs\.(readFile|writeFile|unlink)|File\.(Open|ReadAll|WriteAll)|new File\()`)},
+	{"Network I/O", regexp.MustCompile(`\b(http\.(Get|Post|NewRequest|ListenAndServe|HandleFunc)|net\.(Dial|Listen)|requests\.(get|post|put|delete)|urllib|urlopen|socket\.|fetch\(|axios|HttpClient|WebClient|grpc\.Dial)`)},
+}
+
+// Maximum characters of a single flagged chunk included in a security prompt
+const securityChunkMaxChars = 2500
+
+// securityChunksPerCategory returns how many chunks to include per category for a detail level
+func securityChunksPerCategory(detailLevel DetailLevel) int {
+	switch detailLevel {
+	case DetailBrief:
+		return 3
+	case DetailComprehensive:
+		return 10
+	default:
+		return 6
+	}
+}
+
+// securityHit is a chunk flagged for a category, with the matching line numbers
+type securityHit struct {
+	Chunk storage.CodeChunk
+	Lines []int
+}
+
+// findSecurityHits flags chunks matching each risky pattern category, most
+// matches first, skipping chunks already shown under an earlier category
+func findSecurityHits(chunks []storage.CodeChunk, options SummaryOptions) map[string][]securityHit {
+	hits := make(map[string][]securityHit)
+	shown := make(map[string]bool)
+	limit := securityChunksPerCategory(options.DetailLevel)
+
+	for _, category := range securityCategories {
+		var candidates []securityHit
+		for _, chunk := range chunks {
+			var lines []int
+			for i, line := range strings.Split(chunk.Content, "\n") {
+				if category.Pattern.MatchString(line) {
+					lines = append(lines, chunk.StartLine+i)
+				}
+			}
+			if len(lines) > 0 {
+				candidates = append(candidates, securityHit{Chunk: chunk, Lines: lines})
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return len(candidates[i].Lines) > len(candidates[j].Lines)
+		})
+
+		for _, hit := range candidates {
+			key := fmt.Sprintf("%s:%d", hit.Chunk.File, hit.Chunk.StartLine)
+			if shown[key] {
+				continue
+			}
+			shown[key] = true
+			hits[category.Name] = append(hits[category.Name], hit)
+			if len(hits[category.Name]) == limit {
+				break
+			}
+		}
+	}
+
+	return hits
+}
+
+// numberLines prefixes each line of content with its line number in the file
+func numberLines(content string, startLine int) string {
+	if startLine <= 0 {
+		startLine = 1
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = fmt.Sprintf("%5d  %s", startLine+i, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// buildSecurityPrompt creates the prompt for a security review of flagged code
+func buildSecurityPrompt(chunks []storage.CodeChunk, repoStructure []FileStructure, options SummaryOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are a senior application security engineer reviewing this codebase. ")
+	sb.WriteString("The code below was flagged by pattern matching as security-sensitive; many matches will be benign. ")
+	sb.WriteString("Identify real weaknesses such as injection, command execution with untrusted input, hard-coded or logged secrets, ")
+	sb.WriteString("weak cryptography, unsafe deserialization, path traversal, missing TLS verification, and SSRF. ")
+	sb.WriteString("Every finding must cite file:line using the line numbers shown. Don't report issues you can't see in the code.")
+
+	sb.WriteString("\n\nCodebase Context:\n")
+	sb.WriteString("- Primary Languages: " + getMainLanguages(repoStructure) + "\n")
+	sb.WriteString(fmt.Sprintf("- Total Files: %d\n", len(repoStructure)))
+
+	hits := findSecurityHits(chunks, options)
+	sb.WriteString("\n\nFlagged code by category:\n")
+	for _, category := range securityCategories {
+		categoryHits := hits[category.Name]
+		if len(categoryHits) == 0 {
+			continue
+		}
+
+		sb.WriteString("\n### " + category.Name + "\n")
+		for _, hit := range categoryHits {
+			content := hit.Chunk.Content
+			if len(content) > securityChunkMaxChars {
+				content = content[:securityChunkMaxChars] + "\n...[truncated]..."
+			}
+
+			var lines []string
+			for _, line := range hit.Lines {
+				lines = append(lines, fmt.Sprint(line))
+			}
+			sb.WriteString(fmt.Sprintf("\n--- %s (matched lines %s) ---\n%s\n",
+				hit.Chunk.File, strings.Join(lines, ", "), numberLines(content, hit.Chunk.StartLine)))
+		}
+	}
+	if len(hits) == 0 {
+		sb.WriteString("(no security-sensitive patterns matched)\n")
+	}
+
+	sb.WriteString("\n\nWrite the report with these sections:\n")
+	sb.WriteString("1. Summary - overall security posture and the most serious risks\n")
+	sb.WriteString("2. Findings - one entry per issue, most severe first, each with: severity (Critical/High/Medium/Low), ")
+	sb.WriteString("file:line, what is wrong, how it could be exploited, and a concrete fix\n")
+	sb.WriteString("3. Sensitive Areas Reviewed - flagged areas that look safe and why\n")
+	sb.WriteString("4. Recommendations - broader hardening steps for this codebase\n")
+
+	return sb.String()
+}
@@ -2,88 +2,146 @@ package summarization
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
+	"log/slog"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/sashabaranov/go-openai"
-	"codie/internal/storage"
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/graph"
+	"github.com/exolottl/codie/internal/pricing"
+	"github.com/exolottl/codie/internal/quality"
+	"github.com/exolottl/codie/internal/storage"
 )
 
 // FileStructure represents the structure of a file in the codebase
 type FileStructure struct {
 	Path     string `json:"path"`
 	Language string `json:"language"`
+	Package  string `json:"package,omitempty"` // Declared package, module, or namespace
 	LOC      int    `json:"loc"`
 }
 
 // SummaryOptions configures the behavior of the summarization process
 type SummaryOptions struct {
-	DetailLevel    string // "brief", "standard", or "comprehensive"
-	FocusPath      string // Optional subdirectory to focus on
+	Mode           Mode        // One of SummaryModes; empty is an overview
+	DetailLevel    DetailLevel // One of DetailLevels; empty is standard
+	Focus          []string // Paths or glob patterns of the files to summarize (empty covers all)
+	Exclude        []string // Paths or glob patterns of files left out of the summary
+	Audience       string   // One of Audiences; empty writes for developers
 	IncludeMetrics bool   // Include code metrics in summary
 }
 
 // DefaultSummaryOptions returns the default options for summarization
 func DefaultSummaryOptions() SummaryOptions {
 	return SummaryOptions{
-		DetailLevel:    "standard",
-		FocusPath:      "",
+		Mode:           ModeOverview,
+		DetailLevel:    DetailStandard,
+		Audience:       "developer",
 		IncludeMetrics: true,
 	}
 }
 
+// Functions, files, and duplicates listed in the code metrics of a summary prompt
+const summaryMetricsTop = 10
+
 // GenerateRepoSummary creates a summary of the codebase using OpenAI
-func GenerateRepoSummary(embeddingsPath string, options SummaryOptions) (string, error) {
+func GenerateRepoSummary(ctx context.Context, embeddingsPath string, options SummaryOptions) (SummaryResult, error) {
+	options, err := options.Normalize()
+	if err != nil {
+		return SummaryResult{}, err
+	}
+
 	// Load embeddings from file
-	chunks, err := loadCodeChunks(embeddingsPath)
+	chunks, err := storage.LoadFromJSON(embeddingsPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to load embeddings: %v", err)
+		return SummaryResult{}, fmt.Errorf("failed to load embeddings: %v", err)
+	}
+
+	// Narrow the summary to the focus before files are ranked, so the prompt
+	// is filled with the focused code. The test coverage of focused code is
+	// mapped from tests anywhere in the index.
+	filter := newPathFilter(chunks, options)
+	allChunks := chunks
+	if chunks = filter.filterChunks(chunks); len(chunks) == 0 {
+		return SummaryResult{}, fmt.Errorf("no indexed files match the focus and exclude patterns")
 	}
 
 	// Create a map of files and their code chunks
 	fileChunks := organizeChunksByFile(chunks)
 
 	// Get high-level file structure
-	repoStructure := analyzeRepoStructure(fileChunks)
+	repoStructure := analyzeRepoStructure(fileChunks, filePackages(chunks))
 
-	// Generate file importance/relevance metrics
-	fileImportance := calculateFileImportance(repoStructure, fileChunks)
+	// Generate file importance/relevance metrics, with centrality taken from
+	// the import and call graph
+	fileGraph, err := graph.Open(embeddingsPath, allChunks)
+	if err != nil {
+		slog.Warn("Failed to save the dependency graph", "path", graph.Path(embeddingsPath), "error", err)
+	}
+	fileImportance := calculateFileImportance(repoStructure, fileChunks, fileGraph.PageRank())
+	boostRecentFiles(fileImportance, storage.RootDir(allChunks))
 
 	// Analyze dependencies
 	dependencies := extractDependencies(fileChunks)
 
 	// Build the prompt for OpenAI
-	prompt := buildSummaryPrompt(repoStructure, fileChunks, fileImportance, dependencies, options)
-
-	// Get summary from OpenAI
-	summary, err := getAISummary(prompt, options)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate summary: %v", err)
-	}
-
-	return summary, nil
-}
-
-// loadCodeChunks loads the code chunks from the embeddings file
-func loadCodeChunks(embeddingsPath string) ([]storage.CodeChunk, error) {
-	data, err := os.ReadFile(embeddingsPath)
-	if err != nil {
-		return nil, err
+	var prompt string
+	switch options.Mode {
+	case ModeOnboarding:
+		prompt = buildOnboardingPrompt(storage.RootDir(chunks), chunks, repoStructure, fileChunks, fileImportance, options)
+	case ModeSecurity:
+		prompt = buildSecurityPrompt(chunks, repoStructure, options)
+	case ModeTests:
+		prompt = buildTestCoveragePrompt(allChunks, filter, repoStructure)
+	case ModeDocs:
+		prompt = buildDocsPrompt(chunks, repoStructure, fileImportance, options)
+	default:
+		// Select code for the prompt by embedding similarity to summary topics,
+		// falling back to the file importance heuristic if retrieval fails
+		retrieved, err := retrieveTopicContext(ctx, chunks, options)
+		if err != nil {
+			slog.Warn("Semantic retrieval unavailable, selecting files heuristically", "error", err)
+			retrieved = nil
+		}
+		// Measurements for the Code Quality section
+		var codeMetrics string
+		if options.IncludeMetrics {
+			codeMetrics = quality.Analyze(chunks).Relative(storage.RootDir(chunks)).Text(summaryMetricsTop)
+		}
+		prompt = buildSummaryPrompt(repoStructure, fileChunks, fileImportance, dependencies, retrieved, codeMetrics, options)
 	}
 
-	var chunks []storage.CodeChunk
-	err = json.Unmarshal(data, &chunks)
+	// Get summary from OpenAI
+	reply, err := getAISummary(ctx, prompt, options)
 	if err != nil {
-		return nil, err
-	}
-
-	return chunks, nil
+		return SummaryResult{}, fmt.Errorf("failed to generate summary: %v", err)
+	}
+
+	return SummaryResult{
+		Text:     reply.Text,
+		Sections: SplitSections(reply.Text),
+		Metadata: SummaryMetadata{
+			Mode:        options.Mode,
+			DetailLevel: options.DetailLevel,
+			Audience:    options.Audience,
+			Focus:       options.Focus,
+			Exclude:     options.Exclude,
+			Provider:    Provider,
+			Model:       ChatModel,
+			Files:       len(fileChunks),
+			Chunks:      len(chunks),
+			GeneratedAt: time.Now(),
+		},
+		Usage: TokenUsage{
+			PromptTokens:     reply.PromptTokens,
+			CompletionTokens: reply.CompletionTokens,
+			EstimatedCost:    pricing.EstimateCost(ChatModel, reply.PromptTokens, reply.CompletionTokens),
+		},
+	}, nil
 }
 
 // organizeChunksByFile groups code chunks by their source file
@@ -97,8 +155,21 @@ func organizeChunksByFile(chunks []storage.CodeChunk) map[string][]string {
 	return fileChunks
 }
 
+// filePackages maps each file to the package recorded for its chunks
+func filePackages(chunks []storage.CodeChunk) map[string]string {
+	packages := make(map[string]string)
+
+	for _, chunk := range chunks {
+		if chunk.Package != "" && packages[chunk.File] == "" {
+			packages[chunk.File] = chunk.Package
+		}
+	}
+
+	return packages
+}
+
 // analyzeRepoStructure extracts the structure of the repository
-func analyzeRepoStructure(fileChunks map[string][]string) []FileStructure {
+func analyzeRepoStructure(fileChunks map[string][]string, packages map[string]string) []FileStructure {
 	var structure []FileStructure
 
 	for filePath, chunks := range fileChunks {
@@ -108,13 +179,13 @@ func analyzeRepoStructure(fileChunks map[string][]string) []FileStructure {
 			loc += len(strings.Split(chunk, "\n"))
 		}
 
-		// Determine language from file extension
-		ext := filepath.Ext(filePath)
-		language := getLanguageFromExtension(ext)
+		// Determine language from file name
+		language := LanguageForFile(filePath)
 
 		structure = append(structure, FileStructure{
 			Path:     filePath,
 			Language: language,
+			Package:  packages[filePath],
 			LOC:      loc,
 		})
 	}
@@ -151,6 +222,10 @@ func getLanguageFromExtension(ext string) string {
 		".sh":    "Shell",
 		".bat":   "Batch",
 		".ps1":   "PowerShell",
+		".tf":    "Terraform",
+		".tfvars": "Terraform",
+		".hcl":   "HCL",
+		".proto": "Protocol Buffers",
 	}
 
 	if lang, ok := languages[ext]; ok {
@@ -159,6 +234,14 @@ func getLanguageFromExtension(ext string) string {
 	return "Unknown"
 }
 
+// LanguageForFile returns the language of a file from its name, or "Unknown"
+func LanguageForFile(path string) string {
+	if fileutils.IsDockerfile(path) {
+		return "Dockerfile"
+	}
+	return getLanguageFromExtension(filepath.Ext(path))
+}
+
 // getMainLanguages returns a comma-separated list of the most common languages in the repo
 func getMainLanguages(repoStructure []FileStructure) string {
 	langCount := make(map[string]int)
@@ -282,13 +365,14 @@ func extractDependencies(fileChunks map[string][]string) string {
 	return sb.String()
 }
 
-// calculateFileImportance determines which files are most important in the codebase
-func calculateFileImportance(repoStructure []FileStructure, fileChunks map[string][]string) map[string]float64 {
+// calculateFileImportance determines which files are most important in the
+// codebase. Most of the weight goes to each file's PageRank over the import
+// and call graph, with the rest from its size, imports, and code patterns.
+func calculateFileImportance(repoStructure []FileStructure, fileChunks map[string][]string, pageRank map[string]float64) map[string]float64 {
 	importance := make(map[string]float64)
 	
-	// Map to track imports between files
+	// Map to track imports in each file
 	importMap := make(map[string]int)
-	importedBy := make(map[string]int)
 	
 	// Scan for imports and key patterns
 	for filePath, chunks := range fileChunks {
@@ -335,44 +419,8 @@ func calculateFileImportance(repoStructure []FileStructure, fileChunks map[strin
 			patternScore += float64(countMatches(content, `if\s+__name__\s*==\s*["']__main__["']`)) * 5 // Main block
 		}
 		
-		// Cross-reference imports to determine imported-by count
-		for otherFilePath, otherChunks := range fileChunks {
-			if otherFilePath == filePath {
-				continue
-			}
-			
-			otherContent := strings.Join(otherChunks, "\n")
-			
-			// Extract filename without extension
-			baseNameWithExt := filepath.Base(filePath)
-			baseName := strings.TrimSuffix(baseNameWithExt, filepath.Ext(baseNameWithExt))
-			
-			// Count references to this file in other files
-			if strings.Contains(otherContent, baseName) {
-				importedBy[filePath]++
-			}
-		}
-		
-		// Calculate file path depth score
-		pathSegments := strings.Split(filePath, string(os.PathSeparator))
-		depth := len(pathSegments)
-		
-		// Files in important directories get a boost
-		pathScore := 0.0
-		lowerPath := strings.ToLower(filePath)
-		if strings.Contains(lowerPath, "main") || strings.Contains(lowerPath, "cmd") {
-			pathScore += 2.0
-		}
-		if strings.Contains(lowerPath, "api") || strings.Contains(lowerPath, "internal") {
-			pathScore += 1.5
-		}
-		if strings.Contains(lowerPath, "core") || strings.Contains(lowerPath, "model") || 
-		   strings.Contains(lowerPath, "service") || strings.Contains(lowerPath, "controller") {
-			pathScore += 1.8
-		}
-		if strings.Contains(lowerPath, "util") || strings.Contains(lowerPath, "helper") {
-			pathScore += 0.7
-		}
+		// PageRank scaled so that a file of average centrality scores 1
+		centrality := pageRank[filePath] * float64(len(fileChunks))
 		
 		// File size factor (normalize LOC)
 		var fileLOC int
@@ -390,10 +438,8 @@ func calculateFileImportance(repoStructure []FileStructure, fileChunks map[strin
 		// Calculate final importance score
 		importance[filePath] = (
 			locFactor * 0.2 +                        // Size of file
-			(1.0 / float64(depth)) * 0.15 +          // Depth in directory tree
-			pathScore * 0.2 +                        // Important directory names
 			float64(importMap[filePath]) * 0.15 +    // Number of imports (complexity)
-			float64(importedBy[filePath]) * 0.2 +    // How many files import this one (centrality)
+			centrality * 0.55 +                      // PageRank over the import and call graph
 			patternScore * 0.1) * 10                       // Important code patterns
 	}
 	
@@ -408,19 +454,17 @@ func countMatches(text, pattern string) int {
 
 // buildSummaryPrompt creates the prompt for the OpenAI API
 func buildSummaryPrompt(repoStructure []FileStructure, fileChunks map[string][]string, 
-	fileImportance map[string]float64, dependencies string, options SummaryOptions) string {
+	fileImportance map[string]float64, dependencies string, retrieved []retrievedTopic, codeMetrics string, options SummaryOptions) string {
 	var sb strings.Builder
+	reader := audienceFor(options.Audience)
 	
-	// Enhanced instruction with professional guidance
-	sb.WriteString("You are analyzing a software codebase. Your task is to create a professional, ")
-	sb.WriteString("technically precise summary that would help a developer understand this project quickly. ")
-	sb.WriteString("Focus on identifying architectural patterns, key abstractions, and the overall design philosophy. ")
-	sb.WriteString("When code follows well-known patterns or frameworks, explicitly name them. ")
+	// Enhanced instruction with professional guidance for the audience
+	sb.WriteString(reader.instruction)
 	
-	if options.DetailLevel == "comprehensive" {
+	if options.DetailLevel == DetailComprehensive {
 		sb.WriteString("Provide detailed explanations of key functionality, design patterns, and implementation decisions. ")
 		sb.WriteString("Include technical nuances and considerations for future development.")
-	} else if options.DetailLevel == "brief" {
+	} else if options.DetailLevel == DetailBrief {
 		sb.WriteString("Keep the summary concise and focused on the most essential components. ")
 		sb.WriteString("Prioritize clarity and high-level understanding over implementation details.")
 	} else {
@@ -428,6 +472,11 @@ func buildSummaryPrompt(repoStructure []FileStructure, fileChunks map[string][]s
 		sb.WriteString("Include enough context for developers to understand the project's approach.")
 	}
 	
+	// Monolingual repos get language-specific guidance; polyglot repos keep the generic prompt
+	if template, ok := languageTemplates[dominantLanguage(repoStructure)]; ok {
+		sb.WriteString("\n\n" + template)
+	}
+	
 	// Add structured context about the codebase
 	sb.WriteString("\n\nCodebase Context:\n")
 	sb.WriteString("- Primary Languages: " + getMainLanguages(repoStructure) + "\n")
@@ -441,176 +490,234 @@ func buildSummaryPrompt(repoStructure []FileStructure, fileChunks map[string][]s
 	sb.WriteString("3. Next, identify relationships between components\n")
 	sb.WriteString("4. Finally, synthesize findings into a cohesive summary\n")
 	
-	// File structure section
-	sb.WriteString("\n\nCodebase structure:\n")
+	// The closing instructions are written first so the budget counts them
+	var closing strings.Builder
 	
-	// Group files by directory for better organization
-	dirMap := make(map[string][]FileStructure)
-	for _, file := range repoStructure {
-		dir := filepath.Dir(file.Path)
-		dirMap[dir] = append(dirMap[dir], file)
+	// Example of good summary style for guidance
+	if options.DetailLevel != DetailBrief && reader.styleExample {
+		closing.WriteString("\n\nExample of good summary style:\n")
+		closing.WriteString("\"This project implements a REST API service using a hexagonal architecture. ")
+		closing.WriteString("The core domain logic is isolated in the 'domain' package, with separate ")
+		closing.WriteString("adapter layers for HTTP routing (using Echo framework), persistence (PostgreSQL), ")
+		closing.WriteString("and external integrations. The codebase follows dependency injection principles ")
+		closing.WriteString("with interfaces defined at domain boundaries...\"\n")
 	}
 	
-	// Print directories and their files
-	var dirs []string
-	for dir := range dirMap {
-		dirs = append(dirs, dir)
+	// Instructions for output format with self-critique
+	closing.WriteString("\n\nPlease format the summary with the following sections:\n")
+	sections := reader.sections
+	if options.IncludeMetrics {
+		sections = append(sections[:len(sections):len(sections)], reader.quality)
 	}
-	sort.Strings(dirs)
-	
-	for _, dir := range dirs {
-		if dir == "." {
-			sb.WriteString("Root directory:\n")
-		} else {
-			sb.WriteString(fmt.Sprintf("Directory %s:\n", dir))
-		}
-		
-		for _, file := range dirMap[dir] {
-			sb.WriteString(fmt.Sprintf("  - %s (%s, %d lines)\n", 
-				filepath.Base(file.Path), file.Language, file.LOC))
-		}
+	for i, section := range sections {
+		closing.WriteString(fmt.Sprintf("%d. %s\n", i+1, section))
 	}
 	
-	// Add dependency information
-	sb.WriteString("\n\nProject Dependencies:\n")
-	sb.WriteString(dependencies)
+	// Request self-critique
+	closing.WriteString("\nAfter drafting your summary, please review it against these quality criteria:\n")
+	closing.WriteString("- Technical accuracy: Are architectural terms used correctly?\n")
+	closing.WriteString("- Comprehensiveness: Does it cover all major aspects of the codebase?\n")
+	closing.WriteString("- Clarity: Would " + reader.reader + " understand the project from this description?\n")
+	closing.WriteString("- Insight: Does it provide useful insights beyond what's immediately obvious?\n")
 	
-	// Include most important files content
-	sb.WriteString("\n\nKey files content:\n")
+	// Structure, dependencies, metrics, and code share the rest of the
+	// budget, with what one section leaves passing to the next
+	budget := newTokenBudget(MaxPromptTokens-pricing.EstimateTokens(sb.String()+closing.String()), 0.2, 0.1, 0.1, 0.6)
 	
-	// Find top important files
-	type fileScore struct {
-		path  string
-		score float64
+	// File structure section
+	sb.WriteString("\n\nCodebase structure:\n")
+	
+	// Group files by logical package, falling back to directory when unknown,
+	// and list just the groups when the files don't fit
+	structure := budget.next()
+	var listing strings.Builder
+	writeStructureSection(&listing, repoStructure, false)
+	if pricing.EstimateTokens(listing.String()) > structure.left {
+		listing.Reset()
+		writeStructureSection(&listing, repoStructure, true)
 	}
-	var scores []fileScore
-	for path, score := range fileImportance {
-		scores = append(scores, fileScore{path, score})
+	if text, ok := structure.fit(listing.String()); ok {
+		sb.WriteString(text)
 	}
 	
-	// Sort by importance (higher score first)
-	sort.Slice(scores, func(i, j int) bool {
-		return scores[i].score > scores[j].score
-	})
+	// Add dependency information
+	sb.WriteString("\n\nProject Dependencies:\n")
+	if text, ok := budget.next().fit(dependencies); ok {
+		sb.WriteString(text)
+	}
 	
-	// Include top files based on detail level
-	topFilesCount := 5
-	if options.DetailLevel == "comprehensive" {
-		topFilesCount = 10
-	} else if options.DetailLevel == "brief" {
-		topFilesCount = 3
+	// Measured complexity, length, and duplication to ground the quality assessment
+	metrics := budget.next()
+	if codeMetrics != "" {
+		if text, ok := metrics.fit(codeMetrics); ok {
+			sb.WriteString("\n\nCode Metrics (cyclomatic complexity, nesting depth, length, and duplicated chunks):\n")
+			sb.WriteString(text)
+		}
 	}
 	
-	// Add content of important files
-	for i := 0; i < len(scores) && i < topFilesCount; i++ {
-		filePath := scores[i].path
+	code := budget.next()
+	if len(retrieved) > 0 {
+		// Code retrieved per topic by embedding similarity
+		sb.WriteString("\n\nRelevant code, retrieved by topic:\n")
 		
-		// Focus check - if focus path is set, only include files in that path
-		if options.FocusPath != "" && !strings.HasPrefix(filePath, options.FocusPath) {
-			continue
+		// Excerpts share the code budget across topics
+		var headers, excerpts []string
+		for _, topic := range retrieved {
+			code.charge("\n### " + topic.Title + "\n")
+			headers = append(headers, topic.Headers...)
+			excerpts = append(excerpts, topic.Excerpts...)
 		}
+		fitted := code.fitAll(headers, excerpts)
 		
-		sb.WriteString(fmt.Sprintf("\n--- %s (Importance: %.2f) ---\n", filePath, scores[i].score))
+		for _, topic := range retrieved {
+			sb.WriteString("\n### " + topic.Title + "\n")
+			for range topic.Excerpts {
+				if fitted[0] != "" {
+					sb.WriteString(headers[0] + fitted[0] + "\n")
+				}
+				headers, fitted = headers[1:], fitted[1:]
+			}
+		}
+	} else {
+		// Include most important files content
+		sb.WriteString("\n\nKey files content:\n")
 		
-		// Join chunks for this file
-		content := strings.Join(fileChunks[filePath], "\n...\n")
+		// Find top important files
+		type fileScore struct {
+			path  string
+			score float64
+		}
+		var scores []fileScore
+		for path, score := range fileImportance {
+			scores = append(scores, fileScore{path, score})
+		}
 		
-		// If file is too large, include just beginning and end
-		if len(content) > 4000 && options.DetailLevel != "comprehensive" {
-			contentLines := strings.Split(content, "\n")
-			if len(contentLines) > 100 {
-				beginLines := contentLines[:50]
-				endLines := contentLines[len(contentLines)-50:]
-				content = strings.Join(beginLines, "\n") + "\n...[middle section omitted]...\n" + strings.Join(endLines, "\n")
-			}
+		// Sort by importance (higher score first)
+		sort.Slice(scores, func(i, j int) bool {
+			return scores[i].score > scores[j].score
+		})
+		
+		// Include top files based on detail level
+		topFilesCount := 5
+		if options.DetailLevel == DetailComprehensive {
+			topFilesCount = 10
+		} else if options.DetailLevel == DetailBrief {
+			topFilesCount = 3
 		}
+		scores = scores[:min(topFilesCount, len(scores))]
 		
-		sb.WriteString(content)
-		sb.WriteString("\n")
-	}
-	
-	// Example of good summary style for guidance
-	if options.DetailLevel != "brief" {
-		sb.WriteString("\n\nExample of good summary style:\n")
-		sb.WriteString("\"This project implements a REST API service using a hexagonal architecture. ")
-		sb.WriteString("The core domain logic is isolated in the 'domain' package, with separate ")
-		sb.WriteString("adapter layers for HTTP routing (using Echo framework), persistence (PostgreSQL), ")
-		sb.WriteString("and external integrations. The codebase follows dependency injection principles ")
-		sb.WriteString("with interfaces defined at domain boundaries...\"\n")
-	}
-	
-	// Instructions for output format with self-critique
-	sb.WriteString("\n\nPlease format the summary with the following sections:\n")
-	sb.WriteString("1. Overview - What the project does and its main purpose\n")
-	sb.WriteString("2. Architecture - Main components and how they're organized\n")
-	sb.WriteString("3. Key Features - Important functionality implemented\n")
-	sb.WriteString("4. Implementation Details - Notable code patterns or techniques\n")
-	
-	if options.IncludeMetrics {
-		sb.WriteString("5. Code Quality - Assessment of structure, organization, and maintainability\n")
+		// Files share the code budget; those too large for their share keep
+		// their beginning and end
+		var headers, contents []string
+		for _, file := range scores {
+			headers = append(headers, fmt.Sprintf("\n--- %s (Importance: %.2f) ---\n", file.path, file.score))
+			contents = append(contents, strings.Join(fileChunks[file.path], "\n...\n"))
+		}
+		
+		omitted := 0
+		for i, content := range code.fitAll(headers, contents) {
+			if content == "" {
+				omitted++
+				continue
+			}
+			sb.WriteString(headers[i])
+			sb.WriteString(content)
+			sb.WriteString("\n")
+		}
+		if omitted > 0 {
+			sb.WriteString(fmt.Sprintf("\n...[%d more files omitted to fit the token budget]...\n", omitted))
+		}
 	}
 	
-	// Request self-critique
-	sb.WriteString("\nAfter drafting your summary, please review it against these quality criteria:\n")
-	sb.WriteString("- Technical accuracy: Are architectural terms used correctly?\n")
-	sb.WriteString("- Comprehensiveness: Does it cover all major aspects of the codebase?\n")
-	sb.WriteString("- Clarity: Would a developer understand the project from this description?\n")
-	sb.WriteString("- Insight: Does it provide useful insights beyond what's immediately obvious?\n")
+	sb.WriteString(closing.String())
 	
 	return sb.String()
 }
 
-// getAISummary sends the prompt to OpenAI and gets the summary
-func getAISummary(prompt string, options SummaryOptions) (string, error) {
-	// Get API key from environment
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY is not set")
+// writeStructureSection writes the codebase structure grouped by declared
+// package (so Java/C# layouts read by namespace) or by directory when no
+// package is known. Compact structures give each group's file and line
+// counts in place of its files.
+func writeStructureSection(sb *strings.Builder, repoStructure []FileStructure, compact bool) {
+	groups := make(map[string][]FileStructure)
+	for _, file := range repoStructure {
+		key := "dir:" + filepath.Dir(file.Path)
+		if file.Package != "" {
+			key = "pkg:" + file.Package
+		}
+		groups[key] = append(groups[key], file)
 	}
 
-	// Create client
-	client := openai.NewClient(apiKey)
+	var keys []string
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		files := groups[key]
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Path < files[j].Path
+		})
+
+		// Directories spanned by this group
+		dirSet := make(map[string]bool)
+		var dirs []string
+		for _, file := range files {
+			if dir := filepath.Dir(file.Path); !dirSet[dir] {
+				dirSet[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+
+		name := strings.SplitN(key, ":", 2)[1]
+		heading := fmt.Sprintf("Directory %s", name)
+		if strings.HasPrefix(key, "pkg:") {
+			heading = fmt.Sprintf("Package %s (%s)", name, strings.Join(dirs, ", "))
+		} else if name == "." {
+			heading = "Root directory"
+		}
 
+		if compact {
+			sb.WriteString(fmt.Sprintf("%s: %d files, %d lines\n", heading, len(files), calculateTotalLOC(files)))
+			continue
+		}
+		sb.WriteString(heading + ":\n")
+
+		for _, file := range files {
+			// Use full paths when a package spans several directories
+			displayName := filepath.Base(file.Path)
+			if len(dirs) > 1 {
+				displayName = file.Path
+			}
+			sb.WriteString(fmt.Sprintf("  - %s (%s, %d lines)\n",
+				displayName, file.Language, file.LOC))
+		}
+	}
+}
+
+// getAISummary sends the prompt to OpenAI and gets the summary
+func getAISummary(ctx context.Context, prompt string, options SummaryOptions) (ChatReply, error) {
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
 	defer cancel()
 
 	// Adjust temperature based on detail level
 	temperature := 0.2 // Default for standard
-	if options.DetailLevel == "comprehensive" {
+	if options.DetailLevel == DetailComprehensive {
 		temperature = 0.3 // Slightly more creative for detailed analysis
-	} else if options.DetailLevel == "brief" {
+	} else if options.DetailLevel == DetailBrief {
 		temperature = 0.1 // More focused for brief summaries
 	}
 
-	// Make API request with enhanced parameters
-	resp, err := client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: openai.GPT4o,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a senior software engineer specialized in analyzing and summarizing codebases. Your summaries are technically precise, insightful, and focused on helping developers understand architectural patterns and design decisions.",
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-			MaxTokens:   4000,
-			Temperature: float32(temperature),
-			TopP:        0.95,
-		},
-	)
-
-	if err != nil {
-		return "", err
+	// Overviews are written for their audience; other modes have their own structure
+	systemPrompt := summarySystemPrompt
+	if options.Mode == "" || options.Mode == ModeOverview {
+		systemPrompt = audienceFor(options.Audience).systemPrompt
 	}
 
-	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
-		return "", fmt.Errorf("empty response from OpenAI")
-	}
+	return chatReply(ctx, ChatModel, systemPrompt, prompt, 4000, float32(temperature))
+}
 
-	return resp.Choices[0].Message.Content, nil
-}
\ No newline at end of file
+// System prompt used for codebase summaries
+const summarySystemPrompt = "You are a senior software engineer specialized in analyzing and summarizing codebases. Your summaries are technically precise, insightful, and focused on helping developers understand architectural patterns and design decisions."
@@ -0,0 +1,254 @@
+package summarization
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/exolottl/codie/internal/imports"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Maximum number of test files whose opening lines are included in the prompt
+const testSampleFiles = 6
+
+// Lines shown from the start of each sampled test file
+const testSampleLines = 40
+
+// Maximum number of untested functions listed in the prompt
+const maxUntestedFunctions = 60
+
+// isTestFile reports whether a path follows a common test file naming convention
+func isTestFile(path string) bool {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	slashed := "/" + filepath.ToSlash(path)
+
+	switch ext {
+	case ".go":
+		return strings.HasSuffix(name, "_test")
+	case ".py":
+		return strings.HasPrefix(name, "test_") || strings.HasSuffix(name, "_test") || strings.Contains(slashed, "/tests/")
+	case ".js", ".jsx", ".ts", ".tsx":
+		return strings.HasSuffix(name, ".test") || strings.HasSuffix(name, ".spec") || strings.Contains(slashed, "/__tests__/")
+	case ".java", ".kt":
+		return strings.HasSuffix(name, "Test") || strings.HasSuffix(name, "Tests") || strings.Contains(slashed, "/src/test/")
+	case ".cs":
+		return strings.HasSuffix(name, "Test") || strings.HasSuffix(name, "Tests")
+	case ".rb":
+		return strings.HasSuffix(name, "_spec") || strings.HasSuffix(name, "_test")
+	}
+	return false
+}
+
+// testSubjectName returns the base name (without extension) of the source
+// file a test file is conventionally named after, e.g. foo_test.go -> foo
+func testSubjectName(path string) string {
+	base := filepath.Base(path)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+
+	for _, suffix := range []string{"_test", "_spec", ".test", ".spec", "Tests", "Test"} {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != name {
+			return trimmed
+		}
+	}
+	return strings.TrimPrefix(name, "test_")
+}
+
+// testCoverage maps test files to the source files they exercise
+type testCoverage struct {
+	TestFiles         []string
+	Exercises         map[string][]string // Test file -> source files it exercises
+	UntestedPackages  []string            // Source directories with no exercising tests
+	UntestedFunctions []string            // "file: function" never referenced by any test
+}
+
+// analyzeTestCoverage maps tests to code by naming convention, package
+// membership (Go tests live in the package they test), and resolved imports
+func analyzeTestCoverage(chunks []storage.CodeChunk) testCoverage {
+	byFile := make(map[string][]storage.CodeChunk)
+	for _, chunk := range chunks {
+		byFile[chunk.File] = append(byFile[chunk.File], chunk)
+	}
+
+	var sources []string
+	coverage := testCoverage{Exercises: make(map[string][]string)}
+	for _, file := range sortedFiles(byFile) {
+		if isTestFile(file) {
+			coverage.TestFiles = append(coverage.TestFiles, file)
+		} else {
+			sources = append(sources, file)
+		}
+	}
+
+	resolver := imports.NewResolver(byFile)
+	tested := make(map[string]bool)
+	var testContent strings.Builder
+	for _, test := range coverage.TestFiles {
+		subject := testSubjectName(test)
+		imported := make(map[string]bool)
+		for _, imp := range imports.ForFile(test, byFile[test]) {
+			for _, file := range resolver.Resolve(test, imp) {
+				imported[file] = true
+			}
+		}
+
+		for _, source := range sources {
+			sameDir := filepath.Dir(source) == filepath.Dir(test)
+			exercised := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source)) == subject ||
+				(sameDir && filepath.Ext(test) == ".go" && filepath.Ext(source) == ".go") ||
+				imported[source]
+
+			if exercised {
+				coverage.Exercises[test] = append(coverage.Exercises[test], source)
+				tested[source] = true
+			}
+		}
+
+		for _, chunk := range byFile[test] {
+			testContent.WriteString(chunk.Content + "\n")
+		}
+	}
+
+	// Packages with no exercised file
+	testedDirs := make(map[string]bool)
+	allDirs := make(map[string]bool)
+	for _, source := range sources {
+		dir := filepath.Dir(source)
+		allDirs[dir] = true
+		if tested[source] {
+			testedDirs[dir] = true
+		}
+	}
+	for dir := range allDirs {
+		if !testedDirs[dir] {
+			coverage.UntestedPackages = append(coverage.UntestedPackages, dir)
+		}
+	}
+	sort.Strings(coverage.UntestedPackages)
+
+	// Functions whose names never appear in any test
+	allTests := testContent.String()
+	for _, source := range sources {
+		for _, chunk := range byFile[source] {
+			if chunk.Function == "" || chunk.Function == "main" || chunk.Function == "init" {
+				continue
+			}
+			if !strings.Contains(allTests, chunk.Function) {
+				coverage.UntestedFunctions = append(coverage.UntestedFunctions, source+": "+chunk.Function)
+			}
+		}
+	}
+
+	return coverage
+}
+
+// buildTestCoveragePrompt creates the prompt for a test-coverage-oriented summary
+func buildTestCoveragePrompt(chunks []storage.CodeChunk, filter pathFilter, repoStructure []FileStructure) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are reviewing the automated tests of this codebase. ")
+	sb.WriteString("Describe the testing strategy, judge how well the important code is covered, and recommend the most valuable tests to add. ")
+	sb.WriteString("The mapping below was derived statically from file names and imports, so treat it as approximate.")
+
+	if template, ok := languageTemplates[dominantLanguage(repoStructure)]; ok {
+		sb.WriteString("\n\n" + template)
+	}
+
+	coverage := analyzeTestCoverage(chunks)
+	sourceCount := 0
+	for _, file := range repoStructure {
+		if !isTestFile(file.Path) {
+			sourceCount++
+		}
+	}
+
+	// Tests are listed when they, or code they exercise, are in focus
+	var tests []string
+	for _, test := range coverage.TestFiles {
+		if filter.includes(test) || slices.ContainsFunc(coverage.Exercises[test], filter.includes) {
+			tests = append(tests, test)
+		}
+	}
+	focusedDirs := make(map[string]bool)
+	for _, chunk := range filter.filterChunks(chunks) {
+		focusedDirs[filepath.Dir(chunk.File)] = true
+	}
+	var untestedPackages []string
+	for _, dir := range coverage.UntestedPackages {
+		if focusedDirs[dir] {
+			untestedPackages = append(untestedPackages, dir)
+		}
+	}
+
+	sb.WriteString("\n\nCodebase Context:\n")
+	sb.WriteString("- Primary Languages: " + getMainLanguages(repoStructure) + "\n")
+	sb.WriteString(fmt.Sprintf("- Source Files: %d\n", sourceCount))
+	sb.WriteString(fmt.Sprintf("- Test Files: %d\n", len(tests)))
+
+	sb.WriteString("\n\nTest files and the code they exercise:\n")
+	if len(tests) == 0 {
+		sb.WriteString("(no test files found)\n")
+	}
+	for _, test := range tests {
+		exercised := coverage.Exercises[test]
+		if len(exercised) == 0 {
+			sb.WriteString(fmt.Sprintf("- %s -> (no indexed source identified)\n", test))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("- %s -> %s\n", test, strings.Join(exercised, ", ")))
+	}
+
+	sb.WriteString("\n\nPackages without tests:\n")
+	if len(untestedPackages) == 0 {
+		sb.WriteString("(none)\n")
+	}
+	for _, dir := range untestedPackages {
+		sb.WriteString("- " + dir + "\n")
+	}
+
+	sb.WriteString("\n\nFunctions never referenced by a test:\n")
+	var untestedFunctions []string
+	for _, function := range coverage.UntestedFunctions {
+		if file, _, _ := strings.Cut(function, ": "); filter.includes(file) {
+			untestedFunctions = append(untestedFunctions, function)
+		}
+	}
+	for i, function := range untestedFunctions {
+		if i == maxUntestedFunctions {
+			sb.WriteString(fmt.Sprintf("- ... and %d more\n", len(untestedFunctions)-i))
+			break
+		}
+		sb.WriteString("- " + function + "\n")
+	}
+	if len(untestedFunctions) == 0 {
+		sb.WriteString("(none)\n")
+	}
+
+	// A sample of tests shows the style: frameworks, fixtures, table-driven tests, mocks
+	if len(tests) > 0 {
+		sb.WriteString("\n\nSample test files:\n")
+		fileChunks := organizeChunksByFile(chunks)
+		for i, test := range tests {
+			if i == testSampleFiles {
+				break
+			}
+			lines := strings.Split(strings.Join(fileChunks[test], "\n"), "\n")
+			if len(lines) > testSampleLines {
+				lines = append(lines[:testSampleLines], "...[rest of file omitted]...")
+			}
+			sb.WriteString(fmt.Sprintf("\n--- %s ---\n%s\n", test, strings.Join(lines, "\n")))
+		}
+	}
+
+	sb.WriteString("\n\nWrite the report with these sections:\n")
+	sb.WriteString("1. Testing Strategy - frameworks, kinds of tests (unit, integration, end-to-end), and conventions used\n")
+	sb.WriteString("2. Coverage Map - which areas are well tested and which aren't\n")
+	sb.WriteString("3. Gaps - the riskiest untested packages and functions, and why they matter\n")
+	sb.WriteString("4. Recommended Tests - the most valuable tests to add next, most valuable first\n")
+
+	return sb.String()
+}
@@ -0,0 +1,462 @@
+package summarization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/pricing"
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Suffix of the summary cache kept next to an index
+const summaryCacheSuffix = ".summaries.json"
+
+// Most tokens of a directory summary prompt, or MaxPromptTokens if fewer
+const directorySummaryMaxTokens = 12000
+
+// Summaries sent to the embeddings API per request
+const summaryEmbedBatchSize = 50
+
+// DirectoryTree holds the summaries of the directories of an indexed
+// codebase
+type DirectoryTree struct {
+	Root        string             `json:"root"`        // Directory the paths of the summaries are relative to
+	Directories []DirectorySummary `json:"directories"` // The root first, each directory before its subdirectories
+}
+
+// DirectorySummary is the summary of one directory of a codebase, written
+// from its files and the summaries of its subdirectories
+type DirectorySummary struct {
+	Path           string        `json:"path"` // "." is the root
+	Summary        string        `json:"summary"`
+	Files          []FileSummary `json:"files"`          // The directory's own files
+	Subdirectories []string      `json:"subdirectories"` // Paths of the directories directly below
+	Cached         bool          `json:"cached"`         // Whether it was reused from the summary cache
+}
+
+// FileSummary is a sentence on what a file does
+type FileSummary struct {
+	Path    string `json:"path"`
+	Summary string `json:"summary"` // Empty if the model didn't describe the file
+}
+
+// summaryCache holds the directory summaries of an index by path, each with
+// the hash of the prompt that wrote it. A directory whose prompt hasn't
+// changed, since neither its files nor its subdirectories' summaries have,
+// keeps its summary.
+type summaryCache struct {
+	Directories map[string]cachedDirectory `json:"directories"`
+}
+
+type cachedDirectory struct {
+	Hash           string              `json:"hash"`
+	Summary        DirectorySummary    `json:"summary"`
+	EmbeddingModel string              `json:"embedding_model,omitempty"`
+	Chunks         []storage.CodeChunk `json:"chunks"` // The summaries of the directory and its files, embedded for search; nil until embedded
+}
+
+// SummaryCachePath returns the path of the summary cache of an index
+func SummaryCachePath(indexPath string) string {
+	return indexPath + summaryCacheSuffix
+}
+
+// loadSummaryCache reads the summary cache of an index, which is empty if
+// it's missing or unreadable
+func loadSummaryCache(indexPath string) summaryCache {
+	cache := summaryCache{Directories: make(map[string]cachedDirectory)}
+	if data, err := os.ReadFile(SummaryCachePath(indexPath)); err == nil {
+		if json.Unmarshal(data, &cache) != nil || cache.Directories == nil {
+			cache.Directories = make(map[string]cachedDirectory)
+		}
+	}
+	return cache
+}
+
+// save writes the summary cache of an index
+func (c summaryCache) save(indexPath string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SummaryCachePath(indexPath), data, 0644)
+}
+
+// GenerateDirectorySummaries summarizes every directory of an index that
+// holds files in the focus of options, and each of their files, deepest
+// directories first so a directory's summary is written from those of its
+// subdirectories. Summaries whose prompts are unchanged since the last run
+// come from the summary cache.
+func GenerateDirectorySummaries(ctx context.Context, embeddingsPath string, options SummaryOptions) (DirectoryTree, error) {
+	options, err := options.Normalize()
+	if err != nil {
+		return DirectoryTree{}, err
+	}
+
+	chunks, err := storage.LoadFromJSON(embeddingsPath)
+	if err != nil {
+		return DirectoryTree{}, fmt.Errorf("failed to load embeddings: %v", err)
+	}
+	root := storage.RootDir(chunks)
+	if chunks = newPathFilter(chunks, options).filterChunks(chunks); len(chunks) == 0 {
+		return DirectoryTree{}, fmt.Errorf("no indexed files match the focus and exclude patterns")
+	}
+
+	// Files by directory, relative to the root, with every directory between
+	// them and the root
+	byFile := make(map[string][]storage.CodeChunk)
+	dirFiles := make(map[string][]string)
+	for _, chunk := range chunks {
+		rel := relativePath(root, chunk.File)
+		if _, ok := byFile[rel]; !ok {
+			dirFiles[filepath.Dir(rel)] = append(dirFiles[filepath.Dir(rel)], rel)
+		}
+		byFile[rel] = append(byFile[rel], chunk)
+	}
+	children := make(map[string][]string)
+	for dir := range dirFiles {
+		for dir != "." {
+			parent := filepath.Dir(dir)
+			if !slices.Contains(children[parent], dir) {
+				children[parent] = append(children[parent], dir)
+			}
+			dir = parent
+		}
+	}
+	dirs := []string{"."}
+	for _, subdirs := range children {
+		dirs = append(dirs, subdirs...)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if depth(dirs[i]) != depth(dirs[j]) {
+			return depth(dirs[i]) > depth(dirs[j])
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	for _, dir := range dirs {
+		sort.Strings(dirFiles[dir])
+		sort.Strings(children[dir])
+	}
+
+	// Each directory is summarized as soon as its subdirectories are, so
+	// directories that don't depend on each other are summarized
+	// concurrently, as many at once as the chat rate limit allows
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(map[string]chan struct{}, len(dirs))
+	for _, dir := range dirs {
+		done[dir] = make(chan struct{})
+	}
+	cache := loadSummaryCache(embeddingsPath)
+	summaries := make(map[string]DirectorySummary)
+	var mu sync.Mutex // Guards cache, summaries, started, and firstErr
+	var started int
+	var firstErr error
+	var wg sync.WaitGroup
+	for _, dir := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[dir])
+			for _, child := range children[dir] {
+				<-done[child]
+			}
+
+			mu.Lock()
+			if firstErr != nil {
+				mu.Unlock()
+				return
+			}
+			var subdirs []DirectorySummary
+			for _, child := range children[dir] {
+				subdirs = append(subdirs, summaries[child])
+			}
+			cached, ok := cache.Directories[dir]
+			started++
+			n := started
+			mu.Unlock()
+
+			prompt := buildDirectorySummaryPrompt(dir, dirFiles[dir], byFile, subdirs, options)
+			hash := sha256.Sum256([]byte(ChatModel + "\x00" + prompt))
+			key := hex.EncodeToString(hash[:])
+			if ok && cached.Hash == key {
+				cached.Summary.Cached = true
+				mu.Lock()
+				summaries[dir] = cached.Summary
+				mu.Unlock()
+				return
+			}
+
+			slog.Info("Summarizing directory", "dir", dir, "progress", fmt.Sprintf("%d/%d", n, len(dirs)))
+			summary, err := summarizeDirectory(ctx, dir, dirFiles[dir], prompt)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				// The first failure stops the directories still waiting
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			summary.Subdirectories = children[dir]
+			summaries[dir] = summary
+			cache.Directories[dir] = cachedDirectory{Hash: key, Summary: summary}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		// Directories summarized so far are kept for the next run
+		if err := cache.save(embeddingsPath); err != nil {
+			slog.Warn("Failed to save the summary cache", "path", SummaryCachePath(embeddingsPath), "error", err)
+		}
+		return DirectoryTree{}, firstErr
+	}
+
+	// Directories that are gone are dropped from the cache, except for those
+	// outside the focus
+	if len(options.Focus) == 0 && len(options.Exclude) == 0 {
+		for dir := range cache.Directories {
+			if _, ok := summaries[dir]; !ok {
+				delete(cache.Directories, dir)
+			}
+		}
+	}
+	embedSummaries(ctx, root, cache, dirs)
+	if err := cache.save(embeddingsPath); err != nil {
+		slog.Warn("Failed to save the summary cache", "path", SummaryCachePath(embeddingsPath), "error", err)
+	}
+
+	// Root first, each directory followed by its subdirectories
+	tree := DirectoryTree{Root: root}
+	var visit func(dir string)
+	visit = func(dir string) {
+		tree.Directories = append(tree.Directories, summaries[dir])
+		for _, child := range children[dir] {
+			visit(child)
+		}
+	}
+	visit(".")
+	return tree, nil
+}
+
+// embedSummaries embeds the summaries of dirs, and of their files, that
+// aren't embedded yet with the current embedding model, storing them in the
+// cache as chunks searched alongside the index. Summaries that fail to embed
+// are retried on the next run.
+func embedSummaries(ctx context.Context, root string, cache summaryCache, dirs []string) {
+	pending := make(map[string][]storage.CodeChunk)
+	var texts []string
+	for _, dir := range dirs {
+		cached := cache.Directories[dir]
+		if cached.Chunks != nil && cached.EmbeddingModel == string(embeddings.EmbeddingModel) {
+			continue
+		}
+		pending[dir] = summaryChunks(root, cached.Summary)
+		for _, chunk := range pending[dir] {
+			texts = append(texts, summaryEmbeddingText(chunk))
+		}
+	}
+	if len(texts) == 0 {
+		return
+	}
+
+	slog.Info("Embedding summaries", "summaries", len(texts))
+	embedded, err := embeddings.GetBatchEmbeddingsContext(ctx, texts, summaryEmbedBatchSize)
+	if err != nil {
+		slog.Warn("Failed to embed summaries, which won't be searchable until the next run", "error", err)
+		return
+	}
+	for dir, chunks := range pending {
+		kept := []storage.CodeChunk{}
+		for _, chunk := range chunks {
+			if chunk.Embedding = embedded[summaryEmbeddingText(chunk)]; len(chunk.Embedding) > 0 {
+				kept = append(kept, chunk)
+			}
+		}
+		cached := cache.Directories[dir]
+		cached.EmbeddingModel, cached.Chunks = string(embeddings.EmbeddingModel), kept
+		cache.Directories[dir] = cached
+	}
+}
+
+// summaryChunks returns the summary of a directory and those of its files as
+// chunks of SummaryKind, with paths as they are in the index
+func summaryChunks(root string, summary DirectorySummary) []storage.CodeChunk {
+	var chunks []storage.CodeChunk
+	if summary.Summary != "" {
+		header := "Summary of the directory " + filepath.ToSlash(summary.Path)
+		if summary.Path == "." {
+			header = "Summary of the repository"
+		}
+		chunks = append(chunks, storage.CodeChunk{
+			File:    filepath.Join(root, summary.Path),
+			Content: summary.Summary,
+			Context: header,
+			Kind:    storage.SummaryKind,
+		})
+	}
+	for _, file := range summary.Files {
+		if file.Summary == "" {
+			continue
+		}
+		chunks = append(chunks, storage.CodeChunk{
+			File:    filepath.Join(root, file.Path),
+			Content: file.Summary,
+			Context: "Summary of the file " + filepath.ToSlash(file.Path),
+			Kind:    storage.SummaryKind,
+		})
+	}
+	return chunks
+}
+
+// summaryEmbeddingText returns the text embedded for a summary chunk, laid
+// out like that of a code chunk
+func summaryEmbeddingText(chunk storage.CodeChunk) string {
+	return embeddings.CodeChunkMetadata{Filename: chunk.File, Content: chunk.Content, Context: chunk.Context}.EmbeddingText()
+}
+
+// SummaryChunks returns the embedded summaries of the directories and files
+// of an index, written by "summarize --per-directory", as chunks of
+// storage.SummaryKind to search alongside its code. Summaries embedded with
+// another embedding model than the current one are left out.
+func SummaryChunks(indexPath string) []storage.CodeChunk {
+	cache := loadSummaryCache(indexPath)
+	dirs := make([]string, 0, len(cache.Directories))
+	for dir := range cache.Directories {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var chunks []storage.CodeChunk
+	for _, dir := range dirs {
+		if cached := cache.Directories[dir]; cached.EmbeddingModel == string(embeddings.EmbeddingModel) {
+			chunks = append(chunks, cached.Chunks...)
+		}
+	}
+	return chunks
+}
+
+// summarizeDirectory asks the model for the summary of a directory and of
+// each of its files
+func summarizeDirectory(ctx context.Context, dir string, files []string, prompt string) (DirectorySummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	reply, err := chatCompletion(ctx, summarySystemPrompt, prompt, 1500, 0.2)
+	if err != nil {
+		return DirectorySummary{}, fmt.Errorf("failed to summarize %s: %v", dir, err)
+	}
+
+	reply = stripCodeFence(reply)
+
+	var parsed struct {
+		Summary string            `json:"summary"`
+		Files   map[string]string `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(reply), &parsed); err != nil {
+		return DirectorySummary{}, fmt.Errorf("failed to parse the summary of %s: %v", dir, err)
+	}
+
+	summary := DirectorySummary{Path: dir, Summary: strings.TrimSpace(parsed.Summary)}
+	for _, file := range files {
+		summary.Files = append(summary.Files, FileSummary{Path: file, Summary: strings.TrimSpace(parsed.Files[filepath.Base(file)])})
+	}
+	return summary, nil
+}
+
+// buildDirectorySummaryPrompt creates the prompt summarizing a directory
+// from its files and the summaries of its subdirectories
+func buildDirectorySummaryPrompt(dir string, files []string, byFile map[string][]storage.CodeChunk,
+	subdirs []DirectorySummary, options SummaryOptions) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are writing one page of a browsable architecture guide to a codebase, the page of a single directory. ")
+	sb.WriteString("Explain what the directory is for, its main abstractions, and how its files and subdirectories fit together, ")
+	sb.WriteString("so a developer can decide whether the code they're looking for is here. ")
+	switch options.DetailLevel {
+	case DetailBrief:
+		sb.WriteString("Keep the directory summary to one or two sentences.\n")
+	case DetailComprehensive:
+		sb.WriteString("Write the directory summary as a paragraph of up to six sentences, naming the key types and functions.\n")
+	default:
+		sb.WriteString("Keep the directory summary to two to four sentences.\n")
+	}
+
+	sb.WriteString("\nReply with only a JSON object of this form:\n")
+	sb.WriteString(`{"summary": "<what the directory is for>", "files": {"<file name>": "<one sentence on what the file does>"}}` + "\n")
+	if len(files) == 0 {
+		sb.WriteString("The directory has no files of its own, so leave files empty.\n")
+	}
+
+	name := dir
+	if dir == "." {
+		name = "the repository root"
+	}
+	sb.WriteString("\nDirectory: " + name + "\n")
+	if len(files) > 0 && len(byFile[files[0]]) > 0 && byFile[files[0]][0].Package != "" {
+		sb.WriteString("Package: " + byFile[files[0]][0].Package + "\n")
+	}
+
+	if len(subdirs) > 0 {
+		sb.WriteString("\nSubdirectories:\n")
+		for _, subdir := range subdirs {
+			sb.WriteString(fmt.Sprintf("- %s/: %s\n", filepath.Base(subdir.Path), subdir.Summary))
+		}
+	}
+
+	// The files share the rest of the budget, trimmed if need be
+	if len(files) > 0 {
+		sb.WriteString("\nFiles:\n")
+		var headers, contents []string
+		for _, file := range files {
+			var content []string
+			for _, chunk := range byFile[file] {
+				content = append(content, chunk.Content)
+			}
+			headers = append(headers, fmt.Sprintf("\n--- %s ---\n", filepath.Base(file)))
+			contents = append(contents, strings.Join(content, "\n...\n"))
+		}
+		limit := min(MaxPromptTokens, directorySummaryMaxTokens)
+		budget := newTokenBudget(limit - pricing.EstimateTokens(sb.String()))
+		for i, content := range budget.next().fitAll(headers, contents) {
+			if content == "" {
+				sb.WriteString(fmt.Sprintf("\n--- %s ---\n...[omitted to fit the token budget]...\n", filepath.Base(files[i])))
+				continue
+			}
+			sb.WriteString(headers[i] + content + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// relativePath returns a file's path relative to root, or the path as it
+// is if it isn't under root
+func relativePath(root, file string) string {
+	rel, err := filepath.Rel(root, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return rel
+}
+
+// depth returns how many directories deep a relative path is
+func depth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(dir), "/") + 1
+}
@@ -0,0 +1,99 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/exolottl/codie/internal/storage"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/formatters"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Lines of the file shown above and below a chunk
+const contextLines = 20
+
+// Lines shown above the chunk when the preview is scrolled to it
+const scrollMargin = 3
+
+var (
+	gutterStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	matchStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("212"))
+)
+
+// chunkPreview renders a chunk with the lines around it in its file,
+// syntax-highlighted and numbered, with the chunk's lines marked. It also
+// returns the line to scroll to so the chunk is in view. The chunk's own
+// content is shown when the file can't be read or has changed since it was
+// indexed.
+func chunkPreview(chunk storage.CodeChunk, height int) (string, int) {
+	first, last := chunk.StartLine, chunk.EndLine
+	var lines []string
+	if data, err := os.ReadFile(chunk.File); err == nil && first > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+	if len(lines) == 0 || last > len(lines) || !strings.Contains(strings.Join(lines[first-1:last], "\n"), strings.TrimSpace(chunk.Content)) {
+		lines = strings.Split(strings.TrimRight(chunk.Content, "\n"), "\n")
+		first, last = 1, len(lines)
+		if chunk.StartLine > 0 {
+			// Number the lines as they were indexed
+			return numberLines(highlight(chunk.File, lines), chunk.StartLine, chunk.StartLine, chunk.StartLine+len(lines)-1), 0
+		}
+		return numberLines(highlight(chunk.File, lines), 1, 0, -1), 0
+	}
+
+	from := max(1, first-contextLines)
+	to := min(len(lines), last+contextLines)
+	shown := highlight(chunk.File, lines[from-1:to])
+
+	// Keep a short chunk in the middle of the pane, and the start of a long one
+	offset := first - from - scrollMargin
+	if chunkHeight := last - first + 1; chunkHeight < height {
+		offset = first - from - (height-chunkHeight)/2
+	}
+	return numberLines(shown, from, first, last), max(0, offset)
+}
+
+// highlight colors lines of source code by the language of file, returning
+// them unchanged if the language is unknown
+func highlight(file string, lines []string) []string {
+	lexer := lexers.Match(file)
+	if lexer == nil {
+		return lines
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, strings.Join(lines, "\n"))
+	if err != nil {
+		return lines
+	}
+
+	var sb strings.Builder
+	if err := formatters.TTY256.Format(&sb, styles.Get("monokai"), iterator); err != nil {
+		return lines
+	}
+	highlighted := strings.Split(strings.TrimRight(sb.String(), "\n"), "\n")
+	if len(highlighted) != len(lines) {
+		return lines
+	}
+	return highlighted
+}
+
+// numberLines prefixes lines with their numbers, starting at start, marking
+// the lines from first to last
+func numberLines(lines []string, start, first, last int) string {
+	width := len(fmt.Sprint(start + len(lines) - 1))
+	var sb strings.Builder
+	for i, line := range lines {
+		n := start + i
+		marker := " "
+		if n >= first && n <= last {
+			marker = matchStyle.Render("▌")
+		}
+		sb.WriteString(gutterStyle.Render(fmt.Sprintf("%*d", width, n)))
+		sb.WriteString(marker + " " + line + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,448 @@
+// Package tui is an interactive terminal browser for search results: a
+// query box, a ranked result list, and a preview of the selected chunk in
+// its file, which can be swapped for a summary of the file.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/exolottl/codie/internal/search"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// SearchFunc returns the chunks most relevant to a query, best first
+type SearchFunc func(ctx context.Context, query string) ([]search.Result, error)
+
+// SummaryFunc returns a markdown summary of a file
+type SummaryFunc func(ctx context.Context, file string) (string, error)
+
+// EditorFunc returns the command opening a file at a line in an editor
+type EditorFunc func(file string, line int) (*exec.Cmd, error)
+
+// Run opens the browser on the terminal and returns when the user quits or
+// ctx is canceled. An initial query, if any, is searched right away.
+func Run(ctx context.Context, query string, searchFn SearchFunc, summaryFn SummaryFunc, editorFn EditorFunc) error {
+	m := newModel(ctx, query, searchFn, summaryFn, editorFn)
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	if err == tea.ErrProgramKilled && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Pane with keyboard focus
+type focus int
+
+const (
+	focusQuery focus = iota
+	focusResults
+)
+
+// Fraction of the width given to the result list
+const listWidthRatio = 0.4
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("212"))
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	borderStyle   = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, false, false, true).
+			BorderForeground(lipgloss.Color("238")).PaddingLeft(1)
+)
+
+// model is the state of the browser
+type model struct {
+	ctx       context.Context
+	searchFn  SearchFunc
+	summaryFn SummaryFunc
+	editorFn  EditorFunc
+
+	input   textinput.Model
+	preview viewport.Model
+	focus   focus
+
+	query    string // Query of the results shown
+	results  []search.Result
+	selected int
+	top      int // First result shown in the list
+
+	summaries   map[string]string // Summaries by file
+	showSummary bool
+	busy        string // What's being waited for, if anything
+	err         error
+
+	width, height int
+}
+
+// Messages of finished background work
+type (
+	resultsMsg struct {
+		query   string
+		results []search.Result
+		err     error
+	}
+	summaryMsg struct {
+		file    string
+		summary string
+		err     error
+	}
+	editorMsg struct {
+		err error
+	}
+)
+
+func newModel(ctx context.Context, query string, searchFn SearchFunc, summaryFn SummaryFunc, editorFn EditorFunc) model {
+	input := textinput.New()
+	input.Placeholder = "Search the codebase"
+	input.Prompt = "🔍 "
+	input.SetValue(query)
+	input.Focus()
+
+	m := model{
+		ctx:       ctx,
+		searchFn:  searchFn,
+		summaryFn: summaryFn,
+		editorFn:  editorFn,
+		input:     input,
+		preview:   viewport.New(0, 0),
+		summaries: make(map[string]string),
+	}
+	if strings.TrimSpace(query) != "" {
+		m.busy = "Searching..."
+	}
+	return m
+}
+
+func (m model) Init() tea.Cmd {
+	if strings.TrimSpace(m.input.Value()) != "" {
+		return tea.Batch(textinput.Blink, m.startSearch())
+	}
+	return textinput.Blink
+}
+
+// startSearch runs the query in the input box in the background
+func (m *model) startSearch() tea.Cmd {
+	query := strings.TrimSpace(m.input.Value())
+	if query == "" {
+		return nil
+	}
+	m.busy = "Searching..."
+	m.err = nil
+	ctx, searchFn := m.ctx, m.searchFn
+	return func() tea.Msg {
+		results, err := searchFn(ctx, query)
+		return resultsMsg{query, results, err}
+	}
+}
+
+// startSummary summarizes the selected result's file in the background,
+// unless its summary is already known
+func (m *model) startSummary() tea.Cmd {
+	if len(m.results) == 0 || m.summaryFn == nil {
+		return nil
+	}
+	file := m.results[m.selected].Chunk.File
+	m.showSummary = true
+	if _, ok := m.summaries[file]; ok {
+		m.updatePreview()
+		return nil
+	}
+	m.busy = "Summarizing " + file + "..."
+	m.err = nil
+	ctx, summaryFn := m.ctx, m.summaryFn
+	return func() tea.Msg {
+		summary, err := summaryFn(ctx, file)
+		return summaryMsg{file, summary, err}
+	}
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.input.Width = msg.Width - 4
+		m.layout()
+		return m, nil
+
+	case resultsMsg:
+		m.busy = ""
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.query, m.results = msg.query, msg.results
+		m.selected, m.top = 0, 0
+		m.showSummary = false
+		if len(m.results) > 0 {
+			m.focus = focusResults
+			m.input.Blur()
+		}
+		m.updatePreview()
+		return m, nil
+
+	case summaryMsg:
+		m.busy = ""
+		if msg.err != nil {
+			m.err = msg.err
+			m.showSummary = false
+			return m, nil
+		}
+		m.summaries[msg.file] = msg.summary
+		m.updatePreview()
+		return m, nil
+
+	case editorMsg:
+		m.err = msg.err
+		// The file may have been edited
+		m.updatePreview()
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.focus == focusQuery {
+			return m.updateQuery(msg)
+		}
+		return m.updateResults(msg)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// updateQuery handles a key typed in the query box
+func (m model) updateQuery(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		return m, m.startSearch()
+	case "tab", "esc":
+		if len(m.results) > 0 {
+			m.focus = focusResults
+			m.input.Blur()
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// updateResults handles a key pressed in the result list
+func (m model) updateResults(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q":
+		return m, tea.Quit
+	case "/", "tab":
+		m.focus = focusQuery
+		return m, m.input.Focus()
+	case "up", "k":
+		m.selectResult(m.selected - 1)
+	case "down", "j":
+		m.selectResult(m.selected + 1)
+	case "home", "g":
+		m.selectResult(0)
+	case "end", "G":
+		m.selectResult(len(m.results) - 1)
+	case "s":
+		if m.showSummary {
+			m.showSummary = false
+			m.updatePreview()
+			return m, nil
+		}
+		return m, m.startSummary()
+	case "o", "enter":
+		return m, m.openEditor()
+	case "esc":
+		if m.showSummary {
+			m.showSummary = false
+			m.updatePreview()
+		}
+	default:
+		// Page keys and the mouse wheel scroll the preview
+		var cmd tea.Cmd
+		m.preview, cmd = m.preview.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// openEditor suspends the browser to open the selected result in the editor
+func (m *model) openEditor() tea.Cmd {
+	if len(m.results) == 0 || m.editorFn == nil {
+		return nil
+	}
+	chunk := m.results[m.selected].Chunk
+	command, err := m.editorFn(chunk.File, chunk.StartLine)
+	if err != nil {
+		m.err = err
+		return nil
+	}
+	return tea.ExecProcess(command, func(err error) tea.Msg { return editorMsg{err} })
+}
+
+// selectResult moves the selection to result i, keeping it in view
+func (m *model) selectResult(i int) {
+	if len(m.results) == 0 {
+		return
+	}
+	i = max(0, min(i, len(m.results)-1))
+	if i == m.selected {
+		return
+	}
+	m.selected = i
+	m.showSummary = false
+	m.scrollList()
+	m.updatePreview()
+}
+
+// scrollList scrolls the result list so the selected result is visible
+func (m *model) scrollList() {
+	visible := m.visibleResults()
+	if m.selected < m.top {
+		m.top = m.selected
+	} else if m.selected >= m.top+visible {
+		m.top = m.selected - visible + 1
+	}
+}
+
+// visibleResults is the number of results that fit in the list pane, at two
+// lines each
+func (m model) visibleResults() int {
+	return max(1, m.paneHeight()/2)
+}
+
+// layout sizes the panes to the window
+func (m *model) layout() {
+	m.preview.Width = max(0, m.width-m.listWidth()-2)
+	m.preview.Height = max(0, m.paneHeight())
+	m.scrollList()
+	m.updatePreview()
+}
+
+// listWidth is the width of the result list pane
+func (m model) listWidth() int {
+	return int(float64(m.width) * listWidthRatio)
+}
+
+// paneHeight is the height of the result list and preview panes, below the
+// query box and above the status line
+func (m model) paneHeight() int {
+	return m.height - 3
+}
+
+// updatePreview shows the selected result in its file, or its file's summary
+func (m *model) updatePreview() {
+	if len(m.results) == 0 || m.preview.Width == 0 {
+		m.preview.SetContent("")
+		return
+	}
+	chunk := m.results[m.selected].Chunk
+
+	if summary, ok := m.summaries[chunk.File]; ok && m.showSummary {
+		rendered := summary
+		renderer, err := glamour.NewTermRenderer(glamour.WithStandardStyle("dark"), glamour.WithWordWrap(m.preview.Width-4))
+		if err == nil {
+			if out, err := renderer.Render(summary); err == nil {
+				rendered = out
+			}
+		}
+		m.preview.SetContent(truncateLines(rendered, m.preview.Width))
+		m.preview.GotoTop()
+		return
+	}
+
+	content, offset := chunkPreview(chunk, m.preview.Height)
+	m.preview.SetContent(truncateLines(content, m.preview.Width))
+	m.preview.SetYOffset(offset)
+}
+
+func (m model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	list := lipgloss.NewStyle().Width(m.listWidth()).Height(m.paneHeight()).Render(m.listView())
+	preview := borderStyle.Height(m.paneHeight()).Render(m.preview.View())
+	panes := lipgloss.JoinHorizontal(lipgloss.Top, list, preview)
+
+	return m.input.View() + "\n\n" + panes + "\n" + m.statusView()
+}
+
+// listView renders the results that fit in the list pane
+func (m model) listView() string {
+	if len(m.results) == 0 {
+		if m.query != "" {
+			return dimStyle.Render("No results for " + m.query)
+		}
+		return dimStyle.Render("Type a query and press enter")
+	}
+
+	visible := m.visibleResults()
+	width := m.listWidth() - 1
+	var lines []string
+	for i := m.top; i < min(len(m.results), m.top+visible); i++ {
+		result := m.results[i]
+		chunk := result.Chunk
+		location := chunk.File
+		if chunk.StartLine > 0 {
+			location = fmt.Sprintf("%s:%d-%d", chunk.File, chunk.StartLine, chunk.EndLine)
+		}
+		symbol := chunk.Function
+		if chunk.Class != "" && symbol != "" {
+			symbol = chunk.Class + "." + symbol
+		} else if symbol == "" {
+			symbol = chunk.Class
+		}
+
+		title := ansi.Truncate(fmt.Sprintf("%d. %s", i+1, location), width, "…")
+		detail := ansi.Truncate(fmt.Sprintf("   %.3f %s", result.Score, symbol), width, "…")
+		if i == m.selected {
+			title = selectedStyle.Render(title)
+		}
+		lines = append(lines, title, dimStyle.Render(detail))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// statusView renders the status line: what's being waited for, the last
+// error, or the keys that apply
+func (m model) statusView() string {
+	var status string
+	switch {
+	case m.busy != "":
+		status = m.busy
+	case m.err != nil:
+		return errorStyle.Render(ansi.Truncate("Error: "+m.err.Error(), m.width, "…"))
+	case m.focus == focusQuery:
+		status = "enter search • tab results • ctrl+c quit"
+	case m.showSummary:
+		status = "↑/↓ select • pgup/pgdn scroll • s/esc code • o open • / search • q quit"
+	default:
+		status = "↑/↓ select • pgup/pgdn scroll • s summarize file • o open • / search • q quit"
+	}
+	if len(m.results) > 0 {
+		status = titleStyle.Render(fmt.Sprintf("%d/%d", m.selected+1, len(m.results))) + "  " + status
+	}
+	return dimStyle.Render(ansi.Truncate(status, m.width, "…"))
+}
+
+// truncateLines cuts every line of text to width columns, as the preview
+// doesn't wrap
+func truncateLines(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = ansi.Truncate(line, width, "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,124 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/exolottl/codie/internal/pricing"
+)
+
+// ModelUsage holds the API requests and tokens used for a single model
+type ModelUsage struct {
+	Model            string  `json:"model"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"estimated_cost_usd"`
+}
+
+// Report summarizes the API usage of a run
+type Report struct {
+	Time      time.Time    `json:"time"`
+	Command   string       `json:"command"`
+	Models    []ModelUsage `json:"models"`
+	Requests  int          `json:"requests"`
+	Tokens    int          `json:"tokens"`
+	TotalCost float64      `json:"estimated_cost_usd"`
+}
+
+// Tracker accumulates API usage reported by responses
+type Tracker struct {
+	mu     sync.Mutex
+	models map[string]*ModelUsage
+}
+
+// NewTracker creates an empty usage tracker
+func NewTracker() *Tracker {
+	return &Tracker{models: make(map[string]*ModelUsage)}
+}
+
+// Record adds one request's token usage for a model
+func (t *Tracker) Record(model string, promptTokens, completionTokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.models[model]
+	if !ok {
+		entry = &ModelUsage{Model: model}
+		t.models[model] = entry
+	}
+	entry.Requests++
+	entry.PromptTokens += promptTokens
+	entry.CompletionTokens += completionTokens
+}
+
+// Report returns a snapshot of the usage recorded so far
+func (t *Tracker) Report(command string) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := Report{Time: time.Now(), Command: command}
+	for _, entry := range t.models {
+		model := *entry
+		model.Cost = pricing.EstimateCost(model.Model, model.PromptTokens, model.CompletionTokens)
+
+		report.Models = append(report.Models, model)
+		report.Requests += model.Requests
+		report.Tokens += model.PromptTokens + model.CompletionTokens
+		report.TotalCost += model.Cost
+	}
+
+	sort.Slice(report.Models, func(i, j int) bool {
+		return report.Models[i].Model < report.Models[j].Model
+	})
+	return report
+}
+
+// Global tracker for API calls made by this process
+var defaultTracker = NewTracker()
+
+// Record adds one request's token usage to the global tracker
+func Record(model string, promptTokens, completionTokens int) {
+	defaultTracker.Record(model, promptTokens, completionTokens)
+}
+
+// Snapshot returns the global tracker's usage report
+func Snapshot(command string) Report {
+	return defaultTracker.Report(command)
+}
+
+// Print writes a human-readable usage summary
+func (r Report) Print(w io.Writer) {
+	if r.Requests == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\nAPI usage:")
+	for _, model := range r.Models {
+		fmt.Fprintf(w, "  %-24s %5d requests  %9d tokens  $%.4f\n",
+			model.Model, model.Requests, model.PromptTokens+model.CompletionTokens, model.Cost)
+	}
+	fmt.Fprintf(w, "  %-24s %5d requests  %9d tokens  $%.4f\n", "Total", r.Requests, r.Tokens, r.TotalCost)
+}
+
+// AppendToLog appends the report as a JSON line to the given file
+func AppendToLog(path string, report Report) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
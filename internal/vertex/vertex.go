@@ -0,0 +1,260 @@
+// Package vertex calls Google Vertex AI for text embeddings and Gemini chat
+// completions, authenticating with Application Default Credentials: a
+// service account key in GOOGLE_APPLICATION_CREDENTIALS, the credentials of
+// "gcloud auth application-default login", or the metadata server on GCP
+package vertex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/exolottl/codie/internal/httpclient"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// OAuth scope of the Vertex AI API
+const scope = "https://www.googleapis.com/auth/cloud-platform"
+
+// Most texts embedded in one request, and the most tokens they may add up to
+const (
+	maxEmbedTexts  = 250
+	maxEmbedTokens = 20000
+)
+
+// Tokens of a text an embedding model reads; longer texts are truncated
+const maxTextTokens = 2048
+
+// Project and Location are the Google Cloud project and region requests go
+// to. An empty Project falls back to GOOGLE_CLOUD_PROJECT and then to the
+// project of the credentials.
+var (
+	Project  = ""
+	Location = "us-central1"
+)
+
+var (
+	mu          sync.Mutex
+	tokenSource oauth2.TokenSource
+	project     string
+)
+
+// Credentials finds the Application Default Credentials and project, so a
+// missing login is reported before any work is done
+func Credentials(ctx context.Context) error {
+	_, _, err := credentials(ctx)
+	return err
+}
+
+// credentials returns a cached token source and the project requests go to
+func credentials(ctx context.Context) (oauth2.TokenSource, string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if tokenSource != nil {
+		return tokenSource, project, nil
+	}
+
+	// Tokens are fetched through the configured proxy, also when the cached
+	// token source refreshes them after this request is done
+	ctx = context.WithValue(context.WithoutCancel(ctx), oauth2.HTTPClient, httpclient.New())
+	creds, err := google.FindDefaultCredentials(ctx, scope)
+	if err != nil {
+		return nil, "", fmt.Errorf("no Google Cloud credentials found (run gcloud auth application-default login or set GOOGLE_APPLICATION_CREDENTIALS): %v", err)
+	}
+	project = Project
+	if project == "" {
+		project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if project == "" {
+		project = creds.ProjectID
+	}
+	if project == "" {
+		return nil, "", fmt.Errorf("no Google Cloud project set; set vertex_project or GOOGLE_CLOUD_PROJECT")
+	}
+	tokenSource = creds.TokenSource
+	return tokenSource, project, nil
+}
+
+// call posts a request to a method of a Google publisher model and decodes the reply
+func call(ctx context.Context, model, method string, request, reply any) error {
+	tokens, project, err := credentials(ctx)
+	if err != nil {
+		return err
+	}
+	token, err := tokens.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get a Google Cloud access token: %v", err)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	host := Location + "-aiplatform.googleapis.com"
+	if Location == "global" {
+		host = "aiplatform.googleapis.com"
+	}
+	url := fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:%s",
+		host, project, Location, model, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	token.SetAuthHeader(req)
+
+	resp, err := httpclient.New().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &failure) == nil && failure.Error.Message != "" {
+			message = failure.Error.Message
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// Matched by callers to back off longer
+			return fmt.Errorf("vertex rate limit exceeded: %s", message)
+		}
+		return fmt.Errorf("vertex returned %s: %s", resp.Status, message)
+	}
+	if err := json.Unmarshal(data, reply); err != nil {
+		return fmt.Errorf("failed to parse Vertex response: %v", err)
+	}
+	return nil
+}
+
+// Embed embeds texts with a text embedding model such as text-embedding-004.
+// The task type is RETRIEVAL_DOCUMENT for indexed text or RETRIEVAL_QUERY
+// for search queries. It returns the vectors in the order of the texts and
+// the tokens read.
+func Embed(ctx context.Context, model string, texts []string, taskType string) ([][]float32, int, error) {
+	var vectors [][]float32
+	tokens := 0
+	for start := 0; start < len(texts); {
+		// Fill a request up to the limits on texts and tokens
+		end, estimate := start, 0
+		for end < len(texts) && end-start < maxEmbedTexts {
+			textTokens := min(len(texts[end])/4+1, maxTextTokens)
+			if end > start && estimate+textTokens > maxEmbedTokens {
+				break
+			}
+			estimate += textTokens
+			end++
+		}
+
+		batchVectors, batchTokens, err := embedBatch(ctx, model, texts[start:end], taskType)
+		if err != nil {
+			return nil, tokens, err
+		}
+		vectors = append(vectors, batchVectors...)
+		tokens += batchTokens
+		start = end
+	}
+	return vectors, tokens, nil
+}
+
+// embedBatch sends one predict request for texts within the request limits
+func embedBatch(ctx context.Context, model string, texts []string, taskType string) ([][]float32, int, error) {
+	type instance struct {
+		Content  string `json:"content"`
+		TaskType string `json:"task_type"`
+	}
+	request := struct {
+		Instances  []instance     `json:"instances"`
+		Parameters map[string]any `json:"parameters"`
+	}{Parameters: map[string]any{"autoTruncate": true}}
+	for _, text := range texts {
+		request.Instances = append(request.Instances, instance{Content: text, TaskType: taskType})
+	}
+
+	var reply struct {
+		Predictions []struct {
+			Embeddings struct {
+				Values     []float32 `json:"values"`
+				Statistics struct {
+					TokenCount float64 `json:"token_count"`
+				} `json:"statistics"`
+			} `json:"embeddings"`
+		} `json:"predictions"`
+	}
+	if err := call(ctx, model, "predict", request, &reply); err != nil {
+		return nil, 0, err
+	}
+	if len(reply.Predictions) != len(texts) {
+		return nil, 0, fmt.Errorf("vertex returned %d embeddings for %d texts", len(reply.Predictions), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	tokens := 0
+	for i, prediction := range reply.Predictions {
+		vectors[i] = prediction.Embeddings.Values
+		tokens += int(prediction.Embeddings.Statistics.TokenCount)
+	}
+	return vectors, tokens, nil
+}
+
+// Generate asks a Gemini model for a reply to a system and user prompt. It
+// returns the reply and the prompt and reply tokens.
+func Generate(ctx context.Context, model, systemPrompt, prompt string, maxTokens int, temperature float32) (string, int, int, error) {
+	type part struct {
+		Text string `json:"text"`
+	}
+	type content struct {
+		Role  string `json:"role,omitempty"`
+		Parts []part `json:"parts"`
+	}
+	request := map[string]any{
+		"systemInstruction": content{Parts: []part{{Text: systemPrompt}}},
+		"contents":          []content{{Role: "user", Parts: []part{{Text: prompt}}}},
+		"generationConfig": map[string]any{
+			"maxOutputTokens": maxTokens,
+			"temperature":     temperature,
+		},
+	}
+
+	var reply struct {
+		Candidates []struct {
+			Content      content `json:"content"`
+			FinishReason string  `json:"finishReason"`
+		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := call(ctx, model, "generateContent", request, &reply); err != nil {
+		return "", 0, 0, err
+	}
+	usage := reply.UsageMetadata
+
+	if len(reply.Candidates) == 0 {
+		return "", usage.PromptTokenCount, usage.CandidatesTokenCount, fmt.Errorf("empty response from Gemini")
+	}
+	var sb strings.Builder
+	for _, p := range reply.Candidates[0].Content.Parts {
+		sb.WriteString(p.Text)
+	}
+	if sb.Len() == 0 {
+		return "", usage.PromptTokenCount, usage.CandidatesTokenCount, fmt.Errorf("empty response from Gemini (finish reason %s)", reply.Candidates[0].FinishReason)
+	}
+	return sb.String(), usage.PromptTokenCount, usage.CandidatesTokenCount, nil
+}
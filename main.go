@@ -3,18 +3,13 @@ package main
 import (
 	"log"
 	"os"
+	"slices"
 	
-	"codie/cmd"
-	"codie/internal/config"
+	"github.com/exolottl/codie/cmd"
+	"github.com/exolottl/codie/internal/config"
 )
 
 func main() {
-	// Initialize configuration with API key validation
-	err := config.Init()
-	if err != nil {
-		log.Fatalf("Configuration error: %v", err)
-	}
-
 	if len(os.Args) < 2 {
 		cmd.PrintUsage()
 		os.Exit(1)
@@ -22,6 +17,24 @@ func main() {
 	
 	command := os.Args[1]
 	
+	// Load settings from .codie.yaml, CODIE_* variables, and flags
+	settings, err := config.LoadSettings(os.Args[2:])
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+	cmd.ApplySettings(settings)
+	
+	// Export spans when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	finishTracing := cmd.StartTracing(command)
+	
+	// Initialize configuration with API key validation
+	if requiresAPIKey(command, os.Args[2:]) {
+		err := config.Init(settings, usesChat(command, os.Args[2:]))
+		if err != nil {
+			log.Fatalf("Configuration error: %v", err)
+		}
+	}
+	
 	switch command {
 	case "help":
 		cmd.PrintUsage()
@@ -29,10 +42,16 @@ func main() {
 	case "index":
 		// Check if directory is provided
 		if len(os.Args) < 3 {
-			log.Fatal("Usage: go run main.go index <directory>")
+			log.Fatal("Usage: go run main.go index <directory> [options]")
 		}
 		dir := os.Args[2]
-		cmd.IndexCodebase(dir)
+		cmd.IndexCodebase(dir, os.Args[3:])
+		
+	case "workspace":
+		cmd.Workspace(os.Args[2:])
+		
+	case "clean":
+		cmd.Clean(os.Args[2:])
 		
 	case "summarize":
 		// Check if directory is provided
@@ -42,10 +61,207 @@ func main() {
 		dir := os.Args[2]
 		cmd.SummarizeCodebase(dir, os.Args[3:])
 		
+	case "summarize-file":
+		// Check if file is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go summarize-file <path> [options]")
+		}
+		path := os.Args[2]
+		cmd.SummarizeFile(path, os.Args[3:])
+		
+	case "summarize-diff":
+		cmd.SummarizeDiff(os.Args[2:])
+		
+	case "pr-summary":
+		cmd.PRSummary(os.Args[2:])
+		
+	case "commit-msg":
+		cmd.CommitMsg(os.Args[2:])
+		
+	case "changelog":
+		cmd.Changelog(os.Args[2:])
+		
+	case "review":
+		cmd.Review(os.Args[2:])
+		
+	case "ci":
+		cmd.CI(os.Args[2:])
+		
+	case "search":
+		// Check if query is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go search <query> [options]")
+		}
+		query := os.Args[2]
+		cmd.SearchCodebase(query, os.Args[3:])
+		
+	case "ask":
+		// Check if a question is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go ask <question> [options]")
+		}
+		cmd.Ask(os.Args[2], os.Args[3:])
+		
+	case "owners":
+		// Check if a query or path is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go owners <query|path> [options]")
+		}
+		cmd.Owners(os.Args[2], os.Args[3:])
+		
+	case "similar":
+		// Check if a file is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go similar <file>[:start-end] [options]")
+		}
+		cmd.FindSimilar(os.Args[2], os.Args[3:])
+		
+	case "tui":
+		cmd.TUI(os.Args[2:])
+		
+	case "clusters":
+		cmd.Clusters(os.Args[2:])
+		
+	case "diagram":
+		cmd.Diagram(os.Args[2:])
+		
+	case "graph":
+		cmd.Graph(os.Args[2:])
+		
+	case "rank":
+		cmd.Rank(os.Args[2:])
+		
+	case "metrics":
+		cmd.Metrics(os.Args[2:])
+		
+	case "debt":
+		cmd.Debt(os.Args[2:])
+		
+	case "document":
+		// Check if a file or package is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go document <path> [--write]")
+		}
+		cmd.Document(os.Args[2], os.Args[3:])
+		
+	case "serve":
+		cmd.Serve(os.Args[2:])
+		
+	case "daemon":
+		cmd.Daemon(os.Args[2:])
+		
+	case "lsp":
+		cmd.LSP(os.Args[2:])
+		
+	case "auth":
+		// Check if subcommand is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go auth <login|logout>")
+		}
+		cmd.Auth(os.Args[2])
+		
+	case "api-report":
+		// Check if directory is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go api-report <directory> [options]")
+		}
+		dir := os.Args[2]
+		cmd.APIReport(dir, os.Args[3:])
+		
+	case "stats":
+		cmd.Stats(os.Args[2:])
+		
+	case "errors":
+		cmd.Errors(os.Args[2:])
+		
+	case "prune":
+		cmd.Prune(os.Args[2:])
+		
+	case "remove":
+		cmd.Remove(os.Args[2:])
+		
+	case "export":
+		cmd.Export(os.Args[2:])
+		
+	case "import":
+		cmd.Import(os.Args[2:])
+		
+	case "migrate":
+		cmd.Migrate(os.Args[2:])
+		
+	case "bench":
+		// Check if directory is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go bench <directory> [options]")
+		}
+		dir := os.Args[2]
+		cmd.Bench(dir, os.Args[3:])
+		
+	case "quicklook":
+		// Check if directory is provided
+		if len(os.Args) < 3 {
+			log.Fatal("Usage: go run main.go quicklook <directory> [options]")
+		}
+		dir := os.Args[2]
+		cmd.QuickLook(dir, os.Args[3:])
+		
 	default:
 		// For backward compatibility, treat the first arg as directory
 		// if it doesn't match a known command
 		dir := os.Args[1]
-		cmd.IndexCodebase(dir)
+		cmd.IndexCodebase(dir, os.Args[2:])
+	}
+	
+	// Print tokens and estimated cost spent by this run
+	cmd.ReportUsage(command, os.Args[2:])
+	finishTracing()
+}
+
+// requiresAPIKey reports whether a command needs a validated API key
+func requiresAPIKey(command string, args []string) bool {
+	switch command {
+	case "help", "auth", "stats", "prune", "remove", "export", "import", "clean", "bench", "errors", "migrate", "graph", "rank", "metrics":
+		return false
+	case "workspace":
+		// Only adding a repository embeds anything
+		return len(args) > 0 && args[0] == "add"
+	case "debt":
+		// Only the remediation plan is written by the model
+		return slices.Contains(args, "--plan")
+	case "diagram":
+		// Only architectural clusters are named by the model
+		return slices.Contains(args, "--label")
+	}
+	for _, arg := range args {
+		// A pull request summary is still generated when only posting is skipped
+		if arg == "--dry-run" && command != "pr-summary" {
+			return false
+		}
+		// The API report only calls the model to describe symbols
+		if arg == "--describe" {
+			return true
+		}
+		// Clusters are only labeled by the model
+		if arg == "--no-label" && command == "clusters" {
+			return false
+		}
+	}
+	return command != "api-report"
+}
+
+// usesChat reports whether a command calls the chat model, whose OpenAI key
+// is needed even when embeddings come from another provider
+func usesChat(command string, args []string) bool {
+	switch command {
+	case "index", "similar", "owners", "workspace":
+		return false
+	case "search":
+		for _, arg := range args {
+			if arg == "--rerank" {
+				return true
+			}
+		}
+		return false
 	}
-}
\ No newline at end of file
+	return true
+}
@@ -0,0 +1,407 @@
+// Package index splits source files into semantic chunks and embeds them,
+// producing the chunks stored in a codie index.
+//
+// Embeddings are requested from OpenAI, the default provider, with the key in
+// OPENAI_API_KEY or the keys in OPENAI_API_KEYS. The provider settings of the
+// codie command aren't read.
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/exolottl/codie/internal/config"
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/fileutils"
+	"github.com/exolottl/codie/internal/gitdiff"
+	"github.com/exolottl/codie/internal/metrics"
+	"github.com/exolottl/codie/internal/progress"
+	"github.com/exolottl/codie/internal/tracing"
+	"github.com/exolottl/codie/pkg/store"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Options control chunking and embedding
+type Options struct {
+	MaxChunkSize int // Maximum characters per chunk
+	ChunkOverlap int // Lines of context repeated between consecutive chunks
+	BatchSize    int // Most chunks per embedding request, which also packs them up to embeddings.BatchTokens
+	Workers      int // Files processed concurrently; 0 uses the number of CPUs
+
+	// Limits that keep huge or generated files from dominating the index;
+	// 0 disables each. Files over a limit are reported in Result.Skipped.
+	MaxFileSize      int64 // Bytes; applied by Directory
+	MaxChunksPerFile int
+	MaxTotalChunks   int // Chunks embedded by one call of Files or Directory
+
+	// MaxChunksInFlight, when positive, bounds the chunks the workers of
+	// Files hold at once, from embedding until Sink returns. A file waits
+	// for room before its chunks are embedded; one with more chunks than
+	// the bound waits until no other file is in flight.
+	MaxChunksInFlight int
+
+	// Chunks left under MaxTotalChunks, shared by the workers of Files
+	budget *atomic.Int64
+
+	// Chunks held under MaxChunksInFlight, shared by the workers of Files
+	inFlight *chunkLimit
+
+	// Commit, when set, is recorded on every chunk as the revision it was
+	// indexed at
+	Commit string
+
+	// Provenance records on the chunks of files read from disk the git
+	// blob hash of the file and, from git blame, the latest commit to
+	// change each chunk's lines. Files git can't blame get only the hash.
+	Provenance bool
+
+	// Repo, when set, namespaces every chunk under a workspace repository
+	Repo string
+
+	// Root is the directory being indexed. Chunks of files that declare no
+	// package are given their directory relative to it. Directory sets it
+	// when unset.
+	Root string
+
+	// Progress, when set, is called from worker goroutines after each file
+	// is processed, with the file's error if it failed
+	Progress func(file string, err error)
+
+	// Sink, when set, receives each file's chunks from worker goroutines as
+	// soon as the file is processed, instead of collecting them in
+	// Result.Chunks. A Sink error fails the file.
+	Sink func(file string, chunks []store.Chunk) error
+}
+
+// DefaultOptions returns the options "codie index" uses without configuration
+func DefaultOptions() Options {
+	defaults := config.DefaultSettings()
+	return Options{
+		MaxChunkSize: defaults.MaxChunkSize,
+		ChunkOverlap: defaults.ChunkOverlap,
+		BatchSize:    defaults.BatchSize,
+		Workers:      defaults.Workers,
+		MaxFileSize:  defaults.MaxFileSize,
+	}
+}
+
+// ErrChunkLimit fails files that would take a run past Options.MaxTotalChunks
+var ErrChunkLimit = errors.New("reached max_total_chunks")
+
+// Skipped is a file left out by one of the limits in Options
+type Skipped struct {
+	File   string
+	Reason string
+}
+
+// FileError is the error of a file that failed to index
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("error processing %s: %v", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Result is the outcome of indexing a set of files
+type Result struct {
+	Files      int           // Files processed
+	Chunks     []store.Chunk // Chunks of the files that succeeded, unless Options.Sink is set
+	ChunkCount int           // Chunks produced, including those passed to Options.Sink
+	Errors     []error       // One *FileError per file that failed
+	Skipped    []Skipped     // Files over a size or chunk limit
+}
+
+// Directory indexes the code files under dir, skipping the directories and
+// ignore patterns "codie index" skips
+func Directory(ctx context.Context, dir string, options Options) (Result, error) {
+	_, span := tracing.Start(ctx, "discover files", attribute.String("codie.directory", dir))
+	files, err := fileutils.GetCodeFiles(dir)
+	span.SetAttributes(attribute.Int("codie.files", len(files)))
+	tracing.End(span, err)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to scan directory: %w", err)
+	}
+
+	files, oversized := fileutils.LimitFileSize(files, options.MaxFileSize)
+	if options.Root == "" {
+		options.Root = dir
+	}
+	result, err := Files(ctx, files, options)
+	for _, file := range oversized {
+		result.Skipped = append(result.Skipped, Skipped{File: file.Path, Reason: file.Reason})
+	}
+	return result, err
+}
+
+// Files chunks and embeds files concurrently. Failures of individual files
+// are collected in the result; the error is set only when ctx is canceled.
+func Files(ctx context.Context, files []string, options Options) (Result, error) {
+	numWorkers := options.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+
+	if options.MaxTotalChunks > 0 {
+		options.budget = new(atomic.Int64)
+		options.budget.Store(int64(options.MaxTotalChunks))
+	}
+
+	if options.MaxChunksInFlight > 0 {
+		options.inFlight = newChunkLimit(options.MaxChunksInFlight)
+	}
+
+	// Files are queued only as workers free up and outcomes are collected
+	// as files finish, so nothing is buffered per file of the run
+	filesChan := make(chan string, numWorkers)
+	result := Result{Files: len(files)}
+	var mu sync.Mutex
+
+	// Launch worker pool
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range filesChan {
+				// Drain the queue without working once canceled
+				if ctx.Err() != nil {
+					continue
+				}
+
+				chunks, held, err := indexFile(ctx, file, options)
+				if err == nil && options.Sink != nil {
+					err = options.Sink(file, chunks)
+				}
+				options.inFlight.release(held)
+
+				mu.Lock()
+				if errors.Is(err, embeddings.ErrTooManyChunks) || errors.Is(err, ErrChunkLimit) {
+					result.Skipped = append(result.Skipped, Skipped{File: file, Reason: err.Error()})
+					metrics.FilesIndexed.WithLabelValues("skipped").Inc()
+				} else if err != nil {
+					err = &FileError{File: file, Err: err}
+					result.Errors = append(result.Errors, err)
+					metrics.FilesIndexed.WithLabelValues("error").Inc()
+				} else {
+					result.ChunkCount += len(chunks)
+					if options.Sink == nil {
+						result.Chunks = append(result.Chunks, chunks...)
+					}
+					metrics.FilesIndexed.WithLabelValues("ok").Inc()
+				}
+				mu.Unlock()
+				if options.Progress != nil {
+					options.Progress(file, err)
+				}
+			}
+		}()
+	}
+
+	// Queue files for processing
+	for _, file := range files {
+		filesChan <- file
+	}
+	close(filesChan)
+
+	// Wait for all workers to finish
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// File reads, chunks, and embeds a single file
+func File(ctx context.Context, file string, options Options) ([]store.Chunk, error) {
+	chunks, held, err := indexFile(ctx, file, options)
+	options.inFlight.release(held)
+	return chunks, err
+}
+
+// indexFile is File, leaving the chunks it holds under
+// Options.MaxChunksInFlight for the caller to release
+func indexFile(ctx context.Context, file string, options Options) (chunks []store.Chunk, held int, err error) {
+	ctx, span := tracing.Start(ctx, "index file", attribute.String("codie.file", file))
+	defer func() {
+		span.SetAttributes(attribute.Int("codie.chunks", len(chunks)))
+		tracing.End(span, err)
+	}()
+
+	content, err := fileutils.ReadFileContent(file)
+	if err != nil {
+		progress.Report(ctx, progress.Event{Stage: progress.Chunking, Items: 1})
+		return nil, 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	chunks, held, err = indexContent(ctx, file, content, options)
+	if err == nil && options.Provenance {
+		addProvenance(ctx, file, content, chunks)
+	}
+	return chunks, held, err
+}
+
+// addProvenance records the blob hash of the file's content on its chunks,
+// and the latest commit to change each chunk's lines
+func addProvenance(ctx context.Context, file, content string, chunks []store.Chunk) {
+	_, span := tracing.Start(ctx, "blame", attribute.String("codie.file", file))
+	blob := gitdiff.BlobHash(content)
+	lines, err := gitdiff.BlameLines(filepath.Dir(file), filepath.Base(file))
+	tracing.End(span, err)
+	for i := range chunks {
+		chunks[i].Blob = blob
+		for line := chunks[i].StartLine; line <= chunks[i].EndLine; line++ {
+			if change, ok := lines[line]; ok && change.Time.After(chunks[i].LastChanged) {
+				chunks[i].LastCommit = change.Commit
+				chunks[i].LastAuthor = change.Author
+				chunks[i].LastChanged = change.Time
+			}
+		}
+	}
+}
+
+// Content chunks and embeds a file's content, such as the file at an older
+// revision. Chunks whose embedding failed are left out.
+func Content(ctx context.Context, file, content string, options Options) ([]store.Chunk, error) {
+	chunks, held, err := indexContent(ctx, file, content, options)
+	options.inFlight.release(held)
+	return chunks, err
+}
+
+// indexContent is Content, leaving the chunks it holds under
+// Options.MaxChunksInFlight for the caller to release
+func indexContent(ctx context.Context, file, content string, options Options) ([]store.Chunk, int, error) {
+	// Split code into semantic chunks with their scope metadata
+	_, span := tracing.Start(ctx, "chunk", attribute.String("codie.file", file))
+	start := time.Now()
+	chunkedCode, err := embeddings.ExtractCodeChunks(file, content, embeddings.ChunkOptions{
+		MaxChunkSize: options.MaxChunkSize,
+		Overlap:      options.ChunkOverlap,
+		MaxChunks:    options.MaxChunksPerFile,
+		Root:         options.Root,
+	})
+	span.SetAttributes(attribute.Int("codie.chunks", len(chunkedCode)))
+	tracing.End(span, err)
+	chunked := progress.Event{Stage: progress.Chunking, Items: 1, Duration: time.Since(start)}
+	if err != nil {
+		progress.Report(ctx, chunked)
+		return nil, 0, err
+	}
+	if len(chunkedCode) == 0 {
+		progress.Report(ctx, chunked)
+		return nil, 0, nil // No valid chunks found
+	}
+
+	// Claim the file's chunks from the index's budget before paying to
+	// embed them
+	if budget := options.budget; budget != nil {
+		n := int64(len(chunkedCode))
+		if budget.Add(-n) < 0 {
+			budget.Add(n)
+			progress.Report(ctx, chunked)
+			return nil, 0, fmt.Errorf("%w of %d; %d chunks left out", ErrChunkLimit, options.MaxTotalChunks, n)
+		}
+	}
+	chunked.Chunks = len(chunkedCode)
+	progress.Report(ctx, chunked)
+
+	// Wait for room among the chunks in flight before holding the file's
+	// embedding texts and embeddings as well
+	held := options.inFlight.acquire(len(chunkedCode))
+
+	// Prepare data for batch processing. The scope header is embedded along
+	// with the code, but only the raw code is stored as the chunk content.
+	var chunksToEmbed []string
+	fileChunks := make([]store.Chunk, len(chunkedCode))
+
+	for i, chunk := range chunkedCode {
+		chunksToEmbed = append(chunksToEmbed, chunk.EmbeddingText())
+		fileChunks[i] = store.Chunk{
+			File:      file,
+			Package:   chunk.Package,
+			Function:  chunk.Function,
+			Class:     chunk.Class,
+			StartLine: chunk.StartLine,
+			EndLine:   chunk.EndLine,
+			Content:   chunk.Content,
+			Context:   chunk.Context,
+			Imports:   chunk.Imports,
+			Calls:     chunk.Calls,
+			Commit:    options.Commit,
+			Repo:      options.Repo,
+			// Embedding will be added later
+		}
+	}
+
+	// Get embeddings for all chunks in batch
+	embedMap, err := embeddings.GetBatchEmbeddingsContext(ctx, chunksToEmbed, options.BatchSize)
+	if err != nil {
+		return nil, held, fmt.Errorf("failed to get embeddings: %w", err)
+	}
+
+	// Associate embeddings with their chunks
+	var validChunks []store.Chunk
+	for i, chunk := range fileChunks {
+		if embedding, ok := embedMap[chunksToEmbed[i]]; ok {
+			chunk.Embedding = embedding
+			validChunks = append(validChunks, chunk)
+		}
+	}
+
+	return validChunks, held, nil
+}
+
+// chunkLimit bounds the chunks held across workers, as a semaphore counting
+// chunks
+type chunkLimit struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int
+	held int
+}
+
+func newChunkLimit(max int) *chunkLimit {
+	l := &chunkLimit{max: max}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until n more chunks fit under the limit and holds them,
+// returning the count to release. More chunks than the limit wait for all
+// of it. A nil limit holds nothing.
+func (l *chunkLimit) acquire(n int) int {
+	if l == nil {
+		return 0
+	}
+	n = min(n, l.max)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.held+n > l.max {
+		l.cond.Wait()
+	}
+	l.held += n
+	return n
+}
+
+// release gives back chunks held by acquire
+func (l *chunkLimit) release(n int) {
+	if l == nil || n == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.held -= n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
@@ -0,0 +1,39 @@
+// Package search ranks indexed code chunks by semantic similarity to a query.
+//
+// Queries are embedded with OpenAI, the default provider, using the key in
+// OPENAI_API_KEY or the keys in OPENAI_API_KEYS. The provider settings of the
+// codie command aren't read.
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/exolottl/codie/internal/embeddings"
+	"github.com/exolottl/codie/internal/search"
+	"github.com/exolottl/codie/pkg/store"
+)
+
+// Result is a chunk and its cosine similarity to the query
+type Result = search.Result
+
+// Query embeds a natural-language query and returns the k chunks most similar to it, best first
+func Query(ctx context.Context, chunks []store.Chunk, query string, k int) ([]Result, error) {
+	embedding, err := embeddings.GetQueryEmbeddingContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return Similar(ctx, chunks, embedding, k)
+}
+
+// Similar returns the k chunks most similar to an embedding, best first
+func Similar(ctx context.Context, chunks []store.Chunk, embedding []float32, k int) ([]Result, error) {
+	var results []Result
+	for result := range search.Stream(ctx, chunks, embedding, k) {
+		results = append(results, result)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
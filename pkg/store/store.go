@@ -0,0 +1,48 @@
+// Package store reads and writes codie index files: code chunks with their
+// embeddings under a header recording how they were built, as written by
+// "codie index". Indexes written before the header existed, bare JSON arrays
+// of chunks, are read too.
+package store
+
+import (
+	"github.com/exolottl/codie/internal/storage"
+)
+
+// Chunk is a span of code from one file with its scope metadata and embedding
+type Chunk = storage.CodeChunk
+
+// Header records the schema version, embedding model and dimensions,
+// chunker version, root, and commit of an index, and when it was written
+type Header = storage.Header
+
+// LockedError is returned by Save and DeleteByFile when another process is
+// writing the index; its PID and Command name that process
+type LockedError = storage.LockedError
+
+// Load reads the chunks of an index file. An index of a newer schema
+// version than this package writes is refused.
+func Load(path string) ([]Chunk, error) {
+	return storage.LoadFromJSON(path)
+}
+
+// LoadHeader reads the header of an index file without its chunks
+func LoadHeader(path string) (Header, error) {
+	return storage.LoadHeader(path)
+}
+
+// Save writes chunks to an index file, replacing it
+func Save(path string, chunks []Chunk) error {
+	return storage.SaveToJSON(chunks, path)
+}
+
+// DeleteByFile removes the chunks of the given files, and of every file under
+// the given directories, from an index file. It returns the number of chunks
+// removed and leaves the file untouched when none match.
+func DeleteByFile(path string, files ...string) (int, error) {
+	return (&storage.JSONStore{Path: path}).DeleteByFile(files...)
+}
+
+// RootDir returns the deepest directory containing every chunk's file
+func RootDir(chunks []Chunk) string {
+	return storage.RootDir(chunks)
+}
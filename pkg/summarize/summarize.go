@@ -0,0 +1,72 @@
+// Package summarize writes natural-language summaries of an indexed codebase
+// and answers questions about it.
+//
+// Requests go to OpenAI, the default provider, with the key in OPENAI_API_KEY
+// or the keys in OPENAI_API_KEYS. The provider settings of the codie command
+// aren't read.
+package summarize
+
+import (
+	"context"
+
+	"github.com/exolottl/codie/internal/summarization"
+	"github.com/exolottl/codie/pkg/search"
+	"github.com/exolottl/codie/pkg/store"
+)
+
+// Options select the kind and depth of a summary
+type Options = summarization.SummaryOptions
+
+// Result is a codebase summary with its sections, metadata, and token usage
+type Result = summarization.SummaryResult
+
+// Mode and DetailLevel are the types of Options.Mode and Options.DetailLevel
+type (
+	Mode        = summarization.Mode
+	DetailLevel = summarization.DetailLevel
+)
+
+// Modes lists the values of Options.Mode
+var Modes = summarization.SummaryModes
+
+// DetailLevels lists the values of Options.DetailLevel
+var DetailLevels = summarization.DetailLevels
+
+// DefaultOptions returns a standard-detail overview with metrics
+func DefaultOptions() Options {
+	return summarization.DefaultSummaryOptions()
+}
+
+// Repository summarizes the codebase in an index file
+func Repository(ctx context.Context, indexPath string, options Options) (Result, error) {
+	return summarization.GenerateRepoSummary(ctx, indexPath, options)
+}
+
+// File summarizes one indexed file, with an outline of the indexed files it imports
+func File(ctx context.Context, indexPath, filePath string, options Options) (string, error) {
+	return summarization.GenerateFileSummary(ctx, indexPath, filePath, options)
+}
+
+// SummaryChunks returns the embedded directory and file summaries of an
+// index, written by "codie summarize --per-directory", to pass to Ask along
+// with the index's chunks
+func SummaryChunks(indexPath string) []store.Chunk {
+	return summarization.SummaryChunks(indexPath)
+}
+
+// Ask answers a question from the k chunks most relevant to it (k <= 0 uses
+// a default), returning the answer and the chunks it was based on
+func Ask(ctx context.Context, chunks []store.Chunk, question string, k int) (string, []search.Result, error) {
+	return summarization.AnswerQuestion(ctx, chunks, question, summarization.AskOptions{TopK: k})
+}
+
+// AskOptions choose the chunks a question is answered from: how many, how
+// similar to the question they must be, and how many tokens they may take
+type AskOptions = summarization.AskOptions
+
+// AskWithOptions answers a question like Ask, with the chunks chosen by
+// options. When no chunk is similar enough, the answer says so and no
+// chunks are returned.
+func AskWithOptions(ctx context.Context, chunks []store.Chunk, question string, options AskOptions) (string, []search.Result, error) {
+	return summarization.AnswerQuestion(ctx, chunks, question, options)
+}
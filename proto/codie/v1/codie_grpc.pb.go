@@ -0,0 +1,293 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: codie/v1/codie.proto
+
+package codiev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Codie_Index_FullMethodName        = "/codie.v1.Codie/Index"
+	Codie_Search_FullMethodName       = "/codie.v1.Codie/Search"
+	Codie_SearchStream_FullMethodName = "/codie.v1.Codie/SearchStream"
+	Codie_Ask_FullMethodName          = "/codie.v1.Codie/Ask"
+	Codie_Summarize_FullMethodName    = "/codie.v1.Codie/Summarize"
+)
+
+// CodieClient is the client API for Codie service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Codie indexes a codebase and answers questions about it
+type CodieClient interface {
+	// Index chunks and embeds a directory, replacing the server's index
+	Index(ctx context.Context, in *IndexRequest, opts ...grpc.CallOption) (*IndexResponse, error)
+	// Search returns the indexed chunks most similar to a query
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// SearchStream sends the same results as Search, best first, each as soon
+	// as it is ranked rather than in one response
+	SearchStream(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchResult], error)
+	// Ask answers a question from the most relevant indexed code
+	Ask(ctx context.Context, in *AskRequest, opts ...grpc.CallOption) (*AskResponse, error)
+	// Summarize generates a summary of the indexed codebase or one file
+	Summarize(ctx context.Context, in *SummarizeRequest, opts ...grpc.CallOption) (*SummarizeResponse, error)
+}
+
+type codieClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCodieClient(cc grpc.ClientConnInterface) CodieClient {
+	return &codieClient{cc}
+}
+
+func (c *codieClient) Index(ctx context.Context, in *IndexRequest, opts ...grpc.CallOption) (*IndexResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IndexResponse)
+	err := c.cc.Invoke(ctx, Codie_Index_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *codieClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, Codie_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *codieClient) SearchStream(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Codie_ServiceDesc.Streams[0], Codie_SearchStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchRequest, SearchResult]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Codie_SearchStreamClient = grpc.ServerStreamingClient[SearchResult]
+
+func (c *codieClient) Ask(ctx context.Context, in *AskRequest, opts ...grpc.CallOption) (*AskResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AskResponse)
+	err := c.cc.Invoke(ctx, Codie_Ask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *codieClient) Summarize(ctx context.Context, in *SummarizeRequest, opts ...grpc.CallOption) (*SummarizeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SummarizeResponse)
+	err := c.cc.Invoke(ctx, Codie_Summarize_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CodieServer is the server API for Codie service.
+// All implementations must embed UnimplementedCodieServer
+// for forward compatibility.
+//
+// Codie indexes a codebase and answers questions about it
+type CodieServer interface {
+	// Index chunks and embeds a directory, replacing the server's index
+	Index(context.Context, *IndexRequest) (*IndexResponse, error)
+	// Search returns the indexed chunks most similar to a query
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// SearchStream sends the same results as Search, best first, each as soon
+	// as it is ranked rather than in one response
+	SearchStream(*SearchRequest, grpc.ServerStreamingServer[SearchResult]) error
+	// Ask answers a question from the most relevant indexed code
+	Ask(context.Context, *AskRequest) (*AskResponse, error)
+	// Summarize generates a summary of the indexed codebase or one file
+	Summarize(context.Context, *SummarizeRequest) (*SummarizeResponse, error)
+	mustEmbedUnimplementedCodieServer()
+}
+
+// UnimplementedCodieServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCodieServer struct{}
+
+func (UnimplementedCodieServer) Index(context.Context, *IndexRequest) (*IndexResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Index not implemented")
+}
+func (UnimplementedCodieServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedCodieServer) SearchStream(*SearchRequest, grpc.ServerStreamingServer[SearchResult]) error {
+	return status.Error(codes.Unimplemented, "method SearchStream not implemented")
+}
+func (UnimplementedCodieServer) Ask(context.Context, *AskRequest) (*AskResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Ask not implemented")
+}
+func (UnimplementedCodieServer) Summarize(context.Context, *SummarizeRequest) (*SummarizeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Summarize not implemented")
+}
+func (UnimplementedCodieServer) mustEmbedUnimplementedCodieServer() {}
+func (UnimplementedCodieServer) testEmbeddedByValue()               {}
+
+// UnsafeCodieServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CodieServer will
+// result in compilation errors.
+type UnsafeCodieServer interface {
+	mustEmbedUnimplementedCodieServer()
+}
+
+func RegisterCodieServer(s grpc.ServiceRegistrar, srv CodieServer) {
+	// If the following call panics, it indicates UnimplementedCodieServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Codie_ServiceDesc, srv)
+}
+
+func _Codie_Index_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CodieServer).Index(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Codie_Index_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CodieServer).Index(ctx, req.(*IndexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Codie_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CodieServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Codie_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CodieServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Codie_SearchStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CodieServer).SearchStream(m, &grpc.GenericServerStream[SearchRequest, SearchResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Codie_SearchStreamServer = grpc.ServerStreamingServer[SearchResult]
+
+func _Codie_Ask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CodieServer).Ask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Codie_Ask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CodieServer).Ask(ctx, req.(*AskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Codie_Summarize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SummarizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CodieServer).Summarize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Codie_Summarize_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CodieServer).Summarize(ctx, req.(*SummarizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Codie_ServiceDesc is the grpc.ServiceDesc for Codie service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Codie_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "codie.v1.Codie",
+	HandlerType: (*CodieServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Index",
+			Handler:    _Codie_Index_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _Codie_Search_Handler,
+		},
+		{
+			MethodName: "Ask",
+			Handler:    _Codie_Ask_Handler,
+		},
+		{
+			MethodName: "Summarize",
+			Handler:    _Codie_Summarize_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SearchStream",
+			Handler:       _Codie_SearchStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "codie/v1/codie.proto",
+}